@@ -2,15 +2,20 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/urfave/cli/v2"
 	"github.com/weisdd/lfgw/internal/lfgw"
+	"github.com/weisdd/lfgw/internal/querymodifier"
 )
 
 var (
 	commit    = "none"
+	date      = "unknown"
 	goVersion = "unknown"
 	version   = "dev"
 )
@@ -18,7 +23,15 @@ var (
 func main() {
 	app := &cli.App{
 		Name:    "lfgw",
-		Version: fmt.Sprintf("%s (commit: %s; runtime: %s)", version, commit, goVersion),
+		Version: fmt.Sprintf("%s (commit: %s; date: %s; runtime: %s)", version, commit, date, goVersion),
+		Metadata: map[string]interface{}{
+			lfgw.BuildInfoMetadataKey: lfgw.BuildInfo{
+				Version:   version,
+				Commit:    commit,
+				Date:      date,
+				GoVersion: goVersion,
+			},
+		},
 		Authors: []*cli.Author{
 			{
 				Name: "weisdd",
@@ -27,13 +40,18 @@ func main() {
 		Copyright: "© 2021-2022 weisdd",
 		HelpName:  "lfgw",
 		Usage:     "A reverse proxy aimed at PromQL / MetricsQL metrics filtering based on OIDC roles",
-		UsageText: "lfgw [flags]",
+		UsageText: "lfgw [flags]\n   lfgw acl from-k8s --role <role> --selector <label selector>\n   lfgw check-acl [--strict] <path>\n   lfgw rewrite (--role <role> | --acl <definition>) <query>\n   lfgw migrate --from <format> <path>",
 		// UseShortOptionHandling: true,
 		// EnableBashCompletion:   true,
 		HideHelpCommand: true,
 		Action:          lfgw.Run,
 		Before: func(c *cli.Context) error {
-			nonEmptyStrings := []string{"upstream-url", "oidc-realm-url", "oidc-client-id"}
+			// Subcommands are not related to the proxy, thus its settings are not validated
+			if c.App.Command(c.Args().First()) != nil {
+				return nil
+			}
+
+			nonEmptyStrings := []string{"upstream-url", "oidc-realm-url", "oidc-client-id", "enforced-label"}
 
 			for _, key := range nonEmptyStrings {
 				if c.String(key) == "" {
@@ -41,30 +59,605 @@ func main() {
 				}
 			}
 
-			if c.String("acl-path") == "" && !c.Bool("assumed-roles") {
-				return fmt.Errorf("the app cannot run without at least one configuration source: defined acl-path or assumed-roles set to true")
+			if c.String("upstream-redirects") != "rewrite" && c.String("upstream-redirects") != "follow" {
+				return fmt.Errorf("upstream-redirects must be either rewrite or follow")
+			}
+
+			if c.String("upstream-sigv4-region") != "" && c.String("upstream-sigv4-service") == "" {
+				return fmt.Errorf("upstream-sigv4-service must not be empty when upstream-sigv4-region is set")
+			}
+
+			if c.String("route-prefix") != "" && !strings.HasPrefix(c.String("route-prefix"), "/") {
+				return fmt.Errorf("route-prefix must start with /")
+			}
+
+			if c.String("external-url") != "" {
+				u, err := url.Parse(c.String("external-url"))
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("external-url must be an absolute http(s) URL")
+				}
+			}
+
+			if c.String("ui-path-prefix") != "" && !strings.HasPrefix(c.String("ui-path-prefix"), "/") {
+				return fmt.Errorf("ui-path-prefix must start with /")
+			}
+
+			if c.String("request-tag-mode") != "param" && c.String("request-tag-mode") != "comment" {
+				return fmt.Errorf("request-tag-mode must be either param or comment")
+			}
+
+			if c.String("request-tag") != "" && c.String("request-tag-mode") == "param" {
+				if param := c.String("request-tag-param"); param == "" || param == "query" || param == "match[]" {
+					return fmt.Errorf("request-tag-param cannot be empty, query or match[]")
+				}
+			}
+
+			if c.Bool("fault-injection") && c.String("admin-token") == "" {
+				return fmt.Errorf("fault-injection requires admin-token")
+			}
+
+			for _, key := range []string{"slo-availability-target", "slo-latency-target"} {
+				if c.Float64(key) < 0 || c.Float64(key) >= 1 {
+					return fmt.Errorf("%s must be within [0, 1)", key)
+				}
+			}
+
+			if c.String("acl-source") != "file" && c.String("acl-source") != "kubernetes" && c.String("acl-source") != "kubernetes-rbac" {
+				return fmt.Errorf("acl-source must be one of file, kubernetes or kubernetes-rbac")
+			}
+
+			if c.String("kubernetes-rbac-username-claim") != "email" && c.String("kubernetes-rbac-username-claim") != "sub" {
+				return fmt.Errorf("kubernetes-rbac-username-claim must be either email or sub")
+			}
+
+			if c.String("acl-source") == "kubernetes-rbac" && c.Duration("kubernetes-rbac-cache-ttl") <= 0 {
+				return fmt.Errorf("kubernetes-rbac-cache-ttl must be positive")
+			}
+
+			if c.String("acl-source") == "file" && c.String("acl-path") == "" && !c.Bool("assumed-roles") {
+				return fmt.Errorf("the app cannot run without at least one configuration source: defined acl-path, acl-source set to kubernetes or assumed-roles set to true")
+			}
+
+			if len(c.StringSlice("roles-claim")) == 0 {
+				return fmt.Errorf("roles-claim cannot be empty")
+			}
+
+			if (c.String("assumed-roles-prefix") != "" || c.String("assumed-roles-pattern") != "") && !c.Bool("assumed-roles") {
+				return fmt.Errorf("assumed-roles-prefix and assumed-roles-pattern require assumed-roles set to true")
+			}
+
+			if _, err := querymodifier.NewAssumedRoles(c.String("assumed-roles-prefix"), c.String("assumed-roles-pattern")); err != nil {
+				return err
+			}
+
+			if c.Bool("assumed-roles-verify-namespaces") && !c.Bool("assumed-roles") {
+				return fmt.Errorf("assumed-roles-verify-namespaces requires assumed-roles set to true")
+			}
+
+			if c.Bool("assumed-roles-verify-namespaces") && c.Duration("assumed-roles-cache-ttl") <= 0 {
+				return fmt.Errorf("assumed-roles-cache-ttl must be positive")
+			}
+
+			if c.String("default-role") != "" && c.String("default-acl") != "" {
+				return fmt.Errorf("default-role and default-acl cannot be used together")
+			}
+
+			for _, ns := range c.StringSlice("shared-namespaces") {
+				if ns == "" || strings.HasPrefix(ns, "!") {
+					return fmt.Errorf("shared-namespaces cannot contain empty or denied (!) values")
+				}
+			}
+
+			if len(c.StringSlice("shared-namespaces")) > 0 {
+				acl, err := querymodifier.NewACL(strings.Join(c.StringSlice("shared-namespaces"), ", "))
+				if err != nil {
+					return fmt.Errorf("invalid shared-namespaces: %w", err)
+				}
+				if acl.Fullaccess {
+					return fmt.Errorf("shared-namespaces cannot grant full access")
+				}
+			}
+
+			if c.Bool("acl-auto-reload") && (c.String("acl-source") != "file" || c.String("acl-path") == "" || c.String("acl-configmap") != "") {
+				return fmt.Errorf("acl-auto-reload requires acl-source set to file and acl-path to be set (acl-configmap is watched anyway)")
+			}
+
+			if c.String("acl-configmap") != "" && c.String("acl-source") != "file" {
+				return fmt.Errorf("acl-configmap cannot be combined with acl-source set to %s", c.String("acl-source"))
+			}
+
+			if c.String("acl-url") != "" {
+				if c.String("acl-source") != "file" || c.String("acl-configmap") != "" || c.Bool("acl-auto-reload") {
+					return fmt.Errorf("acl-url cannot be combined with other ACL sources (acl-source, acl-configmap, acl-auto-reload)")
+				}
+
+				u, err := url.Parse(c.String("acl-url"))
+				if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+					return fmt.Errorf("acl-url must be an absolute http(s) URL")
+				}
+
+				if c.Duration("acl-url-refresh-interval") <= 0 {
+					return fmt.Errorf("acl-url-refresh-interval must be positive")
+				}
+			}
+
+			if c.Duration("acl-consistency-check-interval") > 0 && (c.String("keycloak-admin-client-id") == "" || c.String("keycloak-admin-client-secret") == "") {
+				return fmt.Errorf("acl-consistency-check-interval requires keycloak-admin-client-id and keycloak-admin-client-secret to be set")
+			}
+
+			if c.Duration("keycloak-role-sync-interval") > 0 {
+				if c.String("keycloak-admin-client-id") == "" || c.String("keycloak-admin-client-secret") == "" {
+					return fmt.Errorf("keycloak-role-sync-interval requires keycloak-admin-client-id and keycloak-admin-client-secret to be set")
+				}
+
+				if c.String("keycloak-role-sync-pattern") == "" {
+					return fmt.Errorf("keycloak-role-sync-interval requires keycloak-role-sync-pattern to be set")
+				}
+
+				if c.String("acl-source") == "kubernetes-rbac" {
+					return fmt.Errorf("keycloak-role-sync-interval cannot be combined with acl-source set to kubernetes-rbac")
+				}
+			}
+
+			if _, err := regexp.Compile(c.String("keycloak-role-sync-pattern")); err != nil {
+				return fmt.Errorf("failed to compile keycloak-role-sync-pattern: %w", err)
+			}
+
+			switch c.String("claims-adapter") {
+			case "", "azure-ad", "google":
+			default:
+				return fmt.Errorf("claims-adapter must be either azure-ad or google")
+			}
+
+			if c.Bool("azure-ad-graph-lookup") {
+				if c.String("claims-adapter") != "azure-ad" {
+					return fmt.Errorf("azure-ad-graph-lookup requires claims-adapter to be set to azure-ad")
+				}
+
+				if c.String("azure-ad-tenant-id") == "" || c.String("azure-ad-client-id") == "" || c.String("azure-ad-client-secret") == "" {
+					return fmt.Errorf("azure-ad-graph-lookup requires azure-ad-tenant-id, azure-ad-client-id and azure-ad-client-secret to be set")
+				}
+			}
+
+			if len(c.StringSlice("google-hosted-domains")) > 0 && c.String("claims-adapter") != "google" {
+				return fmt.Errorf("google-hosted-domains requires claims-adapter to be set to google")
+			}
+
+			if c.Duration("canary-interval") > 0 {
+				hasClientCredentials := c.String("canary-client-id") != "" && c.String("canary-client-secret") != ""
+				if c.String("canary-queries") == "" || (c.String("canary-token") == "" && !hasClientCredentials) {
+					return fmt.Errorf("canary-interval requires canary-queries and either canary-token or canary-client-id and canary-client-secret to be set")
+				}
+			}
+
+			if c.String("canary-token") != "" && c.String("canary-client-id") != "" {
+				return fmt.Errorf("canary-token cannot be combined with canary-client-id")
+			}
+
+			if c.String("profile-watchdog-dir") != "" {
+				if c.Uint64("profile-watchdog-rss-bytes") == 0 && c.Int("profile-watchdog-goroutines") <= 0 {
+					return fmt.Errorf("profile-watchdog-dir requires profile-watchdog-rss-bytes or profile-watchdog-goroutines to be set")
+				}
+
+				if c.Duration("profile-watchdog-interval") <= 0 {
+					return fmt.Errorf("profile-watchdog-interval must be positive")
+				}
+			}
+
+			if c.Float64("execution-trace-sample-rate") < 0 || c.Float64("execution-trace-sample-rate") > 1 {
+				return fmt.Errorf("execution-trace-sample-rate must be within [0, 1]")
+			}
+
+			if c.String("request-id-header") == "" {
+				return fmt.Errorf("request-id-header must not be empty")
+			}
+
+			if c.Float64("log-sampling-rate") <= 0 || c.Float64("log-sampling-rate") > 1 {
+				return fmt.Errorf("log-sampling-rate must be within (0, 1]")
+			}
+
+			if c.Duration("slow-request-threshold") < 0 {
+				return fmt.Errorf("slow-request-threshold must not be negative")
+			}
+
+			if c.Int("oidc-cache-size") < 0 {
+				return fmt.Errorf("oidc-cache-size must not be negative")
+			}
+
+			if c.Int("oidc-cache-size") > 0 && c.Duration("oidc-cache-ttl") <= 0 {
+				return fmt.Errorf("oidc-cache-ttl must be positive")
+			}
+
+			if c.Int("request-snapshots") < 0 {
+				return fmt.Errorf("request-snapshots must not be negative")
+			}
+
+			if c.String("vault-addr") != "" && c.String("vault-token") == "" && c.String("vault-kubernetes-role") == "" {
+				return fmt.Errorf("vault-addr requires either vault-token or vault-kubernetes-role to be set")
+			}
+
+			switch c.String("log-format") {
+			case "pretty", "json", "logfmt", "combined":
+			default:
+				return fmt.Errorf("log-format must be one of: pretty, json, logfmt, combined")
+			}
+
+			if c.Duration("log-file-max-age") < 0 {
+				return fmt.Errorf("log-file-max-age must not be negative")
+			}
+
+			if c.Int("log-file-max-backups") < 0 {
+				return fmt.Errorf("log-file-max-backups must not be negative")
+			}
+
+			if c.String("syslog-address") != "" && c.String("log-file") != "" {
+				return fmt.Errorf("syslog-address and log-file are mutually exclusive")
+			}
+
+			switch c.String("role-metrics") {
+			case "", "role", "hash":
+			default:
+				return fmt.Errorf("role-metrics must be one of: role, hash (or empty to disable)")
+			}
+
+			switch c.String("non-api-paths-policy") {
+			case "pass", "block", "fullaccess":
+			default:
+				return fmt.Errorf("non-api-paths-policy must be one of: pass, block, fullaccess")
+			}
+
+			for _, prefix := range c.StringSlice("api-path-prefixes") {
+				if !strings.HasPrefix(prefix, "/") {
+					return fmt.Errorf("api-path-prefixes must start with /, got %q", prefix)
+				}
+			}
+
+			if c.Bool("protect-metrics") && c.String("admin-token") == "" {
+				return fmt.Errorf("protect-metrics requires admin-token to be set")
+			}
+
+			switch c.String("unlabeled-metrics-policy") {
+			case querymodifier.UnlabeledPolicyInject, querymodifier.UnlabeledPolicySkip, querymodifier.UnlabeledPolicyReject:
+			default:
+				return fmt.Errorf("unlabeled-metrics-policy must be one of: inject, skip, reject")
+			}
+
+			if _, err := querymodifier.NewUnlabeledMetricsRegexp(c.StringSlice("unlabeled-metrics")); err != nil {
+				return err
+			}
+
+			if c.String("secondary-admin-token") != "" && c.String("admin-token") == "" {
+				return fmt.Errorf("secondary-admin-token requires admin-token to be set")
+			}
+
+			if c.String("api-keys-path") != "" {
+				if c.String("admin-token") == "" {
+					return fmt.Errorf("api-keys-path requires admin-token to be set")
+				}
+			}
+
+			if len(c.StringSlice("cluster-peers")) > 0 || c.String("cluster-service") != "" {
+				if len(c.StringSlice("cluster-peers")) > 0 && c.String("cluster-service") != "" {
+					return fmt.Errorf("cluster-peers and cluster-service are mutually exclusive")
+				}
+
+				if c.String("admin-token") == "" {
+					return fmt.Errorf("clustering requires admin-token to be set")
+				}
+
+				if scheme := c.String("cluster-peer-scheme"); scheme != "http" && scheme != "https" {
+					return fmt.Errorf("cluster-peer-scheme must be either http or https")
+				}
+
+				for _, peer := range c.StringSlice("cluster-peers") {
+					u, err := url.Parse(peer)
+					if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+						return fmt.Errorf("cluster-peers contains an invalid URL: %q", peer)
+					}
+				}
+
+				if c.String("cluster-service") != "" {
+					namespace, name, ok := strings.Cut(c.String("cluster-service"), "/")
+					if !ok || namespace == "" || name == "" {
+						return fmt.Errorf("cluster-service must be in the form of namespace/name")
+					}
+				}
 			}
 
 			return nil
 		},
+		Commands: []*cli.Command{
+			{
+				Name:      "check-acl",
+				Usage:     "validate an ACL file and print normalized label filters of every role, exits with a non-zero code if the file is invalid",
+				ArgsUsage: "<path>",
+				Action:    lfgw.CheckACL,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "enforced-label",
+						Usage:    "label to enforce by default",
+						EnvVars:  []string{"ENFORCED_LABEL"},
+						Value:    "namespace",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "strict",
+						Usage:    "whether to treat deprecation warnings as errors",
+						Required: false,
+					},
+				},
+			},
+			{
+				Name:      "rewrite",
+				Usage:     "print a query rewritten for the roles or an ACL definition (and its optimized form) without running the proxy",
+				ArgsUsage: "<query>",
+				Action:    lfgw.RewriteQuery,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "acl-path",
+						Usage:    "path to a file with ACL definitions, used with role",
+						EnvVars:  []string{"ACL_PATH"},
+						Value:    "./acl.yaml",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "role",
+						Usage:    "role to rewrite the query for, can be repeated",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "acl",
+						Usage:    "ACL definition (same syntax as in acl.yaml) to rewrite the query for, cannot be combined with role",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "enforced-label",
+						Usage:    "label to enforce by default",
+						EnvVars:  []string{"ENFORCED_LABEL"},
+						Value:    "namespace",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "enable-deduplication",
+						Usage:    "whether to enable deduplication",
+						EnvVars:  []string{"ENABLE_DEDUPLICATION"},
+						Value:    true,
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "shared-namespaces",
+						Usage:    "comma-separated list of label values appended to every ACL without full access",
+						EnvVars:  []string{"SHARED_NAMESPACES"},
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "unlabeled-metrics",
+						Usage:    "comma-separated list of regular expressions matching metrics that don't carry the enforced label",
+						EnvVars:  []string{"UNLABELED_METRICS"},
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "unlabeled-metrics-policy",
+						Usage:    "how to handle selectors of unlabeled metrics: inject, skip or reject",
+						EnvVars:  []string{"UNLABELED_METRICS_POLICY"},
+						Value:    "inject",
+						Required: false,
+					},
+				},
+			},
+			{
+				Name:      "migrate",
+				Usage:     "convert the configuration of a similar proxy into acl.yaml",
+				ArgsUsage: "<path>",
+				Action:    lfgw.MigrateACL,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "from",
+						Usage:    "format of the configuration: path-tenancy (tenants with path prefixes and series selectors) or label-values (tenants with lists of label values)",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "label",
+						Usage:    "label tenants are separated by (namespace if empty), label-values configurations might set it themselves",
+						Required: false,
+					},
+				},
+			},
+			{
+				Name:  "acl",
+				Usage: "ACL helpers",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "from-k8s",
+						Usage:  "print a role definition granting access to namespaces matching a label selector (namespaces are listed through kubeconfig)",
+						Action: lfgw.ACLFromKubernetes,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "role",
+								Usage:    "name of the role to generate",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "selector",
+								Usage:    "label selector of namespaces, e.g. team=foo",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "label",
+								Usage:    "label to enforce instead of the default one (namespace)",
+								Required: false,
+							},
+							&cli.StringFlag{
+								Name:     "kubeconfig",
+								Usage:    "path to kubeconfig (KUBECONFIG or ~/.kube/config if empty)",
+								Required: false,
+							},
+						},
+					},
+				},
+			},
+		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "upstream-url",
 				Usage:    "Prometheus URL, e.g. http://prometheus.localhost",
 				EnvVars:  []string{"UPSTREAM_URL"},
-				Required: true,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "upstream-redirects",
+				Usage:    "how to handle upstream redirects: rewrite (Location headers pointing to the upstream are rewritten to lfgw) or follow (redirects within the upstream are followed server-side)",
+				EnvVars:  []string{"UPSTREAM_REDIRECTS"},
+				Value:    "rewrite",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "upstream-sigv4-region",
+				Usage:    "AWS region upstream requests are signed for with SigV4, e.g. for Amazon Managed Service for Prometheus (credentials are taken from the environment: IRSA or AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY), requests are not signed if empty",
+				EnvVars:  []string{"UPSTREAM_SIGV4_REGION"},
+				Value:    "",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "upstream-sigv4-service",
+				Usage:    "AWS service upstream requests are signed for with SigV4",
+				EnvVars:  []string{"UPSTREAM_SIGV4_SERVICE"},
+				Value:    "aps",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "sentry-dsn",
+				Usage:    "DSN of Sentry (or a compatible service, e.g. GlitchTip) panics, upstream proxy errors and OIDC verification failures are reported to, disabled if empty",
+				EnvVars:  []string{"SENTRY_DSN"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "sentry-environment",
+				Usage:    "environment reported errors are tagged with, e.g. production",
+				EnvVars:  []string{"SENTRY_ENVIRONMENT"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "vault-addr",
+				Usage:    "address of the HashiCorp Vault server secrets referenced as vault:<path>#<key> are fetched from, e.g. https://vault.example.com:8200",
+				EnvVars:  []string{"VAULT_ADDR"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "vault-token",
+				Usage:    "token used to authenticate to Vault, alternative to vault-kubernetes-role",
+				EnvVars:  []string{"VAULT_TOKEN"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "vault-namespace",
+				Usage:    "Vault Enterprise namespace secrets are fetched from",
+				EnvVars:  []string{"VAULT_NAMESPACE"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "vault-kubernetes-role",
+				Usage:    "role used to authenticate to Vault through the Kubernetes auth method with the service account token of the pod, alternative to vault-token",
+				EnvVars:  []string{"VAULT_KUBERNETES_ROLE"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "vault-kubernetes-mount",
+				Usage:    "path the Kubernetes auth method is mounted at in Vault",
+				EnvVars:  []string{"VAULT_KUBERNETES_MOUNT"},
+				Value:    "kubernetes",
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "vault-refresh-interval",
+				Usage:    "how often Vault secrets without a lease (e.g. KV) are fetched again to pick up rotated values, leased secrets are fetched again before the lease is over (0 - fetched only on start)",
+				EnvVars:  []string{"VAULT_REFRESH_INTERVAL"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "external-url",
+				Usage:    "URL lfgw is reachable at by clients, e.g. https://example.com/metrics-gw/, used to generate absolute URLs in redirects",
+				EnvVars:  []string{"EXTERNAL_URL"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "route-prefix",
+				Usage:    "path prefix lfgw is served under, e.g. /metrics-gw, defaults to the path of external-url",
+				EnvVars:  []string{"ROUTE_PREFIX"},
+				Required: false,
 			},
 			&cli.StringFlag{
 				Name:     "oidc-realm-url",
 				Usage:    "OIDC Realm URL, e.g. `https://keycloak.localhost/auth/realms/monitoring",
 				EnvVars:  []string{"OIDC_REALM_URL"},
-				Required: true,
+				Required: false,
 			},
 			&cli.StringFlag{
 				Name:     "oidc-client-id",
 				Usage:    "OIDC Client ID (used for token audience validation)",
 				EnvVars:  []string{"OIDC_CLIENT_ID"},
-				Required: true,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "oidc-cache-size",
+				Usage:    "maximum amount of verified tokens (along with their claims) cached by token hash, so repeated requests with the same token are not verified again (0 - disabled)",
+				EnvVars:  []string{"OIDC_CACHE_SIZE"},
+				Value:    10000,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "oidc-cache-ttl",
+				Usage:    "how long verified tokens are cached, never past their expiry",
+				EnvVars:  []string{"OIDC_CACHE_TTL"},
+				Value:    time.Minute,
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "roles-claim",
+				Usage:    "comma-separated list of claims to take OIDC-roles from, their values are merged; nested claims are specified as a dotted path (e.g. realm_access.roles, resource_access.grafana.roles, groups)",
+				EnvVars:  []string{"ROLES_CLAIM"},
+				Value:    cli.NewStringSlice("roles"),
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "acl-source",
+				Usage:    "where to load ACL definitions from: file (acl-path), kubernetes (MetricsAccessPolicy objects) or kubernetes-rbac (namespaces users can get pods in according to Kubernetes RBAC)",
+				EnvVars:  []string{"ACL_SOURCE"},
+				Value:    "file",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "kubernetes-acl-admin-namespace",
+				Usage:    "namespace where MetricsAccessPolicy objects might grant access to other namespaces through spec.namespaces, such grants are ignored elsewhere",
+				EnvVars:  []string{"KUBERNETES_ACL_ADMIN_NAMESPACE"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "kubernetes-rbac-username-claim",
+				Usage:    "claim mapped to the Kubernetes username with acl-source set to kubernetes-rbac: email or sub (same as --oidc-username-claim of kube-apiserver)",
+				EnvVars:  []string{"KUBERNETES_RBAC_USERNAME_CLAIM"},
+				Value:    "email",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "kubernetes-rbac-username-prefix",
+				Usage:    "prefix added to Kubernetes usernames with acl-source set to kubernetes-rbac (same as --oidc-username-prefix of kube-apiserver)",
+				EnvVars:  []string{"KUBERNETES_RBAC_USERNAME_PREFIX"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "kubernetes-rbac-groups-prefix",
+				Usage:    "prefix added to OIDC roles mapped to Kubernetes groups with acl-source set to kubernetes-rbac (same as --oidc-groups-prefix of kube-apiserver)",
+				EnvVars:  []string{"KUBERNETES_RBAC_GROUPS_PREFIX"},
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "kubernetes-rbac-cache-ttl",
+				Usage:    "how long ACLs derived from Kubernetes RBAC are cached per user",
+				EnvVars:  []string{"KUBERNETES_RBAC_CACHE_TTL"},
+				Value:    time.Minute,
+				Required: false,
 			},
 			&cli.StringFlag{
 				Name:     "acl-path",
@@ -73,6 +666,52 @@ func main() {
 				Value:    "./acl.yaml",
 				Required: false,
 			},
+			&cli.StringFlag{
+				Name:     "acl-configmap",
+				Usage:    "ConfigMap (namespace/name) to load ACL definitions from through the Kubernetes API instead of acl-path, it's watched for changes",
+				EnvVars:  []string{"ACL_CONFIGMAP"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "acl-configmap-key",
+				Usage:    "key of acl-configmap with ACL definitions",
+				EnvVars:  []string{"ACL_CONFIGMAP_KEY"},
+				Value:    "acl.yaml",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "acl-url",
+				Usage:    "URL to fetch ACL definitions from instead of acl-path, they're refreshed every acl-url-refresh-interval",
+				EnvVars:  []string{"ACL_URL"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "acl-url-token",
+				Usage:    "bearer token to authenticate requests to acl-url with, not sent if empty",
+				EnvVars:  []string{"ACL_URL_TOKEN"},
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "acl-url-refresh-interval",
+				Usage:    "how often to refresh ACL definitions from acl-url",
+				EnvVars:  []string{"ACL_URL_REFRESH_INTERVAL"},
+				Value:    time.Minute,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "acl-auto-reload",
+				Usage:    "whether to watch acl-path for changes (including symlink swaps done by kubelet for mounted ConfigMaps) and reload ACLs automatically",
+				EnvVars:  []string{"ACL_AUTO_RELOAD"},
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "enforced-label",
+				Usage:    "label ACLs are enforced on (e.g. namespace, tenant, cluster), might be overridden per role",
+				EnvVars:  []string{"ENFORCED_LABEL"},
+				Value:    "namespace",
+				Required: false,
+			},
 			&cli.BoolFlag{
 				Name:     "assumed-roles",
 				Usage:    "whether to treat unknown OIDC-role names as acl definitions (also known as autoconfiguration)",
@@ -80,6 +719,50 @@ func main() {
 				Value:    false,
 				Required: false,
 			},
+			&cli.StringFlag{
+				Name:     "assumed-roles-prefix",
+				Usage:    "if set, only unknown OIDC-roles starting with the prefix are assumed (e.g. ns:), the prefix is stripped",
+				EnvVars:  []string{"ASSUMED_ROLES_PREFIX"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "assumed-roles-pattern",
+				Usage:    "if set, only unknown OIDC-roles fully matching the regular expression are assumed, the first capture group (if any) is used as an acl definition",
+				EnvVars:  []string{"ASSUMED_ROLES_PATTERN"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "assumed-roles-verify-namespaces",
+				Usage:    "whether to honor assumed roles only if they correspond to existing namespaces (checked through the Kubernetes API)",
+				EnvVars:  []string{"ASSUMED_ROLES_VERIFY_NAMESPACES"},
+				Value:    false,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "assumed-roles-cache-ttl",
+				Usage:    "how long the list of namespaces used to verify assumed roles is cached",
+				EnvVars:  []string{"ASSUMED_ROLES_CACHE_TTL"},
+				Value:    time.Minute,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "default-role",
+				Usage:    "role from acl.yaml to use for authenticated users without any matching roles (otherwise, they're rejected)",
+				EnvVars:  []string{"DEFAULT_ROLE"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "default-acl",
+				Usage:    "ACL definition to use for authenticated users without any matching roles, ${sub} is replaced with the subject of the token (e.g. user-${sub})",
+				EnvVars:  []string{"DEFAULT_ACL"},
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "shared-namespaces",
+				Usage:    "comma-separated list of label values (e.g. kube-public) appended to every ACL without full access",
+				EnvVars:  []string{"SHARED_NAMESPACES"},
+				Required: false,
+			},
 			&cli.BoolFlag{
 				Name:     "enable-deduplication",
 				Usage:    "whether to enable deduplication, which leaves some of the requests unmodified if they match the target policy",
@@ -94,13 +777,51 @@ func main() {
 				Value:    true,
 				Required: false,
 			},
+			&cli.StringSliceFlag{
+				Name:     "unlabeled-metrics",
+				Usage:    "comma-separated list of metric names (regexps are supported) that don't carry the enforced label",
+				EnvVars:  []string{"UNLABELED_METRICS"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "unlabeled-metrics-policy",
+				Usage:    "what to do with selectors of unlabeled metrics for non-full access requests: inject (add label filters anyway), skip (leave them unmodified, logged for auditing) or reject",
+				EnvVars:  []string{"UNLABELED_METRICS_POLICY"},
+				Value:    "inject",
+				Required: false,
+			},
 			&cli.BoolFlag{
 				Name:     "safe-mode",
-				Usage:    "whether to block requests to sensitive endpoints (tsdb admin, insert)",
+				Usage:    "whether to block requests to sensitive endpoints (tsdb admin, snapshots, write, import) for roles without the write capability",
 				EnvVars:  []string{"SAFE_MODE"},
 				Value:    true,
 				Required: false,
 			},
+			&cli.StringFlag{
+				Name:     "non-api-paths-policy",
+				Usage:    "what to do with requests to paths that are not API endpoints (UI, upstream-specific endpoints): pass (proxy them unmodified), block or fullaccess (proxy them only for roles with full access)",
+				EnvVars:  []string{"NON_API_PATHS_POLICY"},
+				Value:    "pass",
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "api-path-prefixes",
+				Usage:    "prefixes of paths treated as API endpoints (label filters are applied to them), if empty, any path containing /api/ or /federate is treated as such",
+				EnvVars:  []string{"API_PATH_PREFIXES"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "query-catalog-path",
+				Usage:    "path to a query catalog, users with roles listed there can only execute pre-approved queries, skipped if empty",
+				EnvVars:  []string{"QUERY_CATALOG_PATH"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "error-messages-path",
+				Usage:    "path to templates of human-readable messages of 401, 403 and 429 errors, optionally per language, skipped if empty",
+				EnvVars:  []string{"ERROR_MESSAGES_PATH"},
+				Required: false,
+			},
 			&cli.BoolFlag{
 				Name:     "set-proxy-headers",
 				Usage:    "whether to set proxy headers (X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host)",
@@ -108,6 +829,60 @@ func main() {
 				Value:    false,
 				Required: false,
 			},
+			&cli.StringFlag{
+				Name:     "request-id-header",
+				Usage:    "header the request ID is returned in and passed to the upstream with, so logs can be correlated end-to-end",
+				EnvVars:  []string{"REQUEST_ID_HEADER"},
+				Value:    "Request-Id",
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "scrub-response-headers",
+				Usage:    "comma-separated list of upstream response headers to remove (e.g. the ones revealing upstream software)",
+				EnvVars:  []string{"SCRUB_RESPONSE_HEADERS"},
+				Value:    cli.NewStringSlice("Server", "X-Powered-By"),
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "hsts-max-age",
+				Usage:    "max-age of Strict-Transport-Security header, the header is not set if 0",
+				EnvVars:  []string{"HSTS_MAX_AGE"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "content-type-nosniff",
+				Usage:    "whether to set X-Content-Type-Options: nosniff header",
+				EnvVars:  []string{"CONTENT_TYPE_NOSNIFF"},
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "response-compression",
+				Usage:    "whether to compress responses with zstd, br or gzip as negotiated with clients through Accept-Encoding (responses of the upstream are requested uncompressed then)",
+				EnvVars:  []string{"RESPONSE_COMPRESSION"},
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "content-security-policy",
+				Usage:    "Content-Security-Policy header for non-API responses (e.g. vmui), the header is not set if empty",
+				EnvVars:  []string{"CONTENT_SECURITY_POLICY"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "ui-path-prefix",
+				Usage:    "path prefix to serve the upstream web UI (vmui, Prometheus UI) under, e.g. /ui, disabled if empty",
+				EnvVars:  []string{"UI_PATH_PREFIX"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "ui-home-path",
+				Usage:    "upstream path requests to ui-path-prefix are redirected to, e.g. /vmui/ for VictoriaMetrics or /graph for Prometheus",
+				EnvVars:  []string{"UI_HOME_PATH"},
+				Value:    "/vmui/",
+				Required: false,
+			},
 			&cli.BoolFlag{
 				Name:     "set-gomax-procs",
 				Usage:    "automatically set GOMAXPROCS to match Linux container CPU quota",
@@ -115,6 +890,399 @@ func main() {
 				Value:    true,
 				Required: false,
 			},
+			&cli.StringFlag{
+				Name:     "admin-token",
+				Usage:    "static bearer token granting access to administrative endpoints, admin access is disabled if empty",
+				EnvVars:  []string{"ADMIN_TOKEN"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "secondary-admin-token",
+				Usage:    "additional admin token accepted along with admin-token, allows rotating the admin token without downtime",
+				EnvVars:  []string{"SECONDARY_ADMIN_TOKEN"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "api-keys-path",
+				Usage:    "path to a file API keys minted through /admin/api-keys are stored in (hashed), API keys are disabled if empty",
+				EnvVars:  []string{"API_KEYS_PATH"},
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "api-keys-max-ttl",
+				Usage:    "maximum lifetime of API keys, unlimited if 0",
+				EnvVars:  []string{"API_KEYS_MAX_TTL"},
+				Value:    365 * 24 * time.Hour,
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "cluster-peers",
+				Usage:    "comma-separated list of base URLs of other lfgw instances runtime admin changes are propagated to (e.g. http://lfgw-1.lfgw:8080)",
+				EnvVars:  []string{"CLUSTER_PEERS"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "cluster-service",
+				Usage:    "Kubernetes service (namespace/name) whose endpoints are other lfgw instances runtime admin changes are propagated to",
+				EnvVars:  []string{"CLUSTER_SERVICE"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "cluster-peer-scheme",
+				Usage:    "scheme (http or https) peers discovered through cluster-service are called with",
+				EnvVars:  []string{"CLUSTER_PEER_SCHEME"},
+				Value:    "http",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "protect-metrics",
+				Usage:    "whether to require the admin token for the /metrics endpoint",
+				EnvVars:  []string{"PROTECT_METRICS"},
+				Value:    false,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "enable-lifecycle",
+				Usage:    "whether to enable the /-/reload endpoint (requires the admin token if admin-token is set)",
+				EnvVars:  []string{"ENABLE_LIFECYCLE"},
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "namespace-metrics-allowlist",
+				Usage:    "comma-separated list of namespaces to export query demand metrics for (namespace_queries_total, namespace_query_errors_total), disabled if empty",
+				EnvVars:  []string{"NAMESPACE_METRICS_ALLOWLIST"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "role-metrics",
+				Usage:    "whether to export request, denial, rewrite and latency metrics per tenant labeled by role (role) or by a hashed tenant id (hash), disabled if empty",
+				EnvVars:  []string{"ROLE_METRICS"},
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "read-after-write-window",
+				Usage:    "for how long reads of a tenant bypass the upstream cache (nocache=1) after the tenant wrote / imported data, disabled if 0",
+				EnvVars:  []string{"READ_AFTER_WRITE_WINDOW"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "request-tag",
+				Usage:    "identifier to tag API requests forwarded to the upstream with, so upstream query logs can attribute load per tenant (e.g. lfgw-{roles}, {roles} is replaced with roles of a user), disabled if empty",
+				EnvVars:  []string{"REQUEST_TAG"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "request-tag-mode",
+				Usage:    "how to tag requests: param (request-tag-param GET parameter) or comment (appended to queries)",
+				EnvVars:  []string{"REQUEST_TAG_MODE"},
+				Value:    "param",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "request-tag-param",
+				Usage:    "GET parameter to set request-tag in when request-tag-mode is param",
+				EnvVars:  []string{"REQUEST_TAG_PARAM"},
+				Value:    "client",
+				Required: false,
+			},
+			&cli.Float64Flag{
+				Name:     "slo-availability-target",
+				Usage:    "share of proxied requests that should not fail with 5xx, e.g. 0.999, availability SLO is not tracked if 0",
+				EnvVars:  []string{"SLO_AVAILABILITY_TARGET"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.Float64Flag{
+				Name:     "slo-latency-target",
+				Usage:    "share of proxied requests that should be served within slo-latency-threshold, e.g. 0.99, latency SLO is not tracked if 0",
+				EnvVars:  []string{"SLO_LATENCY_TARGET"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "slo-latency-threshold",
+				Usage:    "requests served slower than this are counted against the latency SLO",
+				EnvVars:  []string{"SLO_LATENCY_THRESHOLD"},
+				Value:    time.Second,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "fault-injection",
+				Usage:    "whether to allow injecting latency and errors into requests through /admin/faults (requires admin-token), only meant for testing clients in non-production environments",
+				EnvVars:  []string{"FAULT_INJECTION"},
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "source-ip-header",
+				Usage:    "header to take the client IP address from for source_cidrs checks (e.g. X-Forwarded-For), RemoteAddr is used if empty; set only when lfgw is behind a trusted proxy",
+				EnvVars:  []string{"SOURCE_IP_HEADER"},
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "max-token-age",
+				Usage:    "maximum time since authentication (auth_time, iat as a fallback) for tokens to be accepted regardless of their expiration, disabled if 0; might be restricted further per role",
+				EnvVars:  []string{"MAX_TOKEN_AGE"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "allowed-azp",
+				Usage:    "comma-separated list of authorized parties (azp) tokens must be issued to, not checked if empty; might be restricted further per role",
+				EnvVars:  []string{"ALLOWED_AZP"},
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "claims-enrichers",
+				Usage:    "comma-separated list of compiled-in claims enrichers to run after token verification, in order",
+				EnvVars:  []string{"CLAIMS_ENRICHERS"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "claims-adapter",
+				Usage:    "built-in claims adapter for IdP-specific claims (azure-ad, google), runs before claims enrichers, disabled if empty",
+				EnvVars:  []string{"CLAIMS_ADAPTER"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "azure-ad-graph-lookup",
+				Usage:    "whether the azure-ad claims adapter resolves group IDs to display names and groups overage claims through Microsoft Graph",
+				EnvVars:  []string{"AZURE_AD_GRAPH_LOOKUP"},
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "azure-ad-tenant-id",
+				Usage:    "Azure AD tenant ID used for Microsoft Graph lookups",
+				EnvVars:  []string{"AZURE_AD_TENANT_ID"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "azure-ad-client-id",
+				Usage:    "client ID of the Azure AD app used for Microsoft Graph lookups (requires GroupMember.Read.All)",
+				EnvVars:  []string{"AZURE_AD_CLIENT_ID"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "azure-ad-client-secret",
+				Usage:    "client secret of the Azure AD app used for Microsoft Graph lookups",
+				EnvVars:  []string{"AZURE_AD_CLIENT_SECRET"},
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "google-hosted-domains",
+				Usage:    "comma-separated list of Google Workspace domains (hd claim) tokens must belong to when the google claims adapter is used, not checked if empty",
+				EnvVars:  []string{"GOOGLE_HOSTED_DOMAINS"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "token-exchange",
+				Usage:    "whether to exchange user tokens for upstream-scoped tokens (RFC 8693) before proxying requests",
+				EnvVars:  []string{"TOKEN_EXCHANGE"},
+				Value:    false,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "token-exchange-url",
+				Usage:    "token endpoint used for token exchange, taken from OIDC discovery if empty",
+				EnvVars:  []string{"TOKEN_EXCHANGE_URL"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "token-exchange-client-id",
+				Usage:    "client ID used for token exchange, defaults to oidc-client-id",
+				EnvVars:  []string{"TOKEN_EXCHANGE_CLIENT_ID"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "token-exchange-client-secret",
+				Usage:    "client secret used for token exchange",
+				EnvVars:  []string{"TOKEN_EXCHANGE_CLIENT_SECRET"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "token-exchange-audience",
+				Usage:    "audience of the tokens requested through token exchange (normally, the upstream client ID)",
+				EnvVars:  []string{"TOKEN_EXCHANGE_AUDIENCE"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "token-exchange-scope",
+				Usage:    "space-separated list of scopes requested through token exchange",
+				EnvVars:  []string{"TOKEN_EXCHANGE_SCOPE"},
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "acl-consistency-check-interval",
+				Usage:    "how often to compare ACL roles with the roles defined in Keycloak, disabled if 0",
+				EnvVars:  []string{"ACL_CONSISTENCY_CHECK_INTERVAL"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "keycloak-admin-url",
+				Usage:    "Keycloak Admin API URL, e.g. https://keycloak.localhost/auth/admin/realms/monitoring, derived from oidc-realm-url if empty",
+				EnvVars:  []string{"KEYCLOAK_ADMIN_URL"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "keycloak-admin-client-id",
+				Usage:    "client ID of a Keycloak service account with view-realm and view-clients roles",
+				EnvVars:  []string{"KEYCLOAK_ADMIN_CLIENT_ID"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "keycloak-admin-client-secret",
+				Usage:    "client secret of the Keycloak service account",
+				EnvVars:  []string{"KEYCLOAK_ADMIN_CLIENT_SECRET"},
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "keycloak-role-clients",
+				Usage:    "comma-separated list of Keycloak clients whose roles are considered in addition to realm roles",
+				EnvVars:  []string{"KEYCLOAK_ROLE_CLIENTS"},
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "keycloak-role-sync-interval",
+				Usage:    "how often to discover roles matching keycloak-role-sync-pattern in Keycloak and add ACLs for them, disabled if 0",
+				EnvVars:  []string{"KEYCLOAK_ROLE_SYNC_INTERVAL"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "keycloak-role-sync-pattern",
+				Usage:    "regular expression (anchored) matching names of roles to discover in Keycloak, e.g. team-(.+)-viewer",
+				EnvVars:  []string{"KEYCLOAK_ROLE_SYNC_PATTERN"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "keycloak-role-sync-acl",
+				Usage:    "ACL of discovered roles (same syntax as in acl.yaml), submatches of keycloak-role-sync-pattern are expanded (e.g. $1 or ${team})",
+				EnvVars:  []string{"KEYCLOAK_ROLE_SYNC_ACL"},
+				Value:    "$1",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "deep-healthcheck",
+				Usage:    "whether /readyz should verify that a query rewritten according to a randomly selected role succeeds in the upstream",
+				EnvVars:  []string{"DEEP_HEALTHCHECK"},
+				Value:    false,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "canary-interval",
+				Usage:    "how often to run canary queries through the full auth, rewrite and proxy path, disabled if 0",
+				EnvVars:  []string{"CANARY_INTERVAL"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "canary-queries",
+				Usage:    "semicolon-separated list of canary queries, e.g. up{job=\"prometheus\"}; vector(1)",
+				EnvVars:  []string{"CANARY_QUERIES"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "canary-token",
+				Usage:    "service token canary queries are authenticated with, it's rejected on start if it has already expired",
+				EnvVars:  []string{"CANARY_TOKEN"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "canary-client-id",
+				Usage:    "client ID canary queries obtain tokens with through the client credentials flow (instead of canary-token)",
+				EnvVars:  []string{"CANARY_CLIENT_ID"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "canary-client-secret",
+				Usage:    "client secret canary queries obtain tokens with through the client credentials flow",
+				EnvVars:  []string{"CANARY_CLIENT_SECRET"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "profile-watchdog-dir",
+				Usage:    "directory to record heap and goroutine profiles to once a threshold of the profile watchdog is crossed, disabled if empty",
+				EnvVars:  []string{"PROFILE_WATCHDOG_DIR"},
+				Required: false,
+			},
+			&cli.Uint64Flag{
+				Name:     "profile-watchdog-rss-bytes",
+				Usage:    "resident memory (in bytes) that triggers the profile watchdog, not checked if 0",
+				EnvVars:  []string{"PROFILE_WATCHDOG_RSS_BYTES"},
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "profile-watchdog-goroutines",
+				Usage:    "number of goroutines that triggers the profile watchdog, not checked if 0",
+				EnvVars:  []string{"PROFILE_WATCHDOG_GOROUTINES"},
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "profile-watchdog-interval",
+				Usage:    "how often the profile watchdog checks the thresholds",
+				EnvVars:  []string{"PROFILE_WATCHDOG_INTERVAL"},
+				Value:    10 * time.Second,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "profile-watchdog-cooldown",
+				Usage:    "minimum time between two recordings of the profile watchdog",
+				EnvVars:  []string{"PROFILE_WATCHDOG_COOLDOWN"},
+				Value:    10 * time.Minute,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "execution-trace-dir",
+				Usage:    "directory to save execution traces of sampled slow requests to, disabled if empty",
+				EnvVars:  []string{"EXECUTION_TRACE_DIR"},
+				Required: false,
+			},
+			&cli.Float64Flag{
+				Name:     "execution-trace-sample-rate",
+				Usage:    "share of requests an execution trace is recorded for, e.g. 0.01",
+				EnvVars:  []string{"EXECUTION_TRACE_SAMPLE_RATE"},
+				Value:    0.01,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "execution-trace-threshold",
+				Usage:    "execution traces are kept only for requests served slower than this",
+				EnvVars:  []string{"EXECUTION_TRACE_THRESHOLD"},
+				Value:    time.Second,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "slow-request-threshold",
+				Usage:    "proxied requests served slower than this are logged at warn level along with the user, roles and the rewritten query (0 - disabled)",
+				EnvVars:  []string{"SLOW_REQUEST_THRESHOLD"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "request-snapshots",
+				Usage:    "amount of latest proxied requests kept in memory as structured records (caller, ACL, original and rewritten params, status, timings), they're returned by /admin/requests?id=<request ID> (0 - disabled)",
+				EnvVars:  []string{"REQUEST_SNAPSHOTS"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "max-param-length",
+				Usage:    "maximum length of an individual GET / POST parameter value, longer requests are rejected (0 - unlimited)",
+				EnvVars:  []string{"MAX_PARAM_LENGTH"},
+				Value:    0,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "max-params",
+				Usage:    "maximum number of GET / POST parameters (counted separately) in a request, requests with more are rejected (0 - unlimited)",
+				EnvVars:  []string{"MAX_PARAMS"},
+				Value:    0,
+				Required: false,
+			},
 			&cli.BoolFlag{
 				Name:     "debug",
 				Usage:    "whether to print out debug log messages",
@@ -122,9 +1290,16 @@ func main() {
 				Value:    false,
 				Required: false,
 			},
+			&cli.BoolFlag{
+				Name:     "validate-upstream-responses",
+				Usage:    "whether to log upstream API responses that are not well-formed Prometheus API JSON along with the rewritten query, only works in debug mode",
+				EnvVars:  []string{"VALIDATE_UPSTREAM_RESPONSES"},
+				Value:    false,
+				Required: false,
+			},
 			&cli.StringFlag{
 				Name:     "log-format",
-				Usage:    "log format: pretty, json",
+				Usage:    "log format: pretty, json, logfmt, combined (access logs in the Apache combined format, other logs in json)",
 				EnvVars:  []string{"LOG_FORMAT"},
 				Value:    "pretty",
 				Required: false,
@@ -143,6 +1318,62 @@ func main() {
 				Value:    false,
 				Required: false,
 			},
+			&cli.Float64Flag{
+				Name:     "log-sampling-rate",
+				Usage:    "share of successful requests access logs are written for, e.g. 0.01; failed requests (4xx, 5xx) are always logged",
+				EnvVars:  []string{"LOG_SAMPLING_RATE"},
+				Value:    1,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "log-file",
+				Usage:    "path to the file logs are written to instead of stdout (reopened on SIGUSR1)",
+				EnvVars:  []string{"LOG_FILE"},
+				Value:    "",
+				Required: false,
+			},
+			&cli.Uint64Flag{
+				Name:     "log-file-max-size-bytes",
+				Usage:    "size the log file is rotated at (0 - no size-based rotation)",
+				EnvVars:  []string{"LOG_FILE_MAX_SIZE_BYTES"},
+				Value:    100 << 20,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "log-file-max-age",
+				Usage:    "age the log file is rotated at (0 - no age-based rotation)",
+				EnvVars:  []string{"LOG_FILE_MAX_AGE"},
+				Value:    24 * time.Hour,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "log-file-max-backups",
+				Usage:    "number of rotated log files to keep",
+				EnvVars:  []string{"LOG_FILE_MAX_BACKUPS"},
+				Value:    5,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "syslog-address",
+				Usage:    "syslog server logs are sent to as RFC5424 messages instead of stdout, e.g. udp://syslog:514, tcp://syslog:601, unixgram:///dev/log",
+				EnvVars:  []string{"SYSLOG_ADDRESS"},
+				Value:    "",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "syslog-facility",
+				Usage:    "syslog facility, e.g. daemon, local0",
+				EnvVars:  []string{"SYSLOG_FACILITY"},
+				Value:    "daemon",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "syslog-app-name",
+				Usage:    "app name (tag) of syslog messages",
+				EnvVars:  []string{"SYSLOG_APP_NAME"},
+				Value:    "lfgw",
+				Required: false,
+			},
 			&cli.IntFlag{
 				Name:     "port",
 				Usage:    "port the web server will listen on",
@@ -171,11 +1402,25 @@ func main() {
 				Value:    20 * time.Second,
 				Required: false,
 			},
+			&cli.DurationFlag{
+				Name:     "drain-grace-period",
+				Usage:    "how long to keep serving existing connections with keep-alives after a drain is requested",
+				EnvVars:  []string{"DRAIN_GRACE_PERIOD"},
+				Value:    15 * time.Second,
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "feature-flags",
+				Usage:    "comma-separated list of feature flags to enable (name) or disable (-name), see README for the list",
+				EnvVars:  []string{"FEATURE_FLAGS"},
+				Required: false,
+			},
 		},
 	}
 
 	err := app.Run(os.Args)
 	if err != nil {
 		fmt.Printf("\n%+v: %+v\n", os.Args[0], err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,192 @@
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client is a minimal Keycloak Admin REST API client. It authenticates through the client credentials grant, so the client has to have a service account with view-realm / view-clients roles.
+type Client struct {
+	AdminURL     string
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	HTTPClient   *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// Role represents a realm or a client role.
+type Role struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Composite   bool   `json:"composite"`
+	ClientRole  bool   `json:"clientRole"`
+	ContainerID string `json:"containerId"`
+}
+
+// ClientRepresentation represents a Keycloak client (only the fields lfgw cares about).
+type ClientRepresentation struct {
+	ID       string `json:"id"`
+	ClientID string `json:"clientId"`
+}
+
+// tokenResponse represents a response from the token endpoint.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// NewClient returns a Client for the realm behind realmURL (e.g. https://keycloak.localhost/auth/realms/monitoring). If adminURL is empty, it's derived from realmURL.
+func NewClient(realmURL, adminURL, clientID, clientSecret string) (*Client, error) {
+	realmURL = strings.TrimRight(realmURL, "/")
+
+	if adminURL == "" {
+		var err error
+		adminURL, err = AdminURLFromRealmURL(realmURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Client{
+		AdminURL:     strings.TrimRight(adminURL, "/"),
+		TokenURL:     realmURL + "/protocol/openid-connect/token",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// AdminURLFromRealmURL converts a realm URL (.../realms/<realm>) into the respective Admin API URL (.../admin/realms/<realm>).
+func AdminURLFromRealmURL(realmURL string) (string, error) {
+	i := strings.LastIndex(realmURL, "/realms/")
+	if i < 0 {
+		return "", fmt.Errorf("failed to derive Keycloak Admin API URL from %q: no /realms/ in path", realmURL)
+	}
+
+	return realmURL[:i] + "/admin" + strings.TrimRight(realmURL[i:], "/"), nil
+}
+
+// RealmRoles returns all realm roles.
+func (c *Client) RealmRoles(ctx context.Context) ([]Role, error) {
+	var roles []Role
+	err := c.get(ctx, "/roles", nil, &roles)
+	return roles, err
+}
+
+// Clients returns clients, optionally filtered by clientID (Keycloak performs a search rather than an exact match).
+func (c *Client) Clients(ctx context.Context, clientID string) ([]ClientRepresentation, error) {
+	params := url.Values{}
+	if clientID != "" {
+		params.Set("clientId", clientID)
+	}
+
+	var clients []ClientRepresentation
+	err := c.get(ctx, "/clients", params, &clients)
+	return clients, err
+}
+
+// ClientRoles returns roles of the client with the given clientId (not the internal ID).
+func (c *Client) ClientRoles(ctx context.Context, clientID string) ([]Role, error) {
+	clients, err := c.Clients(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, client := range clients {
+		if client.ClientID != clientID {
+			continue
+		}
+
+		var roles []Role
+		err := c.get(ctx, "/clients/"+url.PathEscape(client.ID)+"/roles", nil, &roles)
+		return roles, err
+	}
+
+	return nil, fmt.Errorf("client %q is not found", clientID)
+}
+
+// get sends an authenticated GET request to the Admin API and decodes the JSON response into v.
+func (c *Client) get(ctx context.Context, path string, params url.Values, v any) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	u := c.AdminURL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GET %s: %s: %s", path, resp.Status, body)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// token returns a cached access token or obtains a new one through the client credentials grant.
+func (c *Client) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.accessToken != "" && time.Now().Add(10*time.Second).Before(c.expiresAt) {
+		return c.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain Keycloak Admin API token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("failed to obtain Keycloak Admin API token: %s: %s", resp.Status, body)
+	}
+
+	var tr tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", fmt.Errorf("failed to obtain Keycloak Admin API token: %w", err)
+	}
+
+	c.accessToken = tr.AccessToken
+	c.expiresAt = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+
+	return c.accessToken, nil
+}
@@ -0,0 +1,136 @@
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// keycloakServer returns a mocked Keycloak with realm "monitoring", a few realm roles and a client "grafana" with client roles.
+func keycloakServer(t *testing.T, tokenRequests *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/auth/realms/monitoring/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests.Add(1)
+
+		clientID, clientSecret, _ := r.BasicAuth()
+		if clientID != "lfgw" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(tokenResponse{AccessToken: "admin-token", ExpiresIn: 300})
+	})
+
+	authorized := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer admin-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+
+	mux.HandleFunc("/auth/admin/realms/monitoring/roles", authorized(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]Role{{ID: "1", Name: "team-a"}, {ID: "2", Name: "team-b"}})
+	}))
+
+	mux.HandleFunc("/auth/admin/realms/monitoring/clients", authorized(func(w http.ResponseWriter, r *http.Request) {
+		// Keycloak performs a search, so similar clients are returned as well
+		_ = json.NewEncoder(w).Encode([]ClientRepresentation{{ID: "uuid-2", ClientID: "grafana-dev"}, {ID: "uuid-1", ClientID: "grafana"}})
+	}))
+
+	mux.HandleFunc("/auth/admin/realms/monitoring/clients/uuid-1/roles", authorized(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]Role{{ID: "3", Name: "grafana-admin", ClientRole: true}})
+	}))
+
+	return httptest.NewServer(mux)
+}
+
+func TestAdminURLFromRealmURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		realmURL string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "Legacy path",
+			realmURL: "https://keycloak.localhost/auth/realms/monitoring",
+			want:     "https://keycloak.localhost/auth/admin/realms/monitoring",
+		},
+		{
+			name:     "Without /auth",
+			realmURL: "https://keycloak.localhost/realms/monitoring/",
+			want:     "https://keycloak.localhost/admin/realms/monitoring",
+		},
+		{
+			name:     "Not a Keycloak realm",
+			realmURL: "https://accounts.google.com",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AdminURLFromRealmURL(tt.realmURL)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	var tokenRequests atomic.Int32
+	ts := keycloakServer(t, &tokenRequests)
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL+"/auth/realms/monitoring", "", "lfgw", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Realm roles", func(t *testing.T) {
+		roles, err := c.RealmRoles(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, []Role{{ID: "1", Name: "team-a"}, {ID: "2", Name: "team-b"}}, roles)
+	})
+
+	t.Run("Client roles", func(t *testing.T) {
+		roles, err := c.ClientRoles(context.Background(), "grafana")
+		assert.Nil(t, err)
+		assert.Equal(t, []Role{{ID: "3", Name: "grafana-admin", ClientRole: true}}, roles)
+	})
+
+	t.Run("Unknown client", func(t *testing.T) {
+		_, err := c.ClientRoles(context.Background(), "random-client")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Token is reused", func(t *testing.T) {
+		assert.Equal(t, int32(1), tokenRequests.Load())
+	})
+
+	t.Run("Invalid credentials", func(t *testing.T) {
+		c, err := NewClient(ts.URL+"/auth/realms/monitoring", "", "lfgw", "wrong-secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.RealmRoles(context.Background())
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,440 @@
+package kubernetes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Group is the API group of MetricsAccessPolicy
+	Group = "lfgw.io"
+	// Version is the API version of MetricsAccessPolicy
+	Version = "v1alpha1"
+	// Resource is the plural name of MetricsAccessPolicy
+	Resource = "metricsaccesspolicies"
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// ErrWatchExpired is returned when the resource version a watch was started from is too old, a fresh list is needed.
+var ErrWatchExpired = errors.New("watch expired")
+
+// Client is a minimal Kubernetes API client that reads and watches the few kinds of objects lfgw cares about.
+type Client struct {
+	APIServerURL string
+	// Token is used for authentication if TokenPath is empty
+	Token string
+	// TokenPath is re-read on every request, so rotated service account tokens are picked up
+	TokenPath  string
+	HTTPClient *http.Client
+	// RequestTimeout applies to regular requests, watches are limited by WatchTimeout instead
+	RequestTimeout time.Duration
+	WatchTimeout   time.Duration
+}
+
+// MetricsAccessPolicy grants OIDC roles access to metrics of the namespace the object resides in.
+type MetricsAccessPolicy struct {
+	Metadata ObjectMeta              `json:"metadata"`
+	Spec     MetricsAccessPolicySpec `json:"spec"`
+}
+
+// MetricsAccessPolicySpec represents the spec of MetricsAccessPolicy.
+type MetricsAccessPolicySpec struct {
+	// Roles lists OIDC roles the policy applies to
+	Roles []string `json:"roles"`
+	// Namespaces overrides the granted namespaces (same syntax as in acl.yaml), it's honoured only for policies in the admin namespace
+	Namespaces string `json:"namespaces,omitempty"`
+}
+
+// ConfigMap represents a ConfigMap (only the fields lfgw cares about).
+type ConfigMap struct {
+	Metadata ObjectMeta        `json:"metadata"`
+	Data     map[string]string `json:"data"`
+}
+
+// ObjectMeta contains the metadata fields lfgw cares about.
+type ObjectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// MetricsAccessPolicyList represents a list response.
+type MetricsAccessPolicyList struct {
+	Metadata ListMeta              `json:"metadata"`
+	Items    []MetricsAccessPolicy `json:"items"`
+}
+
+// NamespaceList represents a list of namespaces (only the fields lfgw cares about).
+type NamespaceList struct {
+	Items []struct {
+		Metadata ObjectMeta `json:"metadata"`
+	} `json:"items"`
+}
+
+// Endpoints represents Endpoints of a Service (only the fields lfgw cares about).
+type Endpoints struct {
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []struct {
+			Port int `json:"port"`
+		} `json:"ports"`
+	} `json:"subsets"`
+}
+
+// SubjectAccessReview checks whether a user can perform an action (only the fields lfgw cares about).
+type SubjectAccessReview struct {
+	APIVersion string                    `json:"apiVersion"`
+	Kind       string                    `json:"kind"`
+	Spec       SubjectAccessReviewSpec   `json:"spec"`
+	Status     SubjectAccessReviewStatus `json:"status"`
+}
+
+// SubjectAccessReviewSpec describes the user and the action to check.
+type SubjectAccessReviewSpec struct {
+	User               string             `json:"user,omitempty"`
+	Groups             []string           `json:"groups,omitempty"`
+	ResourceAttributes ResourceAttributes `json:"resourceAttributes"`
+}
+
+// ResourceAttributes describes an action on a resource. An empty namespace means all namespaces.
+type ResourceAttributes struct {
+	Namespace string `json:"namespace,omitempty"`
+	Verb      string `json:"verb"`
+	Group     string `json:"group,omitempty"`
+	Resource  string `json:"resource"`
+}
+
+// SubjectAccessReviewStatus contains the result of a review.
+type SubjectAccessReviewStatus struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// ListMeta contains the list metadata fields lfgw cares about.
+type ListMeta struct {
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// watchEvent represents a single event of a watch stream.
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// watchStatus represents the object of an ERROR watch event.
+type watchStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewClient returns an in-cluster Client if lfgw runs in a pod, otherwise the client is configured through kubeconfig (KUBECONFIG or ~/.kube/config).
+func NewClient() (*Client, error) {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return NewInClusterClient()
+	}
+
+	path, err := DefaultKubeconfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClientFromKubeconfig(path)
+}
+
+// NewInClusterClient returns a Client configured through the service account mounted into the pod.
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	caCert, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to parse service account CA")
+	}
+
+	return &Client{
+		APIServerURL:   "https://" + net.JoinHostPort(host, port),
+		TokenPath:      serviceAccountDir + "/token",
+		HTTPClient:     newHTTPClient(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}),
+		RequestTimeout: 10 * time.Second,
+		WatchTimeout:   5 * time.Minute,
+	}, nil
+}
+
+// newHTTPClient returns an HTTP client without an overall timeout (it would break watches), timeouts are set through contexts instead.
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}
+}
+
+// ListMetricsAccessPolicies returns MetricsAccessPolicy objects from all namespaces.
+func (c *Client) ListMetricsAccessPolicies(ctx context.Context) (MetricsAccessPolicyList, error) {
+	var list MetricsAccessPolicyList
+	err := c.getJSON(ctx, metricsAccessPoliciesPath(), nil, &list)
+	return list, err
+}
+
+// WaitForMetricsAccessPolicyChange watches MetricsAccessPolicy objects starting from resourceVersion and returns once an object is added, modified or deleted. It returns false if the watch ended without changes (e.g. on timeout), and ErrWatchExpired if resourceVersion is too old.
+func (c *Client) WaitForMetricsAccessPolicyChange(ctx context.Context, resourceVersion string) (bool, error) {
+	return c.waitForChange(ctx, metricsAccessPoliciesPath(), nil, resourceVersion)
+}
+
+// GetConfigMap returns the ConfigMap.
+func (c *Client) GetConfigMap(ctx context.Context, namespace, name string) (ConfigMap, error) {
+	var cm ConfigMap
+	err := c.getJSON(ctx, configMapsPath(namespace)+"/"+url.PathEscape(name), nil, &cm)
+	return cm, err
+}
+
+// WaitForConfigMapChange watches the ConfigMap starting from resourceVersion, see WaitForMetricsAccessPolicyChange for details.
+func (c *Client) WaitForConfigMapChange(ctx context.Context, namespace, name, resourceVersion string) (bool, error) {
+	params := url.Values{}
+	params.Set("fieldSelector", "metadata.name="+name)
+
+	return c.waitForChange(ctx, configMapsPath(namespace), params, resourceVersion)
+}
+
+// ListNamespaces returns names of namespaces matching labelSelector (all namespaces if empty).
+func (c *Client) ListNamespaces(ctx context.Context, labelSelector string) ([]string, error) {
+	params := url.Values{}
+	if labelSelector != "" {
+		params.Set("labelSelector", labelSelector)
+	}
+
+	var list NamespaceList
+	if err := c.getJSON(ctx, "/api/v1/namespaces", params, &list); err != nil {
+		return nil, err
+	}
+
+	namespaces := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		namespaces = append(namespaces, item.Metadata.Name)
+	}
+
+	return namespaces, nil
+}
+
+// GetEndpointAddresses returns ready addresses (host:port) of the Service. If the Service exposes several ports, the first one is used.
+func (c *Client) GetEndpointAddresses(ctx context.Context, namespace, name string) ([]string, error) {
+	var endpoints Endpoints
+	if err := c.getJSON(ctx, "/api/v1/namespaces/"+url.PathEscape(namespace)+"/endpoints/"+url.PathEscape(name), nil, &endpoints); err != nil {
+		return nil, err
+	}
+
+	addresses := []string{}
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Ports) == 0 {
+			continue
+		}
+
+		for _, address := range subset.Addresses {
+			addresses = append(addresses, net.JoinHostPort(address.IP, strconv.Itoa(subset.Ports[0].Port)))
+		}
+	}
+
+	return addresses, nil
+}
+
+// CanI returns true if the user (or any of the groups) is allowed to perform the action according to the authorizers of the API server (e.g. RBAC). The service account lfgw runs with needs to be allowed to create subjectaccessreviews.
+func (c *Client) CanI(ctx context.Context, user string, groups []string, attributes ResourceAttributes) (bool, error) {
+	review := SubjectAccessReview{
+		APIVersion: "authorization.k8s.io/v1",
+		Kind:       "SubjectAccessReview",
+		Spec: SubjectAccessReviewSpec{
+			User:               user,
+			Groups:             groups,
+			ResourceAttributes: attributes,
+		},
+	}
+
+	if err := c.postJSON(ctx, "/apis/authorization.k8s.io/v1/subjectaccessreviews", review, &review); err != nil {
+		return false, err
+	}
+
+	return review.Status.Allowed, nil
+}
+
+// metricsAccessPoliciesPath returns the path of MetricsAccessPolicy objects across all namespaces.
+func metricsAccessPoliciesPath() string {
+	return fmt.Sprintf("/apis/%s/%s/%s", Group, Version, Resource)
+}
+
+// configMapsPath returns the path of ConfigMaps in the namespace.
+func configMapsPath(namespace string) string {
+	return "/api/v1/namespaces/" + url.PathEscape(namespace) + "/configmaps"
+}
+
+// getJSON sends a GET request and decodes the JSON response into v.
+func (c *Client) getJSON(ctx context.Context, path string, params url.Values, v any) error {
+	if c.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.RequestTimeout)
+		defer cancel()
+	}
+
+	resp, err := c.get(ctx, path, params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode GET %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// postJSON sends v as a JSON body of a POST request and decodes the JSON response into out.
+func (c *Client) postJSON(ctx context.Context, path string, v, out any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if c.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.RequestTimeout)
+		defer cancel()
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, path, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode POST %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// waitForChange watches objects behind path starting from resourceVersion and returns once an object is added, modified or deleted.
+func (c *Client) waitForChange(ctx context.Context, path string, params url.Values, resourceVersion string) (bool, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("watch", "1")
+	params.Set("resourceVersion", resourceVersion)
+	params.Set("allowWatchBookmarks", "true")
+	if c.WatchTimeout > 0 {
+		params.Set("timeoutSeconds", fmt.Sprintf("%d", int(c.WatchTimeout.Seconds())))
+	}
+
+	resp, err := c.get(ctx, path, params)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var event watchEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return false, fmt.Errorf("failed to decode watch event: %w", err)
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+			return true, nil
+		case "ERROR":
+			var status watchStatus
+			_ = json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return false, fmt.Errorf("%w: %s", ErrWatchExpired, status.Message)
+			}
+			return false, fmt.Errorf("watch error: %d: %s", status.Code, status.Message)
+		}
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return false, err
+	}
+
+	return false, ctx.Err()
+}
+
+// get sends an authenticated GET request to the API server.
+func (c *Client) get(ctx context.Context, path string, params url.Values) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, path, params, nil)
+}
+
+// do sends an authenticated request to the API server, responses with unexpected status codes are turned into errors.
+func (c *Client) do(ctx context.Context, method, path string, params url.Values, body []byte) (*http.Response, error) {
+	u := strings.TrimRight(c.APIServerURL, "/") + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	token := c.Token
+	if c.TokenPath != "" {
+		content, err := os.ReadFile(c.TokenPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token: %w", err)
+		}
+		token = strings.TrimSpace(string(content))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Created is returned for reviews
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if resp.StatusCode == http.StatusGone {
+			return nil, fmt.Errorf("%w: %s", ErrWatchExpired, body)
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, body)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,328 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// apiServer returns a mocked Kubernetes API server with two MetricsAccessPolicy objects. Watches respond with the given events.
+func apiServer(t *testing.T, events ...string) *httptest.Server {
+	t.Helper()
+
+	path := fmt.Sprintf("/apis/%s/%s/%s", Group, Version, Resource)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer sa-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Get("watch") != "1" {
+			_, _ = w.Write([]byte(`{"metadata":{"resourceVersion":"100"},"items":[
+				{"metadata":{"name":"viewers","namespace":"team-a","resourceVersion":"98"},"spec":{"roles":["team-a-viewer"]}},
+				{"metadata":{"name":"sre","namespace":"lfgw","resourceVersion":"99"},"spec":{"roles":["sre"],"namespaces":".*"}}
+			]}`))
+			return
+		}
+
+		assert.Equal(t, "100", r.URL.Query().Get("resourceVersion"))
+
+		for _, event := range events {
+			_, _ = w.Write([]byte(event + "\n"))
+		}
+	}))
+}
+
+func newTestClient(t *testing.T, ts *httptest.Server) *Client {
+	t.Helper()
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenPath, []byte("sa-token\n"), 0o600))
+
+	return &Client{
+		APIServerURL: ts.URL,
+		TokenPath:    tokenPath,
+		HTTPClient:   ts.Client(),
+	}
+}
+
+func TestClient_ListMetricsAccessPolicies(t *testing.T) {
+	ts := apiServer(t)
+	defer ts.Close()
+
+	c := newTestClient(t, ts)
+
+	list, err := c.ListMetricsAccessPolicies(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "100", list.Metadata.ResourceVersion)
+	assert.Equal(t, []MetricsAccessPolicy{
+		{
+			Metadata: ObjectMeta{Name: "viewers", Namespace: "team-a", ResourceVersion: "98"},
+			Spec:     MetricsAccessPolicySpec{Roles: []string{"team-a-viewer"}},
+		},
+		{
+			Metadata: ObjectMeta{Name: "sre", Namespace: "lfgw", ResourceVersion: "99"},
+			Spec:     MetricsAccessPolicySpec{Roles: []string{"sre"}, Namespaces: ".*"},
+		},
+	}, list.Items)
+
+	t.Run("Invalid token", func(t *testing.T) {
+		assert.Nil(t, os.WriteFile(c.TokenPath, []byte("random-token"), 0o600))
+
+		_, err := c.ListMetricsAccessPolicies(context.Background())
+		assert.NotNil(t, err)
+	})
+}
+
+func TestClient_WaitForMetricsAccessPolicyChange(t *testing.T) {
+	tests := []struct {
+		name        string
+		events      []string
+		wantChanged bool
+		wantErr     error
+		wantAnyErr  bool
+	}{
+		{
+			name:        "Change after a bookmark",
+			events:      []string{`{"type":"BOOKMARK","object":{}}`, `{"type":"MODIFIED","object":{}}`},
+			wantChanged: true,
+		},
+		{
+			name:        "Watch ended without changes",
+			events:      []string{`{"type":"BOOKMARK","object":{}}`},
+			wantChanged: false,
+		},
+		{
+			name:       "Expired resource version",
+			events:     []string{`{"type":"ERROR","object":{"code":410,"message":"too old resource version"}}`},
+			wantErr:    ErrWatchExpired,
+			wantAnyErr: true,
+		},
+		{
+			name:       "Other errors",
+			events:     []string{`{"type":"ERROR","object":{"code":500,"message":"internal error"}}`},
+			wantAnyErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := apiServer(t, tt.events...)
+			defer ts.Close()
+
+			c := newTestClient(t, ts)
+
+			changed, err := c.WaitForMetricsAccessPolicyChange(context.Background(), "100")
+			assert.Equal(t, tt.wantChanged, changed)
+			assert.Equal(t, tt.wantAnyErr, err != nil)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_ConfigMap(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/lfgw/configmaps/acl":
+			_, _ = w.Write([]byte(`{"metadata":{"name":"acl","namespace":"lfgw","resourceVersion":"42"},"data":{"acl.yaml":"admin: .*"}}`))
+		case r.URL.Path == "/api/v1/namespaces/lfgw/configmaps" && r.URL.Query().Get("watch") == "1":
+			assert.Equal(t, "metadata.name=acl", r.URL.Query().Get("fieldSelector"))
+			assert.Equal(t, "42", r.URL.Query().Get("resourceVersion"))
+			_, _ = w.Write([]byte(`{"type":"MODIFIED","object":{}}` + "\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c := &Client{
+		APIServerURL: ts.URL,
+		Token:        "static-token",
+		HTTPClient:   ts.Client(),
+	}
+
+	cm, err := c.GetConfigMap(context.Background(), "lfgw", "acl")
+	assert.Nil(t, err)
+	assert.Equal(t, ConfigMap{
+		Metadata: ObjectMeta{Name: "acl", Namespace: "lfgw", ResourceVersion: "42"},
+		Data:     map[string]string{"acl.yaml": "admin: .*"},
+	}, cm)
+
+	changed, err := c.WaitForConfigMapChange(context.Background(), "lfgw", "acl", "42")
+	assert.Nil(t, err)
+	assert.True(t, changed)
+
+	_, err = c.GetConfigMap(context.Background(), "lfgw", "random-name")
+	assert.NotNil(t, err)
+}
+
+func TestClient_ListNamespaces(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.URL.Query().Get("labelSelector") {
+		case "team=foo":
+			_, _ = w.Write([]byte(`{"items":[{"metadata":{"name":"foo-dev"}},{"metadata":{"name":"foo-prod"}}]}`))
+		case "":
+			_, _ = w.Write([]byte(`{"items":[{"metadata":{"name":"default"}},{"metadata":{"name":"foo-dev"}},{"metadata":{"name":"foo-prod"}}]}`))
+		default:
+			_, _ = w.Write([]byte(`{"items":[]}`))
+		}
+	}))
+	defer ts.Close()
+
+	c := &Client{
+		APIServerURL: ts.URL,
+		HTTPClient:   ts.Client(),
+	}
+
+	tests := []struct {
+		name     string
+		selector string
+		want     []string
+	}{
+		{
+			name:     "selector",
+			selector: "team=foo",
+			want:     []string{"foo-dev", "foo-prod"},
+		},
+		{
+			name:     "no selector",
+			selector: "",
+			want:     []string{"default", "foo-dev", "foo-prod"},
+		},
+		{
+			name:     "no matches",
+			selector: "team=bar",
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.ListNamespaces(context.Background(), tt.selector)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClient_GetEndpointAddresses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/monitoring/endpoints/lfgw" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"subsets":[
+			{"addresses":[{"ip":"10.0.0.1"},{"ip":"10.0.0.2"}],"ports":[{"name":"http","port":8080}]},
+			{"notReadyAddresses":[{"ip":"10.0.0.3"}],"ports":[{"name":"http","port":8080}]}
+		]}`))
+	}))
+	defer ts.Close()
+
+	c := &Client{
+		APIServerURL: ts.URL,
+		HTTPClient:   ts.Client(),
+	}
+
+	got, err := c.GetEndpointAddresses(context.Background(), "monitoring", "lfgw")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.1:8080", "10.0.0.2:8080"}, got)
+
+	_, err = c.GetEndpointAddresses(context.Background(), "monitoring", "random-name")
+	assert.NotNil(t, err)
+}
+
+func TestClient_CanI(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/authorization.k8s.io/v1/subjectaccessreviews" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var review SubjectAccessReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if review.Spec.User == "broken" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		attributes := review.Spec.ResourceAttributes
+		review.Status.Allowed = attributes.Verb == "get" && attributes.Resource == "pods" &&
+			(slices.Contains(review.Spec.Groups, "sre") || (review.Spec.User == "alice" && attributes.Namespace == "team-a"))
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(review)
+	}))
+	defer ts.Close()
+
+	c := &Client{
+		APIServerURL: ts.URL,
+		HTTPClient:   ts.Client(),
+	}
+
+	tests := []struct {
+		name       string
+		user       string
+		groups     []string
+		namespace  string
+		want       bool
+		wantAnyErr bool
+	}{
+		{
+			name:      "Allowed in a namespace",
+			user:      "alice",
+			namespace: "team-a",
+			want:      true,
+		},
+		{
+			name:      "Denied in another namespace",
+			user:      "alice",
+			namespace: "team-b",
+			want:      false,
+		},
+		{
+			name:   "Allowed cluster-wide through a group",
+			user:   "bob",
+			groups: []string{"sre"},
+			want:   true,
+		},
+		{
+			name:       "Error",
+			user:       "broken",
+			wantAnyErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.CanI(context.Background(), tt.user, tt.groups, ResourceAttributes{Namespace: tt.namespace, Verb: "get", Resource: "pods"})
+			assert.Equal(t, tt.wantAnyErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
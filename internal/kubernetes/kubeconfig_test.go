@@ -0,0 +1,83 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClientFromKubeconfig(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer kubeconfig-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"metadata":{"name":"acl","namespace":"lfgw","resourceVersion":"1"}}`))
+	}))
+	defer ts.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "token"), []byte("kubeconfig-token\n"), 0o600))
+
+	content := `apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+  - name: other
+    cluster:
+      server: https://random-cluster.localhost
+  - name: test
+    cluster:
+      server: ` + ts.URL + `
+      certificate-authority-data: ` + base64.StdEncoding.EncodeToString(ca) + `
+contexts:
+  - name: other
+    context:
+      cluster: other
+      user: other
+  - name: test
+    context:
+      cluster: test
+      user: test
+users:
+  - name: other
+    user:
+      token: random-token
+  - name: test
+    user:
+      tokenFile: token
+`
+
+	path := filepath.Join(dir, "config")
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+
+	c, err := NewClientFromKubeconfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, ts.URL, c.APIServerURL)
+	assert.Equal(t, filepath.Join(dir, "token"), c.TokenPath)
+
+	// The request succeeds only if both the CA and the token are picked up
+	_, err = c.GetConfigMap(context.Background(), "lfgw", "acl")
+	assert.Nil(t, err)
+
+	t.Run("Unknown current context", func(t *testing.T) {
+		assert.Nil(t, os.WriteFile(path, []byte("current-context: random-context\n"), 0o600))
+
+		_, err := NewClientFromKubeconfig(path)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := NewClientFromKubeconfig(filepath.Join(dir, "random-file"))
+		assert.NotNil(t, err)
+	})
+}
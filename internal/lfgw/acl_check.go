@@ -0,0 +1,62 @@
+package lfgw
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// CheckACL validates an ACL file the same way it's validated on start and prints normalized label filters of every role, so ACL changes can be gated in CI.
+func CheckACL(c *cli.Context) error {
+	path := c.Args().First()
+	if path == "" {
+		return fmt.Errorf("path to an ACL file is required")
+	}
+
+	return checkACL(c.App.Writer, c.App.ErrWriter, path, c.String("enforced-label"), c.Bool("strict"))
+}
+
+// checkACL loads the ACL file and prints a line per role (role: label filters) to w. Deprecation warnings are printed to errW, with strict they're treated as errors.
+func checkACL(w, errW io.Writer, path, enforcedLabel string, strict bool) error {
+	if strings.TrimSpace(path) == "" {
+		return fmt.Errorf("path to an ACL file is required")
+	}
+
+	acls, warnings, err := querymodifier.NewACLsFromFileWithWarnings(path, enforcedLabel)
+	if err != nil {
+		return fmt.Errorf("%s is invalid: %w", path, err)
+	}
+
+	for _, warning := range warnings {
+		fmt.Fprintf(errW, "warning: %s\n", warning)
+	}
+
+	if strict && len(warnings) > 0 {
+		return fmt.Errorf("%s uses deprecated settings", path)
+	}
+
+	roles := make([]string, 0, len(acls))
+	for role := range acls {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	var app application
+	for _, role := range roles {
+		acl := acls[role]
+
+		if acl.RolePattern != nil {
+			fmt.Fprintf(w, "%s: pattern %s\n", role, acl.RolePattern.Regexp)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %s\n", role, app.labelFiltersString(acl))
+	}
+
+	_, err = fmt.Fprintf(w, "%s is valid (%d definitions)\n", path, len(roles))
+	return err
+}
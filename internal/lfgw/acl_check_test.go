@@ -0,0 +1,83 @@
+package lfgw
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckACL(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		strict     bool
+		want       string
+		wantErrOut string
+		wantErr    bool
+	}{
+		{
+			name:    "valid",
+			content: "version: 2\nroles:\n  team-b: b1, b2\n  team-a: a\n  team-(.+): ${1}-.*\nusers:\n  alice@example.com: alice\n",
+			want:    "team-(.+): pattern ^(?:team-(.+))$\nteam-a: namespace=\"a\"\nteam-b: namespace=~\"b1|b2\"\nuser:alice@example.com: namespace=\"alice\"\n%s is valid (4 definitions)\n",
+		},
+		{
+			name:       "deprecated format",
+			content:    "team-a: a\n",
+			want:       "team-a: namespace=\"a\"\n%s is valid (1 definitions)\n",
+			wantErrOut: "warning: acl.yaml uses the deprecated flat format",
+		},
+		{
+			name:       "deprecated format (strict)",
+			content:    "team-a: a\n",
+			strict:     true,
+			wantErrOut: "warning: acl.yaml uses the deprecated flat format",
+			wantErr:    true,
+		},
+		{
+			name:    "invalid regexp",
+			content: "version: 2\nroles:\n  team-a: a(\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty entry",
+			content: "version: 2\nroles:\n  team-a: ' , '\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate role",
+			content: "version: 2\nroles:\n  team-a: a\n  team-a: b\n",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported version",
+			content: "version: 3\nroles:\n  team-a: a\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "acl.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var out, errOut bytes.Buffer
+			err := checkACL(&out, &errOut, path, "", tt.strict)
+			assert.Contains(t, errOut.String(), tt.wantErrOut)
+
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, fmt.Sprintf(tt.want, path), out.String())
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package lfgw
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/weisdd/lfgw/internal/keycloak"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+var (
+	aclRolesMissingInIdP    atomic.Int64
+	idpRolesWithoutACL      atomic.Int64
+	aclConsistencyLastCheck atomic.Int64
+
+	_ = metrics.NewGauge("acl_consistency_acl_roles_missing_in_idp", func() float64 {
+		return float64(aclRolesMissingInIdP.Load())
+	})
+	_ = metrics.NewGauge("acl_consistency_idp_roles_without_acl", func() float64 {
+		return float64(idpRolesWithoutACL.Load())
+	})
+	_ = metrics.NewGauge("acl_consistency_last_check_timestamp_seconds", func() float64 {
+		return float64(aclConsistencyLastCheck.Load())
+	})
+	aclConsistencyErrorsTotal = metrics.NewCounter("acl_consistency_check_errors_total")
+)
+
+// keycloakDefaultRoles lists roles that Keycloak creates in every realm, they're never expected to have an ACL.
+var keycloakDefaultRoles = []string{"offline_access", "uma_authorization", "default-roles-"}
+
+// configureKeycloakClient sets up a Keycloak Admin API client if any of the features relying on it is enabled.
+func (app *application) configureKeycloakClient() error {
+	if app.ACLConsistencyCheckInterval <= 0 && app.KeycloakRoleSyncInterval <= 0 {
+		return nil
+	}
+
+	client, err := keycloak.NewClient(app.OIDCRealmURL, app.KeycloakAdminURL, app.KeycloakAdminClientID, app.KeycloakAdminClientSecret)
+	if err != nil {
+		return err
+	}
+
+	app.keycloakClient = client
+
+	return nil
+}
+
+// runACLConsistencyChecker periodically compares ACL roles with the roles defined in the IdP until ctx is cancelled.
+func (app *application) runACLConsistencyChecker(ctx context.Context) {
+	app.logger.Info().Caller().
+		Msgf("ACL consistency checker is on (interval: %s)", app.ACLConsistencyCheckInterval)
+
+	ticker := time.NewTicker(app.ACLConsistencyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := app.checkACLConsistency(ctx); err != nil {
+			aclConsistencyErrorsTotal.Inc()
+			app.logger.Error().Caller().
+				Err(err).Msg("ACL consistency check failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkACLConsistency fetches realm (and, optionally, client) roles from the IdP and reports ACL roles that don't exist in the IdP as well as IdP roles that don't have an ACL.
+func (app *application) checkACLConsistency(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	idpRoles, err := app.fetchIdPRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	idpRoleNames := make([]string, 0, len(idpRoles))
+	for _, role := range idpRoles {
+		idpRoleNames = append(idpRoleNames, role.Name)
+	}
+
+	acls := app.getACLs()
+
+	// IdP roles matching role patterns have ACLs, while role patterns themselves (as well as users and clients) are not expected to exist in the IdP
+	aclRoleNames := make([]string, 0, len(acls))
+	for role, acl := range acls {
+		if acl.RolePattern == nil && !querymodifier.IsReservedKey(role) {
+			aclRoleNames = append(aclRoleNames, role)
+		}
+	}
+	for role := range acls.ForRoles(idpRoleNames) {
+		if _, exists := acls[role]; !exists {
+			aclRoleNames = append(aclRoleNames, role)
+		}
+	}
+
+	missingInIdP, withoutACL := app.diffRoles(aclRoleNames, idpRoleNames)
+
+	for _, role := range missingInIdP {
+		app.logger.Warn().Caller().
+			Msgf("ACL role %s does not exist in the IdP", role)
+	}
+
+	// In assumed roles mode, IdP roles without ACL are expected, so there's no need to warn about them
+	if len(withoutACL) > 0 && !app.AssumedRolesEnabled {
+		app.logger.Warn().Caller().
+			Msgf("IdP roles without ACL: %s", strings.Join(withoutACL, ", "))
+	}
+
+	aclRolesMissingInIdP.Store(int64(len(missingInIdP)))
+	idpRolesWithoutACL.Store(int64(len(withoutACL)))
+	aclConsistencyLastCheck.Store(time.Now().Unix())
+
+	return nil
+}
+
+// diffRoles returns sorted lists of ACL roles missing in the IdP and IdP roles without ACL. Keycloak default roles are ignored.
+func (app *application) diffRoles(aclRoles, idpRoles []string) (missingInIdP, withoutACL []string) {
+	acl := make(map[string]bool, len(aclRoles))
+	for _, role := range aclRoles {
+		acl[role] = true
+	}
+
+	idp := make(map[string]bool, len(idpRoles))
+	for _, role := range idpRoles {
+		idp[role] = true
+	}
+
+	for role := range acl {
+		if !idp[role] {
+			missingInIdP = append(missingInIdP, role)
+		}
+	}
+
+	for role := range idp {
+		if acl[role] || isKeycloakDefaultRole(role) {
+			continue
+		}
+		withoutACL = append(withoutACL, role)
+	}
+
+	sort.Strings(missingInIdP)
+	sort.Strings(withoutACL)
+
+	return missingInIdP, withoutACL
+}
+
+// isKeycloakDefaultRole returns true for roles that Keycloak creates on its own.
+func isKeycloakDefaultRole(role string) bool {
+	for _, defaultRole := range keycloakDefaultRoles {
+		if role == defaultRole || (strings.HasSuffix(defaultRole, "-") && strings.HasPrefix(role, defaultRole)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,80 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/keycloak"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_diffRoles(t *testing.T) {
+	app := &application{}
+
+	aclRoles := []string{"team-b", "team-a", "removed-team"}
+	idpRoles := []string{"team-a", "team-b", "new-team", "offline_access", "uma_authorization", "default-roles-monitoring"}
+
+	missingInIdP, withoutACL := app.diffRoles(aclRoles, idpRoles)
+	assert.Equal(t, []string{"removed-team"}, missingInIdP)
+	assert.Equal(t, []string{"new-team"}, withoutACL)
+
+	missingInIdP, withoutACL = app.diffRoles([]string{"team-a"}, []string{"team-a"})
+	assert.Empty(t, missingInIdP)
+	assert.Empty(t, withoutACL)
+}
+
+func TestApp_checkACLConsistency(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/realms/monitoring/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"access_token":"token","expires_in":300}`))
+	})
+	mux.HandleFunc("/admin/realms/monitoring/roles", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]keycloak.Role{{Name: "team-a"}, {Name: "new-team"}})
+	})
+	mux.HandleFunc("/admin/realms/monitoring/clients", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]keycloak.ClientRepresentation{{ID: "uuid", ClientID: "grafana"}})
+	})
+	mux.HandleFunc("/admin/realms/monitoring/clients/uuid/roles", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]keycloak.Role{{Name: "grafana-admin", ClientRole: true}})
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:                        &aclsState{},
+		logger:                      &logger,
+		OIDCRealmURL:                ts.URL + "/realms/monitoring",
+		KeycloakAdminClientID:       "lfgw",
+		KeycloakAdminClientSecret:   "secret",
+		KeycloakRoleClients:         []string{"grafana"},
+		ACLConsistencyCheckInterval: 1,
+		ACLs: querymodifier.ACLs{
+			"team-a":        querymodifier.ACL{RawACL: "team-a"},
+			"grafana-admin": querymodifier.ACL{RawACL: ".*", Fullaccess: true},
+			"removed-team":  querymodifier.ACL{RawACL: "removed-team"},
+		},
+	}
+
+	if err := app.configureKeycloakClient(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := app.checkACLConsistency(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), aclRolesMissingInIdP.Load())
+	assert.Equal(t, int64(1), idpRolesWithoutACL.Load())
+	assert.NotZero(t, aclConsistencyLastCheck.Load())
+
+	t.Run("Unknown client", func(t *testing.T) {
+		app.KeycloakRoleClients = []string{"random-client"}
+		err := app.checkACLConsistency(context.Background())
+		assert.NotNil(t, err)
+	})
+}
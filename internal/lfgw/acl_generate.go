@@ -0,0 +1,100 @@
+package lfgw
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/weisdd/lfgw/internal/kubernetes"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+	"gopkg.in/yaml.v3"
+)
+
+// ACLFromKubernetes is used as an entrypoint for "acl from-k8s" command. It lists namespaces matching a label selector through kubeconfig and prints a role definition granting access to them.
+func ACLFromKubernetes(c *cli.Context) error {
+	path := c.String("kubeconfig")
+	if path == "" {
+		var err error
+		path, err = kubernetes.DefaultKubeconfigPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	client, err := kubernetes.NewClientFromKubeconfig(path)
+	if err != nil {
+		return err
+	}
+
+	namespaces, err := client.ListNamespaces(c.Context, c.String("selector"))
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	definition, err := roleDefinitionForNamespaces(c.String("role"), namespaces, c.String("label"))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(c.App.Writer, definition)
+	return err
+}
+
+// roleDefinitionForNamespaces returns acl.yaml with a single role granting access to the namespaces. The result is validated the same way as acl.yaml is validated on start, so it can be pasted as is.
+func roleDefinitionForNamespaces(role string, namespaces []string, label string) (string, error) {
+	role = strings.TrimSpace(role)
+	if role == "" {
+		return "", fmt.Errorf("role cannot be empty")
+	}
+
+	if len(namespaces) == 0 {
+		return "", fmt.Errorf("no namespaces matched the selector")
+	}
+
+	namespaces = slices.Clone(namespaces)
+	slices.Sort(namespaces)
+
+	type roleDefinition struct {
+		Namespaces string `yaml:"namespaces"`
+		Label      string `yaml:"label,omitempty"`
+	}
+
+	var definition any = strings.Join(namespaces, ", ")
+	if label != "" {
+		definition = roleDefinition{
+			Namespaces: strings.Join(namespaces, ", "),
+			Label:      label,
+		}
+	}
+
+	return encodeACLFile(map[string]any{role: definition}, label)
+}
+
+// encodeACLFile returns acl.yaml (of the current version) with the role definitions. The result is validated the same way as acl.yaml is validated on start, so it can be used as is.
+func encodeACLFile(roles map[string]any, label string) (string, error) {
+	doc := struct {
+		Version int            `yaml:"version"`
+		Roles   map[string]any `yaml:"roles"`
+	}{
+		Version: querymodifier.CurrentACLFileVersion,
+		Roles:   roles,
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	if _, _, err := querymodifier.NewACLsFromBytes(buf.Bytes(), label); err != nil {
+		return "", fmt.Errorf("generated an invalid role definition: %w", err)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,57 @@
+package lfgw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleDefinitionForNamespaces(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       string
+		namespaces []string
+		label      string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "sorted namespaces",
+			role:       "team-foo",
+			namespaces: []string{"foo-prod", "foo-dev"},
+			want:       "version: 2\nroles:\n  team-foo: foo-dev, foo-prod\n",
+		},
+		{
+			name:       "custom label",
+			role:       "team-foo",
+			namespaces: []string{"foo-dev"},
+			label:      "kubernetes_namespace",
+			want:       "version: 2\nroles:\n  team-foo:\n    namespaces: foo-dev\n    label: kubernetes_namespace\n",
+		},
+		{
+			name:       "empty role",
+			role:       " ",
+			namespaces: []string{"foo-dev"},
+			wantErr:    true,
+		},
+		{
+			name:       "no namespaces",
+			role:       "team-foo",
+			namespaces: []string{},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := roleDefinitionForNamespaces(tt.role, tt.namespaces, tt.label)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package lfgw
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/VictoriaMetrics/metricsql"
+	"github.com/urfave/cli/v2"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// migrateFromPathTenancy is a list of tenants served under path prefixes, each restricted by a series selector (e.g. prometheus-filter-proxy)
+	migrateFromPathTenancy = "path-tenancy"
+	// migrateFromLabelValues is a mapping of tenants to the values of a label they can see (e.g. prom-label-proxy, kube-rbac-proxy)
+	migrateFromLabelValues = "label-values"
+)
+
+// pathTenancyConfig is the input of the path-tenancy format.
+type pathTenancyConfig struct {
+	Tenants []struct {
+		Name     string `yaml:"name"`
+		Path     string `yaml:"path"`
+		Selector string `yaml:"selector"`
+	} `yaml:"tenants"`
+}
+
+// labelValuesConfig is the input of the label-values format. Values are given either as a list or as a single value.
+type labelValuesConfig struct {
+	Label   string               `yaml:"label"`
+	Tenants map[string]yaml.Node `yaml:"tenants"`
+}
+
+// migratedRole is a role definition produced by migrateACL, the short form is used if only namespaces are set.
+type migratedRole struct {
+	Namespaces string            `yaml:"namespaces"`
+	Label      string            `yaml:"label,omitempty"`
+	Labels     map[string]string `yaml:"labels,omitempty"`
+}
+
+// MigrateACL is used as an entrypoint for "migrate" command. It converts the configuration of a similar proxy into acl.yaml.
+func MigrateACL(c *cli.Context) error {
+	path := c.Args().First()
+	if path == "" {
+		return fmt.Errorf("path to a configuration file is required")
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return migrateACL(c.App.Writer, c.String("from"), content, c.String("label"))
+}
+
+// migrateACL converts content of the given format into acl.yaml and prints it to w. Roles are enforced on label (the one of the input or DefaultLabel if empty).
+func migrateACL(w io.Writer, from string, content []byte, label string) error {
+	var (
+		roles map[string]migratedRole
+		err   error
+	)
+
+	switch from {
+	case migrateFromPathTenancy:
+		roles, err = migratePathTenancy(content, label)
+	case migrateFromLabelValues:
+		roles, label, err = migrateLabelValues(content, label)
+	default:
+		return fmt.Errorf("unsupported format %q, must be one of: %s, %s", from, migrateFromPathTenancy, migrateFromLabelValues)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(roles) == 0 {
+		return fmt.Errorf("no tenants found")
+	}
+
+	definitions := make(map[string]any, len(roles))
+	for role, definition := range roles {
+		if label != "" && label != querymodifier.DefaultLabel {
+			definition.Label = label
+		}
+
+		if definition.Label == "" && len(definition.Labels) == 0 {
+			definitions[role] = definition.Namespaces
+			continue
+		}
+
+		definitions[role] = definition
+	}
+
+	out, err := encodeACLFile(definitions, "")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(w, out)
+	return err
+}
+
+// migratePathTenancy converts series selectors of tenants into role definitions. Tenants are named after the last segment of their path unless the name is set explicitly.
+func migratePathTenancy(content []byte, label string) (map[string]migratedRole, error) {
+	if label == "" {
+		label = querymodifier.DefaultLabel
+	}
+
+	var config pathTenancyConfig
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]migratedRole, len(config.Tenants))
+	for i, tenant := range config.Tenants {
+		role := tenant.Name
+		if role == "" {
+			role = path.Base(strings.TrimRight(tenant.Path, "/"))
+		}
+		if role == "" || role == "." || role == "/" {
+			return nil, fmt.Errorf("tenant #%d has neither name nor path", i+1)
+		}
+
+		if _, exists := roles[role]; exists {
+			return nil, fmt.Errorf("tenant %s is defined more than once", role)
+		}
+
+		definition, err := roleFromSelector(tenant.Selector, label)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", role, err)
+		}
+
+		roles[role] = definition
+	}
+
+	return roles, nil
+}
+
+// roleFromSelector converts a series selector (e.g. {namespace=~"a|b", cluster="prod"}) into a role definition: filters on label become namespaces (negative ones are denied), filters on other labels become extra labels.
+func roleFromSelector(selector, label string) (migratedRole, error) {
+	if strings.TrimSpace(selector) == "" {
+		return migratedRole{Namespaces: ".*"}, nil
+	}
+
+	expr, err := metricsql.Parse(selector)
+	if err != nil {
+		return migratedRole{}, fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+
+	me, ok := expr.(*metricsql.MetricExpr)
+	if !ok {
+		return migratedRole{}, fmt.Errorf("%q is not a series selector", selector)
+	}
+
+	var namespaces []string
+	labels := map[string]string{}
+
+	for _, lf := range me.LabelFilters {
+		values := migratedValues(lf)
+
+		switch {
+		case lf.Label == "__name__":
+			return migratedRole{}, fmt.Errorf("metric names in selectors are not supported (%q)", selector)
+		case lf.Label == label:
+			if lf.IsNegative {
+				for i := range values {
+					values[i] = "!" + values[i]
+				}
+			}
+			namespaces = append(namespaces, values...)
+		case lf.IsNegative:
+			return migratedRole{}, fmt.Errorf("negative filters are supported only for %s (%q)", label, selector)
+		default:
+			if _, exists := labels[lf.Label]; exists {
+				return migratedRole{}, fmt.Errorf("%s is filtered more than once (%q)", lf.Label, selector)
+			}
+			labels[lf.Label] = strings.Join(values, ", ")
+		}
+	}
+
+	if len(namespaces) == 0 {
+		namespaces = []string{".*"}
+	}
+
+	definition := migratedRole{Namespaces: strings.Join(namespaces, ", ")}
+	if len(labels) > 0 {
+		definition.Labels = labels
+	}
+
+	return definition, nil
+}
+
+// migratedValues returns ACL entries matching the same values as the filter: exact matches are escaped, simple alternations of regular expressions are split.
+func migratedValues(lf metricsql.LabelFilter) []string {
+	if !lf.IsRegexp {
+		return []string{regexp.QuoteMeta(lf.Value)}
+	}
+
+	if strings.ContainsAny(lf.Value, "()") {
+		return []string{lf.Value}
+	}
+
+	return strings.Split(lf.Value, "|")
+}
+
+// migrateLabelValues converts lists of label values of tenants into role definitions. Values are matched literally. The label of the input takes precedence over label.
+func migrateLabelValues(content []byte, label string) (map[string]migratedRole, string, error) {
+	var config labelValuesConfig
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, "", err
+	}
+
+	if config.Label != "" {
+		label = config.Label
+	}
+
+	tenants := make([]string, 0, len(config.Tenants))
+	for tenant := range config.Tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	roles := make(map[string]migratedRole, len(tenants))
+	for _, tenant := range tenants {
+		node := config.Tenants[tenant]
+
+		var values []string
+		if node.Kind == yaml.ScalarNode {
+			values = []string{node.Value}
+		} else if err := node.Decode(&values); err != nil {
+			return nil, "", fmt.Errorf("tenant %s: expected a value or a list of values", tenant)
+		}
+
+		if len(values) == 0 {
+			return nil, "", fmt.Errorf("tenant %s has no values", tenant)
+		}
+
+		for i := range values {
+			values[i] = regexp.QuoteMeta(values[i])
+		}
+
+		roles[tenant] = migratedRole{Namespaces: strings.Join(values, ", ")}
+	}
+
+	return roles, label, nil
+}
@@ -0,0 +1,120 @@
+package lfgw
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateACL(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		content string
+		label   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "path tenancy",
+			from: migrateFromPathTenancy,
+			content: `tenants:
+  - path: /team-a/
+    selector: '{namespace=~"payments|billing"}'
+  - name: team-b
+    path: /b
+    selector: '{namespace="b.1", cluster=~"prod-1|prod-2"}'
+  - path: /sre
+  - path: /dev
+    selector: '{namespace!~"kube-.*"}'
+`,
+			want: `version: 2
+roles:
+  dev: '!kube-.*'
+  sre: .*
+  team-a: payments, billing
+  team-b:
+    namespaces: b\.1
+    labels:
+      cluster: prod-1, prod-2
+`,
+		},
+		{
+			name:    "path tenancy with another label",
+			from:    migrateFromPathTenancy,
+			content: "tenants:\n  - path: /a\n    selector: '{tenant=\"a\"}'\n",
+			label:   "tenant",
+			want:    "version: 2\nroles:\n  a:\n    namespaces: a\n    label: tenant\n",
+		},
+		{
+			name:    "negative filters on other labels",
+			from:    migrateFromPathTenancy,
+			content: "tenants:\n  - path: /a\n    selector: '{namespace=\"a\", cluster!=\"prod\"}'\n",
+			wantErr: true,
+		},
+		{
+			name:    "metric names",
+			from:    migrateFromPathTenancy,
+			content: "tenants:\n  - path: /a\n    selector: 'up{namespace=\"a\"}'\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate tenants",
+			from:    migrateFromPathTenancy,
+			content: "tenants:\n  - path: /a\n  - path: /x/a\n",
+			wantErr: true,
+		},
+		{
+			name:    "tenant without name and path",
+			from:    migrateFromPathTenancy,
+			content: "tenants:\n  - selector: '{namespace=\"a\"}'\n",
+			wantErr: true,
+		},
+		{
+			name:    "label values",
+			from:    migrateFromLabelValues,
+			content: "tenants:\n  team-a: [payments, billing]\n  team-b: b.1\n",
+			want:    "version: 2\nroles:\n  team-a: payments, billing\n  team-b: b\\.1\n",
+		},
+		{
+			name:    "label values with a label",
+			from:    migrateFromLabelValues,
+			content: "label: tenant\ntenants:\n  acme: [acme]\n",
+			want:    "version: 2\nroles:\n  acme:\n    namespaces: acme\n    label: tenant\n",
+		},
+		{
+			name:    "label values without values",
+			from:    migrateFromLabelValues,
+			content: "tenants:\n  acme: []\n",
+			wantErr: true,
+		},
+		{
+			name:    "no tenants",
+			from:    migrateFromLabelValues,
+			content: "tenants: {}\n",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported format",
+			from:    "unknown",
+			content: "tenants: {}\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := migrateACL(&out, tt.from, []byte(tt.content), tt.label)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// maxACLSimulationSize limits the size of simulation requests accepted through the admin endpoint
+const maxACLSimulationSize = 1 << 20
+
+// aclSimulationRequest describes a token to compute the ACL for: its roles and optionally the email / client ID (so users and clients sections are covered). AssumedRoles overrides ASSUMED_ROLES if set.
+type aclSimulationRequest struct {
+	Roles        []string `json:"roles"`
+	Email        string   `json:"email,omitempty"`
+	ClientID     string   `json:"client_id,omitempty"`
+	AssumedRoles *bool    `json:"assumed_roles,omitempty"`
+}
+
+// aclSimulationResponse is the ACL lfgw would compute for an aclSimulationRequest. Error is set if no ACL can be computed (e.g. there are no matching roles).
+type aclSimulationResponse struct {
+	Roles              []string          `json:"roles"`
+	MatchedRoles       []string          `json:"matched_roles"`
+	Fullaccess         bool              `json:"fullaccess"`
+	RawACL             string            `json:"raw_acl,omitempty"`
+	RawDenyACL         string            `json:"raw_deny_acl,omitempty"`
+	LabelFilter        string            `json:"label_filter,omitempty"`
+	ForcedParams       map[string]string `json:"forced_params,omitempty"`
+	Write              bool              `json:"write"`
+	Paths              []string          `json:"paths,omitempty"`
+	Methods            []string          `json:"methods,omitempty"`
+	AggregationOnly    bool              `json:"aggregation_only"`
+	MinSeries          int               `json:"min_series,omitempty"`
+	ResponseTimeBudget string            `json:"response_time_budget,omitempty"`
+	Error              string            `json:"error,omitempty"`
+}
+
+// aclSimulationHandler returns the composite ACL lfgw would compute for a token with the given roles using the current ACLs and settings, which is useful for access reviews. It requires an admin token and accepts a JSON object via POST. Source networks and token binding of roles are not considered.
+func (app *application) aclSimulationHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		app.clientError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxACLSimulationSize))
+	if err != nil {
+		app.clientErrorMessage(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var req aclSimulationRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		app.clientErrorMessage(w, http.StatusBadRequest, fmt.Errorf("failed to parse the request: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app.simulateACL(req)); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// simulateACL computes the ACL for the request the same way oidcMiddleware does.
+func (app *application) simulateACL(req aclSimulationRequest) aclSimulationResponse {
+	assumedRolesEnabled := app.AssumedRolesEnabled
+	if req.AssumedRoles != nil {
+		assumedRolesEnabled = *req.AssumedRoles
+	}
+
+	roles := app.tokenRoles(userClaims{Roles: req.Roles, Email: req.Email, ClientID: req.ClientID})
+	if roles == nil {
+		roles = []string{}
+	}
+
+	resp := aclSimulationResponse{
+		Roles:        roles,
+		MatchedRoles: []string{},
+	}
+
+	for role := range app.getACLs().ForRoles(roles) {
+		resp.MatchedRoles = append(resp.MatchedRoles, role)
+	}
+	sort.Strings(resp.MatchedRoles)
+
+	acl, err := app.getUserACLWithAssumedRoles(roles, assumedRolesEnabled)
+	if err == nil {
+		acl, err = app.withSharedNamespaces(acl)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+
+	resp.Fullaccess = acl.Fullaccess
+	resp.RawACL = acl.RawACL
+	resp.RawDenyACL = acl.RawDenyACL
+	resp.LabelFilter = app.labelFiltersString(acl)
+	resp.ForcedParams = acl.ForcedParams
+	resp.Write = acl.Write
+	resp.Paths = acl.Paths
+	resp.Methods = acl.Methods
+	resp.AggregationOnly = acl.AggregationOnly
+	resp.MinSeries = acl.MinSeries
+	if acl.ResponseTimeBudget > 0 {
+		resp.ResponseTimeBudget = acl.ResponseTimeBudget.String()
+	}
+
+	return resp
+}
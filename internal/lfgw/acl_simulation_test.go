@@ -0,0 +1,135 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_aclSimulationHandler(t *testing.T) {
+	acls, _, err := querymodifier.NewACLsFromBytes([]byte(`version: 2
+roles:
+  admin: .*
+  team-a:
+    namespaces: a, !a-secret
+    forced_params:
+      deny_partial_response: "1"
+  team-b:
+    namespaces: b
+    write: true
+    methods: [GET]
+users:
+  alice@example.com: alice
+`), querymodifier.DefaultLabel)
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:          &aclsState{},
+		logger:        &logger,
+		AdminToken:    "secret",
+		ACLs:          acls,
+		EnforcedLabel: querymodifier.DefaultLabel,
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := app.nonProxiedEndpointsMiddleware(next)
+
+	request := func(method, authorization, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(method, "/admin/acl-simulate", strings.NewReader(body))
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "", `{"roles": ["team-a"]}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodGet, "Bearer secret", "").Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "Bearer secret", "[").Code)
+
+	tests := []struct {
+		name string
+		body string
+		want aclSimulationResponse
+	}{
+		{
+			name: "composite ACL",
+			body: `{"roles": ["team-a", "team-b", "unknown"]}`,
+			want: aclSimulationResponse{
+				Roles:        []string{"team-a", "team-b", "unknown"},
+				MatchedRoles: []string{"team-a", "team-b"},
+				RawACL:       "a, b",
+				RawDenyACL:   "a-secret",
+				LabelFilter:  `namespace=~"a|b", namespace!~"a-secret"`,
+				ForcedParams: map[string]string{"deny_partial_response": "1"},
+				Write:        true,
+			},
+		},
+		{
+			name: "full access",
+			body: `{"roles": ["team-a", "admin"]}`,
+			want: aclSimulationResponse{
+				Roles:        []string{"team-a", "admin"},
+				MatchedRoles: []string{"admin", "team-a"},
+				Fullaccess:   true,
+				RawACL:       ".*",
+				LabelFilter:  `namespace=~".*"`,
+				ForcedParams: map[string]string{"deny_partial_response": "1"},
+			},
+		},
+		{
+			name: "users",
+			body: `{"roles": [], "email": "alice@example.com"}`,
+			want: aclSimulationResponse{
+				Roles:        []string{"user:alice@example.com"},
+				MatchedRoles: []string{"user:alice@example.com"},
+				RawACL:       "alice",
+				LabelFilter:  `namespace="alice"`,
+			},
+		},
+		{
+			name: "no matching roles",
+			body: `{"roles": ["minio"]}`,
+			want: aclSimulationResponse{
+				Roles:        []string{"minio"},
+				MatchedRoles: []string{},
+				Error:        querymodifier.ErrNoMatchingRoles.Error(),
+			},
+		},
+		{
+			name: "assumed roles",
+			body: `{"roles": ["minio"], "assumed_roles": true}`,
+			want: aclSimulationResponse{
+				Roles:        []string{"minio"},
+				MatchedRoles: []string{},
+				RawACL:       "minio",
+				LabelFilter:  `namespace="minio"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rr := request(http.MethodPost, "Bearer secret", tt.body)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			var got aclSimulationResponse
+			assert.Nil(t, json.NewDecoder(rr.Body).Decode(&got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
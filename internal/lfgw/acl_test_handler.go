@@ -0,0 +1,149 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// maxACLTestSize limits the size of ACL test suites accepted through the admin endpoint
+const maxACLTestSize = 4 << 20
+
+// aclTestCase is a single case of an ACL regression suite: a query made by a token with the roles (and optionally the email / client ID, so users and clients sections are covered) is expected to be rewritten into Expected, or to be denied.
+type aclTestCase struct {
+	Name     string   `json:"name,omitempty"`
+	Roles    []string `json:"roles"`
+	Email    string   `json:"email,omitempty"`
+	ClientID string   `json:"client_id,omitempty"`
+	Query    string   `json:"query"`
+	Expected string   `json:"expected,omitempty"`
+	Denied   bool     `json:"denied,omitempty"`
+}
+
+// aclTestResult is the outcome of an aclTestCase.
+type aclTestResult struct {
+	aclTestCase
+	Got   string `json:"got,omitempty"`
+	Error string `json:"error,omitempty"`
+	Pass  bool   `json:"pass"`
+}
+
+// aclTestReport is returned by aclTestHandler.
+type aclTestReport struct {
+	Passed  int             `json:"passed"`
+	Failed  int             `json:"failed"`
+	Results []aclTestResult `json:"results"`
+}
+
+// aclTestHandler runs a batch of ACL test cases against the current ACLs and settings, so authorization regression suites can be run in CI against a live gateway. It requires an admin token and accepts a JSON list of cases via POST. Failed cases don't change the status code, the report contains the number of failures.
+func (app *application) aclTestHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		app.clientError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxACLTestSize))
+	if err != nil {
+		app.clientErrorMessage(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var cases []aclTestCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		app.clientErrorMessage(w, http.StatusBadRequest, fmt.Errorf("failed to parse test cases: %w", err))
+		return
+	}
+
+	report := aclTestReport{
+		Results: make([]aclTestResult, 0, len(cases)),
+	}
+
+	for _, tc := range cases {
+		result := app.runACLTestCase(tc)
+		if result.Pass {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// runACLTestCase rewrites the query of a test case the same way rewriteRequestMiddleware does and compares it with the expected one. Both queries are normalized, so formatting differences don't matter. Source networks and token binding of roles are not considered.
+func (app *application) runACLTestCase(tc aclTestCase) aclTestResult {
+	result := aclTestResult{aclTestCase: tc}
+
+	got, err := app.rewriteTestQuery(tc)
+	if err != nil {
+		result.Error = err.Error()
+		result.Pass = tc.Denied
+		return result
+	}
+
+	result.Got = got
+	if tc.Denied {
+		return result
+	}
+
+	result.Pass = got == normalizeQuery(tc.Expected)
+
+	return result
+}
+
+// rewriteTestQuery returns the query of a test case rewritten according to the ACL of its roles.
+func (app *application) rewriteTestQuery(tc aclTestCase) (string, error) {
+	roles := app.tokenRoles(userClaims{Roles: tc.Roles, Email: tc.Email, ClientID: tc.ClientID})
+
+	acl, err := app.getUserACL(roles)
+	if err != nil {
+		return "", err
+	}
+
+	acl, err = app.withSharedNamespaces(acl)
+	if err != nil {
+		return "", err
+	}
+
+	if acl.Fullaccess {
+		return normalizeQuery(tc.Query), nil
+	}
+
+	qm := app.newQueryModifier(acl)
+
+	rawQuery, err := qm.GetModifiedEncodedURLValues(url.Values{"query": {tc.Query}})
+	if err != nil {
+		return "", err
+	}
+
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", err
+	}
+
+	return params.Get("query"), nil
+}
+
+// normalizeQuery returns the query in the form produced by rewrites, queries that cannot be parsed are returned as is.
+func normalizeQuery(query string) string {
+	expr, err := metricsql.Parse(query)
+	if err != nil {
+		return query
+	}
+
+	return string(expr.AppendString(nil))
+}
@@ -0,0 +1,100 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_aclTestHandler(t *testing.T) {
+	acls, _, err := querymodifier.NewACLsFromBytes([]byte(`version: 2
+roles:
+  admin: .*
+  team-a: a
+users:
+  alice@example.com: alice
+`), querymodifier.DefaultLabel)
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:          &aclsState{},
+		logger:        &logger,
+		AdminToken:    "secret",
+		ACLs:          acls,
+		EnforcedLabel: querymodifier.DefaultLabel,
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := app.nonProxiedEndpointsMiddleware(next)
+
+	request := func(method, authorization, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(method, "/admin/acl-test", strings.NewReader(body))
+		r.Header.Set("Authorization", authorization)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+
+		return rr
+	}
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "", "[]").Code)
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "Bearer random", "[]").Code)
+	})
+
+	t.Run("Wrong method", func(t *testing.T) {
+		assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodGet, "Bearer secret", "").Code)
+	})
+
+	t.Run("Invalid suite", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "Bearer secret", "{").Code)
+	})
+
+	t.Run("Cases", func(t *testing.T) {
+		body := `[
+  {"name": "rewrite", "roles": ["team-a"], "query": "up", "expected": "up{namespace=\"a\"}"},
+  {"name": "formatting", "roles": ["team-a"], "query": "sum(up)", "expected": "sum( up{ namespace = \"a\" } )"},
+  {"name": "full access", "roles": ["admin"], "query": "up", "expected": "up"},
+  {"name": "user", "email": "alice@example.com", "query": "up", "expected": "up{namespace=\"alice\"}"},
+  {"name": "denied", "roles": ["unknown"], "query": "up", "denied": true},
+  {"name": "wrong expectation", "roles": ["team-a"], "query": "up", "expected": "up{namespace=\"b\"}"},
+  {"name": "unexpectedly denied", "roles": ["unknown"], "query": "up", "expected": "up"}
+]`
+		rr := request(http.MethodPost, "Bearer secret", body)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var report aclTestReport
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		assert.Equal(t, 5, report.Passed)
+		assert.Equal(t, 2, report.Failed)
+
+		pass := make(map[string]bool, len(report.Results))
+		for _, result := range report.Results {
+			pass[result.Name] = result.Pass
+		}
+
+		assert.Equal(t, map[string]bool{
+			"rewrite":             true,
+			"formatting":          true,
+			"full access":         true,
+			"user":                true,
+			"denied":              true,
+			"wrong expectation":   false,
+			"unexpectedly denied": false,
+		}, pass)
+
+		assert.Equal(t, `up{namespace="a"}`, report.Results[5].Got)
+		assert.NotEmpty(t, report.Results[6].Error)
+	})
+}
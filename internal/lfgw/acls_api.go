@@ -0,0 +1,98 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/weisdd/lfgw/internal/querymodifier"
+	"gopkg.in/yaml.v3"
+)
+
+// maxACLImportSize limits the size of ACL documents accepted through the admin endpoint
+const maxACLImportSize = 10 << 20
+
+// aclsHandler exports the document the current ACLs were loaded from (GET, YAML by default, JSON with ?format=json) and atomically replaces the ACLs with an imported document (PUT, YAML or JSON). An imported document is validated in the same way as on start, the current ACLs are kept if it's invalid. It requires an admin token.
+func (app *application) aclsHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		app.exportACLs(w, r)
+	case http.MethodPut:
+		app.importACLs(w, r)
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+		app.clientError(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// exportACLs writes the document the current ACLs were loaded from.
+func (app *application) exportACLs(w http.ResponseWriter, r *http.Request) {
+	app.acls.mu.RLock()
+	document := app.acls.document
+	app.acls.mu.RUnlock()
+
+	if document == nil {
+		app.clientErrorMessage(w, http.StatusConflict, errACLsNotExportable)
+		return
+	}
+
+	if r.URL.Query().Get("format") != "json" {
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(document)
+		return
+	}
+
+	var v any
+	if err := yaml.Unmarshal(document, &v); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// importACLs validates the document in the request body and swaps ACLs.
+func (app *application) importACLs(w http.ResponseWriter, r *http.Request) {
+	if app.ACLSource == aclSourceKubernetesRBAC {
+		app.clientErrorMessage(w, http.StatusConflict, errACLsNotImportable)
+		return
+	}
+
+	document, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxACLImportSize))
+	if err != nil {
+		app.clientErrorMessage(w, http.StatusBadRequest, err)
+		return
+	}
+
+	acls, warnings, err := querymodifier.NewACLsFromBytes(document, app.EnforcedLabel)
+	if err != nil {
+		app.clientErrorMessage(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := app.handleDeprecations("admin API", warnings); err != nil {
+		app.clientErrorMessage(w, http.StatusBadRequest, err)
+		return
+	}
+
+	app.logger.Info().Caller().
+		Msgf("Importing ACL through the admin API")
+	app.logRoleDefinitions(acls)
+
+	previous := app.setACLsDocument(acls, document)
+	aclLastSuccessfulReload.Set(float64(time.Now().Unix()))
+
+	app.logACLSummary(previous, acls)
+
+	app.propagateToPeers(w, r, document)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_aclsHandler(t *testing.T) {
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:       &aclsState{},
+		logger:     &logger,
+		AdminToken: "secret",
+		ACLSource:  aclSourceFile,
+	}
+	app.setACLs(querymodifier.ACLs{})
+	defer app.setACLs(querymodifier.ACLs{})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := app.nonProxiedEndpointsMiddleware(next)
+
+	request := func(method, target, authorization, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	document := "version: 2\nroles:\n  team-a: a\n  admin: .*\n"
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/admin/acls", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPut, "/admin/acls", "Bearer wrong", document).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodPost, "/admin/acls", "Bearer secret", document).Code)
+
+	t.Run("ACLs not loaded from a document cannot be exported", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, request(http.MethodGet, "/admin/acls", "Bearer secret", "").Code)
+	})
+
+	t.Run("Import and export", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, request(http.MethodPut, "/admin/acls", "Bearer secret", document).Code)
+		assert.Contains(t, app.getACLs(), "team-a")
+
+		rr := request(http.MethodGet, "/admin/acls", "Bearer secret", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/yaml", rr.Header().Get("Content-Type"))
+		assert.Equal(t, document, rr.Body.String())
+
+		rr = request(http.MethodGet, "/admin/acls?format=json", "Bearer secret", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"version": 2, "roles": {"team-a": "a", "admin": ".*"}}`, rr.Body.String())
+	})
+
+	t.Run("JSON documents can be imported", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, request(http.MethodPut, "/admin/acls", "Bearer secret", `{"version": 2, "roles": {"team-b": "b"}}`).Code)
+		assert.Contains(t, app.getACLs(), "team-b")
+		assert.NotContains(t, app.getACLs(), "team-a")
+	})
+
+	t.Run("Invalid documents are rejected", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/admin/acls", "Bearer secret", "version: 2\nroles:\n  team-c: c(\n").Code)
+		assert.Contains(t, app.getACLs(), "team-b")
+	})
+
+	t.Run("ACLs derived from Kubernetes RBAC cannot be imported", func(t *testing.T) {
+		app.ACLSource = aclSourceKubernetesRBAC
+		defer func() { app.ACLSource = aclSourceFile }()
+
+		assert.Equal(t, http.StatusConflict, request(http.MethodPut, "/admin/acls", "Bearer secret", document).Code)
+	})
+}
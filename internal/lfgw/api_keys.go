@@ -0,0 +1,394 @@
+package lfgw
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+const (
+	// apiKeyPrefix makes API keys easy to tell apart from jwt-tokens (and to find in leaked secrets)
+	apiKeyPrefix = "lfgw_"
+	// apiKeyRolePrefix marks the pseudo-role requests authenticated with API keys get, so they can be told apart in fault rules and request tags
+	apiKeyRolePrefix = "api-key:"
+
+	// maxAPIKeyRequestSize limits the size of requests minting API keys
+	maxAPIKeyRequestSize = 64 << 10
+)
+
+// apiKeyStore keeps API keys indexed by the hash of the key.
+type apiKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*apiKey
+}
+
+// apiKey is an API key issued to an external consumer. Only the SHA-256 hash of the key is stored, so the key itself is shown only once, when it's minted.
+type apiKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	ACL       string    `json:"acl"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	acl       querymodifier.ACL
+}
+
+// apiKeyInfo is the representation of an API key returned by the admin API.
+type apiKeyInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	ACL       string    `json:"acl"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Expired   bool      `json:"expired"`
+	// Key is set only in responses to minting requests
+	Key string `json:"key,omitempty"`
+}
+
+// apiKeyRequest is a request to mint an API key.
+type apiKeyRequest struct {
+	Name string `json:"name"`
+	ACL  string `json:"acl"`
+	TTL  string `json:"ttl"`
+}
+
+// info returns the representation of the key for the admin API.
+func (k *apiKey) info(now time.Time) apiKeyInfo {
+	return apiKeyInfo{
+		ID:        k.ID,
+		Name:      k.Name,
+		ACL:       k.ACL,
+		CreatedAt: k.CreatedAt,
+		ExpiresAt: k.ExpiresAt,
+		Expired:   !now.Before(k.ExpiresAt),
+	}
+}
+
+// hashAPIKey returns the hex-encoded SHA-256 hash of the key. Keys are random enough, so there's no need for a slow hash.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes encoded with base64 (URL-safe, no padding).
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// apiKeysLabel returns the label ACLs of API keys are applied to.
+func (app *application) apiKeysLabel() string {
+	if app.EnforcedLabel == "" {
+		return querymodifier.DefaultLabel
+	}
+
+	return app.EnforcedLabel
+}
+
+// configureAPIKeys loads API keys from app.APIKeysPath if it's set. A missing file means there are no keys yet.
+func (app *application) configureAPIKeys() error {
+	app.apiKeys = nil
+	if app.APIKeysPath == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(app.APIKeysPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		app.apiKeys = &apiKeyStore{keys: map[string]*apiKey{}}
+		app.logger.Info().Caller().
+			Msgf("API keys are enabled, %s does not exist yet", app.APIKeysPath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var stored []*apiKey
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return fmt.Errorf("failed to parse API keys: %w", err)
+	}
+
+	keys := make(map[string]*apiKey, len(stored))
+	for _, key := range stored {
+		key.acl, err = querymodifier.NewACLForLabel(app.apiKeysLabel(), key.ACL)
+		if err != nil {
+			return fmt.Errorf("API key %s: %w", key.ID, err)
+		}
+		keys[key.Hash] = key
+	}
+
+	app.apiKeys = &apiKeyStore{keys: keys}
+
+	app.logger.Info().Caller().
+		Msgf("Loaded %d API key(s) from %s", len(keys), app.APIKeysPath)
+
+	return nil
+}
+
+// saveAPIKeys writes API keys to app.APIKeysPath atomically (through a temporary file), so a crash never leaves a truncated file behind. It must be called with app.apiKeys.mu held.
+func (app *application) saveAPIKeys() error {
+	stored := make([]*apiKey, 0, len(app.apiKeys.keys))
+	for _, key := range app.apiKeys.keys {
+		stored = append(stored, key)
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].CreatedAt.Before(stored[j].CreatedAt) })
+
+	content, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(app.APIKeysPath), ".api-keys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), app.APIKeysPath)
+}
+
+// lookupAPIKey returns the API key matching the raw key.
+func (app *application) lookupAPIKey(rawKey string, now time.Time) (*apiKey, error) {
+	app.apiKeys.mu.RLock()
+	key, ok := app.apiKeys.keys[hashAPIKey(rawKey)]
+	app.apiKeys.mu.RUnlock()
+
+	if !ok {
+		return nil, errAPIKeyInvalid
+	}
+
+	if !now.Before(key.ExpiresAt) {
+		return nil, errAPIKeyExpired
+	}
+
+	return key, nil
+}
+
+// isAPIKey returns true if the bearer token should be treated as an API key rather than as a jwt-token.
+func (app *application) isAPIKey(rawToken string) bool {
+	return app.apiKeys != nil && strings.HasPrefix(rawToken, apiKeyPrefix)
+}
+
+// authenticateAPIKey authorizes a request made with an API key: the ACL of the key is set in the request context. The key never reaches the upstream.
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, rawKey string) {
+	key, err := app.lookupAPIKey(rawKey, time.Now())
+	if err != nil {
+		hlog.FromRequest(r).Error().Caller().
+			Err(err).Msg("")
+		app.userError(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	acl, err := app.withSharedNamespaces(key.acl)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.allowRequestDebug(r, acl)
+	app.enrichLogContext(r, "api_key", key.ID)
+	app.setAccessLogUser(r, key.ID)
+	app.enrichLogContext(r, "api_key_name", key.Name)
+	app.setMetricsTenant(r, []string{apiKeyRolePrefix + key.ID})
+	app.enrichDebugLogContext(r, "label_filter", app.labelFiltersString(acl))
+
+	r.Header.Del("Authorization")
+	r.Header.Del("X-Forwarded-Access-Token")
+	r.Header.Del("X-Auth-Request-Access-Token")
+
+	ctx := context.WithValue(r.Context(), contextKeyACL, acl)
+	ctx = context.WithValue(ctx, contextKeyRoles, []string{apiKeyRolePrefix + key.ID})
+	ctx = context.WithValue(ctx, contextKeyIdentity, identity{APIKey: key.ID})
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// mintAPIKey creates a new API key and persists it.
+func (app *application) mintAPIKey(req apiKeyRequest, now time.Time) (apiKeyInfo, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return apiKeyInfo{}, fmt.Errorf("name cannot be empty")
+	}
+
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil || ttl <= 0 {
+		return apiKeyInfo{}, fmt.Errorf("ttl must be a positive duration, e.g. 720h")
+	}
+	if app.APIKeysMaxTTL > 0 && ttl > app.APIKeysMaxTTL {
+		return apiKeyInfo{}, fmt.Errorf("ttl cannot exceed %s", app.APIKeysMaxTTL)
+	}
+
+	acl, err := querymodifier.NewACLForLabel(app.apiKeysLabel(), req.ACL)
+	if err != nil {
+		return apiKeyInfo{}, fmt.Errorf("invalid acl: %w", err)
+	}
+
+	id, err := randomString(9)
+	if err != nil {
+		return apiKeyInfo{}, err
+	}
+
+	secret, err := randomString(32)
+	if err != nil {
+		return apiKeyInfo{}, err
+	}
+	rawKey := apiKeyPrefix + secret
+
+	key := &apiKey{
+		ID:        id,
+		Name:      req.Name,
+		ACL:       req.ACL,
+		Hash:      hashAPIKey(rawKey),
+		CreatedAt: now.UTC(),
+		ExpiresAt: now.Add(ttl).UTC(),
+		acl:       acl,
+	}
+
+	app.apiKeys.mu.Lock()
+	defer app.apiKeys.mu.Unlock()
+
+	app.apiKeys.keys[key.Hash] = key
+	if err := app.saveAPIKeys(); err != nil {
+		delete(app.apiKeys.keys, key.Hash)
+		return apiKeyInfo{}, fmt.Errorf("failed to save API keys: %w", err)
+	}
+
+	info := key.info(now)
+	info.Key = rawKey
+
+	return info, nil
+}
+
+// revokeAPIKey removes the API key with the given ID and persists the change. It returns false if there's no such key.
+func (app *application) revokeAPIKey(id string) (bool, error) {
+	app.apiKeys.mu.Lock()
+	defer app.apiKeys.mu.Unlock()
+
+	for hash, key := range app.apiKeys.keys {
+		if key.ID != id {
+			continue
+		}
+
+		delete(app.apiKeys.keys, hash)
+		if err := app.saveAPIKeys(); err != nil {
+			app.apiKeys.keys[hash] = key
+			return false, fmt.Errorf("failed to save API keys: %w", err)
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// listAPIKeys returns all API keys (including expired ones) sorted by creation time.
+func (app *application) listAPIKeys(now time.Time) []apiKeyInfo {
+	app.apiKeys.mu.RLock()
+	defer app.apiKeys.mu.RUnlock()
+
+	keys := make([]apiKeyInfo, 0, len(app.apiKeys.keys))
+	for _, key := range app.apiKeys.keys {
+		keys = append(keys, key.info(now))
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+
+	return keys
+}
+
+// apiKeysHandler manages API keys, it requires an admin token: GET lists keys, POST mints a key (the key is returned only once), DELETE revokes the key passed as the id parameter.
+func (app *application) apiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if app.apiKeys == nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	if !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(app.listAPIKeys(time.Now())); err != nil {
+			app.serverError(w, r, err)
+		}
+	case http.MethodPost:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIKeyRequestSize))
+		if err != nil {
+			app.clientErrorMessage(w, http.StatusBadRequest, err)
+			return
+		}
+
+		var req apiKeyRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			app.clientErrorMessage(w, http.StatusBadRequest, fmt.Errorf("failed to parse the request: %w", err))
+			return
+		}
+
+		info, err := app.mintAPIKey(req, time.Now())
+		if err != nil {
+			app.clientErrorMessage(w, http.StatusBadRequest, err)
+			return
+		}
+
+		app.logger.Warn().Caller().
+			Str("api_key", info.ID).Str("api_key_name", info.Name).Str("acl", info.ACL).Time("expires_at", info.ExpiresAt).
+			Msg("API key minted")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			app.serverError(w, r, err)
+		}
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+
+		revoked, err := app.revokeAPIKey(id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if !revoked {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+
+		app.logger.Warn().Caller().
+			Str("api_key", id).Msg("API key revoked")
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodDelete}, ", "))
+		app.clientError(w, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,162 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_apiKeys(t *testing.T) {
+	ts := oidcIDPServer(t)
+	defer ts.Close()
+
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:        &logger,
+		OIDCRealmURL:  ts.URL,
+		OIDCClientID:  "grafana",
+		AdminToken:    "secret",
+		APIKeysPath:   filepath.Join(t.TempDir(), "api-keys.json"),
+		APIKeysMaxTTL: 24 * time.Hour,
+	}
+
+	if err := app.configureOIDCVerifier(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, app.configureAPIKeys())
+
+	admin := func(method, target, authorization, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", authorization)
+
+		rr := httptest.NewRecorder()
+		app.nonProxiedEndpointsMiddleware(http.NotFoundHandler()).ServeHTTP(rr, r)
+
+		return rr
+	}
+
+	var gotACL querymodifier.ACL
+	var gotAuthorization string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotACL, _ = r.Context().Value(contextKeyACL).(querymodifier.ACL)
+		gotAuthorization = r.Header.Get("Authorization")
+	})
+
+	query := func(key string) int {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil)
+		r.Header.Set("Authorization", "Bearer "+key)
+
+		rr := httptest.NewRecorder()
+		app.oidcMiddleware(next).ServeHTTP(rr, r)
+
+		return rr.Code
+	}
+
+	t.Run("Admin token is required", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, admin(http.MethodGet, "/admin/api-keys", "", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, admin(http.MethodPost, "/admin/api-keys", "Bearer random", `{}`).Code)
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		for _, body := range []string{
+			`{`,
+			`{"acl": "team-a", "ttl": "1h"}`,
+			`{"name": "customer", "acl": "team-a"}`,
+			`{"name": "customer", "acl": "team-a", "ttl": "48h"}`,
+			`{"name": "customer", "acl": "team-a, [", "ttl": "1h"}`,
+		} {
+			assert.Equal(t, http.StatusBadRequest, admin(http.MethodPost, "/admin/api-keys", "Bearer secret", body).Code, body)
+		}
+	})
+
+	rr := admin(http.MethodPost, "/admin/api-keys", "Bearer secret", `{"name": "customer", "acl": "team-a", "ttl": "1h"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var minted apiKeyInfo
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &minted))
+	assert.True(t, strings.HasPrefix(minted.Key, apiKeyPrefix))
+	assert.NotEmpty(t, minted.ID)
+
+	t.Run("Keys are stored hashed", func(t *testing.T) {
+		content, err := os.ReadFile(app.APIKeysPath)
+		assert.Nil(t, err)
+		assert.NotContains(t, string(content), minted.Key)
+		assert.Contains(t, string(content), hashAPIKey(minted.Key))
+	})
+
+	t.Run("Keys are listed without secrets", func(t *testing.T) {
+		rr := admin(http.MethodGet, "/admin/api-keys", "Bearer secret", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), minted.Key)
+
+		var keys []apiKeyInfo
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &keys))
+		assert.Len(t, keys, 1)
+		assert.Equal(t, "customer", keys[0].Name)
+	})
+
+	t.Run("Keys grant their ACL", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, query(minted.Key))
+
+		want, err := querymodifier.NewACL("team-a")
+		assert.Nil(t, err)
+		assert.Equal(t, want, gotACL)
+		assert.Empty(t, gotAuthorization)
+
+		assert.Equal(t, http.StatusUnauthorized, query(apiKeyPrefix+"random"))
+	})
+
+	t.Run("Token exchange is skipped for keys", func(t *testing.T) {
+		var calls atomic.Int32
+		ts := tokenEndpointServer(t, &calls, 300)
+		defer ts.Close()
+
+		app.tokenExchanger = newTokenExchanger(ts.URL, "lfgw", "secret", "prometheus", "", nil)
+		defer func() {
+			app.tokenExchanger = nil
+		}()
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil)
+		r.Header.Set("Authorization", "Bearer "+minted.Key)
+
+		rr := httptest.NewRecorder()
+		app.oidcMiddleware(app.tokenExchangeMiddleware(next)).ServeHTTP(rr, r)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, gotAuthorization)
+		assert.Zero(t, calls.Load())
+	})
+
+	t.Run("Keys survive restarts", func(t *testing.T) {
+		assert.Nil(t, app.configureAPIKeys())
+		assert.Equal(t, http.StatusOK, query(minted.Key))
+	})
+
+	t.Run("Expired keys", func(t *testing.T) {
+		_, err := app.lookupAPIKey(minted.Key, time.Now().Add(2*time.Hour))
+		assert.ErrorIs(t, err, errAPIKeyExpired)
+	})
+
+	t.Run("Revoked keys", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, admin(http.MethodDelete, "/admin/api-keys?id=random", "Bearer secret", "").Code)
+		assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "/admin/api-keys?id="+minted.ID, "Bearer secret", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, query(minted.Key))
+
+		assert.Nil(t, app.configureAPIKeys())
+		assert.Equal(t, http.StatusUnauthorized, query(minted.Key))
+	})
+}
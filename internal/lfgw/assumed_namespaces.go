@@ -0,0 +1,123 @@
+package lfgw
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/kubernetes"
+)
+
+var assumedRolesRejected = metrics.NewCounter("assumed_roles_rejected_total")
+
+// assumedNamespacesCache keeps names of existing namespaces, so the Kubernetes API is not queried on every request.
+type assumedNamespacesCache struct {
+	mu         sync.Mutex
+	namespaces map[string]bool
+	expires    time.Time
+}
+
+// configureAssumedNamespaces sets up a Kubernetes client (in-cluster or through kubeconfig) used to verify that assumed roles correspond to existing namespaces.
+func (app *application) configureAssumedNamespaces() error {
+	app.assumedNamespaces = nil
+	if !app.AssumedRolesVerifyNamespaces {
+		return nil
+	}
+
+	if app.kubernetesClient == nil {
+		client, err := kubernetes.NewClient()
+		if err != nil {
+			return err
+		}
+
+		app.kubernetesClient = client
+	}
+
+	app.assumedNamespaces = &assumedNamespacesCache{}
+
+	app.logger.Info().Caller().
+		Msgf("Assumed roles are honored only for existing namespaces (cache TTL: %s)", app.AssumedRolesCacheTTL)
+
+	return nil
+}
+
+// verifyAssumedRoles drops unknown roles that would be assumed as anything but the name of an existing namespace (e.g. typos, regular expressions). Known roles and roles that cannot be assumed are kept as is.
+func (app *application) verifyAssumedRoles(r *http.Request, roles []string) ([]string, error) {
+	if !app.AssumedRolesEnabled || app.assumedNamespaces == nil {
+		return roles, nil
+	}
+
+	acls := app.getACLs().ForRoles(roles)
+
+	verified := make([]string, 0, len(roles))
+	rejected := []string{}
+
+	var namespaces map[string]bool
+	for _, role := range roles {
+		if _, exists := acls[role]; exists {
+			verified = append(verified, role)
+			continue
+		}
+
+		namespace, ok := app.assumedRoles.RawACL(role)
+		if !ok {
+			verified = append(verified, role)
+			continue
+		}
+
+		if namespaces == nil {
+			var err error
+			namespaces, err = app.existingNamespaces(r.Context())
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if namespaces[namespace] {
+			verified = append(verified, role)
+			continue
+		}
+
+		rejected = append(rejected, role)
+	}
+
+	if len(rejected) > 0 {
+		assumedRolesRejected.Add(len(rejected))
+		hlog.FromRequest(r).Warn().Caller().
+			Strs("rejected_roles", rejected).Msg("Assumed roles don't match existing namespaces")
+	}
+
+	return verified, nil
+}
+
+// existingNamespaces returns names of existing namespaces, cached for AssumedRolesCacheTTL. API errors are not cached.
+func (app *application) existingNamespaces(ctx context.Context) (map[string]bool, error) {
+	now := time.Now()
+
+	cache := app.assumedNamespaces
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.namespaces != nil && now.Before(cache.expires) {
+		return cache.namespaces, nil
+	}
+
+	list, err := app.kubernetesClient.ListNamespaces(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	namespaces := make(map[string]bool, len(list))
+	for _, namespace := range list {
+		namespaces[namespace] = true
+	}
+
+	cache.namespaces = namespaces
+	cache.expires = now.Add(app.AssumedRolesCacheTTL)
+
+	return namespaces, nil
+}
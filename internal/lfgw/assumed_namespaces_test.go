@@ -0,0 +1,94 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/kubernetes"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_verifyAssumedRoles(t *testing.T) {
+	var lists atomic.Int64
+	var broken atomic.Bool
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces" || broken.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		lists.Add(1)
+		_, _ = w.Write([]byte(`{"items":[{"metadata":{"name":"team-a"}},{"metadata":{"name":"team-b"}}]}`))
+	}))
+	defer ts.Close()
+
+	acls, _, err := querymodifier.NewACLsFromBytes([]byte("viewer: public\n"), "")
+	assert.Nil(t, err)
+
+	assumedRoles, err := querymodifier.NewAssumedRoles("ns:", "")
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:                         &aclsState{},
+		logger:                       &logger,
+		ACLs:                         acls,
+		AssumedRolesEnabled:          true,
+		AssumedRolesVerifyNamespaces: true,
+		AssumedRolesCacheTTL:         time.Minute,
+		assumedRoles:                 assumedRoles,
+		kubernetesClient: &kubernetes.Client{
+			APIServerURL: ts.URL,
+			HTTPClient:   ts.Client(),
+		},
+		assumedNamespaces: &assumedNamespacesCache{},
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+
+	t.Run("Roles of missing namespaces are dropped", func(t *testing.T) {
+		got, err := app.verifyAssumedRoles(r, []string{"viewer", "ns:team-a", "ns:tema-b", "ns:.*", "developer"})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"viewer", "ns:team-a", "developer"}, got)
+	})
+
+	t.Run("Namespaces are cached", func(t *testing.T) {
+		got, err := app.verifyAssumedRoles(r, []string{"ns:team-b"})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"ns:team-b"}, got)
+		assert.Equal(t, int64(1), lists.Load())
+	})
+
+	t.Run("API errors are not cached", func(t *testing.T) {
+		broken.Store(true)
+		app.assumedNamespaces.mu.Lock()
+		app.assumedNamespaces.expires = time.Time{}
+		app.assumedNamespaces.mu.Unlock()
+
+		_, err := app.verifyAssumedRoles(r, []string{"ns:team-a"})
+		assert.NotNil(t, err)
+
+		broken.Store(false)
+		got, err := app.verifyAssumedRoles(r, []string{"ns:team-a"})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"ns:team-a"}, got)
+	})
+
+	t.Run("Known roles don't need the API", func(t *testing.T) {
+		broken.Store(true)
+		defer broken.Store(false)
+		app.assumedNamespaces.mu.Lock()
+		app.assumedNamespaces.expires = time.Time{}
+		app.assumedNamespaces.mu.Unlock()
+
+		got, err := app.verifyAssumedRoles(r, []string{"viewer"})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"viewer"}, got)
+	})
+}
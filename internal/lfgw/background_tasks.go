@@ -0,0 +1,233 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	taskStatusRunning    = "running"
+	taskStatusRestarting = "restarting"
+	taskStatusStopped    = "stopped"
+
+	// taskMinBackoff and taskMaxBackoff bound the delay before a failed task is restarted, it doubles after every consecutive failure
+	taskMinBackoff = time.Second
+	taskMaxBackoff = time.Minute
+)
+
+// backgroundTaskState is the health of a background task.
+type backgroundTaskState struct {
+	Status    string    `json:"status"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// backgroundTasks supervises long-running subsystems (watchers, pollers, schedulers). A task that fails, panics or returns before shutdown is logged and restarted with a backoff, so it neither stops silently nor brings down the whole process. Tasks are expected to return once their context is cancelled.
+type backgroundTasks struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	group  errgroup.Group
+	logger *zerolog.Logger
+
+	mu     sync.Mutex
+	states map[string]*backgroundTaskState
+}
+
+// newBackgroundTasks returns a supervisor with no tasks.
+func newBackgroundTasks(logger *zerolog.Logger) *backgroundTasks {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &backgroundTasks{
+		ctx:    ctx,
+		cancel: cancel,
+		logger: logger,
+		states: make(map[string]*backgroundTaskState),
+	}
+}
+
+// Go starts the task under supervision. Its health is exposed as the background_task_up gauge and restarts are counted in background_task_restarts_total.
+func (t *backgroundTasks) Go(name string, task func(ctx context.Context) error) {
+	t.setState(name, taskStatusRunning, nil)
+
+	metrics.GetOrCreateGauge(fmt.Sprintf(`background_task_up{task=%q}`, name), func() float64 {
+		if t.status(name) == taskStatusRunning {
+			return 1
+		}
+		return 0
+	})
+
+	t.group.Go(func() error {
+		t.supervise(name, task)
+		return nil
+	})
+}
+
+// supervise runs the task until shutdown, restarting it every time it fails.
+func (t *backgroundTasks) supervise(name string, task func(ctx context.Context) error) {
+	backoff := taskMinBackoff
+
+	for {
+		started := time.Now()
+		err := runTask(t.ctx, task)
+
+		if t.ctx.Err() != nil {
+			t.setState(name, taskStatusStopped, err)
+			return
+		}
+
+		if err == nil {
+			err = errTaskExited
+		}
+
+		// A task that has been running for a while is considered healthy, so its next failure starts a new series of backoffs
+		if time.Since(started) > taskMaxBackoff {
+			backoff = taskMinBackoff
+		}
+
+		t.setState(name, taskStatusRestarting, err)
+		metrics.GetOrCreateCounter(fmt.Sprintf(`background_task_restarts_total{task=%q}`, name)).Inc()
+		t.logger.Error().Caller().
+			Str("task", name).Err(err).Msgf("Background task failed, restarting in %s", backoff)
+
+		select {
+		case <-t.ctx.Done():
+			t.setState(name, taskStatusStopped, err)
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, taskMaxBackoff)
+		t.setState(name, taskStatusRunning, nil)
+	}
+}
+
+// runTask runs the task, a panic is returned as an error.
+func runTask(ctx context.Context, task func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return task(ctx)
+}
+
+// untilCancelled adapts a function running until ctx is cancelled to a task.
+func untilCancelled(run func(ctx context.Context)) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		run(ctx)
+		return nil
+	}
+}
+
+// setState records the status of the task. Restarts are counted on transitions to taskStatusRestarting, err is kept as the last error.
+func (t *backgroundTasks) setState(name, status string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.states[name]
+	if !ok {
+		state = &backgroundTaskState{}
+		t.states[name] = state
+	}
+
+	if status == taskStatusRestarting {
+		state.Restarts++
+	}
+
+	if err != nil {
+		state.LastError = err.Error()
+	}
+
+	state.Status = status
+	state.Since = time.Now().UTC()
+}
+
+// status returns the status of the task.
+func (t *backgroundTasks) status(name string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if state, ok := t.states[name]; ok {
+		return state.Status
+	}
+
+	return ""
+}
+
+// snapshot returns a copy of states of all tasks.
+func (t *backgroundTasks) snapshot() map[string]backgroundTaskState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	states := make(map[string]backgroundTaskState, len(t.states))
+	for name, state := range t.states {
+		states[name] = *state
+	}
+
+	return states
+}
+
+// Shutdown cancels all tasks and waits for them to return until ctx is done.
+func (t *backgroundTasks) Shutdown(ctx context.Context) error {
+	t.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		_ = t.group.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		states := t.snapshot()
+
+		running := []string{}
+		for name, state := range states {
+			if state.Status != taskStatusStopped {
+				running = append(running, name)
+			}
+		}
+		sort.Strings(running)
+
+		return fmt.Errorf("background tasks did not stop in time: %v", running)
+	}
+}
+
+// tasksHandler returns the health of background tasks as JSON, it requires an admin token.
+func (app *application) tasksHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		app.clientError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	states := map[string]backgroundTaskState{}
+	if app.tasks != nil {
+		states = app.tasks.snapshot()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(states); err != nil {
+		hlog.FromRequest(r).Error().Caller().
+			Err(err).Msg("")
+	}
+}
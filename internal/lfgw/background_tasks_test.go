@@ -0,0 +1,95 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackgroundTasks(t *testing.T) {
+	logger := zerolog.New(nil)
+	tasks := newBackgroundTasks(&logger)
+
+	var runs atomic.Int64
+	tasks.Go("flaky", func(ctx context.Context) error {
+		if runs.Add(1) == 1 {
+			panic("watcher is broken")
+		}
+
+		<-ctx.Done()
+		return nil
+	})
+	tasks.Go("steady", untilCancelled(func(ctx context.Context) {
+		<-ctx.Done()
+	}))
+
+	t.Run("Failed task is restarted", func(t *testing.T) {
+		assert.Eventually(t, func() bool {
+			return runs.Load() == 2
+		}, 5*time.Second, 10*time.Millisecond)
+
+		state := tasks.snapshot()["flaky"]
+		assert.Equal(t, taskStatusRunning, state.Status)
+		assert.Equal(t, 1, state.Restarts)
+		assert.Equal(t, "panic: watcher is broken", state.LastError)
+
+		assert.Equal(t, taskStatusRunning, tasks.snapshot()["steady"].Status)
+	})
+
+	t.Run("Health is reported", func(t *testing.T) {
+		app := &application{
+			AdminToken: "admin",
+			tasks:      tasks,
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/admin/tasks", nil)
+		r.Header.Set("Authorization", "Bearer admin")
+		rr := httptest.NewRecorder()
+		app.tasksHandler(rr, r)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var states map[string]backgroundTaskState
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &states))
+		assert.Equal(t, 1, states["flaky"].Restarts)
+
+		rr = httptest.NewRecorder()
+		app.tasksHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/tasks", nil))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		assert.Nil(t, tasks.Shutdown(ctx))
+
+		for name, state := range tasks.snapshot() {
+			assert.Equal(t, taskStatusStopped, state.Status, name)
+		}
+	})
+}
+
+func TestBackgroundTasks_Shutdown(t *testing.T) {
+	logger := zerolog.New(nil)
+	tasks := newBackgroundTasks(&logger)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	tasks.Go("stuck", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.EqualError(t, tasks.Shutdown(ctx), "background tasks did not stop in time: [stuck]")
+}
@@ -0,0 +1,66 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+	"github.com/urfave/cli/v2"
+)
+
+// BuildInfoMetadataKey is the key of cli.App.Metadata the build info is passed through from main, where it's set via ldflags.
+const BuildInfoMetadataKey = "buildInfo"
+
+// BuildInfo describes the build of lfgw, so it's possible to track what is actually deployed.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// buildInfoFromContext returns the build info passed through app metadata, fields are "unknown" if it's not set (e.g. in tests).
+func buildInfoFromContext(c *cli.Context) BuildInfo {
+	if c.App != nil {
+		if info, ok := c.App.Metadata[BuildInfoMetadataKey].(BuildInfo); ok {
+			return info
+		}
+	}
+
+	return BuildInfo{
+		Version:   "unknown",
+		Commit:    "unknown",
+		Date:      "unknown",
+		GoVersion: "unknown",
+	}
+}
+
+// registerBuildInfo logs the build info and exposes it as the lfgw_build_info gauge, which always equals 1.
+func (app *application) registerBuildInfo() {
+	info := app.buildInfo
+
+	app.logger.Info().Caller().
+		Str("version", info.Version).Str("commit", info.Commit).Str("date", info.Date).Str("go_version", info.GoVersion).
+		Msg("Starting lfgw")
+
+	metrics.GetOrCreateGauge(fmt.Sprintf(`lfgw_build_info{version=%q,commit=%q,date=%q,go_version=%q}`, info.Version, info.Commit, info.Date, info.GoVersion), func() float64 {
+		return 1
+	})
+}
+
+// versionHandler returns the build info as JSON.
+func (app *application) versionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		app.clientError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app.buildInfo); err != nil {
+		hlog.FromRequest(r).Error().Caller().
+			Err(err).Msg("")
+	}
+}
@@ -0,0 +1,69 @@
+package lfgw
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_versionHandler(t *testing.T) {
+	app := &application{
+		buildInfo: BuildInfo{
+			Version:   "0.13.0",
+			Commit:    "8a15b8e",
+			Date:      "2024-02-01T10:00:00Z",
+			GoVersion: "go1.21.6",
+		},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "GET",
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"version":"0.13.0","commit":"8a15b8e","date":"2024-02-01T10:00:00Z","go_version":"go1.21.6"}`,
+		},
+		{
+			name:       "POST",
+			method:     http.MethodPost,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			app.versionHandler(rr, httptest.NewRequest(tt.method, "/version", nil))
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestApp_registerBuildInfo(t *testing.T) {
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:    &logger,
+		buildInfo: BuildInfo{Version: "buildinfo-test", Commit: "none", Date: "unknown", GoVersion: "go1.21.6"},
+	}
+
+	app.registerBuildInfo()
+
+	var buf bytes.Buffer
+	metrics.WritePrometheus(&buf, false)
+	assert.Contains(t, buf.String(), `lfgw_build_info{version="buildinfo-test",commit="none",date="unknown",go_version="go1.21.6"} 1`)
+}
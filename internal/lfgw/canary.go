@@ -0,0 +1,310 @@
+package lfgw
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// canaryPath is the endpoint canary queries are sent to.
+const canaryPath = "/api/v1/query"
+
+// canaryRemoteAddr is the source address of canary queries. It's taken from TEST-NET-1 (RFC 5737), so it's never a real client and `source_cidrs` that include loopback addresses don't apply to canary queries.
+const canaryRemoteAddr = "192.0.2.1:0"
+
+// canaryMaxResponseSize limits the part of canary responses that is kept.
+const canaryMaxResponseSize = 1 << 20
+
+// canaryResponseWriter collects the response to a canary query, which is served in-process. The body is truncated to canaryMaxResponseSize.
+type canaryResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// newCanaryResponseWriter returns an empty canaryResponseWriter.
+func newCanaryResponseWriter() *canaryResponseWriter {
+	return &canaryResponseWriter{
+		header: http.Header{},
+	}
+}
+
+// Header implements http.ResponseWriter.
+func (w *canaryResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *canaryResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write implements http.ResponseWriter.
+func (w *canaryResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+
+	if remaining := canaryMaxResponseSize - w.body.Len(); remaining > 0 {
+		w.body.Write(b[:min(len(b), remaining)])
+	}
+
+	return len(b), nil
+}
+
+// Flush implements http.Flusher, there's nothing to flush.
+func (w *canaryResponseWriter) Flush() {}
+
+// statusCode returns the status code of the response, 200 if none was written explicitly.
+func (w *canaryResponseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+
+	return w.status
+}
+
+// canaryResponse represents the part of a Prometheus API response the canary cares about.
+type canaryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+// canaryCredentials obtains tokens for canary queries from the token endpoint through the client credentials flow and caches them until they are about to expire.
+type canaryCredentials struct {
+	tokenURL string
+	clientID string
+	client   *http.Client
+
+	mu    sync.Mutex
+	token exchangedToken
+}
+
+// newCanaryCredentials returns canaryCredentials without a cached token.
+func newCanaryCredentials(tokenURL, clientID string) *canaryCredentials {
+	return &canaryCredentials{
+		tokenURL: tokenURL,
+		clientID: clientID,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// accessToken returns a cached token or requests a new one with clientSecret.
+func (cc *canaryCredentials) accessToken(ctx context.Context, clientSecret string) (string, error) {
+	cc.mu.Lock()
+	token := cc.token
+	cc.mu.Unlock()
+
+	if token.accessToken != "" && time.Now().Add(tokenExchangeExpiryMargin).Before(token.expiresAt) {
+		return token.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cc.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(cc.clientID), url.QueryEscape(clientSecret))
+
+	resp, err := cc.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get a canary token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to get a canary token: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get a canary token: %s: %s", resp.Status, body)
+	}
+
+	var tr tokenExchangeResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return "", fmt.Errorf("failed to get a canary token: %w", err)
+	}
+
+	if tr.AccessToken == "" {
+		return "", fmt.Errorf("failed to get a canary token: no access_token in response")
+	}
+
+	// Tokens without expires_in are not cached, because we cannot tell when they become invalid
+	if tr.ExpiresIn > 0 {
+		cc.mu.Lock()
+		cc.token = exchangedToken{
+			accessToken: tr.AccessToken,
+			expiresAt:   time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second),
+		}
+		cc.mu.Unlock()
+	}
+
+	return tr.AccessToken, nil
+}
+
+// configureCanary sets up the way canary queries are authenticated. If CanaryClientID is set, tokens are obtained from the token endpoint (tokenURL) through the client credentials flow. Otherwise, CanaryToken is used as is, so it's rejected if it has already expired (opaque tokens are not checked).
+func (app *application) configureCanary(tokenURL string) error {
+	// Just to make sure our logging calls are always safe
+	if app.logger == nil {
+		app.configureLogging()
+	}
+
+	if app.CanaryInterval <= 0 {
+		return nil
+	}
+
+	if app.CanaryClientID != "" {
+		if tokenURL == "" {
+			return fmt.Errorf("canary client credentials are set, but token endpoint is unknown")
+		}
+
+		app.canaryCredentials = newCanaryCredentials(tokenURL, app.CanaryClientID)
+		return nil
+	}
+
+	expiresAt, ok := jwtExpiresAt(app.CanaryToken)
+	if !ok {
+		return nil
+	}
+
+	if !time.Now().Before(expiresAt) {
+		return fmt.Errorf("CANARY_TOKEN expired at %s, use CANARY_CLIENT_ID and CANARY_CLIENT_SECRET to obtain canary tokens through client credentials instead", expiresAt.Format(time.RFC3339))
+	}
+
+	app.logger.Warn().Caller().
+		Msgf("CANARY_TOKEN expires at %s, canary queries will fail afterwards unless it's rotated or CANARY_CLIENT_ID and CANARY_CLIENT_SECRET are used instead", expiresAt.Format(time.RFC3339))
+
+	return nil
+}
+
+// jwtExpiresAt returns the expiration time (exp) of a JWT without verifying it. false is returned if the token is not a JWT or has no expiration time.
+func jwtExpiresAt(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ExpiresAt == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(claims.ExpiresAt, 0), true
+}
+
+// splitCanaryQueries splits a semicolon-separated list of queries (commas are common in PromQL, so they can't be used as a separator).
+func splitCanaryQueries(s string) []string {
+	var queries []string
+
+	for _, q := range strings.Split(s, ";") {
+		q = strings.TrimSpace(q)
+		if q != "" {
+			queries = append(queries, q)
+		}
+	}
+
+	return queries
+}
+
+// runCanaryScheduler periodically sends canary queries through handler (full auth, rewrite and proxy path) until ctx is cancelled.
+func (app *application) runCanaryScheduler(ctx context.Context, handler http.Handler) {
+	app.logger.Info().Caller().
+		Msgf("Canary queries are on (interval: %s, queries: %d)", app.CanaryInterval, len(app.CanaryQueries))
+
+	ticker := time.NewTicker(app.CanaryInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, query := range app.CanaryQueries {
+			app.runCanaryQuery(ctx, handler, query)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runCanaryQuery sends a single canary query through handler and updates the respective metrics.
+func (app *application) runCanaryQuery(ctx context.Context, handler http.Handler, query string) {
+	start := time.Now()
+	err := app.sendCanaryQuery(ctx, handler, query)
+	duration := time.Since(start).Seconds()
+
+	metrics.GetOrCreateSummary(fmt.Sprintf("canary_request_duration_seconds{query=%q}", query)).Update(duration)
+
+	if err != nil {
+		metrics.GetOrCreateCounter(fmt.Sprintf(`canary_requests_total{query=%q,status="failure"}`, query)).Inc()
+		app.logger.Error().Caller().
+			Err(err).Msgf("Canary query %s failed", query)
+		return
+	}
+
+	metrics.GetOrCreateCounter(fmt.Sprintf(`canary_requests_total{query=%q,status="success"}`, query)).Inc()
+	metrics.GetOrCreateFloatCounter(fmt.Sprintf("canary_last_success_timestamp_seconds{query=%q}", query)).Set(float64(time.Now().Unix()))
+}
+
+// sendCanaryQuery sends a query authenticated with CanaryToken (or a token obtained through client credentials) through handler, it returns an error unless the upstream reports success.
+func (app *application) sendCanaryQuery(ctx context.Context, handler http.Handler, query string) error {
+	ctx, cancel := context.WithTimeout(ctx, app.CanaryInterval)
+	defer cancel()
+
+	params := url.Values{}
+	params.Set("query", query)
+
+	token := app.currentSecret("CANARY_TOKEN", app.CanaryToken)
+	if app.canaryCredentials != nil {
+		var err error
+		token, err = app.canaryCredentials.accessToken(ctx, app.currentSecret("CANARY_CLIENT_SECRET", app.CanaryClientSecret))
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, canaryPath+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.RemoteAddr = canaryRemoteAddr
+
+	rw := newCanaryResponseWriter()
+	handler.ServeHTTP(rw, req)
+
+	status := fmt.Sprintf("%d %s", rw.statusCode(), http.StatusText(rw.statusCode()))
+
+	var cr canaryResponse
+	if err := json.Unmarshal(rw.body.Bytes(), &cr); err != nil {
+		return fmt.Errorf("%s: %s", status, strings.TrimSpace(rw.body.String()))
+	}
+
+	if rw.statusCode() != http.StatusOK || cr.Status != "success" {
+		return fmt.Errorf("%s: %s", status, cr.Error)
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestSplitCanaryQueries(t *testing.T) {
+	assert.Equal(t, []string{`up{job="prometheus"}`, "sum by (namespace, pod) (kube_pod_info)"}, splitCanaryQueries(` up{job="prometheus"} ;sum by (namespace, pod) (kube_pod_info);; `))
+	assert.Nil(t, splitCanaryQueries(""))
+}
+
+func TestApp_runCanaryQuery(t *testing.T) {
+	idp := oidcIDPServer(t)
+	defer idp.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The query must have been rewritten according to the canary role
+		if r.URL.Query().Get("query") != `up{namespace="monitoring"}` {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"error","error":"unexpected query"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, err := url.Parse(upstream.URL)
+	assert.Nil(t, err)
+
+	acl, err := querymodifier.NewACL("monitoring")
+	assert.Nil(t, err)
+
+	clientID := "canaryclientid"
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:           &aclsState{},
+		logger:         &logger,
+		OIDCRealmURL:   idp.URL,
+		OIDCClientID:   clientID,
+		UpstreamURL:    upstreamURL,
+		ACLs:           querymodifier.ACLs{"canary": acl},
+		CanaryInterval: 5 * time.Second,
+		proxy:          httputil.NewSingleHostReverseProxy(upstreamURL),
+	}
+
+	if err := app.configureOIDCVerifier(); err != nil {
+		t.Fatal(err)
+	}
+
+	type testClaims struct {
+		userClaims
+		jwt.StandardClaims
+	}
+
+	app.CanaryToken = oidcGenerateToken(t, testClaims{
+		userClaims{
+			Roles: []string{"canary"},
+		},
+		jwt.StandardClaims{
+			Audience:  clientID,
+			ExpiresAt: time.Now().Add(time.Minute * 5).Unix(),
+			Issuer:    idp.URL,
+		},
+	})
+
+	tests := []struct {
+		name       string
+		query      string
+		token      string
+		wantStatus string
+	}{
+		{
+			name:       "Success",
+			query:      "up",
+			token:      app.CanaryToken,
+			wantStatus: "success",
+		},
+		{
+			name:       "Upstream error",
+			query:      "down",
+			token:      app.CanaryToken,
+			wantStatus: "failure",
+		},
+		{
+			name:       "Invalid token",
+			query:      "up",
+			token:      "invalid",
+			wantStatus: "failure",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.CanaryToken = tt.token
+
+			counter := metrics.GetOrCreateCounter(fmt.Sprintf(`canary_requests_total{query=%q,status=%q}`, tt.query, tt.wantStatus))
+			before := counter.Get()
+
+			app.runCanaryQuery(context.Background(), app.routes(), tt.query)
+
+			assert.Equal(t, before+1, counter.Get())
+		})
+	}
+
+	t.Run("Roles limited to loopback addresses don't apply", func(t *testing.T) {
+		loopbackOnly := acl
+		loopbackOnly.SourceCIDRs = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+		app.ACLs = querymodifier.ACLs{"canary": loopbackOnly}
+		defer func() { app.ACLs = querymodifier.ACLs{"canary": acl} }()
+
+		err := app.sendCanaryQuery(context.Background(), app.routes(), "up")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Token is obtained through client credentials", func(t *testing.T) {
+		token := tests[0].token
+		var calls atomic.Int32
+		tokenEndpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+
+			clientID, clientSecret, ok := r.BasicAuth()
+			assert.True(t, ok)
+			assert.Equal(t, "canary", clientID)
+			assert.Equal(t, "canary-secret", clientSecret)
+			assert.Nil(t, r.ParseForm())
+			assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+
+			_ = json.NewEncoder(w).Encode(tokenExchangeResponse{AccessToken: token, TokenType: "Bearer", ExpiresIn: 300})
+		}))
+		defer tokenEndpoint.Close()
+
+		app.CanaryToken = ""
+		app.CanaryClientID = "canary"
+		app.CanaryClientSecret = "canary-secret"
+		assert.Nil(t, app.configureCanary(tokenEndpoint.URL))
+
+		counter := metrics.GetOrCreateCounter(`canary_requests_total{query="up",status="success"}`)
+		before := counter.Get()
+
+		app.runCanaryQuery(context.Background(), app.routes(), "up")
+		app.runCanaryQuery(context.Background(), app.routes(), "up")
+
+		assert.Equal(t, before+2, counter.Get())
+		assert.Equal(t, int32(1), calls.Load(), "tokens must be cached")
+	})
+}
+
+func TestApp_configureCanary(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	token := func(expiresAt time.Time) string {
+		return oidcGenerateToken(t, jwt.StandardClaims{ExpiresAt: expiresAt.Unix()})
+	}
+
+	tests := []struct {
+		name     string
+		app      *application
+		tokenURL string
+		wantErr  string
+	}{
+		{
+			name: "Canary queries are disabled",
+			app:  &application{CanaryToken: token(time.Now().Add(-time.Hour))},
+		},
+		{
+			name: "Valid token",
+			app:  &application{CanaryInterval: time.Minute, CanaryToken: token(time.Now().Add(time.Hour))},
+		},
+		{
+			name: "Opaque token",
+			app:  &application{CanaryInterval: time.Minute, CanaryToken: "opaque-token"},
+		},
+		{
+			name:    "Expired token",
+			app:     &application{CanaryInterval: time.Minute, CanaryToken: token(time.Now().Add(-time.Hour))},
+			wantErr: "CANARY_TOKEN expired at",
+		},
+		{
+			name:     "Client credentials",
+			app:      &application{CanaryInterval: time.Minute, CanaryClientID: "canary"},
+			tokenURL: "https://idp.localhost/token",
+		},
+		{
+			name:    "Client credentials without a token endpoint",
+			app:     &application{CanaryInterval: time.Minute, CanaryClientID: "canary"},
+			wantErr: "token endpoint is unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.app.logger = &logger
+
+			err := tt.app.configureCanary(tt.tokenURL)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.app.CanaryClientID != "", tt.app.canaryCredentials != nil)
+		})
+	}
+}
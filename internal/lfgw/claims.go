@@ -0,0 +1,195 @@
+package lfgw
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// defaultRolesClaim is the claim roles are taken from unless other claims are set through ROLES_CLAIM
+const defaultRolesClaim = "roles"
+
+// Claims contains claims of a verified token used for ACL resolution. Enrichers may change Email and Roles, other fields are informational.
+type Claims struct {
+	Subject string
+	Email   string
+	Roles   []string
+	// Raw contains all claims of the token
+	Raw map[string]any
+}
+
+// ClaimsEnricher enriches or normalizes claims of verified tokens before ACLs are resolved (e.g. maps legacy group names to roles, adds roles from a local file), so quirks of an IdP don't require patching the middleware. Enrichers are compiled in through RegisterClaimsEnricher and enabled by name through CLAIMS_ENRICHERS.
+type ClaimsEnricher interface {
+	Enrich(ctx context.Context, claims *Claims) error
+}
+
+// ClaimsEnricherFunc is an adapter to use ordinary functions as claims enrichers.
+type ClaimsEnricherFunc func(ctx context.Context, claims *Claims) error
+
+// Enrich calls f(ctx, claims).
+func (f ClaimsEnricherFunc) Enrich(ctx context.Context, claims *Claims) error {
+	return f(ctx, claims)
+}
+
+// Claims enrichers are kept at the package level as they're registered from init functions
+var (
+	claimsEnrichersMu sync.RWMutex
+	claimsEnrichers   = make(map[string]ClaimsEnricher)
+)
+
+// RegisterClaimsEnricher makes a claims enricher available under the name. It's meant to be called from init functions and panics if the name is empty, already registered, or the enricher is nil.
+func RegisterClaimsEnricher(name string, enricher ClaimsEnricher) {
+	claimsEnrichersMu.Lock()
+	defer claimsEnrichersMu.Unlock()
+
+	if name == "" || enricher == nil {
+		panic("lfgw: claims enricher must have a name and cannot be nil")
+	}
+
+	if _, exists := claimsEnrichers[name]; exists {
+		panic(fmt.Sprintf("lfgw: claims enricher %s is registered twice", name))
+	}
+
+	claimsEnrichers[name] = enricher
+}
+
+// registeredClaimsEnrichers returns sorted names of registered claims enrichers.
+func registeredClaimsEnrichers() []string {
+	claimsEnrichersMu.RLock()
+	defer claimsEnrichersMu.RUnlock()
+
+	names := make([]string, 0, len(claimsEnrichers))
+	for name := range claimsEnrichers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// configureClaimsEnrichers looks up claims enrichers listed in app.ClaimsEnrichers, so misconfigurations are caught on start.
+func (app *application) configureClaimsEnrichers() error {
+	app.claimsEnrichers = nil
+	for _, name := range app.ClaimsEnrichers {
+		claimsEnrichersMu.RLock()
+		enricher, ok := claimsEnrichers[name]
+		claimsEnrichersMu.RUnlock()
+
+		if !ok {
+			return fmt.Errorf("unknown claims enricher: %s (registered: %s)", name, strings.Join(registeredClaimsEnrichers(), ", "))
+		}
+		app.claimsEnrichers = append(app.claimsEnrichers, enricher)
+	}
+
+	return nil
+}
+
+// enrichClaims runs the claims adapter (if any) and enabled claims enrichers in the configured order.
+func (app *application) enrichClaims(ctx context.Context, claims *Claims) error {
+	if app.claimsAdapter != nil {
+		if err := app.claimsAdapter.Enrich(ctx, claims); err != nil {
+			return fmt.Errorf("claims adapter %s failed: %w", app.ClaimsAdapter, err)
+		}
+	}
+
+	for i, enricher := range app.claimsEnrichers {
+		if err := enricher.Enrich(ctx, claims); err != nil {
+			return fmt.Errorf("claims enricher %s failed: %w", app.ClaimsEnrichers[i], err)
+		}
+	}
+
+	return nil
+}
+
+// tokenRoles returns roles of a token along with keys of user ACLs matching its email and of a client ACL matching its client, so they're merged like roles. Roles named like user / client ACL keys are dropped, and emails explicitly marked as unverified are not considered.
+func (app *application) tokenRoles(claims userClaims) []string {
+	acls := app.getACLs()
+
+	roles := querymodifier.WithoutReservedRoles(claims.Roles)
+	roles = append(roles, acls.ClientRoles(tokenClientID(claims))...)
+
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		return roles
+	}
+
+	return append(roles, acls.UserRoles(claims.Email)...)
+}
+
+// tokenClientID returns the client a service account token was issued to: client_id (set by Keycloak for client credentials grants) or azp for tokens without an email. User tokens have azp of the client the user logged in through (e.g. Grafana), so they never get ACLs of that client.
+func tokenClientID(claims userClaims) string {
+	if claims.ClientID != "" {
+		return claims.ClientID
+	}
+
+	if claims.Email == "" {
+		return claims.AZP
+	}
+
+	return ""
+}
+
+// hasCustomRolesClaims returns true if roles are taken from claims other than only the top-level roles claim.
+func (app *application) hasCustomRolesClaims() bool {
+	return len(app.RolesClaims) > 1 || (len(app.RolesClaims) == 1 && app.RolesClaims[0] != defaultRolesClaim)
+}
+
+// claimsRoles returns a union of roles found in raw claims under the dotted paths, in the order of their appearance.
+func claimsRoles(raw map[string]any, paths []string) ([]string, error) {
+	roles := []string{}
+	seen := make(map[string]bool)
+
+	for _, path := range paths {
+		found, err := claimRoles(raw, path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, role := range found {
+			if !seen[role] {
+				seen[role] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	return roles, nil
+}
+
+// claimRoles returns roles found in raw claims under the dotted path (e.g. realm_access.roles, resource_access.grafana.roles). Roles might be a list of strings or a single string, a missing claim means no roles.
+func claimRoles(raw map[string]any, path string) ([]string, error) {
+	var value any = raw
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, nil
+		}
+
+		value, ok = object[key]
+		if !ok {
+			return nil, nil
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []any:
+		roles := make([]string, 0, len(v))
+		for _, item := range v {
+			role, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s claim must contain a list of strings", path)
+			}
+			roles = append(roles, role)
+		}
+		return roles, nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%s claim must contain a list of strings", path)
+	}
+}
@@ -0,0 +1,425 @@
+package lfgw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	claimsAdapterAzureAD = "azure-ad"
+	claimsAdapterGoogle  = "google"
+
+	azureADLoginURL = "https://login.microsoftonline.com"
+	azureADGraphURL = "https://graph.microsoft.com"
+	// azureADGraphCacheTTL is how long group names and group memberships fetched from Microsoft Graph are reused
+	azureADGraphCacheTTL = 10 * time.Minute
+	// azureADGraphCacheSize is the maximum amount of entries kept in each of the Graph caches
+	azureADGraphCacheSize = 10000
+	// azureADGetByIDsLimit is the maximum amount of IDs accepted by directoryObjects/getByIds
+	azureADGetByIDsLimit = 1000
+)
+
+// configureClaimsAdapter sets up the built-in claims adapter selected through app.ClaimsAdapter. Adapters run before claims enrichers, so enrichers see normalized claims.
+func (app *application) configureClaimsAdapter() error {
+	// Just to make sure our logging calls are always safe
+	if app.logger == nil {
+		app.configureLogging()
+	}
+
+	switch app.ClaimsAdapter {
+	case "":
+		app.claimsAdapter = nil
+		return nil
+	case claimsAdapterAzureAD:
+		adapter := &azureADClaimsAdapter{}
+		if app.AzureADGraphLookup {
+			adapter.graph = newAzureADGraphClient(app.AzureADTenantID, app.AzureADClientID, app.AzureADClientSecret)
+		}
+		app.claimsAdapter = adapter
+	case claimsAdapterGoogle:
+		adapter := &googleClaimsAdapter{}
+		for _, domain := range app.GoogleHostedDomains {
+			adapter.hostedDomains = append(adapter.hostedDomains, strings.ToLower(domain))
+		}
+		app.claimsAdapter = adapter
+	default:
+		return fmt.Errorf("unknown claims adapter: %s (supported: %s, %s)", app.ClaimsAdapter, claimsAdapterAzureAD, claimsAdapterGoogle)
+	}
+
+	app.logger.Info().Caller().
+		Msgf("Claims adapter is on (adapter: %s)", app.ClaimsAdapter)
+
+	return nil
+}
+
+// azureADClaimsAdapter adds groups of Azure AD tokens (object IDs) to roles. With Graph lookup, group IDs are resolved to display names and group overage claims (issued instead of groups for users in more than 200 groups) are resolved through Graph. Tokens without an email get upn as the email.
+type azureADClaimsAdapter struct {
+	graph *azureADGraphClient
+}
+
+// Enrich implements ClaimsEnricher.
+func (a *azureADClaimsAdapter) Enrich(ctx context.Context, claims *Claims) error {
+	if claims.Email == "" {
+		if upn, ok := claims.Raw["upn"].(string); ok {
+			claims.Email = upn
+		}
+	}
+
+	groups, err := claimRoles(claims.Raw, "groups")
+	if err != nil {
+		return err
+	}
+
+	if a.graph == nil {
+		claims.Roles = appendMissing(claims.Roles, groups...)
+		return nil
+	}
+
+	if azureADHasGroupsOverage(claims.Raw) {
+		oid, _ := claims.Raw["oid"].(string)
+		if oid == "" {
+			return fmt.Errorf("token has a groups overage claim, but no oid")
+		}
+
+		groups, err = a.graph.memberGroups(ctx, oid)
+		if err != nil {
+			return err
+		}
+	}
+
+	names, err := a.graph.groupNames(ctx, groups)
+	if err != nil {
+		return err
+	}
+
+	// Groups that cannot be resolved (e.g. deleted or not visible to the app) are kept as IDs, so ACLs might refer to them either way
+	for _, group := range groups {
+		if name, ok := names[group]; ok {
+			group = name
+		}
+		claims.Roles = appendMissing(claims.Roles, group)
+	}
+
+	return nil
+}
+
+// azureADHasGroupsOverage returns true if groups are not included into the token, but have to be fetched from Graph (_claim_names contains groups).
+func azureADHasGroupsOverage(raw map[string]any) bool {
+	claimNames, ok := raw["_claim_names"].(map[string]any)
+	if !ok {
+		return false
+	}
+
+	_, ok = claimNames["groups"]
+	return ok
+}
+
+// googleClaimsAdapter checks the hosted domain (hd) of Google tokens and adds group emails from the groups claim to roles. If hosted domains are set, tokens of other domains (including consumer accounts without hd) are rejected, and only groups within the hosted domains are considered.
+type googleClaimsAdapter struct {
+	hostedDomains []string
+}
+
+// Enrich implements ClaimsEnricher.
+func (a *googleClaimsAdapter) Enrich(ctx context.Context, claims *Claims) error {
+	if len(a.hostedDomains) > 0 {
+		hd, _ := claims.Raw["hd"].(string)
+		if !a.isHostedDomain(hd) {
+			return fmt.Errorf("%w: hosted domain %q is not allowed", errClaimsRejected, hd)
+		}
+	}
+
+	groups, err := claimRoles(claims.Raw, "groups")
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		// Emails are case-insensitive, so group emails are normalized to match ACLs consistently
+		group = strings.ToLower(group)
+		if len(a.hostedDomains) > 0 {
+			_, domain, _ := strings.Cut(group, "@")
+			if !a.isHostedDomain(domain) {
+				continue
+			}
+		}
+		claims.Roles = appendMissing(claims.Roles, group)
+	}
+
+	return nil
+}
+
+// isHostedDomain returns true if the domain is one of the allowed hosted domains.
+func (a *googleClaimsAdapter) isHostedDomain(domain string) bool {
+	domain = strings.ToLower(domain)
+	for _, hd := range a.hostedDomains {
+		if domain == hd {
+			return true
+		}
+	}
+
+	return false
+}
+
+// appendMissing appends values that are not present in the slice yet.
+func appendMissing(slice []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range slice {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			slice = append(slice, value)
+		}
+	}
+
+	return slice
+}
+
+// azureADGraphClient queries Microsoft Graph with an app-only token obtained through client credentials. Results are cached for azureADGraphCacheTTL.
+type azureADGraphClient struct {
+	tokenURL     string
+	graphURL     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	mu      sync.Mutex
+	token   exchangedToken
+	names   map[string]azureADCacheEntry
+	members map[string]azureADCacheEntry
+}
+
+// azureADCacheEntry holds cached values along with their expiration time.
+type azureADCacheEntry struct {
+	values    []string
+	expiresAt time.Time
+}
+
+// newAzureADGraphClient returns an azureADGraphClient for the tenant with empty caches.
+func newAzureADGraphClient(tenantID, clientID, clientSecret string) *azureADGraphClient {
+	return &azureADGraphClient{
+		tokenURL:     fmt.Sprintf("%s/%s/oauth2/v2.0/token", azureADLoginURL, url.PathEscape(tenantID)),
+		graphURL:     azureADGraphURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		names:        make(map[string]azureADCacheEntry),
+		members:      make(map[string]azureADCacheEntry),
+	}
+}
+
+// groupNames returns display names of the groups by their IDs. Groups unknown to Graph are missing from the result.
+func (g *azureADGraphClient) groupNames(ctx context.Context, ids []string) (map[string]string, error) {
+	names := make(map[string]string, len(ids))
+	missing := []string{}
+
+	g.mu.Lock()
+	now := time.Now()
+	for _, id := range ids {
+		entry, ok := g.names[id]
+		switch {
+		case !ok || now.After(entry.expiresAt):
+			missing = append(missing, id)
+		case len(entry.values) > 0:
+			names[id] = entry.values[0]
+		}
+	}
+	g.mu.Unlock()
+
+	for len(missing) > 0 {
+		batch := missing
+		if len(batch) > azureADGetByIDsLimit {
+			batch = batch[:azureADGetByIDsLimit]
+		}
+		missing = missing[len(batch):]
+
+		var result struct {
+			Value []struct {
+				ID          string `json:"id"`
+				DisplayName string `json:"displayName"`
+			} `json:"value"`
+		}
+		request := map[string]any{"ids": batch, "types": []string{"group"}}
+		if err := g.post(ctx, "/v1.0/directoryObjects/getByIds", request, &result); err != nil {
+			return nil, err
+		}
+
+		found := make(map[string]string, len(result.Value))
+		for _, object := range result.Value {
+			if object.DisplayName != "" {
+				found[object.ID] = object.DisplayName
+				names[object.ID] = object.DisplayName
+			}
+		}
+
+		// Unknown groups are cached as well, so they're not looked up on every request
+		for _, id := range batch {
+			entry := azureADCacheEntry{expiresAt: time.Now().Add(azureADGraphCacheTTL)}
+			if name, ok := found[id]; ok {
+				entry.values = []string{name}
+			}
+			g.store(g.names, id, entry)
+		}
+	}
+
+	return names, nil
+}
+
+// memberGroups returns IDs of all groups the user is a member of, including transitive memberships.
+func (g *azureADGraphClient) memberGroups(ctx context.Context, oid string) ([]string, error) {
+	g.mu.Lock()
+	entry, ok := g.members[oid]
+	g.mu.Unlock()
+
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.values, nil
+	}
+
+	var result struct {
+		Value []string `json:"value"`
+	}
+	request := map[string]any{"securityEnabledOnly": false}
+	if err := g.post(ctx, fmt.Sprintf("/v1.0/users/%s/getMemberGroups", url.PathEscape(oid)), request, &result); err != nil {
+		return nil, err
+	}
+
+	g.store(g.members, oid, azureADCacheEntry{
+		values:    result.Value,
+		expiresAt: time.Now().Add(azureADGraphCacheTTL),
+	})
+
+	return result.Value, nil
+}
+
+// store puts an entry into the cache. Expired entries are dropped once the cache is full; if that's not enough, the cache is reset.
+func (g *azureADGraphClient) store(cache map[string]azureADCacheEntry, key string, entry azureADCacheEntry) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(cache) >= azureADGraphCacheSize {
+		now := time.Now()
+		for k, v := range cache {
+			if now.After(v.expiresAt) {
+				delete(cache, k)
+			}
+		}
+
+		if len(cache) >= azureADGraphCacheSize {
+			for k := range cache {
+				delete(cache, k)
+			}
+		}
+	}
+
+	cache[key] = entry
+}
+
+// post sends a JSON request to Graph and decodes the response into result.
+func (g *azureADGraphClient) post(ctx context.Context, path string, request any, result any) error {
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.graphURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("graph request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return fmt.Errorf("graph request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("graph request failed: %s: %s", resp.Status, respBody)
+	}
+
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("graph request failed: %w", err)
+	}
+
+	return nil
+}
+
+// accessToken returns a cached app-only token for Graph or requests a new one through client credentials.
+func (g *azureADGraphClient) accessToken(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	token := g.token
+	g.mu.Unlock()
+
+	if token.accessToken != "" && time.Now().Add(tokenExchangeExpiryMargin).Before(token.expiresAt) {
+		return token.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", g.clientID)
+	form.Set("client_secret", g.clientSecret)
+	form.Set("scope", azureADGraphURL+"/.default")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get a graph token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to get a graph token: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get a graph token: %s: %s", resp.Status, body)
+	}
+
+	var tr tokenExchangeResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return "", fmt.Errorf("failed to get a graph token: %w", err)
+	}
+
+	if tr.AccessToken == "" {
+		return "", fmt.Errorf("failed to get a graph token: no access_token in response")
+	}
+
+	g.mu.Lock()
+	g.token = exchangedToken{
+		accessToken: tr.AccessToken,
+		expiresAt:   time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second),
+	}
+	g.mu.Unlock()
+
+	return tr.AccessToken, nil
+}
@@ -0,0 +1,149 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_configureClaimsAdapter(t *testing.T) {
+	t.Run("Unknown adapter", func(t *testing.T) {
+		app := application{ClaimsAdapter: "okta"}
+		assert.ErrorContains(t, app.configureClaimsAdapter(), "unknown claims adapter: okta")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		app := application{}
+		assert.Nil(t, app.configureClaimsAdapter())
+		assert.Nil(t, app.claimsAdapter)
+	})
+
+	t.Run("Adapter runs before enrichers", func(t *testing.T) {
+		app := application{ClaimsAdapter: claimsAdapterGoogle, GoogleHostedDomains: []string{"Example.com"}}
+		assert.Nil(t, app.configureClaimsAdapter())
+		assert.Nil(t, app.configureClaimsEnrichers())
+
+		claims := Claims{Raw: map[string]any{"hd": "example.com", "groups": []any{"Team-A@example.com"}}}
+		assert.Nil(t, app.enrichClaims(context.Background(), &claims))
+		assert.Equal(t, []string{"team-a@example.com"}, claims.Roles)
+
+		claims = Claims{Raw: map[string]any{"hd": "example.org"}}
+		assert.ErrorIs(t, app.enrichClaims(context.Background(), &claims), errClaimsRejected)
+	})
+}
+
+func TestGoogleClaimsAdapter_Enrich(t *testing.T) {
+	tests := []struct {
+		name          string
+		hostedDomains []string
+		raw           map[string]any
+		want          []string
+		wantRejected  bool
+	}{
+		{
+			name:          "Hosted domain",
+			hostedDomains: []string{"example.com"},
+			raw:           map[string]any{"hd": "example.com", "groups": []any{"team-a@example.com", "team-b@partner.com"}},
+			want:          []string{"admin", "team-a@example.com"},
+		},
+		{
+			name:          "Foreign domain",
+			hostedDomains: []string{"example.com"},
+			raw:           map[string]any{"hd": "example.org"},
+			wantRejected:  true,
+		},
+		{
+			name:          "Consumer account",
+			hostedDomains: []string{"example.com"},
+			raw:           map[string]any{},
+			wantRejected:  true,
+		},
+		{
+			name: "No hosted domains",
+			raw:  map[string]any{"groups": []any{"team-b@partner.com", "admin"}},
+			want: []string{"admin", "team-b@partner.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &googleClaimsAdapter{hostedDomains: tt.hostedDomains}
+			claims := Claims{Roles: []string{"admin"}, Raw: tt.raw}
+
+			err := adapter.Enrich(context.Background(), &claims)
+			if tt.wantRejected {
+				assert.ErrorIs(t, err, errClaimsRejected)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, claims.Roles)
+		})
+	}
+}
+
+func TestAzureADClaimsAdapter_Enrich(t *testing.T) {
+	t.Run("Without Graph lookup", func(t *testing.T) {
+		adapter := &azureADClaimsAdapter{}
+		claims := Claims{
+			Roles: []string{"admin"},
+			Raw:   map[string]any{"upn": "user@example.com", "groups": []any{"8f1c2a0e-0000-0000-0000-000000000001"}},
+		}
+
+		assert.Nil(t, adapter.Enrich(context.Background(), &claims))
+		assert.Equal(t, "user@example.com", claims.Email)
+		assert.Equal(t, []string{"admin", "8f1c2a0e-0000-0000-0000-000000000001"}, claims.Roles)
+	})
+
+	t.Run("With Graph lookup", func(t *testing.T) {
+		calls := map[string]int{}
+		graph := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls[r.URL.Path]++
+
+			switch r.URL.Path {
+			case "/token":
+				assert.Nil(t, r.ParseForm())
+				assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+				io.WriteString(w, `{"access_token": "graph-token", "expires_in": 3600}`)
+			case "/v1.0/users/oid-1/getMemberGroups":
+				assert.Equal(t, "Bearer graph-token", r.Header.Get("Authorization"))
+				io.WriteString(w, `{"value": ["id-1", "id-2"]}`)
+			case "/v1.0/directoryObjects/getByIds":
+				var request struct {
+					IDs []string `json:"ids"`
+				}
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+				assert.ElementsMatch(t, []string{"id-1", "id-2"}, request.IDs)
+				io.WriteString(w, `{"value": [{"id": "id-1", "displayName": "team-a"}]}`)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer graph.Close()
+
+		g := newAzureADGraphClient("tenant", "client", "secret")
+		g.tokenURL = graph.URL + "/token"
+		g.graphURL = graph.URL
+		adapter := &azureADClaimsAdapter{graph: g}
+
+		for i := 0; i < 2; i++ {
+			claims := Claims{
+				Email: "user@example.com",
+				Raw: map[string]any{
+					"oid":          "oid-1",
+					"_claim_names": map[string]any{"groups": "src1"},
+				},
+			}
+
+			assert.Nil(t, adapter.Enrich(context.Background(), &claims))
+			assert.Equal(t, []string{"team-a", "id-2"}, claims.Roles, "unresolved groups must be kept as IDs")
+		}
+
+		assert.Equal(t, map[string]int{"/token": 1, "/v1.0/users/oid-1/getMemberGroups": 1, "/v1.0/directoryObjects/getByIds": 1}, calls, "Graph responses must be cached")
+	})
+}
@@ -0,0 +1,130 @@
+package lfgw
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_enrichClaims(t *testing.T) {
+	RegisterClaimsEnricher("test-add-role", ClaimsEnricherFunc(func(ctx context.Context, claims *Claims) error {
+		claims.Roles = append(claims.Roles, "added")
+		return nil
+	}))
+	RegisterClaimsEnricher("test-email-from-raw", ClaimsEnricherFunc(func(ctx context.Context, claims *Claims) error {
+		claims.Email, _ = claims.Raw["preferred_username"].(string)
+		return nil
+	}))
+	RegisterClaimsEnricher("test-failing", ClaimsEnricherFunc(func(ctx context.Context, claims *Claims) error {
+		return errors.New("cache file is not available")
+	}))
+
+	t.Run("Registered twice", func(t *testing.T) {
+		assert.Panics(t, func() {
+			RegisterClaimsEnricher("test-add-role", ClaimsEnricherFunc(nil))
+		})
+	})
+
+	t.Run("Unknown enricher", func(t *testing.T) {
+		app := application{ClaimsEnrichers: []string{"test-add-role", "unknown"}}
+		assert.ErrorContains(t, app.configureClaimsEnrichers(), "unknown claims enricher: unknown")
+	})
+
+	t.Run("Enrichers run in order", func(t *testing.T) {
+		app := application{ClaimsEnrichers: []string{"test-add-role", "test-email-from-raw"}}
+		assert.Nil(t, app.configureClaimsEnrichers())
+
+		claims := Claims{
+			Roles: []string{"team-a"},
+			Raw:   map[string]any{"preferred_username": "user@localhost"},
+		}
+		assert.Nil(t, app.enrichClaims(context.Background(), &claims))
+		assert.Equal(t, []string{"team-a", "added"}, claims.Roles)
+		assert.Equal(t, "user@localhost", claims.Email)
+	})
+
+	t.Run("Failing enricher", func(t *testing.T) {
+		app := application{ClaimsEnrichers: []string{"test-failing"}}
+		assert.Nil(t, app.configureClaimsEnrichers())
+		assert.ErrorContains(t, app.enrichClaims(context.Background(), &Claims{}), "claims enricher test-failing failed")
+	})
+}
+
+func Test_claimRoles(t *testing.T) {
+	raw := map[string]any{
+		"roles":        []any{"top-level"},
+		"realm_access": map[string]any{"roles": []any{"team-a", "team-b"}},
+		"resource_access": map[string]any{
+			"grafana": map[string]any{"roles": []any{"editor"}},
+		},
+		"groups":  "admins",
+		"invalid": []any{"team-a", 1},
+	}
+
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "roles", want: []string{"top-level"}},
+		{path: "realm_access.roles", want: []string{"team-a", "team-b"}},
+		{path: "resource_access.grafana.roles", want: []string{"editor"}},
+		{path: "resource_access.lfgw.roles", want: nil},
+		{path: "groups", want: []string{"admins"}},
+		{path: "groups.roles", want: nil},
+		{path: "realm_access", wantErr: true},
+		{path: "invalid", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := claimRoles(raw, tt.path)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_claimsRoles(t *testing.T) {
+	raw := map[string]any{
+		"roles":        []any{"team-a"},
+		"groups":       []any{"admins", "team-a"},
+		"realm_access": map[string]any{"roles": []any{"offline_access"}},
+		"invalid":      1,
+	}
+
+	got, err := claimsRoles(raw, []string{"roles", "groups", "realm_access.roles", "missing"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"team-a", "admins", "offline_access"}, got)
+
+	_, err = claimsRoles(raw, []string{"roles", "invalid"})
+	assert.NotNil(t, err)
+}
+
+func TestApp_tokenRoles(t *testing.T) {
+	acls, _, err := querymodifier.NewACLsFromBytes([]byte("version: 2\nroles:\n  team-a: a\nusers:\n  \"*@example.com\": b\nclients:\n  vmalert: c\n  grafana: d\n"), querymodifier.DefaultLabel)
+	assert.Nil(t, err)
+
+	app := application{ACLs: acls, acls: &aclsState{}}
+	verified, unverified := true, false
+
+	assert.Equal(t, []string{"team-a", "user:*@example.com"}, app.tokenRoles(userClaims{Roles: []string{"team-a"}, Email: "alice@example.com"}))
+	assert.Equal(t, []string{"team-a", "user:*@example.com"}, app.tokenRoles(userClaims{Roles: []string{"team-a"}, Email: "alice@example.com", EmailVerified: &verified}))
+	assert.Equal(t, []string{"team-a"}, app.tokenRoles(userClaims{Roles: []string{"team-a"}, Email: "alice@example.com", EmailVerified: &unverified}))
+	assert.Equal(t, []string{}, app.tokenRoles(userClaims{Roles: []string{"user:*@example.com", "client:vmalert"}}))
+
+	// Service accounts
+	assert.Equal(t, []string{"client:vmalert"}, app.tokenRoles(userClaims{ClientID: "vmalert", AZP: "vmalert"}))
+	assert.Equal(t, []string{"client:vmalert"}, app.tokenRoles(userClaims{AZP: "vmalert"}))
+	// Users logged in through a client don't get its ACL
+	assert.Equal(t, []string{"team-a", "user:*@example.com"}, app.tokenRoles(userClaims{Roles: []string{"team-a"}, Email: "alice@example.com", AZP: "grafana"}))
+}
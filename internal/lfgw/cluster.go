@@ -0,0 +1,242 @@
+package lfgw
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/kubernetes"
+)
+
+const (
+	// clusterPropagatedHeader marks admin requests propagated from a peer, so they're not propagated any further
+	clusterPropagatedHeader = "X-LFGW-Cluster-Propagated"
+	// clusterFailedPeersHeader lists peers a change couldn't be propagated to
+	clusterFailedPeersHeader = "X-LFGW-Cluster-Failed-Peers"
+	// clusterPeerTimeout limits the time a peer has to apply a propagated change, admin requests wait for peers at most that long
+	clusterPeerTimeout = 2 * time.Second
+	// clusterPeerDialTimeout limits the time it takes to connect to a peer (including the TLS handshake)
+	clusterPeerDialTimeout = time.Second
+)
+
+var (
+	clusterPropagationsSucceeded = metrics.NewCounter(`cluster_propagations_total{status="success"}`)
+	clusterPropagationsFailed    = metrics.NewCounter(`cluster_propagations_total{status="failure"}`)
+)
+
+// configureCluster sets up the client peers are called with and, if peers are discovered through the endpoints of app.ClusterService, a Kubernetes client (in-cluster or through kubeconfig).
+func (app *application) configureCluster() error {
+	if len(app.ClusterPeers) == 0 && app.ClusterService == "" {
+		return nil
+	}
+
+	app.clusterClient = newClusterClient()
+
+	switch {
+	case len(app.ClusterPeers) > 0:
+		app.logger.Info().Caller().
+			Msgf("Clustering is on (peers: %s)", strings.Join(app.ClusterPeers, ", "))
+	case app.ClusterService != "":
+		if app.kubernetesClient == nil {
+			client, err := kubernetes.NewClient()
+			if err != nil {
+				return err
+			}
+
+			app.kubernetesClient = client
+		}
+
+		app.logger.Info().Caller().
+			Msgf("Clustering is on (peers are discovered through the endpoints of %s, scheme: %s)", app.ClusterService, app.clusterPeerScheme())
+	}
+
+	if app.hasInsecureClusterPeers() {
+		app.logger.Warn().Caller().
+			Msg("Some cluster peers are called over plain HTTP, so the admin token is sent to them in cleartext. Consider using https (e.g. through a TLS-terminating sidecar)")
+	}
+
+	return nil
+}
+
+// newClusterClient returns a client for propagating changes to peers. Redirects are not followed, so the admin token is never sent anywhere else.
+func newClusterClient() *http.Client {
+	return &http.Client{
+		Timeout: clusterPeerTimeout,
+		Transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: clusterPeerDialTimeout}).DialContext,
+			TLSHandshakeTimeout: clusterPeerDialTimeout,
+			MaxIdleConnsPerHost: 1,
+			IdleConnTimeout:     time.Minute,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// clusterPeerScheme returns the scheme peers discovered through app.ClusterService are called with, http by default.
+func (app *application) clusterPeerScheme() string {
+	if app.ClusterPeerScheme == "" {
+		return "http"
+	}
+
+	return app.ClusterPeerScheme
+}
+
+// hasInsecureClusterPeers returns true if any of the peers is called over plain HTTP.
+func (app *application) hasInsecureClusterPeers() bool {
+	if app.ClusterService != "" {
+		return app.clusterPeerScheme() == "http"
+	}
+
+	for _, peer := range app.ClusterPeers {
+		if strings.HasPrefix(strings.ToLower(peer), "http://") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clusterPeers returns base URLs of peers: either app.ClusterPeers or ready endpoints of app.ClusterService called with app.ClusterPeerScheme (the instance itself is excluded).
+func (app *application) clusterPeers(ctx context.Context) ([]string, error) {
+	if len(app.ClusterPeers) > 0 {
+		return app.ClusterPeers, nil
+	}
+
+	namespace, name, _ := strings.Cut(app.ClusterService, "/")
+	addresses, err := app.kubernetesClient.GetEndpointAddresses(ctx, namespace, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover peers: %w", err)
+	}
+
+	local := localAddresses()
+
+	peers := []string{}
+	for _, address := range addresses {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil || local[host] {
+			continue
+		}
+
+		peers = append(peers, app.clusterPeerScheme()+"://"+address+app.RoutePrefix)
+	}
+
+	return peers, nil
+}
+
+// localAddresses returns IP addresses of network interfaces of the instance.
+func localAddresses() map[string]bool {
+	local := make(map[string]bool)
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return local
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			local[ipNet.IP.String()] = true
+		}
+	}
+
+	return local
+}
+
+// propagateToPeers replays an admin request that has just been applied locally on all peers, so operators don't have to repeat runtime changes per instance. The request is sent with the same method, path, body and admin token. Requests propagated from a peer are not propagated again. Failures don't revert the local change, they're logged and listed in the X-LFGW-Cluster-Failed-Peers response header, thus it has to be called before the status is written.
+func (app *application) propagateToPeers(w http.ResponseWriter, r *http.Request, body []byte) {
+	if (len(app.ClusterPeers) == 0 && app.ClusterService == "") || r.Header.Get(clusterPropagatedHeader) != "" {
+		return
+	}
+
+	logger := hlog.FromRequest(r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterPeerTimeout)
+	defer cancel()
+
+	peers, err := app.clusterPeers(ctx)
+	if err != nil {
+		clusterPropagationsFailed.Inc()
+		logger.Error().Caller().
+			Err(err).Msgf("Failed to propagate %s %s to peers", r.Method, r.URL.Path)
+		w.Header().Set(clusterFailedPeersHeader, "*")
+		return
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+
+	for _, peer := range peers {
+		peer := peer
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := app.sendToPeer(ctx, r, peer, body); err != nil {
+				clusterPropagationsFailed.Inc()
+				logger.Error().Caller().
+					Err(err).Msgf("Failed to propagate %s %s to %s", r.Method, r.URL.Path, peer)
+
+				mu.Lock()
+				failed = append(failed, peer)
+				mu.Unlock()
+				return
+			}
+
+			clusterPropagationsSucceeded.Inc()
+		}()
+	}
+
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		w.Header().Set(clusterFailedPeersHeader, strings.Join(failed, ", "))
+	}
+
+	logger.Info().Caller().
+		Msgf("Propagated %s %s to %d of %d peer(s)", r.Method, r.URL.Path, len(peers)-len(failed), len(peers))
+}
+
+// sendToPeer sends a copy of the admin request to the peer.
+func (app *application) sendToPeer(ctx context.Context, r *http.Request, peer string, body []byte) error {
+	u := strings.TrimRight(peer, "/") + r.URL.Path
+	if r.URL.RawQuery != "" {
+		u += "?" + r.URL.RawQuery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", r.Header.Get("Authorization"))
+	req.Header.Set(clusterPropagatedHeader, "true")
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := app.clusterClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package lfgw
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/kubernetes"
+)
+
+func TestApp_propagateToPeers(t *testing.T) {
+	type propagatedRequest struct {
+		method     string
+		path       string
+		body       string
+		auth       string
+		propagated string
+	}
+
+	var (
+		mu       sync.Mutex
+		received []propagatedRequest
+	)
+
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		received = append(received, propagatedRequest{
+			method:     r.Method,
+			path:       r.URL.Path,
+			body:       string(body),
+			auth:       r.Header.Get("Authorization"),
+			propagated: r.Header.Get(clusterPropagatedHeader),
+		})
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer peer.Close()
+
+	brokenPeer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer brokenPeer.Close()
+
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:         &logger,
+		AdminToken:     "secret",
+		FaultInjection: true,
+		RoutePrefix:    "/metrics-gw",
+		ClusterPeers:   []string{peer.URL + "/metrics-gw", brokenPeer.URL},
+	}
+	app.configureFaultInjection()
+	assert.Nil(t, app.configureCluster())
+
+	rules := `[{"roles":["team-a"],"error_rate":1}]`
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		propagated     bool
+		wantPropagated []propagatedRequest
+	}{
+		{
+			name:   "Change is propagated",
+			method: http.MethodPut,
+			body:   rules,
+			wantPropagated: []propagatedRequest{
+				{method: http.MethodPut, path: "/metrics-gw/admin/faults", body: rules, auth: "Bearer secret", propagated: "true"},
+			},
+		},
+		{
+			name:   "Removal is propagated",
+			method: http.MethodDelete,
+			wantPropagated: []propagatedRequest{
+				{method: http.MethodDelete, path: "/metrics-gw/admin/faults", auth: "Bearer secret", propagated: "true"},
+			},
+		},
+		{
+			name:       "Propagated change is applied locally only",
+			method:     http.MethodPut,
+			body:       rules,
+			propagated: true,
+		},
+		{
+			name:   "Reads are not propagated",
+			method: http.MethodGet,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			received = nil
+			mu.Unlock()
+
+			r := httptest.NewRequest(tt.method, "/admin/faults", strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "Bearer secret")
+			if tt.propagated {
+				r.Header.Set(clusterPropagatedHeader, "true")
+			}
+			rr := httptest.NewRecorder()
+
+			app.faultsHandler(rr, r)
+			assert.Less(t, rr.Code, 300)
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.wantPropagated, received)
+
+			if tt.wantPropagated != nil {
+				assert.Equal(t, brokenPeer.URL, rr.Header().Get(clusterFailedPeersHeader))
+			}
+		})
+	}
+}
+
+func TestApp_clusterPeers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/monitoring/endpoints/lfgw" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"subsets":[{"addresses":[{"ip":"192.0.2.10"},{"ip":"192.0.2.11"}],"ports":[{"port":8080}]}]}`))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		scheme string
+		want   []string
+	}{
+		{
+			name: "Plain HTTP by default",
+			want: []string{"http://192.0.2.10:8080/metrics-gw", "http://192.0.2.11:8080/metrics-gw"},
+		},
+		{
+			name:   "HTTPS",
+			scheme: "https",
+			want:   []string{"https://192.0.2.10:8080/metrics-gw", "https://192.0.2.11:8080/metrics-gw"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.New(nil)
+			app := &application{
+				logger:            &logger,
+				RoutePrefix:       "/metrics-gw",
+				ClusterService:    "monitoring/lfgw",
+				ClusterPeerScheme: tt.scheme,
+				kubernetesClient: &kubernetes.Client{
+					APIServerURL: ts.URL,
+					HTTPClient:   ts.Client(),
+				},
+			}
+
+			got, err := app.clusterPeers(context.Background())
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.scheme == "", app.hasInsecureClusterPeers())
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package lfgw
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	encodingGzip   = "gzip"
+	encodingZstd   = "zstd"
+	encodingBrotli = "br"
+
+	// minCompressedResponseSize is the size of responses (if known) below which compression isn't worth it
+	minCompressedResponseSize = 1 << 10
+	// maxZstdDecoderMemory limits memory zstd decoders might allocate for a single request or response
+	maxZstdDecoderMemory = 64 << 20
+
+	contextKeyResponseEncoding = contextKey("responseEncoding")
+)
+
+// preferredEncodings lists encodings lfgw can compress responses with in the order of preference for equally weighted encodings in Accept-Encoding.
+var preferredEncodings = []string{encodingZstd, encodingBrotli, encodingGzip}
+
+// newDecompressor returns a reader decompressing r according to the content encoding.
+func newDecompressor(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case encodingGzip, "x-gzip":
+		return gzip.NewReader(r)
+	case encodingZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxZstdDecoderMemory))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case encodingBrotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %q", encoding)
+	}
+}
+
+// newCompressor returns a writer compressing data written to w according to the content encoding.
+func newCompressor(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case encodingGzip:
+		return gzip.NewWriter(w), nil
+	case encodingZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	case encodingBrotli:
+		return brotli.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %q", encoding)
+	}
+}
+
+// negotiateEncoding returns the encoding of preferredEncodings the client accepts with the highest weight according to the Accept-Encoding header or an empty string if there's none.
+func negotiateEncoding(acceptEncoding string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		encoding, params, _ := strings.Cut(part, ";")
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding == "" {
+			continue
+		}
+
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+
+		if encoding == "*" {
+			wildcard = weight
+			continue
+		}
+		weights[encoding] = weight
+	}
+
+	best := ""
+	bestWeight := 0.0
+	for _, encoding := range preferredEncodings {
+		weight, ok := weights[encoding]
+		if !ok {
+			weight = wildcard
+		}
+
+		if weight > bestWeight {
+			best = encoding
+			bestWeight = weight
+		}
+	}
+
+	return best
+}
+
+// compressionMiddleware decompresses form bodies of requests sent with Content-Encoding (gzip, zstd, br), so they can be rewritten. Other bodies (e.g. remote write, imports) are passed to the upstream as is. If app.ResponseCompression is enabled, the encoding of the response is negotiated with the client, while responses of the upstream are requested uncompressed, so they can be inspected and rewritten.
+func (app *application) compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if encoding := r.Header.Get("Content-Encoding"); encoding != "" && app.isFormEncoded(r) {
+			body, err := newDecompressor(encoding, r.Body)
+			if err != nil {
+				hlog.FromRequest(r).Error().Caller().
+					Err(err).Msg("")
+				app.clientError(w, http.StatusUnsupportedMediaType)
+				return
+			}
+			defer body.Close()
+
+			r.Body = body
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+		}
+
+		if app.ResponseCompression {
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			// The transport requests and decompresses gzip transparently if Accept-Encoding is not set
+			r.Header.Del("Accept-Encoding")
+
+			if encoding != "" {
+				r = r.WithContext(context.WithValue(r.Context(), contextKeyResponseEncoding, encoding))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// compressResponse compresses the response of the upstream with the encoding negotiated by compressionMiddleware. Responses that are already encoded, partial or small ones are passed as is.
+func (app *application) compressResponse(resp *http.Response) error {
+	if resp.Request == nil {
+		return nil
+	}
+
+	encoding, ok := resp.Request.Context().Value(contextKeyResponseEncoding).(string)
+	if !ok || encoding == "" {
+		return nil
+	}
+
+	resp.Header.Add("Vary", "Accept-Encoding")
+
+	if resp.Header.Get("Content-Encoding") != "" || resp.Request.Method == http.MethodHead ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified || resp.StatusCode == http.StatusPartialContent ||
+		resp.Request.Header.Get("Range") != "" || (resp.ContentLength >= 0 && resp.ContentLength < minCompressedResponseSize) {
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	cw, err := newCompressor(encoding, pw)
+	if err != nil {
+		return err
+	}
+
+	body := resp.Body
+	go func() {
+		_, err := io.Copy(cw, body)
+		if closeErr := cw.Close(); err == nil {
+			err = closeErr
+		}
+		body.Close()
+		pw.CloseWithError(err)
+	}()
+
+	resp.Body = pr
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Content-Encoding", encoding)
+
+	return nil
+}
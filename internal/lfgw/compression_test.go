@@ -0,0 +1,259 @@
+package lfgw
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		want           string
+	}{
+		{
+			name:           "empty",
+			acceptEncoding: "",
+			want:           "",
+		},
+		{
+			name:           "identity only",
+			acceptEncoding: "identity",
+			want:           "",
+		},
+		{
+			name:           "browser",
+			acceptEncoding: "gzip, deflate, br, zstd",
+			want:           encodingZstd,
+		},
+		{
+			name:           "weights",
+			acceptEncoding: "zstd;q=0.5, br;q=0.8, gzip",
+			want:           encodingGzip,
+		},
+		{
+			name:           "disabled encoding",
+			acceptEncoding: "zstd;q=0, br",
+			want:           encodingBrotli,
+		},
+		{
+			name:           "wildcard",
+			acceptEncoding: "*;q=0.1, gzip",
+			want:           encodingGzip,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, negotiateEncoding(tt.acceptEncoding))
+		})
+	}
+}
+
+// compress returns data compressed with the encoding.
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	cw, err := newCompressor(encoding, &buf)
+	assert.Nil(t, err)
+	_, err = cw.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, cw.Close())
+
+	return buf.Bytes()
+}
+
+// decompress returns data decompressed according to the encoding.
+func decompress(t *testing.T, encoding string, data []byte) []byte {
+	zr, err := newDecompressor(encoding, bytes.NewReader(data))
+	assert.Nil(t, err)
+	defer zr.Close()
+
+	decompressed, err := io.ReadAll(zr)
+	assert.Nil(t, err)
+
+	return decompressed
+}
+
+func TestApp_compressionMiddleware(t *testing.T) {
+	logger := zerolog.New(nil)
+	form := url.Values{"query": {`up{namespace="minio"}`}}.Encode()
+
+	tests := []struct {
+		name                string
+		responseCompression bool
+		contentType         string
+		contentEncoding     string
+		acceptEncoding      string
+		wantStatus          int
+		wantBody            string
+		wantEncoding        string
+	}{
+		{
+			name:            "zstd form",
+			contentType:     "application/x-www-form-urlencoded",
+			contentEncoding: encodingZstd,
+			wantStatus:      http.StatusOK,
+			wantBody:        form,
+		},
+		{
+			name:            "brotli form",
+			contentType:     "application/x-www-form-urlencoded",
+			contentEncoding: encodingBrotli,
+			wantStatus:      http.StatusOK,
+			wantBody:        form,
+		},
+		{
+			name:            "other bodies are passed as is",
+			contentType:     "application/x-protobuf",
+			contentEncoding: encodingZstd,
+			wantStatus:      http.StatusOK,
+			wantEncoding:    "",
+		},
+		{
+			name:            "unsupported encoding",
+			contentType:     "application/x-www-form-urlencoded",
+			contentEncoding: "compress",
+			wantStatus:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:                "response encoding is negotiated",
+			responseCompression: true,
+			acceptEncoding:      "gzip, br",
+			wantStatus:          http.StatusOK,
+			wantEncoding:        encodingBrotli,
+		},
+		{
+			name:           "response compression is disabled",
+			acceptEncoding: "gzip, br",
+			wantStatus:     http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{
+				logger:              &logger,
+				ResponseCompression: tt.responseCompression,
+			}
+
+			body := []byte(form)
+			if tt.contentEncoding != "" && tt.contentEncoding != "compress" {
+				body = compress(t, tt.contentEncoding, body)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/query", bytes.NewReader(body))
+			r.Header.Set("Content-Type", tt.contentType)
+			r.Header.Set("Content-Encoding", tt.contentEncoding)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rr := httptest.NewRecorder()
+
+			var gotBody []byte
+			var gotEncoding string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotBody, _ = io.ReadAll(r.Body)
+				gotEncoding, _ = r.Context().Value(contextKeyResponseEncoding).(string)
+
+				if tt.responseCompression {
+					assert.Empty(t, r.Header.Get("Accept-Encoding"))
+				}
+			})
+
+			app.compressionMiddleware(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantEncoding, gotEncoding)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, string(gotBody))
+			}
+		})
+	}
+}
+
+func TestApp_compressResponse(t *testing.T) {
+	app := &application{}
+	payload := strings.Repeat(`{"status":"success","data":{"resultType":"vector","result":[]}}`, 100)
+
+	tests := []struct {
+		name         string
+		encoding     string
+		body         string
+		header       http.Header
+		wantEncoding string
+	}{
+		{
+			name:         "zstd",
+			encoding:     encodingZstd,
+			body:         payload,
+			header:       http.Header{},
+			wantEncoding: encodingZstd,
+		},
+		{
+			name:         "gzip",
+			encoding:     encodingGzip,
+			body:         payload,
+			header:       http.Header{},
+			wantEncoding: encodingGzip,
+		},
+		{
+			name:     "not negotiated",
+			body:     payload,
+			header:   http.Header{},
+			encoding: "",
+		},
+		{
+			name:         "already encoded",
+			encoding:     encodingBrotli,
+			body:         payload,
+			header:       http.Header{"Content-Encoding": {"snappy"}},
+			wantEncoding: "snappy",
+		},
+		{
+			name:     "small response",
+			encoding: encodingBrotli,
+			body:     "{}",
+			header:   http.Header{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+			if tt.encoding != "" {
+				r = r.WithContext(context.WithValue(r.Context(), contextKeyResponseEncoding, tt.encoding))
+			}
+
+			resp := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        tt.header,
+				Body:          io.NopCloser(strings.NewReader(tt.body)),
+				ContentLength: int64(len(tt.body)),
+				Request:       r,
+			}
+
+			err := app.compressResponse(resp)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantEncoding, resp.Header.Get("Content-Encoding"))
+
+			body, err := io.ReadAll(resp.Body)
+			assert.Nil(t, err)
+
+			if tt.wantEncoding == tt.encoding && tt.wantEncoding != "" {
+				assert.Equal(t, int64(-1), resp.ContentLength)
+				body = decompress(t, tt.wantEncoding, body)
+			}
+			assert.Equal(t, tt.body, string(body))
+		})
+	}
+}
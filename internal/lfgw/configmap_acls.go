@@ -0,0 +1,91 @@
+package lfgw
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/weisdd/lfgw/internal/kubernetes"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// parseConfigMapRef splits a ConfigMap reference in the namespace/name format.
+func parseConfigMapRef(ref string) (string, string, error) {
+	namespace, name, found := strings.Cut(ref, "/")
+	if !found || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid ConfigMap reference %q, expected namespace/name", ref)
+	}
+
+	return namespace, name, nil
+}
+
+// configureConfigMapACLs sets up a Kubernetes client (in-cluster or through kubeconfig) and loads ACLs from app.ACLConfigMap.
+func (app *application) configureConfigMapACLs() error {
+	if _, _, err := parseConfigMapRef(app.ACLConfigMap); err != nil {
+		return err
+	}
+
+	client, err := kubernetes.NewClient()
+	if err != nil {
+		return err
+	}
+
+	app.kubernetesClient = client
+
+	app.logger.Info().Caller().
+		Msgf("Loading ACLs from ConfigMap %s (key: %s)", app.ACLConfigMap, app.ACLConfigMapKey)
+
+	_, err = app.syncConfigMapACLs(context.Background())
+	return err
+}
+
+// syncConfigMapACLs fetches app.ACLConfigMap, validates its content and swaps ACLs. The current ACLs are kept if the content fails validation. The resource version of the ConfigMap is returned even in that case, so further changes can be watched from there.
+func (app *application) syncConfigMapACLs(ctx context.Context) (string, error) {
+	namespace, name, err := parseConfigMapRef(app.ACLConfigMap)
+	if err != nil {
+		return "", err
+	}
+
+	cm, err := app.kubernetesClient.GetConfigMap(ctx, namespace, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to get ConfigMap %s: %w", app.ACLConfigMap, err)
+	}
+
+	content, exists := cm.Data[app.ACLConfigMapKey]
+	if !exists {
+		return cm.Metadata.ResourceVersion, fmt.Errorf("ConfigMap %s has no %s key, keeping the previous ACL", app.ACLConfigMap, app.ACLConfigMapKey)
+	}
+
+	acls, warnings, err := querymodifier.NewACLsFromBytes([]byte(content), app.EnforcedLabel)
+	if err != nil {
+		return cm.Metadata.ResourceVersion, fmt.Errorf("failed to load ACL from ConfigMap %s, keeping the previous one: %w", app.ACLConfigMap, err)
+	}
+
+	if err := app.handleDeprecations("ConfigMap "+app.ACLConfigMap, warnings); err != nil {
+		return cm.Metadata.ResourceVersion, fmt.Errorf("failed to load ACL from ConfigMap %s, keeping the previous one: %w", app.ACLConfigMap, err)
+	}
+
+	app.logRoleDefinitions(acls)
+
+	previous := app.setACLsDocument(acls, []byte(content))
+	aclLastSuccessfulReload.Set(float64(time.Now().Unix()))
+
+	app.logACLSummary(previous, acls)
+
+	return cm.Metadata.ResourceVersion, nil
+}
+
+// runConfigMapACLWatcher reloads ACLs on every change of app.ACLConfigMap until ctx is cancelled.
+func (app *application) runConfigMapACLWatcher(ctx context.Context) {
+	namespace, name, err := parseConfigMapRef(app.ACLConfigMap)
+	if err != nil {
+		app.logger.Error().Caller().
+			Err(err).Msg("")
+		return
+	}
+
+	app.runKubernetesWatchLoop(ctx, app.syncConfigMapACLs, func(ctx context.Context, resourceVersion string) (bool, error) {
+		return app.kubernetesClient.WaitForConfigMapChange(ctx, namespace, name, resourceVersion)
+	})
+}
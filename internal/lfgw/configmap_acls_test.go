@@ -0,0 +1,83 @@
+package lfgw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/kubernetes"
+)
+
+func TestParseConfigMapRef(t *testing.T) {
+	namespace, name, err := parseConfigMapRef("lfgw/acl")
+	assert.Nil(t, err)
+	assert.Equal(t, "lfgw", namespace)
+	assert.Equal(t, "acl", name)
+
+	for _, ref := range []string{"", "acl", "/acl", "lfgw/", "lfgw/acl/acl.yaml"} {
+		_, _, err := parseConfigMapRef(ref)
+		assert.NotNil(t, err, ref)
+	}
+}
+
+func TestApp_syncConfigMapACLs(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	content := `{"metadata":{"resourceVersion":"1"},"data":{"acl.yaml":"version: 2\nroles:\n  minio: minio\n"}}`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/lfgw/configmaps/acl" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer ts.Close()
+
+	app := &application{
+		acls:            &aclsState{},
+		logger:          &logger,
+		ACLConfigMap:    "lfgw/acl",
+		ACLConfigMapKey: "acl.yaml",
+		kubernetesClient: &kubernetes.Client{
+			APIServerURL: ts.URL,
+			HTTPClient:   ts.Client(),
+		},
+	}
+
+	resourceVersion, err := app.syncConfigMapACLs(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "1", resourceVersion)
+	assert.Equal(t, "minio", app.getACLs()["minio"].RawACL)
+
+	t.Run("Invalid content keeps the previous ACL", func(t *testing.T) {
+		previous := app.getACLs()
+		content = `{"metadata":{"resourceVersion":"2"},"data":{"acl.yaml":"version: 2\nroles:\n  minio: mini[o\n"}}`
+
+		resourceVersion, err := app.syncConfigMapACLs(context.Background())
+		assert.NotNil(t, err)
+		assert.Equal(t, "2", resourceVersion)
+		assert.Equal(t, previous, app.getACLs())
+	})
+
+	t.Run("Missing key keeps the previous ACL", func(t *testing.T) {
+		previous := app.getACLs()
+		content = `{"metadata":{"resourceVersion":"3"},"data":{"acl.yml":"version: 2\nroles:\n  minio: mimir\n"}}`
+
+		resourceVersion, err := app.syncConfigMapACLs(context.Background())
+		assert.NotNil(t, err)
+		assert.Equal(t, "3", resourceVersion)
+		assert.Equal(t, previous, app.getACLs())
+	})
+
+	t.Run("Missing ConfigMap", func(t *testing.T) {
+		app.ACLConfigMap = "lfgw/random-name"
+
+		resourceVersion, err := app.syncConfigMapACLs(context.Background())
+		assert.NotNil(t, err)
+		assert.Equal(t, "", resourceVersion)
+	})
+}
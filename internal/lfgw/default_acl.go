@@ -0,0 +1,72 @@
+package lfgw
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// defaultACLSubjectPlaceholder is replaced with the subject (sub claim) of the token in DEFAULT_ACL
+const defaultACLSubjectPlaceholder = "${sub}"
+
+var (
+	// validSubject limits subjects that can be substituted into DEFAULT_ACL, so they cannot inject extra definitions (e.g. through commas)
+	validSubject = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+
+	defaultACLRequests = metrics.NewCounter("default_acl_requests_total")
+)
+
+// hasDefaultACL returns true if users without matching roles should get a default ACL instead of being rejected.
+func (app *application) hasDefaultACL() bool {
+	return app.DefaultRole != "" || app.DefaultACL != ""
+}
+
+// validateDefaultACL makes sure app.DefaultACL is a valid ACL definition for any valid subject.
+func (app *application) validateDefaultACL() error {
+	if app.DefaultACL == "" {
+		return nil
+	}
+
+	label := app.EnforcedLabel
+	if label == "" {
+		label = querymodifier.DefaultLabel
+	}
+
+	_, err := querymodifier.NewACLForLabel(label, strings.ReplaceAll(app.DefaultACL, defaultACLSubjectPlaceholder, "subject"))
+	if err != nil {
+		return fmt.Errorf("invalid default ACL: %w", err)
+	}
+
+	return nil
+}
+
+// defaultUserACL returns the ACL for users without matching roles: either the one of app.DefaultRole or app.DefaultACL with ${sub} replaced by the subject of the token. Special symbols in the subject are escaped, so it's always matched literally.
+func (app *application) defaultUserACL(subject string) (querymodifier.ACL, error) {
+	defaultACLRequests.Inc()
+
+	if app.DefaultRole != "" {
+		acl, err := app.getACLs().GetUserACL([]string{app.DefaultRole}, false, app.EnforcedLabel)
+		if err != nil {
+			return querymodifier.ACL{}, fmt.Errorf("failed to use default role %s: %w", app.DefaultRole, err)
+		}
+		return acl, nil
+	}
+
+	rawACL := app.DefaultACL
+	if strings.Contains(rawACL, defaultACLSubjectPlaceholder) {
+		if !validSubject.MatchString(subject) {
+			return querymodifier.ACL{}, fmt.Errorf("%w: %q", errInvalidSubject, subject)
+		}
+		rawACL = strings.ReplaceAll(rawACL, defaultACLSubjectPlaceholder, regexp.QuoteMeta(subject))
+	}
+
+	label := app.EnforcedLabel
+	if label == "" {
+		label = querymodifier.DefaultLabel
+	}
+
+	return querymodifier.NewACLForLabel(label, rawACL)
+}
@@ -0,0 +1,81 @@
+package lfgw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_defaultUserACL(t *testing.T) {
+	acls, _, err := querymodifier.NewACLsFromBytes([]byte("guest: public"), "")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name    string
+		app     application
+		subject string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "default role",
+			app:     application{DefaultRole: "guest"},
+			subject: "f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+			want:    "public",
+		},
+		{
+			name:    "unknown default role",
+			app:     application{DefaultRole: "unknown"},
+			subject: "f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+			wantErr: true,
+		},
+		{
+			name:    "default ACL with subject",
+			app:     application{DefaultACL: "user-${sub}"},
+			subject: "f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+			want:    "user-f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+		},
+		{
+			name:    "special symbols in subject are escaped",
+			app:     application{DefaultACL: "user-${sub}"},
+			subject: "john.doe",
+			want:    `user-john\.doe`,
+		},
+		{
+			name:    "subject cannot inject definitions",
+			app:     application{DefaultACL: "user-${sub}"},
+			subject: "x, .*",
+			wantErr: true,
+		},
+		{
+			name:    "static default ACL",
+			app:     application{DefaultACL: "public, sandbox"},
+			subject: "x, .*",
+			want:    "public, sandbox",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := tt.app
+			app.ACLs = acls
+			app.acls = &aclsState{}
+
+			got, err := app.defaultUserACL(tt.subject)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got.RawACL)
+		})
+	}
+}
+
+func TestApp_validateDefaultACL(t *testing.T) {
+	assert.Nil(t, (&application{}).validateDefaultACL())
+	assert.Nil(t, (&application{DefaultACL: "user-${sub}"}).validateDefaultACL())
+	assert.NotNil(t, (&application{DefaultACL: "user-${sub}-["}).validateDefaultACL())
+}
@@ -0,0 +1,89 @@
+package lfgw
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+)
+
+// configureDrain sets up the draining state (off until draining is requested) along with its gauge.
+func (app *application) configureDrain() {
+	draining := &atomic.Bool{}
+	app.draining = draining
+
+	metrics.GetOrCreateGauge("draining", func() float64 {
+		if draining.Load() {
+			return 1
+		}
+		return 0
+	})
+}
+
+// isDraining returns true once draining has begun.
+func (app *application) isDraining() bool {
+	return app.draining != nil && app.draining.Load()
+}
+
+// readyzHandler reports readiness: NotReady once draining has begun, so external load balancers stop sending new requests. In deep mode, it also verifies that a query rewritten according to a randomly selected role succeeds in the upstream.
+func (app *application) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if app.isDraining() {
+		http.Error(w, "Draining", http.StatusServiceUnavailable)
+		return
+	}
+
+	if app.DeepHealthcheck && !app.deepHealthcheckHandler(w, r) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("OK"))
+}
+
+// drainHandler begins draining, it requires an admin token.
+func (app *application) drainHandler(w http.ResponseWriter, r *http.Request) {
+	if app.draining == nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	if !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		app.clientError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	hlog.FromRequest(r).Info().Caller().
+		Msg("Drain requested")
+
+	app.drain()
+
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte("Draining"))
+}
+
+// drain flips readiness to NotReady and, once DrainGracePeriod is over, disables keep-alives, so clients of existing connections reconnect elsewhere. Requests are still served in the meantime. Repeated calls have no effect.
+func (app *application) drain() {
+	if !app.draining.CompareAndSwap(false, true) {
+		return
+	}
+
+	app.logger.Info().Caller().
+		Msgf("Draining: readiness is set to NotReady, keep-alives will be disabled in %s", app.DrainGracePeriod)
+
+	time.AfterFunc(app.DrainGracePeriod, func() {
+		if app.server != nil {
+			app.server.SetKeepAlivesEnabled(false)
+		}
+
+		app.logger.Info().Caller().
+			Msg("Draining: keep-alives are disabled")
+	})
+}
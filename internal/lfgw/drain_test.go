@@ -0,0 +1,84 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_drain(t *testing.T) {
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:           &logger,
+		AdminToken:       "secret",
+		DrainGracePeriod: 10 * time.Millisecond,
+	}
+	app.configureDrain()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := app.nonProxiedEndpointsMiddleware(next)
+
+	request := func(method, path, authorization string) int {
+		t.Helper()
+
+		r, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Authorization", authorization)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		rs := rr.Result()
+		defer rs.Body.Close()
+
+		return rs.StatusCode
+	}
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	app.server = ts.Config
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/readyz", ""))
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "/admin/drain", ""))
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "/admin/drain", "Bearer random"))
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/readyz", ""))
+	})
+
+	t.Run("Wrong method", func(t *testing.T) {
+		assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodGet, "/admin/drain", "Bearer secret"))
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/readyz", ""))
+	})
+
+	t.Run("Drain", func(t *testing.T) {
+		assert.Equal(t, http.StatusAccepted, request(http.MethodPost, "/admin/drain", "Bearer secret"))
+		assert.Equal(t, http.StatusServiceUnavailable, request(http.MethodGet, "/readyz", ""))
+
+		// Requests are still served
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/healthz", ""))
+		assert.Equal(t, http.StatusNoContent, request(http.MethodGet, "/api/v1/query", ""))
+
+		// Repeated calls are fine
+		assert.Equal(t, http.StatusAccepted, request(http.MethodPost, "/admin/drain", "Bearer secret"))
+	})
+
+	t.Run("Keep-alives are disabled after the grace period", func(t *testing.T) {
+		assert.Eventually(t, func() bool {
+			rs, err := http.Get(ts.URL + "/healthz")
+			if err != nil {
+				return false
+			}
+			defer rs.Body.Close()
+
+			return rs.Close
+		}, time.Second, 10*time.Millisecond)
+	})
+}
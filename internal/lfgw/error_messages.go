@@ -0,0 +1,273 @@
+package lfgw
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/rs/zerolog/hlog"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultErrorMessagesLanguage holds templates used if none of the languages accepted by the client has a template for the status
+	defaultErrorMessagesLanguage = "default"
+	// maxUpstreamErrorLength limits how much of an upstream error is read to be exposed to templates
+	maxUpstreamErrorLength = 4 << 10
+)
+
+// templatedStatuses lists statuses error messages can be templated for.
+var templatedStatuses = map[int]bool{
+	http.StatusUnauthorized:    true,
+	http.StatusForbidden:       true,
+	http.StatusTooManyRequests: true,
+}
+
+// errorMessagesFile represents the content of an error messages file.
+type errorMessagesFile struct {
+	// Contact is exposed to templates as .Contact (e.g. a link to a support channel)
+	Contact string `yaml:"contact"`
+	// Messages maps languages (e.g. de, pt-br or default) to message templates per status
+	Messages map[string]map[int]string `yaml:"messages"`
+}
+
+// errorMessages is a set of templates for the human-readable part of client errors.
+type errorMessages struct {
+	contact   string
+	templates map[string]map[int]*template.Template
+}
+
+// errorMessageData is passed to error message templates.
+type errorMessageData struct {
+	Status    int
+	Error     string
+	Roles     []string
+	Path      string
+	RequestID string
+	Contact   string
+}
+
+// configureErrorMessages loads error message templates from app.ErrorMessagesPath if it's set.
+func (app *application) configureErrorMessages() error {
+	if app.ErrorMessagesPath == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(app.ErrorMessagesPath)
+	if err != nil {
+		return err
+	}
+
+	messages, err := newErrorMessages(content)
+	if err != nil {
+		return fmt.Errorf("failed to load error messages: %w", err)
+	}
+
+	app.errorMessages = messages
+
+	app.logger.Info().Caller().
+		Msgf("Error messages are loaded: %d languages", len(messages.templates))
+
+	return nil
+}
+
+// newErrorMessages parses and validates error message templates. Templates are executed against sample data, so references to unknown fields are caught on start.
+func newErrorMessages(content []byte) (*errorMessages, error) {
+	var file errorMessagesFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	messages := &errorMessages{
+		contact:   file.Contact,
+		templates: make(map[string]map[int]*template.Template, len(file.Messages)),
+	}
+
+	sample := errorMessageData{Status: http.StatusForbidden, Roles: []string{"team-a"}, Contact: file.Contact}
+	for language, statuses := range file.Messages {
+		language = strings.ToLower(strings.TrimSpace(language))
+		if language == "" {
+			return nil, fmt.Errorf("language cannot be empty")
+		}
+
+		messages.templates[language] = make(map[int]*template.Template, len(statuses))
+		for status, text := range statuses {
+			if !templatedStatuses[status] {
+				return nil, fmt.Errorf("%s: status %d cannot be templated, supported statuses: 401, 403, 429", language, status)
+			}
+
+			tmpl, err := template.New(fmt.Sprintf("%s/%d", language, status)).
+				Funcs(template.FuncMap{"join": strings.Join}).
+				Parse(text)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := tmpl.Execute(io.Discard, sample); err != nil {
+				return nil, err
+			}
+
+			messages.templates[language][status] = tmpl
+		}
+	}
+
+	return messages, nil
+}
+
+// lookup returns a template for the status in the language most preferred by the client according to the Accept-Language header, falls back to the default language. Returns nil if there's no template for the status.
+func (m *errorMessages) lookup(acceptLanguage string, status int) (*template.Template, string) {
+	for _, language := range append(acceptedLanguages(acceptLanguage), defaultErrorMessagesLanguage) {
+		if tmpl, ok := m.templates[language][status]; ok {
+			return tmpl, language
+		}
+	}
+
+	return nil, ""
+}
+
+// acceptedLanguages returns languages listed in the Accept-Language header ordered by preference. A regional variant (e.g. de-ch) is followed by its base language (de).
+func acceptedLanguages(header string) []string {
+	type weightedLanguage struct {
+		language string
+		weight   float64
+	}
+
+	weighted := []weightedLanguage{}
+	for _, part := range strings.Split(header, ",") {
+		language, params, _ := strings.Cut(part, ";")
+		language = strings.ToLower(strings.TrimSpace(language))
+		if language == "" || language == "*" {
+			continue
+		}
+
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if weight <= 0 {
+			continue
+		}
+
+		weighted = append(weighted, weightedLanguage{language: language, weight: weight})
+	}
+
+	sort.SliceStable(weighted, func(i, j int) bool {
+		return weighted[i].weight > weighted[j].weight
+	})
+
+	languages := make([]string, 0, len(weighted))
+	for _, w := range weighted {
+		languages = append(languages, w.language)
+		if base, _, ok := strings.Cut(w.language, "-"); ok {
+			languages = append(languages, base)
+		}
+	}
+
+	return languages
+}
+
+// renderErrorMessage renders the human-readable part of a client error for the request. Returns false if error messages are not configured, there's no template for the status or the template fails.
+func (app *application) renderErrorMessage(r *http.Request, status int, err error) (string, string, bool) {
+	if app.errorMessages == nil || r == nil {
+		return "", "", false
+	}
+
+	tmpl, language := app.errorMessages.lookup(r.Header.Get("Accept-Language"), status)
+	if tmpl == nil {
+		return "", "", false
+	}
+
+	data := errorMessageData{
+		Status:  status,
+		Path:    r.URL.Path,
+		Contact: app.errorMessages.contact,
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+	data.Roles, _ = r.Context().Value(contextKeyRoles).([]string)
+	if id, ok := hlog.IDFromRequest(r); ok {
+		data.RequestID = id.String()
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		hlog.FromRequest(r).Error().Caller().
+			Err(err).Msg("Failed to render an error message")
+		return "", "", false
+	}
+
+	return buf.String(), language, true
+}
+
+// userError sends a client error to an end user. Unless error messages are configured, it's the same as clientErrorMessage (or clientError if err is nil). Denials (401, 403) are kept in recent denials, the error is kept in the request snapshot.
+func (app *application) userError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	app.recordDenial(r, status, err)
+	app.setSnapshotError(r, err)
+
+	message, language, ok := app.renderErrorMessage(r, status, err)
+	if !ok {
+		if err == nil {
+			app.clientError(w, status)
+			return
+		}
+		app.clientErrorMessage(w, status, err)
+		return
+	}
+
+	if language != defaultErrorMessagesLanguage {
+		w.Header().Set("Content-Language", language)
+	}
+	http.Error(w, http.StatusText(status), status)
+	fmt.Fprintf(w, "%s", message)
+}
+
+// applyErrorMessage replaces the body of 429 Too Many Requests responses of the upstream with a templated error message, the original body is exposed to the template as .Error.
+func (app *application) applyErrorMessage(resp *http.Response) error {
+	if app.errorMessages == nil || resp.Request == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	upstreamError, err := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamErrorLength))
+	if err != nil {
+		return fmt.Errorf("failed to read the upstream error: %w", err)
+	}
+
+	var templateErr error
+	// Compressed errors are not exposed to templates
+	if resp.Header.Get("Content-Encoding") == "" {
+		templateErr = fmt.Errorf("%s", bytes.TrimSpace(upstreamError))
+	}
+
+	message, language, ok := app.renderErrorMessage(resp.Request, resp.StatusCode, templateErr)
+	if !ok {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(upstreamError), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+
+	body := []byte(http.StatusText(resp.StatusCode) + "\n" + message)
+	if language != defaultErrorMessagesLanguage {
+		resp.Header.Set("Content-Language", language)
+	}
+	resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.ContentLength = int64(len(body))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	return nil
+}
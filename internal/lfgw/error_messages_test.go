@@ -0,0 +1,231 @@
+package lfgw
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewErrorMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			content: `
+contact: https://wiki.example.com/metrics-access
+messages:
+  default:
+    403: "Roles {{ join .Roles \", \" }} are not allowed to access {{ .Path }}, see {{ .Contact }}"
+  DE:
+    401: "Anmeldung fehlgeschlagen: {{ .Error }}"
+`,
+		},
+		{
+			name: "unsupported status",
+			content: `
+messages:
+  default:
+    500: "oops"
+`,
+			wantErr: true,
+		},
+		{
+			name: "malformed template",
+			content: `
+messages:
+  default:
+    403: "{{ .Roles"
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown field",
+			content: `
+messages:
+  default:
+    403: "{{ .Team }}"
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newErrorMessages([]byte(tt.content))
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Contains(t, got.templates, "de")
+		})
+	}
+}
+
+func TestAcceptedLanguages(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []string
+	}{
+		{
+			name:   "empty",
+			header: "",
+			want:   []string{},
+		},
+		{
+			name:   "ordered by weight",
+			header: "en;q=0.5, de-CH, fr;q=0.8, *;q=0.1",
+			want:   []string{"de-ch", "de", "fr", "en"},
+		},
+		{
+			name:   "zero weight and malformed weights are ignored",
+			header: "pt;q=0, es;q=abc, it",
+			want:   []string{"it"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, acceptedLanguages(tt.header))
+		})
+	}
+}
+
+func TestApp_userError(t *testing.T) {
+	messages, err := newErrorMessages([]byte(`
+contact: https://wiki.example.com/metrics-access
+messages:
+  default:
+    403: "Roles {{ join .Roles \", \" }} cannot access {{ .Path }}, see {{ .Contact }}"
+  de:
+    403: "Rollen {{ join .Roles \", \" }} haben keinen Zugriff, siehe {{ .Contact }}"
+`))
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+
+	tests := []struct {
+		name           string
+		messages       *errorMessages
+		status         int
+		acceptLanguage string
+		wantBody       string
+		wantLanguage   string
+	}{
+		{
+			name:     "not configured",
+			status:   http.StatusForbidden,
+			wantBody: "Forbidden\naccess denied",
+		},
+		{
+			name:     "default language",
+			messages: messages,
+			status:   http.StatusForbidden,
+			wantBody: "Forbidden\nRoles team-a, team-b cannot access /api/v1/query, see https://wiki.example.com/metrics-access",
+		},
+		{
+			name:           "preferred language",
+			messages:       messages,
+			status:         http.StatusForbidden,
+			acceptLanguage: "fr, de-AT;q=0.9",
+			wantBody:       "Forbidden\nRollen team-a, team-b haben keinen Zugriff, siehe https://wiki.example.com/metrics-access",
+			wantLanguage:   "de",
+		},
+		{
+			name:     "no template for the status",
+			messages: messages,
+			status:   http.StatusUnauthorized,
+			wantBody: "Unauthorized\naccess denied",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{
+				logger:        &logger,
+				errorMessages: tt.messages,
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+			r.Header.Set("Accept-Language", tt.acceptLanguage)
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyRoles, []string{"team-a", "team-b"}))
+			rr := httptest.NewRecorder()
+
+			app.userError(rr, r, tt.status, errors.New("access denied"))
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, tt.wantBody, rr.Body.String())
+			assert.Equal(t, tt.wantLanguage, rr.Header().Get("Content-Language"))
+		})
+	}
+}
+
+func TestApp_applyErrorMessage(t *testing.T) {
+	messages, err := newErrorMessages([]byte(`
+messages:
+  default:
+    429: "Slow down, please: {{ .Error }}"
+`))
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:        &logger,
+		errorMessages: messages,
+	}
+
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantBody string
+	}{
+		{
+			name:     "too many requests",
+			status:   http.StatusTooManyRequests,
+			body:     "concurrency limit exceeded\n",
+			wantBody: "Too Many Requests\nSlow down, please: concurrency limit exceeded",
+		},
+		{
+			name:     "other statuses are passed through",
+			status:   http.StatusServiceUnavailable,
+			body:     "unavailable\n",
+			wantBody: "unavailable\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: tt.status,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+				Request:    httptest.NewRequest(http.MethodGet, "/api/v1/query", nil),
+			}
+
+			err := app.applyErrorMessage(resp)
+			assert.Nil(t, err)
+
+			body, err := io.ReadAll(resp.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantBody, string(body))
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
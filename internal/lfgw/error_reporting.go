@@ -0,0 +1,371 @@
+package lfgw
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	errorKindPanic = "panic"
+	errorKindProxy = "proxy"
+	errorKindOIDC  = "oidc"
+
+	// errorReportQueueSize is the maximum amount of events waiting to be sent, further events are dropped
+	errorReportQueueSize = 100
+	// errorReportRateLimit is the maximum amount of events sent per minute, so a flood of errors (e.g. expired tokens) doesn't exhaust the quota
+	errorReportRateLimit = 60
+)
+
+var (
+	errorReportsSentTotal    = metrics.NewCounter(`error_reports_total{result="sent"}`)
+	errorReportsFailedTotal  = metrics.NewCounter(`error_reports_total{result="failed"}`)
+	errorReportsDroppedTotal = metrics.NewCounter(`error_reports_total{result="dropped"}`)
+)
+
+// errorReportScrubbedHeaders are request headers never sent along with events, as they contain credentials
+var errorReportScrubbedHeaders = []string{"Authorization", "Cookie", "X-Forwarded-Access-Token", "X-Auth-Request-Access-Token"}
+
+// errorReporter sends events to a Sentry-compatible endpoint through the envelope API. Events are queued and sent in the background, so reporting never delays requests.
+type errorReporter struct {
+	endpoint    string
+	auth        string
+	dsn         string
+	environment string
+	release     string
+	serverName  string
+	client      *http.Client
+	queue       chan sentryEvent
+
+	mu          sync.Mutex
+	windowStart time.Time
+	windowCount int
+}
+
+// sentryEvent is a subset of the Sentry event payload.
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Exception   *sentryExceptions `json:"exception,omitempty"`
+	Request     *sentryRequest    `json:"request,omitempty"`
+	User        *sentryUser       `json:"user,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]any    `json:"extra,omitempty"`
+}
+
+// sentryExceptions is the exception interface of Sentry events.
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+// sentryException describes a single error.
+type sentryException struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// sentryRequest is the request interface of Sentry events.
+type sentryRequest struct {
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`
+	QueryString string            `json:"query_string,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+// sentryUser is the user interface of Sentry events.
+type sentryUser struct {
+	ID        string `json:"id,omitempty"`
+	Email     string `json:"email,omitempty"`
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+// newErrorReporter parses the DSN (e.g. https://<public key>@sentry.example.com/<project ID>) and returns a reporter sending events to its envelope endpoint.
+func newErrorReporter(dsn, environment, release string) (*errorReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse error reporting DSN: %w", err)
+	}
+
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("error reporting DSN must be an http(s) URL with a public key, e.g. https://<key>@sentry.example.com/<project>")
+	}
+
+	path := strings.TrimRight(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	projectID := path[i+1:]
+	if projectID == "" {
+		return nil, fmt.Errorf("error reporting DSN must contain a project ID")
+	}
+
+	serverName, _ := os.Hostname()
+
+	return &errorReporter{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:i], projectID),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_key=%s, sentry_client=lfgw/%s", u.User.Username(), release),
+		dsn:         dsn,
+		environment: environment,
+		release:     release,
+		serverName:  serverName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan sentryEvent, errorReportQueueSize),
+	}, nil
+}
+
+// configureErrorReporting sets up an error reporter if app.SentryDSN is set.
+func (app *application) configureErrorReporting() error {
+	if app.SentryDSN == "" {
+		return nil
+	}
+
+	reporter, err := newErrorReporter(app.SentryDSN, app.SentryEnvironment, app.buildInfo.Version)
+	if err != nil {
+		return err
+	}
+	app.errorReporter = reporter
+
+	app.logger.Info().Caller().
+		Msgf("Error reporting is on (endpoint: %s, environment: %q)", reporter.endpoint, app.SentryEnvironment)
+
+	return nil
+}
+
+// reportError queues an event for the error along with the context of the request (URL, scrubbed headers, request ID, caller and roles). Does nothing if error reporting is disabled.
+func (app *application) reportError(r *http.Request, kind, level string, err error, extra map[string]any) {
+	if app.errorReporter == nil {
+		return
+	}
+
+	event := sentryEvent{
+		Level:   level,
+		Message: err.Error(),
+		Exception: &sentryExceptions{Values: []sentryException{{
+			Type:  kind,
+			Value: err.Error(),
+		}}},
+		Tags:  map[string]string{"kind": kind},
+		Extra: extra,
+	}
+
+	if r != nil {
+		headers := make(map[string]string, len(r.Header))
+		for name := range r.Header {
+			headers[name] = r.Header.Get(name)
+		}
+		for _, name := range errorReportScrubbedHeaders {
+			delete(headers, name)
+		}
+
+		event.Request = &sentryRequest{
+			URL:         app.requestURL(r),
+			Method:      r.Method,
+			QueryString: r.URL.RawQuery,
+			Headers:     headers,
+		}
+
+		event.User = &sentryUser{}
+		if addr, err := app.getClientIP(r); err == nil {
+			event.User.IPAddress = addr.String()
+		}
+		if id, ok := r.Context().Value(contextKeyIdentity).(identity); ok {
+			event.User.ID = id.Subject
+			event.User.Email = id.Email
+			if id.APIKey != "" {
+				event.User.ID = apiKeyRolePrefix + id.APIKey
+			}
+		}
+
+		if id, ok := hlog.IDFromRequest(r); ok {
+			event.Tags["req_id"] = id.String()
+		}
+
+		if roles, ok := r.Context().Value(contextKeyRoles).([]string); ok {
+			if event.Extra == nil {
+				event.Extra = make(map[string]any)
+			}
+			event.Extra["roles"] = roles
+		}
+	}
+
+	app.errorReporter.enqueue(event)
+}
+
+// requestURL returns the URL the request was sent to without the query.
+func (app *application) requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return (&url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path}).String()
+}
+
+// enqueue fills in common fields of the event and queues it. Events are dropped if the queue is full or the rate limit is exceeded.
+func (er *errorReporter) enqueue(event sentryEvent) {
+	now := time.Now()
+
+	er.mu.Lock()
+	if now.Sub(er.windowStart) >= time.Minute {
+		er.windowStart = now
+		er.windowCount = 0
+	}
+	er.windowCount++
+	limited := er.windowCount > errorReportRateLimit
+	er.mu.Unlock()
+
+	if limited {
+		errorReportsDroppedTotal.Inc()
+		return
+	}
+
+	event.EventID = newEventID()
+	event.Timestamp = now.UTC().Format(time.RFC3339Nano)
+	event.Platform = "go"
+	event.Logger = "lfgw"
+	event.Release = er.release
+	event.Environment = er.environment
+	event.ServerName = er.serverName
+
+	select {
+	case er.queue <- event:
+	default:
+		errorReportsDroppedTotal.Inc()
+	}
+}
+
+// run sends queued events until ctx is cancelled, then tries to send the rest of them for a few seconds.
+func (er *errorReporter) run(ctx context.Context) {
+	for {
+		select {
+		case event := <-er.queue:
+			er.sendAndCount(ctx, event)
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			for {
+				select {
+				case event := <-er.queue:
+					er.sendAndCount(flushCtx, event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// sendAndCount sends the event and updates metrics.
+func (er *errorReporter) sendAndCount(ctx context.Context, event sentryEvent) {
+	if err := er.send(ctx, event); err != nil {
+		errorReportsFailedTotal.Inc()
+		return
+	}
+
+	errorReportsSentTotal.Inc()
+}
+
+// send posts the event as an envelope.
+func (er *errorReporter) send(ctx context.Context, event sentryEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	header, err := json.Marshal(map[string]string{
+		"event_id": event.EventID,
+		"dsn":      er.dsn,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	body.Write(header)
+	fmt.Fprintf(&body, "\n{\"type\":\"event\",\"length\":%d}\n", len(payload))
+	body.Write(payload)
+	body.WriteString("\n")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, er.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", er.auth)
+
+	resp, err := er.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// newEventID returns a random UUID without dashes, as expected by Sentry.
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return hex.EncodeToString(b)
+}
+
+// errorReportingMiddleware reports panics of further handlers and re-panics, so they're handled by net/http as before. http.ErrAbortHandler is used to abort responses on purpose (e.g. by the reverse proxy), so it's not reported.
+func (app *application) errorReportingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.errorReporter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec != http.ErrAbortHandler {
+					err, ok := rec.(error)
+					if !ok {
+						err = fmt.Errorf("%v", rec)
+					}
+					app.reportError(r, errorKindPanic, "fatal", err, map[string]any{"stack": string(debug.Stack())})
+				}
+
+				panic(rec)
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isClientGone returns true if the error is caused by the client, which cancelled the request, so there's nothing to report.
+func isClientGone(r *http.Request, err error) bool {
+	return errors.Is(err, context.Canceled) && errors.Is(r.Context().Err(), context.Canceled)
+}
@@ -0,0 +1,147 @@
+package lfgw
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewErrorReporter(t *testing.T) {
+	tests := []struct {
+		name         string
+		dsn          string
+		wantEndpoint string
+		wantErr      bool
+	}{
+		{
+			name:         "Sentry",
+			dsn:          "https://key@o1.ingest.sentry.io/42",
+			wantEndpoint: "https://o1.ingest.sentry.io/api/42/envelope/",
+		},
+		{
+			name:         "Path prefix",
+			dsn:          "http://key@glitchtip.example.com/errors/7",
+			wantEndpoint: "http://glitchtip.example.com/errors/api/7/envelope/",
+		},
+		{
+			name:    "No key",
+			dsn:     "https://sentry.example.com/42",
+			wantErr: true,
+		},
+		{
+			name:    "No project",
+			dsn:     "https://key@sentry.example.com/",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newErrorReporter(tt.dsn, "", "1.0.0")
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantEndpoint, got.endpoint)
+		})
+	}
+}
+
+func TestApp_reportError(t *testing.T) {
+	events := make(chan sentryEvent, 1)
+	sentry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/42/envelope/", r.URL.Path)
+		assert.Contains(t, r.Header.Get("X-Sentry-Auth"), "sentry_key=key")
+
+		// Envelope header, item header, event
+		scanner := bufio.NewScanner(r.Body)
+		lines := []string{}
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		assert.Len(t, lines, 3)
+
+		var event sentryEvent
+		assert.Nil(t, json.Unmarshal([]byte(lines[2]), &event))
+		events <- event
+	}))
+	defer sentry.Close()
+
+	reporter, err := newErrorReporter("http://key@"+sentry.Listener.Addr().String()+"/42", "test", "1.0.0")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reporter.run(ctx)
+
+	logger := zerolog.New(nil)
+	app := &application{logger: &logger, errorReporter: reporter}
+
+	r := httptest.NewRequest(http.MethodGet, "http://lfgw.example.com/api/v1/query?query=up", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("User-Agent", "Grafana")
+	r = r.WithContext(context.WithValue(r.Context(), contextKeyIdentity, identity{Subject: "sub", Email: "user@example.com"}))
+	r = r.WithContext(context.WithValue(r.Context(), contextKeyRoles, []string{"team-a"}))
+
+	app.reportError(r, errorKindProxy, "error", errors.New("dial tcp: connection refused"), nil)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "error", event.Level)
+		assert.Equal(t, "test", event.Environment)
+		assert.Equal(t, "1.0.0", event.Release)
+		assert.Equal(t, "proxy", event.Tags["kind"])
+		assert.Equal(t, "dial tcp: connection refused", event.Exception.Values[0].Value)
+		assert.Equal(t, "http://lfgw.example.com/api/v1/query", event.Request.URL)
+		assert.Equal(t, "query=up", event.Request.QueryString)
+		assert.Equal(t, map[string]string{"User-Agent": "Grafana"}, event.Request.Headers, "credentials must be scrubbed")
+		assert.Equal(t, "user@example.com", event.User.Email)
+		assert.Equal(t, []any{"team-a"}, event.Extra["roles"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not sent")
+	}
+}
+
+func TestApp_errorReportingMiddleware(t *testing.T) {
+	reporter, err := newErrorReporter("http://key@localhost/42", "", "1.0.0")
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+	app := &application{logger: &logger, errorReporter: reporter}
+
+	t.Run("Panic is reported and re-panicked", func(t *testing.T) {
+		handler := app.errorReportingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+
+		assert.PanicsWithValue(t, "boom", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/query", nil))
+		})
+
+		event := <-reporter.queue
+		assert.Equal(t, "fatal", event.Level)
+		assert.Equal(t, "boom", event.Message)
+		assert.Contains(t, event.Extra["stack"], "errorReportingMiddleware")
+	})
+
+	t.Run("Aborted handlers are not reported", func(t *testing.T) {
+		handler := app.errorReportingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+
+		assert.Panics(t, func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/query", nil))
+		})
+		assert.Len(t, reporter.queue, 0)
+	})
+}
@@ -3,9 +3,29 @@ package lfgw
 import "errors"
 
 var (
-	errNoToken                = errors.New("no bearer token found")
-	errNoTokenGrafana         = errors.New("no bearer token found, possible causes: grafana data source is not configured with Forward Oauth Identity option; grafana user sessions are not tuned to live shorter than IDP sessions; malicious requests")
-	errUpstreamNotInitialized = errors.New("UpstreamURL is not initialized")
-	errVerifierNotInitialized = errors.New("OIDC verifier is not initialized")
-	errACLNotSetInContext     = errors.New("ACL is not set in the context")
+	errNoToken                    = errors.New("no bearer token found")
+	errNoTokenGrafana             = errors.New("no bearer token found, possible causes: grafana data source is not configured with Forward Oauth Identity option; grafana user sessions are not tuned to live shorter than IDP sessions; malicious requests")
+	errUpstreamNotInitialized     = errors.New("UpstreamURL is not initialized")
+	errVerifierNotInitialized     = errors.New("OIDC verifier is not initialized")
+	errACLNotSetInContext         = errors.New("ACL is not set in the context")
+	errSourceIPNotAllowed         = errors.New("access from this IP address is not allowed for the roles")
+	errTooManyParams              = errors.New("too many parameters")
+	errParamTooLong               = errors.New("parameter is too long")
+	errTokenBinding               = errors.New("token does not satisfy binding requirements")
+	errInvalidSubject             = errors.New("token subject cannot be used in the default ACL")
+	errNotCatalogQuery            = errors.New("only queries from the query catalog are allowed")
+	errAPIKeyInvalid              = errors.New("invalid API key")
+	errAPIKeyExpired              = errors.New("API key is expired")
+	errPathNotAllowed             = errors.New("access to this path is not allowed for the roles")
+	errMethodNotAllowed           = errors.New("this method is not allowed for the roles")
+	errWriteRequiresFullaccess    = errors.New("writing data requires a role with full access, as namespaces cannot be enforced on it")
+	errACLsNotExportable          = errors.New("ACLs are not loaded from a document (e.g. from MetricsAccessPolicy objects), thus cannot be exported")
+	errACLsNotImportable          = errors.New("ACLs are derived from Kubernetes RBAC, thus cannot be imported")
+	errLifecycleDisabled          = errors.New("lifecycle API is not enabled")
+	errImpersonationDenied        = errors.New("only users with full access are allowed to impersonate roles")
+	errTaskExited                 = errors.New("background task exited unexpectedly")
+	errResponseTimeBudgetExceeded = errors.New("response time budget of the roles is exceeded")
+	errClaimsRejected             = errors.New("token claims are rejected")
+	errSnapshotNotFound           = errors.New("request snapshot is not found (the request is unknown or has been evicted)")
+	errNoAWSCredentials           = errors.New("no AWS credentials found (neither AWS_ROLE_ARN with AWS_WEB_IDENTITY_TOKEN_FILE, nor AWS_ACCESS_KEY_ID with AWS_SECRET_ACCESS_KEY are set)")
 )
@@ -0,0 +1,109 @@
+package lfgw
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/trace"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+)
+
+// executionTraceMaxFiles limits the number of traces kept in ExecutionTraceDir, the oldest ones are removed
+const executionTraceMaxFiles = 20
+
+var (
+	executionTraceCaptures = metrics.NewCounter("execution_traces_total")
+	// executionTraceRunning is set while a trace is recorded, the runtime supports only one trace at a time
+	executionTraceRunning atomic.Bool
+)
+
+// executionTraceMiddleware records Go execution traces for a sampled fraction (app.ExecutionTraceSampleRate) of requests and keeps the ones of requests served slower than app.ExecutionTraceThreshold in app.ExecutionTraceDir (e.g. 20220501T100000Z-<req_id>.trace), so sporadic latency spikes caused by scheduling, GC or lock contention can be analyzed with `go tool trace`. A trace covers the whole process, the request itself is marked as a task annotated with its ID. Requests sampled while another trace is recorded are not traced.
+func (app *application) executionTraceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.ExecutionTraceDir == "" || rand.Float64() >= app.ExecutionTraceSampleRate || !executionTraceRunning.CompareAndSwap(false, true) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer executionTraceRunning.Store(false)
+
+		f, err := os.CreateTemp(app.ExecutionTraceDir, "*.trace.tmp")
+		if err != nil {
+			hlog.FromRequest(r).Error().Caller().
+				Err(err).Msg("Failed to create an execution trace file")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Might fail if a trace is already being recorded by other means (e.g. tests with -trace)
+		if err := trace.Start(f); err != nil {
+			hlog.FromRequest(r).Debug().Caller().
+				Err(err).Msg("Failed to start an execution trace")
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reqID := "unknown"
+		if id, ok := hlog.IDFromRequest(r); ok {
+			reqID = id.String()
+		}
+
+		ctx, task := trace.NewTask(r.Context(), "request")
+		trace.Log(ctx, "req_id", reqID)
+		trace.Log(ctx, "path", r.URL.Path)
+
+		start := time.Now()
+		defer func() {
+			task.End()
+			trace.Stop()
+			app.saveExecutionTrace(r, f, reqID, start)
+		}()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// saveExecutionTrace keeps the recorded trace if the request was slow enough, otherwise it's removed.
+func (app *application) saveExecutionTrace(r *http.Request, f *os.File, reqID string, start time.Time) {
+	logger := hlog.FromRequest(r)
+	duration := time.Since(start)
+
+	if err := f.Close(); err != nil {
+		logger.Error().Caller().
+			Err(err).Msg("Failed to write an execution trace")
+		_ = os.Remove(f.Name())
+		return
+	}
+
+	if duration < app.ExecutionTraceThreshold {
+		if err := os.Remove(f.Name()); err != nil {
+			logger.Error().Caller().
+				Err(err).Msg("Failed to remove an execution trace")
+		}
+		return
+	}
+
+	path := filepath.Join(app.ExecutionTraceDir, fmt.Sprintf("%s-%s.trace", start.UTC().Format("20060102T150405Z"), reqID))
+	if err := os.Rename(f.Name(), path); err != nil {
+		logger.Error().Caller().
+			Err(err).Msg("Failed to save an execution trace")
+		_ = os.Remove(f.Name())
+		return
+	}
+
+	executionTraceCaptures.Inc()
+	logger.Warn().Caller().
+		Dur("duration", duration).Msgf("Recorded execution trace to %s", path)
+
+	if err := pruneOldestFiles(filepath.Join(app.ExecutionTraceDir, "*.trace"), executionTraceMaxFiles); err != nil {
+		logger.Error().Caller().
+			Err(err).Msg("Failed to remove old execution traces")
+	}
+}
@@ -0,0 +1,79 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_executionTraceMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate float64
+		threshold  time.Duration
+		wantTraces int
+	}{
+		{
+			name:       "slow request",
+			sampleRate: 1,
+			threshold:  0,
+			wantTraces: 1,
+		},
+		{
+			name:       "fast request",
+			sampleRate: 1,
+			threshold:  time.Hour,
+		},
+		{
+			name:       "not sampled",
+			sampleRate: 0,
+			threshold:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			app := &application{
+				ExecutionTraceDir:        dir,
+				ExecutionTraceSampleRate: tt.sampleRate,
+				ExecutionTraceThreshold:  tt.threshold,
+			}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			logger := zerolog.New(nil)
+			handler := hlog.NewHandler(logger)(hlog.RequestIDHandler("req_id", "Request-Id")(app.executionTraceMiddleware(next)))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/query", nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			entries, err := os.ReadDir(dir)
+			assert.Nil(t, err)
+			// Temporary files are removed
+			assert.Len(t, entries, tt.wantTraces)
+
+			if tt.wantTraces > 0 {
+				name := entries[0].Name()
+				assert.True(t, strings.HasSuffix(name, "-"+rr.Header().Get("Request-Id")+".trace"), name)
+
+				info, err := os.Stat(filepath.Join(dir, name))
+				assert.Nil(t, err)
+				assert.NotZero(t, info.Size())
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package lfgw
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// upstreamPath returns the path of an upstream request relative to app.UpstreamURL (e.g. /api/v1/query for /select/0/prometheus/api/v1/query).
+func (app *application) upstreamPath(path string) string {
+	if app.UpstreamURL == nil {
+		return path
+	}
+
+	prefix := strings.TrimRight(app.UpstreamURL.Path, "/")
+	if prefix == "" || !strings.HasPrefix(path, prefix+"/") {
+		return path
+	}
+
+	return strings.TrimPrefix(path, prefix)
+}
+
+// isExportPath returns true if the path targets one of the export endpoints (/api/v1/export, /api/v1/export/csv, /api/v1/export/native).
+func (app *application) isExportPath(path string) bool {
+	return strings.HasPrefix(app.upstreamPath(path), "/api/v1/export")
+}
+
+// applyExportRange serves a single byte range of an export response if the upstream ignored the Range header of the request (VictoriaMetrics streams exports as a whole), so large downloads can be resumed. It's only possible when the upstream reports the length of the response, otherwise the whole response is returned, which is allowed for servers that don't support ranges. Responses the upstream served as partial content are passed through as is.
+func (app *application) applyExportRange(resp *http.Response) error {
+	r := resp.Request
+	if r == nil || !app.isExportPath(r.URL.Path) || resp.StatusCode != http.StatusOK || resp.ContentLength < 0 {
+		return nil
+	}
+
+	if resp.Header.Get("Accept-Ranges") == "" {
+		resp.Header.Set("Accept-Ranges", "bytes")
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" {
+		return nil
+	}
+
+	// The representation might have changed since the download was started, so it's sent as a whole then
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != resp.Header.Get("ETag") && ifRange != resp.Header.Get("Last-Modified") {
+		return nil
+	}
+
+	start, end, err := parseByteRange(rangeHeader, resp.ContentLength)
+	if err != nil {
+		// Malformed or multiple ranges are ignored
+		return nil
+	}
+
+	if start < 0 {
+		resp.Body.Close()
+		resp.StatusCode = http.StatusRequestedRangeNotSatisfiable
+		resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", resp.ContentLength))
+		resp.Header.Del("Content-Type")
+		resp.Header.Set("Content-Length", "0")
+		resp.ContentLength = 0
+		resp.Body = http.NoBody
+		return nil
+	}
+
+	if _, err := io.CopyN(io.Discard, resp.Body, start); err != nil {
+		return fmt.Errorf("failed to skip to the requested range: %w", err)
+	}
+
+	length := end - start + 1
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, length), resp.Body}
+
+	resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, resp.ContentLength))
+	resp.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+	resp.ContentLength = length
+	resp.StatusCode = http.StatusPartialContent
+	resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+
+	return nil
+}
+
+// parseByteRange parses a Range header with a single byte range (e.g. bytes=100-199, bytes=100-, bytes=-100) for a response of the given size and returns its inclusive bounds. Negative bounds are returned for unsatisfiable ranges, an error - for malformed or multiple ranges.
+func parseByteRange(header string, size int64) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, fmt.Errorf("unsupported range: %s", header)
+	}
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok || (first == "" && last == "") {
+		return 0, 0, fmt.Errorf("malformed range: %s", header)
+	}
+
+	// Suffix range: the last N bytes
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("malformed range: %s", header)
+		}
+		if n == 0 || size == 0 {
+			return -1, -1, nil
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("malformed range: %s", header)
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, fmt.Errorf("malformed range: %s", header)
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return -1, -1, nil
+	}
+
+	return start, end, nil
+}
@@ -0,0 +1,136 @@
+package lfgw
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_applyExportRange(t *testing.T) {
+	export := `{"metric":{"__name__":"up","namespace":"a"},"values":[1],"timestamps":[1700000000000]}` + "\n"
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		// The upstream ignores ranges, as VictoriaMetrics does for exports
+		_, _ = w.Write([]byte(export))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, err := url.Parse(upstream.URL + "/select/0/prometheus")
+	assert.Nil(t, err)
+
+	app := application{UpstreamURL: upstreamURL}
+	proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+	proxy.ModifyResponse = app.modifyResponse
+
+	size := len(export)
+
+	tests := []struct {
+		name             string
+		path             string
+		headers          map[string]string
+		wantStatus       int
+		wantBody         string
+		wantContentRange string
+	}{
+		{
+			name:       "No range",
+			path:       "/api/v1/export",
+			wantStatus: http.StatusOK,
+			wantBody:   export,
+		},
+		{
+			name:             "Resumed download",
+			path:             "/api/v1/export",
+			headers:          map[string]string{"Range": "bytes=10-"},
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         export[10:],
+			wantContentRange: fmt.Sprintf("bytes 10-%d/%d", size-1, size),
+		},
+		{
+			name:             "Bounded range",
+			path:             "/api/v1/export/csv",
+			headers:          map[string]string{"Range": "bytes=0-9", "If-Range": `"v1"`},
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         export[:10],
+			wantContentRange: fmt.Sprintf("bytes 0-9/%d", size),
+		},
+		{
+			name:             "Suffix range",
+			path:             "/api/v1/export",
+			headers:          map[string]string{"Range": "bytes=-5"},
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         export[size-5:],
+			wantContentRange: fmt.Sprintf("bytes %d-%d/%d", size-5, size-1, size),
+		},
+		{
+			name:       "Changed representation",
+			path:       "/api/v1/export",
+			headers:    map[string]string{"Range": "bytes=10-", "If-Range": `"v0"`},
+			wantStatus: http.StatusOK,
+			wantBody:   export,
+		},
+		{
+			name:       "Multiple ranges are ignored",
+			path:       "/api/v1/export",
+			headers:    map[string]string{"Range": "bytes=0-1,5-6"},
+			wantStatus: http.StatusOK,
+			wantBody:   export,
+		},
+		{
+			name:             "Unsatisfiable range",
+			path:             "/api/v1/export",
+			headers:          map[string]string{"Range": "bytes=10000-"},
+			wantStatus:       http.StatusRequestedRangeNotSatisfiable,
+			wantContentRange: fmt.Sprintf("bytes */%d", size),
+		},
+		{
+			name:       "Not an export",
+			path:       "/api/v1/query",
+			headers:    map[string]string{"Range": "bytes=10-"},
+			wantStatus: http.StatusOK,
+			wantBody:   export,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for header, value := range tt.headers {
+				r.Header.Set(header, value)
+			}
+
+			rr := httptest.NewRecorder()
+			proxy.ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantBody, rr.Body.String())
+			assert.Equal(t, tt.wantContentRange, rr.Header().Get("Content-Range"))
+		})
+	}
+}
+
+func Test_parseByteRange(t *testing.T) {
+	start, end, err := parseByteRange("bytes=5-100", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{5, 9}, []int64{start, end})
+
+	start, end, err = parseByteRange("bytes=-100", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0, 9}, []int64{start, end})
+
+	start, _, err = parseByteRange("bytes=10-", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), start)
+
+	for _, header := range []string{"items=0-1", "bytes=5-1", "bytes=-", "bytes=a-1", "bytes=0-1,2-3"} {
+		_, _, err := parseByteRange(header, 10)
+		assert.NotNil(t, err, header)
+	}
+}
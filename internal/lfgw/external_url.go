@@ -0,0 +1,47 @@
+package lfgw
+
+import (
+	"net/http"
+	"strings"
+)
+
+// routePrefixMiddleware strips app.RoutePrefix from requests, so lfgw can be mounted under a path (e.g. /metrics-gw/) behind an ingress that doesn't rewrite paths. Requests outside of the prefix (e.g. kubelet probes sent to the pod directly) are served as is.
+func (app *application) routePrefixMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.RoutePrefix == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		path := r.URL.Path
+		if path == app.RoutePrefix || strings.HasPrefix(path, app.RoutePrefix+"/") {
+			path = strings.TrimPrefix(path, app.RoutePrefix)
+			if path == "" {
+				path = "/"
+			}
+
+			r.URL.Path = path
+			r.URL.RawPath = ""
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// externalURLFor returns the URL clients should use to reach the path served by lfgw: the path is prefixed with app.RoutePrefix and, if app.ExternalURL is set, made absolute.
+func (app *application) externalURLFor(path string) string {
+	path = app.RoutePrefix + path
+
+	if app.ExternalURL == nil {
+		return path
+	}
+
+	return app.ExternalURL.Scheme + "://" + app.ExternalURL.Host + path
+}
+
+// rewriteExternalLocation turns a root-relative Location header into the external URL of lfgw.
+func (app *application) rewriteExternalLocation(resp *http.Response) {
+	if location := resp.Header.Get("Location"); isRootRelative(location) {
+		resp.Header.Set("Location", app.externalURLFor(location))
+	}
+}
@@ -0,0 +1,150 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_routePrefixMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		path   string
+		want   string
+	}{
+		{
+			name:   "disabled",
+			prefix: "",
+			path:   "/metrics-gw/api/v1/query",
+			want:   "/metrics-gw/api/v1/query",
+		},
+		{
+			name:   "prefix is stripped",
+			prefix: "/metrics-gw",
+			path:   "/metrics-gw/api/v1/query",
+			want:   "/api/v1/query",
+		},
+		{
+			name:   "prefix itself",
+			prefix: "/metrics-gw",
+			path:   "/metrics-gw",
+			want:   "/",
+		},
+		{
+			name:   "paths outside of prefix are intact",
+			prefix: "/metrics-gw",
+			path:   "/healthz",
+			want:   "/healthz",
+		},
+		{
+			name:   "similar paths are intact",
+			prefix: "/metrics-gw",
+			path:   "/metrics-gwx/api/v1/query",
+			want:   "/metrics-gwx/api/v1/query",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := application{
+				RoutePrefix: tt.prefix,
+			}
+
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.URL.Path
+			})
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			app.routePrefixMiddleware(next).ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApp_externalLocation(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/vmui/", http.StatusMovedPermanently)
+	}))
+	defer upstream.Close()
+
+	upstreamURL, err := url.Parse(upstream.URL)
+	assert.Nil(t, err)
+
+	externalURL, err := url.Parse("https://example.com/metrics-gw/")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name string
+		app  application
+		path string
+		want string
+	}{
+		{
+			name: "no external URL",
+			app:  application{},
+			path: "/vmui",
+			want: "/vmui/",
+		},
+		{
+			name: "route prefix",
+			app: application{
+				RoutePrefix: "/metrics-gw",
+			},
+			path: "/metrics-gw/vmui",
+			want: "/metrics-gw/vmui/",
+		},
+		{
+			name: "external URL",
+			app: application{
+				ExternalURL: externalURL,
+				RoutePrefix: "/metrics-gw",
+			},
+			path: "/metrics-gw/vmui",
+			want: "https://example.com/metrics-gw/vmui/",
+		},
+		{
+			name: "external URL with UI prefix",
+			app: application{
+				ExternalURL:  externalURL,
+				RoutePrefix:  "/metrics-gw",
+				UIPathPrefix: "/ui",
+			},
+			path: "/metrics-gw/ui/vmui",
+			want: "https://example.com/metrics-gw/ui/vmui/",
+		},
+		{
+			name: "redirect to UI home",
+			app: application{
+				ExternalURL:  externalURL,
+				RoutePrefix:  "/metrics-gw",
+				UIPathPrefix: "/ui",
+				UIHomePath:   "/vmui/",
+			},
+			path: "/metrics-gw/ui/",
+			want: "https://example.com/metrics-gw/ui/vmui/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := tt.app
+			app.UpstreamURL = upstreamURL
+
+			proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+			proxy.ModifyResponse = app.modifyResponse
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			app.routePrefixMiddleware(app.uiPrefixMiddleware(proxy)).ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.want, rr.Header().Get("Location"))
+		})
+	}
+}
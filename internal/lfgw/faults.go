@@ -0,0 +1,222 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+)
+
+const contextKeyRoles = contextKey("roles")
+
+// maxFaultRulesSize limits the size of fault rules accepted through the admin endpoint
+const maxFaultRulesSize = 1 << 20
+
+var (
+	faultLatencyInjections = metrics.NewCounter(`fault_injections_total{type="latency"}`)
+	faultErrorInjections   = metrics.NewCounter(`fault_injections_total{type="error"}`)
+)
+
+// faultInjector keeps the fault rules set through /admin/faults
+type faultInjector struct {
+	mu    sync.RWMutex
+	rules []faultRule
+}
+
+// faultRule describes a fault to inject into matching requests. A rule without roles matches any role, a rule without paths matches any path (paths are prefixes). Latency is added before the request is proxied, then the request fails with Status (503 by default) with the probability of ErrorRate.
+type faultRule struct {
+	Roles     []string `json:"roles,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+	Latency   string   `json:"latency,omitempty"`
+	ErrorRate float64  `json:"error_rate,omitempty"`
+	Status    int      `json:"status,omitempty"`
+	latency   time.Duration
+}
+
+// matches returns true if the rule applies to a request to the path made with the roles.
+func (fr faultRule) matches(path string, roles []string) bool {
+	if len(fr.Roles) > 0 && !slices.ContainsFunc(roles, func(role string) bool { return slices.Contains(fr.Roles, role) }) {
+		return false
+	}
+
+	if len(fr.Paths) > 0 && !slices.ContainsFunc(fr.Paths, func(prefix string) bool { return strings.HasPrefix(path, prefix) }) {
+		return false
+	}
+
+	return true
+}
+
+// parseFaultRules parses and validates fault rules.
+func parseFaultRules(data []byte) ([]faultRule, error) {
+	var rules []faultRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse fault rules: %w", err)
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+
+		if rule.Latency != "" {
+			latency, err := time.ParseDuration(rule.Latency)
+			if err != nil || latency < 0 {
+				return nil, fmt.Errorf("rule %d contains invalid latency: %q", i, rule.Latency)
+			}
+			rule.latency = latency
+		}
+
+		if rule.ErrorRate < 0 || rule.ErrorRate > 1 {
+			return nil, fmt.Errorf("rule %d contains error_rate outside of [0, 1]: %v", i, rule.ErrorRate)
+		}
+
+		if rule.Status == 0 {
+			rule.Status = http.StatusServiceUnavailable
+		}
+		if rule.Status < 400 || rule.Status > 599 {
+			return nil, fmt.Errorf("rule %d contains status that is not an error: %d", i, rule.Status)
+		}
+	}
+
+	return rules, nil
+}
+
+// matching returns the first fault rule applying to the request.
+func (fi *faultInjector) matching(path string, roles []string) (faultRule, bool) {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+
+	for _, rule := range fi.rules {
+		if rule.matches(path, roles) {
+			return rule, true
+		}
+	}
+
+	return faultRule{}, false
+}
+
+// getRules returns current fault rules.
+func (fi *faultInjector) getRules() []faultRule {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+
+	return fi.rules
+}
+
+// setRules replaces fault rules, nil removes all of them.
+func (fi *faultInjector) setRules(rules []faultRule) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	fi.rules = rules
+}
+
+// configureFaultInjection sets up fault rules if app.FaultInjection is enabled.
+func (app *application) configureFaultInjection() {
+	app.faults = nil
+	if app.FaultInjection {
+		app.faults = &faultInjector{}
+	}
+}
+
+// faultInjectionMiddleware injects latency and errors into requests matching fault rules set through /admin/faults, so resilience of clients (e.g. Grafana retries, alerting) against gateway degradation can be verified. It has no effect unless app.FaultInjection is enabled.
+func (app *application) faultInjectionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.faults == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		roles, _ := r.Context().Value(contextKeyRoles).([]string)
+		rule, ok := app.faults.matching(r.URL.Path, roles)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if rule.latency > 0 {
+			faultLatencyInjections.Inc()
+			app.enrichDebugLogContext(r, "fault_latency", rule.latency.String())
+
+			select {
+			case <-time.After(rule.latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		//#nosec G404 -- not used for security purposes
+		if rule.ErrorRate > 0 && rand.Float64() < rule.ErrorRate {
+			faultErrorInjections.Inc()
+			hlog.FromRequest(r).Warn().Caller().
+				Msgf("Injected fault: %d", rule.Status)
+			http.Error(w, "Injected fault", rule.Status)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// faultsHandler manages fault rules, it requires an admin token: GET returns current rules, PUT replaces them with a JSON list from the body, DELETE removes all rules.
+func (app *application) faultsHandler(w http.ResponseWriter, r *http.Request) {
+	if app.faults == nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	if !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rules := app.faults.getRules()
+		if rules == nil {
+			rules = []faultRule{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rules); err != nil {
+			app.serverError(w, r, err)
+		}
+	case http.MethodPut:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFaultRulesSize))
+		if err != nil {
+			app.clientErrorMessage(w, http.StatusBadRequest, err)
+			return
+		}
+
+		rules, err := parseFaultRules(data)
+		if err != nil {
+			app.clientErrorMessage(w, http.StatusBadRequest, err)
+			return
+		}
+
+		app.faults.setRules(rules)
+
+		app.logger.Warn().Caller().
+			Msgf("Fault rules set: %s", data)
+
+		app.propagateToPeers(w, r, data)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		app.faults.setRules(nil)
+
+		app.logger.Warn().Caller().
+			Msg("Fault rules removed")
+
+		app.propagateToPeers(w, r, nil)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut, http.MethodDelete}, ", "))
+		app.clientError(w, http.StatusMethodNotAllowed)
+	}
+}
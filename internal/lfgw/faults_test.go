@@ -0,0 +1,86 @@
+package lfgw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_faultInjection(t *testing.T) {
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:         &logger,
+		AdminToken:     "secret",
+		FaultInjection: true,
+	}
+	app.configureFaultInjection()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := app.nonProxiedEndpointsMiddleware(app.faultInjectionMiddleware(next))
+
+	request := func(method, path, authorization, body string, roles ...string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", authorization)
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyRoles, roles))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+
+		return rr
+	}
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodPut, "/admin/faults", "", "[]").Code)
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/admin/faults", "Bearer random", "").Code)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/admin/faults", "Bearer secret", `[{"error_rate": 2}]`).Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/admin/faults", "Bearer secret", `[{"latency": "soon"}]`).Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/admin/faults", "Bearer secret", `[{"status": 200}]`).Code)
+		assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/admin/faults", "Bearer secret", `{}`).Code)
+	})
+
+	t.Run("Errors for matching roles and paths", func(t *testing.T) {
+		rules := `[{"roles": ["team-a"], "paths": ["/api/v1/query_range"], "error_rate": 1, "status": 502}]`
+		assert.Equal(t, http.StatusNoContent, request(http.MethodPut, "/admin/faults", "Bearer secret", rules).Code)
+
+		assert.Equal(t, http.StatusBadGateway, request(http.MethodGet, "/api/v1/query_range", "", "", "team-a").Code)
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/v1/query_range", "", "", "team-b").Code)
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/v1/query", "", "", "team-a").Code)
+
+		rr := request(http.MethodGet, "/admin/faults", "Bearer secret", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `[{"roles": ["team-a"], "paths": ["/api/v1/query_range"], "error_rate": 1, "status": 502}]`, rr.Body.String())
+	})
+
+	t.Run("Latency", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, request(http.MethodPut, "/admin/faults", "Bearer secret", `[{"latency": "50ms"}]`).Code)
+
+		start := time.Now()
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/v1/query", "", "", "team-b").Code)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("Rules removed", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, "/admin/faults", "Bearer secret", "").Code)
+		assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/v1/query_range", "", "", "team-a").Code)
+		assert.Equal(t, "[]\n", request(http.MethodGet, "/admin/faults", "Bearer secret", "").Body.String())
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		app.FaultInjection = false
+		app.configureFaultInjection()
+		assert.Equal(t, http.StatusNotFound, request(http.MethodPut, "/admin/faults", "Bearer secret", `[{"error_rate": 1}]`).Code)
+	})
+}
@@ -0,0 +1,107 @@
+package lfgw
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	// featureStrictACLs turns deprecation warnings of ACL files into errors, so outdated definitions are rejected on load and reload
+	featureStrictACLs = "strict-acls"
+)
+
+// featureFlag describes a behavior that is rolled out incrementally. Flags that are enabled by default can be disabled with a - prefix (e.g. -name) until they're removed.
+type featureFlag struct {
+	Description string
+	Default     bool
+}
+
+// featureFlags lists all known feature flags.
+var featureFlags = map[string]featureFlag{
+	featureStrictACLs: {
+		Description: "treat deprecation warnings of ACL files as errors",
+		Default:     false,
+	},
+}
+
+var deprecationWarningsTotal = metrics.NewCounter("deprecation_warnings_total")
+
+// configureFeatureFlags resolves app.FeatureFlags against the defaults. Unknown flags are only logged, so the configuration can outlive flags that are removed once their behavior becomes permanent.
+func (app *application) configureFeatureFlags() {
+	app.features = make(map[string]bool, len(featureFlags))
+	for name, flag := range featureFlags {
+		app.features[name] = flag.Default
+	}
+
+	for _, raw := range app.FeatureFlags {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		name, disabled := strings.CutPrefix(raw, "-")
+		if _, known := featureFlags[name]; !known {
+			app.logger.Warn().Caller().
+				Str("feature_flag", name).Msg("Unknown feature flag is ignored")
+			continue
+		}
+
+		app.features[name] = !disabled
+	}
+
+	names := make([]string, 0, len(app.features))
+	for name := range app.features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var enabled []string
+	for _, name := range names {
+		value := 0.0
+		if app.features[name] {
+			value = 1
+			enabled = append(enabled, name)
+		}
+		metrics.GetOrCreateFloatCounter(fmt.Sprintf(`feature_flag_enabled{flag=%q}`, name)).Set(value)
+	}
+
+	app.logger.Info().Caller().
+		Strs("enabled_feature_flags", enabled).Msg("Feature flags are configured")
+}
+
+// featureEnabled returns true if the feature flag is enabled (falls back to the default if flags are not configured). Every time an enabled flag is checked, feature_flag_used_total is increased, so it's visible whether the new behavior is actually exercised.
+func (app *application) featureEnabled(name string) bool {
+	enabled, ok := app.features[name]
+	if !ok {
+		enabled = featureFlags[name].Default
+	}
+
+	if enabled {
+		metrics.GetOrCreateCounter(fmt.Sprintf(`feature_flag_used_total{flag=%q}`, name)).Inc()
+	}
+
+	return enabled
+}
+
+// handleDeprecations logs deprecation warnings of a source (e.g. an ACL file) in a structured way. With strict-acls, the warnings are returned as an error instead, so the caller can reject the content.
+func (app *application) handleDeprecations(source string, warnings []string) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+
+	deprecationWarningsTotal.Add(len(warnings))
+
+	if app.featureEnabled(featureStrictACLs) {
+		return fmt.Errorf("%s uses deprecated settings (%s is on): %s", source, featureStrictACLs, strings.Join(warnings, "; "))
+	}
+
+	for _, warning := range warnings {
+		app.logger.Warn().Caller().
+			Str("source", source).Bool("deprecated", true).Msg(warning)
+	}
+
+	return nil
+}
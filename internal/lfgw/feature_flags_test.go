@@ -0,0 +1,83 @@
+package lfgw
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_configureFeatureFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags []string
+		want  bool
+	}{
+		{
+			name: "Default",
+			want: false,
+		},
+		{
+			name:  "Enabled",
+			flags: []string{" strict-acls "},
+			want:  true,
+		},
+		{
+			name:  "Disabled",
+			flags: []string{"strict-acls", "-strict-acls"},
+			want:  false,
+		},
+		{
+			name:  "Unknown flags are ignored",
+			flags: []string{"unknown", "strict-acls"},
+			want:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.New(nil)
+			app := &application{
+				logger:       &logger,
+				FeatureFlags: tt.flags,
+			}
+
+			app.configureFeatureFlags()
+			assert.Equal(t, tt.want, app.featureEnabled(featureStrictACLs))
+			assert.NotContains(t, app.features, "unknown")
+		})
+	}
+}
+
+func TestApp_handleDeprecations(t *testing.T) {
+	logger := zerolog.New(nil)
+	warnings := []string{"acl.yaml uses the deprecated flat format (version 1)"}
+
+	t.Run("Warnings are logged", func(t *testing.T) {
+		app := &application{
+			logger: &logger,
+		}
+
+		assert.Nil(t, app.handleDeprecations("acl.yaml", warnings))
+		assert.Nil(t, app.handleDeprecations("acl.yaml", nil))
+	})
+
+	t.Run("Warnings are errors with strict-acls", func(t *testing.T) {
+		app := &application{
+			logger:       &logger,
+			FeatureFlags: []string{featureStrictACLs},
+		}
+		app.configureFeatureFlags()
+
+		used := metrics.GetOrCreateCounter(`feature_flag_used_total{flag="strict-acls"}`)
+		before := used.Get()
+
+		err := app.handleDeprecations("acl.yaml", warnings)
+		assert.ErrorContains(t, err, "deprecated flat format")
+		assert.Equal(t, before+1, used.Get())
+
+		assert.Nil(t, app.handleDeprecations("acl.yaml", nil))
+	})
+}
@@ -0,0 +1,80 @@
+package lfgw
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// modifyResponse processes upstream responses before they're returned to clients.
+func (app *application) modifyResponse(resp *http.Response) error {
+	if err := app.rewriteLocationHeader(resp); err != nil {
+		return err
+	}
+
+	if err := app.validateUpstreamResponse(resp); err != nil {
+		return err
+	}
+
+	if err := app.rewriteUIResponse(resp); err != nil {
+		return err
+	}
+
+	if err := app.applyExportRange(resp); err != nil {
+		return err
+	}
+
+	if err := app.applyErrorMessage(resp); err != nil {
+		return err
+	}
+
+	app.rewriteExternalLocation(resp)
+	app.scrubResponseHeaders(resp)
+
+	// Compressed last, so the other modifications can inspect the body
+	return app.compressResponse(resp)
+}
+
+// scrubResponseHeaders removes headers revealing details of the upstream (app.ScrubResponseHeaders) along with security and request ID headers set by lfgw, so the latter are not duplicated.
+func (app *application) scrubResponseHeaders(resp *http.Response) {
+	for _, header := range app.ScrubResponseHeaders {
+		resp.Header.Del(header)
+	}
+
+	for header := range app.securityHeaders(resp.Request) {
+		resp.Header.Del(header)
+	}
+
+	if app.RequestIDHeader != "" {
+		resp.Header.Del(app.RequestIDHeader)
+	}
+}
+
+// securityHeaders returns security headers to set on a response to the request. Content-Security-Policy is set only for non-API requests (e.g. vmui), since it's meaningless for API responses.
+func (app *application) securityHeaders(r *http.Request) map[string]string {
+	headers := make(map[string]string)
+
+	if app.HSTSMaxAge > 0 {
+		headers["Strict-Transport-Security"] = fmt.Sprintf("max-age=%d", int(app.HSTSMaxAge.Seconds()))
+	}
+
+	if app.ContentTypeNosniff {
+		headers["X-Content-Type-Options"] = "nosniff"
+	}
+
+	if app.ContentSecurityPolicy != "" && r != nil && app.isNotAPIRequest(r.URL.Path) {
+		headers["Content-Security-Policy"] = app.ContentSecurityPolicy
+	}
+
+	return headers
+}
+
+// securityHeadersMiddleware sets security headers on all responses, including the ones generated by lfgw itself.
+func (app *application) securityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for header, value := range app.securityHeaders(r) {
+			w.Header().Set(header, value)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,96 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_responseHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "prometheus/2.45.0")
+		w.Header().Set("X-Powered-By", "Go")
+		w.Header().Set("Strict-Transport-Security", "max-age=1")
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, err := url.Parse(upstream.URL)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name string
+		app  application
+		path string
+		want http.Header
+	}{
+		{
+			name: "defaults",
+			app: application{
+				ScrubResponseHeaders: []string{"Server", "X-Powered-By"},
+			},
+			path: "/vmui/",
+			want: http.Header{
+				"Content-Type":              {"text/html"},
+				"Strict-Transport-Security": {"max-age=1"},
+			},
+		},
+		{
+			name: "security headers for UI",
+			app: application{
+				ScrubResponseHeaders:  []string{"Server", "X-Powered-By"},
+				HSTSMaxAge:            24 * time.Hour,
+				ContentTypeNosniff:    true,
+				ContentSecurityPolicy: "default-src 'self'",
+			},
+			path: "/vmui/",
+			want: http.Header{
+				"Content-Type":              {"text/html"},
+				"Strict-Transport-Security": {"max-age=86400"},
+				"X-Content-Type-Options":    {"nosniff"},
+				"Content-Security-Policy":   {"default-src 'self'"},
+			},
+		},
+		{
+			name: "no CSP for API",
+			app: application{
+				HSTSMaxAge:            24 * time.Hour,
+				ContentSecurityPolicy: "default-src 'self'",
+			},
+			path: "/api/v1/query",
+			want: http.Header{
+				"Content-Type":              {"text/html"},
+				"Server":                    {"prometheus/2.45.0"},
+				"X-Powered-By":              {"Go"},
+				"Strict-Transport-Security": {"max-age=86400"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := tt.app
+			app.UpstreamURL = upstreamURL
+
+			proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+			proxy.ModifyResponse = app.modifyResponse
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			app.securityHeadersMiddleware(proxy).ServeHTTP(rr, r)
+
+			got := rr.Header().Clone()
+			// Set by the test server, not interesting here
+			got.Del("Date")
+			got.Del("Content-Length")
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// deepHealthcheckQuery is a trivial query used for deep health checks, it's rewritten according to a randomly selected role.
+const deepHealthcheckQuery = "up"
+
+// healthzHandler reports liveness. It doesn't depend on the upstream, so a failing upstream doesn't get instances restarted.
+func (app *application) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("OK"))
+}
+
+// deepHealthcheckHandler verifies that a query rewritten according to a randomly selected role succeeds in the upstream. It returns false after responding with 503 if it doesn't.
+func (app *application) deepHealthcheckHandler(w http.ResponseWriter, r *http.Request) bool {
+	role, err := app.deepHealthcheck(r.Context())
+	if err != nil {
+		hlog.FromRequest(r).Error().Caller().
+			Err(err).Msgf("Deep health check failed (role: %s)", role)
+		http.Error(w, fmt.Sprintf("Deep health check failed (role: %s): %s", role, err), http.StatusServiceUnavailable)
+		return false
+	}
+
+	return true
+}
+
+// upstreamTransport returns the transport used by the proxy (with SigV4 signing, upstream metrics, etc.), so requests made by lfgw itself reach the upstream the same way as proxied ones. It defaults to http.DefaultTransport until the proxy is set up.
+func (app *application) upstreamTransport() http.RoundTripper {
+	if app.proxy == nil || app.proxy.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return app.proxy.Transport
+}
+
+// deepHealthcheck sends deepHealthcheckQuery rewritten according to a randomly selected role to the upstream through the proxy transport and returns an error unless the upstream reports success. If there are no roles (e.g. only assumed roles are used), the query is sent unmodified.
+func (app *application) deepHealthcheck(ctx context.Context) (string, error) {
+	if app.UpstreamURL == nil {
+		return "", errUpstreamNotInitialized
+	}
+
+	acls := app.getACLs()
+
+	roles := make([]string, 0, len(acls))
+	for role, acl := range acls {
+		// Role patterns have no ACL on their own
+		if acl.RolePattern != nil {
+			continue
+		}
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	params := url.Values{}
+	params.Set("query", deepHealthcheckQuery)
+	rawQuery := params.Encode()
+
+	role := ""
+	if len(roles) > 0 {
+		//#nosec G404 -- no need for a cryptographically secure random number here
+		role = roles[rand.Intn(len(roles))]
+		acl := acls[role]
+
+		if !acl.Fullaccess {
+			qm := app.newQueryModifier(acl)
+
+			var err error
+			rawQuery, err = qm.GetModifiedEncodedURLValues(params)
+			if err != nil {
+				return role, err
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	u := *app.UpstreamURL
+	u.Path = strings.TrimRight(u.Path, "/") + "/api/v1/query"
+	u.RawQuery = rawQuery
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return role, err
+	}
+
+	resp, err := app.upstreamTransport().RoundTrip(req)
+	if err != nil {
+		return role, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return role, err
+	}
+
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || resp.StatusCode != http.StatusOK || result.Status != "success" {
+		return role, fmt.Errorf("upstream responded with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return role, nil
+}
@@ -0,0 +1,149 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// roundTripperFunc allows to use a function as an http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestApp_healthzHandler(t *testing.T) {
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:          &logger,
+		DeepHealthcheck: true,
+		ACLs:            querymodifier.ACLs{},
+	}
+
+	r, err := http.NewRequest(http.MethodGet, "/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	app.healthzHandler(rr, r)
+	rs := rr.Result()
+	defer rs.Body.Close()
+
+	assert.Equal(t, http.StatusOK, rs.StatusCode, "liveness must not depend on the upstream")
+}
+
+func TestApp_readyzHandler_deepHealthcheck(t *testing.T) {
+	// Upstream that fails for queries with the namespace label, as if rewrites produced invalid queries
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prometheus/api/v1/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.URL.Query().Get("query") {
+		case "up", `up{tenant="a"}`:
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"error","error":"unknown label"}`))
+		}
+	}))
+	defer upstream.Close()
+
+	upstreamURL, err := url.Parse(upstream.URL + "/prometheus/")
+	assert.Nil(t, err)
+
+	aclAdmin, err := querymodifier.NewACL(".*")
+	assert.Nil(t, err)
+
+	aclTenant, err := querymodifier.NewACLForLabel("tenant", "a")
+	assert.Nil(t, err)
+
+	aclNamespace, err := querymodifier.NewACL("minio")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name            string
+		deepHealthcheck bool
+		acls            querymodifier.ACLs
+		want            int
+	}{
+		{
+			name:            "Deep health check is off",
+			deepHealthcheck: false,
+			acls:            querymodifier.ACLs{"namespace": aclNamespace},
+			want:            http.StatusOK,
+		},
+		{
+			name:            "No roles",
+			deepHealthcheck: true,
+			acls:            querymodifier.ACLs{},
+			want:            http.StatusOK,
+		},
+		{
+			name:            "Full access role",
+			deepHealthcheck: true,
+			acls:            querymodifier.ACLs{"admin": aclAdmin},
+			want:            http.StatusOK,
+		},
+		{
+			name:            "Valid rewrite",
+			deepHealthcheck: true,
+			acls:            querymodifier.ACLs{"tenant": aclTenant},
+			want:            http.StatusOK,
+		},
+		{
+			name:            "Invalid rewrite",
+			deepHealthcheck: true,
+			acls:            querymodifier.ACLs{"namespace": aclNamespace},
+			want:            http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent atomic.Int32
+
+			logger := zerolog.New(nil)
+			app := &application{
+				acls:            &aclsState{},
+				logger:          &logger,
+				UpstreamURL:     upstreamURL,
+				DeepHealthcheck: tt.deepHealthcheck,
+				ACLs:            tt.acls,
+				proxy: &httputil.ReverseProxy{
+					Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+						sent.Add(1)
+						return http.DefaultTransport.RoundTrip(req)
+					}),
+				},
+			}
+
+			r, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			app.readyzHandler(rr, r)
+			rs := rr.Result()
+			defer rs.Body.Close()
+
+			assert.Equal(t, tt.want, rs.StatusCode)
+
+			if tt.deepHealthcheck {
+				assert.Equal(t, int32(1), sent.Load(), "the check must be sent through the proxy transport")
+			}
+		})
+	}
+}
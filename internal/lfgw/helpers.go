@@ -1,12 +1,18 @@
 package lfgw
 
 import (
+	"crypto/subtle"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strings"
 
+	"github.com/VictoriaMetrics/metrics"
 	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/querymodifier"
 )
 
 // serverError sends a generic 500 Internal Server Error response to the user.
@@ -56,16 +62,241 @@ func (app *application) getRawAccessToken(r *http.Request) (string, error) {
 	return "", errNoToken
 }
 
-// isNotAPIRequest returns true if the requested path does not target API or federate endpoints.
+// isAdminRequest returns true if the request carries a bearer token matching either the admin token or the secondary admin token (used during rotation). Always returns false if no admin token is configured.
+func (app *application) isAdminRequest(r *http.Request) bool {
+	if app.AdminToken == "" {
+		return false
+	}
+
+	t, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+
+	return matchesSecret(t, app.currentSecret("ADMIN_TOKEN", app.AdminToken), app.currentSecret("SECONDARY_ADMIN_TOKEN", app.SecondaryAdminToken))
+}
+
+// matchesSecret returns true if value matches any of the non-empty secrets. All secrets are compared in constant time, so it's not possible to tell which one is active.
+func matchesSecret(value string, secrets ...string) bool {
+	matched := 0
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		matched |= subtle.ConstantTimeCompare([]byte(value), []byte(secret))
+	}
+
+	return matched == 1
+}
+
+// getClientIP returns the IP address of the client. If app.SourceIPHeader is set, the rightmost address from the header is taken (the one added by the closest trusted proxy), otherwise r.RemoteAddr is used.
+func (app *application) getClientIP(r *http.Request) (netip.Addr, error) {
+	raw := r.RemoteAddr
+
+	if app.SourceIPHeader != "" {
+		if v := r.Header.Get(app.SourceIPHeader); v != "" {
+			values := strings.Split(v, ",")
+			raw = strings.TrimSpace(values[len(values)-1])
+		}
+	}
+
+	if addrPort, err := netip.ParseAddrPort(raw); err == nil {
+		return addrPort.Addr().Unmap(), nil
+	}
+
+	addr, err := netip.ParseAddr(raw)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to parse client IP %q: %s", raw, err)
+	}
+
+	return addr.Unmap(), nil
+}
+
+// filterRolesBySourceIP drops known roles that are not allowed to be used from the client IP address. An error is returned if the user is left without any usable roles because of the source restrictions.
+func (app *application) filterRolesBySourceIP(r *http.Request, roles []string) ([]string, error) {
+	var clientIP netip.Addr
+
+	allowed := make([]string, 0, len(roles))
+	denied := []string{}
+	knownAllowed := 0
+
+	acls := app.getACLs().ForRoles(roles)
+
+	for _, role := range roles {
+		acl, exists := acls[role]
+		if !exists {
+			allowed = append(allowed, role)
+			continue
+		}
+
+		if len(acl.SourceCIDRs) == 0 {
+			allowed = append(allowed, role)
+			knownAllowed++
+			continue
+		}
+
+		// The address is resolved only when it's actually needed
+		if !clientIP.IsValid() {
+			var err error
+			clientIP, err = app.getClientIP(r)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", errSourceIPNotAllowed, err)
+			}
+		}
+
+		if acl.IsAllowedFrom(clientIP) {
+			allowed = append(allowed, role)
+			knownAllowed++
+			continue
+		}
+
+		denied = append(denied, role)
+		metrics.GetOrCreateCounter(fmt.Sprintf(`source_ip_denials_total{role=%q}`, role)).Inc()
+	}
+
+	if len(denied) == 0 {
+		return allowed, nil
+	}
+
+	hlog.FromRequest(r).Debug().Caller().
+		Msgf("Roles %s are not allowed from %s, skipping them", strings.Join(denied, ", "), clientIP)
+
+	// Unknown roles might still give access in assumed roles mode
+	if knownAllowed == 0 && (!app.AssumedRolesEnabled || len(allowed) == 0) {
+		return nil, fmt.Errorf("%w: %s (client IP: %s)", errSourceIPNotAllowed, strings.Join(denied, ", "), clientIP)
+	}
+
+	return allowed, nil
+}
+
+// getUserACL returns an ACL for the roles. If assumed roles are restricted (ASSUMED_ROLES_PREFIX, ASSUMED_ROLES_PATTERN), unknown roles are assumed only if they match the restriction.
+func (app *application) getUserACL(roles []string) (querymodifier.ACL, error) {
+	return app.getUserACLWithAssumedRoles(roles, app.AssumedRolesEnabled)
+}
+
+// getUserACLWithAssumedRoles is the same as getUserACL, but whether unknown roles are assumed is set by assumedRolesEnabled instead of app.AssumedRolesEnabled (e.g. for ACL simulations).
+func (app *application) getUserACLWithAssumedRoles(roles []string, assumedRolesEnabled bool) (querymodifier.ACL, error) {
+	acls := app.getACLs()
+	if !assumedRolesEnabled || !app.assumedRoles.IsRestricted() {
+		return acls.GetUserACL(roles, assumedRolesEnabled, app.EnforcedLabel)
+	}
+
+	acls, err := acls.WithAssumedRoles(roles, app.assumedRoles, app.EnforcedLabel)
+	if err != nil {
+		return querymodifier.ACL{}, err
+	}
+
+	return acls.GetUserACL(roles, false, app.EnforcedLabel)
+}
+
+// Values of NonAPIPathsPolicy, anything else is treated as nonAPIPathsPolicyPass.
+const (
+	nonAPIPathsPolicyPass       = "pass"
+	nonAPIPathsPolicyBlock      = "block"
+	nonAPIPathsPolicyFullaccess = "fullaccess"
+)
+
+// isNotAPIRequest returns true if the requested path does not start with any of APIPathPrefixes or, if they are not set, does not target API or federate endpoints.
 func (app *application) isNotAPIRequest(path string) bool {
+	if len(app.APIPathPrefixes) > 0 {
+		for _, prefix := range app.APIPathPrefixes {
+			if strings.HasPrefix(path, prefix) {
+				return false
+			}
+		}
+		return true
+	}
+
 	return !strings.Contains(path, "/api/") && !strings.Contains(path, "/federate")
 }
 
-// isUnsafePath returns true if the requested path targets a potentially dangerous endpoint (admin or remote write).
+// isNonAPIRequestAllowed returns true if a request to a non-API path can be proxied according to NonAPIPathsPolicy.
+func (app *application) isNonAPIRequestAllowed(acl querymodifier.ACL) bool {
+	switch app.NonAPIPathsPolicy {
+	case nonAPIPathsPolicyBlock:
+		return false
+	case nonAPIPathsPolicyFullaccess:
+		return acl.Fullaccess
+	default:
+		return true
+	}
+}
+
+// hasFormBody returns true if r.ParseForm() reads form data from the body of requests with the given method (PATCH, POST, and PUT). Other methods (e.g. GET, HEAD) are rewritten through GET params only.
+func (app *application) hasFormBody(method string) bool {
+	return method == http.MethodPatch || method == http.MethodPost || method == http.MethodPut
+}
+
+// isFormEncoded returns true if the request body is of application/x-www-form-urlencoded type.
+func (app *application) isFormEncoded(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+// checkParamLimits returns an error if params exceed MaxParams (values are counted separately) or any of the values is longer than MaxParamLength. Zero limits are not enforced.
+func (app *application) checkParamLimits(params url.Values) error {
+	count := 0
+
+	for name, values := range params {
+		count += len(values)
+		if app.MaxParams > 0 && count > app.MaxParams {
+			return fmt.Errorf("%w: more than %d", errTooManyParams, app.MaxParams)
+		}
+
+		for _, v := range values {
+			if app.MaxParamLength > 0 && len(v) > app.MaxParamLength {
+				return fmt.Errorf("%w: %s is longer than %d bytes", errParamTooLong, name, app.MaxParamLength)
+			}
+		}
+	}
+
+	return nil
+}
+
+// labelFiltersString returns all label filters of the ACL as a comma-separated string. Label filter pairs are shown as a group of alternatives, e.g. (cluster="a", namespace="b" or cluster="c", namespace="d").
+func (app *application) labelFiltersString(acl querymodifier.ACL) string {
+	buf := acl.LabelFilter.AppendString(nil)
+
+	for i, pair := range acl.LabelFilterPairs {
+		if i == 0 {
+			buf = append(buf, ", ("...)
+		} else {
+			buf = append(buf, " or "...)
+		}
+
+		for j, lf := range pair {
+			if j > 0 {
+				buf = append(buf, ", "...)
+			}
+			buf = lf.AppendString(buf)
+		}
+
+		if i == len(acl.LabelFilterPairs)-1 {
+			buf = append(buf, ')')
+		}
+	}
+
+	if acl.RawDenyACL != "" {
+		buf = append(buf, ", "...)
+		buf = acl.DenyLabelFilter.AppendString(buf)
+	}
+
+	for _, lf := range acl.ExtraLabelFilters {
+		buf = append(buf, ", "...)
+		buf = lf.AppendString(buf)
+	}
+
+	return string(buf)
+}
+
+// isUnsafePath returns true if the requested path targets a potentially dangerous endpoint (admin, snapshots, remote write or import).
 func (app *application) isUnsafePath(path string) bool {
 	// TODO: move to regexp?
-	// TODO: more unsafe paths?
-	return strings.Contains(path, "/admin/tsdb") || strings.Contains(path, "/api/v1/write")
+	return strings.Contains(path, "/admin/tsdb") || strings.Contains(path, "/api/v1/write") || strings.Contains(path, "/api/v1/import") || strings.Contains(path, "/snapshot/")
 }
 
 // unescapedURLQuery returns unescaped query string
@@ -78,3 +309,34 @@ func (app *application) unescapedURLQuery(s string) string {
 
 	return decoded
 }
+
+// applyForcedParams sets parameters forced by an ACL in GET params and drops them from a form body (if any), so users cannot override them in either place.
+func (app *application) applyForcedParams(r *http.Request, params map[string]string) error {
+	query := r.URL.Query()
+	for param, value := range params {
+		query.Set(param, value)
+	}
+	r.URL.RawQuery = query.Encode()
+
+	if !app.hasFormBody(r.Method) || !app.isFormEncoded(r) {
+		return nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+
+	for param := range params {
+		r.PostForm.Del(param)
+	}
+
+	newBody := strings.NewReader(r.PostForm.Encode())
+	r.ContentLength = newBody.Size()
+	r.Body = io.NopCloser(newBody)
+
+	// Workaround to make further r.ParseForm() calls update r.Form and r.PostForm again
+	r.Form = nil
+	r.PostForm = nil
+
+	return nil
+}
@@ -1,11 +1,17 @@
 package lfgw
 
 import (
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
 )
 
 func TestGetRawAccessToken(t *testing.T) {
@@ -116,6 +122,16 @@ func TestIsUnsafePath(t *testing.T) {
 			path: "/api/v1/write",
 			want: true,
 		},
+		{
+			name: "import",
+			path: "/api/v1/import/csv",
+			want: true,
+		},
+		{
+			name: "snapshot",
+			path: "/snapshot/create",
+			want: true,
+		},
 		{
 			name: "random endpoint",
 			path: "/api/v1/random",
@@ -140,9 +156,10 @@ func TestIsNotAPIRequest(t *testing.T) {
 	}
 
 	tests := []struct {
-		name string
-		path string
-		want bool
+		name     string
+		prefixes []string
+		path     string
+		want     bool
 	}{
 		{
 			name: "api",
@@ -159,10 +176,23 @@ func TestIsNotAPIRequest(t *testing.T) {
 			path: "/metrics",
 			want: true,
 		},
+		{
+			name:     "api prefix",
+			prefixes: []string{"/api/v1/", "/federate"},
+			path:     "/api/v1/query",
+			want:     false,
+		},
+		{
+			name:     "api path outside of prefixes",
+			prefixes: []string{"/api/v1/", "/federate"},
+			path:     "/prometheus/api/v1/query",
+			want:     true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			app.APIPathPrefixes = tt.prefixes
 			got := app.isNotAPIRequest(tt.path)
 			if got != tt.want {
 				t.Errorf("want %t; got %t", tt.want, got)
@@ -170,3 +200,461 @@ func TestIsNotAPIRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestIsNonAPIRequestAllowed(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		fullaccess bool
+		want       bool
+	}{
+		{
+			name: "default",
+			want: true,
+		},
+		{
+			name:   "pass",
+			policy: nonAPIPathsPolicyPass,
+			want:   true,
+		},
+		{
+			name:       "block",
+			policy:     nonAPIPathsPolicyBlock,
+			fullaccess: true,
+			want:       false,
+		},
+		{
+			name:       "fullaccess, full access",
+			policy:     nonAPIPathsPolicyFullaccess,
+			fullaccess: true,
+			want:       true,
+		},
+		{
+			name:   "fullaccess, restricted access",
+			policy: nonAPIPathsPolicyFullaccess,
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{NonAPIPathsPolicy: tt.policy}
+			got := app.isNonAPIRequestAllowed(querymodifier.ACL{Fullaccess: tt.fullaccess})
+			if got != tt.want {
+				t.Errorf("want %t; got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHasFormBody(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{method: http.MethodGet, want: false},
+		{method: http.MethodHead, want: false},
+		{method: http.MethodDelete, want: false},
+		{method: http.MethodOptions, want: false},
+		{method: http.MethodPost, want: true},
+		{method: http.MethodPut, want: true},
+		{method: http.MethodPatch, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			got := app.hasFormBody(tt.method)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIsFormEncoded(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		name        string
+		contentType string
+		want        bool
+	}{
+		{name: "Form", contentType: "application/x-www-form-urlencoded", want: true},
+		{name: "Form with charset", contentType: "application/x-www-form-urlencoded; charset=utf-8", want: true},
+		{name: "Protobuf", contentType: "application/x-protobuf", want: false},
+		{name: "Empty", contentType: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/query", nil)
+			r.Header.Set("Content-Type", tt.contentType)
+
+			assert.Equal(t, tt.want, app.isFormEncoded(r))
+		})
+	}
+}
+
+func TestApplyForcedParams(t *testing.T) {
+	app := &application{}
+	params := map[string]string{"deny_partial_response": "1"}
+
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        string
+		wantQuery   string
+		wantBody    string
+	}{
+		{
+			name:      "GET",
+			method:    http.MethodGet,
+			url:       "/api/v1/query?query=up&deny_partial_response=0",
+			wantQuery: "deny_partial_response=1&query=up",
+			wantBody:  "",
+		},
+		{
+			name:        "POST form",
+			method:      http.MethodPost,
+			url:         "/api/v1/query",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "query=up&deny_partial_response=0",
+			wantQuery:   "deny_partial_response=1",
+			wantBody:    "query=up",
+		},
+		{
+			name:        "POST without a form",
+			method:      http.MethodPost,
+			url:         "/api/v1/write",
+			contentType: "application/x-protobuf",
+			body:        "deny_partial_response=0",
+			wantQuery:   "deny_partial_response=1",
+			wantBody:    "deny_partial_response=0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			err := app.applyForcedParams(r, params)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantQuery, r.URL.RawQuery)
+
+			body, err := io.ReadAll(r.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
+
+func TestCheckParamLimits(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxParams      int
+		maxParamLength int
+		params         url.Values
+		wantErr        error
+	}{
+		{
+			name:   "No limits",
+			params: url.Values{"query": {strings.Repeat("a", 10000)}, "match[]": {"a", "b", "c"}},
+		},
+		{
+			name:           "Within limits",
+			maxParams:      4,
+			maxParamLength: 10,
+			params:         url.Values{"query": {"up"}, "match[]": {"a", "b", "c"}},
+		},
+		{
+			name:      "Too many params (values are counted separately)",
+			maxParams: 3,
+			params:    url.Values{"query": {"up"}, "match[]": {"a", "b", "c"}},
+			wantErr:   errTooManyParams,
+		},
+		{
+			name:           "Too long param",
+			maxParamLength: 10,
+			params:         url.Values{"query": {strings.Repeat("a", 11)}},
+			wantErr:        errParamTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{
+				MaxParams:      tt.maxParams,
+				MaxParamLength: tt.maxParamLength,
+			}
+
+			err := app.checkParamLimits(tt.params)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestLabelFiltersString(t *testing.T) {
+	app := &application{}
+
+	acl, err := querymodifier.NewACL("minio, stolon")
+	assert.Nil(t, err)
+	assert.Equal(t, `namespace=~"minio|stolon"`, app.labelFiltersString(acl))
+
+	acl, err = querymodifier.NewACLWithLabels(querymodifier.DefaultLabel, "minio", map[string]string{"cluster": "prod"})
+	assert.Nil(t, err)
+	assert.Equal(t, `namespace="minio", cluster="prod"`, app.labelFiltersString(acl))
+
+	acl, err = querymodifier.NewACL("min.*, !minio-secret")
+	assert.Nil(t, err)
+	assert.Equal(t, `namespace=~"min.*", namespace!~"minio-secret"`, app.labelFiltersString(acl))
+
+	acl, err = querymodifier.NewACL("prod-eu:payments, prod-us:billing")
+	assert.Nil(t, err)
+	assert.Equal(t, `namespace=~"payments|billing", (cluster="prod-eu", namespace="payments" or cluster="prod-us", namespace="billing")`, app.labelFiltersString(acl))
+}
+
+func TestIsAdminRequest(t *testing.T) {
+	tests := []struct {
+		name                string
+		adminToken          string
+		secondaryAdminToken string
+		authorization       string
+		want                bool
+	}{
+		{
+			name:          "Matching token",
+			adminToken:    "secret",
+			authorization: "Bearer secret",
+			want:          true,
+		},
+		{
+			name:          "Different token",
+			adminToken:    "secret",
+			authorization: "Bearer random",
+			want:          false,
+		},
+		{
+			name:          "Not a bearer token",
+			adminToken:    "secret",
+			authorization: "Basic secret",
+			want:          false,
+		},
+		{
+			name:          "No token",
+			adminToken:    "secret",
+			authorization: "",
+			want:          false,
+		},
+		{
+			name:                "Matching secondary token",
+			adminToken:          "secret",
+			secondaryAdminToken: "previous",
+			authorization:       "Bearer previous",
+			want:                true,
+		},
+		{
+			name:                "Primary token during rotation",
+			adminToken:          "secret",
+			secondaryAdminToken: "previous",
+			authorization:       "Bearer secret",
+			want:                true,
+		},
+		{
+			name:          "Empty secondary token is never matched",
+			adminToken:    "secret",
+			authorization: "Bearer ",
+			want:          false,
+		},
+		{
+			name:          "Admin token is not configured",
+			adminToken:    "",
+			authorization: "Bearer ",
+			want:          false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{
+				AdminToken:          tt.adminToken,
+				SecondaryAdminToken: tt.secondaryAdminToken,
+			}
+
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			got := app.isAdminRequest(r)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		sourceIPHeader string
+		remoteAddr     string
+		headerValue    string
+		want           string
+		wantErr        bool
+	}{
+		{
+			name:       "RemoteAddr with port",
+			remoteAddr: "10.0.0.1:12345",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "IPv6 RemoteAddr with port",
+			remoteAddr: "[2001:db8::1]:12345",
+			want:       "2001:db8::1",
+		},
+		{
+			name:           "Header is ignored if not configured",
+			sourceIPHeader: "",
+			remoteAddr:     "10.0.0.1:12345",
+			headerValue:    "192.168.0.1",
+			want:           "10.0.0.1",
+		},
+		{
+			name:           "Rightmost value from the header",
+			sourceIPHeader: "X-Forwarded-For",
+			remoteAddr:     "10.0.0.1:12345",
+			headerValue:    "1.1.1.1, 192.168.0.1",
+			want:           "192.168.0.1",
+		},
+		{
+			name:           "Fallback to RemoteAddr if header is empty",
+			sourceIPHeader: "X-Forwarded-For",
+			remoteAddr:     "10.0.0.1:12345",
+			headerValue:    "",
+			want:           "10.0.0.1",
+		},
+		{
+			name:       "Invalid address",
+			remoteAddr: "localhost",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{
+				SourceIPHeader: tt.sourceIPHeader,
+			}
+
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.RemoteAddr = tt.remoteAddr
+			if tt.headerValue != "" {
+				r.Header.Set("X-Forwarded-For", tt.headerValue)
+			}
+
+			got, err := app.getClientIP(r)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
+
+func TestFilterRolesBySourceIP(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	acls := querymodifier.ACLs{
+		"vendor": querymodifier.ACL{
+			RawACL:      "vendor",
+			SourceCIDRs: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		},
+		"team": querymodifier.ACL{
+			RawACL: "team",
+		},
+	}
+
+	tests := []struct {
+		name                string
+		assumedRolesEnabled bool
+		remoteAddr          string
+		roles               []string
+		want                []string
+		wantErr             error
+	}{
+		{
+			name:       "Allowed network",
+			remoteAddr: "10.0.0.1:1234",
+			roles:      []string{"vendor", "team"},
+			want:       []string{"vendor", "team"},
+		},
+		{
+			name:       "Restricted role is dropped",
+			remoteAddr: "192.168.0.1:1234",
+			roles:      []string{"vendor", "team"},
+			want:       []string{"team"},
+		},
+		{
+			name:       "No usable roles left",
+			remoteAddr: "192.168.0.1:1234",
+			roles:      []string{"vendor", "unknown"},
+			wantErr:    errSourceIPNotAllowed,
+		},
+		{
+			name:                "Unknown roles are kept in assumed roles mode",
+			assumedRolesEnabled: true,
+			remoteAddr:          "192.168.0.1:1234",
+			roles:               []string{"vendor", "unknown"},
+			want:                []string{"unknown"},
+		},
+		{
+			name:       "Client IP is not needed without restricted roles",
+			remoteAddr: "",
+			roles:      []string{"team"},
+			want:       []string{"team"},
+		},
+		{
+			name:       "Invalid client IP",
+			remoteAddr: "",
+			roles:      []string{"vendor"},
+			wantErr:    errSourceIPNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{
+				acls:                &aclsState{},
+				logger:              &logger,
+				ACLs:                acls,
+				AssumedRolesEnabled: tt.assumedRolesEnabled,
+			}
+
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.RemoteAddr = tt.remoteAddr
+
+			got, err := app.filterRolesBySourceIP(r, tt.roles)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
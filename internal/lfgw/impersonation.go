@@ -0,0 +1,47 @@
+package lfgw
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+const impersonateRoleHeader = "X-LFGW-Impersonate-Role"
+
+var impersonatedRequests = metrics.NewCounter("impersonated_requests_total")
+
+// impersonate evaluates the request under the ACL of the role passed in the X-LFGW-Impersonate-Role header. Only users with full access are allowed to impersonate roles. If the header is not set, the original ACL and roles are returned.
+func (app *application) impersonate(r *http.Request, acl querymodifier.ACL, roles []string) (querymodifier.ACL, []string, error) {
+	role := strings.TrimSpace(r.Header.Get(impersonateRoleHeader))
+	r.Header.Del(impersonateRoleHeader)
+
+	if role == "" {
+		return acl, roles, nil
+	}
+
+	if !acl.Fullaccess {
+		return acl, roles, errImpersonationDenied
+	}
+
+	impersonatedACL, err := app.getACLs().GetUserACL([]string{role}, false, app.EnforcedLabel)
+	if err != nil {
+		return acl, roles, fmt.Errorf("cannot impersonate role %q: %w", role, err)
+	}
+
+	impersonatedACL, err = app.withSharedNamespaces(impersonatedACL)
+	if err != nil {
+		return acl, roles, err
+	}
+
+	impersonatedRequests.Inc()
+	app.enrichLogContext(r, "impersonated_role", role)
+	hlog.FromRequest(r).Info().Caller().
+		Strs("roles", roles).
+		Msgf("Impersonating role %q", role)
+
+	return impersonatedACL, []string{role}, nil
+}
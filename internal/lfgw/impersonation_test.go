@@ -0,0 +1,82 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_impersonate(t *testing.T) {
+	acls, _, err := querymodifier.NewACLsFromBytes([]byte("admin: .*\nteam-a: minio, mimir\n"), "")
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:   &aclsState{},
+		logger: &logger,
+		ACLs:   acls,
+	}
+
+	tests := []struct {
+		name      string
+		header    string
+		roles     []string
+		wantRoles []string
+		wantACL   string
+		wantErr   bool
+	}{
+		{
+			name:      "no header",
+			roles:     []string{"team-a"},
+			wantRoles: []string{"team-a"},
+			wantACL:   "minio, mimir",
+		},
+		{
+			name:      "full access user impersonates a role",
+			header:    "team-a",
+			roles:     []string{"admin"},
+			wantRoles: []string{"team-a"},
+			wantACL:   "minio, mimir",
+		},
+		{
+			name:    "restricted user cannot impersonate",
+			header:  "admin",
+			roles:   []string{"team-a"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown role",
+			header:  "team-b",
+			roles:   []string{"admin"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+			if tt.header != "" {
+				r.Header.Set(impersonateRoleHeader, tt.header)
+			}
+
+			acl, err := app.getACLs().GetUserACL(tt.roles, false, "")
+			assert.Nil(t, err)
+
+			gotACL, gotRoles, err := app.impersonate(r, acl, tt.roles)
+			assert.Empty(t, r.Header.Get(impersonateRoleHeader))
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantRoles, gotRoles)
+			assert.Equal(t, tt.wantACL, gotACL.RawACL)
+		})
+	}
+}
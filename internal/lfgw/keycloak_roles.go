@@ -0,0 +1,194 @@
+package lfgw
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/weisdd/lfgw/internal/keycloak"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+var (
+	keycloakRoleSyncRoles atomic.Int64
+
+	_ = metrics.NewGauge("keycloak_role_sync_roles", func() float64 {
+		return float64(keycloakRoleSyncRoles.Load())
+	})
+	keycloakRoleSyncLastSuccess = metrics.NewFloatCounter("keycloak_role_sync_last_success_timestamp_seconds")
+	keycloakRoleSyncErrorsTotal = metrics.NewCounter("keycloak_role_sync_errors_total")
+)
+
+// runKeycloakRoleSyncer periodically discovers roles matching KeycloakRoleSyncPattern in Keycloak and adds ACLs for them until ctx is cancelled.
+func (app *application) runKeycloakRoleSyncer(ctx context.Context) {
+	app.logger.Info().Caller().
+		Msgf("Keycloak role sync is on (interval: %s, pattern: %s, ACL: %s)", app.KeycloakRoleSyncInterval, app.KeycloakRoleSyncPattern, app.KeycloakRoleSyncACL)
+
+	ticker := time.NewTicker(app.KeycloakRoleSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := app.syncKeycloakRoles(ctx); err != nil {
+			keycloakRoleSyncErrorsTotal.Inc()
+			app.logger.Error().Caller().
+				Err(err).Msg("Keycloak role sync failed, keeping the previously discovered roles")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncKeycloakRoles fetches roles from Keycloak, builds ACLs for those matching KeycloakRoleSyncPattern and swaps them in.
+func (app *application) syncKeycloakRoles(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	idpRoles, err := app.fetchIdPRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(idpRoles))
+	for _, role := range idpRoles {
+		names = append(names, role.Name)
+	}
+
+	acls, err := app.keycloakRoleACLs(names)
+	if err != nil {
+		return err
+	}
+
+	added := app.setKeycloakRoleACLs(acls)
+	keycloakRoleSyncRoles.Store(int64(len(acls)))
+	keycloakRoleSyncLastSuccess.Set(float64(time.Now().Unix()))
+
+	if len(added) > 0 {
+		app.logger.Info().Caller().
+			Strs("added_roles", added).Msgf("Discovered %d role(s) in Keycloak", len(added))
+	}
+
+	return nil
+}
+
+// fetchIdPRoles returns realm roles and roles of KeycloakRoleClients.
+func (app *application) fetchIdPRoles(ctx context.Context) ([]keycloak.Role, error) {
+	idpRoles, err := app.keycloakClient.RealmRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, clientID := range app.KeycloakRoleClients {
+		clientRoles, err := app.keycloakClient.ClientRoles(ctx, clientID)
+		if err != nil {
+			return nil, err
+		}
+		idpRoles = append(idpRoles, clientRoles...)
+	}
+
+	return idpRoles, nil
+}
+
+// keycloakRoleACLs returns ACLs for the roles matching KeycloakRoleSyncPattern. An ACL is built by expanding KeycloakRoleSyncACL with the submatches of the pattern (e.g. $1 or ${team}), they're validated and quoted the same way as in role patterns, so a role name cannot widen its own access. Roles leading to invalid ACLs are skipped, so one odd role doesn't block the others.
+func (app *application) keycloakRoleACLs(roles []string) (querymodifier.ACLs, error) {
+	re, err := regexp.Compile("^(?:" + app.KeycloakRoleSyncPattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile keycloak role sync pattern: %w", err)
+	}
+
+	label := app.EnforcedLabel
+	if label == "" {
+		label = querymodifier.DefaultLabel
+	}
+
+	acls := make(querymodifier.ACLs)
+
+	for _, role := range roles {
+		if querymodifier.IsReservedKey(role) {
+			continue
+		}
+
+		match := re.FindStringSubmatchIndex(role)
+		if match == nil {
+			continue
+		}
+
+		rawACL, ok := querymodifier.ExpandCaptures(re, app.KeycloakRoleSyncACL, role, match)
+		if !ok {
+			app.logger.Error().Caller().
+				Msgf("Keycloak role %s is skipped, it contains symbols not allowed in ACLs", role)
+			continue
+		}
+
+		acl, err := querymodifier.NewACLForLabel(label, rawACL)
+		if err != nil {
+			app.logger.Error().Caller().
+				Err(err).Msgf("Keycloak role %s is skipped", role)
+			continue
+		}
+
+		acls[role] = acl
+	}
+
+	return acls, nil
+}
+
+// setKeycloakRoleACLs replaces the ACLs of discovered roles and returns the sorted list of roles that were not there before.
+func (app *application) setKeycloakRoleACLs(acls querymodifier.ACLs) []string {
+	app.acls.mu.Lock()
+	defer app.acls.mu.Unlock()
+
+	base := make(querymodifier.ACLs, len(app.ACLs))
+	for role, acl := range app.ACLs {
+		if _, synced := app.keycloakSyncedRoles[role]; !synced {
+			base[role] = acl
+		}
+	}
+
+	previous := app.keycloakSyncedRoles
+	app.keycloakDiscoveredACLs = acls
+	app.ACLs = app.withKeycloakRoleACLs(base)
+	app.acls.loadedAt = time.Now()
+
+	var added []string
+	for role := range app.keycloakSyncedRoles {
+		if _, exists := previous[role]; !exists {
+			added = append(added, role)
+		}
+	}
+	sort.Strings(added)
+
+	return added
+}
+
+// withKeycloakRoleACLs returns acls extended with ACLs of discovered roles (app.keycloakDiscoveredACLs) and keeps the roles actually added (i.e. not defined otherwise) in app.keycloakSyncedRoles. Roles defined in acls (either directly or through role patterns) take precedence. It must be called with app.acls.mu held.
+func (app *application) withKeycloakRoleACLs(acls querymodifier.ACLs) querymodifier.ACLs {
+	app.keycloakSyncedRoles = map[string]struct{}{}
+
+	if len(app.keycloakDiscoveredACLs) == 0 {
+		return acls
+	}
+
+	merged := make(querymodifier.ACLs, len(acls)+len(app.keycloakDiscoveredACLs))
+	for role, acl := range acls {
+		merged[role] = acl
+	}
+
+	for role, acl := range app.keycloakDiscoveredACLs {
+		if len(acls.ForRoles([]string{role})) > 0 {
+			continue
+		}
+
+		merged[role] = acl
+		app.keycloakSyncedRoles[role] = struct{}{}
+	}
+
+	return merged
+}
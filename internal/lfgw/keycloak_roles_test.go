@@ -0,0 +1,109 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/keycloak"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_syncKeycloakRoles(t *testing.T) {
+	idpRoles := []keycloak.Role{{Name: "team-a-viewer"}, {Name: "team-b-viewer"}, {Name: "team-c-viewer"}, {Name: "offline_access"}, {Name: "team-.*|kube-system-viewer"}, {Name: "team-x, kube-system-viewer"}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/realms/monitoring/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"access_token":"token","expires_in":300}`))
+	})
+	mux.HandleFunc("/admin/realms/monitoring/roles", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(idpRoles)
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	newACL := func(rawACL string) querymodifier.ACL {
+		acl, err := querymodifier.NewACL(rawACL)
+		assert.Nil(t, err)
+		return acl
+	}
+
+	acls, _, err := querymodifier.NewACLsFromBytes([]byte(`version: 2
+roles:
+  team-a-viewer: team-a, shared
+  "team-(?P<team>c)-.+": "${team}-custom"
+`), querymodifier.DefaultLabel)
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:                      &aclsState{},
+		logger:                    &logger,
+		OIDCRealmURL:              ts.URL + "/realms/monitoring",
+		KeycloakAdminClientID:     "lfgw",
+		KeycloakAdminClientSecret: "secret",
+		KeycloakRoleSyncInterval:  1,
+		KeycloakRoleSyncPattern:   "team-(.+)-viewer",
+		KeycloakRoleSyncACL:       "team-$1",
+		ACLs:                      acls,
+	}
+
+	if err := app.configureKeycloakClient(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, app.syncKeycloakRoles(context.Background()))
+	assert.Equal(t, int64(3), keycloakRoleSyncRoles.Load())
+
+	t.Run("Discovered roles get ACLs", func(t *testing.T) {
+		got, err := app.getUserACL([]string{"team-b-viewer"})
+		assert.Nil(t, err)
+		assert.Equal(t, newACL("team-b"), got)
+	})
+
+	t.Run("Roles injecting expressions are skipped", func(t *testing.T) {
+		_, err := app.getUserACL([]string{"team-.*|kube-system-viewer"})
+		assert.ErrorIs(t, err, querymodifier.ErrNoMatchingRoles)
+
+		_, err = app.getUserACL([]string{"team-x, kube-system-viewer"})
+		assert.ErrorIs(t, err, querymodifier.ErrNoMatchingRoles)
+	})
+
+	t.Run("Defined roles take precedence", func(t *testing.T) {
+		got, err := app.getUserACL([]string{"team-a-viewer"})
+		assert.Nil(t, err)
+		assert.Equal(t, newACL("team-a, shared"), got)
+
+		got, err = app.getUserACL([]string{"team-c-viewer"})
+		assert.Nil(t, err)
+		assert.Equal(t, newACL("c-custom"), got)
+	})
+
+	t.Run("Roles removed from Keycloak are dropped", func(t *testing.T) {
+		idpRoles = []keycloak.Role{{Name: "team-a-viewer"}}
+		assert.Nil(t, app.syncKeycloakRoles(context.Background()))
+
+		_, err := app.getUserACL([]string{"team-b-viewer"})
+		assert.ErrorIs(t, err, querymodifier.ErrNoMatchingRoles)
+
+		got, err := app.getUserACL([]string{"team-a-viewer"})
+		assert.Nil(t, err)
+		assert.Equal(t, newACL("team-a, shared"), got)
+	})
+
+	t.Run("Discovered roles survive reloads", func(t *testing.T) {
+		idpRoles = []keycloak.Role{{Name: "team-d-viewer"}}
+		assert.Nil(t, app.syncKeycloakRoles(context.Background()))
+
+		app.setACLs(querymodifier.ACLs{})
+
+		got, err := app.getUserACL([]string{"team-d-viewer"})
+		assert.Nil(t, err)
+		assert.Equal(t, newACL("team-d"), got)
+	})
+}
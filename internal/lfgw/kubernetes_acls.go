@@ -0,0 +1,145 @@
+package lfgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/weisdd/lfgw/internal/kubernetes"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+const (
+	aclSourceFile       = "file"
+	aclSourceKubernetes = "kubernetes"
+
+	// kubernetesRetryInterval is how long to wait before listing MetricsAccessPolicy objects again after a failure
+	kubernetesRetryInterval = 5 * time.Second
+)
+
+// configureKubernetesACLs sets up a Kubernetes client (in-cluster or through kubeconfig) and loads ACLs from MetricsAccessPolicy objects.
+func (app *application) configureKubernetesACLs() error {
+	client, err := kubernetes.NewClient()
+	if err != nil {
+		return err
+	}
+
+	app.kubernetesClient = client
+
+	app.logger.Info().Caller().
+		Msgf("Loading ACLs from %s.%s/%s objects (admin namespace: %q)", kubernetes.Resource, kubernetes.Group, kubernetes.Version, app.KubernetesACLAdminNamespace)
+
+	_, err = app.syncKubernetesACLs(context.Background())
+	return err
+}
+
+// aclsFromPolicies builds ACLs from MetricsAccessPolicy objects. A policy grants its roles access to the namespace it resides in, so namespace owners can manage grants through Kubernetes RBAC. Only policies in the admin namespace might grant access to other namespaces through spec.namespaces. Invalid policies and roles are skipped, so one broken object doesn't affect others.
+func (app *application) aclsFromPolicies(policies []kubernetes.MetricsAccessPolicy) querymodifier.ACLs {
+	grants := make(map[string][]string)
+
+	for _, policy := range policies {
+		name := policy.Metadata.Namespace + "/" + policy.Metadata.Name
+
+		granted := policy.Metadata.Namespace
+		if policy.Spec.Namespaces != "" {
+			if app.KubernetesACLAdminNamespace == "" || policy.Metadata.Namespace != app.KubernetesACLAdminNamespace {
+				app.logger.Warn().Caller().
+					Msgf("MetricsAccessPolicy %s is skipped: spec.namespaces is allowed only in the admin namespace", name)
+				continue
+			}
+			granted = policy.Spec.Namespaces
+		}
+
+		for _, role := range policy.Spec.Roles {
+			role = strings.TrimSpace(role)
+			if role == "" {
+				continue
+			}
+			grants[role] = append(grants[role], granted)
+		}
+	}
+
+	label := app.EnforcedLabel
+	if label == "" {
+		label = querymodifier.DefaultLabel
+	}
+
+	acls := make(querymodifier.ACLs, len(grants))
+
+	for role, granted := range grants {
+		sort.Strings(granted)
+		granted = slices.Compact(granted)
+
+		acl, err := querymodifier.NewACLForLabel(label, strings.Join(granted, ", "))
+		if err != nil {
+			app.logger.Error().Caller().
+				Err(err).Msgf("Role %s is skipped", role)
+			continue
+		}
+
+		acls[role] = acl
+	}
+
+	return acls
+}
+
+// syncKubernetesACLs lists MetricsAccessPolicy objects, rebuilds ACLs and swaps them. The resource version of the list is returned, so changes can be watched from there.
+func (app *application) syncKubernetesACLs(ctx context.Context) (string, error) {
+	list, err := app.kubernetesClient.ListMetricsAccessPolicies(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list MetricsAccessPolicy objects: %w", err)
+	}
+
+	acls := app.aclsFromPolicies(list.Items)
+
+	app.logRoleDefinitions(acls)
+
+	previous := app.setACLs(acls)
+	aclLastSuccessfulReload.Set(float64(time.Now().Unix()))
+
+	app.logACLSummary(previous, acls)
+
+	return list.Metadata.ResourceVersion, nil
+}
+
+// runKubernetesACLWatcher rebuilds ACLs on every change of MetricsAccessPolicy objects until ctx is cancelled.
+func (app *application) runKubernetesACLWatcher(ctx context.Context) {
+	app.runKubernetesWatchLoop(ctx, app.syncKubernetesACLs, app.kubernetesClient.WaitForMetricsAccessPolicyChange)
+}
+
+// runKubernetesWatchLoop calls sync every time wait reports a change until ctx is cancelled. Besides changes, sync is called every time a watch times out, so missed events can't leave ACLs stale for long. If sync fails, but still returns a resource version (e.g. the objects are there, though invalid), changes are watched from there. Otherwise, sync is retried after kubernetesRetryInterval.
+func (app *application) runKubernetesWatchLoop(ctx context.Context, sync func(context.Context) (string, error), wait func(context.Context, string) (bool, error)) {
+	for {
+		resourceVersion, err := sync(ctx)
+		if err != nil && resourceVersion != "" {
+			app.logger.Error().Caller().
+				Err(err).Msg("Failed to sync ACLs with Kubernetes, waiting for changes")
+			err = nil
+		}
+
+		if err == nil {
+			_, err = wait(ctx, resourceVersion)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil || errors.Is(err, kubernetes.ErrWatchExpired) {
+			continue
+		}
+
+		app.logger.Error().Caller().
+			Err(err).Msgf("Failed to sync ACLs with Kubernetes, retrying in %s", kubernetesRetryInterval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(kubernetesRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package lfgw
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/kubernetes"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_aclsFromPolicies(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	policy := func(namespace, name, namespaces string, roles ...string) kubernetes.MetricsAccessPolicy {
+		return kubernetes.MetricsAccessPolicy{
+			Metadata: kubernetes.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:     kubernetes.MetricsAccessPolicySpec{Roles: roles, Namespaces: namespaces},
+		}
+	}
+
+	newACL := func(rawACL string) querymodifier.ACL {
+		acl, err := querymodifier.NewACL(rawACL)
+		assert.Nil(t, err)
+		return acl
+	}
+
+	tests := []struct {
+		name     string
+		policies []kubernetes.MetricsAccessPolicy
+		want     querymodifier.ACLs
+	}{
+		{
+			name:     "No policies",
+			policies: nil,
+			want:     querymodifier.ACLs{},
+		},
+		{
+			name: "Grants are merged per role",
+			policies: []kubernetes.MetricsAccessPolicy{
+				policy("team-b", "viewers", "", "team-viewer", "team-b-viewer"),
+				policy("team-a", "viewers", "", "team-viewer", " "),
+				policy("team-a", "duplicate", "", "team-viewer"),
+			},
+			want: querymodifier.ACLs{
+				"team-viewer":   newACL("team-a, team-b"),
+				"team-b-viewer": newACL("team-b"),
+			},
+		},
+		{
+			name: "spec.namespaces in the admin namespace",
+			policies: []kubernetes.MetricsAccessPolicy{
+				policy("lfgw", "sre", ".*", "sre"),
+				policy("lfgw", "platform", "kube-.*, monitoring", "platform"),
+			},
+			want: querymodifier.ACLs{
+				"sre":      newACL(".*"),
+				"platform": newACL("kube-.*, monitoring"),
+			},
+		},
+		{
+			name: "spec.namespaces outside of the admin namespace",
+			policies: []kubernetes.MetricsAccessPolicy{
+				policy("team-a", "escalation", ".*", "team-a-viewer"),
+				policy("team-a", "viewers", "", "team-a-viewer"),
+			},
+			want: querymodifier.ACLs{
+				"team-a-viewer": newACL("team-a"),
+			},
+		},
+		{
+			name: "Invalid roles are skipped",
+			policies: []kubernetes.MetricsAccessPolicy{
+				policy("lfgw", "broken", "mini[o", "broken"),
+				policy("team-a", "viewers", "", "team-a-viewer"),
+			},
+			want: querymodifier.ACLs{
+				"team-a-viewer": newACL("team-a"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{
+				logger:                      &logger,
+				KubernetesACLAdminNamespace: "lfgw",
+			}
+
+			assert.Equal(t, tt.want, app.aclsFromPolicies(tt.policies))
+		})
+	}
+
+	t.Run("No admin namespace", func(t *testing.T) {
+		app := &application{
+			logger: &logger,
+		}
+
+		got := app.aclsFromPolicies([]kubernetes.MetricsAccessPolicy{policy("", "cluster-wide", ".*", "sre")})
+		assert.Equal(t, querymodifier.ACLs{}, got)
+	})
+}
+
+func TestApp_syncKubernetesACLs(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf("/apis/%s/%s/%s", kubernetes.Group, kubernetes.Version, kubernetes.Resource) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"metadata":{"resourceVersion":"100"},"items":[
+			{"metadata":{"name":"viewers","namespace":"team-a"},"spec":{"roles":["team-a-viewer"]}}
+		]}`))
+	}))
+	defer ts.Close()
+
+	app := &application{
+		acls:          &aclsState{},
+		logger:        &logger,
+		EnforcedLabel: "namespace",
+		kubernetesClient: &kubernetes.Client{
+			APIServerURL: ts.URL,
+			HTTPClient:   ts.Client(),
+		},
+	}
+
+	resourceVersion, err := app.syncKubernetesACLs(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "100", resourceVersion)
+
+	acls := app.getACLs()
+	assert.Len(t, acls, 1)
+	assert.Equal(t, "team-a", acls["team-a-viewer"].RawACL)
+
+	t.Run("Failed list keeps the previous ACL", func(t *testing.T) {
+		app.kubernetesClient.APIServerURL = ts.URL + "/random-prefix"
+
+		_, err := app.syncKubernetesACLs(context.Background())
+		assert.NotNil(t, err)
+		assert.Equal(t, acls, app.getACLs())
+	})
+}
@@ -0,0 +1,216 @@
+package lfgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weisdd/lfgw/internal/kubernetes"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+const (
+	aclSourceKubernetesRBAC = "kubernetes-rbac"
+
+	// kubernetesRBACVerb and kubernetesRBACResource define the action a user must be allowed to perform in a namespace to see its metrics
+	kubernetesRBACVerb     = "get"
+	kubernetesRBACResource = "pods"
+
+	// kubernetesRBACConcurrency limits the number of concurrent access reviews made for a single user
+	kubernetesRBACConcurrency = 8
+)
+
+// kubernetesRBACCacheEntry is an ACL computed for a user along with the time it expires at.
+type kubernetesRBACCacheEntry struct {
+	acl     querymodifier.ACL
+	err     error
+	expires time.Time
+}
+
+// kubernetesRBACCache keeps ACLs computed from Kubernetes RBAC, so access reviews are not repeated on every request.
+type kubernetesRBACCache struct {
+	mu      sync.Mutex
+	entries map[string]kubernetesRBACCacheEntry
+}
+
+// newKubernetesRBACCache returns an empty cache.
+func newKubernetesRBACCache() *kubernetesRBACCache {
+	return &kubernetesRBACCache{entries: make(map[string]kubernetesRBACCacheEntry)}
+}
+
+// get returns the entry cached for the key if it hasn't expired by now.
+func (c *kubernetesRBACCache) get(key string, now time.Time) (kubernetesRBACCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		return kubernetesRBACCacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// put stores the entry for the key, expired entries are dropped along the way.
+func (c *kubernetesRBACCache) put(key string, entry kubernetesRBACCacheEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = entry
+}
+
+// reset drops all cached entries.
+func (c *kubernetesRBACCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]kubernetesRBACCacheEntry)
+}
+
+// configureKubernetesRBAC sets up a Kubernetes client (in-cluster or through kubeconfig) used to compute ACLs of users from Kubernetes RBAC.
+func (app *application) configureKubernetesRBAC() error {
+	client, err := kubernetes.NewClient()
+	if err != nil {
+		return err
+	}
+
+	app.kubernetesClient = client
+	app.kubernetesRBACCache = newKubernetesRBACCache()
+
+	app.logger.Info().Caller().
+		Msgf("ACLs are derived from Kubernetes RBAC: a user has access to metrics of namespaces they can %s %s in (username claim: %s)", kubernetesRBACVerb, kubernetesRBACResource, app.KubernetesRBACUsernameClaim)
+
+	return nil
+}
+
+// kubernetesRBACSubject returns the Kubernetes user and groups the token maps to, mirroring --oidc-username-claim, --oidc-username-prefix and --oidc-groups-prefix of kube-apiserver.
+func (app *application) kubernetesRBACSubject(subject, email string, roles []string) (string, []string) {
+	user := email
+	if app.KubernetesRBACUsernameClaim == "sub" {
+		user = subject
+	}
+	if user != "" {
+		user = app.KubernetesRBACUsernamePrefix + user
+	}
+
+	groups := make([]string, 0, len(roles))
+	for _, role := range roles {
+		groups = append(groups, app.KubernetesRBACGroupsPrefix+role)
+	}
+	sort.Strings(groups)
+
+	return user, groups
+}
+
+// getKubernetesRBACACL returns the ACL of a user derived from Kubernetes RBAC: full access if the user can get pods cluster-wide, otherwise access to the namespaces they can get pods in. ErrNoMatchingRoles is returned if there are no such namespaces, so the default ACL might still be applied. Results (including denials) are cached for KubernetesRBACCacheTTL.
+func (app *application) getKubernetesRBACACL(ctx context.Context, subject, email string, roles []string) (querymodifier.ACL, error) {
+	user, groups := app.kubernetesRBACSubject(subject, email, roles)
+	if user == "" && len(groups) == 0 {
+		return querymodifier.ACL{}, querymodifier.ErrNoMatchingRoles
+	}
+
+	key := user + "\n" + strings.Join(groups, "\n")
+	now := time.Now()
+
+	if entry, ok := app.kubernetesRBACCache.get(key, now); ok {
+		return entry.acl, entry.err
+	}
+
+	acl, err := app.computeKubernetesRBACACL(ctx, user, groups)
+	if err != nil && !errors.Is(err, querymodifier.ErrNoMatchingRoles) {
+		// API errors are not cached, so they don't outlive the outage
+		return querymodifier.ACL{}, err
+	}
+
+	app.kubernetesRBACCache.put(key, kubernetesRBACCacheEntry{acl: acl, err: err, expires: now.Add(app.KubernetesRBACCacheTTL)}, now)
+
+	return acl, err
+}
+
+// computeKubernetesRBACACL runs access reviews for the user: first cluster-wide, then for every namespace.
+func (app *application) computeKubernetesRBACACL(ctx context.Context, user string, groups []string) (querymodifier.ACL, error) {
+	label := app.EnforcedLabel
+	if label == "" {
+		label = querymodifier.DefaultLabel
+	}
+
+	allowed, err := app.kubernetesClient.CanI(ctx, user, groups, kubernetes.ResourceAttributes{Verb: kubernetesRBACVerb, Resource: kubernetesRBACResource})
+	if err != nil {
+		return querymodifier.ACL{}, fmt.Errorf("failed to review access of %q: %w", user, err)
+	}
+
+	if allowed {
+		return querymodifier.NewACLForLabel(label, ".*")
+	}
+
+	namespaces, err := app.kubernetesClient.ListNamespaces(ctx, "")
+	if err != nil {
+		return querymodifier.ACL{}, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	granted, err := app.reviewNamespaces(ctx, user, groups, namespaces)
+	if err != nil {
+		return querymodifier.ACL{}, err
+	}
+
+	if len(granted) == 0 {
+		return querymodifier.ACL{}, querymodifier.ErrNoMatchingRoles
+	}
+
+	return querymodifier.NewACLForLabel(label, strings.Join(granted, ", "))
+}
+
+// reviewNamespaces returns the sorted list of namespaces the user can get pods in. Reviews are made concurrently, the first error is returned.
+func (app *application) reviewNamespaces(ctx context.Context, user string, groups []string, namespaces []string) ([]string, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		granted []string
+		errs    []error
+	)
+
+	sem := make(chan struct{}, kubernetesRBACConcurrency)
+
+	for _, namespace := range namespaces {
+		namespace := namespace
+
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			allowed, err := app.kubernetesClient.CanI(ctx, user, groups, kubernetes.ResourceAttributes{Namespace: namespace, Verb: kubernetesRBACVerb, Resource: kubernetesRBACResource})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("failed to review access of %q to %s: %w", user, namespace, err))
+			case allowed:
+				granted = append(granted, namespace)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	sort.Strings(granted)
+
+	return granted, nil
+}
@@ -0,0 +1,147 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/kubernetes"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_getKubernetesRBACACL(t *testing.T) {
+	var reviews atomic.Int64
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces":
+			_, _ = w.Write([]byte(`{"items":[{"metadata":{"name":"team-a"}},{"metadata":{"name":"team-b"}},{"metadata":{"name":"team-c"}}]}`))
+		case "/apis/authorization.k8s.io/v1/subjectaccessreviews":
+			reviews.Add(1)
+
+			var review kubernetes.SubjectAccessReview
+			if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			spec := review.Spec
+			if spec.User == "oidc:broken@example.com" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			namespace := spec.ResourceAttributes.Namespace
+			review.Status.Allowed = slices.Contains(spec.Groups, "oidc:sre") ||
+				(spec.User == "oidc:alice@example.com" && (namespace == "team-a" || namespace == "team-c")) ||
+				(slices.Contains(spec.Groups, "oidc:team-b") && namespace == "team-b")
+
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(review)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	app := &application{
+		KubernetesRBACUsernameClaim:  "email",
+		KubernetesRBACUsernamePrefix: "oidc:",
+		KubernetesRBACGroupsPrefix:   "oidc:",
+		KubernetesRBACCacheTTL:       time.Minute,
+		kubernetesClient: &kubernetes.Client{
+			APIServerURL: ts.URL,
+			HTTPClient:   ts.Client(),
+		},
+		kubernetesRBACCache: newKubernetesRBACCache(),
+	}
+
+	newACL := func(rawACL string) querymodifier.ACL {
+		acl, err := querymodifier.NewACL(rawACL)
+		assert.Nil(t, err)
+		return acl
+	}
+
+	tests := []struct {
+		name       string
+		email      string
+		roles      []string
+		want       querymodifier.ACL
+		wantErr    error
+		wantAnyErr bool
+	}{
+		{
+			name:  "Namespaces of the user",
+			email: "alice@example.com",
+			want:  newACL("team-a, team-c"),
+		},
+		{
+			name:  "Namespaces of the user and groups",
+			email: "alice@example.com",
+			roles: []string{"team-b"},
+			want:  newACL("team-a, team-b, team-c"),
+		},
+		{
+			name:  "Cluster-wide access",
+			email: "bob@example.com",
+			roles: []string{"sre"},
+			want:  newACL(".*"),
+		},
+		{
+			name:       "No access",
+			email:      "bob@example.com",
+			wantErr:    querymodifier.ErrNoMatchingRoles,
+			wantAnyErr: true,
+		},
+		{
+			name:       "API errors",
+			email:      "broken@example.com",
+			wantAnyErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := app.getKubernetesRBACACL(context.Background(), "subject", tt.email, tt.roles)
+			assert.Equal(t, tt.wantAnyErr, err != nil)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			if !tt.wantAnyErr {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Results are cached", func(t *testing.T) {
+		before := reviews.Load()
+
+		got, err := app.getKubernetesRBACACL(context.Background(), "subject", "alice@example.com", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, newACL("team-a, team-c"), got)
+
+		_, err = app.getKubernetesRBACACL(context.Background(), "subject", "bob@example.com", nil)
+		assert.ErrorIs(t, err, querymodifier.ErrNoMatchingRoles)
+
+		assert.Equal(t, before, reviews.Load())
+	})
+}
+
+func TestApp_kubernetesRBACSubject(t *testing.T) {
+	app := &application{
+		KubernetesRBACUsernameClaim:  "sub",
+		KubernetesRBACUsernamePrefix: "oidc:",
+		KubernetesRBACGroupsPrefix:   "oidc-group:",
+	}
+
+	user, groups := app.kubernetesRBACSubject("1234", "alice@example.com", []string{"b", "a"})
+	assert.Equal(t, "oidc:1234", user)
+	assert.Equal(t, []string{"oidc-group:a", "oidc-group:b"}, groups)
+}
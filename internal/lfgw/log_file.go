@@ -0,0 +1,149 @@
+package lfgw
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// rotatedLogFileTimeFormat is used in names of rotated log files (e.g. lfgw.log.20220501T100000.000Z)
+const rotatedLogFileTimeFormat = "20060102T150405.000Z"
+
+// logFile is a log file rotated once it grows bigger than maxSize or gets older than maxAge (no rotation if 0). Rotated files are renamed to <path>.<timestamp>, only the newest maxBackups of them are kept. The file can also be reopened, so it can be rotated by external tools such as logrotate.
+type logFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// newLogFile opens (or creates) the log file at the path for appending.
+func newLogFile(path string, maxSize uint64, maxAge time.Duration, maxBackups int) (*logFile, error) {
+	lf := &logFile{
+		path:       path,
+		maxSize:    int64(maxSize),
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+
+	return lf, nil
+}
+
+// open opens the file at lf.path and swaps it with the current one, which is closed then. The current file is kept if the new one cannot be opened. The caller must hold lf.mu (unless lf is not shared yet).
+func (lf *logFile) open() error {
+	file, err := os.OpenFile(lf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	previous := lf.file
+
+	lf.file = file
+	lf.size = info.Size()
+	lf.openedAt = time.Now()
+
+	if previous != nil {
+		return previous.Close()
+	}
+
+	return nil
+}
+
+// Write implements io.Writer interface. The file is rotated before an entry is written if the entry doesn't fit into maxSize or the file is older than maxAge, so entries are never split between files.
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.needsRotation(len(p)) {
+		if err := lf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := lf.file.Write(p)
+	lf.size += int64(n)
+
+	return n, err
+}
+
+// needsRotation returns true if the file has to be rotated before n more bytes are written.
+func (lf *logFile) needsRotation(n int) bool {
+	if lf.size == 0 {
+		return false
+	}
+
+	if lf.maxSize > 0 && lf.size+int64(n) > lf.maxSize {
+		return true
+	}
+
+	return lf.maxAge > 0 && time.Since(lf.openedAt) >= lf.maxAge
+}
+
+// rotate renames the current file, opens a new one and removes rotated files beyond maxBackups. The caller must hold lf.mu.
+func (lf *logFile) rotate() error {
+	rotated := fmt.Sprintf("%s.%s", lf.path, time.Now().UTC().Format(rotatedLogFileTimeFormat))
+	if err := os.Rename(lf.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	if err := lf.open(); err != nil {
+		return err
+	}
+
+	if err := pruneOldestFiles(lf.path+".*", lf.maxBackups); err != nil {
+		return fmt.Errorf("failed to remove old log files: %w", err)
+	}
+
+	return nil
+}
+
+// Reopen opens lf.path again, which is needed after the file is moved away by an external tool (e.g. logrotate).
+func (lf *logFile) Reopen() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	return lf.open()
+}
+
+// reopenLogFileOnSIGUSR1 reopens the log file every time SIGUSR1 is received until ctx is cancelled.
+func (app *application) reopenLogFileOnSIGUSR1(ctx context.Context) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	defer signal.Stop(usr1)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-usr1:
+			if err := app.logFile.Reopen(); err != nil {
+				// Entries are still written to the previous file
+				app.logger.Error().Caller().
+					Err(err).Msgf("Caught %s signal, failed to reopen log file %s", s, app.LogFile)
+				continue
+			}
+
+			app.logger.Info().Caller().
+				Msgf("Caught %s signal, reopened log file %s", s, app.LogFile)
+		}
+	}
+}
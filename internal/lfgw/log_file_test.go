@@ -0,0 +1,85 @@
+package lfgw
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogFile(t *testing.T) {
+	t.Run("Rotation by size", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lfgw.log")
+
+		lf, err := newLogFile(path, 10, 0, 2)
+		assert.Nil(t, err)
+
+		for _, entry := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+			_, err := lf.Write([]byte(entry))
+			assert.Nil(t, err)
+			// Rotated files are named after the time of rotation
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		content, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, "fourth\n", string(content))
+
+		rotated, err := filepath.Glob(path + ".*")
+		assert.Nil(t, err)
+		assert.Len(t, rotated, 2, "only maxBackups rotated files are kept")
+
+		content, err = os.ReadFile(rotated[1])
+		assert.Nil(t, err)
+		assert.Equal(t, "third\n", string(content))
+	})
+
+	t.Run("Rotation by age", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lfgw.log")
+
+		lf, err := newLogFile(path, 0, time.Hour, 5)
+		assert.Nil(t, err)
+
+		_, err = lf.Write([]byte("old\n"))
+		assert.Nil(t, err)
+
+		lf.openedAt = time.Now().Add(-2 * time.Hour)
+		_, err = lf.Write([]byte("new\n"))
+		assert.Nil(t, err)
+
+		content, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, "new\n", string(content))
+
+		rotated, err := filepath.Glob(path + ".*")
+		assert.Nil(t, err)
+		assert.Len(t, rotated, 1)
+	})
+
+	t.Run("Reopen", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "lfgw.log")
+
+		lf, err := newLogFile(path, 0, 0, 5)
+		assert.Nil(t, err)
+
+		_, err = lf.Write([]byte("before\n"))
+		assert.Nil(t, err)
+
+		// Imitates logrotate
+		assert.Nil(t, os.Rename(path, path+".1"))
+		assert.Nil(t, lf.Reopen())
+
+		_, err = lf.Write([]byte("after\n"))
+		assert.Nil(t, err)
+
+		content, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		assert.Equal(t, "after\n", string(content))
+
+		content, err = os.ReadFile(path + ".1")
+		assert.Nil(t, err)
+		assert.Equal(t, "before\n", string(content))
+	})
+}
@@ -0,0 +1,181 @@
+package lfgw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	logFormatLogfmt   = "logfmt"
+	logFormatCombined = "combined"
+
+	// combinedTimeFormat is the timestamp format of Apache logs (%t)
+	combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+	contextKeyAccessLog = contextKey("accessLog")
+)
+
+// accessLogRecord is filled in while a request is processed, so the user is known once access logs in the combined format are written. Middlewares run in the same goroutine, thus no locking is needed.
+type accessLogRecord struct {
+	user string
+}
+
+// withAccessLogRecord adds an empty accessLogRecord to the context of the request if access logs are written in the combined format.
+func (app *application) withAccessLogRecord(r *http.Request) (*http.Request, *accessLogRecord) {
+	if app.LogFormat != logFormatCombined {
+		return r, nil
+	}
+
+	record := &accessLogRecord{}
+	return r.WithContext(context.WithValue(r.Context(), contextKeyAccessLog, record)), record
+}
+
+// setAccessLogUser records the user (email or API key) of the request for access logs in the combined format.
+func (app *application) setAccessLogUser(r *http.Request, user string) {
+	if record, ok := r.Context().Value(contextKeyAccessLog).(*accessLogRecord); ok {
+		record.user = user
+	}
+}
+
+// writeCombinedLog writes an access log entry in the Apache combined format (remote host, user, time the request was received, request line, status, size, referer and user agent) to app.accessLogOut.
+func (app *application) writeCombinedLog(r *http.Request, record *accessLogRecord, status, size int, duration time.Duration) {
+	if app.accessLogOut == nil {
+		return
+	}
+
+	host := r.RemoteAddr
+	if addr, err := app.getClientIP(r); err == nil {
+		host = addr.String()
+	}
+
+	user := "-"
+	if record != nil && record.user != "" {
+		user = strings.ReplaceAll(record.user, " ", "_")
+	}
+
+	bytesSent := "-"
+	if size > 0 {
+		bytesSent = strconv.Itoa(size)
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		host,
+		user,
+		time.Now().Add(-duration).Format(combinedTimeFormat),
+		r.Method,
+		combinedEscape(r.URL.RequestURI()),
+		r.Proto,
+		status,
+		bytesSent,
+		combinedEscape(headerOrDash(r, "Referer")),
+		combinedEscape(headerOrDash(r, "User-Agent")),
+	)
+
+	_, _ = io.WriteString(app.accessLogOut, line)
+}
+
+// headerOrDash returns the value of the header or "-" if it's empty.
+func headerOrDash(r *http.Request, header string) string {
+	if v := r.Header.Get(header); v != "" {
+		return v
+	}
+
+	return "-"
+}
+
+// combinedEscape escapes quotes and backslashes, so values cannot break quoted fields of combined logs.
+func combinedEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// logfmtWriter converts JSON entries written by zerolog into logfmt (key=value pairs). Time, level, caller and message go first, other fields are sorted by key. Nested values (e.g. stages) are kept as quoted JSON.
+type logfmtWriter struct {
+	out io.Writer
+}
+
+// Write implements io.Writer interface. Entries that cannot be parsed are written as is.
+func (lw logfmtWriter) Write(p []byte) (int, error) {
+	entry := map[string]interface{}{}
+
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	if err := decoder.Decode(&entry); err != nil {
+		return lw.out.Write(p)
+	}
+
+	leading := []string{zerolog.TimestampFieldName, zerolog.LevelFieldName, zerolog.CallerFieldName, zerolog.MessageFieldName}
+
+	keys := make([]string, 0, len(entry))
+	for key := range entry {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	write := func(key string) {
+		value, ok := entry[key]
+		if !ok {
+			return
+		}
+		delete(entry, key)
+
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(value))
+	}
+
+	for _, key := range leading {
+		write(key)
+	}
+	for _, key := range keys {
+		write(key)
+	}
+	buf.WriteByte('\n')
+
+	if _, err := lw.out.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// logfmtValue formats a decoded JSON value for logfmt, strings are quoted only if needed.
+func logfmtValue(value interface{}) string {
+	var s string
+
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return strconv.Quote(fmt.Sprint(v))
+		}
+		s = string(b)
+	}
+
+	if s == "" || strings.ContainsAny(s, " =\"\\") || strings.IndexFunc(s, func(r rune) bool { return !strconv.IsPrint(r) }) >= 0 {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
@@ -0,0 +1,80 @@
+package lfgw
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogfmtWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		want  string
+	}{
+		{
+			name:  "Leading fields",
+			entry: `{"req_id":"abc","level":"info","status":200,"message":"","time":"2022-05-01T10:00:00Z","caller":"middleware.go:42"}`,
+			want:  `time=2022-05-01T10:00:00Z level=info caller=middleware.go:42 message="" req_id=abc status=200` + "\n",
+		},
+		{
+			name:  "Quoting",
+			entry: `{"level":"error","error":"no bearer token found","query":"up{namespace=\"default\"}","debug":true}`,
+			want:  `level=error debug=true error="no bearer token found" query="up{namespace=\"default\"}"` + "\n",
+		},
+		{
+			name:  "Nested values",
+			entry: `{"level":"info","stages":{"acl":0.001}}`,
+			want:  `level=info stages="{\"acl\":0.001}"` + "\n",
+		},
+		{
+			name:  "Invalid entry",
+			entry: "not json\n",
+			want:  "not json\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			lw := logfmtWriter{out: &buf}
+
+			n, err := lw.Write([]byte(tt.entry))
+			assert.Nil(t, err)
+			assert.Equal(t, len(tt.entry), n)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestApp_writeCombinedLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(nil)
+
+	app := &application{
+		logger:       &logger,
+		LogRequests:  true,
+		LogFormat:    logFormatCombined,
+		accessLogOut: &buf,
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.setAccessLogUser(r, "user@example.com")
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, `/api/v1/query?query=up{namespace="default"}`, nil)
+	r.RemoteAddr = "10.0.0.1:12345"
+	r.Header.Set("User-Agent", `Grafana/9.0 "beta"`)
+
+	app.logAndMetricsMiddleware(next).ServeHTTP(httptest.NewRecorder(), r)
+
+	want := regexp.MustCompile(`^10\.0\.0\.1 - user@example\.com \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /api/v1/query\?query=up\{namespace=\\"default\\"\} HTTP/1\.1" 200 5 "-" "Grafana/9\.0 \\"beta\\""\n$`)
+	assert.Regexp(t, want, buf.String())
+}
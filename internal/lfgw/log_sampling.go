@@ -0,0 +1,15 @@
+package lfgw
+
+import (
+	"math/rand"
+	"net/http"
+)
+
+// shouldLogRequest returns true if an access log entry is written for a request with the status. Only a share of successful requests (app.LogSamplingRate) is logged, while failed requests (4xx, 5xx) are always logged, so are all requests in debug mode. Requests are not sampled unless the rate is within (0, 1).
+func (app *application) shouldLogRequest(status int) bool {
+	if app.Debug || status >= http.StatusBadRequest || app.LogSamplingRate <= 0 || app.LogSamplingRate >= 1 {
+		return true
+	}
+
+	return rand.Float64() < app.LogSamplingRate
+}
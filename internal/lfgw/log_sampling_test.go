@@ -0,0 +1,73 @@
+package lfgw
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_shouldLogRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		app    application
+		status int
+		want   bool
+	}{
+		{
+			name:   "No sampling",
+			app:    application{LogSamplingRate: 1},
+			status: http.StatusOK,
+			want:   true,
+		},
+		{
+			name:   "Sampling rate is not set",
+			app:    application{},
+			status: http.StatusOK,
+			want:   true,
+		},
+		{
+			name:   "Successful request sampled out",
+			app:    application{LogSamplingRate: 0.000001},
+			status: http.StatusOK,
+			want:   false,
+		},
+		{
+			name:   "Client error",
+			app:    application{LogSamplingRate: 0.000001},
+			status: http.StatusForbidden,
+			want:   true,
+		},
+		{
+			name:   "Server error",
+			app:    application{LogSamplingRate: 0.000001},
+			status: http.StatusBadGateway,
+			want:   true,
+		},
+		{
+			name:   "Debug",
+			app:    application{LogSamplingRate: 0.000001, Debug: true},
+			status: http.StatusOK,
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.app.shouldLogRequest(tt.status))
+		})
+	}
+
+	t.Run("Share of successful requests", func(t *testing.T) {
+		app := application{LogSamplingRate: 0.1}
+
+		logged := 0
+		for i := 0; i < 10000; i++ {
+			if app.shouldLogRequest(http.StatusOK) {
+				logged++
+			}
+		}
+
+		assert.InDelta(t, 1000, logged, 200)
+	})
+}
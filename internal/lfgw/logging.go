@@ -1,6 +1,7 @@
 package lfgw
 
 import (
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -31,9 +32,29 @@ func (s stdErrorLogWrapper) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-// configureLogging configures zerolog and sets the respective fields in the application struct
+// configureLogging configures zerolog and sets the respective fields in the application struct. Logs are sent to app.SyslogAddress or written to app.LogFile if either is set, stdout is used otherwise.
 func (app *application) configureLogging() {
-	zlog.Logger = zlog.Output(os.Stdout)
+	var out io.Writer = os.Stdout
+
+	var outputErr error
+	switch {
+	case app.SyslogAddress != "":
+		if app.syslog == nil {
+			app.syslog, outputErr = newSyslogWriter(app.SyslogAddress, app.SyslogFacility, app.SyslogAppName, app.logFormatter(true))
+		}
+		if app.syslog != nil {
+			out = app.syslog
+		}
+	case app.LogFile != "":
+		if app.logFile == nil {
+			app.logFile, outputErr = newLogFile(app.LogFile, app.LogFileMaxSizeBytes, app.LogFileMaxAge, app.LogFileMaxBackups)
+		}
+		if app.logFile != nil {
+			out = app.logFile
+		}
+	}
+
+	zlog.Logger = zlog.Output(out)
 	app.logger = &zlog.Logger
 	logWrapper := stdErrorLogWrapper{logger: app.logger}
 	// NOTE: don't delete log.Lshortfile
@@ -42,13 +63,36 @@ func (app *application) configureLogging() {
 	zerolog.CallerMarshalFunc = app.lshortfile
 	zerolog.DurationFieldUnit = time.Second
 
-	if app.LogFormat == "pretty" {
-		zlog.Logger = zlog.Output(zerolog.ConsoleWriter{Out: os.Stdout, NoColor: app.LogNoColor})
+	app.accessLogOut = out
+
+	// Entries are formatted by the syslog writer itself, so severities can be derived from levels
+	if app.syslog == nil {
+		zlog.Logger = zlog.Output(app.logFormatter(app.LogNoColor)(out))
 	}
 
 	if app.Debug {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
+
+	// Logs are written to stdout then
+	if outputErr != nil {
+		app.logger.Fatal().Caller().
+			Err(outputErr).Msg("")
+	}
+}
+
+// logFormatter returns a function wrapping a writer, so JSON entries written by zerolog are converted into app.LogFormat.
+func (app *application) logFormatter(noColor bool) func(out io.Writer) io.Writer {
+	return func(out io.Writer) io.Writer {
+		switch app.LogFormat {
+		case "pretty":
+			return zerolog.ConsoleWriter{Out: out, NoColor: noColor}
+		case logFormatLogfmt:
+			return logfmtWriter{out: out}
+		default:
+			return out
+		}
+	}
 }
 
 // lshortfile implements Lshortfile equivalent for zerolog's CallerMarshalFunc.
@@ -75,14 +119,26 @@ func (app *application) enrichLogContext(r *http.Request, field string, value st
 	}
 }
 
-// enrichDebugLogContext adds a custom field and a value to zerolog context if logging level is set to Debug.
+// enrichDebugLogContext adds a custom field and a value to zerolog context if logging level is set to Debug or debug enrichment is enabled for the request. While it's only requested (X-LFGW-Debug), the field is kept aside until the caller is allowed to use it.
 func (app *application) enrichDebugLogContext(r *http.Request, field string, value string) {
-	if app.Debug {
-		if field != "" && value != "" {
-			log := zerolog.Ctx(r.Context())
-			log.UpdateContext(func(c zerolog.Context) zerolog.Context {
-				return c.Str(field, value)
-			})
+	if field == "" || value == "" {
+		return
+	}
+
+	if !app.Debug {
+		rd, ok := r.Context().Value(contextKeyRequestDebug).(*requestDebug)
+		if !ok {
+			return
+		}
+
+		if !rd.enabled {
+			rd.pending = append(rd.pending, debugField{name: field, value: value})
+			return
 		}
 	}
+
+	log := zerolog.Ctx(r.Context())
+	log.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str(field, value)
+	})
 }
@@ -3,15 +3,23 @@ package lfgw
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"os"
+	"regexp"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	oidc "github.com/coreos/go-oidc/v3/oidc"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
+	"github.com/weisdd/lfgw/internal/keycloak"
+	"github.com/weisdd/lfgw/internal/kubernetes"
 	"github.com/weisdd/lfgw/internal/querymodifier"
 	"go.uber.org/automaxprocs/maxprocs"
 )
@@ -19,29 +27,189 @@ import (
 // Define an application struct to hold the application-wide dependencies for the
 // web application.
 type application struct {
-	UpstreamURL             *url.URL
-	OIDCRealmURL            string
-	OIDCClientID            string
-	ACLPath                 string
-	AssumedRolesEnabled     bool
-	EnableDeduplication     bool
-	OptimizeExpressions     bool
-	SafeMode                bool
-	SetProxyHeaders         bool
-	SetGomaxProcs           bool
-	Debug                   bool
-	LogFormat               string
-	LogNoColor              bool
-	LogRequests             bool
-	Port                    int
-	ReadTimeout             time.Duration
-	WriteTimeout            time.Duration
-	GracefulShutdownTimeout time.Duration
-	errorLog                *log.Logger
-	ACLs                    querymodifier.ACLs
-	proxy                   *httputil.ReverseProxy
-	verifier                *oidc.IDTokenVerifier
-	logger                  *zerolog.Logger
+	UpstreamURL                  *url.URL
+	UpstreamRedirects            string
+	UpstreamSigV4Region          string
+	UpstreamSigV4Service         string
+	sigV4                        *sigV4Signer
+	SentryDSN                    string
+	SentryEnvironment            string
+	errorReporter                *errorReporter
+	VaultAddr                    string
+	VaultToken                   string
+	VaultNamespace               string
+	VaultKubernetesRole          string
+	VaultKubernetesMount         string
+	VaultRefreshInterval         time.Duration
+	secretLeases                 []*leasedSecret
+	rotatedSecrets               *rotatedSecrets
+	ExternalURL                  *url.URL
+	RoutePrefix                  string
+	OIDCRealmURL                 string
+	OIDCClientID                 string
+	OIDCCacheSize                int
+	OIDCCacheTTL                 time.Duration
+	RolesClaims                  []string
+	ACLSource                    string
+	ACLPath                      string
+	ACLConfigMap                 string
+	ACLConfigMapKey              string
+	ACLURL                       string
+	ACLURLToken                  string
+	ACLURLRefreshInterval        time.Duration
+	ACLAutoReload                bool
+	EnforcedLabel                string
+	KubernetesACLAdminNamespace  string
+	KubernetesRBACUsernameClaim  string
+	KubernetesRBACUsernamePrefix string
+	KubernetesRBACGroupsPrefix   string
+	KubernetesRBACCacheTTL       time.Duration
+	AssumedRolesEnabled          bool
+	AssumedRolesPrefix           string
+	AssumedRolesPattern          string
+	AssumedRolesVerifyNamespaces bool
+	AssumedRolesCacheTTL         time.Duration
+	DefaultRole                  string
+	DefaultACL                   string
+	SharedNamespaces             []string
+	EnableDeduplication          bool
+	OptimizeExpressions          bool
+	UnlabeledMetrics             []string
+	UnlabeledMetricsPolicy       string
+	SafeMode                     bool
+	NonAPIPathsPolicy            string
+	APIPathPrefixes              []string
+	QueryCatalogPath             string
+	ErrorMessagesPath            string
+	SetProxyHeaders              bool
+	RequestIDHeader              string
+	ScrubResponseHeaders         []string
+	HSTSMaxAge                   time.Duration
+	ContentTypeNosniff           bool
+	ResponseCompression          bool
+	ContentSecurityPolicy        string
+	UIPathPrefix                 string
+	UIHomePath                   string
+	SetGomaxProcs                bool
+	AdminToken                   string
+	SecondaryAdminToken          string
+	APIKeysPath                  string
+	APIKeysMaxTTL                time.Duration
+	ClusterPeers                 []string
+	ClusterService               string
+	ClusterPeerScheme            string
+	ProtectMetrics               bool
+	EnableLifecycle              bool
+	NamespaceMetricsAllowlist    []string
+	RoleMetrics                  string
+	ReadAfterWriteWindow         time.Duration
+	RequestTag                   string
+	RequestTagMode               string
+	RequestTagParam              string
+	SLOAvailabilityTarget        float64
+	SLOLatencyTarget             float64
+	SLOLatencyThreshold          time.Duration
+	FaultInjection               bool
+	SourceIPHeader               string
+	MaxTokenAge                  time.Duration
+	AllowedAZPs                  []string
+	ClaimsEnrichers              []string
+	ClaimsAdapter                string
+	AzureADGraphLookup           bool
+	AzureADTenantID              string
+	AzureADClientID              string
+	AzureADClientSecret          string
+	GoogleHostedDomains          []string
+	TokenExchange                bool
+	TokenExchangeURL             string
+	TokenExchangeClientID        string
+	TokenExchangeClientSecret    string
+	TokenExchangeAudience        string
+	TokenExchangeScope           string
+	ACLConsistencyCheckInterval  time.Duration
+	KeycloakAdminURL             string
+	KeycloakAdminClientID        string
+	KeycloakAdminClientSecret    string
+	KeycloakRoleClients          []string
+	KeycloakRoleSyncInterval     time.Duration
+	KeycloakRoleSyncPattern      string
+	KeycloakRoleSyncACL          string
+	DeepHealthcheck              bool
+	CanaryInterval               time.Duration
+	CanaryQueries                []string
+	CanaryToken                  string
+	CanaryClientID               string
+	CanaryClientSecret           string
+	ProfileWatchdogDir           string
+	ProfileWatchdogRSSBytes      uint64
+	ProfileWatchdogGoroutines    int
+	ProfileWatchdogInterval      time.Duration
+	ProfileWatchdogCooldown      time.Duration
+	ExecutionTraceDir            string
+	ExecutionTraceSampleRate     float64
+	ExecutionTraceThreshold      time.Duration
+	SlowRequestThreshold         time.Duration
+	RequestSnapshots             int
+	MaxParamLength               int
+	MaxParams                    int
+	Debug                        bool
+	ValidateUpstreamResponses    bool
+	LogFormat                    string
+	LogNoColor                   bool
+	LogRequests                  bool
+	LogSamplingRate              float64
+	LogFile                      string
+	LogFileMaxSizeBytes          uint64
+	LogFileMaxAge                time.Duration
+	LogFileMaxBackups            int
+	logFile                      *logFile
+	SyslogAddress                string
+	SyslogFacility               string
+	SyslogAppName                string
+	syslog                       *syslogWriter
+	Port                         int
+	ReadTimeout                  time.Duration
+	WriteTimeout                 time.Duration
+	GracefulShutdownTimeout      time.Duration
+	DrainGracePeriod             time.Duration
+	FeatureFlags                 []string
+	features                     map[string]bool
+	errorLog                     *log.Logger
+	accessLogOut                 io.Writer
+	ACLs                         querymodifier.ACLs
+	acls                         *aclsState
+	proxy                        *httputil.ReverseProxy
+	verifier                     *oidc.IDTokenVerifier
+	oidcCache                    *oidcCache
+	oidcTokenURL                 string
+	tokenExchanger               *tokenExchanger
+	apiKeys                      *apiKeyStore
+	recentWrites                 *recentWrites
+	slo                          *sloTracker
+	faults                       *faultInjector
+	maintenanceMode              *maintenanceMode
+	draining                     *atomic.Bool
+	clusterClient                *http.Client
+	recentDenials                *recentDenials
+	requestSnapshots             *snapshotRing
+	canaryCredentials            *canaryCredentials
+	queryCatalog                 *queryCatalog
+	errorMessages                *errorMessages
+	unlabeledMetrics             *regexp.Regexp
+	keycloakClient               *keycloak.Client
+	keycloakDiscoveredACLs       querymodifier.ACLs
+	keycloakSyncedRoles          map[string]struct{}
+	claimsEnrichers              []ClaimsEnricher
+	claimsAdapter                ClaimsEnricher
+	assumedRoles                 querymodifier.AssumedRoles
+	assumedNamespaces            *assumedNamespacesCache
+	kubernetesClient             *kubernetes.Client
+	kubernetesRBACCache          *kubernetesRBACCache
+	remoteACLETag                string
+	server                       *http.Server
+	tasks                        *backgroundTasks
+	buildInfo                    BuildInfo
+	logger                       *zerolog.Logger
 }
 
 // Run is used as an entrypoint for cli
@@ -63,25 +231,162 @@ func newApplication(c *cli.Context) (application, error) {
 		return application{}, fmt.Errorf("failed to parse upstream-url: %s", err)
 	}
 
+	var externalURL *url.URL
+	if c.String("external-url") != "" {
+		externalURL, err = url.Parse(c.String("external-url"))
+		if err != nil {
+			return application{}, fmt.Errorf("failed to parse external-url: %s", err)
+		}
+	}
+
+	routePrefix := c.String("route-prefix")
+	if routePrefix == "" && externalURL != nil {
+		routePrefix = externalURL.Path
+	}
+
 	app := application{
-		UpstreamURL:             upstreamURL,
-		OIDCRealmURL:            c.String("oidc-realm-url"),
-		OIDCClientID:            c.String("oidc-client-id"),
-		ACLPath:                 c.String("acl-path"),
-		AssumedRolesEnabled:     c.Bool("assumed-roles"),
-		EnableDeduplication:     c.Bool("enable-deduplication"),
-		OptimizeExpressions:     c.Bool("optimize-expressions"),
-		SafeMode:                c.Bool("safe-mode"),
-		SetProxyHeaders:         c.Bool("set-proxy-headers"),
-		SetGomaxProcs:           c.Bool("set-gomax-procs"),
-		Debug:                   c.Bool("debug"),
-		LogFormat:               c.String("log-format"),
-		LogNoColor:              c.Bool("log-no-color"),
-		LogRequests:             c.Bool("log-requests"),
-		Port:                    c.Int("port"),
-		ReadTimeout:             c.Duration("read-timeout"),
-		WriteTimeout:            c.Duration("write-timeout"),
-		GracefulShutdownTimeout: c.Duration("graceful-shutdown-timeout"),
+		UpstreamURL:                  upstreamURL,
+		UpstreamRedirects:            c.String("upstream-redirects"),
+		UpstreamSigV4Region:          c.String("upstream-sigv4-region"),
+		UpstreamSigV4Service:         c.String("upstream-sigv4-service"),
+		SentryDSN:                    c.String("sentry-dsn"),
+		SentryEnvironment:            c.String("sentry-environment"),
+		VaultAddr:                    c.String("vault-addr"),
+		VaultToken:                   c.String("vault-token"),
+		VaultNamespace:               c.String("vault-namespace"),
+		VaultKubernetesRole:          c.String("vault-kubernetes-role"),
+		VaultKubernetesMount:         c.String("vault-kubernetes-mount"),
+		VaultRefreshInterval:         c.Duration("vault-refresh-interval"),
+		ExternalURL:                  externalURL,
+		RoutePrefix:                  strings.TrimRight(routePrefix, "/"),
+		OIDCRealmURL:                 c.String("oidc-realm-url"),
+		OIDCClientID:                 c.String("oidc-client-id"),
+		OIDCCacheSize:                c.Int("oidc-cache-size"),
+		OIDCCacheTTL:                 c.Duration("oidc-cache-ttl"),
+		RolesClaims:                  c.StringSlice("roles-claim"),
+		ACLSource:                    c.String("acl-source"),
+		ACLPath:                      c.String("acl-path"),
+		ACLConfigMap:                 c.String("acl-configmap"),
+		ACLConfigMapKey:              c.String("acl-configmap-key"),
+		ACLURL:                       c.String("acl-url"),
+		ACLURLToken:                  c.String("acl-url-token"),
+		ACLURLRefreshInterval:        c.Duration("acl-url-refresh-interval"),
+		ACLAutoReload:                c.Bool("acl-auto-reload"),
+		EnforcedLabel:                c.String("enforced-label"),
+		KubernetesACLAdminNamespace:  c.String("kubernetes-acl-admin-namespace"),
+		KubernetesRBACUsernameClaim:  c.String("kubernetes-rbac-username-claim"),
+		KubernetesRBACUsernamePrefix: c.String("kubernetes-rbac-username-prefix"),
+		KubernetesRBACGroupsPrefix:   c.String("kubernetes-rbac-groups-prefix"),
+		KubernetesRBACCacheTTL:       c.Duration("kubernetes-rbac-cache-ttl"),
+		AssumedRolesEnabled:          c.Bool("assumed-roles"),
+		AssumedRolesPrefix:           c.String("assumed-roles-prefix"),
+		AssumedRolesPattern:          c.String("assumed-roles-pattern"),
+		AssumedRolesVerifyNamespaces: c.Bool("assumed-roles-verify-namespaces"),
+		AssumedRolesCacheTTL:         c.Duration("assumed-roles-cache-ttl"),
+		DefaultRole:                  c.String("default-role"),
+		DefaultACL:                   c.String("default-acl"),
+		SharedNamespaces:             c.StringSlice("shared-namespaces"),
+		EnableDeduplication:          c.Bool("enable-deduplication"),
+		OptimizeExpressions:          c.Bool("optimize-expressions"),
+		UnlabeledMetrics:             c.StringSlice("unlabeled-metrics"),
+		UnlabeledMetricsPolicy:       c.String("unlabeled-metrics-policy"),
+		SafeMode:                     c.Bool("safe-mode"),
+		NonAPIPathsPolicy:            c.String("non-api-paths-policy"),
+		APIPathPrefixes:              c.StringSlice("api-path-prefixes"),
+		QueryCatalogPath:             c.String("query-catalog-path"),
+		ErrorMessagesPath:            c.String("error-messages-path"),
+		SetProxyHeaders:              c.Bool("set-proxy-headers"),
+		RequestIDHeader:              c.String("request-id-header"),
+		ScrubResponseHeaders:         c.StringSlice("scrub-response-headers"),
+		HSTSMaxAge:                   c.Duration("hsts-max-age"),
+		ContentTypeNosniff:           c.Bool("content-type-nosniff"),
+		ResponseCompression:          c.Bool("response-compression"),
+		ContentSecurityPolicy:        c.String("content-security-policy"),
+		UIPathPrefix:                 strings.TrimRight(c.String("ui-path-prefix"), "/"),
+		UIHomePath:                   c.String("ui-home-path"),
+		SetGomaxProcs:                c.Bool("set-gomax-procs"),
+		AdminToken:                   c.String("admin-token"),
+		SecondaryAdminToken:          c.String("secondary-admin-token"),
+		APIKeysPath:                  c.String("api-keys-path"),
+		APIKeysMaxTTL:                c.Duration("api-keys-max-ttl"),
+		ClusterPeers:                 c.StringSlice("cluster-peers"),
+		ClusterService:               c.String("cluster-service"),
+		ClusterPeerScheme:            c.String("cluster-peer-scheme"),
+		ProtectMetrics:               c.Bool("protect-metrics"),
+		EnableLifecycle:              c.Bool("enable-lifecycle"),
+		NamespaceMetricsAllowlist:    c.StringSlice("namespace-metrics-allowlist"),
+		RoleMetrics:                  c.String("role-metrics"),
+		ReadAfterWriteWindow:         c.Duration("read-after-write-window"),
+		RequestTag:                   c.String("request-tag"),
+		RequestTagMode:               c.String("request-tag-mode"),
+		RequestTagParam:              c.String("request-tag-param"),
+		SLOAvailabilityTarget:        c.Float64("slo-availability-target"),
+		SLOLatencyTarget:             c.Float64("slo-latency-target"),
+		SLOLatencyThreshold:          c.Duration("slo-latency-threshold"),
+		FaultInjection:               c.Bool("fault-injection"),
+		SourceIPHeader:               c.String("source-ip-header"),
+		MaxTokenAge:                  c.Duration("max-token-age"),
+		AllowedAZPs:                  c.StringSlice("allowed-azp"),
+		ClaimsEnrichers:              c.StringSlice("claims-enrichers"),
+		ClaimsAdapter:                c.String("claims-adapter"),
+		AzureADGraphLookup:           c.Bool("azure-ad-graph-lookup"),
+		AzureADTenantID:              c.String("azure-ad-tenant-id"),
+		AzureADClientID:              c.String("azure-ad-client-id"),
+		AzureADClientSecret:          c.String("azure-ad-client-secret"),
+		GoogleHostedDomains:          c.StringSlice("google-hosted-domains"),
+		TokenExchange:                c.Bool("token-exchange"),
+		TokenExchangeURL:             c.String("token-exchange-url"),
+		TokenExchangeClientID:        c.String("token-exchange-client-id"),
+		TokenExchangeClientSecret:    c.String("token-exchange-client-secret"),
+		TokenExchangeAudience:        c.String("token-exchange-audience"),
+		TokenExchangeScope:           c.String("token-exchange-scope"),
+		ACLConsistencyCheckInterval:  c.Duration("acl-consistency-check-interval"),
+		KeycloakAdminURL:             c.String("keycloak-admin-url"),
+		KeycloakAdminClientID:        c.String("keycloak-admin-client-id"),
+		KeycloakAdminClientSecret:    c.String("keycloak-admin-client-secret"),
+		KeycloakRoleClients:          c.StringSlice("keycloak-role-clients"),
+		KeycloakRoleSyncInterval:     c.Duration("keycloak-role-sync-interval"),
+		KeycloakRoleSyncPattern:      c.String("keycloak-role-sync-pattern"),
+		KeycloakRoleSyncACL:          c.String("keycloak-role-sync-acl"),
+		DeepHealthcheck:              c.Bool("deep-healthcheck"),
+		CanaryInterval:               c.Duration("canary-interval"),
+		CanaryQueries:                splitCanaryQueries(c.String("canary-queries")),
+		CanaryToken:                  c.String("canary-token"),
+		CanaryClientID:               c.String("canary-client-id"),
+		CanaryClientSecret:           c.String("canary-client-secret"),
+		ProfileWatchdogDir:           c.String("profile-watchdog-dir"),
+		ProfileWatchdogRSSBytes:      c.Uint64("profile-watchdog-rss-bytes"),
+		ProfileWatchdogGoroutines:    c.Int("profile-watchdog-goroutines"),
+		ProfileWatchdogInterval:      c.Duration("profile-watchdog-interval"),
+		ProfileWatchdogCooldown:      c.Duration("profile-watchdog-cooldown"),
+		ExecutionTraceDir:            c.String("execution-trace-dir"),
+		ExecutionTraceSampleRate:     c.Float64("execution-trace-sample-rate"),
+		ExecutionTraceThreshold:      c.Duration("execution-trace-threshold"),
+		SlowRequestThreshold:         c.Duration("slow-request-threshold"),
+		RequestSnapshots:             c.Int("request-snapshots"),
+		MaxParamLength:               c.Int("max-param-length"),
+		MaxParams:                    c.Int("max-params"),
+		Debug:                        c.Bool("debug"),
+		ValidateUpstreamResponses:    c.Bool("validate-upstream-responses"),
+		LogFormat:                    c.String("log-format"),
+		LogNoColor:                   c.Bool("log-no-color"),
+		LogRequests:                  c.Bool("log-requests"),
+		LogSamplingRate:              c.Float64("log-sampling-rate"),
+		LogFile:                      c.String("log-file"),
+		LogFileMaxSizeBytes:          c.Uint64("log-file-max-size-bytes"),
+		LogFileMaxAge:                c.Duration("log-file-max-age"),
+		LogFileMaxBackups:            c.Int("log-file-max-backups"),
+		SyslogAddress:                c.String("syslog-address"),
+		SyslogFacility:               c.String("syslog-facility"),
+		SyslogAppName:                c.String("syslog-app-name"),
+		Port:                         c.Int("port"),
+		ReadTimeout:                  c.Duration("read-timeout"),
+		WriteTimeout:                 c.Duration("write-timeout"),
+		GracefulShutdownTimeout:      c.Duration("graceful-shutdown-timeout"),
+		DrainGracePeriod:             c.Duration("drain-grace-period"),
+		FeatureFlags:                 c.StringSlice("feature-flags"),
+		buildInfo:                    buildInfoFromContext(c),
+		acls:                         &aclsState{},
 	}
 
 	return app, nil
@@ -90,12 +395,89 @@ func newApplication(c *cli.Context) (application, error) {
 // Run starts lfgw (main-like function)
 func (app *application) Run() {
 	app.configureLogging()
+	app.registerBuildInfo()
+
+	if err := app.configureSecrets(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	app.configureFeatureFlags()
+	app.logConfigSummary()
 	app.configureACLs()
+	app.configureMaintenance()
+	app.configureDrain()
+	app.recentDenials = newRecentDenials()
+	app.configureSLO()
+	app.configureReadAfterWrite()
+	app.configureFaultInjection()
+	app.configureRequestSnapshots()
+
+	if err := app.configureAPIKeys(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	if err := app.configureUnlabeledMetrics(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	if err := app.configureQueryCatalog(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	if err := app.configureErrorMessages(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	if err := app.configureClaimsAdapter(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	if err := app.configureClaimsEnrichers(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
 
 	if err := app.configureOIDCVerifier(); err != nil {
 		app.logger.Fatal().Caller().
 			Err(err).Msg("")
 	}
+	app.configureOIDCCache()
+
+	if err := app.configureTokenExchange(app.oidcTokenURL); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	if err := app.configureCanary(app.oidcTokenURL); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	if err := app.configureKeycloakClient(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	if err := app.configureCluster(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	if err := app.configureUpstreamSigV4(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	if err := app.configureErrorReporting(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
 
 	// TODO: expose undo and move to another function?
 	if app.SetGomaxProcs {
@@ -116,7 +498,7 @@ func (app *application) Run() {
 	}
 }
 
-// configureACLs logs assumed roles mode, verifies current ACLs settings (assumed roles, aclpath), loads the ACLs from a file and logs roles if needed
+// configureACLs logs assumed roles mode, verifies current ACLs settings (assumed roles, aclpath), loads the ACLs from a file (or from Kubernetes) and logs roles if needed
 func (app *application) configureACLs() {
 	// Just to make sure our logging calls are always safe
 	if app.logger == nil {
@@ -131,6 +513,59 @@ func (app *application) configureACLs() {
 			Msg("Assumed roles mode is off")
 	}
 
+	assumedRoles, err := querymodifier.NewAssumedRoles(app.AssumedRolesPrefix, app.AssumedRolesPattern)
+	if err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+	app.assumedRoles = assumedRoles
+
+	if err := app.configureAssumedNamespaces(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msgf("Failed to configure verification of assumed roles")
+	}
+
+	if err := app.validateDefaultACL(); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msg("")
+	}
+
+	if app.ACLURL != "" {
+		if err := app.configureRemoteACLs(); err != nil {
+			app.logger.Fatal().Caller().
+				Err(err).Msgf("Failed to load ACL from URL")
+		}
+
+		return
+	}
+
+	if app.ACLConfigMap != "" {
+		if err := app.configureConfigMapACLs(); err != nil {
+			app.logger.Fatal().Caller().
+				Err(err).Msgf("Failed to load ACL from ConfigMap")
+		}
+
+		return
+	}
+
+	if app.ACLSource == aclSourceKubernetes {
+		if err := app.configureKubernetesACLs(); err != nil {
+			app.logger.Fatal().Caller().
+				Err(err).Msgf("Failed to load ACL from Kubernetes")
+		}
+
+		return
+	}
+
+	if app.ACLSource == aclSourceKubernetesRBAC {
+		if err := app.configureKubernetesRBAC(); err != nil {
+			app.logger.Fatal().Caller().
+				Err(err).Msgf("Failed to configure Kubernetes RBAC")
+		}
+
+		return
+	}
+
 	if app.ACLPath == "" {
 		// NOTE: the condition should never happen as it's filtered out by "Before" functionality of cli, though left just in case
 		if !app.AssumedRolesEnabled {
@@ -144,17 +579,51 @@ func (app *application) configureACLs() {
 		return
 	}
 
-	var err error
+	document, err := os.ReadFile(app.ACLPath)
+	if err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msgf("Failed to load ACL")
+	}
 
-	app.ACLs, err = querymodifier.NewACLsFromFile(app.ACLPath)
+	acls, warnings, err := querymodifier.NewACLsFromBytes(document, app.EnforcedLabel)
 	if err != nil {
 		app.logger.Fatal().Caller().
 			Err(err).Msgf("Failed to load ACL")
 	}
 
-	for role, acl := range app.ACLs {
+	if err := app.handleDeprecations(app.ACLPath, warnings); err != nil {
+		app.logger.Fatal().Caller().
+			Err(err).Msgf("Failed to load ACL")
+	}
+
+	app.logRoleDefinitions(acls)
+	app.setACLsDocument(acls, document)
+	aclLastSuccessfulReload.Set(float64(time.Now().Unix()))
+
+	app.logACLSummary(nil, acls)
+}
+
+// logRoleDefinitions logs every role along with the label filters it's converted to.
+func (app *application) logRoleDefinitions(acls querymodifier.ACLs) {
+	for role, acl := range acls {
+		if acl.RolePattern != nil {
+			app.logger.Info().Caller().
+				Msgf("Loaded role pattern %s", acl.RolePattern)
+			continue
+		}
+
 		app.logger.Info().Caller().
-			Msgf("Loaded role definition for %s: %q (converted to %s)", role, acl.RawACL, acl.LabelFilter.AppendString(nil))
+			Msgf("Loaded role definition for %s: %q (converted to %s)", role, acl.RawACL, app.labelFiltersString(acl))
+
+		if len(acl.SourceCIDRs) > 0 {
+			app.logger.Info().Caller().
+				Msgf("Role %s is restricted to source networks: %v", role, acl.SourceCIDRs)
+		}
+
+		if acl.MaxTokenAge > 0 || len(acl.AllowedAZPs) > 0 {
+			app.logger.Info().Caller().
+				Msgf("Role %s is bound to tokens (max age: %s, authorized parties: %v)", role, acl.MaxTokenAge, acl.AllowedAZPs)
+		}
 	}
 }
 
@@ -179,6 +648,7 @@ func (app *application) configureOIDCVerifier() error {
 		ClientID: app.OIDCClientID,
 	}
 	app.verifier = provider.Verifier(oidcConfig)
+	app.oidcTokenURL = provider.Endpoint().TokenURL
 
 	return nil
 }
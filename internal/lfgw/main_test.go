@@ -51,10 +51,30 @@ func Test_newApplication(t *testing.T) {
 			name: "set-gomax-procs",
 			want: application{SetGomaxProcs: true},
 		},
+		{
+			name: "response-compression",
+			want: application{ResponseCompression: true},
+		},
 		{
 			name: "assumed-roles",
 			want: application{AssumedRolesEnabled: true},
 		},
+		{
+			name: "acl-auto-reload",
+			want: application{ACLAutoReload: true},
+		},
+		{
+			name: "protect-metrics",
+			want: application{ProtectMetrics: true},
+		},
+		{
+			name: "token-exchange",
+			want: application{TokenExchange: true},
+		},
+		{
+			name: "deep-healthcheck",
+			want: application{DeepHealthcheck: true},
+		},
 	}
 
 	for _, tt := range tests {
@@ -65,6 +85,8 @@ func Test_newApplication(t *testing.T) {
 
 			// Needed since Parse is called in the function
 			tt.want.UpstreamURL = &url.URL{}
+			tt.want.buildInfo = BuildInfo{Version: "unknown", Commit: "unknown", Date: "unknown", GoVersion: "unknown"}
+			tt.want.acls = &aclsState{}
 
 			got, err := newApplication(c)
 			assert.Nil(t, err)
@@ -74,67 +96,436 @@ func Test_newApplication(t *testing.T) {
 
 	t.Run("Full application struct", func(t *testing.T) {
 		upstreamURL := "http://localhost"
+		upstreamRedirects := "follow"
+		upstreamSigV4Region := "eu-west-1"
+		upstreamSigV4Service := "aps"
+		sentryDSN := "https://key@sentry.example.com/1"
+		sentryEnvironment := "production"
+		vaultAddr := "https://vault.example.com:8200"
+		vaultToken := "hvs.token"
+		vaultNamespace := "team-a"
+		vaultKubernetesRole := "lfgw"
+		vaultKubernetesMount := "kubernetes-prod"
+		vaultRefreshInterval := 10 * time.Minute
+		externalURL := "https://example.com/metrics-gw/"
 		oidcRealmURL := "http://localhost2"
 		oidcClientID := "grafana"
+		oidcCacheSize := 500
+		oidcCacheTTL := 30 * time.Second
+		rolesClaims := []string{"realm_access.roles", "groups"}
+		aclSource := "kubernetes"
+		kubernetesACLAdminNamespace := "lfgw"
+		kubernetesRBACUsernameClaim := "sub"
+		kubernetesRBACUsernamePrefix := "oidc:"
+		kubernetesRBACGroupsPrefix := "oidc:"
+		kubernetesRBACCacheTTL := 30 * time.Second
 		aclPath := "ACL.yaml"
+		aclConfigMap := "lfgw/acl"
+		aclConfigMapKey := "acl.yml"
+		aclURL := "https://iam.localhost/acl.yaml"
+		aclURLToken := "acl-url-token"
+		aclURLRefreshInterval := time.Minute * 5
+		aclAutoReload := true
+		enforcedLabel := "tenant"
 		assumedRoles := true
+		assumedRolesPrefix := "ns:"
+		assumedRolesVerifyNamespaces := true
+		assumedRolesCacheTTL := 2 * time.Minute
+		defaultRole := "guest"
+		defaultACL := "user-${sub}"
 		enableDeduplication := true
 		optimizeExpression := true
+		sharedNamespaces := []string{"kube-public", "monitoring-shared"}
+		unlabeledMetrics := []string{"up", "scrape_.*"}
+		unlabeledMetricsPolicy := "skip"
 		safeMode := true
+		nonAPIPathsPolicy := "fullaccess"
+		apiPathPrefixes := []string{"/api/v1/", "/federate"}
+		queryCatalogPath := "catalog.yaml"
+		errorMessagesPath := "error-messages.yaml"
 		setProxyHeaders := true
+		requestIDHeader := "X-Request-Id"
+		scrubResponseHeaders := []string{"Server", "X-Powered-By"}
+		hstsMaxAge := 365 * 24 * time.Hour
+		contentTypeNosniff := true
+		responseCompression := true
+		contentSecurityPolicy := "default-src 'self'"
+		uiPathPrefix := "/ui"
+		uiHomePath := "/vmui/"
 		setGomaxProcs := true
+		adminToken := "admin-token"
+		secondaryAdminToken := "secondary-admin-token"
+		apiKeysPath := "/var/lib/lfgw/api-keys.json"
+		apiKeysMaxTTL := 720 * time.Hour
+		clusterPeers := []string{"http://lfgw-1.lfgw:8080", "http://lfgw-2.lfgw:8080"}
+		clusterService := "monitoring/lfgw"
+		clusterPeerScheme := "https"
+		protectMetrics := true
+		enableLifecycle := true
+		namespaceMetricsAllowlist := []string{"minio", "stolon"}
+		roleMetrics := "hash"
+		readAfterWriteWindow := 30 * time.Second
+		requestTag := "lfgw-{roles}"
+		requestTagMode := "comment"
+		requestTagParam := "tenant"
+		sloAvailabilityTarget := 0.999
+		sloLatencyTarget := 0.99
+		sloLatencyThreshold := 2 * time.Second
+		faultInjection := true
+		sourceIPHeader := "X-Forwarded-For"
+		maxTokenAge := time.Hour
+		allowedAZPs := []string{"grafana", "lfgw"}
+		claimsEnrichers := []string{"legacy-groups"}
+		claimsAdapter := "azure-ad"
+		azureADGraphLookup := true
+		azureADTenantID := "tenant"
+		azureADClientID := "lfgw-graph"
+		azureADClientSecret := "graph-secret"
+		googleHostedDomains := []string{"example.com"}
+		tokenExchange := true
+		tokenExchangeURL := "http://localhost3/token"
+		tokenExchangeClientID := "lfgw"
+		tokenExchangeClientSecret := "secret"
+		tokenExchangeAudience := "prometheus"
+		tokenExchangeScope := "openid"
+		aclConsistencyCheckInterval := 5 * time.Minute
+		keycloakAdminURL := "http://localhost2/admin/realms/monitoring"
+		keycloakAdminClientID := "lfgw-admin"
+		keycloakAdminClientSecret := "admin-secret"
+		keycloakRoleClients := []string{"grafana", "lfgw"}
+		keycloakRoleSyncInterval := 5 * time.Minute
+		keycloakRoleSyncPattern := "team-(.+)-viewer"
+		keycloakRoleSyncACL := "team-$1"
+		deepHealthcheck := true
+		canaryInterval := time.Minute
+		canaryQueries := `up{job="prometheus"}; sum by (namespace, pod) (kube_pod_info)`
+		canaryToken := "canary-token"
+		canaryClientID := "canary"
+		canaryClientSecret := "canary-secret"
+		profileWatchdogDir := "/var/lib/lfgw/profiles"
+		profileWatchdogRSSBytes := uint64(1 << 30)
+		profileWatchdogGoroutines := 10000
+		profileWatchdogInterval := 5 * time.Second
+		profileWatchdogCooldown := 15 * time.Minute
+		executionTraceDir := "/var/lib/lfgw/traces"
+		executionTraceSampleRate := 0.05
+		executionTraceThreshold := 2 * time.Second
+		slowRequestThreshold := 5 * time.Second
+		requestSnapshots := 500
+		maxParamLength := 4096
+		maxParams := 20
 		debug := true
+		validateUpstreamResponses := true
 		logFormat := "json"
 		logNoColor := true
 		logRequests := true
+		logSamplingRate := 0.1
+		logFile := "/var/log/lfgw/lfgw.log"
+		logFileMaxSizeBytes := uint64(10 << 20)
+		logFileMaxAge := 12 * time.Hour
+		logFileMaxBackups := 3
+		syslogAddress := "udp://syslog:514"
+		syslogFacility := "local0"
+		syslogAppName := "lfgw-prod"
 		port := 9999
 		readTimeout := 6 * time.Second
 		writeTimeout := 7 * time.Second
 		gracefulShutdownTimeout := 8 * time.Second
+		drainGracePeriod := 9 * time.Second
+		featureFlags := []string{"strict-acls"}
 
 		set := flag.NewFlagSet("test", 0)
 		set.String("upstream-url", upstreamURL, "doc")
+		set.String("upstream-redirects", upstreamRedirects, "doc")
+		set.String("upstream-sigv4-region", upstreamSigV4Region, "doc")
+		set.String("upstream-sigv4-service", upstreamSigV4Service, "doc")
+		set.String("sentry-dsn", sentryDSN, "doc")
+		set.String("sentry-environment", sentryEnvironment, "doc")
+		set.String("vault-addr", vaultAddr, "doc")
+		set.String("vault-token", vaultToken, "doc")
+		set.String("vault-namespace", vaultNamespace, "doc")
+		set.String("vault-kubernetes-role", vaultKubernetesRole, "doc")
+		set.String("vault-kubernetes-mount", vaultKubernetesMount, "doc")
+		set.Duration("vault-refresh-interval", vaultRefreshInterval, "doc")
+		set.String("external-url", externalURL, "doc")
+		set.String("route-prefix", "", "doc")
 		set.String("oidc-realm-url", oidcRealmURL, "doc")
 		set.String("oidc-client-id", oidcClientID, "doc")
+		set.Int("oidc-cache-size", oidcCacheSize, "doc")
+		set.Duration("oidc-cache-ttl", oidcCacheTTL, "doc")
+		set.Var(cli.NewStringSlice(rolesClaims...), "roles-claim", "doc")
+		set.String("acl-source", aclSource, "doc")
+		set.String("kubernetes-acl-admin-namespace", kubernetesACLAdminNamespace, "doc")
+		set.String("kubernetes-rbac-username-claim", kubernetesRBACUsernameClaim, "doc")
+		set.String("kubernetes-rbac-username-prefix", kubernetesRBACUsernamePrefix, "doc")
+		set.String("kubernetes-rbac-groups-prefix", kubernetesRBACGroupsPrefix, "doc")
+		set.Duration("kubernetes-rbac-cache-ttl", kubernetesRBACCacheTTL, "doc")
 		set.String("acl-path", aclPath, "doc")
+		set.String("acl-configmap", aclConfigMap, "doc")
+		set.String("acl-configmap-key", aclConfigMapKey, "doc")
+		set.String("acl-url", aclURL, "doc")
+		set.String("acl-url-token", aclURLToken, "doc")
+		set.Duration("acl-url-refresh-interval", aclURLRefreshInterval, "doc")
+		set.Bool("acl-auto-reload", aclAutoReload, "doc")
+		set.String("enforced-label", enforcedLabel, "doc")
 		set.Bool("assumed-roles", assumedRoles, "doc")
+		set.String("assumed-roles-prefix", assumedRolesPrefix, "doc")
+		set.String("assumed-roles-pattern", "", "doc")
+		set.Bool("assumed-roles-verify-namespaces", assumedRolesVerifyNamespaces, "doc")
+		set.Duration("assumed-roles-cache-ttl", assumedRolesCacheTTL, "doc")
+		set.String("default-role", defaultRole, "doc")
+		set.String("default-acl", defaultACL, "doc")
 		set.Bool("enable-deduplication", enableDeduplication, "doc")
 		set.Bool("optimize-expressions", optimizeExpression, "doc")
+		set.Var(cli.NewStringSlice(sharedNamespaces...), "shared-namespaces", "doc")
+		set.Var(cli.NewStringSlice(unlabeledMetrics...), "unlabeled-metrics", "doc")
+		set.String("unlabeled-metrics-policy", unlabeledMetricsPolicy, "doc")
 		set.Bool("safe-mode", safeMode, "doc")
+		set.String("non-api-paths-policy", nonAPIPathsPolicy, "doc")
+		set.Var(cli.NewStringSlice(apiPathPrefixes...), "api-path-prefixes", "doc")
+		set.String("query-catalog-path", queryCatalogPath, "doc")
+		set.String("error-messages-path", errorMessagesPath, "doc")
 		set.Bool("set-proxy-headers", setProxyHeaders, "doc")
+		set.String("request-id-header", requestIDHeader, "doc")
+		set.Var(cli.NewStringSlice(scrubResponseHeaders...), "scrub-response-headers", "doc")
+		set.Duration("hsts-max-age", hstsMaxAge, "doc")
+		set.Bool("content-type-nosniff", contentTypeNosniff, "doc")
+		set.Bool("response-compression", responseCompression, "doc")
+		set.String("content-security-policy", contentSecurityPolicy, "doc")
+		set.String("ui-path-prefix", uiPathPrefix+"/", "doc")
+		set.String("ui-home-path", uiHomePath, "doc")
 		set.Bool("set-gomax-procs", setGomaxProcs, "doc")
+		set.String("admin-token", adminToken, "doc")
+		set.String("secondary-admin-token", secondaryAdminToken, "doc")
+		set.String("api-keys-path", apiKeysPath, "doc")
+		set.Duration("api-keys-max-ttl", apiKeysMaxTTL, "doc")
+		set.Var(cli.NewStringSlice(clusterPeers...), "cluster-peers", "doc")
+		set.String("cluster-service", clusterService, "doc")
+		set.String("cluster-peer-scheme", clusterPeerScheme, "doc")
+		set.Bool("protect-metrics", protectMetrics, "doc")
+		set.Bool("enable-lifecycle", enableLifecycle, "doc")
+		set.Var(cli.NewStringSlice(namespaceMetricsAllowlist...), "namespace-metrics-allowlist", "doc")
+		set.String("role-metrics", roleMetrics, "doc")
+		set.Duration("read-after-write-window", readAfterWriteWindow, "doc")
+		set.String("request-tag", requestTag, "doc")
+		set.String("request-tag-mode", requestTagMode, "doc")
+		set.String("request-tag-param", requestTagParam, "doc")
+		set.Float64("slo-availability-target", sloAvailabilityTarget, "doc")
+		set.Float64("slo-latency-target", sloLatencyTarget, "doc")
+		set.Duration("slo-latency-threshold", sloLatencyThreshold, "doc")
+		set.Bool("fault-injection", faultInjection, "doc")
+		set.String("source-ip-header", sourceIPHeader, "doc")
+		set.Duration("max-token-age", maxTokenAge, "doc")
+		set.Var(cli.NewStringSlice(allowedAZPs...), "allowed-azp", "doc")
+		set.Var(cli.NewStringSlice(claimsEnrichers...), "claims-enrichers", "doc")
+		set.String("claims-adapter", claimsAdapter, "doc")
+		set.Bool("azure-ad-graph-lookup", azureADGraphLookup, "doc")
+		set.String("azure-ad-tenant-id", azureADTenantID, "doc")
+		set.String("azure-ad-client-id", azureADClientID, "doc")
+		set.String("azure-ad-client-secret", azureADClientSecret, "doc")
+		set.Var(cli.NewStringSlice(googleHostedDomains...), "google-hosted-domains", "doc")
+		set.Bool("token-exchange", tokenExchange, "doc")
+		set.String("token-exchange-url", tokenExchangeURL, "doc")
+		set.String("token-exchange-client-id", tokenExchangeClientID, "doc")
+		set.String("token-exchange-client-secret", tokenExchangeClientSecret, "doc")
+		set.String("token-exchange-audience", tokenExchangeAudience, "doc")
+		set.String("token-exchange-scope", tokenExchangeScope, "doc")
+		set.Duration("acl-consistency-check-interval", aclConsistencyCheckInterval, "doc")
+		set.String("keycloak-admin-url", keycloakAdminURL, "doc")
+		set.String("keycloak-admin-client-id", keycloakAdminClientID, "doc")
+		set.String("keycloak-admin-client-secret", keycloakAdminClientSecret, "doc")
+		set.Var(cli.NewStringSlice(keycloakRoleClients...), "keycloak-role-clients", "doc")
+		set.Duration("keycloak-role-sync-interval", keycloakRoleSyncInterval, "doc")
+		set.String("keycloak-role-sync-pattern", keycloakRoleSyncPattern, "doc")
+		set.String("keycloak-role-sync-acl", keycloakRoleSyncACL, "doc")
+		set.Bool("deep-healthcheck", deepHealthcheck, "doc")
+		set.Duration("canary-interval", canaryInterval, "doc")
+		set.String("canary-queries", canaryQueries, "doc")
+		set.String("canary-token", canaryToken, "doc")
+		set.String("canary-client-id", canaryClientID, "doc")
+		set.String("canary-client-secret", canaryClientSecret, "doc")
+		set.String("profile-watchdog-dir", profileWatchdogDir, "doc")
+		set.Uint64("profile-watchdog-rss-bytes", profileWatchdogRSSBytes, "doc")
+		set.Int("profile-watchdog-goroutines", profileWatchdogGoroutines, "doc")
+		set.Duration("profile-watchdog-interval", profileWatchdogInterval, "doc")
+		set.Duration("profile-watchdog-cooldown", profileWatchdogCooldown, "doc")
+		set.String("execution-trace-dir", executionTraceDir, "doc")
+		set.Float64("execution-trace-sample-rate", executionTraceSampleRate, "doc")
+		set.Duration("execution-trace-threshold", executionTraceThreshold, "doc")
+		set.Duration("slow-request-threshold", slowRequestThreshold, "doc")
+		set.Int("request-snapshots", requestSnapshots, "doc")
+		set.Int("max-param-length", maxParamLength, "doc")
+		set.Int("max-params", maxParams, "doc")
 		set.Bool("debug", debug, "doc")
+		set.Bool("validate-upstream-responses", validateUpstreamResponses, "doc")
 		set.String("log-format", logFormat, "doc")
 		set.Bool("log-no-color", logNoColor, "doc")
 		set.Bool("log-requests", logRequests, "doc")
+		set.Float64("log-sampling-rate", logSamplingRate, "doc")
+		set.String("log-file", logFile, "doc")
+		set.Uint64("log-file-max-size-bytes", logFileMaxSizeBytes, "doc")
+		set.Duration("log-file-max-age", logFileMaxAge, "doc")
+		set.Int("log-file-max-backups", logFileMaxBackups, "doc")
+		set.String("syslog-address", syslogAddress, "doc")
+		set.String("syslog-facility", syslogFacility, "doc")
+		set.String("syslog-app-name", syslogAppName, "doc")
 		set.Int("port", port, "doc")
 		set.Duration("read-timeout", readTimeout, "doc")
 		set.Duration("write-timeout", writeTimeout, "doc")
 		set.Duration("graceful-shutdown-timeout", gracefulShutdownTimeout, "doc")
-		c := cli.NewContext(nil, set, nil)
+		set.Duration("drain-grace-period", drainGracePeriod, "doc")
+		set.Var(cli.NewStringSlice(featureFlags...), "feature-flags", "doc")
+		buildInfo := BuildInfo{Version: "0.13.0", Commit: "8a15b8e", Date: "2024-02-01T10:00:00Z", GoVersion: "go1.21.6"}
+		c := cli.NewContext(&cli.App{Metadata: map[string]interface{}{BuildInfoMetadataKey: buildInfo}}, set, nil)
 
 		appUpstreamURL, err := url.Parse(upstreamURL)
 		assert.Nil(t, err)
 
+		appExternalURL, err := url.Parse(externalURL)
+		assert.Nil(t, err)
+
 		want := application{
-			UpstreamURL:             appUpstreamURL,
-			OIDCRealmURL:            oidcRealmURL,
-			OIDCClientID:            oidcClientID,
-			ACLPath:                 aclPath,
-			AssumedRolesEnabled:     assumedRoles,
-			OptimizeExpressions:     optimizeExpression,
-			EnableDeduplication:     enableDeduplication,
-			SafeMode:                safeMode,
-			SetProxyHeaders:         setProxyHeaders,
-			SetGomaxProcs:           setGomaxProcs,
-			Debug:                   debug,
-			LogFormat:               logFormat,
-			LogNoColor:              logNoColor,
-			LogRequests:             logRequests,
-			Port:                    port,
-			ReadTimeout:             readTimeout,
-			WriteTimeout:            writeTimeout,
-			GracefulShutdownTimeout: gracefulShutdownTimeout,
+			UpstreamURL:                  appUpstreamURL,
+			UpstreamRedirects:            upstreamRedirects,
+			UpstreamSigV4Region:          upstreamSigV4Region,
+			UpstreamSigV4Service:         upstreamSigV4Service,
+			SentryDSN:                    sentryDSN,
+			SentryEnvironment:            sentryEnvironment,
+			VaultAddr:                    vaultAddr,
+			VaultToken:                   vaultToken,
+			VaultNamespace:               vaultNamespace,
+			VaultKubernetesRole:          vaultKubernetesRole,
+			VaultKubernetesMount:         vaultKubernetesMount,
+			VaultRefreshInterval:         vaultRefreshInterval,
+			ExternalURL:                  appExternalURL,
+			RoutePrefix:                  "/metrics-gw",
+			OIDCRealmURL:                 oidcRealmURL,
+			OIDCClientID:                 oidcClientID,
+			OIDCCacheSize:                oidcCacheSize,
+			OIDCCacheTTL:                 oidcCacheTTL,
+			RolesClaims:                  rolesClaims,
+			ACLSource:                    aclSource,
+			KubernetesACLAdminNamespace:  kubernetesACLAdminNamespace,
+			KubernetesRBACUsernameClaim:  kubernetesRBACUsernameClaim,
+			KubernetesRBACUsernamePrefix: kubernetesRBACUsernamePrefix,
+			KubernetesRBACGroupsPrefix:   kubernetesRBACGroupsPrefix,
+			KubernetesRBACCacheTTL:       kubernetesRBACCacheTTL,
+			ACLPath:                      aclPath,
+			ACLConfigMap:                 aclConfigMap,
+			ACLConfigMapKey:              aclConfigMapKey,
+			ACLURL:                       aclURL,
+			ACLURLToken:                  aclURLToken,
+			ACLURLRefreshInterval:        aclURLRefreshInterval,
+			ACLAutoReload:                aclAutoReload,
+			EnforcedLabel:                enforcedLabel,
+			AssumedRolesEnabled:          assumedRoles,
+			AssumedRolesPrefix:           assumedRolesPrefix,
+			AssumedRolesVerifyNamespaces: assumedRolesVerifyNamespaces,
+			AssumedRolesCacheTTL:         assumedRolesCacheTTL,
+			DefaultRole:                  defaultRole,
+			DefaultACL:                   defaultACL,
+			OptimizeExpressions:          optimizeExpression,
+			EnableDeduplication:          enableDeduplication,
+			SharedNamespaces:             sharedNamespaces,
+			UnlabeledMetrics:             unlabeledMetrics,
+			UnlabeledMetricsPolicy:       unlabeledMetricsPolicy,
+			SafeMode:                     safeMode,
+			NonAPIPathsPolicy:            nonAPIPathsPolicy,
+			APIPathPrefixes:              apiPathPrefixes,
+			QueryCatalogPath:             queryCatalogPath,
+			ErrorMessagesPath:            errorMessagesPath,
+			SetProxyHeaders:              setProxyHeaders,
+			RequestIDHeader:              requestIDHeader,
+			ScrubResponseHeaders:         scrubResponseHeaders,
+			HSTSMaxAge:                   hstsMaxAge,
+			ContentTypeNosniff:           contentTypeNosniff,
+			ResponseCompression:          responseCompression,
+			ContentSecurityPolicy:        contentSecurityPolicy,
+			UIPathPrefix:                 uiPathPrefix,
+			UIHomePath:                   uiHomePath,
+			SetGomaxProcs:                setGomaxProcs,
+			AdminToken:                   adminToken,
+			SecondaryAdminToken:          secondaryAdminToken,
+			APIKeysPath:                  apiKeysPath,
+			APIKeysMaxTTL:                apiKeysMaxTTL,
+			ClusterPeers:                 clusterPeers,
+			ClusterService:               clusterService,
+			ClusterPeerScheme:            clusterPeerScheme,
+			ProtectMetrics:               protectMetrics,
+			EnableLifecycle:              enableLifecycle,
+			NamespaceMetricsAllowlist:    namespaceMetricsAllowlist,
+			RoleMetrics:                  roleMetrics,
+			ReadAfterWriteWindow:         readAfterWriteWindow,
+			RequestTag:                   requestTag,
+			RequestTagMode:               requestTagMode,
+			RequestTagParam:              requestTagParam,
+			SLOAvailabilityTarget:        sloAvailabilityTarget,
+			SLOLatencyTarget:             sloLatencyTarget,
+			SLOLatencyThreshold:          sloLatencyThreshold,
+			FaultInjection:               faultInjection,
+			SourceIPHeader:               sourceIPHeader,
+			MaxTokenAge:                  maxTokenAge,
+			AllowedAZPs:                  allowedAZPs,
+			ClaimsEnrichers:              claimsEnrichers,
+			ClaimsAdapter:                claimsAdapter,
+			AzureADGraphLookup:           azureADGraphLookup,
+			AzureADTenantID:              azureADTenantID,
+			AzureADClientID:              azureADClientID,
+			AzureADClientSecret:          azureADClientSecret,
+			GoogleHostedDomains:          googleHostedDomains,
+			TokenExchange:                tokenExchange,
+			TokenExchangeURL:             tokenExchangeURL,
+			TokenExchangeClientID:        tokenExchangeClientID,
+			TokenExchangeClientSecret:    tokenExchangeClientSecret,
+			TokenExchangeAudience:        tokenExchangeAudience,
+			TokenExchangeScope:           tokenExchangeScope,
+			ACLConsistencyCheckInterval:  aclConsistencyCheckInterval,
+			KeycloakAdminURL:             keycloakAdminURL,
+			KeycloakAdminClientID:        keycloakAdminClientID,
+			KeycloakAdminClientSecret:    keycloakAdminClientSecret,
+			KeycloakRoleClients:          keycloakRoleClients,
+			KeycloakRoleSyncInterval:     keycloakRoleSyncInterval,
+			KeycloakRoleSyncPattern:      keycloakRoleSyncPattern,
+			KeycloakRoleSyncACL:          keycloakRoleSyncACL,
+			DeepHealthcheck:              deepHealthcheck,
+			CanaryInterval:               canaryInterval,
+			CanaryQueries:                []string{`up{job="prometheus"}`, "sum by (namespace, pod) (kube_pod_info)"},
+			CanaryToken:                  canaryToken,
+			CanaryClientID:               canaryClientID,
+			CanaryClientSecret:           canaryClientSecret,
+			ProfileWatchdogDir:           profileWatchdogDir,
+			ProfileWatchdogRSSBytes:      profileWatchdogRSSBytes,
+			ProfileWatchdogGoroutines:    profileWatchdogGoroutines,
+			ProfileWatchdogInterval:      profileWatchdogInterval,
+			ProfileWatchdogCooldown:      profileWatchdogCooldown,
+			ExecutionTraceDir:            executionTraceDir,
+			ExecutionTraceSampleRate:     executionTraceSampleRate,
+			ExecutionTraceThreshold:      executionTraceThreshold,
+			SlowRequestThreshold:         slowRequestThreshold,
+			RequestSnapshots:             requestSnapshots,
+			MaxParamLength:               maxParamLength,
+			MaxParams:                    maxParams,
+			Debug:                        debug,
+			ValidateUpstreamResponses:    validateUpstreamResponses,
+			LogFormat:                    logFormat,
+			LogNoColor:                   logNoColor,
+			LogRequests:                  logRequests,
+			LogSamplingRate:              logSamplingRate,
+			LogFile:                      logFile,
+			LogFileMaxSizeBytes:          logFileMaxSizeBytes,
+			LogFileMaxAge:                logFileMaxAge,
+			LogFileMaxBackups:            logFileMaxBackups,
+			SyslogAddress:                syslogAddress,
+			SyslogFacility:               syslogFacility,
+			SyslogAppName:                syslogAppName,
+			Port:                         port,
+			ReadTimeout:                  readTimeout,
+			WriteTimeout:                 writeTimeout,
+			GracefulShutdownTimeout:      gracefulShutdownTimeout,
+			DrainGracePeriod:             drainGracePeriod,
+			FeatureFlags:                 featureFlags,
+			buildInfo:                    buildInfo,
+			acls:                         &aclsState{},
 		}
 
 		got, err := newApplication(c)
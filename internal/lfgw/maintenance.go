@@ -0,0 +1,133 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// maxMaintenanceSize limits the size of the maintenance state accepted through the admin endpoint
+const maxMaintenanceSize = 1 << 16
+
+// defaultMaintenanceMessage is returned to clients if maintenance mode is enabled without a message
+const defaultMaintenanceMessage = "lfgw is under maintenance, try again later"
+
+// maintenance describes maintenance mode: while it's enabled, proxied requests are answered with 503 Service Unavailable and the message, while health, metrics and admin endpoints keep working.
+type maintenance struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+// maintenanceMode keeps the current maintenance state.
+type maintenanceMode struct {
+	mu    sync.RWMutex
+	state maintenance
+}
+
+// get returns the current maintenance state, maintenance mode is disabled if m is nil.
+func (m *maintenanceMode) get() maintenance {
+	if m == nil {
+		return maintenance{}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.state
+}
+
+// set replaces the maintenance state.
+func (m *maintenanceMode) set(state maintenance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state = state
+}
+
+// configureMaintenance sets up maintenance mode (disabled until it's enabled through the admin endpoint) along with its gauge.
+func (app *application) configureMaintenance() {
+	mode := &maintenanceMode{}
+	app.maintenanceMode = mode
+
+	metrics.GetOrCreateGauge("maintenance_mode", func() float64 {
+		if mode.get().Enabled {
+			return 1
+		}
+		return 0
+	})
+}
+
+// maintenanceMiddleware answers requests with 503 Service Unavailable while maintenance mode is enabled.
+func (app *application) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := app.maintenanceMode.get()
+		if !state.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		message := state.Message
+		if message == "" {
+			message = defaultMaintenanceMessage
+		}
+
+		app.userError(w, r, http.StatusServiceUnavailable, errors.New(message))
+	})
+}
+
+// maintenanceHandler manages maintenance mode, it requires an admin token: GET returns the current state, PUT replaces it with a JSON object from the body (e.g. {"enabled": true, "message": "Upgrading the storage"}), DELETE disables maintenance mode.
+func (app *application) maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	if app.maintenanceMode == nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	if !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(app.maintenanceMode.get()); err != nil {
+			app.serverError(w, r, err)
+		}
+	case http.MethodPut:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMaintenanceSize))
+		if err != nil {
+			app.clientErrorMessage(w, http.StatusBadRequest, err)
+			return
+		}
+
+		var state maintenance
+		if err := json.Unmarshal(data, &state); err != nil {
+			app.clientErrorMessage(w, http.StatusBadRequest, err)
+			return
+		}
+
+		app.maintenanceMode.set(state)
+
+		app.logger.Warn().Caller().
+			Bool("enabled", state.Enabled).Str("message", state.Message).Msg("Maintenance mode set")
+
+		app.propagateToPeers(w, r, data)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		app.maintenanceMode.set(maintenance{})
+
+		app.logger.Warn().Caller().
+			Msg("Maintenance mode disabled")
+
+		app.propagateToPeers(w, r, nil)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut, http.MethodDelete}, ", "))
+		app.clientError(w, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,56 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_maintenance(t *testing.T) {
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:     &logger,
+		AdminToken: "secret",
+	}
+	app.configureMaintenance()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := app.nonProxiedEndpointsMiddleware(app.maintenanceMiddleware(next))
+
+	request := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", authorization)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPut, "/admin/maintenance", "Bearer wrong", `{"enabled": true}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/admin/maintenance", "Bearer secret", `{"enabled": "yes"}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodPost, "/admin/maintenance", "Bearer secret", "").Code)
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/v1/query", "", "").Code)
+
+	assert.Equal(t, http.StatusNoContent, request(http.MethodPut, "/admin/maintenance", "Bearer secret", `{"enabled": true, "message": "Upgrading the storage"}`).Code)
+
+	rr := request(http.MethodGet, "/admin/maintenance", "Bearer secret", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"enabled": true, "message": "Upgrading the storage"}`, rr.Body.String())
+
+	rr = request(http.MethodGet, "/api/v1/query", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Upgrading the storage")
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/healthz", "", "").Code, "health checks must keep working")
+
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, "/admin/maintenance", "Bearer secret", "").Code)
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/v1/query", "", "").Code)
+}
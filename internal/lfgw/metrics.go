@@ -0,0 +1,16 @@
+package lfgw
+
+import (
+	"net/http"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// contentTypePrometheusText is the content type of Prometheus text format.
+const contentTypePrometheusText = "text/plain; version=0.0.4; charset=utf-8"
+
+// writeMetrics exposes all registered metrics in Prometheus text format. NOTE: OpenMetrics is not offered even if a client prefers it, because VictoriaMetrics/metrics exposes neither metric types nor exemplars, and collectors fall back to Prometheus text format.
+func (app *application) writeMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypePrometheusText)
+	metrics.WritePrometheus(w, true)
+}
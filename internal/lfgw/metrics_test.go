@@ -0,0 +1,53 @@
+package lfgw
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_writeMetrics(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		name   string
+		accept string
+	}{
+		{
+			name:   "Prometheus text format",
+			accept: "",
+		},
+		{
+			name:   "OpenMetrics is preferred",
+			accept: "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Accept", tt.accept)
+
+			rr := httptest.NewRecorder()
+			app.writeMetrics(rr, r)
+			rs := rr.Result()
+			defer rs.Body.Close()
+
+			assert.Equal(t, contentTypePrometheusText, rs.Header.Get("Content-Type"))
+
+			b, err := io.ReadAll(rs.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Contains(t, string(b), "go_gomaxprocs")
+			assert.NotContains(t, string(b), "# EOF")
+		})
+	}
+}
@@ -2,6 +2,7 @@ package lfgw
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
@@ -17,8 +18,12 @@ type contextKey string
 const contextKeyACL = contextKey("acl")
 
 type userClaims struct {
-	Roles []string `json:"roles"`
-	Email string   `json:"email"`
+	Roles         []string `json:"roles"`
+	Email         string   `json:"email"`
+	EmailVerified *bool    `json:"email_verified,omitempty"`
+	AuthTime      int64    `json:"auth_time"`
+	AZP           string   `json:"azp"`
+	ClientID      string   `json:"client_id,omitempty"`
 }
 
 var (
@@ -28,16 +33,71 @@ var (
 	queryRangeDuration = metrics.NewSummary(`request_duration_seconds{path="/api/v1/query_range"}`)
 )
 
-// nonProxiedEndpointsMiddleware is a workaround to support healthz and metrics endpoints while forwarding everything else to an upstream.
+// nonProxiedEndpointsMiddleware is a workaround to support healthz, readyz, metrics, slo and admin endpoints while forwarding everything else to an upstream.
 func (app *application) nonProxiedEndpointsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case "/healthz":
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("OK"))
+			app.healthzHandler(w, r)
+			return
+		case "/readyz":
+			app.readyzHandler(w, r)
+			return
+		case "/version":
+			app.versionHandler(w, r)
+			return
+		case "/admin/drain":
+			app.drainHandler(w, r)
+			return
+		case "/admin/ui", "/admin/ui/", "/admin/ui/app.js":
+			app.operatorUIHandler(w, r)
+			return
+		case "/admin/status":
+			app.operatorStatusHandler(w, r)
+			return
+		case "/admin/maintenance":
+			app.maintenanceHandler(w, r)
+			return
+		case "/admin/requests":
+			app.requestSnapshotHandler(w, r)
+			return
+		case "/admin/tasks":
+			app.tasksHandler(w, r)
+			return
+		case "/admin/faults":
+			app.faultsHandler(w, r)
+			return
+		case "/admin/acl-test":
+			app.aclTestHandler(w, r)
+			return
+		case "/admin/acl-simulate":
+			app.aclSimulationHandler(w, r)
+			return
+		case "/admin/api-keys":
+			app.apiKeysHandler(w, r)
+			return
+		case "/-/reload":
+			app.reloadHandler(w, r)
+			return
+		case "/admin/acls":
+			app.aclsHandler(w, r)
+			return
+		case "/lfgw/api/roles":
+			app.rolesHandler(w, r)
+			return
+		case "/slo":
+			if app.ProtectMetrics && !app.isAdminRequest(r) {
+				app.clientError(w, http.StatusUnauthorized)
+				return
+			}
+			app.sloHandler(w, r)
 			return
 		case "/metrics":
-			metrics.WritePrometheus(w, true)
+			if app.ProtectMetrics && !app.isAdminRequest(r) {
+				app.clientError(w, http.StatusUnauthorized)
+				return
+			}
+			app.writeMetrics(w, r)
 			return
 		default:
 			next.ServeHTTP(w, r)
@@ -48,9 +108,11 @@ func (app *application) nonProxiedEndpointsMiddleware(next http.Handler) http.Ha
 // logAndMetricsMiddleware updates metrics, populates zerolog context with additional fields that are used in log entries generated by other middlewares and optionally generates access logs.
 func (app *application) logAndMetricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next = hlog.RequestIDHandler("req_id", "Request-Id")(next)
+		next = hlog.RequestIDHandler("req_id", app.RequestIDHeader)(next)
+
+		r = app.withRequestDebug(r)
 
-		if app.Debug {
+		if app.isDebugRequested(r) {
 			err := r.ParseForm()
 			if err != nil {
 				app.clientError(w, http.StatusBadRequest)
@@ -59,9 +121,11 @@ func (app *application) logAndMetricsMiddleware(next http.Handler) http.Handler
 
 			// Once r.ParseForm() is called, we need to update ContentLength, otherwise the request will fail. r.PostForm contains data for PATCH, POST, and PUT requests.
 			postForm := r.PostForm.Encode()
-			newBody := strings.NewReader(postForm)
-			r.ContentLength = newBody.Size()
-			r.Body = io.NopCloser(newBody)
+			if app.hasFormBody(r.Method) {
+				newBody := strings.NewReader(postForm)
+				r.ContentLength = newBody.Size()
+				r.Body = io.NopCloser(newBody)
+			}
 
 			// If any of those are empty, they won't get logged
 			app.enrichDebugLogContext(r, "get_params", app.unescapedURLQuery(r.URL.Query().Encode()))
@@ -72,17 +136,28 @@ func (app *application) logAndMetricsMiddleware(next http.Handler) http.Handler
 			r.PostForm = nil
 		}
 
+		r, accessLog := app.withAccessLogRecord(r)
+
 		next = hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
 			// Generate access / debug logs
-			if app.LogRequests || app.Debug {
-				// TODO: optionally change to debug?
-				hlog.FromRequest(r).Info().
-					Str("method", r.Method).
-					Stringer("url", r.URL).
-					Int("status", status).
-					Int("size", size).
-					Dur("duration", duration).
-					Msg("")
+			if app.isDebugRequest(r) || (app.LogRequests && app.shouldLogRequest(status)) {
+				if app.LogFormat == logFormatCombined {
+					app.writeCombinedLog(r, accessLog, status, size, duration)
+				} else {
+					// TODO: optionally change to debug?
+					event := hlog.FromRequest(r).Info().
+						Str("method", r.Method).
+						Stringer("url", r.URL).
+						Int("status", status).
+						Int("size", size).
+						Dur("duration", duration)
+
+					if stages, ok := r.Context().Value(contextKeyStages).(*requestStages); ok {
+						event = event.Dict("stages", stages.dict())
+					}
+
+					event.Msg("")
+				}
 			}
 
 			// Update metrics
@@ -99,17 +174,42 @@ func (app *application) logAndMetricsMiddleware(next http.Handler) http.Handler
 			}
 		})(next)
 
+		// Durations of stages are logged only in debug mode (or for debug requests), while histograms are always updated
+		if app.isDebugRequested(r) {
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyStages, &requestStages{}))
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
 
-// safeModeMiddleware forbids access to some API endpoints if safe mode is enabled.
+// safeModeMiddleware forbids access to some API endpoints if safe mode is enabled, unless the user has a role with the write capability.
 func (app *application) safeModeMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.SafeMode && app.isUnsafePath(r.URL.Path) {
+			acl, _ := r.Context().Value(contextKeyACL).(querymodifier.ACL)
+			if !acl.Write {
+				hlog.FromRequest(r).Error().Caller().
+					Msgf("Blocked a request to %s", r.URL.Path)
+				app.userError(w, r, http.StatusForbidden, nil)
+				return
+			}
+
+			app.enrichLogContext(r, "write", "true")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// methodAllowlistMiddleware forbids HTTP methods not allowed by the ACL (see methods in role definitions).
+func (app *application) methodAllowlistMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acl, ok := r.Context().Value(contextKeyACL).(querymodifier.ACL)
+		if ok && !acl.AllowsMethod(r.Method) {
 			hlog.FromRequest(r).Error().Caller().
-				Msgf("Blocked a request to %s", r.URL.Path)
-			app.clientError(w, http.StatusForbidden)
+				Strs("allowed_methods", acl.Methods).Msgf("Blocked a %s request to %s", r.Method, r.URL.Path)
+			app.userError(w, r, http.StatusForbidden, errMethodNotAllowed)
 			return
 		}
 
@@ -117,6 +217,68 @@ func (app *application) safeModeMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// pathAllowlistMiddleware forbids access to paths not allowed by the ACL (see paths in role definitions).
+func (app *application) pathAllowlistMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acl, ok := r.Context().Value(contextKeyACL).(querymodifier.ACL)
+		if ok && !acl.AllowsPath(r.URL.Path) {
+			hlog.FromRequest(r).Error().Caller().
+				Strs("allowed_paths", acl.Paths).Msgf("Blocked a request to %s", r.URL.Path)
+			app.userError(w, r, http.StatusForbidden, errPathNotAllowed)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// paramLimitsMiddleware rejects requests with too many or too long GET / POST parameters, so that adversarial mega-queries never reach the metricsql parser and the upstream.
+func (app *application) paramLimitsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.MaxParams <= 0 && app.MaxParamLength <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := app.checkParamLimits(r.URL.Query()); err != nil {
+			hlog.FromRequest(r).Error().Caller().
+				Err(err).Msg("")
+			app.clientErrorMessage(w, http.StatusRequestURITooLong, err)
+			return
+		}
+
+		// Other bodies (e.g. remote write) are not parsed by r.ParseForm(), so they're left intact
+		if !app.hasFormBody(r.Method) || !app.isFormEncoded(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		if err := app.checkParamLimits(r.PostForm); err != nil {
+			hlog.FromRequest(r).Error().Caller().
+				Err(err).Msg("")
+			app.clientErrorMessage(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+
+		// Once r.ParseForm() is called, we need to restore the body for further middlewares and the upstream
+		newBody := strings.NewReader(r.PostForm.Encode())
+		r.ContentLength = newBody.Size()
+		r.Body = io.NopCloser(newBody)
+
+		// Workaround to make further r.ParseForm() calls update r.Form and r.PostForm again
+		r.Form = nil
+		r.PostForm = nil
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // proxyHeadersMiddleware sets proxy headers.
 func (app *application) proxyHeadersMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -133,6 +295,8 @@ func (app *application) proxyHeadersMiddleware(next http.Handler) http.Handler {
 // oidcMiddleware verifies a jwt token, and, if valid and authorized, adds a respective label filter to the request context.
 func (app *application) oidcMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authStart := time.Now()
+
 		if app.verifier == nil {
 			app.serverError(w, r, errVerifierNotInitialized)
 			return
@@ -144,46 +308,151 @@ func (app *application) oidcMiddleware(next http.Handler) http.Handler {
 			hlog.FromRequest(r).Error().Caller().
 				Err(err).Msg("")
 
-			app.clientErrorMessage(w, http.StatusUnauthorized, err)
+			app.userError(w, r, http.StatusUnauthorized, err)
+			return
+		}
+
+		if app.isAPIKey(rawAccessToken) {
+			app.authenticateAPIKey(w, r, next, rawAccessToken)
 			return
 		}
 
 		ctx := r.Context()
-		accessToken, err := app.verifier.Verify(ctx, rawAccessToken)
+		accessToken, err := app.verifyToken(ctx, rawAccessToken)
 		if err != nil {
 			// Better to log to see token verification errors
 			hlog.FromRequest(r).Error().Caller().
 				Err(err).Msg("")
-			app.clientErrorMessage(w, http.StatusUnauthorized, err)
+			app.reportError(r, errorKindOIDC, "warning", err, nil)
+			app.userError(w, r, http.StatusUnauthorized, err)
 			return
 		}
 
-		var claims userClaims
-		if err := accessToken.Claims(&claims); err != nil {
-			// Claims property is not set / unmarshal errors, very unlikely to catch it
-			hlog.FromRequest(r).Error().Caller().
-				Err(err).Msg("")
-			app.clientErrorMessage(w, http.StatusUnauthorized, err)
-			return
+		claims := accessToken.claims
+		rawClaims := accessToken.rawClaims
+
+		if app.hasCustomRolesClaims() {
+			claims.Roles, err = claimsRoles(rawClaims, app.RolesClaims)
+			if err != nil {
+				hlog.FromRequest(r).Error().Caller().
+					Err(err).Msg("")
+				app.userError(w, r, http.StatusUnauthorized, err)
+				return
+			}
+		}
+
+		if len(app.claimsEnrichers) > 0 || app.claimsAdapter != nil {
+			enriched := Claims{
+				Subject: accessToken.subject,
+				Email:   claims.Email,
+				Roles:   claims.Roles,
+				Raw:     rawClaims,
+			}
+			if err := app.enrichClaims(ctx, &enriched); err != nil {
+				// Adapters reject tokens not meant for lfgw (e.g. of a foreign Google Workspace domain)
+				if errors.Is(err, errClaimsRejected) {
+					hlog.FromRequest(r).Error().Caller().
+						Err(err).Msg("")
+					app.userError(w, r, http.StatusForbidden, err)
+					return
+				}
+
+				app.serverError(w, r, err)
+				return
+			}
+
+			claims.Email = enriched.Email
+			claims.Roles = enriched.Roles
 		}
 
 		app.enrichLogContext(r, "email", claims.Email)
+		app.setAccessLogUser(r, claims.Email)
 		// NOTE: The field will contain all roles present in the token, not only those that are considered during ACL generation process
 		app.enrichDebugLogContext(r, "roles", strings.Join(claims.Roles, ", "))
+		// Roles are exposed to error message templates
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyRoles, claims.Roles))
+		app.setMetricsTenant(r, app.tokenRoles(claims))
 
-		acl, err := app.ACLs.GetUserACL(claims.Roles, app.AssumedRolesEnabled)
+		authTime := app.tokenAuthTime(claims, accessToken.issuedAt)
+		if err := app.checkTokenBinding(app.MaxTokenAge, app.AllowedAZPs, authTime, claims.AZP); err != nil {
+			hlog.FromRequest(r).Error().Caller().
+				Err(err).Msg("")
+			app.userError(w, r, http.StatusUnauthorized, err)
+			return
+		}
+
+		app.recordStage(r, stageAuth, authStart)
+		aclStart := time.Now()
+
+		roles, err := app.filterRolesBySourceIP(r, app.tokenRoles(claims))
+		if err != nil {
+			hlog.FromRequest(r).Error().Caller().
+				Err(err).Msg("")
+			app.userError(w, r, http.StatusForbidden, err)
+			return
+		}
+
+		roles, err = app.filterRolesByTokenBinding(r, roles, authTime, claims.AZP)
 		if err != nil {
 			hlog.FromRequest(r).Error().Caller().
 				Err(err).Msg("")
-			app.clientErrorMessage(w, http.StatusUnauthorized, err)
+			app.userError(w, r, http.StatusUnauthorized, err)
 			return
 		}
 
-		app.enrichDebugLogContext(r, "label_filter", string(acl.LabelFilter.AppendString(nil)))
+		roles, err = app.verifyAssumedRoles(r, roles)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		var acl querymodifier.ACL
+		if app.ACLSource == aclSourceKubernetesRBAC {
+			acl, err = app.getKubernetesRBACACL(ctx, accessToken.subject, claims.Email, roles)
+			if err != nil && !errors.Is(err, querymodifier.ErrNoMatchingRoles) {
+				app.serverError(w, r, err)
+				return
+			}
+		} else {
+			acl, err = app.getUserACL(roles)
+		}
+		if errors.Is(err, querymodifier.ErrNoMatchingRoles) && app.hasDefaultACL() {
+			app.enrichDebugLogContext(r, "default_acl", "true")
+			acl, err = app.defaultUserACL(accessToken.subject)
+		}
+		if err != nil {
+			hlog.FromRequest(r).Error().Caller().
+				Err(err).Msg("")
+			app.userError(w, r, http.StatusUnauthorized, err)
+			return
+		}
+
+		acl, err = app.withSharedNamespaces(acl)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		// Debug enrichment is allowed according to the ACL of the caller, so it's also available while impersonating a role
+		app.allowRequestDebug(r, acl)
+
+		acl, roles, err = app.impersonate(r, acl, roles)
+		if err != nil {
+			hlog.FromRequest(r).Error().Caller().
+				Err(err).Msg("")
+			app.userError(w, r, http.StatusForbidden, err)
+			return
+		}
+
+		app.enrichDebugLogContext(r, "label_filter", app.labelFiltersString(acl))
 
 		ctx = context.WithValue(ctx, contextKeyACL, acl)
+		ctx = context.WithValue(ctx, contextKeyRoles, roles)
+		ctx = context.WithValue(ctx, contextKeyIdentity, identity{Subject: accessToken.subject, Email: claims.Email, ClientID: claims.ClientID})
 		r = r.WithContext(ctx)
 
+		app.recordStage(r, stageACL, aclStart)
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -191,6 +460,8 @@ func (app *application) oidcMiddleware(next http.Handler) http.Handler {
 // rewriteRequestMiddleware rewrites a request before forwarding it to the upstream.
 func (app *application) rewriteRequestMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next := app.stageHandler(stageRewrite, time.Now(), next)
+
 		// TODO: rewrite?
 		if app.UpstreamURL == nil {
 			app.serverError(w, r, errUpstreamNotInitialized)
@@ -208,12 +479,27 @@ func (app *application) rewriteRequestMiddleware(next http.Handler) http.Handler
 		}
 
 		if app.isNotAPIRequest(r.URL.Path) {
+			if !app.isNonAPIRequestAllowed(acl) {
+				hlog.FromRequest(r).Error().Caller().
+					Msgf("Not an API request, blocked by the non-API paths policy (%s)", app.NonAPIPathsPolicy)
+				app.userError(w, r, http.StatusForbidden, nil)
+				return
+			}
+
 			hlog.FromRequest(r).Debug().Caller().
 				Msg("Not an API request, request is not modified")
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		if len(acl.ForcedParams) > 0 {
+			if err := app.applyForcedParams(r, acl.ForcedParams); err != nil {
+				app.clientError(w, http.StatusBadRequest)
+				return
+			}
+			app.enrichDebugLogContext(r, "forced_params", app.unescapedURLQuery(r.URL.RawQuery))
+		}
+
 		if acl.Fullaccess {
 			hlog.FromRequest(r).Debug().Caller().
 				Msg("User has full access, request is not modified")
@@ -221,37 +507,49 @@ func (app *application) rewriteRequestMiddleware(next http.Handler) http.Handler
 			return
 		}
 
+		// Data sent to write / import endpoints is not a form, so it can be neither rewritten nor limited to namespaces of the roles (re-encoding it as a form would silently drop it)
+		if app.isWritePath(r.URL.Path) {
+			hlog.FromRequest(r).Error().Caller().
+				Msgf("Blocked a request to %s", r.URL.Path)
+			app.userError(w, r, http.StatusForbidden, errWriteRequiresFullaccess)
+			return
+		}
+
 		err := r.ParseForm()
 		if err != nil {
 			app.clientError(w, http.StatusBadRequest)
 			return
 		}
 
-		qm := querymodifier.QueryModifier{
-			ACL:                 acl,
-			EnableDeduplication: app.EnableDeduplication,
-			OptimizeExpressions: app.OptimizeExpressions,
-		}
+		qm := app.newQueryModifier(acl)
 
 		// Adjust GET params
 		newGetParams, err := qm.GetModifiedEncodedURLValues(r.URL.Query())
 		if err != nil {
-			hlog.FromRequest(r).Error().Caller().
-				Err(err).Msg("")
-			app.clientError(w, http.StatusBadRequest)
+			app.queryRewriteError(w, r, err)
 			return
 		}
 		r.URL.RawQuery = newGetParams
 		app.enrichDebugLogContext(r, "new_get_params", app.unescapedURLQuery(newGetParams))
 
+		// Requests like GET and HEAD carry no form body, so there's nothing to rewrite there. Though, it's still better to explicitly drop the body to make sure nothing bypasses the ACL
+		if !app.hasFormBody(r.Method) {
+			app.logSkippedMetrics(r, qm)
+			app.markRewritten(r)
+			r.ContentLength = 0
+			r.Body = http.NoBody
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// For PATCH, POST, and PUT requests
 		newPostParams, err := qm.GetModifiedEncodedURLValues(r.PostForm)
 		if err != nil {
-			hlog.FromRequest(r).Error().Caller().
-				Err(err).Msg("")
-			app.clientError(w, http.StatusBadRequest)
+			app.queryRewriteError(w, r, err)
 			return
 		}
+		app.logSkippedMetrics(r, qm)
+		app.markRewritten(r)
 		newBody := strings.NewReader(newPostParams)
 		r.ContentLength = newBody.Size()
 		r.Body = io.NopCloser(newBody)
@@ -32,6 +32,12 @@ func Test_nonProxiedEndpointsMiddleware(t *testing.T) {
 			wantStatusCode:  http.StatusOK,
 			wantBodyContent: "OK",
 		},
+		{
+			name:            "/readyz",
+			path:            "/readyz",
+			wantStatusCode:  http.StatusOK,
+			wantBodyContent: "OK",
+		},
 		{
 			name:            "/metrics",
 			path:            "/metrics",
@@ -85,6 +91,39 @@ func Test_nonProxiedEndpointsMiddleware(t *testing.T) {
 			defer rs.Body.Close()
 		})
 	}
+
+	t.Run("Protected /metrics", func(t *testing.T) {
+		logger := zerolog.New(nil)
+		app := &application{
+			logger:         &logger,
+			AdminToken:     "secret",
+			ProtectMetrics: true,
+		}
+
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		for authorization, want := range map[string]int{
+			"":              http.StatusUnauthorized,
+			"Bearer random": http.StatusUnauthorized,
+			"Bearer secret": http.StatusOK,
+		} {
+			r, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Authorization", authorization)
+
+			rr := httptest.NewRecorder()
+			app.nonProxiedEndpointsMiddleware(next).ServeHTTP(rr, r)
+			rs := rr.Result()
+
+			assert.Equal(t, want, rs.StatusCode, authorization)
+
+			defer rs.Body.Close()
+		}
+	})
 }
 
 // TODO: logMiddleware add a test https://go.dev/src/net/http/httputil/reverseproxy_test.go
@@ -96,6 +135,7 @@ func Test_safeModeMiddleware(t *testing.T) {
 		path     string
 		method   string
 		safeMode bool
+		write    bool
 		want     int
 	}{
 		{
@@ -126,6 +166,29 @@ func Test_safeModeMiddleware(t *testing.T) {
 			safeMode: false,
 			want:     http.StatusOK,
 		},
+		{
+			name:     "api write (safe mode on, write role)",
+			path:     "/api/v1/write",
+			method:   http.MethodGet,
+			safeMode: true,
+			write:    true,
+			want:     http.StatusOK,
+		},
+		{
+			name:     "import (safe mode on)",
+			path:     "/api/v1/import",
+			method:   http.MethodGet,
+			safeMode: true,
+			want:     http.StatusForbidden,
+		},
+		{
+			name:     "delete series (safe mode on, write role)",
+			path:     "/api/v1/admin/tsdb/delete_series",
+			method:   http.MethodGet,
+			safeMode: true,
+			write:    true,
+			want:     http.StatusOK,
+		},
 		{
 			name:     "random path (safe mode on)",
 			path:     "/api/v1/test",
@@ -154,6 +217,7 @@ func Test_safeModeMiddleware(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyACL, querymodifier.ACL{Write: tt.write}))
 
 			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				_, _ = w.Write([]byte("OK"))
@@ -171,6 +235,212 @@ func Test_safeModeMiddleware(t *testing.T) {
 	}
 }
 
+func Test_methodAllowlistMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		methods []string
+		want    int
+	}{
+		{
+			name:   "No restrictions",
+			method: http.MethodPost,
+			want:   http.StatusOK,
+		},
+		{
+			name:    "Allowed method",
+			method:  http.MethodGet,
+			methods: []string{http.MethodGet},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "HEAD along with GET",
+			method:  http.MethodHead,
+			methods: []string{http.MethodGet},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "Not allowed method",
+			method:  http.MethodPost,
+			methods: []string{http.MethodGet},
+			want:    http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.New(nil)
+			app := &application{
+				logger: &logger,
+			}
+
+			r := httptest.NewRequest(tt.method, "/api/v1/query", nil)
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyACL, querymodifier.ACL{Methods: tt.methods}))
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("OK"))
+			})
+
+			rr := httptest.NewRecorder()
+			app.methodAllowlistMiddleware(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.want, rr.Code)
+		})
+	}
+}
+
+func Test_pathAllowlistMiddleware(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		paths []string
+		want  int
+	}{
+		{
+			name: "No restrictions",
+			path: "/api/v1/series",
+			want: http.StatusOK,
+		},
+		{
+			name:  "Allowed path",
+			path:  "/api/v1/query_range",
+			paths: []string{"/api/v1/query", "/api/v1/query_range"},
+			want:  http.StatusOK,
+		},
+		{
+			name:  "Allowed prefix",
+			path:  "/api/v1/label/namespace/values",
+			paths: []string{"/api/v1/label/*"},
+			want:  http.StatusOK,
+		},
+		{
+			name:  "Not allowed path",
+			path:  "/api/v1/series",
+			paths: []string{"/api/v1/query", "/api/v1/query_range"},
+			want:  http.StatusForbidden,
+		},
+		{
+			name:  "Path traversal",
+			path:  "/api/v1/query/../series",
+			paths: []string{"/api/v1/query*"},
+			want:  http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.New(nil)
+			app := &application{
+				logger: &logger,
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.URL.Path = tt.path
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyACL, querymodifier.ACL{Paths: tt.paths}))
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("OK"))
+			})
+
+			rr := httptest.NewRecorder()
+			app.pathAllowlistMiddleware(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.want, rr.Code)
+		})
+	}
+}
+
+func Test_paramLimitsMiddleware(t *testing.T) {
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:         &logger,
+		MaxParams:      2,
+		MaxParamLength: 20,
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		contentType    string
+		body           string
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "GET within limits",
+			method:         http.MethodGet,
+			url:            "/api/v1/query?query=up",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "GET with too many params",
+			method:         http.MethodGet,
+			url:            "/api/v1/series?match[]=a&match[]=b&match[]=c",
+			wantStatusCode: http.StatusRequestURITooLong,
+		},
+		{
+			name:           "GET with too long param",
+			method:         http.MethodGet,
+			url:            "/api/v1/query?query=" + strings.Repeat("a", 21),
+			wantStatusCode: http.StatusRequestURITooLong,
+		},
+		{
+			name:           "POST within limits",
+			method:         http.MethodPost,
+			url:            "/api/v1/query",
+			contentType:    "application/x-www-form-urlencoded",
+			body:           "query=up",
+			wantStatusCode: http.StatusOK,
+			wantBody:       "query=up",
+		},
+		{
+			name:           "POST with too long param",
+			method:         http.MethodPost,
+			url:            "/api/v1/query",
+			contentType:    "application/x-www-form-urlencoded",
+			body:           "query=" + strings.Repeat("a", 21),
+			wantStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "POST of a different type is left intact",
+			method:         http.MethodPost,
+			url:            "/api/v1/write",
+			contentType:    "application/x-protobuf",
+			body:           strings.Repeat("a", 100),
+			wantStatusCode: http.StatusOK,
+			wantBody:       strings.Repeat("a", 100),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Content-Type", tt.contentType)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.wantBody, string(body))
+
+				w.WriteHeader(http.StatusOK)
+			})
+
+			rr := httptest.NewRecorder()
+			app.paramLimitsMiddleware(next).ServeHTTP(rr, r)
+			rs := rr.Result()
+			defer rs.Body.Close()
+
+			assert.Equal(t, tt.wantStatusCode, rs.StatusCode)
+		})
+	}
+}
+
 func Test_proxyHeadersMiddleware(t *testing.T) {
 	// Just to hold reference values
 	headers := map[string]string{
@@ -250,6 +520,7 @@ func Test_oidcMiddleware(t *testing.T) {
 
 	// appHelper is needed to set up OIDC verifier in the same way as the main app
 	appHelper := application{
+		acls:         &aclsState{},
 		OIDCRealmURL: issuerURL,
 		OIDCClientID: clientID,
 		logger:       &logger,
@@ -294,6 +565,7 @@ func Test_oidcMiddleware(t *testing.T) {
 		{
 			name: "Verifier not initialized",
 			app: application{
+				acls:     &aclsState{},
 				logger:   &logger,
 				ACLs:     acls,
 				verifier: nil,
@@ -304,6 +576,7 @@ func Test_oidcMiddleware(t *testing.T) {
 		{
 			name: "No token",
 			app: application{
+				acls:     &aclsState{},
 				logger:   &logger,
 				ACLs:     acls,
 				verifier: verifier,
@@ -314,6 +587,7 @@ func Test_oidcMiddleware(t *testing.T) {
 		{
 			name: "Incorrect token: different issuer",
 			app: application{
+				acls:     &aclsState{},
 				logger:   &logger,
 				ACLs:     acls,
 				verifier: verifier,
@@ -328,6 +602,7 @@ func Test_oidcMiddleware(t *testing.T) {
 		{
 			name: "Incorrect token: expired",
 			app: application{
+				acls:     &aclsState{},
 				logger:   &logger,
 				ACLs:     acls,
 				verifier: verifier,
@@ -342,6 +617,7 @@ func Test_oidcMiddleware(t *testing.T) {
 		{
 			name: "Incorrect token: different audience",
 			app: application{
+				acls:     &aclsState{},
 				logger:   &logger,
 				ACLs:     acls,
 				verifier: verifier,
@@ -356,6 +632,7 @@ func Test_oidcMiddleware(t *testing.T) {
 		{
 			name: "No known roles, assumed roles disabled",
 			app: application{
+				acls:     &aclsState{},
 				logger:   &logger,
 				ACLs:     acls,
 				verifier: verifier,
@@ -376,6 +653,7 @@ func Test_oidcMiddleware(t *testing.T) {
 		{
 			name: "No known roles, assumed roles enabled",
 			app: application{
+				acls:                &aclsState{},
 				logger:              &logger,
 				AssumedRolesEnabled: true,
 				ACLs:                acls,
@@ -394,6 +672,99 @@ func Test_oidcMiddleware(t *testing.T) {
 			},
 			want: http.StatusOK,
 		},
+		{
+			name: "Token binding: old token",
+			app: application{
+				acls:        &aclsState{},
+				logger:      &logger,
+				ACLs:        acls,
+				MaxTokenAge: time.Hour,
+				verifier:    verifier,
+			},
+			claims: testClaims{
+				userClaims{
+					Roles:    []string{"grafana-editor"},
+					AuthTime: time.Now().Add(-time.Hour * 2).Unix(),
+				},
+				jwt.StandardClaims{
+					Audience:  clientID,
+					ExpiresAt: time.Now().Add(time.Minute * 5).Unix(),
+					IssuedAt:  time.Now().Unix(),
+					Issuer:    issuerURL,
+				},
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "Token binding: fresh token",
+			app: application{
+				acls:        &aclsState{},
+				logger:      &logger,
+				ACLs:        acls,
+				MaxTokenAge: time.Hour,
+				verifier:    verifier,
+			},
+			claims: testClaims{
+				userClaims{
+					Roles: []string{"grafana-editor"},
+				},
+				jwt.StandardClaims{
+					Audience:  clientID,
+					ExpiresAt: time.Now().Add(time.Minute * 5).Unix(),
+					IssuedAt:  time.Now().Unix(),
+					Issuer:    issuerURL,
+				},
+			},
+			want: http.StatusOK,
+		},
+		{
+			name: "Token binding: unknown azp",
+			app: application{
+				acls:        &aclsState{},
+				logger:      &logger,
+				ACLs:        acls,
+				AllowedAZPs: []string{clientID},
+				verifier:    verifier,
+			},
+			claims: testClaims{
+				userClaims{
+					Roles: []string{"grafana-editor"},
+					AZP:   "random-client-id",
+				},
+				jwt.StandardClaims{
+					Audience:  clientID,
+					ExpiresAt: time.Now().Add(time.Minute * 5).Unix(),
+					Issuer:    issuerURL,
+				},
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "Token binding: per-role requirements",
+			app: application{
+				acls:   &aclsState{},
+				logger: &logger,
+				ACLs: querymodifier.ACLs{
+					"grafana-editor": querymodifier.ACL{
+						RawACL:      "monitoring",
+						AllowedAZPs: []string{"other-client-id"},
+					},
+				},
+				verifier: verifier,
+			},
+			claims: testClaims{
+				userClaims{
+					Roles: []string{"grafana-editor"},
+					AZP:   clientID,
+				},
+				jwt.StandardClaims{
+					Audience:  clientID,
+					ExpiresAt: time.Now().Add(time.Minute * 5).Unix(),
+					Issuer:    issuerURL,
+				},
+			},
+			want: http.StatusUnauthorized,
+		},
 	}
 
 	for _, tt := range tests {
@@ -428,6 +799,7 @@ func Test_oidcMiddleware(t *testing.T) {
 
 	t.Run("Correct ACL is in the context", func(t *testing.T) {
 		app := application{
+			acls:     &aclsState{},
 			logger:   &logger,
 			ACLs:     acls,
 			verifier: verifier,
@@ -473,6 +845,56 @@ func Test_oidcMiddleware(t *testing.T) {
 
 		defer rs.Body.Close()
 	})
+
+	t.Run("Enriched claims are used for ACLs", func(t *testing.T) {
+		RegisterClaimsEnricher("test-legacy-roles", ClaimsEnricherFunc(func(ctx context.Context, claims *Claims) error {
+			for i, role := range claims.Roles {
+				claims.Roles[i] = strings.TrimPrefix(role, "legacy-")
+			}
+			return nil
+		}))
+
+		app := application{
+			acls:            &aclsState{},
+			logger:          &logger,
+			ACLs:            acls,
+			verifier:        verifier,
+			ClaimsEnrichers: []string{"test-legacy-roles"},
+		}
+		assert.Nil(t, app.configureClaimsEnrichers())
+
+		r, err := http.NewRequest(http.MethodGet, "http://lfgw/api/v1/federate", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims := testClaims{
+			userClaims{
+				Roles: []string{"legacy-grafana-editor"},
+				Email: "user@localhost",
+			},
+			jwt.StandardClaims{
+				Audience:  clientID,
+				ExpiresAt: time.Now().Add(time.Minute * 5).Unix(),
+				Issuer:    issuerURL,
+			},
+		}
+
+		rawAccessToken := oidcGenerateToken(t, claims)
+		r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", rawAccessToken))
+
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			acl, ok := r.Context().Value(contextKeyACL).(querymodifier.ACL)
+			assert.True(t, ok, errACLNotSetInContext)
+			assert.Equal(t, acl, aclEditor)
+			_, _ = w.Write([]byte("OK"))
+		})
+
+		rr := httptest.NewRecorder()
+
+		app.oidcMiddleware(next).ServeHTTP(rr, r)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
 }
 
 func Test_rewriteRequestMiddleware(t *testing.T) {
@@ -705,6 +1127,144 @@ func Test_rewriteRequestMiddleware(t *testing.T) {
 		defer rs.Body.Close()
 	})
 
+	t.Run("Method handling", func(t *testing.T) {
+		acl, err := querymodifier.NewACL("monitoring")
+		assert.Nil(t, err)
+
+		tests := []struct {
+			method         string
+			wantGetQuery   string
+			wantBody       string
+			wantStatusCode int
+		}{
+			{
+				method:         http.MethodGet,
+				wantGetQuery:   `kube_pod_info{namespace="monitoring"}`,
+				wantBody:       "",
+				wantStatusCode: http.StatusOK,
+			},
+			{
+				method:         http.MethodHead,
+				wantGetQuery:   `kube_pod_info{namespace="monitoring"}`,
+				wantBody:       "",
+				wantStatusCode: http.StatusOK,
+			},
+			{
+				method:         http.MethodPost,
+				wantGetQuery:   `kube_pod_info{namespace="monitoring"}`,
+				wantBody:       `query=up%7Bnamespace%3D%22monitoring%22%7D`,
+				wantStatusCode: http.StatusOK,
+			},
+			{
+				method:         http.MethodPut,
+				wantGetQuery:   `kube_pod_info{namespace="monitoring"}`,
+				wantBody:       `query=up%7Bnamespace%3D%22monitoring%22%7D`,
+				wantStatusCode: http.StatusOK,
+			},
+			{
+				method:         http.MethodPatch,
+				wantGetQuery:   `kube_pod_info{namespace="monitoring"}`,
+				wantBody:       `query=up%7Bnamespace%3D%22monitoring%22%7D`,
+				wantStatusCode: http.StatusOK,
+			},
+			{
+				// Body is not considered by r.ParseForm(), so it must not reach the upstream
+				method:         http.MethodDelete,
+				wantGetQuery:   `kube_pod_info{namespace="monitoring"}`,
+				wantBody:       "",
+				wantStatusCode: http.StatusOK,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.method, func(t *testing.T) {
+				body := strings.NewReader("query=up")
+				r, err := http.NewRequest(tt.method, "http://lfgw/api/v1/query?query=kube_pod_info", body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+				ctx := context.WithValue(r.Context(), contextKeyACL, acl)
+				r = r.WithContext(ctx)
+
+				next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t, tt.wantGetQuery, r.URL.Query().Get("query"))
+
+					gotBody, err := io.ReadAll(r.Body)
+					assert.Nil(t, err)
+					assert.Equal(t, tt.wantBody, string(gotBody))
+					assert.Equal(t, int64(len(tt.wantBody)), r.ContentLength)
+
+					w.WriteHeader(http.StatusOK)
+				})
+
+				rr := httptest.NewRecorder()
+				app.rewriteRequestMiddleware(next).ServeHTTP(rr, r)
+				rs := rr.Result()
+				defer rs.Body.Close()
+
+				assert.Equal(t, tt.wantStatusCode, rs.StatusCode)
+			})
+		}
+	})
+
+	t.Run("Data sent to ingestion endpoints", func(t *testing.T) {
+		app := &application{
+			logger:      &logger,
+			UpstreamURL: upstreamURL,
+			SafeMode:    true,
+		}
+
+		body := `{"metric":{"__name__":"up","namespace":"monitoring"},"values":[1],"timestamps":[1549891472010]}` + "\n"
+
+		tests := []struct {
+			name           string
+			rawACL         string
+			wantBody       string
+			wantStatusCode int
+		}{
+			{
+				name:           "Full access",
+				rawACL:         ".*",
+				wantBody:       body,
+				wantStatusCode: http.StatusOK,
+			},
+			{
+				name:           "Namespaces cannot be enforced",
+				rawACL:         "monitoring",
+				wantStatusCode: http.StatusForbidden,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := httptest.NewRequest(http.MethodPost, "http://lfgw/api/v1/import", strings.NewReader(body))
+				r.Header.Set("Content-Type", "application/json")
+
+				acl, err := querymodifier.NewACL(tt.rawACL)
+				assert.Nil(t, err)
+				acl.Write = true
+				r = r.WithContext(context.WithValue(r.Context(), contextKeyACL, acl))
+
+				var gotBody string
+				next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					data, err := io.ReadAll(r.Body)
+					assert.Nil(t, err)
+					gotBody = string(data)
+
+					w.WriteHeader(http.StatusOK)
+				})
+
+				rr := httptest.NewRecorder()
+				app.safeModeMiddleware(app.rewriteRequestMiddleware(next)).ServeHTTP(rr, r)
+
+				assert.Equal(t, tt.wantStatusCode, rr.Code)
+				assert.Equal(t, tt.wantBody, gotBody)
+			})
+		}
+	})
+
 	// TODO: log fields are added (both get / post)
 }
 
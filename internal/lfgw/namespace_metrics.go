@@ -0,0 +1,91 @@
+package lfgw
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// namespaceMetricsMiddleware counts queries and query errors per namespace referenced in the (rewritten) label filters, so it's visible which tenants drive read load. Only namespaces from app.NamespaceMetricsAllowlist are counted to keep cardinality bounded.
+func (app *application) namespaceMetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Query helpers (e.g. format_query) don't execute queries, thus they're not counted
+		if len(app.NamespaceMetricsAllowlist) == 0 || app.isNotAPIRequest(r.URL.Path) || app.isQueryHelperRequest(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		acl, ok := r.Context().Value(contextKeyACL).(querymodifier.ACL)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		// Once r.ParseForm() is called, we need to update ContentLength, otherwise the request will fail
+		if app.hasFormBody(r.Method) {
+			newBody := strings.NewReader(r.PostForm.Encode())
+			r.ContentLength = newBody.Size()
+			r.Body = io.NopCloser(newBody)
+		}
+
+		namespaces := app.referencedNamespaces(r, acl.LabelFilter.Label)
+
+		// Workaround to make further r.ParseForm() calls update r.Form and r.PostForm again
+		r.Form = nil
+		r.PostForm = nil
+
+		if len(namespaces) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
+			for _, namespace := range namespaces {
+				metrics.GetOrCreateCounter(fmt.Sprintf(`namespace_queries_total{namespace=%q}`, namespace)).Inc()
+				if status >= http.StatusBadRequest {
+					metrics.GetOrCreateCounter(fmt.Sprintf(`namespace_query_errors_total{namespace=%q}`, namespace)).Inc()
+				}
+			}
+		})(next).ServeHTTP(w, r)
+	})
+}
+
+// referencedNamespaces returns allowlisted namespaces referenced by query and match[] parameters of a parsed request. Label is the label namespaces are enforced on.
+func (app *application) referencedNamespaces(r *http.Request, label string) []string {
+	referenced := make(map[string]bool)
+
+	for _, param := range []string{"query", "match[]"} {
+		for _, query := range r.Form[param] {
+			values, err := querymodifier.ReferencedValues(query, label, app.NamespaceMetricsAllowlist)
+			if err != nil {
+				// The upstream will return an error anyway
+				continue
+			}
+
+			for _, value := range values {
+				referenced[value] = true
+			}
+		}
+	}
+
+	namespaces := []string{}
+	for _, namespace := range app.NamespaceMetricsAllowlist {
+		if referenced[namespace] {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	return namespaces
+}
@@ -0,0 +1,100 @@
+package lfgw
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_namespaceMetricsMiddleware(t *testing.T) {
+	app := application{
+		NamespaceMetricsAllowlist: []string{"nsmetrics-a", "nsmetrics-b"},
+	}
+
+	acl, err := querymodifier.NewACL("nsmetrics-a, nsmetrics-b")
+	assert.Nil(t, err)
+
+	counter := func(name, namespace string) uint64 {
+		return metrics.GetOrCreateCounter(fmt.Sprintf(`%s{namespace=%q}`, name, namespace)).Get()
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		status     int
+		wantCounts map[string]uint64
+		wantErrors map[string]uint64
+	}{
+		{
+			name:       "GET",
+			method:     http.MethodGet,
+			query:      `up{namespace="nsmetrics-a"}`,
+			status:     http.StatusOK,
+			wantCounts: map[string]uint64{"nsmetrics-a": 1, "nsmetrics-b": 0},
+			wantErrors: map[string]uint64{"nsmetrics-a": 0, "nsmetrics-b": 0},
+		},
+		{
+			name:       "POST with an error",
+			method:     http.MethodPost,
+			query:      `up{namespace=~"nsmetrics-a|nsmetrics-b"}`,
+			status:     http.StatusUnprocessableEntity,
+			wantCounts: map[string]uint64{"nsmetrics-a": 1, "nsmetrics-b": 1},
+			wantErrors: map[string]uint64{"nsmetrics-a": 1, "nsmetrics-b": 1},
+		},
+		{
+			name:       "not allowlisted",
+			method:     http.MethodGet,
+			query:      `up{namespace="default"}`,
+			status:     http.StatusOK,
+			wantCounts: map[string]uint64{"nsmetrics-a": 0, "nsmetrics-b": 0},
+			wantErrors: map[string]uint64{"nsmetrics-a": 0, "nsmetrics-b": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := map[string]uint64{}
+			beforeErrors := map[string]uint64{}
+			for _, ns := range app.NamespaceMetricsAllowlist {
+				before[ns] = counter("namespace_queries_total", ns)
+				beforeErrors[ns] = counter("namespace_query_errors_total", ns)
+			}
+
+			params := url.Values{"query": {tt.query}}
+
+			var r *http.Request
+			if tt.method == http.MethodPost {
+				r = httptest.NewRequest(tt.method, "/api/v1/query", strings.NewReader(params.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				r = httptest.NewRequest(tt.method, "/api/v1/query?"+params.Encode(), nil)
+			}
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyACL, acl))
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The body must still be readable by the upstream
+				assert.Nil(t, r.ParseForm())
+				assert.Equal(t, tt.query, r.Form.Get("query"))
+				w.WriteHeader(tt.status)
+			})
+
+			rr := httptest.NewRecorder()
+			app.namespaceMetricsMiddleware(next).ServeHTTP(rr, r)
+			assert.Equal(t, tt.status, rr.Code)
+
+			for _, ns := range app.NamespaceMetricsAllowlist {
+				assert.Equal(t, tt.wantCounts[ns], counter("namespace_queries_total", ns)-before[ns], ns)
+				assert.Equal(t, tt.wantErrors[ns], counter("namespace_query_errors_total", ns)-beforeErrors[ns], ns)
+			}
+		})
+	}
+}
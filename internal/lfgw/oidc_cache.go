@@ -0,0 +1,183 @@
+package lfgw
+
+import (
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	oidcCacheHitsTotal   = metrics.NewCounter(`oidc_verification_cache_requests_total{result="hit"}`)
+	oidcCacheMissesTotal = metrics.NewCounter(`oidc_verification_cache_requests_total{result="miss"}`)
+)
+
+// verifiedToken is an access token that passed verification along with the claims extracted from it. rawClaims are extracted only if custom roles claims or claims enrichment are configured.
+type verifiedToken struct {
+	subject   string
+	issuedAt  time.Time
+	claims    userClaims
+	rawClaims map[string]any
+	expires   time.Time
+}
+
+// oidcCache keeps verified tokens keyed by the SHA-256 of the raw token, so Grafana dashboards sending dozens of queries with the same token don't get it verified every time. Once the cache is full, tokens are evicted in the order they expire.
+type oidcCache struct {
+	mu       sync.Mutex
+	size     int
+	entries  map[[sha256.Size]byte]*oidcCacheEntry
+	byExpiry oidcCacheQueue
+}
+
+// oidcCacheEntry is a cached token along with its position in oidcCacheQueue.
+type oidcCacheEntry struct {
+	key   [sha256.Size]byte
+	token verifiedToken
+	index int
+}
+
+// oidcCacheQueue is a min-heap of cache entries ordered by expiry, it implements heap.Interface.
+type oidcCacheQueue []*oidcCacheEntry
+
+// Len implements heap.Interface.
+func (q oidcCacheQueue) Len() int {
+	return len(q)
+}
+
+// Less implements heap.Interface.
+func (q oidcCacheQueue) Less(i, j int) bool {
+	return q[i].token.expires.Before(q[j].token.expires)
+}
+
+// Swap implements heap.Interface.
+func (q oidcCacheQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+// Push implements heap.Interface.
+func (q *oidcCacheQueue) Push(x any) {
+	entry := x.(*oidcCacheEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+// Pop implements heap.Interface.
+func (q *oidcCacheQueue) Pop() any {
+	old := *q
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+
+	return entry
+}
+
+// configureOIDCCache sets up a cache for up to app.OIDCCacheSize verified tokens, it's disabled if the size is 0.
+func (app *application) configureOIDCCache() {
+	app.oidcCache = nil
+	if app.OIDCCacheSize > 0 {
+		app.oidcCache = &oidcCache{
+			size:    app.OIDCCacheSize,
+			entries: make(map[[sha256.Size]byte]*oidcCacheEntry),
+		}
+	}
+}
+
+// get returns the token cached for the key if it hasn't expired by now.
+func (c *oidcCache) get(key [sha256.Size]byte, now time.Time) (verifiedToken, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return verifiedToken{}, false
+	}
+
+	if !now.Before(entry.token.expires) {
+		heap.Remove(&c.byExpiry, entry.index)
+		delete(c.entries, key)
+		return verifiedToken{}, false
+	}
+
+	return entry.token, true
+}
+
+// put stores the token for the key. If the cache is full, the token expiring first is evicted (expired tokens go first), so new tokens are always cached.
+func (c *oidcCache) put(key [sha256.Size]byte, token verifiedToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		entry.token = token
+		heap.Fix(&c.byExpiry, entry.index)
+		return
+	}
+
+	for len(c.entries) >= c.size {
+		evicted := heap.Pop(&c.byExpiry).(*oidcCacheEntry)
+		delete(c.entries, evicted.key)
+	}
+
+	entry := &oidcCacheEntry{key: key, token: token}
+	heap.Push(&c.byExpiry, entry)
+	c.entries[key] = entry
+}
+
+// verifyToken verifies the access token and extracts its claims. Results are cached for OIDCCacheTTL, but never past the expiry of the token, if app.oidcCache is set. Failures are not cached.
+func (app *application) verifyToken(ctx context.Context, rawAccessToken string) (verifiedToken, error) {
+	key := sha256.Sum256([]byte(rawAccessToken))
+	now := time.Now()
+
+	if app.oidcCache != nil {
+		if entry, ok := app.oidcCache.get(key, now); ok {
+			oidcCacheHitsTotal.Inc()
+			return entry.clone(), nil
+		}
+		oidcCacheMissesTotal.Inc()
+	}
+
+	accessToken, err := app.verifier.Verify(ctx, rawAccessToken)
+	if err != nil {
+		return verifiedToken{}, err
+	}
+
+	token := verifiedToken{
+		subject:  accessToken.Subject,
+		issuedAt: accessToken.IssuedAt,
+		expires:  now.Add(app.OIDCCacheTTL),
+	}
+	if accessToken.Expiry.Before(token.expires) {
+		token.expires = accessToken.Expiry
+	}
+
+	if err := accessToken.Claims(&token.claims); err != nil {
+		return verifiedToken{}, err
+	}
+
+	if app.hasCustomRolesClaims() || len(app.claimsEnrichers) > 0 || app.claimsAdapter != nil {
+		if err := accessToken.Claims(&token.rawClaims); err != nil {
+			return verifiedToken{}, err
+		}
+	}
+
+	if app.oidcCache != nil {
+		app.oidcCache.put(key, token)
+	}
+
+	return token.clone(), nil
+}
+
+// clone returns a copy of the token, so callers can modify roles and raw claims without affecting the cached token. Nested raw claims are shared, they're only read.
+func (t verifiedToken) clone() verifiedToken {
+	t.claims.Roles = slices.Clone(t.claims.Roles)
+	t.rawClaims = maps.Clone(t.rawClaims)
+
+	return t
+}
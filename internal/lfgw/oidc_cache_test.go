@@ -0,0 +1,163 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/stretchr/testify/assert"
+)
+
+// newUnsignedToken returns a jwt-token with the claims and a dummy signature, it's accepted by verifiers skipping signature checks.
+func newUnsignedToken(t *testing.T, claims map[string]any) string {
+	t.Helper()
+
+	payload, err := json.Marshal(claims)
+	assert.NoError(t, err)
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + enc.EncodeToString(payload) + "." + enc.EncodeToString([]byte("signature"))
+}
+
+func TestApp_verifyToken(t *testing.T) {
+	newVerifier := func(issuer string) *oidc.IDTokenVerifier {
+		return oidc.NewVerifier(issuer, &oidc.StaticKeySet{}, &oidc.Config{
+			ClientID:                   "grafana",
+			InsecureSkipSignatureCheck: true,
+		})
+	}
+
+	newToken := func(sub string, exp time.Time) string {
+		return newUnsignedToken(t, map[string]any{
+			"iss":   "https://idp.example.com",
+			"aud":   "grafana",
+			"sub":   sub,
+			"exp":   exp.Unix(),
+			"iat":   time.Now().Unix(),
+			"email": sub + "@example.com",
+			"roles": []string{"team-a"},
+		})
+	}
+
+	t.Run("Verified tokens are cached", func(t *testing.T) {
+		app := &application{
+			verifier:      newVerifier("https://idp.example.com"),
+			OIDCCacheSize: 10,
+			OIDCCacheTTL:  time.Minute,
+		}
+		app.configureOIDCCache()
+		rawToken := newToken("cached", time.Now().Add(time.Hour))
+
+		token, err := app.verifyToken(context.Background(), rawToken)
+		assert.NoError(t, err)
+		assert.Equal(t, "cached", token.subject)
+		assert.Equal(t, "cached@example.com", token.claims.Email)
+		assert.Equal(t, []string{"team-a"}, token.claims.Roles)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), token.expires, 5*time.Second)
+
+		// Modifications made by callers don't affect the cached token
+		token.claims.Roles[0] = "team-b"
+
+		// The token would fail verification with another issuer, so it's served from the cache
+		app.verifier = newVerifier("https://other-idp.example.com")
+		token, err = app.verifyToken(context.Background(), rawToken)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"team-a"}, token.claims.Roles)
+	})
+
+	t.Run("TTL is capped at token expiry", func(t *testing.T) {
+		app := &application{
+			verifier:      newVerifier("https://idp.example.com"),
+			OIDCCacheSize: 10,
+			OIDCCacheTTL:  time.Hour,
+		}
+		app.configureOIDCCache()
+		exp := time.Now().Add(2 * time.Minute).Truncate(time.Second)
+
+		token, err := app.verifyToken(context.Background(), newToken("expiring", exp))
+		assert.NoError(t, err)
+		assert.True(t, token.expires.Equal(exp))
+	})
+
+	t.Run("Failures are not cached", func(t *testing.T) {
+		app := &application{
+			verifier:      newVerifier("https://other-idp.example.com"),
+			OIDCCacheSize: 10,
+			OIDCCacheTTL:  time.Minute,
+		}
+		app.configureOIDCCache()
+		rawToken := newToken("failed", time.Now().Add(time.Hour))
+
+		_, err := app.verifyToken(context.Background(), rawToken)
+		assert.Error(t, err)
+
+		app.verifier = newVerifier("https://idp.example.com")
+		_, err = app.verifyToken(context.Background(), rawToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Cache is bounded", func(t *testing.T) {
+		app := &application{
+			verifier:      newVerifier("https://idp.example.com"),
+			OIDCCacheSize: 2,
+			OIDCCacheTTL:  time.Minute,
+		}
+		app.configureOIDCCache()
+
+		for _, sub := range []string{"a", "b", "c"} {
+			_, err := app.verifyToken(context.Background(), newToken(sub, time.Now().Add(time.Hour)))
+			assert.NoError(t, err)
+		}
+		assert.Len(t, app.oidcCache.entries, 2)
+	})
+
+	t.Run("Tokens expiring first are evicted", func(t *testing.T) {
+		app := &application{
+			verifier:      newVerifier("https://idp.example.com"),
+			OIDCCacheSize: 2,
+			OIDCCacheTTL:  time.Hour,
+		}
+		app.configureOIDCCache()
+
+		expiringSoon := newToken("expiring-soon", time.Now().Add(2*time.Minute))
+		expiringLater := newToken("expiring-later", time.Now().Add(time.Hour))
+		fresh := newToken("fresh", time.Now().Add(30*time.Minute))
+
+		for _, rawToken := range []string{expiringLater, expiringSoon, fresh} {
+			_, err := app.verifyToken(context.Background(), rawToken)
+			assert.NoError(t, err)
+		}
+
+		// Only cached tokens pass verification with another issuer
+		app.verifier = newVerifier("https://other-idp.example.com")
+
+		_, err := app.verifyToken(context.Background(), fresh)
+		assert.NoError(t, err, "new tokens must be cached even if the cache is full of live tokens")
+
+		_, err = app.verifyToken(context.Background(), expiringLater)
+		assert.NoError(t, err)
+
+		_, err = app.verifyToken(context.Background(), expiringSoon)
+		assert.Error(t, err, "the token expiring first must be evicted")
+	})
+
+	t.Run("Cache is disabled", func(t *testing.T) {
+		app := &application{
+			verifier:     newVerifier("https://idp.example.com"),
+			OIDCCacheTTL: time.Minute,
+		}
+		app.configureOIDCCache()
+		rawToken := newToken("uncached", time.Now().Add(time.Hour))
+
+		_, err := app.verifyToken(context.Background(), rawToken)
+		assert.NoError(t, err)
+		assert.Nil(t, app.oidcCache)
+
+		app.verifier = newVerifier("https://other-idp.example.com")
+		_, err = app.verifyToken(context.Background(), rawToken)
+		assert.Error(t, err)
+	})
+}
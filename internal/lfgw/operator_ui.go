@@ -0,0 +1,131 @@
+package lfgw
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// operatorUIAssets contains the operator UI: a static page, which asks for the admin token and renders data of admin endpoints, so the page itself is served without authentication
+//
+//go:embed operator_ui
+var operatorUIAssets embed.FS
+
+// operatorUIHealthcheckTimeout limits the time the upstream health check of the status endpoint takes
+const operatorUIHealthcheckTimeout = 5 * time.Second
+
+// operatorStatus is the state of the instance shown in the operator UI.
+type operatorStatus struct {
+	Build         BuildInfo                      `json:"build"`
+	ACLSource     string                         `json:"acl_source"`
+	ACLsLoadedAt  time.Time                      `json:"acls_loaded_at"`
+	Roles         int                            `json:"roles"`
+	Draining      bool                           `json:"draining"`
+	Maintenance   maintenance                    `json:"maintenance"`
+	Lifecycle     bool                           `json:"lifecycle"`
+	Upstream      upstreamStatus                 `json:"upstream"`
+	Tasks         map[string]backgroundTaskState `json:"tasks"`
+	Config        map[string]string              `json:"config"`
+	RecentDenials []denial                       `json:"recent_denials"`
+}
+
+// upstreamStatus is the result of a deep health check of the upstream.
+type upstreamStatus struct {
+	Healthy  bool    `json:"healthy"`
+	Role     string  `json:"role,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+// operatorUIHandler serves the operator UI page under /admin/ui/ and its script.
+func (app *application) operatorUIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		app.clientError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The trailing slash is required, as the script is loaded relative to the page
+	if r.URL.Path == "/admin/ui" {
+		http.Redirect(w, r, app.externalURLFor("/admin/ui/"), http.StatusMovedPermanently)
+		return
+	}
+
+	name, contentType := "operator_ui/index.html", "text/html; charset=utf-8"
+	if r.URL.Path == "/admin/ui/app.js" {
+		name, contentType = "operator_ui/app.js", "text/javascript; charset=utf-8"
+	}
+
+	content, err := operatorUIAssets.ReadFile(name)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(content)
+}
+
+// operatorStatusHandler returns the state of the instance shown in the operator UI as JSON: build, ACLs, draining and maintenance mode, upstream health, background tasks, effective configuration (secrets are masked) and recent denials. It requires an admin token.
+func (app *application) operatorStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		app.clientError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	app.acls.mu.RLock()
+	loadedAt := app.acls.loadedAt
+	app.acls.mu.RUnlock()
+
+	status := operatorStatus{
+		Build:         app.buildInfo,
+		ACLSource:     app.aclSourceName(),
+		ACLsLoadedAt:  loadedAt,
+		Roles:         len(app.loadedRoles()),
+		Draining:      app.isDraining(),
+		Maintenance:   app.maintenanceMode.get(),
+		Lifecycle:     app.EnableLifecycle,
+		Upstream:      app.upstreamStatus(r.Context()),
+		Tasks:         map[string]backgroundTaskState{},
+		Config:        app.configSnapshot(),
+		RecentDenials: app.recentDenials.list(),
+	}
+
+	if app.tasks != nil {
+		status.Tasks = app.tasks.snapshot()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// upstreamStatus checks the upstream the same way as deep health checks do.
+func (app *application) upstreamStatus(ctx context.Context) upstreamStatus {
+	ctx, cancel := context.WithTimeout(ctx, operatorUIHealthcheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	role, err := app.deepHealthcheck(ctx)
+
+	status := upstreamStatus{
+		Healthy:  err == nil,
+		Role:     role,
+		Duration: time.Since(start).Seconds(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	return status
+}
@@ -0,0 +1,153 @@
+// The operator UI renders data of admin endpoints, the admin token is kept in the session storage of the browser only.
+(function () {
+  "use strict";
+
+  // The UI is served under /admin/ui, possibly behind a route prefix
+  var base = location.pathname.replace(/\/admin\/ui\/?$/, "");
+
+  function token() {
+    return sessionStorage.getItem("lfgw-admin-token") || "";
+  }
+
+  function request(method, path, body) {
+    return fetch(base + path, {
+      method: method,
+      headers: { "Authorization": "Bearer " + token(), "Content-Type": "application/json" },
+      body: body === undefined ? undefined : JSON.stringify(body),
+    }).then(function (resp) {
+      if (resp.status === 401) {
+        sessionStorage.removeItem("lfgw-admin-token");
+        show(false);
+        throw new Error("The admin token is not valid");
+      }
+      return resp.text().then(function (text) {
+        if (!resp.ok) {
+          throw new Error(method + " " + path + ": " + resp.status + " " + text);
+        }
+        return text && resp.headers.get("Content-Type") === "application/json" ? JSON.parse(text) : text;
+      });
+    });
+  }
+
+  // Values are always set as text, since denial reasons and roles may contain user input
+  function row(table, cells, header) {
+    var tr = document.createElement("tr");
+    cells.forEach(function (cell) {
+      var td = document.createElement(header ? "th" : "td");
+      if (cell && cell.text !== undefined) {
+        td.textContent = cell.text;
+        td.className = cell.className;
+      } else {
+        td.textContent = cell === undefined || cell === null ? "" : String(cell);
+      }
+      tr.appendChild(td);
+    });
+    table.appendChild(tr);
+  }
+
+  function table(id, header, rows) {
+    var t = document.getElementById(id);
+    t.textContent = "";
+    if (header) {
+      row(t, header, true);
+    }
+    rows.forEach(function (cells) { row(t, cells); });
+  }
+
+  function flag(value, bad) {
+    return { text: value ? "yes" : "no", className: value === bad ? "bad" : "ok" };
+  }
+
+  function render(status, roles) {
+    table("status", null, [
+      ["Version", status.build.version + " (" + status.build.commit + ", " + status.build.go_version + ")"],
+      ["ACL source", status.acl_source],
+      ["ACLs loaded at", status.acls_loaded_at],
+      ["Roles", status.roles],
+      ["Draining", flag(status.draining, true)],
+      ["Maintenance mode", flag(status.maintenance.enabled, true)],
+      ["Maintenance message", status.maintenance.message],
+    ]);
+
+    document.getElementById("reload").disabled = !status.lifecycle;
+    document.getElementById("reload-hint").textContent = status.lifecycle ? "" : "Requires ENABLE_LIFECYCLE";
+
+    var upstream = status.upstream;
+    table("upstream", null, [
+      ["Healthy", flag(upstream.healthy, false)],
+      ["Checked as role", upstream.role],
+      ["Duration", upstream.duration_seconds.toFixed(3) + "s"],
+      ["Error", upstream.error],
+    ]);
+
+    table("tasks", ["Task", "Status", "Restarts", "Last error"], Object.keys(status.tasks).sort().map(function (name) {
+      var task = status.tasks[name];
+      return [name, { text: task.status, className: task.status === "running" ? "ok" : "bad" }, task.restarts, task.last_error];
+    }));
+
+    table("denials", ["Time", "Status", "Method", "Path", "Reason", "Roles", "Client IP", "Request ID"], status.recent_denials.map(function (d) {
+      return [d.time, d.status, d.method, d.path, d.reason, (d.roles || []).join(", "), d.client_ip, d.request_id];
+    }));
+
+    table("roles", ["Role", "Source", "Label filter", "Full access"], roles.map(function (role) {
+      return [role.role, role.source, role.label_filter || role.pattern, role.fullaccess ? "yes" : "no"];
+    }));
+
+    table("config", ["Setting", "Value"], Object.keys(status.config).sort().map(function (key) {
+      return [key, status.config[key]];
+    }));
+  }
+
+  function refresh() {
+    document.getElementById("error").textContent = "";
+    return Promise.all([request("GET", "/admin/status"), request("GET", "/lfgw/api/roles")])
+      .then(function (results) { render(results[0], results[1]); })
+      .catch(function (err) { document.getElementById("error").textContent = err.message; });
+  }
+
+  function action(promise) {
+    var result = document.getElementById("action-result");
+    result.textContent = "";
+    promise
+      .then(function (text) { result.textContent = text || "Done"; })
+      .catch(function (err) { result.textContent = err.message; })
+      .then(refresh);
+  }
+
+  function show(signedIn) {
+    document.getElementById("login").className = signedIn ? "hidden" : "";
+    document.getElementById("main").className = signedIn ? "" : "hidden";
+  }
+
+  document.getElementById("login").addEventListener("submit", function (event) {
+    event.preventDefault();
+    sessionStorage.setItem("lfgw-admin-token", document.getElementById("token").value);
+    document.getElementById("token").value = "";
+    show(true);
+    refresh();
+  });
+
+  document.getElementById("logout").addEventListener("click", function () {
+    sessionStorage.removeItem("lfgw-admin-token");
+    show(false);
+  });
+
+  document.getElementById("refresh").addEventListener("click", refresh);
+
+  document.getElementById("reload").addEventListener("click", function () {
+    action(request("POST", "/-/reload"));
+  });
+
+  document.getElementById("maintenance-on").addEventListener("click", function () {
+    action(request("PUT", "/admin/maintenance", { enabled: true, message: document.getElementById("maintenance-message").value }));
+  });
+
+  document.getElementById("maintenance-off").addEventListener("click", function () {
+    action(request("DELETE", "/admin/maintenance"));
+  });
+
+  if (token()) {
+    show(true);
+    refresh();
+  }
+})();
@@ -0,0 +1,92 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_operatorUI(t *testing.T) {
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:       &aclsState{},
+		logger:     &logger,
+		AdminToken: "secret",
+		ACLSource:  aclSourceFile,
+		buildInfo:  BuildInfo{Version: "1.0.0"},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := app.nonProxiedEndpointsMiddleware(next)
+
+	request := func(method, path, authorization string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(method, path, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	t.Run("Page", func(t *testing.T) {
+		rr := request(http.MethodGet, "/admin/ui", "")
+		assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+		assert.Equal(t, "/admin/ui/", rr.Header().Get("Location"))
+
+		rr = request(http.MethodGet, "/admin/ui/", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Body.String(), `<script src="app.js">`)
+
+		rr = request(http.MethodGet, "/admin/ui/app.js", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/javascript; charset=utf-8", rr.Header().Get("Content-Type"))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodPost, "/admin/ui/", "").Code)
+	})
+
+	t.Run("Redirect behind a route prefix", func(t *testing.T) {
+		externalURL, err := url.Parse("https://example.com/metrics-gw/")
+		assert.NoError(t, err)
+
+		prefixed := &application{
+			acls:        &aclsState{},
+			logger:      &logger,
+			RoutePrefix: "/metrics-gw",
+			ExternalURL: externalURL,
+		}
+
+		rr := httptest.NewRecorder()
+		prefixed.operatorUIHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/ui", nil))
+		assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+		assert.Equal(t, "https://example.com/metrics-gw/admin/ui/", rr.Header().Get("Location"))
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/admin/status", "").Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodPost, "/admin/status", "Bearer secret").Code)
+
+		rr := request(http.MethodGet, "/admin/status", "Bearer secret")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var status operatorStatus
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &status))
+		assert.Equal(t, "1.0.0", status.Build.Version)
+		assert.Equal(t, aclSourceFile, status.ACLSource)
+		assert.Equal(t, "<redacted>", status.Config["AdminToken"])
+		// There's no upstream in the test
+		assert.False(t, status.Upstream.Healthy)
+		assert.NotEmpty(t, status.Upstream.Error)
+	})
+}
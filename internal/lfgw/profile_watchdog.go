@@ -0,0 +1,148 @@
+package lfgw
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// profileWatchdogMaxProfiles limits the number of profiles kept in ProfileWatchdogDir, the oldest ones are removed
+const profileWatchdogMaxProfiles = 20
+
+// profileWatchdogProfiles are recorded every time a threshold is crossed
+var profileWatchdogProfiles = []string{"heap", "goroutine"}
+
+var profileWatchdogCaptures = metrics.NewCounter("profile_watchdog_captures_total")
+
+// runProfileWatchdog checks resident memory and the number of goroutines every ProfileWatchdogInterval and records profiles once a threshold is crossed, at most once per ProfileWatchdogCooldown.
+func (app *application) runProfileWatchdog(ctx context.Context) {
+	app.logger.Info().Caller().
+		Msgf("Profile watchdog is on (directory: %s, RSS: %d bytes, goroutines: %d)", app.ProfileWatchdogDir, app.ProfileWatchdogRSSBytes, app.ProfileWatchdogGoroutines)
+
+	ticker := time.NewTicker(app.ProfileWatchdogInterval)
+	defer ticker.Stop()
+
+	var lastCapture time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			reason, triggered := app.profileWatchdogReason()
+			if !triggered || (!lastCapture.IsZero() && now.Sub(lastCapture) < app.ProfileWatchdogCooldown) {
+				continue
+			}
+
+			lastCapture = now
+
+			if err := app.captureProfiles(reason, now); err != nil {
+				app.logger.Error().Caller().
+					Err(err).Msg("Failed to record profiles")
+			}
+		}
+	}
+}
+
+// profileWatchdogReason returns the name of the crossed threshold, false if none of them is crossed.
+func (app *application) profileWatchdogReason() (string, bool) {
+	if app.ProfileWatchdogGoroutines > 0 && runtime.NumGoroutine() >= app.ProfileWatchdogGoroutines {
+		return "goroutines", true
+	}
+
+	if app.ProfileWatchdogRSSBytes > 0 {
+		rss, err := residentMemory()
+		if err == nil && rss >= app.ProfileWatchdogRSSBytes {
+			return "rss", true
+		}
+	}
+
+	return "", false
+}
+
+// captureProfiles writes profileWatchdogProfiles to ProfileWatchdogDir (e.g. 20220501T100000Z-rss-heap.pprof) and removes the oldest profiles beyond profileWatchdogMaxProfiles.
+func (app *application) captureProfiles(reason string, now time.Time) error {
+	prefix := now.UTC().Format("20060102T150405Z") + "-" + reason
+
+	for _, name := range profileWatchdogProfiles {
+		path := filepath.Join(app.ProfileWatchdogDir, fmt.Sprintf("%s-%s.pprof", prefix, name))
+
+		if err := writeProfile(path, name); err != nil {
+			return err
+		}
+	}
+
+	profileWatchdogCaptures.Inc()
+	app.logger.Warn().Caller().
+		Str("reason", reason).Int("goroutines", runtime.NumGoroutine()).Msgf("Recorded profiles to %s", app.ProfileWatchdogDir)
+
+	return app.pruneProfiles()
+}
+
+// writeProfile writes the named runtime profile to path.
+func writeProfile(path, name string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write %s profile: %w", name, err)
+	}
+
+	return f.Close()
+}
+
+// pruneProfiles removes the oldest profiles in ProfileWatchdogDir, so the directory doesn't grow unbounded during long spikes.
+func (app *application) pruneProfiles() error {
+	return pruneOldestFiles(filepath.Join(app.ProfileWatchdogDir, "*.pprof"), profileWatchdogMaxProfiles)
+}
+
+// pruneOldestFiles removes files matching the pattern beyond the latest keep ones. Names are expected to start with a timestamp, so they're sorted chronologically.
+func pruneOldestFiles(pattern string, keep int) error {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(paths)
+
+	for len(paths) > keep {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+
+	return nil
+}
+
+// residentMemory returns the resident set size of the process, it's supported only on Linux.
+func residentMemory() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected format of /proc/self/statm: %q", data)
+	}
+
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return pages * uint64(os.Getpagesize()), nil
+}
@@ -0,0 +1,89 @@
+package lfgw
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_profileWatchdogReason(t *testing.T) {
+	tests := []struct {
+		name       string
+		app        application
+		linuxOnly  bool
+		wantReason string
+		want       bool
+	}{
+		{
+			name: "No thresholds",
+			app:  application{},
+		},
+		{
+			name:       "Goroutines",
+			app:        application{ProfileWatchdogGoroutines: 1},
+			wantReason: "goroutines",
+			want:       true,
+		},
+		{
+			name: "Goroutines below the threshold",
+			app:  application{ProfileWatchdogGoroutines: runtime.NumGoroutine() + 1000},
+		},
+		{
+			name:       "RSS",
+			app:        application{ProfileWatchdogRSSBytes: 1},
+			linuxOnly:  true,
+			wantReason: "rss",
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.linuxOnly && runtime.GOOS != "linux" {
+				t.Skip("resident memory is supported only on Linux")
+			}
+
+			reason, got := tt.app.profileWatchdogReason()
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantReason, reason)
+		})
+	}
+}
+
+func TestApp_captureProfiles(t *testing.T) {
+	dir := t.TempDir()
+
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:             &logger,
+		ProfileWatchdogDir: dir,
+	}
+
+	start := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	err := app.captureProfiles("rss", start)
+	assert.Nil(t, err)
+
+	for _, name := range profileWatchdogProfiles {
+		info, err := os.Stat(filepath.Join(dir, fmt.Sprintf("20220501T100000Z-rss-%s.pprof", name)))
+		assert.Nil(t, err)
+		assert.NotZero(t, info.Size())
+	}
+
+	// The oldest profiles are removed
+	for i := 1; i <= profileWatchdogMaxProfiles; i++ {
+		assert.Nil(t, app.captureProfiles("goroutines", start.Add(time.Duration(i)*time.Minute)))
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pprof"))
+	assert.Nil(t, err)
+	assert.Len(t, paths, profileWatchdogMaxProfiles)
+	assert.NotContains(t, paths, filepath.Join(dir, "20220501T100000Z-rss-heap.pprof"))
+}
@@ -0,0 +1,269 @@
+package lfgw
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/hlog"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// defaultCatalogParamPattern is used for template parameters without a pattern, it's enough for label values like pod or instance names
+	defaultCatalogParamPattern = `[A-Za-z0-9_.:-]+`
+	// catalogAllQueries grants a role all queries of the catalog
+	catalogAllQueries = "*"
+)
+
+var (
+	catalogParamRegexp = regexp.MustCompile(`\$(?:\{(\w+)\}|(\w+))`)
+	whitespaceRegexp   = regexp.MustCompile(`\s+`)
+	catalogParamName   = regexp.MustCompile(`^\w+$`)
+)
+
+// queryCatalogFile represents the content of a query catalog file.
+type queryCatalogFile struct {
+	// Queries are named query templates
+	Queries map[string]struct {
+		Query string `yaml:"query"`
+		// Params maps template parameters to regular expressions their values must match
+		Params map[string]string `yaml:"params"`
+	} `yaml:"queries"`
+	// Roles lists names of queries each restricted role might execute
+	Roles map[string][]string `yaml:"roles"`
+}
+
+// queryCatalog is a set of pre-approved queries. Users with any of the restricted roles can only execute queries from the catalog granted to their restricted roles.
+type queryCatalog struct {
+	queries map[string]*regexp.Regexp
+	roles   map[string][]string
+}
+
+// configureQueryCatalog loads the query catalog from app.QueryCatalogPath if it's set.
+func (app *application) configureQueryCatalog() error {
+	if app.QueryCatalogPath == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(app.QueryCatalogPath)
+	if err != nil {
+		return err
+	}
+
+	catalog, err := newQueryCatalog(content)
+	if err != nil {
+		return fmt.Errorf("failed to load query catalog: %w", err)
+	}
+
+	app.queryCatalog = catalog
+
+	app.logger.Info().Caller().
+		Msgf("Query catalog is loaded: %d queries, %d restricted roles", len(catalog.queries), len(catalog.roles))
+
+	return nil
+}
+
+// newQueryCatalog parses and validates a query catalog.
+func newQueryCatalog(content []byte) (*queryCatalog, error) {
+	var file queryCatalogFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	catalog := &queryCatalog{
+		queries: make(map[string]*regexp.Regexp, len(file.Queries)),
+		roles:   make(map[string][]string, len(file.Roles)),
+	}
+
+	for name, query := range file.Queries {
+		if strings.TrimSpace(query.Query) == "" {
+			return nil, fmt.Errorf("query %s is empty", name)
+		}
+
+		re, err := compileCatalogQuery(query.Query, query.Params)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", name, err)
+		}
+
+		catalog.queries[name] = re
+	}
+
+	for role, names := range file.Roles {
+		for _, name := range names {
+			if _, exists := catalog.queries[name]; !exists && name != catalogAllQueries {
+				return nil, fmt.Errorf("role %s refers to an unknown query %s", role, name)
+			}
+		}
+
+		catalog.roles[role] = names
+	}
+
+	return catalog, nil
+}
+
+// compileCatalogQuery turns a query template into a regular expression. Parameters ($name or ${name}) are replaced with their patterns, the rest must match literally, though whitespace is normalized.
+func compileCatalogQuery(template string, params map[string]string) (*regexp.Regexp, error) {
+	for param := range params {
+		if !catalogParamName.MatchString(param) {
+			return nil, fmt.Errorf("invalid parameter name %q", param)
+		}
+	}
+
+	template = normalizeWhitespace(template)
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+
+	last := 0
+	for _, match := range catalogParamRegexp.FindAllStringSubmatchIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:match[0]]))
+		last = match[1]
+
+		var name string
+		if match[2] >= 0 {
+			name = template[match[2]:match[3]]
+		} else {
+			name = template[match[4]:match[5]]
+		}
+
+		paramPattern, ok := params[name]
+		if !ok {
+			paramPattern = defaultCatalogParamPattern
+		}
+
+		if _, err := regexp.Compile(paramPattern); err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", name, err)
+		}
+
+		pattern.WriteString("(?:" + paramPattern + ")")
+	}
+
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("$")
+
+	return regexp.Compile(pattern.String())
+}
+
+// normalizeWhitespace trims the query and collapses whitespace, so indentation and line breaks of dashboards don't matter.
+func normalizeWhitespace(query string) string {
+	return whitespaceRegexp.ReplaceAllString(strings.TrimSpace(query), " ")
+}
+
+// allowedQueries returns sorted names of catalog queries granted to the restricted roles among roles. If none of the roles are restricted, ok is false.
+func (c *queryCatalog) allowedQueries(roles []string) (names []string, ok bool) {
+	seen := make(map[string]bool)
+
+	for _, role := range roles {
+		granted, restricted := c.roles[role]
+		if !restricted {
+			continue
+		}
+
+		ok = true
+		for _, name := range granted {
+			if name != catalogAllQueries {
+				seen[name] = true
+				continue
+			}
+
+			for name := range c.queries {
+				seen[name] = true
+			}
+		}
+	}
+
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, ok
+}
+
+// match returns the name of the first allowed query matching the query.
+func (c *queryCatalog) match(allowed []string, query string) (string, bool) {
+	query = normalizeWhitespace(query)
+
+	for _, name := range allowed {
+		if c.queries[name].MatchString(query) {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// isCatalogPath returns true if restricted users might access the path, all other paths (including the UI) are denied to them.
+func (app *application) isCatalogPath(path string) bool {
+	return strings.HasSuffix(path, "/api/v1/query") || strings.HasSuffix(path, "/api/v1/query_range")
+}
+
+// queryCatalogMiddleware makes sure users with restricted roles only execute queries from the query catalog. Queries are still rewritten according to ACLs afterwards.
+func (app *application) queryCatalogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.queryCatalog == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		roles, _ := r.Context().Value(contextKeyRoles).([]string)
+		allowed, restricted := app.queryCatalog.allowedQueries(roles)
+		if !restricted {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !app.isCatalogPath(r.URL.Path) {
+			hlog.FromRequest(r).Error().Caller().
+				Msgf("Blocked a request to %s from a user restricted to the query catalog", r.URL.Path)
+			app.userError(w, r, http.StatusForbidden, errNotCatalogQuery)
+			return
+		}
+
+		queries := r.URL.Query()["query"]
+
+		if app.hasFormBody(r.Method) && app.isFormEncoded(r) {
+			if err := r.ParseForm(); err != nil {
+				app.clientError(w, http.StatusBadRequest)
+				return
+			}
+
+			queries = append(queries, r.PostForm["query"]...)
+
+			// Once r.ParseForm() is called, we need to restore the body for further middlewares and the upstream
+			newBody := strings.NewReader(r.PostForm.Encode())
+			r.ContentLength = newBody.Size()
+			r.Body = io.NopCloser(newBody)
+
+			// Workaround to make further r.ParseForm() calls update r.Form and r.PostForm again
+			r.Form = nil
+			r.PostForm = nil
+		}
+
+		if len(queries) == 0 {
+			app.userError(w, r, http.StatusForbidden, errNotCatalogQuery)
+			return
+		}
+
+		names := make([]string, 0, len(queries))
+		for _, query := range queries {
+			name, ok := app.queryCatalog.match(allowed, query)
+			if !ok {
+				hlog.FromRequest(r).Error().Caller().
+					Msgf("Blocked a query that is not in the query catalog: %s", query)
+				app.userError(w, r, http.StatusForbidden, errNotCatalogQuery)
+				return
+			}
+			names = append(names, name)
+		}
+
+		app.enrichLogContext(r, "catalog_query", strings.Join(names, ", "))
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,233 @@
+package lfgw
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+const testQueryCatalog = `
+queries:
+  cpu:
+    query: sum(rate(container_cpu_usage_seconds_total{pod="$pod"}[${interval}]))
+    params:
+      interval: "[0-9]+[smh]"
+  up:
+    query: up
+roles:
+  customer-a:
+    - cpu
+  customer-admin:
+    - "*"
+`
+
+func TestNewQueryCatalog(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "Unknown query",
+			content: "queries:\n  up:\n    query: up\nroles:\n  customer: [down]\n",
+		},
+		{
+			name:    "Empty query",
+			content: "queries:\n  up:\n    query: ' '\n",
+		},
+		{
+			name:    "Invalid parameter pattern",
+			content: "queries:\n  up:\n    query: up{job=\"$job\"}\n    params:\n      job: \"[\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newQueryCatalog([]byte(tt.content))
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestQueryCatalog_match(t *testing.T) {
+	catalog, err := newQueryCatalog([]byte(testQueryCatalog))
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name   string
+		roles  []string
+		query  string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "Parameters",
+			roles:  []string{"customer-a"},
+			query:  `sum(rate(container_cpu_usage_seconds_total{pod="api-1"}[5m]))`,
+			want:   "cpu",
+			wantOK: true,
+		},
+		{
+			name:   "Whitespace is normalized",
+			roles:  []string{"customer-a"},
+			query:  "sum(rate(container_cpu_usage_seconds_total{pod=\"api-1\"}[5m]))\n",
+			want:   "cpu",
+			wantOK: true,
+		},
+		{
+			name:  "Parameter values must match their patterns",
+			roles: []string{"customer-a"},
+			query: `sum(rate(container_cpu_usage_seconds_total{pod="api-1"}[5m] or vector(1)))`,
+		},
+		{
+			name:  "Injection through the default pattern",
+			roles: []string{"customer-a"},
+			query: `sum(rate(container_cpu_usage_seconds_total{pod="a",pod!="b"}[5m]))`,
+		},
+		{
+			name:  "Query not granted",
+			roles: []string{"customer-a"},
+			query: "up",
+		},
+		{
+			name:   "All queries",
+			roles:  []string{"customer-admin"},
+			query:  "up",
+			want:   "up",
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, restricted := catalog.allowedQueries(tt.roles)
+			assert.True(t, restricted)
+
+			got, ok := catalog.match(allowed, tt.query)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, restricted := catalog.allowedQueries([]string{"team-a"})
+	assert.False(t, restricted)
+}
+
+func TestApp_queryCatalogMiddleware(t *testing.T) {
+	catalog, err := newQueryCatalog([]byte(testQueryCatalog))
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:       &logger,
+		queryCatalog: catalog,
+	}
+
+	cpuQuery := `sum(rate(container_cpu_usage_seconds_total{pod="api-1"}[5m]))`
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		roles    []string
+		want     int
+		wantBody string
+	}{
+		{
+			name:   "Not restricted",
+			method: http.MethodGet,
+			target: "/api/v1/series?match[]=up",
+			roles:  []string{"team-a"},
+			want:   http.StatusOK,
+		},
+		{
+			name:   "Catalog query",
+			method: http.MethodGet,
+			target: "/api/v1/query?query=" + url.QueryEscape(cpuQuery),
+			roles:  []string{"customer-a"},
+			want:   http.StatusOK,
+		},
+		{
+			name:     "Catalog query in a form body",
+			method:   http.MethodPost,
+			target:   "/api/v1/query_range",
+			body:     url.Values{"query": {cpuQuery}, "step": {"60"}}.Encode(),
+			roles:    []string{"customer-a"},
+			want:     http.StatusOK,
+			wantBody: url.Values{"query": {cpuQuery}, "step": {"60"}}.Encode(),
+		},
+		{
+			name:   "Other query",
+			method: http.MethodGet,
+			target: "/api/v1/query?query=up",
+			roles:  []string{"customer-a"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "Other query in a form body",
+			method: http.MethodPost,
+			target: "/api/v1/query?query=" + url.QueryEscape(cpuQuery),
+			body:   "query=up",
+			roles:  []string{"customer-a"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "Restricted roles take precedence",
+			method: http.MethodGet,
+			target: "/api/v1/query?query=up",
+			roles:  []string{"team-a", "customer-a"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "Other endpoints",
+			method: http.MethodGet,
+			target: "/api/v1/series?match[]=up",
+			roles:  []string{"customer-admin"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "No query",
+			method: http.MethodGet,
+			target: "/api/v1/query",
+			roles:  []string{"customer-admin"},
+			want:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			r := httptest.NewRequest(tt.method, tt.target, body)
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyRoles, tt.roles))
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.wantBody != "" {
+					got, err := io.ReadAll(r.Body)
+					assert.Nil(t, err)
+					assert.Equal(t, tt.wantBody, string(got))
+				}
+			})
+
+			rr := httptest.NewRecorder()
+			app.queryCatalogMiddleware(next).ServeHTTP(rr, r)
+			assert.Equal(t, tt.want, rr.Code)
+		})
+	}
+}
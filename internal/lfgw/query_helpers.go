@@ -0,0 +1,34 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// queryHelperPaths lists endpoints that parse or format a query without executing it (available in Prometheus v2.31+ and v3.0+ respectively)
+var queryHelperPaths = []string{"/api/v1/format_query", "/api/v1/parse_query"}
+
+// isQueryHelperRequest returns true if the requested path targets an endpoint that parses or formats a query without executing it. The query is rewritten according to the ACL like for any other API request, so the upstream returns the form that would be executed on behalf of the user.
+func (app *application) isQueryHelperRequest(path string) bool {
+	for _, helperPath := range queryHelperPaths {
+		if strings.HasSuffix(path, helperPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// queryHelperError responds with an error in the format of Prometheus API (errorType is bad_data), so client tooling previewing a query can show why it's rejected.
+func (app *application) queryHelperError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"status":    "error",
+		"errorType": "bad_data",
+		"error":     err.Error(),
+	})
+}
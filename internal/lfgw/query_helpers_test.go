@@ -0,0 +1,90 @@
+package lfgw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_queryHelpers(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	upstreamURL, err := url.Parse("http://prometheus")
+	assert.Nil(t, err)
+
+	app := &application{
+		logger:      &logger,
+		UpstreamURL: upstreamURL,
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		aggOnly   bool
+		want      int
+		wantQuery string
+		wantBody  string
+	}{
+		{
+			name:      "format_query is rewritten",
+			path:      "/api/v1/format_query?query=rate(http_requests_total[5m])",
+			want:      http.StatusOK,
+			wantQuery: `rate(http_requests_total{namespace="minio"}[5m])`,
+		},
+		{
+			name:      "parse_query is rewritten",
+			path:      "/api/v1/parse_query?query=up",
+			want:      http.StatusOK,
+			wantQuery: `up{namespace="minio"}`,
+		},
+		{
+			name:     "Syntax error",
+			path:     "/api/v1/format_query?query=rate(",
+			want:     http.StatusBadRequest,
+			wantBody: `"errorType":"bad_data"`,
+		},
+		{
+			name:     "Non-aggregated query of an aggregation-only role",
+			path:     "/api/v1/format_query?query=up",
+			aggOnly:  true,
+			want:     http.StatusForbidden,
+			wantBody: `"error":"only aggregated queries are allowed for the roles: up is not aggregated through sum, avg or count"`,
+		},
+		{
+			name:     "Syntax error in other endpoints",
+			path:     "/api/v1/query?query=rate(",
+			want:     http.StatusBadRequest,
+			wantBody: "Bad Request",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := querymodifier.NewACL("minio")
+			assert.Nil(t, err)
+			acl.AggregationOnly = tt.aggOnly
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyACL, acl))
+
+			var gotQuery string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotQuery = r.URL.Query().Get("query")
+			})
+
+			rr := httptest.NewRecorder()
+			app.rewriteRequestMiddleware(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.want, rr.Code)
+			assert.Equal(t, tt.wantQuery, gotQuery)
+			assert.Contains(t, rr.Body.String(), tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package lfgw
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// readAfterWriteParams are VictoriaMetrics parameters that make reads bypass the response cache, so just written data is visible.
+var readAfterWriteParams = map[string]string{"nocache": "1"}
+
+// recentWrites keeps the time read-after-write windows of tenants (label filters of an ACL) end.
+type recentWrites struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// newRecentWrites returns recentWrites without any open windows.
+func newRecentWrites() *recentWrites {
+	return &recentWrites{
+		until: make(map[string]time.Time),
+	}
+}
+
+// record opens a read-after-write window for the tenant and drops expired windows of other tenants.
+func (rw *recentWrites) record(tenant string, until time.Time) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	now := time.Now()
+	for t, expiry := range rw.until {
+		if expiry.Before(now) {
+			delete(rw.until, t)
+		}
+	}
+
+	rw.until[tenant] = until
+}
+
+// has returns true if the tenant's read-after-write window is still open.
+func (rw *recentWrites) has(tenant string, now time.Time) bool {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	expiry, ok := rw.until[tenant]
+	return ok && now.Before(expiry)
+}
+
+// configureReadAfterWrite sets up tracking of recent writes if app.ReadAfterWriteWindow is set.
+func (app *application) configureReadAfterWrite() {
+	app.recentWrites = nil
+	if app.ReadAfterWriteWindow > 0 {
+		app.recentWrites = newRecentWrites()
+	}
+}
+
+// readAfterWriteMiddleware makes reads of a tenant bypass the upstream cache for app.ReadAfterWriteWindow after the tenant successfully wrote / imported data, so test pipelines see their just-written data. Tenants are identified by the label filters of their ACLs.
+func (app *application) readAfterWriteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.recentWrites == nil || app.isNotAPIRequest(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		acl, ok := r.Context().Value(contextKeyACL).(querymodifier.ACL)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tenant := app.labelFiltersString(acl)
+
+		if app.isWritePath(r.URL.Path) {
+			hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
+				if status >= 200 && status < 300 {
+					app.recentWrites.record(tenant, time.Now().Add(app.ReadAfterWriteWindow))
+				}
+			})(next).ServeHTTP(w, r)
+			return
+		}
+
+		if app.recentWrites.has(tenant, time.Now()) {
+			if err := app.applyForcedParams(r, readAfterWriteParams); err != nil {
+				app.clientError(w, http.StatusBadRequest)
+				return
+			}
+			app.enrichDebugLogContext(r, "read_after_write", "true")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isWritePath returns true if the requested path targets an endpoint that writes or imports data.
+func (app *application) isWritePath(path string) bool {
+	return strings.Contains(path, "/api/v1/import") || strings.Contains(path, "/api/v1/write")
+}
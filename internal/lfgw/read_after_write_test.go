@@ -0,0 +1,54 @@
+package lfgw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_readAfterWriteMiddleware(t *testing.T) {
+	app := application{
+		ReadAfterWriteWindow: time.Minute,
+	}
+	app.configureReadAfterWrite()
+
+	writer, err := querymodifier.NewACL("raw-writer")
+	assert.Nil(t, err)
+
+	other, err := querymodifier.NewACL("raw-other")
+	assert.Nil(t, err)
+
+	// send returns the nocache parameter seen by the upstream
+	send := func(acl querymodifier.ACL, path string, status int) string {
+		var nocache string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nocache = r.URL.Query().Get("nocache")
+			w.WriteHeader(status)
+		})
+
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyACL, acl))
+		app.readAfterWriteMiddleware(next).ServeHTTP(httptest.NewRecorder(), r)
+
+		return nocache
+	}
+
+	assert.Empty(t, send(writer, "/api/v1/query?query=up", http.StatusOK), "no writes yet")
+
+	send(writer, "/api/v1/import", http.StatusBadRequest)
+	assert.Empty(t, send(writer, "/api/v1/query?query=up", http.StatusOK), "failed writes are ignored")
+
+	send(writer, "/api/v1/import/prometheus", http.StatusNoContent)
+	assert.Equal(t, "1", send(writer, "/api/v1/query?query=up&nocache=0", http.StatusOK))
+	assert.Empty(t, send(other, "/api/v1/query?query=up", http.StatusOK), "other tenants are not affected")
+	assert.Empty(t, send(writer, "/vmui/", http.StatusOK), "non-API requests are not affected")
+
+	// Expired window
+	app.recentWrites.record(app.labelFiltersString(writer), time.Now().Add(-time.Second))
+	assert.Empty(t, send(writer, "/api/v1/query?query=up", http.StatusOK))
+}
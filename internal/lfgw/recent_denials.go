@@ -0,0 +1,94 @@
+package lfgw
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// recentDenialsSize is the amount of the latest denials kept in memory
+const recentDenialsSize = 100
+
+// recentDenials is a ring buffer of the latest denials.
+type recentDenials struct {
+	mu      sync.Mutex
+	denials []denial
+	// next is the index the next denial is written to
+	next int
+}
+
+// newRecentDenials returns an empty ring buffer.
+func newRecentDenials() *recentDenials {
+	return &recentDenials{denials: make([]denial, 0, recentDenialsSize)}
+}
+
+// add keeps the denial, the oldest one is dropped if the buffer is full.
+func (rd *recentDenials) add(d denial) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	if len(rd.denials) < recentDenialsSize {
+		rd.denials = append(rd.denials, d)
+	} else {
+		rd.denials[rd.next] = d
+	}
+	rd.next = (rd.next + 1) % recentDenialsSize
+}
+
+// list returns recent denials, the latest first. It's empty if rd is nil.
+func (rd *recentDenials) list() []denial {
+	if rd == nil {
+		return []denial{}
+	}
+
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	denials := make([]denial, 0, len(rd.denials))
+	for i := 1; i <= len(rd.denials); i++ {
+		denials = append(denials, rd.denials[(rd.next-i+recentDenialsSize)%recentDenialsSize])
+	}
+
+	return denials
+}
+
+// denial describes a request rejected with 401 Unauthorized or 403 Forbidden.
+type denial struct {
+	Time      time.Time `json:"time"`
+	Status    int       `json:"status"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Reason    string    `json:"reason,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// recordDenial keeps the request in recent denials if it's rejected with 401 or 403, so operators can see who gets rejected and why without searching logs.
+func (app *application) recordDenial(r *http.Request, status int, err error) {
+	if app.recentDenials == nil || (status != http.StatusUnauthorized && status != http.StatusForbidden) {
+		return
+	}
+
+	d := denial{
+		Time:   time.Now(),
+		Status: status,
+		Method: r.Method,
+		Path:   r.URL.Path,
+	}
+
+	if err != nil {
+		d.Reason = err.Error()
+	}
+	d.Roles, _ = r.Context().Value(contextKeyRoles).([]string)
+	if addr, err := app.getClientIP(r); err == nil {
+		d.ClientIP = addr.String()
+	}
+	if id, ok := hlog.IDFromRequest(r); ok {
+		d.RequestID = id.String()
+	}
+
+	app.recentDenials.add(d)
+}
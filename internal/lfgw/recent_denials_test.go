@@ -0,0 +1,45 @@
+package lfgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_recordDenial(t *testing.T) {
+	app := &application{
+		recentDenials: newRecentDenials(),
+	}
+
+	t.Run("Only denials are kept", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyRoles, []string{"team-a"}))
+
+		app.recordDenial(r, http.StatusBadRequest, errors.New("bad request"))
+		app.recordDenial(r, http.StatusForbidden, errors.New("source IP is not allowed"))
+
+		denials := app.recentDenials.list()
+		assert.Len(t, denials, 1)
+		assert.Equal(t, http.StatusForbidden, denials[0].Status)
+		assert.Equal(t, "/api/v1/query", denials[0].Path)
+		assert.Equal(t, "source IP is not allowed", denials[0].Reason)
+		assert.Equal(t, []string{"team-a"}, denials[0].Roles)
+	})
+
+	t.Run("The latest denials are kept, the latest first", func(t *testing.T) {
+		for i := 0; i < recentDenialsSize+10; i++ {
+			r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/query?i=%d", i), nil)
+			app.recordDenial(r, http.StatusUnauthorized, fmt.Errorf("denial %d", i))
+		}
+
+		denials := app.recentDenials.list()
+		assert.Len(t, denials, recentDenialsSize)
+		assert.Equal(t, fmt.Sprintf("denial %d", recentDenialsSize+9), denials[0].Reason)
+		assert.Equal(t, "denial 10", denials[recentDenialsSize-1].Reason)
+	})
+}
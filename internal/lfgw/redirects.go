@@ -0,0 +1,100 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+const (
+	upstreamRedirectsRewrite = "rewrite"
+	upstreamRedirectsFollow  = "follow"
+
+	// maxUpstreamRedirects limits the number of redirects followed server-side
+	maxUpstreamRedirects = 10
+)
+
+// configureUpstreamRedirects makes the proxy follow redirects within the upstream server-side if app.UpstreamRedirects is set to follow. Redirects that are not followed (e.g. to other hosts) are handled by rewriteLocationHeader in both modes, so upstream redirects don't leak the upstream address to clients.
+func (app *application) configureUpstreamRedirects(proxy *httputil.ReverseProxy) {
+	if app.UpstreamRedirects == upstreamRedirectsFollow {
+		proxy.Transport = newRedirectFollowingTransport(app.UpstreamURL, proxy.Transport)
+	}
+}
+
+// rewriteLocationHeader replaces a Location header pointing to the upstream with a path relative to lfgw, so clients resolve it against the external URL they used. The upstream path prefix (if any) is stripped as it's added back while proxying. Locations pointing elsewhere are left as is.
+func (app *application) rewriteLocationHeader(resp *http.Response) error {
+	location := resp.Header.Get("Location")
+	if location == "" || app.UpstreamURL == nil {
+		return nil
+	}
+
+	locationURL, err := url.Parse(location)
+	if err != nil {
+		// Not our business, the client will deal with it
+		return nil
+	}
+
+	if resp.Request != nil {
+		locationURL = resp.Request.URL.ResolveReference(locationURL)
+	}
+
+	if !strings.EqualFold(locationURL.Host, app.UpstreamURL.Host) {
+		return nil
+	}
+
+	prefix := strings.TrimRight(app.UpstreamURL.Path, "/")
+	path := locationURL.Path
+	if prefix != "" {
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			return nil
+		}
+		path = strings.TrimPrefix(path, prefix)
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	rewritten := url.URL{
+		Path:     path,
+		RawQuery: locationURL.RawQuery,
+		Fragment: locationURL.Fragment,
+	}
+
+	resp.Header.Set("Location", rewritten.String())
+
+	return nil
+}
+
+// redirectFollowingTransport follows redirects that stay within the upstream, so clients get the final response.
+type redirectFollowingTransport struct {
+	client *http.Client
+}
+
+// newRedirectFollowingTransport returns a transport following redirects to the upstream host. Redirects to other hosts are returned as is, so credentials are never sent elsewhere. base defaults to http.DefaultTransport.
+func newRedirectFollowingTransport(upstreamURL *url.URL, base http.RoundTripper) *redirectFollowingTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &redirectFollowingTransport{
+		client: &http.Client{
+			Transport: base,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxUpstreamRedirects || !strings.EqualFold(req.URL.Host, upstreamURL.Host) {
+					return http.ErrUseLastResponse
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// RoundTrip implements http.RoundTripper. Requests with a body are followed only if the body can be replayed (GetBody is set), otherwise the redirect is returned as is.
+func (t *redirectFollowingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// http.Client refuses to send server requests
+	req = req.Clone(req.Context())
+	req.RequestURI = ""
+
+	return t.client.Do(req)
+}
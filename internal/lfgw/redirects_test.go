@@ -0,0 +1,115 @@
+package lfgw
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_configureUpstreamRedirects(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/prom/graph":
+			http.Redirect(w, r, "http://"+r.Host+"/prom/new-graph?g0.expr=up", http.StatusFound)
+		case "/prom/relative":
+			http.Redirect(w, r, "/prom/new-graph", http.StatusMovedPermanently)
+		case "/prom/external":
+			http.Redirect(w, r, "https://grafana.localhost/d/abc", http.StatusFound)
+		case "/prom/outside-prefix":
+			http.Redirect(w, r, "/other", http.StatusFound)
+		case "/prom/new-graph":
+			_, _ = w.Write([]byte("graph"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+
+	upstreamURL, err := url.Parse(upstream.URL + "/prom")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name         string
+		mode         string
+		path         string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "rewrite absolute location",
+			mode:         upstreamRedirectsRewrite,
+			path:         "/graph",
+			wantStatus:   http.StatusFound,
+			wantLocation: "/new-graph?g0.expr=up",
+		},
+		{
+			name:         "rewrite relative location",
+			mode:         upstreamRedirectsRewrite,
+			path:         "/relative",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/new-graph",
+		},
+		{
+			name:         "external location is kept",
+			mode:         upstreamRedirectsRewrite,
+			path:         "/external",
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://grafana.localhost/d/abc",
+		},
+		{
+			name:         "location outside of upstream path is kept",
+			mode:         upstreamRedirectsRewrite,
+			path:         "/outside-prefix",
+			wantStatus:   http.StatusFound,
+			wantLocation: "/other",
+		},
+		{
+			name:       "follow",
+			mode:       upstreamRedirectsFollow,
+			path:       "/graph",
+			wantStatus: http.StatusOK,
+			wantBody:   "graph",
+		},
+		{
+			name:         "follow does not leave upstream",
+			mode:         upstreamRedirectsFollow,
+			path:         "/external",
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://grafana.localhost/d/abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.New(io.Discard)
+			app := application{
+				UpstreamURL:       upstreamURL,
+				UpstreamRedirects: tt.mode,
+				logger:            &logger,
+			}
+
+			proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+			app.configureUpstreamRedirects(proxy)
+			proxy.ModifyResponse = app.modifyResponse
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			// Normally done by rewriteRequestMiddleware
+			r.Host = upstreamURL.Host
+			proxy.ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantLocation, rr.Header().Get("Location"))
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package lfgw
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+var aclLastSuccessfulReload = metrics.NewFloatCounter("acl_last_successful_reload_timestamp_seconds")
+
+// aclsState guards app.ACLs, so they can be swapped at runtime (e.g. on SIGHUP) while requests are being served, and keeps where they come from.
+type aclsState struct {
+	mu sync.RWMutex
+	// loadedAt is the time app.ACLs were last replaced
+	loadedAt time.Time
+	// document is the document (in the acl.yaml format) app.ACLs were loaded from, nil if they were not loaded from a document (e.g. from MetricsAccessPolicy objects)
+	document []byte
+}
+
+// getACLs returns the current ACLs. The returned map must not be modified, reloads replace it as a whole.
+func (app *application) getACLs() querymodifier.ACLs {
+	app.acls.mu.RLock()
+	defer app.acls.mu.RUnlock()
+
+	return app.ACLs
+}
+
+// setACLs atomically replaces the current ACLs and returns the previous ones.
+func (app *application) setACLs(acls querymodifier.ACLs) querymodifier.ACLs {
+	return app.setACLsDocument(acls, nil)
+}
+
+// setACLsDocument is the same as setACLs, but it also keeps the document the ACLs were loaded from (in the acl.yaml format), so it can be exported. document is nil if the ACLs were not loaded from a document (e.g. from MetricsAccessPolicy objects).
+func (app *application) setACLsDocument(acls querymodifier.ACLs, document []byte) querymodifier.ACLs {
+	app.acls.mu.Lock()
+	defer app.acls.mu.Unlock()
+
+	previous := app.ACLs
+	app.ACLs = app.withKeycloakRoleACLs(acls)
+	app.acls.loadedAt = time.Now()
+	app.acls.document = document
+
+	return previous
+}
+
+// reloadACLs re-reads and re-validates app.ACLPath. The current ACLs are kept if the file fails validation.
+func (app *application) reloadACLs() error {
+	// Just to make sure our logging calls are always safe
+	if app.logger == nil {
+		app.configureLogging()
+	}
+
+	document, err := os.ReadFile(app.ACLPath)
+	if err != nil {
+		app.logger.Error().Caller().
+			Err(err).Msgf("Failed to reload ACL, keeping the previous one")
+		return err
+	}
+
+	acls, warnings, err := querymodifier.NewACLsFromBytes(document, app.EnforcedLabel)
+	if err != nil {
+		app.logger.Error().Caller().
+			Err(err).Msgf("Failed to reload ACL, keeping the previous one")
+		return err
+	}
+
+	if err := app.handleDeprecations(app.ACLPath, warnings); err != nil {
+		app.logger.Error().Caller().
+			Err(err).Msgf("Failed to reload ACL, keeping the previous one")
+		return err
+	}
+
+	app.logRoleDefinitions(acls)
+
+	previous := app.setACLsDocument(acls, document)
+	aclLastSuccessfulReload.Set(float64(time.Now().Unix()))
+
+	app.logACLSummary(previous, acls)
+
+	return nil
+}
+
+// reloadACLsOnSIGHUP reloads ACLs every time SIGHUP is received until ctx is cancelled.
+func (app *application) reloadACLsOnSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-hup:
+			app.logger.Info().Caller().
+				Msgf("Caught %s signal, reloading ACL from %s", s, app.ACLPath)
+
+			_ = app.reloadACLs()
+		}
+	}
+}
+
+// reloadHandler reloads ACLs from the configured source (and roles discovered in Keycloak) on POST or PUT, mirroring /-/reload of Prometheus. It's available only if EnableLifecycle is set, and requires the admin token if it's configured.
+func (app *application) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.EnableLifecycle {
+		app.clientErrorMessage(w, http.StatusForbidden, errLifecycleDisabled)
+		return
+	}
+
+	if app.AdminToken != "" && !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPost+", "+http.MethodPut)
+		app.clientError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	hlog.FromRequest(r).Info().Caller().
+		Msg("Reload requested")
+
+	if err := app.reload(r.Context()); err != nil {
+		hlog.FromRequest(r).Error().Caller().
+			Err(err).Msg("")
+		app.clientErrorMessage(w, http.StatusInternalServerError, fmt.Errorf("failed to reload: %w", err))
+		return
+	}
+
+	_, _ = w.Write([]byte("Reloaded"))
+}
+
+// reload re-reads ACLs from the configured source, the current ACLs are kept on errors. With Kubernetes RBAC, cached ACLs of users are dropped instead.
+func (app *application) reload(ctx context.Context) error {
+	var err error
+
+	switch {
+	case app.ACLURL != "":
+		err = app.syncRemoteACLs(ctx)
+	case app.ACLConfigMap != "":
+		_, err = app.syncConfigMapACLs(ctx)
+	case app.ACLSource == aclSourceKubernetes:
+		_, err = app.syncKubernetesACLs(ctx)
+	case app.ACLSource == aclSourceKubernetesRBAC:
+		app.kubernetesRBACCache.reset()
+	case app.ACLPath != "":
+		err = app.reloadACLs()
+	}
+	if err != nil {
+		return err
+	}
+
+	if app.KeycloakRoleSyncInterval > 0 {
+		return app.syncKeycloakRoles(ctx)
+	}
+
+	return nil
+}
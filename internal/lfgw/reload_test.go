@@ -0,0 +1,160 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_reloadACLs(t *testing.T) {
+	aclPath := filepath.Join(t.TempDir(), "acl.yaml")
+
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:    &aclsState{},
+		logger:  &logger,
+		ACLPath: aclPath,
+	}
+
+	t.Run("Valid file", func(t *testing.T) {
+		err := os.WriteFile(aclPath, []byte("version: 2\nroles:\n  admin: .*\n  minio: minio\n"), 0o600)
+		assert.Nil(t, err)
+
+		err = app.reloadACLs()
+		assert.Nil(t, err)
+
+		acls := app.getACLs()
+		assert.Len(t, acls, 2)
+		assert.Equal(t, "minio", acls["minio"].RawACL)
+	})
+
+	t.Run("Updated file", func(t *testing.T) {
+		err := os.WriteFile(aclPath, []byte("version: 2\nroles:\n  minio: minio, mimir\n"), 0o600)
+		assert.Nil(t, err)
+
+		err = app.reloadACLs()
+		assert.Nil(t, err)
+
+		acls := app.getACLs()
+		assert.Len(t, acls, 1)
+		assert.Equal(t, "minio, mimir", acls["minio"].RawACL)
+	})
+
+	t.Run("Invalid file keeps the previous ACL", func(t *testing.T) {
+		previous := app.getACLs()
+
+		err := os.WriteFile(aclPath, []byte("version: 2\nroles:\n  minio: mini[o\n"), 0o600)
+		assert.Nil(t, err)
+
+		err = app.reloadACLs()
+		assert.NotNil(t, err)
+		assert.Equal(t, previous, app.getACLs())
+	})
+
+	t.Run("Missing file keeps the previous ACL", func(t *testing.T) {
+		previous := app.getACLs()
+
+		err := os.Remove(aclPath)
+		assert.Nil(t, err)
+
+		err = app.reloadACLs()
+		assert.NotNil(t, err)
+		assert.Equal(t, previous, app.getACLs())
+	})
+}
+
+func TestApp_reloadHandler(t *testing.T) {
+	aclPath := filepath.Join(t.TempDir(), "acl.yaml")
+	err := os.WriteFile(aclPath, []byte("version: 2\nroles:\n  minio: minio\n"), 0o600)
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+
+	tests := []struct {
+		name          string
+		app           *application
+		method        string
+		authorization string
+		content       string
+		want          int
+		wantRawACL    string
+	}{
+		{
+			name:       "Lifecycle API is disabled",
+			app:        &application{ACLPath: aclPath},
+			method:     http.MethodPost,
+			content:    "version: 2\nroles:\n  minio: minio, mimir\n",
+			want:       http.StatusForbidden,
+			wantRawACL: "minio",
+		},
+		{
+			name:       "Reload without admin token",
+			app:        &application{ACLPath: aclPath, EnableLifecycle: true},
+			method:     http.MethodPost,
+			content:    "version: 2\nroles:\n  minio: minio, mimir\n",
+			want:       http.StatusOK,
+			wantRawACL: "minio, mimir",
+		},
+		{
+			name:       "Not allowed method",
+			app:        &application{ACLPath: aclPath, EnableLifecycle: true},
+			method:     http.MethodGet,
+			content:    "version: 2\nroles:\n  minio: minio, loki\n",
+			want:       http.StatusMethodNotAllowed,
+			wantRawACL: "minio",
+		},
+		{
+			name:       "Admin token is required if set",
+			app:        &application{ACLPath: aclPath, EnableLifecycle: true, AdminToken: "secret"},
+			method:     http.MethodPost,
+			content:    "version: 2\nroles:\n  minio: minio, loki\n",
+			want:       http.StatusUnauthorized,
+			wantRawACL: "minio",
+		},
+		{
+			name:          "Reload with admin token",
+			app:           &application{ACLPath: aclPath, EnableLifecycle: true, AdminToken: "secret"},
+			method:        http.MethodPut,
+			authorization: "Bearer secret",
+			content:       "version: 2\nroles:\n  minio: minio, loki\n",
+			want:          http.StatusOK,
+			wantRawACL:    "minio, loki",
+		},
+		{
+			name:          "Invalid file keeps the previous ACL",
+			app:           &application{ACLPath: aclPath, EnableLifecycle: true, AdminToken: "secret"},
+			method:        http.MethodPost,
+			authorization: "Bearer secret",
+			content:       "version: 2\nroles:\n  minio: mini[o\n",
+			want:          http.StatusInternalServerError,
+			wantRawACL:    "minio",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.app.logger = &logger
+			tt.app.acls = &aclsState{}
+			assert.Nil(t, os.WriteFile(aclPath, []byte("version: 2\nroles:\n  minio: minio\n"), 0o600))
+			assert.Nil(t, tt.app.reloadACLs())
+			assert.Nil(t, os.WriteFile(aclPath, []byte(tt.content), 0o600))
+
+			r := httptest.NewRequest(tt.method, "/-/reload", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			tt.app.reloadHandler(rr, r)
+
+			assert.Equal(t, tt.want, rr.Code)
+			assert.Equal(t, tt.wantRawACL, tt.app.getACLs()["minio"].RawACL)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package lfgw
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// maxRemoteACLSize limits the size of ACL documents fetched from ACLURL.
+const maxRemoteACLSize = 10 << 20
+
+// configureRemoteACLs loads ACLs from app.ACLURL.
+func (app *application) configureRemoteACLs() error {
+	app.logger.Info().Caller().
+		Msgf("Loading ACLs from %s (refresh interval: %s)", app.ACLURL, app.ACLURLRefreshInterval)
+
+	return app.syncRemoteACLs(context.Background())
+}
+
+// fetchRemoteACLs fetches the ACL document from app.ACLURL. If the document hasn't changed since the previous fetch (according to its ETag), nil is returned.
+func (app *application) fetchRemoteACLs(ctx context.Context) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, app.ACLURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if app.ACLURLToken != "" {
+		req.Header.Set("Authorization", "Bearer "+app.currentSecret("ACL_URL_TOKEN", app.ACLURLToken))
+	}
+	if app.remoteACLETag != "" {
+		req.Header.Set("If-None-Match", app.remoteACLETag)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, app.remoteACLETag, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, "", fmt.Errorf("GET %s: %s: %s", app.ACLURL, resp.Status, body)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteACLSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(content) > maxRemoteACLSize {
+		return nil, "", fmt.Errorf("GET %s: the document exceeds %d bytes", app.ACLURL, maxRemoteACLSize)
+	}
+
+	return content, resp.Header.Get("ETag"), nil
+}
+
+// syncRemoteACLs fetches the ACL document from app.ACLURL, validates it and swaps ACLs. The current ACLs are kept if the document cannot be fetched or fails validation.
+func (app *application) syncRemoteACLs(ctx context.Context) error {
+	content, etag, err := app.fetchRemoteACLs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch ACL from %s, keeping the previous one: %w", app.ACLURL, err)
+	}
+
+	if content == nil {
+		app.logger.Debug().Caller().
+			Msgf("ACL at %s has not changed", app.ACLURL)
+		aclLastSuccessfulReload.Set(float64(time.Now().Unix()))
+		return nil
+	}
+
+	acls, warnings, err := querymodifier.NewACLsFromBytes(content, app.EnforcedLabel)
+	if err != nil {
+		return fmt.Errorf("failed to load ACL from %s, keeping the previous one: %w", app.ACLURL, err)
+	}
+
+	if err := app.handleDeprecations(app.ACLURL, warnings); err != nil {
+		return fmt.Errorf("failed to load ACL from %s, keeping the previous one: %w", app.ACLURL, err)
+	}
+
+	app.logRoleDefinitions(acls)
+
+	previous := app.setACLsDocument(acls, content)
+	app.remoteACLETag = etag
+	aclLastSuccessfulReload.Set(float64(time.Now().Unix()))
+
+	app.logACLSummary(previous, acls)
+
+	return nil
+}
+
+// runRemoteACLRefresher periodically refreshes ACLs from app.ACLURL until ctx is cancelled.
+func (app *application) runRemoteACLRefresher(ctx context.Context) {
+	ticker := time.NewTicker(app.ACLURLRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := app.syncRemoteACLs(ctx); err != nil {
+			app.logger.Error().Caller().
+				Err(err).Msg("")
+		}
+	}
+}
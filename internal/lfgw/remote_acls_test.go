@@ -0,0 +1,97 @@
+package lfgw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_syncRemoteACLs(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	var (
+		content atomic.Value
+		status  atomic.Int32
+	)
+	content.Store("version: 2\nroles:\n  minio: minio\n")
+	status.Store(http.StatusOK)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer acl-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		etag := `"` + content.Load().(string) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(int(status.Load()))
+		_, _ = w.Write([]byte(content.Load().(string)))
+	}))
+	defer ts.Close()
+
+	app := &application{
+		acls:        &aclsState{},
+		logger:      &logger,
+		ACLURL:      ts.URL,
+		ACLURLToken: "acl-token",
+	}
+
+	err := app.syncRemoteACLs(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "minio", app.getACLs()["minio"].RawACL)
+
+	t.Run("Unchanged document", func(t *testing.T) {
+		previous := app.getACLs()
+
+		err := app.syncRemoteACLs(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, previous, app.getACLs())
+	})
+
+	t.Run("Updated document", func(t *testing.T) {
+		content.Store("version: 2\nroles:\n  minio: minio, mimir\n")
+
+		err := app.syncRemoteACLs(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, "minio, mimir", app.getACLs()["minio"].RawACL)
+	})
+
+	t.Run("Invalid document keeps the previous ACL", func(t *testing.T) {
+		previous := app.getACLs()
+		content.Store("version: 2\nroles:\n  minio: mini[o\n")
+
+		err := app.syncRemoteACLs(context.Background())
+		assert.NotNil(t, err)
+		assert.Equal(t, previous, app.getACLs())
+	})
+
+	t.Run("Fetch failure keeps the previous ACL", func(t *testing.T) {
+		previous := app.getACLs()
+		content.Store("version: 2\nroles:\n  minio: minio\n")
+		status.Store(http.StatusInternalServerError)
+
+		err := app.syncRemoteACLs(context.Background())
+		assert.NotNil(t, err)
+		assert.Equal(t, previous, app.getACLs())
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		previous := app.getACLs()
+		status.Store(http.StatusOK)
+		app.ACLURLToken = "random-token"
+
+		err := app.syncRemoteACLs(context.Background())
+		assert.NotNil(t, err)
+		assert.Equal(t, previous, app.getACLs())
+	})
+}
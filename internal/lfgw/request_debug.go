@@ -0,0 +1,90 @@
+package lfgw
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+const (
+	debugHeader = "X-LFGW-Debug"
+
+	contextKeyRequestDebug = contextKey("requestDebug")
+)
+
+var debugRequests = metrics.NewCounter("debug_requests_total")
+
+// requestDebug tracks whether debug enrichment is requested through the X-LFGW-Debug header and allowed for the caller. Until the caller is known to have full access, debug fields are kept aside and added to the log context only once it's enabled.
+type requestDebug struct {
+	enabled bool
+	pending []debugField
+}
+
+// debugField is a log field kept aside until debug enrichment is enabled.
+type debugField struct {
+	name  string
+	value string
+}
+
+// withRequestDebug returns the request with debug enrichment pending if it's requested through the X-LFGW-Debug header. The header is never passed to the upstream. Nothing is changed in global debug mode.
+func (app *application) withRequestDebug(r *http.Request) *http.Request {
+	value := r.Header.Get(debugHeader)
+	r.Header.Del(debugHeader)
+
+	if app.Debug || value == "" {
+		return r
+	}
+
+	if requested, err := strconv.ParseBool(value); err != nil || !requested {
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), contextKeyRequestDebug, &requestDebug{}))
+}
+
+// isDebugRequested returns true if debug enrichment is on globally or requested for the request (it's not necessarily allowed yet).
+func (app *application) isDebugRequested(r *http.Request) bool {
+	if app.Debug {
+		return true
+	}
+
+	_, ok := r.Context().Value(contextKeyRequestDebug).(*requestDebug)
+	return ok
+}
+
+// isDebugRequest returns true if debug enrichment is on globally or enabled for the request.
+func (app *application) isDebugRequest(r *http.Request) bool {
+	if app.Debug {
+		return true
+	}
+
+	rd, ok := r.Context().Value(contextKeyRequestDebug).(*requestDebug)
+	return ok && rd.enabled
+}
+
+// allowRequestDebug enables requested debug enrichment if the ACL of the caller grants full access (before impersonation), fields kept aside so far are added to the log context. Otherwise, the request is processed as usual.
+func (app *application) allowRequestDebug(r *http.Request, acl querymodifier.ACL) {
+	rd, ok := r.Context().Value(contextKeyRequestDebug).(*requestDebug)
+	if !ok || rd.enabled {
+		return
+	}
+
+	if !acl.Fullaccess {
+		hlog.FromRequest(r).Warn().Caller().
+			Msgf("Ignored %s header, only users with full access are allowed to request debug enrichment", debugHeader)
+		return
+	}
+
+	rd.enabled = true
+	for _, field := range rd.pending {
+		app.enrichLogContext(r, field.name, field.value)
+	}
+	rd.pending = nil
+
+	debugRequests.Inc()
+	app.enrichLogContext(r, "debug", "true")
+}
@@ -0,0 +1,95 @@
+package lfgw
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_requestDebug(t *testing.T) {
+	app := &application{}
+
+	newRequest := func(header string) (*http.Request, *bytes.Buffer) {
+		t.Helper()
+
+		var buf bytes.Buffer
+		logger := zerolog.New(&buf)
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil)
+		if header != "" {
+			r.Header.Set(debugHeader, header)
+		}
+		r = r.WithContext(logger.WithContext(r.Context()))
+
+		return app.withRequestDebug(r), &buf
+	}
+
+	logEntry := func(r *http.Request, buf *bytes.Buffer) string {
+		t.Helper()
+
+		buf.Reset()
+		zerolog.Ctx(r.Context()).Info().Msg("")
+		return buf.String()
+	}
+
+	t.Run("Not requested", func(t *testing.T) {
+		r, buf := newRequest("")
+		assert.False(t, app.isDebugRequested(r))
+
+		app.enrichDebugLogContext(r, "get_params", "query=up")
+		app.allowRequestDebug(r, querymodifier.ACL{Fullaccess: true})
+		assert.False(t, app.isDebugRequest(r))
+		assert.NotContains(t, logEntry(r, buf), "get_params")
+	})
+
+	t.Run("Requested with an invalid value", func(t *testing.T) {
+		r, _ := newRequest("yes please")
+		assert.False(t, app.isDebugRequested(r))
+		assert.Empty(t, r.Header.Get(debugHeader))
+	})
+
+	t.Run("Requested by a user with full access", func(t *testing.T) {
+		r, buf := newRequest("true")
+		assert.True(t, app.isDebugRequested(r))
+		assert.False(t, app.isDebugRequest(r))
+		assert.Empty(t, r.Header.Get(debugHeader), "the header must not reach the upstream")
+
+		app.enrichDebugLogContext(r, "get_params", "query=up")
+		assert.NotContains(t, logEntry(r, buf), "get_params", "fields must be kept aside until debug is allowed")
+
+		app.allowRequestDebug(r, querymodifier.ACL{Fullaccess: true})
+		assert.True(t, app.isDebugRequest(r))
+		app.enrichDebugLogContext(r, "label_filter", `namespace=~".*"`)
+
+		entry := logEntry(r, buf)
+		assert.Contains(t, entry, `"get_params":"query=up"`)
+		assert.Contains(t, entry, `"label_filter":"namespace=~\".*\""`)
+		assert.Contains(t, entry, `"debug":"true"`)
+	})
+
+	t.Run("Requested by a user without full access", func(t *testing.T) {
+		r, buf := newRequest("1")
+
+		app.enrichDebugLogContext(r, "get_params", "query=up")
+		app.allowRequestDebug(r, querymodifier.ACL{RawACL: "team-a"})
+		app.enrichDebugLogContext(r, "label_filter", `namespace="team-a"`)
+		assert.False(t, app.isDebugRequest(r))
+
+		entry := logEntry(r, buf)
+		assert.NotContains(t, entry, "get_params")
+		assert.NotContains(t, entry, "label_filter")
+	})
+
+	t.Run("Global debug mode", func(t *testing.T) {
+		app := &application{Debug: true}
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+		assert.True(t, app.isDebugRequested(r))
+		assert.True(t, app.isDebugRequest(r))
+	})
+}
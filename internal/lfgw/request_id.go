@@ -0,0 +1,22 @@
+package lfgw
+
+import (
+	"net/http"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// upstreamRequestIDMiddleware sets the ID of the request (the same as logged as req_id) in app.RequestIDHeader of the proxied request, so logs of lfgw can be correlated with query logs of the upstream. A value sent by the client is replaced, as it cannot be trusted to be unique.
+func (app *application) upstreamRequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.RequestIDHeader != "" {
+			if id, ok := hlog.IDFromRequest(r); ok {
+				r.Header.Set(app.RequestIDHeader, id.String())
+			} else {
+				r.Header.Del(app.RequestIDHeader)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,40 @@
+package lfgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_upstreamRequestIDMiddleware(t *testing.T) {
+	app := &application{RequestIDHeader: "X-Request-Id"}
+
+	var upstreamID string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamID = r.Header.Get("X-Request-Id")
+	})
+	handler := app.logAndMetricsMiddleware(app.upstreamRequestIDMiddleware(next))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	r.Header.Set("X-Request-Id", "spoofed")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+
+	assert.NotEmpty(t, upstreamID)
+	assert.NotEqual(t, "spoofed", upstreamID)
+	assert.Equal(t, upstreamID, rr.Header().Get("X-Request-Id"), "the same ID must be returned to the client")
+}
+
+func TestApp_scrubResponseHeaders_requestID(t *testing.T) {
+	app := &application{RequestIDHeader: "X-Request-Id"}
+
+	resp := &http.Response{
+		Header:  http.Header{"X-Request-Id": []string{"upstream"}},
+		Request: httptest.NewRequest(http.MethodGet, "/api/v1/query", nil),
+	}
+	app.scrubResponseHeaders(resp)
+
+	assert.Empty(t, resp.Header.Get("X-Request-Id"), "the ID set by lfgw must not be duplicated")
+}
@@ -0,0 +1,241 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+const contextKeySnapshot = contextKey("snapshot")
+
+// requestSnapshot is a structured record of how a request was processed, so support engineers can look it up by the request ID instead of searching logs. It's filled in by middlewares while the request is processed and stored once it's served.
+type requestSnapshot struct {
+	ID              string             `json:"id"`
+	Time            time.Time          `json:"time"`
+	Method          string             `json:"method"`
+	Path            string             `json:"path"`
+	Caller          snapshotCaller     `json:"caller"`
+	ACL             *snapshotACL       `json:"acl,omitempty"`
+	OriginalParams  string             `json:"original_params,omitempty"`
+	RewrittenParams string             `json:"rewritten_params,omitempty"`
+	Error           string             `json:"error,omitempty"`
+	Status          int                `json:"status"`
+	Size            int                `json:"size"`
+	Duration        float64            `json:"duration_seconds"`
+	Stages          map[string]float64 `json:"stages_seconds,omitempty"`
+
+	stages requestStages
+}
+
+// snapshotCaller is a summary of the claims (or the API key) of the request.
+type snapshotCaller struct {
+	Subject  string   `json:"subject,omitempty"`
+	Email    string   `json:"email,omitempty"`
+	ClientID string   `json:"client_id,omitempty"`
+	APIKey   string   `json:"api_key,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// snapshotACL is the ACL the request was authorized with.
+type snapshotACL struct {
+	LabelFilter string `json:"label_filter,omitempty"`
+	Fullaccess  bool   `json:"fullaccess"`
+}
+
+// snapshotRing keeps the latest snapshots, they're indexed by the request ID.
+type snapshotRing struct {
+	mu        sync.RWMutex
+	snapshots []*requestSnapshot
+	next      int
+	byID      map[string]*requestSnapshot
+}
+
+// newSnapshotRing returns a ring keeping up to size snapshots.
+func newSnapshotRing(size int) *snapshotRing {
+	return &snapshotRing{
+		snapshots: make([]*requestSnapshot, 0, size),
+		byID:      make(map[string]*requestSnapshot, size),
+	}
+}
+
+// add stores the snapshot, the oldest one is dropped if the ring is full.
+func (sr *snapshotRing) add(snapshot *requestSnapshot) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if len(sr.snapshots) < cap(sr.snapshots) {
+		sr.snapshots = append(sr.snapshots, snapshot)
+	} else {
+		delete(sr.byID, sr.snapshots[sr.next].ID)
+		sr.snapshots[sr.next] = snapshot
+	}
+	sr.next = (sr.next + 1) % cap(sr.snapshots)
+	sr.byID[snapshot.ID] = snapshot
+}
+
+// get returns the snapshot of the request or nil if it's not kept (anymore).
+func (sr *snapshotRing) get(id string) *requestSnapshot {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	return sr.byID[id]
+}
+
+// configureRequestSnapshots sets up a ring for app.RequestSnapshots snapshots, they're disabled if it's 0.
+func (app *application) configureRequestSnapshots() {
+	app.requestSnapshots = nil
+	if app.RequestSnapshots > 0 {
+		app.requestSnapshots = newSnapshotRing(app.RequestSnapshots)
+	}
+}
+
+// requestSnapshotMiddleware starts a snapshot of the request along with its original params, and stores it once the request is served. It has to run after the request ID is set.
+func (app *application) requestSnapshotMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := hlog.IDFromRequest(r)
+		if app.requestSnapshots == nil || !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		snapshot := &requestSnapshot{
+			ID:     id.String(),
+			Time:   time.Now(),
+			Method: r.Method,
+			Path:   r.URL.Path,
+		}
+
+		params, err := app.snapshotParams(r)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		snapshot.OriginalParams = params
+
+		r = r.WithContext(context.WithValue(r.Context(), contextKeySnapshot, snapshot))
+
+		hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
+			snapshot.Status = status
+			snapshot.Size = size
+			snapshot.Duration = duration.Seconds()
+
+			snapshot.stages.mu.Lock()
+			for _, stage := range snapshot.stages.stages {
+				if snapshot.Stages == nil {
+					snapshot.Stages = make(map[string]float64)
+				}
+				snapshot.Stages[stage.name] = stage.duration.Seconds()
+			}
+			snapshot.stages.mu.Unlock()
+
+			app.requestSnapshots.add(snapshot)
+		})(next).ServeHTTP(w, r)
+	})
+}
+
+// requestSnapshotUpstreamMiddleware adds the caller, the ACL and the rewritten params to the snapshot of the request. It has to run right before the request is proxied.
+func (app *application) requestSnapshotUpstreamMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snapshot, ok := r.Context().Value(contextKeySnapshot).(*requestSnapshot)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if id, ok := r.Context().Value(contextKeyIdentity).(identity); ok {
+			snapshot.Caller = snapshotCaller{
+				Subject:  id.Subject,
+				Email:    id.Email,
+				ClientID: id.ClientID,
+				APIKey:   id.APIKey,
+			}
+		}
+		snapshot.Caller.Roles, _ = r.Context().Value(contextKeyRoles).([]string)
+
+		if acl, ok := r.Context().Value(contextKeyACL).(querymodifier.ACL); ok {
+			snapshot.ACL = &snapshotACL{
+				LabelFilter: app.labelFiltersString(acl),
+				Fullaccess:  acl.Fullaccess,
+			}
+		}
+
+		params, err := app.snapshotParams(r)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		snapshot.RewrittenParams = params
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// snapshotParams returns GET and POST params of the request unescaped. The body is restored, so it can still be read further on.
+func (app *application) snapshotParams(r *http.Request) (string, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", err
+	}
+
+	// Once r.ParseForm() is called, we need to update ContentLength, otherwise the request will fail
+	if app.hasFormBody(r.Method) {
+		newBody := strings.NewReader(r.PostForm.Encode())
+		r.ContentLength = newBody.Size()
+		r.Body = io.NopCloser(newBody)
+	}
+
+	params := app.unescapedURLQuery(r.Form.Encode())
+
+	// Workaround to make further r.ParseForm() calls update r.Form and r.PostForm again
+	r.Form = nil
+	r.PostForm = nil
+
+	return params, nil
+}
+
+// setSnapshotError keeps the reason the request failed with in its snapshot.
+func (app *application) setSnapshotError(r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+
+	if snapshot, ok := r.Context().Value(contextKeySnapshot).(*requestSnapshot); ok {
+		snapshot.Error = err.Error()
+	}
+}
+
+// requestSnapshotHandler returns the snapshot of the request passed as id (the ID returned in the request ID header and logged as req_id), it requires an admin token.
+func (app *application) requestSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if app.requestSnapshots == nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	if !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		app.clientError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	snapshot := app.requestSnapshots.get(r.URL.Query().Get("id"))
+	if snapshot == nil {
+		app.clientErrorMessage(w, http.StatusNotFound, errSnapshotNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		app.serverError(w, r, err)
+	}
+}
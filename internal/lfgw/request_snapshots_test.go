@@ -0,0 +1,135 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestSnapshotRing(t *testing.T) {
+	ring := newSnapshotRing(3)
+	for i := 0; i < 5; i++ {
+		ring.add(&requestSnapshot{ID: fmt.Sprintf("id-%d", i)})
+	}
+
+	assert.Nil(t, ring.get("id-0"))
+	assert.Nil(t, ring.get("id-1"))
+	for i := 2; i < 5; i++ {
+		id := fmt.Sprintf("id-%d", i)
+		if assert.NotNil(t, ring.get(id)) {
+			assert.Equal(t, id, ring.get(id).ID)
+		}
+	}
+	assert.Len(t, ring.byID, 3)
+}
+
+func TestApp_requestSnapshots(t *testing.T) {
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:           &logger,
+		AdminToken:       "secret",
+		RequestIDHeader:  "Request-Id",
+		RequestSnapshots: 10,
+	}
+	app.configureRequestSnapshots()
+
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.recordStage(r, stageUpstream, time.Now().Add(-time.Second))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Imitates authorization and rewriting of the request done by other middlewares
+	rewrite := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("deny") != "" {
+				app.userError(w, r, http.StatusForbidden, errPathNotAllowed)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), contextKeyIdentity, identity{Subject: "123", Email: "user@example.com"})
+			ctx = context.WithValue(ctx, contextKeyRoles, []string{"admin"})
+			ctx = context.WithValue(ctx, contextKeyACL, querymodifier.ACL{Fullaccess: true})
+			r = r.WithContext(ctx)
+			r.URL.RawQuery = `query=up{namespace="default"}`
+
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	handler := app.nonProxiedEndpointsMiddleware(
+		hlog.NewHandler(logger)(
+			hlog.RequestIDHandler("req_id", app.RequestIDHeader)(
+				app.requestSnapshotMiddleware(
+					rewrite(app.requestSnapshotUpstreamMiddleware(upstream))))))
+
+	proxied := func(target string) string {
+		t.Helper()
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr.Header().Get(app.RequestIDHeader)
+	}
+
+	lookup := func(id, authorization string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, "/admin/requests?id="+id, nil)
+		r.Header.Set("Authorization", authorization)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	t.Run("Successful request", func(t *testing.T) {
+		id := proxied("/api/v1/query?query=up")
+
+		rr := lookup(id, "Bearer secret")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var got requestSnapshot
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+		assert.Equal(t, id, got.ID)
+		assert.Equal(t, "/api/v1/query", got.Path)
+		assert.Equal(t, "user@example.com", got.Caller.Email)
+		assert.Equal(t, []string{"admin"}, got.Caller.Roles)
+		if assert.NotNil(t, got.ACL) {
+			assert.True(t, got.ACL.Fullaccess)
+		}
+		assert.Equal(t, "query=up", got.OriginalParams)
+		assert.Equal(t, `query=up{namespace="default"}`, got.RewrittenParams)
+		assert.Equal(t, http.StatusOK, got.Status)
+		assert.GreaterOrEqual(t, got.Stages[stageUpstream], 1.0)
+	})
+
+	t.Run("Denied request", func(t *testing.T) {
+		id := proxied("/api/v1/query?query=up&deny=1")
+
+		rr := lookup(id, "Bearer secret")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var got requestSnapshot
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+		assert.Equal(t, http.StatusForbidden, got.Status)
+		assert.Equal(t, errPathNotAllowed.Error(), got.Error)
+		assert.Nil(t, got.ACL)
+		assert.Empty(t, got.RewrittenParams)
+	})
+
+	t.Run("Unknown request", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, lookup("unknown", "Bearer secret").Code)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		id := proxied("/api/v1/query?query=up")
+		assert.Equal(t, http.StatusUnauthorized, lookup(id, "Bearer wrong").Code)
+	})
+}
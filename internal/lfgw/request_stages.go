@@ -0,0 +1,112 @@
+package lfgw
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog"
+)
+
+const (
+	stageAuth     = "auth"
+	stageACL      = "acl"
+	stageRewrite  = "rewrite"
+	stageUpstream = "upstream"
+
+	contextKeyStages = contextKey("stages")
+)
+
+// stageDurations contains a histogram per stage of request processing, so it's possible to see which stage adds latency under load.
+var stageDurations = map[string]*metrics.Histogram{
+	stageAuth:     metrics.NewHistogram(`request_stage_duration_seconds{stage="auth"}`),
+	stageACL:      metrics.NewHistogram(`request_stage_duration_seconds{stage="acl"}`),
+	stageRewrite:  metrics.NewHistogram(`request_stage_duration_seconds{stage="rewrite"}`),
+	stageUpstream: metrics.NewHistogram(`request_stage_duration_seconds{stage="upstream"}`),
+}
+
+// requestStage is the duration of a single stage of request processing.
+type requestStage struct {
+	name     string
+	duration time.Duration
+}
+
+// requestStages collects durations of stages of a request in the order they're completed, so they can be logged along with the request. The upstream stage might be recorded from another goroutine, hence the mutex.
+type requestStages struct {
+	mu     sync.Mutex
+	stages []requestStage
+}
+
+// add appends the duration of a stage.
+func (s *requestStages) add(name string, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stages = append(s.stages, requestStage{name: name, duration: duration})
+}
+
+// dict returns the durations as a zerolog dictionary (stage => duration).
+func (s *requestStages) dict() *zerolog.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dict := zerolog.Dict()
+	for _, stage := range s.stages {
+		dict = dict.Dur(stage.name, stage.duration)
+	}
+
+	return dict
+}
+
+// recordStage updates the histogram of the stage with the time passed since start. In debug mode, the duration is also kept in the request context, so it's logged along with the request.
+func (app *application) recordStage(r *http.Request, stage string, start time.Time) {
+	duration := time.Since(start)
+
+	if histogram, ok := stageDurations[stage]; ok {
+		histogram.Update(duration.Seconds())
+	}
+
+	if stages, ok := r.Context().Value(contextKeyStages).(*requestStages); ok {
+		stages.add(stage, duration)
+	}
+
+	if snapshot, ok := r.Context().Value(contextKeySnapshot).(*requestSnapshot); ok {
+		snapshot.stages.add(stage, duration)
+	}
+}
+
+// stageHandler records the time passed since start as the stage before passing the request to next. It's handy for middlewares with several exit points.
+func (app *application) stageHandler(stage string, start time.Time, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.recordStage(r, stage, start)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// stageTransport records the time it takes the upstream to respond (until response headers are received) as the upstream stage.
+type stageTransport struct {
+	app  *application
+	base http.RoundTripper
+}
+
+// newStageTransport returns a stageTransport wrapping base, which defaults to http.DefaultTransport.
+func newStageTransport(app *application, base http.RoundTripper) *stageTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &stageTransport{
+		app:  app,
+		base: base,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *stageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	t.app.recordStage(req, stageUpstream, start)
+
+	return resp, err
+}
@@ -0,0 +1,76 @@
+package lfgw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_requestStages(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer upstream.Close()
+
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+	app := &application{
+		logger: &logger,
+		Debug:  true,
+	}
+
+	transport := newStageTransport(app, nil)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.recordStage(r, stageAuth, time.Now().Add(-time.Millisecond))
+
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, upstream.URL, nil)
+		assert.Nil(t, err)
+
+		resp, err := transport.RoundTrip(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+
+		w.WriteHeader(resp.StatusCode)
+	})
+
+	handler := hlog.NewHandler(logger)(app.logAndMetricsMiddleware(app.stageHandler(stageRewrite, time.Now(), next)))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	var entry struct {
+		Stages map[string]float64 `json:"stages"`
+	}
+	assert.Nil(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Contains(t, entry.Stages, stageRewrite)
+	assert.Contains(t, entry.Stages, stageUpstream)
+	// The unit of durations depends on zerolog.DurationFieldUnit, so only the presence of the value is checked
+	assert.Contains(t, entry.Stages, stageAuth)
+	assert.Greater(t, entry.Stages[stageAuth], float64(0))
+
+	var exposed bytes.Buffer
+	metrics.WritePrometheus(&exposed, false)
+	assert.Contains(t, exposed.String(), `request_stage_duration_seconds_count{stage="upstream"}`)
+
+	t.Run("Durations are kept only in the request context", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		app.recordStage(r, stageAuth, time.Now())
+		assert.Nil(t, r.Context().Value(contextKeyStages))
+
+		stages := &requestStages{}
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyStages, stages))
+		app.recordStage(r, stageACL, time.Now())
+		assert.Len(t, stages.stages, 1)
+	})
+}
@@ -0,0 +1,90 @@
+package lfgw
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// requestTagRolesPlaceholder is replaced with roles of a user in app.RequestTag
+const requestTagRolesPlaceholder = "{roles}"
+
+// unsafeRequestTagSymbols matches symbols that are replaced in request tags, so a role name can never break out of a query comment
+var unsafeRequestTagSymbols = regexp.MustCompile(`[^A-Za-z0-9._:@,+-]`)
+
+// requestTag returns app.RequestTag with roles of a user substituted (sorted and comma-separated, none if there are no roles).
+func (app *application) requestTag(roles []string) string {
+	sorted := make([]string, len(roles))
+	copy(sorted, roles)
+	sort.Strings(sorted)
+
+	value := strings.Join(sorted, ",")
+	if value == "" {
+		value = "none"
+	}
+
+	tag := strings.ReplaceAll(app.RequestTag, requestTagRolesPlaceholder, value)
+
+	return unsafeRequestTagSymbols.ReplaceAllString(tag, "_")
+}
+
+// requestTagMiddleware tags API requests forwarded to the upstream with app.RequestTag, so upstream query logs (e.g. vmselect) can attribute load per tenant even without lfgw logs. Depending on app.RequestTagMode, the tag is either set as the app.RequestTagParam GET parameter (user-supplied values are overridden) or appended to queries as a comment. It's applied after queries are rewritten, as comments don't survive rewrites.
+func (app *application) requestTagMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.RequestTag == "" || app.isNotAPIRequest(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		roles, _ := r.Context().Value(contextKeyRoles).([]string)
+		tag := app.requestTag(roles)
+
+		if app.RequestTagMode != "comment" {
+			query := r.URL.Query()
+			query.Set(app.RequestTagParam, tag)
+			r.URL.RawQuery = query.Encode()
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		if commentQueries(query, tag) {
+			r.URL.RawQuery = query.Encode()
+		}
+
+		if !app.hasFormBody(r.Method) || !app.isFormEncoded(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		commentQueries(r.PostForm, tag)
+
+		newBody := strings.NewReader(r.PostForm.Encode())
+		r.ContentLength = newBody.Size()
+		r.Body = io.NopCloser(newBody)
+
+		// Workaround to make further r.ParseForm() calls update r.Form and r.PostForm again
+		r.Form = nil
+		r.PostForm = nil
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// commentQueries appends the tag as a comment to all query parameters, returns true if there were any.
+func commentQueries(params map[string][]string, tag string) bool {
+	queries := params["query"]
+	for i, query := range queries {
+		queries[i] = query + "\n# " + tag
+	}
+
+	return len(queries) > 0
+}
@@ -0,0 +1,96 @@
+package lfgw
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_requestTagMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		app        application
+		method     string
+		target     string
+		body       string
+		roles      []string
+		wantParams url.Values
+		wantBody   url.Values
+	}{
+		{
+			name:       "Disabled",
+			app:        application{RequestTagMode: "param", RequestTagParam: "client"},
+			method:     http.MethodGet,
+			target:     "/api/v1/query?query=up",
+			roles:      []string{"team-a"},
+			wantParams: url.Values{"query": {"up"}},
+		},
+		{
+			name:       "Param",
+			app:        application{RequestTag: "lfgw-{roles}", RequestTagMode: "param", RequestTagParam: "client"},
+			method:     http.MethodGet,
+			target:     "/api/v1/query?query=up&client=spoofed",
+			roles:      []string{"team-b", "team-a"},
+			wantParams: url.Values{"query": {"up"}, "client": {"lfgw-team-a,team-b"}},
+		},
+		{
+			name:       "Comment in GET params",
+			app:        application{RequestTag: "lfgw-{roles}", RequestTagMode: "comment"},
+			method:     http.MethodGet,
+			target:     "/api/v1/query?query=up",
+			wantParams: url.Values{"query": {"up\n# lfgw-none"}},
+		},
+		{
+			name:       "Comment in a form body",
+			app:        application{RequestTag: "lfgw-{roles}", RequestTagMode: "comment"},
+			method:     http.MethodPost,
+			target:     "/api/v1/query_range",
+			body:       "query=up&step=60",
+			roles:      []string{"team-a\n) or vector(1"},
+			wantParams: url.Values{},
+			wantBody:   url.Values{"query": {"up\n# lfgw-team-a___or_vector_1"}, "step": {"60"}},
+		},
+		{
+			name:       "Not an API request",
+			app:        application{RequestTag: "lfgw-{roles}", RequestTagMode: "param", RequestTagParam: "client"},
+			method:     http.MethodGet,
+			target:     "/vmui/?query=up",
+			wantParams: url.Values{"query": {"up"}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			r := httptest.NewRequest(tt.method, tt.target, body)
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyRoles, tt.roles))
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tt.wantParams, r.URL.Query())
+
+				if tt.wantBody != nil {
+					assert.Nil(t, r.ParseForm())
+					assert.Equal(t, tt.wantBody, r.PostForm)
+				}
+			})
+
+			rr := httptest.NewRecorder()
+			tt.app.requestTagMiddleware(next).ServeHTTP(rr, r)
+			assert.Equal(t, http.StatusOK, rr.Code)
+		})
+	}
+}
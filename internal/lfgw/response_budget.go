@@ -0,0 +1,62 @@
+package lfgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// contextKeyResponseTimeBudget holds the response time budget applied to the request
+const contextKeyResponseTimeBudget = contextKey("responseTimeBudget")
+
+var responseTimeBudgetsExceeded = metrics.NewCounter("response_time_budgets_exceeded_total")
+
+// responseTimeBudgetMiddleware cancels requests to the upstream once the response time budget of the ACL (response_time_budget of the roles) is exceeded, so tenants with a budget cannot occupy upstream workers for longer than that. The upstream is expected to abort queries of cancelled requests (VictoriaMetrics does).
+func (app *application) responseTimeBudgetMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.isNotAPIRequest(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		acl, ok := r.Context().Value(contextKeyACL).(querymodifier.ACL)
+		if !ok || acl.ResponseTimeBudget <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), acl.ResponseTimeBudget)
+		defer cancel()
+
+		ctx = context.WithValue(ctx, contextKeyResponseTimeBudget, acl.ResponseTimeBudget)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// proxyErrorHandler responds with 504 Gateway Timeout and a hint on how to make the query cheaper if the response time budget of the request is exceeded. Other errors are logged and answered with 502 Bad Gateway (the same way as by httputil.ReverseProxy by default). If the upstream has already started sending the response by the time the budget is exceeded, the response is cut off instead.
+func (app *application) proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	budget, ok := r.Context().Value(contextKeyResponseTimeBudget).(time.Duration)
+	if ok && errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		responseTimeBudgetsExceeded.Inc()
+
+		err = fmt.Errorf("%w (%s), narrow down the time range, increase the step or select fewer series", errResponseTimeBudgetExceeded, budget)
+		hlog.FromRequest(r).Warn().Caller().
+			Err(err).Msg("")
+		app.userError(w, r, http.StatusGatewayTimeout, err)
+		return
+	}
+
+	if !isClientGone(r, err) {
+		app.reportError(r, errorKindProxy, "error", err, nil)
+	}
+
+	hlog.FromRequest(r).Error().Caller().
+		Err(err).Msg("proxy error")
+	w.WriteHeader(http.StatusBadGateway)
+}
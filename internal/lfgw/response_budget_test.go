@@ -0,0 +1,89 @@
+package lfgw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_responseTimeBudgetMiddleware(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(100 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+
+	upstreamURL, err := url.Parse(upstream.URL)
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+	app := &application{
+		logger: &logger,
+	}
+	app.proxy = httputil.NewSingleHostReverseProxy(upstreamURL)
+	app.proxy.ErrorHandler = app.proxyErrorHandler
+
+	tests := []struct {
+		name     string
+		budget   time.Duration
+		path     string
+		want     int
+		wantBody string
+	}{
+		{
+			name:     "Budget is exceeded",
+			budget:   20 * time.Millisecond,
+			path:     "/api/v1/query_range?query=up",
+			want:     http.StatusGatewayTimeout,
+			wantBody: "Gateway Timeout\nresponse time budget of the roles is exceeded (20ms), narrow down the time range, increase the step or select fewer series",
+		},
+		{
+			name:   "Budget is not exceeded",
+			budget: time.Second,
+			path:   "/api/v1/query_range?query=up",
+			want:   http.StatusOK,
+		},
+		{
+			name: "No budget",
+			path: "/api/v1/query_range?query=up",
+			want: http.StatusOK,
+		},
+		{
+			name:   "Non-API request",
+			budget: 20 * time.Millisecond,
+			path:   "/vmui/",
+			want:   http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := querymodifier.NewACL("sandbox")
+			assert.Nil(t, err)
+			acl.ResponseTimeBudget = tt.budget
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyACL, acl))
+			rr := httptest.NewRecorder()
+
+			app.responseTimeBudgetMiddleware(app.proxy).ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.want, rr.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
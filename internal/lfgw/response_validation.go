@@ -0,0 +1,177 @@
+package lfgw
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+)
+
+// maxValidatedResponseSize limits the size of upstream responses that are validated, bigger responses are passed through as is
+const maxValidatedResponseSize = 10 << 20
+
+var upstreamResponseAnomalies = metrics.NewCounter("upstream_response_anomalies_total")
+
+// apiResponse is the envelope of Prometheus HTTP API responses.
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+}
+
+// validateUpstreamResponse logs responses of API endpoints that are not well-formed Prometheus API JSON, so rewrites an upstream silently mis-handles (e.g. after a version upgrade) are spotted quickly. It's only done in debug mode with app.ValidateUpstreamResponses enabled, log entries contain the rewritten query through the debug log context. The body is restored for the client in any case.
+func (app *application) validateUpstreamResponse(resp *http.Response) error {
+	if !app.Debug || !app.ValidateUpstreamResponses || resp.Request == nil || app.isNotAPIRequest(resp.Request.URL.Path) {
+		return nil
+	}
+
+	encoding := resp.Header.Get("Content-Encoding")
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxValidatedResponseSize+1))
+	if err != nil {
+		return err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+
+	if len(body) > maxValidatedResponseSize {
+		return nil
+	}
+
+	if encoding != "" {
+		zr, err := newDecompressor(encoding, bytes.NewReader(body))
+		if err == nil {
+			body, err = io.ReadAll(io.LimitReader(zr, maxValidatedResponseSize+1))
+			zr.Close()
+		}
+		if err != nil {
+			app.logResponseAnomaly(resp, fmt.Errorf("failed to decompress the response: %w", err))
+			return nil
+		}
+
+		if len(body) > maxValidatedResponseSize {
+			return nil
+		}
+	}
+
+	if err := validateAPIResponse(app.upstreamPath(resp.Request.URL.Path), resp.StatusCode, resp.Header.Get("Content-Type"), body); err != nil {
+		app.logResponseAnomaly(resp, err)
+	}
+
+	return nil
+}
+
+// logResponseAnomaly logs and counts an anomaly in an upstream response.
+func (app *application) logResponseAnomaly(resp *http.Response, err error) {
+	upstreamResponseAnomalies.Inc()
+	hlog.FromRequest(resp.Request).Warn().Caller().
+		Err(err).
+		Str("path", resp.Request.URL.Path).
+		Int("upstream_status", resp.StatusCode).
+		Msg("Malformed upstream response")
+}
+
+// validateAPIResponse returns an error if the body is not a well-formed Prometheus API response for the path and the status code.
+func validateAPIResponse(path string, status int, contentType string, body []byte) error {
+	// Federation and remote write / import endpoints don't return JSON
+	if path == "/federate" || !strings.HasPrefix(path, "/api/v1/") || strings.HasPrefix(path, "/api/v1/import") || strings.HasPrefix(path, "/api/v1/export") || path == "/api/v1/write" {
+		return nil
+	}
+
+	// Some upstreams return empty bodies for no content
+	if status == http.StatusNoContent {
+		return nil
+	}
+
+	if !strings.HasPrefix(contentType, "application/json") {
+		return fmt.Errorf("unexpected Content-Type: %q", contentType)
+	}
+
+	var ar apiResponse
+	if err := json.Unmarshal(body, &ar); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	switch ar.Status {
+	case "success":
+		if status >= http.StatusBadRequest {
+			return fmt.Errorf("status success with HTTP status %d", status)
+		}
+		return validateAPIData(path, ar.Data)
+	case "error":
+		if status < http.StatusBadRequest {
+			return fmt.Errorf("status error with HTTP status %d", status)
+		}
+		if ar.ErrorType == "" || ar.Error == "" {
+			return fmt.Errorf("status error without errorType or error")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unexpected status: %q", ar.Status)
+	}
+}
+
+// validateAPIData returns an error if data of a successful response doesn't match the format of the endpoint.
+func validateAPIData(path string, data json.RawMessage) error {
+	if len(data) == 0 {
+		return fmt.Errorf("data is missing")
+	}
+
+	switch {
+	case path == "/api/v1/query" || path == "/api/v1/query_range":
+		var result struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("invalid data: %w", err)
+		}
+
+		switch result.ResultType {
+		case "matrix", "vector":
+			var series []struct {
+				Metric map[string]string `json:"metric"`
+			}
+			if err := json.Unmarshal(result.Result, &series); err != nil {
+				return fmt.Errorf("invalid %s result: %w", result.ResultType, err)
+			}
+		case "scalar", "string":
+			var sample []any
+			if err := json.Unmarshal(result.Result, &sample); err != nil || len(sample) != 2 {
+				return fmt.Errorf("invalid %s result", result.ResultType)
+			}
+		default:
+			return fmt.Errorf("unexpected resultType: %q", result.ResultType)
+		}
+	case path == "/api/v1/series":
+		var series []map[string]string
+		if err := json.Unmarshal(data, &series); err != nil {
+			return fmt.Errorf("invalid series: %w", err)
+		}
+	case path == "/api/v1/labels" || strings.HasPrefix(path, "/api/v1/label/"):
+		var values []string
+		if err := json.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("invalid label values: %w", err)
+		}
+	case path == "/api/v1/format_query":
+		var query string
+		if err := json.Unmarshal(data, &query); err != nil {
+			return fmt.Errorf("invalid formatted query: %w", err)
+		}
+	case path == "/api/v1/parse_query":
+		var node map[string]any
+		if err := json.Unmarshal(data, &node); err != nil {
+			return fmt.Errorf("invalid syntax tree: %w", err)
+		}
+	}
+
+	return nil
+}
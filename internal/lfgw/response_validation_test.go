@@ -0,0 +1,194 @@
+package lfgw
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validateAPIResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{
+			name:   "vector",
+			path:   "/api/v1/query",
+			status: http.StatusOK,
+			body:   `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"namespace":"a"},"value":[1,"1"]}]}}`,
+		},
+		{
+			name:   "scalar",
+			path:   "/api/v1/query",
+			status: http.StatusOK,
+			body:   `{"status":"success","data":{"resultType":"scalar","result":[1,"1"]}}`,
+		},
+		{
+			name:   "error",
+			path:   "/api/v1/query",
+			status: http.StatusUnprocessableEntity,
+			body:   `{"status":"error","errorType":"execution","error":"cannot parse"}`,
+		},
+		{
+			name:   "labels",
+			path:   "/api/v1/label/namespace/values",
+			status: http.StatusOK,
+			body:   `{"status":"success","data":["a","b"]}`,
+		},
+		{
+			name:   "formatted query",
+			path:   "/api/v1/format_query",
+			status: http.StatusOK,
+			body:   `{"status":"success","data":"up{namespace=\"a\"}"}`,
+		},
+		{
+			name:   "syntax tree",
+			path:   "/api/v1/parse_query",
+			status: http.StatusOK,
+			body:   `{"status":"success","data":{"type":"vectorSelector","name":"up"}}`,
+		},
+		{
+			name:    "invalid formatted query",
+			path:    "/api/v1/format_query",
+			status:  http.StatusOK,
+			body:    `{"status":"success","data":{"query":"up"}}`,
+			wantErr: true,
+		},
+		{
+			name:   "federate is not validated",
+			path:   "/federate",
+			status: http.StatusOK,
+			body:   `up{namespace="a"} 1`,
+		},
+		{
+			name:    "invalid JSON",
+			path:    "/api/v1/query",
+			status:  http.StatusOK,
+			body:    `{"status":"success"`,
+			wantErr: true,
+		},
+		{
+			name:    "unexpected resultType",
+			path:    "/api/v1/query_range",
+			status:  http.StatusOK,
+			body:    `{"status":"success","data":{"resultType":"table","result":[]}}`,
+			wantErr: true,
+		},
+		{
+			name:    "success with error status",
+			path:    "/api/v1/query",
+			status:  http.StatusBadGateway,
+			body:    `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			wantErr: true,
+		},
+		{
+			name:    "error without details",
+			path:    "/api/v1/query",
+			status:  http.StatusBadRequest,
+			body:    `{"status":"error"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid series",
+			path:    "/api/v1/series",
+			status:  http.StatusOK,
+			body:    `{"status":"success","data":{"namespace":"a"}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAPIResponse(tt.path, tt.status, "application/json", []byte(tt.body))
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestApp_validateUpstreamResponse(t *testing.T) {
+	app := application{
+		Debug:                     true,
+		ValidateUpstreamResponses: true,
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write([]byte(`{"status":"success","data":{"resultType":"table"}}`))
+	assert.Nil(t, zw.Close())
+
+	tests := []struct {
+		name          string
+		body          []byte
+		encoding      string
+		wantAnomalies uint64
+	}{
+		{
+			name:          "valid",
+			body:          []byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`),
+			wantAnomalies: 0,
+		},
+		{
+			name:          "malformed",
+			body:          []byte(`<html>Bad Gateway</html>`),
+			wantAnomalies: 1,
+		},
+		{
+			name:          "malformed gzip",
+			body:          compressed.Bytes(),
+			encoding:      "gzip",
+			wantAnomalies: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(bytes.NewReader(tt.body)),
+				Request:    httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil),
+			}
+			if tt.encoding != "" {
+				resp.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			before := upstreamResponseAnomalies.Get()
+			assert.Nil(t, app.validateUpstreamResponse(resp))
+			assert.Equal(t, tt.wantAnomalies, upstreamResponseAnomalies.Get()-before)
+
+			// The body is passed to the client unchanged
+			body, err := io.ReadAll(resp.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.body, body)
+		})
+	}
+
+	t.Run("Debug mode is off", func(t *testing.T) {
+		app := application{ValidateUpstreamResponses: true}
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("malformed")),
+			Request:    httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil),
+		}
+
+		before := upstreamResponseAnomalies.Get()
+		assert.Nil(t, app.validateUpstreamResponse(resp))
+		assert.Equal(t, before, upstreamResponseAnomalies.Get())
+	})
+}
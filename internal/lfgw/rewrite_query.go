@@ -0,0 +1,101 @@
+package lfgw
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/VictoriaMetrics/metricsql"
+	"github.com/urfave/cli/v2"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// RewriteQuery prints a PromQL / MetricsQL expression rewritten for the roles (--role) from an ACL file or for an ACL definition (--acl), so the applied filters can be checked without a running gateway.
+func RewriteQuery(c *cli.Context) error {
+	query := c.Args().First()
+	if query == "" {
+		return fmt.Errorf("query is required")
+	}
+
+	if len(c.StringSlice("role")) > 0 == (c.String("acl") != "") {
+		return fmt.Errorf("exactly one of role or acl must be set")
+	}
+
+	app := application{
+		EnforcedLabel:          c.String("enforced-label"),
+		EnableDeduplication:    c.Bool("enable-deduplication"),
+		SharedNamespaces:       c.StringSlice("shared-namespaces"),
+		UnlabeledMetrics:       c.StringSlice("unlabeled-metrics"),
+		UnlabeledMetricsPolicy: c.String("unlabeled-metrics-policy"),
+		acls:                   &aclsState{},
+	}
+
+	var acl querymodifier.ACL
+	if c.String("acl") != "" {
+		var err error
+		acl, err = querymodifier.NewACLForLabel(app.EnforcedLabel, c.String("acl"))
+		if err != nil {
+			return fmt.Errorf("invalid acl: %w", err)
+		}
+	} else {
+		acls, err := querymodifier.NewACLsFromFile(c.String("acl-path"), app.EnforcedLabel)
+		if err != nil {
+			return err
+		}
+		app.ACLs = acls
+
+		acl, err = app.getUserACL(c.StringSlice("role"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return app.rewriteQuery(c.App.Writer, acl, query)
+}
+
+// rewriteQuery prints the query rewritten according to the ACL and its optimized form to w.
+func (app *application) rewriteQuery(w io.Writer, acl querymodifier.ACL, query string) error {
+	re, err := querymodifier.NewUnlabeledMetricsRegexp(app.UnlabeledMetrics)
+	if err != nil {
+		return err
+	}
+	app.unlabeledMetrics = re
+
+	acl, err = app.withSharedNamespaces(acl)
+	if err != nil {
+		return err
+	}
+
+	var rewritten string
+	if acl.Fullaccess {
+		expr, err := metricsql.Parse(query)
+		if err != nil {
+			return err
+		}
+		rewritten = string(expr.AppendString(nil))
+	} else {
+		qm := app.newQueryModifier(acl)
+
+		rawQuery, err := qm.GetModifiedEncodedURLValues(url.Values{"query": {query}})
+		if err != nil {
+			return err
+		}
+
+		params, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return err
+		}
+		rewritten = params.Get("query")
+	}
+
+	expr, err := metricsql.Parse(rewritten)
+	if err != nil {
+		return err
+	}
+	optimized := string(metricsql.Optimize(expr).AppendString(nil))
+
+	fmt.Fprintf(w, "label filters: %s\n", app.labelFiltersString(acl))
+	fmt.Fprintf(w, "rewritten: %s\n", rewritten)
+	_, err = fmt.Fprintf(w, "optimized: %s\n", optimized)
+	return err
+}
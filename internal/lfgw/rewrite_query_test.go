@@ -0,0 +1,77 @@
+package lfgw
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_rewriteQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     application
+		rawACL  string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "single namespace",
+			rawACL: "minio",
+			query:  `sum(rate(http_requests_total[5m]))`,
+			want:   "label filters: namespace=\"minio\"\nrewritten: sum(rate(http_requests_total{namespace=\"minio\"}[5m]))\noptimized: sum(rate(http_requests_total{namespace=\"minio\"}[5m]))\n",
+		},
+		{
+			name:   "optimized form",
+			rawACL: "minio",
+			query:  `foo + bar{job="a"}`,
+			want:   "label filters: namespace=\"minio\"\nrewritten: foo{namespace=\"minio\"} + bar{job=\"a\", namespace=\"minio\"}\noptimized: foo{job=\"a\", namespace=\"minio\"} + bar{job=\"a\", namespace=\"minio\"}\n",
+		},
+		{
+			name:   "full access",
+			rawACL: ".*",
+			query:  `up`,
+			want:   "label filters: namespace=~\".*\"\nrewritten: up\noptimized: up\n",
+		},
+		{
+			name:   "shared namespaces",
+			app:    application{SharedNamespaces: []string{"kube-public"}},
+			rawACL: "minio",
+			query:  `up`,
+			want:   "label filters: namespace=~\"minio|kube-public\"\nrewritten: up{namespace=~\"minio|kube-public\"}\noptimized: up{namespace=~\"minio|kube-public\"}\n",
+		},
+		{
+			name:    "rejected unlabeled metric",
+			app:     application{UnlabeledMetrics: []string{"node_.*"}, UnlabeledMetricsPolicy: querymodifier.UnlabeledPolicyReject},
+			rawACL:  "minio",
+			query:   `node_load1`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid query",
+			rawACL:  "minio",
+			query:   `sum(`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := querymodifier.NewACL(tt.rawACL)
+			assert.Nil(t, err)
+
+			var out bytes.Buffer
+			err = tt.app.rewriteQuery(&out, acl, tt.query)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
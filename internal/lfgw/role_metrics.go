@@ -0,0 +1,111 @@
+package lfgw
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	roleMetricsRole = "role"
+	roleMetricsHash = "hash"
+
+	// tenantUnauthenticated is used for requests rejected before roles are known (e.g. with invalid tokens)
+	tenantUnauthenticated = "unauthenticated"
+	// tenantUnmatched is used for requests with no roles defined in ACLs (e.g. assumed roles, default ACL)
+	tenantUnmatched = "unmatched"
+
+	contextKeyRoleMetrics = contextKey("roleMetrics")
+)
+
+// roleMetricsRecord is filled in while a request is processed, so roleMetricsMiddleware can update metrics of the tenant once the request is served. Middlewares run in the same goroutine, thus no locking is needed.
+type roleMetricsRecord struct {
+	tenant    string
+	rewritten bool
+}
+
+// roleMetricsMiddleware counts requests, denials (401, 403) and rewrites along with latencies per tenant, so it's visible who drives load and who gets rejected. The tenant is either the list of roles defined in ACLs (app.RoleMetrics is "role") or its hash ("hash").
+func (app *application) roleMetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.RoleMetrics == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		record := &roleMetricsRecord{}
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyRoleMetrics, record))
+
+		hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
+			app.updateRoleMetrics(record, status, duration)
+		})(next).ServeHTTP(w, r)
+	})
+}
+
+// updateRoleMetrics updates metrics of the tenant of a served request.
+func (app *application) updateRoleMetrics(record *roleMetricsRecord, status int, duration time.Duration) {
+	label := app.RoleMetrics
+	if label == roleMetricsHash {
+		label = "tenant"
+	}
+
+	tenant := record.tenant
+	if tenant == "" {
+		tenant = tenantUnauthenticated
+	}
+
+	metrics.GetOrCreateCounter(fmt.Sprintf(`role_requests_total{%s=%q}`, label, tenant)).Inc()
+	metrics.GetOrCreateHistogram(fmt.Sprintf(`role_request_duration_seconds{%s=%q}`, label, tenant)).Update(duration.Seconds())
+
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		metrics.GetOrCreateCounter(fmt.Sprintf(`role_denied_requests_total{%s=%q,status="%d"}`, label, tenant, status)).Inc()
+	}
+
+	if record.rewritten {
+		metrics.GetOrCreateCounter(fmt.Sprintf(`role_rewritten_requests_total{%s=%q}`, label, tenant)).Inc()
+	}
+}
+
+// setMetricsTenant records the tenant of the request based on its roles. Only roles defined in ACLs and pseudo-roles of API keys are considered to keep cardinality bounded.
+func (app *application) setMetricsTenant(r *http.Request, roles []string) {
+	record, ok := r.Context().Value(contextKeyRoleMetrics).(*roleMetricsRecord)
+	if !ok {
+		return
+	}
+
+	known := app.getACLs().ForRoles(roles)
+
+	tenantRoles := []string{}
+	for _, role := range roles {
+		if _, exists := known[role]; exists || strings.HasPrefix(role, apiKeyRolePrefix) {
+			tenantRoles = append(tenantRoles, role)
+		}
+	}
+
+	if len(tenantRoles) == 0 {
+		record.tenant = tenantUnmatched
+		return
+	}
+
+	sort.Strings(tenantRoles)
+	record.tenant = strings.Join(tenantRoles, ",")
+
+	if app.RoleMetrics == roleMetricsHash {
+		sum := sha256.Sum256([]byte(record.tenant))
+		record.tenant = hex.EncodeToString(sum[:])[:12]
+	}
+}
+
+// markRewritten records that the query of the request was rewritten according to the ACL.
+func (app *application) markRewritten(r *http.Request) {
+	if record, ok := r.Context().Value(contextKeyRoleMetrics).(*roleMetricsRecord); ok {
+		record.rewritten = true
+	}
+}
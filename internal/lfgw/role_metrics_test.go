@@ -0,0 +1,97 @@
+package lfgw
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_roleMetricsMiddleware(t *testing.T) {
+	acls, _, err := querymodifier.NewACLsFromBytes([]byte("rolemetrics-a: minio\nrolemetrics-b: stolon\n"), "")
+	assert.Nil(t, err)
+
+	counter := func(name, labels string) uint64 {
+		return metrics.GetOrCreateCounter(fmt.Sprintf(`%s{%s}`, name, labels)).Get()
+	}
+
+	tests := []struct {
+		name          string
+		mode          string
+		roles         []string
+		rewrite       bool
+		status        int
+		wantLabels    string
+		wantDenials   uint64
+		wantRewritten uint64
+	}{
+		{
+			name:          "roles",
+			mode:          roleMetricsRole,
+			roles:         []string{"rolemetrics-b", "unknown", "rolemetrics-a"},
+			rewrite:       true,
+			status:        http.StatusOK,
+			wantLabels:    `role="rolemetrics-a,rolemetrics-b"`,
+			wantRewritten: 1,
+		},
+		{
+			name:        "denied",
+			mode:        roleMetricsRole,
+			roles:       []string{"unknown"},
+			status:      http.StatusForbidden,
+			wantLabels:  `role="unmatched"`,
+			wantDenials: 1,
+		},
+		{
+			name:        "unauthenticated",
+			mode:        roleMetricsRole,
+			status:      http.StatusUnauthorized,
+			wantLabels:  `role="unauthenticated"`,
+			wantDenials: 1,
+		},
+		{
+			name:       "hashed",
+			mode:       roleMetricsHash,
+			roles:      []string{"rolemetrics-a"},
+			status:     http.StatusOK,
+			wantLabels: `tenant="89354396a5cb"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			app := application{
+				acls:        &aclsState{},
+				ACLs:        acls,
+				RoleMetrics: tt.mode,
+			}
+
+			deniedLabels := fmt.Sprintf(`%s,status="%d"`, tt.wantLabels, tt.status)
+			requestsBefore := counter("role_requests_total", tt.wantLabels)
+			deniedBefore := counter("role_denied_requests_total", deniedLabels)
+			rewrittenBefore := counter("role_rewritten_requests_total", tt.wantLabels)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.roles != nil {
+					app.setMetricsTenant(r, tt.roles)
+				}
+				if tt.rewrite {
+					app.markRewritten(r)
+				}
+				w.WriteHeader(tt.status)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+			app.roleMetricsMiddleware(next).ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, requestsBefore+1, counter("role_requests_total", tt.wantLabels))
+			assert.Equal(t, deniedBefore+tt.wantDenials, counter("role_denied_requests_total", deniedLabels))
+			assert.Equal(t, rewrittenBefore+tt.wantRewritten, counter("role_rewritten_requests_total", tt.wantLabels))
+		})
+	}
+}
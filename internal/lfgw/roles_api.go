@@ -0,0 +1,86 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// aclSourceKeycloak is the source of roles discovered in Keycloak (see KEYCLOAK_ROLE_SYNC_INTERVAL)
+const aclSourceKeycloak = "keycloak"
+
+// loadedRole describes a role of the currently loaded ACLs.
+type loadedRole struct {
+	Role        string    `json:"role"`
+	LabelFilter string    `json:"label_filter,omitempty"`
+	Pattern     string    `json:"pattern,omitempty"`
+	Fullaccess  bool      `json:"fullaccess"`
+	Source      string    `json:"source"`
+	LoadedAt    time.Time `json:"loaded_at"`
+}
+
+// aclSourceName returns the name of the source ACLs are loaded from.
+func (app *application) aclSourceName() string {
+	switch {
+	case app.ACLURL != "":
+		return "url"
+	case app.ACLConfigMap != "":
+		return "configmap"
+	case app.ACLSource == "":
+		return aclSourceFile
+	default:
+		return app.ACLSource
+	}
+}
+
+// loadedRoles returns the roles of the currently loaded ACLs sorted by name.
+func (app *application) loadedRoles() []loadedRole {
+	app.acls.mu.RLock()
+	defer app.acls.mu.RUnlock()
+
+	roles := make([]loadedRole, 0, len(app.ACLs))
+	for role, acl := range app.ACLs {
+		lr := loadedRole{
+			Role:       role,
+			Fullaccess: acl.Fullaccess,
+			Source:     app.aclSourceName(),
+			LoadedAt:   app.acls.loadedAt,
+		}
+
+		if _, synced := app.keycloakSyncedRoles[role]; synced {
+			lr.Source = aclSourceKeycloak
+		}
+
+		if acl.RolePattern != nil {
+			lr.Pattern = acl.RolePattern.Regexp.String()
+		} else {
+			lr.LabelFilter = app.labelFiltersString(acl)
+		}
+
+		roles = append(roles, lr)
+	}
+
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Role < roles[j].Role })
+
+	return roles
+}
+
+// rolesHandler lists the roles of the currently loaded ACLs along with their label filters, so operators can verify what the running instance has actually loaded. It requires an admin token.
+func (app *application) rolesHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdminRequest(r) {
+		app.clientError(w, http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		app.clientError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app.loadedRoles()); err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,76 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_rolesHandler(t *testing.T) {
+	acls, _, err := querymodifier.NewACLsFromBytes([]byte("version: 2\nroles:\n  team-b: b1, b2\n  admin: .*\n  team-(.+): ${1}\n"), "")
+	assert.Nil(t, err)
+
+	discovered, err := querymodifier.NewACL("payments")
+	assert.Nil(t, err)
+
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:                   &aclsState{},
+		logger:                 &logger,
+		AdminToken:             "secret",
+		ACLSource:              aclSourceFile,
+		keycloakDiscoveredACLs: querymodifier.ACLs{"payments-viewer": discovered},
+	}
+	app.setACLs(acls)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := app.nonProxiedEndpointsMiddleware(next)
+
+	request := func(method, authorization string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(method, "/lfgw/api/roles", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "Bearer wrong").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodPost, "Bearer secret").Code)
+
+	rr := request(http.MethodGet, "Bearer secret")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var got []loadedRole
+	assert.Nil(t, json.NewDecoder(rr.Body).Decode(&got))
+
+	for i := range got {
+		assert.False(t, got[i].LoadedAt.IsZero())
+		got[i].LoadedAt = app.acls.loadedAt
+	}
+
+	want := []loadedRole{
+		{Role: "admin", LabelFilter: `namespace=~".*"`, Fullaccess: true, Source: aclSourceFile},
+		{Role: "payments-viewer", LabelFilter: `namespace="payments"`, Source: aclSourceKeycloak},
+		{Role: "team-(.+)", Pattern: "^(?:team-(.+))$", Source: aclSourceFile},
+		{Role: "team-b", LabelFilter: `namespace=~"b1|b2"`, Source: aclSourceFile},
+	}
+	for i := range want {
+		want[i].LoadedAt = app.acls.loadedAt
+	}
+
+	assert.Equal(t, want, got)
+}
@@ -8,14 +8,40 @@ import (
 // routes returns a router with all paths.
 func (app *application) routes() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(app.routePrefixMiddleware)
+	r.Use(app.securityHeadersMiddleware)
 	r.Use(app.nonProxiedEndpointsMiddleware)
+	r.Use(app.uiPrefixMiddleware)
+	r.Use(app.sloMiddleware)
 	r.Use(hlog.NewHandler(*app.logger))
+	// Request bodies have to be decompressed before they're parsed for debug logs
+	r.Use(app.compressionMiddleware)
 	r.Use(app.logAndMetricsMiddleware)
+	// Panics are reported with the request ID set by logAndMetricsMiddleware
+	r.Use(app.errorReportingMiddleware)
+	r.Use(app.requestSnapshotMiddleware)
+	r.Use(app.maintenanceMiddleware)
+	r.Use(app.executionTraceMiddleware)
+	r.Use(app.roleMetricsMiddleware)
 	r.Use(app.oidcMiddleware)
+	r.Use(app.whoamiMiddleware)
+	r.Use(app.faultInjectionMiddleware)
 	// Better to keep it here to see user email in logs (for unsafe paths)
 	r.Use(app.safeModeMiddleware)
+	r.Use(app.methodAllowlistMiddleware)
+	r.Use(app.pathAllowlistMiddleware)
+	r.Use(app.paramLimitsMiddleware)
+	r.Use(app.queryCatalogMiddleware)
 	r.Use(app.proxyHeadersMiddleware)
 	r.Use(app.rewriteRequestMiddleware)
+	r.Use(app.slowRequestMiddleware)
+	r.Use(app.responseTimeBudgetMiddleware)
+	r.Use(app.requestTagMiddleware)
+	r.Use(app.readAfterWriteMiddleware)
+	r.Use(app.namespaceMetricsMiddleware)
+	r.Use(app.tokenExchangeMiddleware)
+	r.Use(app.upstreamRequestIDMiddleware)
+	r.Use(app.requestSnapshotUpstreamMiddleware)
 	r.PathPrefix("/").Handler(app.proxy)
 	return r
 }
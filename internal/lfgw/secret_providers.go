@@ -0,0 +1,407 @@
+package lfgw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	secretRefVault = "vault"
+	secretRefFile  = "file"
+
+	// secretRetryInterval is how long to wait before fetching a secret again if its refresh failed
+	secretRetryInterval = 30 * time.Second
+	// vaultLoginMargin is how long before expiration a Vault token obtained through Kubernetes auth is replaced with a new one
+	vaultLoginMargin = time.Minute
+	// vaultKubernetesTokenPath is the service account token used for Kubernetes auth
+	vaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+var (
+	secretRotationsTotal     = metrics.NewCounter("secret_rotations_total")
+	secretRefreshErrorsTotal = metrics.NewCounter("secret_refresh_errors_total")
+)
+
+// rotatedSecrets keeps rotated values of settings (setting name => value).
+type rotatedSecrets struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// newRotatedSecrets returns an empty store of rotated secrets.
+func newRotatedSecrets() *rotatedSecrets {
+	return &rotatedSecrets{values: make(map[string]string)}
+}
+
+// set stores the rotated value of the setting.
+func (rs *rotatedSecrets) set(name, value string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.values[name] = value
+}
+
+// get returns the rotated value of the setting, or the configured value if it hasn't been rotated (or rs is nil).
+func (rs *rotatedSecrets) get(name, configured string) string {
+	if rs == nil {
+		return configured
+	}
+
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	if value, ok := rs.values[name]; ok {
+		return value
+	}
+
+	return configured
+}
+
+// secretProvider fetches a secret by its reference (the part after <scheme>:). ttl is how long the value is valid (e.g. the lease duration), 0 means it's fetched only once.
+type secretProvider interface {
+	fetchSecret(ctx context.Context, ref string) (value string, ttl time.Duration, err error)
+}
+
+// secretField is a setting that can be set to a reference to a secret (e.g. vault:secret/data/lfgw#admin_token) instead of the secret itself.
+type secretField struct {
+	name  string
+	value *string
+	// rotatable settings are read through currentSecret, so rotated values are applied without a restart
+	rotatable bool
+}
+
+// leasedSecret is a secret that's fetched again before its ttl is over.
+type leasedSecret struct {
+	field     secretField
+	ref       string
+	provider  secretProvider
+	value     string
+	refreshAt time.Time
+}
+
+// secretFields returns settings that can be fetched from secret providers.
+func (app *application) secretFields() []secretField {
+	return []secretField{
+		{name: "ADMIN_TOKEN", value: &app.AdminToken, rotatable: true},
+		{name: "SECONDARY_ADMIN_TOKEN", value: &app.SecondaryAdminToken, rotatable: true},
+		{name: "ACL_URL_TOKEN", value: &app.ACLURLToken, rotatable: true},
+		{name: "CANARY_TOKEN", value: &app.CanaryToken, rotatable: true},
+		{name: "CANARY_CLIENT_SECRET", value: &app.CanaryClientSecret, rotatable: true},
+		{name: "TOKEN_EXCHANGE_CLIENT_SECRET", value: &app.TokenExchangeClientSecret, rotatable: true},
+		{name: "KEYCLOAK_ADMIN_CLIENT_SECRET", value: &app.KeycloakAdminClientSecret},
+		{name: "AZURE_AD_CLIENT_SECRET", value: &app.AzureADClientSecret},
+		{name: "SENTRY_DSN", value: &app.SentryDSN},
+	}
+}
+
+// parseSecretRef splits a setting into the scheme of a secret provider and the reference, ok is false if the setting is a plain value.
+func parseSecretRef(value string) (scheme string, ref string, ok bool) {
+	scheme, ref, ok = strings.Cut(value, ":")
+	if !ok || (scheme != secretRefVault && scheme != secretRefFile) {
+		return "", "", false
+	}
+
+	return scheme, ref, true
+}
+
+// configureSecrets replaces references to secret providers (vault:<path>#<key>, file:<path>) in secret settings with the secrets. Secrets with a ttl are kept in app.secretLeases, so they're refreshed in the background.
+func (app *application) configureSecrets() error {
+	app.rotatedSecrets = newRotatedSecrets()
+
+	providers := map[string]secretProvider{
+		secretRefFile: fileSecretProvider{},
+	}
+
+	if app.VaultAddr != "" {
+		vault, err := newVaultClient(app.VaultAddr, app.VaultToken, app.VaultNamespace, app.VaultKubernetesRole, app.VaultKubernetesMount, app.VaultRefreshInterval)
+		if err != nil {
+			return err
+		}
+		providers[secretRefVault] = vault
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, field := range app.secretFields() {
+		scheme, ref, ok := parseSecretRef(*field.value)
+		if !ok {
+			continue
+		}
+
+		provider, ok := providers[scheme]
+		if !ok {
+			return fmt.Errorf("%s refers to Vault, but VAULT_ADDR is not set", field.name)
+		}
+
+		value, ttl, err := provider.fetchSecret(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s from %s: %w", field.name, scheme, err)
+		}
+		*field.value = value
+
+		if ttl > 0 {
+			app.secretLeases = append(app.secretLeases, &leasedSecret{
+				field:     field,
+				ref:       ref,
+				provider:  provider,
+				value:     value,
+				refreshAt: secretRefreshTime(time.Now(), ttl),
+			})
+		}
+
+		app.logger.Info().Caller().
+			Msgf("Fetched %s from %s (ttl: %s)", field.name, scheme, ttl)
+	}
+
+	return nil
+}
+
+// secretRefreshTime returns when a secret fetched at t should be fetched again: once two thirds of its ttl are over, so there's time to retry.
+func secretRefreshTime(t time.Time, ttl time.Duration) time.Time {
+	return t.Add(ttl * 2 / 3)
+}
+
+// runSecretRefresher fetches leased secrets again before they expire. Rotated values of rotatable settings are applied right away, others require a restart.
+func (app *application) runSecretRefresher(ctx context.Context) {
+	for {
+		next := app.secretLeases[0].refreshAt
+		for _, lease := range app.secretLeases[1:] {
+			if lease.refreshAt.Before(next) {
+				next = lease.refreshAt
+			}
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, lease := range app.secretLeases {
+			if time.Now().Before(lease.refreshAt) {
+				continue
+			}
+
+			app.refreshSecret(ctx, lease)
+		}
+	}
+}
+
+// refreshSecret fetches the leased secret again and applies the value if it has changed.
+func (app *application) refreshSecret(ctx context.Context, lease *leasedSecret) {
+	fetchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	value, ttl, err := lease.provider.fetchSecret(fetchCtx, lease.ref)
+	if err != nil {
+		secretRefreshErrorsTotal.Inc()
+		lease.refreshAt = time.Now().Add(secretRetryInterval)
+		app.logger.Error().Caller().
+			Err(err).Msgf("Failed to refresh %s, keeping the previous value", lease.field.name)
+		return
+	}
+
+	lease.refreshAt = time.Now().Add(secretRetryInterval)
+	if ttl > 0 {
+		lease.refreshAt = secretRefreshTime(time.Now(), ttl)
+	}
+
+	if value == lease.value {
+		return
+	}
+	lease.value = value
+	secretRotationsTotal.Inc()
+
+	if !lease.field.rotatable {
+		app.logger.Warn().Caller().
+			Msgf("%s has been rotated, restart lfgw to apply it", lease.field.name)
+		return
+	}
+
+	app.rotatedSecrets.set(lease.field.name, value)
+	app.logger.Info().Caller().
+		Msgf("%s has been rotated", lease.field.name)
+}
+
+// currentSecret returns the rotated value of the setting, or the configured value if it hasn't been rotated.
+func (app *application) currentSecret(name, configured string) string {
+	return app.rotatedSecrets.get(name, configured)
+}
+
+// fileSecretProvider reads secrets from files (e.g. mounted Kubernetes secrets), trailing newlines are trimmed.
+type fileSecretProvider struct{}
+
+// fetchSecret reads the file at path.
+func (fileSecretProvider) fetchSecret(_ context.Context, path string) (string, time.Duration, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), 0, nil
+}
+
+// vaultClient reads secrets from HashiCorp Vault. It authenticates with a static token or through the Kubernetes auth method, tokens obtained through the latter are replaced before they expire.
+type vaultClient struct {
+	addr            string
+	namespace       string
+	kubernetesRole  string
+	kubernetesMount string
+	tokenPath       string
+	refreshInterval time.Duration
+	client          *http.Client
+
+	mu             sync.Mutex
+	token          string
+	tokenExpiresAt time.Time
+}
+
+// vaultResponse is a subset of Vault responses shared by secret reads and logins.
+type vaultResponse struct {
+	LeaseDuration int64          `json:"lease_duration"`
+	Data          map[string]any `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// newVaultClient returns a client for the Vault server at addr. Either token or kubernetesRole must be set. Secrets without a lease (e.g. KV) are fetched again every refreshInterval, unless it's 0.
+func newVaultClient(addr, token, namespace, kubernetesRole, kubernetesMount string, refreshInterval time.Duration) (*vaultClient, error) {
+	if token == "" && kubernetesRole == "" {
+		return nil, fmt.Errorf("either VAULT_TOKEN or VAULT_KUBERNETES_ROLE has to be set to use Vault")
+	}
+
+	return &vaultClient{
+		addr:            strings.TrimRight(addr, "/"),
+		namespace:       namespace,
+		kubernetesRole:  kubernetesRole,
+		kubernetesMount: kubernetesMount,
+		tokenPath:       vaultKubernetesTokenPath,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		token:           token,
+	}, nil
+}
+
+// fetchSecret reads the key of the secret referenced as <path>#<key>, e.g. secret/data/lfgw#admin_token. Both KV v1 and v2 (and other engines returning flat data) are supported.
+func (vc *vaultClient) fetchSecret(ctx context.Context, ref string) (string, time.Duration, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", 0, fmt.Errorf("vault references must be in the form vault:<path>#<key>, got vault:%s", ref)
+	}
+
+	token, err := vc.getToken(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+
+	resp, err := vc.do(ctx, http.MethodGet, "/v1/"+strings.TrimLeft(path, "/"), token, nil)
+	if err != nil {
+		return "", 0, err
+	}
+
+	data := resp.Data
+	// KV v2 nests the secret under data.data along with data.metadata
+	if nested, ok := data["data"].(map[string]any); ok && data["metadata"] != nil {
+		data = nested
+	}
+
+	value, ok := data[key].(string)
+	if !ok {
+		return "", 0, fmt.Errorf("key %q is not found in %s", key, path)
+	}
+
+	ttl := time.Duration(resp.LeaseDuration) * time.Second
+	if ttl == 0 {
+		ttl = vc.refreshInterval
+	}
+
+	return value, ttl, nil
+}
+
+// getToken returns the static token or a token obtained through Kubernetes auth, logging in again if the current one is about to expire.
+func (vc *vaultClient) getToken(ctx context.Context) (string, error) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if vc.kubernetesRole == "" || (vc.token != "" && time.Now().Add(vaultLoginMargin).Before(vc.tokenExpiresAt)) {
+		return vc.token, nil
+	}
+
+	jwt, err := os.ReadFile(vc.tokenPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account token for Vault Kubernetes auth: %w", err)
+	}
+
+	resp, err := vc.do(ctx, http.MethodPost, fmt.Sprintf("/v1/auth/%s/login", strings.Trim(vc.kubernetesMount, "/")), "", map[string]string{
+		"role": vc.kubernetesRole,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("vault kubernetes login failed: %w", err)
+	}
+
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault kubernetes login failed: no client token in the response")
+	}
+
+	vc.token = resp.Auth.ClientToken
+	vc.tokenExpiresAt = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second)
+
+	return vc.token, nil
+}
+
+// do sends a request to the Vault API and decodes the response.
+func (vc *vaultClient) do(ctx context.Context, method, path, token string, payload any) (vaultResponse, error) {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return vaultResponse{}, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, vc.addr+path, body)
+	if err != nil {
+		return vaultResponse{}, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if vc.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", vc.namespace)
+	}
+
+	resp, err := vc.client.Do(req)
+	if err != nil {
+		return vaultResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var vr vaultResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&vr); err != nil && resp.StatusCode == http.StatusOK {
+		return vaultResponse{}, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return vaultResponse{}, fmt.Errorf("unexpected status code %d from vault: %s", resp.StatusCode, strings.Join(vr.Errors, "; "))
+	}
+
+	return vr, nil
+}
@@ -0,0 +1,183 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseSecretRef(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		scheme string
+		ref    string
+		ok     bool
+	}{
+		{name: "Plain value", value: "secret", ok: false},
+		{name: "Plain value with a colon", value: "https://key@sentry.example.com/1", ok: false},
+		{name: "Vault", value: "vault:secret/data/lfgw#admin_token", scheme: secretRefVault, ref: "secret/data/lfgw#admin_token", ok: true},
+		{name: "File", value: "file:/etc/lfgw/admin-token", scheme: secretRefFile, ref: "/etc/lfgw/admin-token", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme, ref, ok := parseSecretRef(tt.value)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.scheme, scheme)
+			assert.Equal(t, tt.ref, ref)
+		})
+	}
+}
+
+// newTestVault returns a Vault server with a KV v2 secret (secret/data/lfgw), a leased secret (database/creds/lfgw) and the Kubernetes auth method. The leased secret changes on every read.
+func newTestVault(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var leases atomic.Int64
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/kubernetes/login" {
+			var login map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&login)
+			if login["role"] != "lfgw" || login["jwt"] != "sa-token" {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"k8s-token","lease_duration":3600}}`))
+			return
+		}
+
+		if token := r.Header.Get("X-Vault-Token"); token != "static-token" && token != "k8s-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/lfgw":
+			_, _ = w.Write([]byte(`{"lease_duration":0,"data":{"data":{"admin_token":"kv-admin-token"},"metadata":{"version":3}}}`))
+		case "/v1/database/creds/lfgw":
+			n := leases.Add(1)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"lease_duration": 60,
+				"data":           map[string]string{"password": fmt.Sprintf("password-%d", n)},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+}
+
+func TestVaultClient_fetchSecret(t *testing.T) {
+	srv := newTestVault(t)
+	defer srv.Close()
+
+	t.Run("KV v2 secret with a static token", func(t *testing.T) {
+		vc, err := newVaultClient(srv.URL, "static-token", "", "", "kubernetes", 0)
+		assert.NoError(t, err)
+
+		value, ttl, err := vc.fetchSecret(context.Background(), "secret/data/lfgw#admin_token")
+		assert.NoError(t, err)
+		assert.Equal(t, "kv-admin-token", value)
+		assert.Zero(t, ttl)
+	})
+
+	t.Run("Leased secret through Kubernetes auth", func(t *testing.T) {
+		tokenPath := filepath.Join(t.TempDir(), "token")
+		assert.NoError(t, os.WriteFile(tokenPath, []byte("sa-token\n"), 0o600))
+
+		vc, err := newVaultClient(srv.URL, "", "", "lfgw", "kubernetes", time.Hour)
+		assert.NoError(t, err)
+		vc.tokenPath = tokenPath
+
+		value, ttl, err := vc.fetchSecret(context.Background(), "database/creds/lfgw#password")
+		assert.NoError(t, err)
+		assert.Equal(t, "password-1", value)
+		assert.Equal(t, time.Minute, ttl)
+		assert.Equal(t, "k8s-token", vc.token)
+	})
+
+	t.Run("Secrets without a lease are refreshed every refresh interval", func(t *testing.T) {
+		vc, err := newVaultClient(srv.URL, "static-token", "", "", "kubernetes", time.Hour)
+		assert.NoError(t, err)
+
+		_, ttl, err := vc.fetchSecret(context.Background(), "secret/data/lfgw#admin_token")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Hour, ttl)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		vc, err := newVaultClient(srv.URL, "wrong-token", "", "", "kubernetes", 0)
+		assert.NoError(t, err)
+
+		_, _, err = vc.fetchSecret(context.Background(), "secret/data/lfgw#admin_token")
+		assert.ErrorContains(t, err, "permission denied")
+
+		vc.token = "static-token"
+		_, _, err = vc.fetchSecret(context.Background(), "secret/data/lfgw#missing")
+		assert.ErrorContains(t, err, `key "missing" is not found`)
+
+		_, _, err = vc.fetchSecret(context.Background(), "secret/data/lfgw")
+		assert.ErrorContains(t, err, "vault:<path>#<key>")
+
+		_, err = newVaultClient(srv.URL, "", "", "", "kubernetes", 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestApp_configureSecrets(t *testing.T) {
+	srv := newTestVault(t)
+	defer srv.Close()
+
+	canaryTokenPath := filepath.Join(t.TempDir(), "canary-token")
+	assert.NoError(t, os.WriteFile(canaryTokenPath, []byte("file-canary-token\n"), 0o600))
+
+	logger := zerolog.New(nil)
+	app := &application{
+		logger:                    &logger,
+		VaultAddr:                 srv.URL,
+		VaultToken:                "static-token",
+		VaultKubernetesMount:      "kubernetes",
+		AdminToken:                "vault:secret/data/lfgw#admin_token",
+		CanaryToken:               "file:" + canaryTokenPath,
+		TokenExchangeClientSecret: "vault:database/creds/lfgw#password",
+		KeycloakAdminClientSecret: "plain-secret",
+	}
+
+	assert.NoError(t, app.configureSecrets())
+	assert.Equal(t, "kv-admin-token", app.AdminToken)
+	assert.Equal(t, "file-canary-token", app.CanaryToken)
+	assert.Equal(t, "password-1", app.TokenExchangeClientSecret)
+	assert.Equal(t, "plain-secret", app.KeycloakAdminClientSecret)
+
+	if assert.Len(t, app.secretLeases, 1) {
+		lease := app.secretLeases[0]
+		assert.Equal(t, "TOKEN_EXCHANGE_CLIENT_SECRET", lease.field.name)
+
+		app.refreshSecret(context.Background(), lease)
+		assert.Equal(t, "password-2", lease.value)
+		assert.Equal(t, "password-2", app.currentSecret("TOKEN_EXCHANGE_CLIENT_SECRET", app.TokenExchangeClientSecret))
+		assert.True(t, lease.refreshAt.After(time.Now()))
+	}
+
+	t.Run("Vault is not configured", func(t *testing.T) {
+		app := &application{
+			logger:     &logger,
+			AdminToken: "vault:secret/data/lfgw#admin_token",
+		}
+		assert.ErrorContains(t, app.configureSecrets(), "VAULT_ADDR is not set")
+	})
+}
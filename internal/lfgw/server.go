@@ -23,6 +23,15 @@ func (app *application) serve() error {
 	// TODO: somehow pass more context to ErrorLog (unsafe?)
 	app.proxy.ErrorLog = app.errorLog
 	app.proxy.FlushInterval = time.Millisecond * 200
+	app.proxy.Transport = newUpstreamMetricsTransport(app.proxy.Transport)
+	// Signing goes before redirects are handled, so followed redirects are signed as well
+	if app.sigV4 != nil {
+		app.proxy.Transport = newSigV4Transport(app.sigV4, app.proxy.Transport)
+	}
+	app.configureUpstreamRedirects(app.proxy)
+	app.proxy.Transport = newStageTransport(app, app.proxy.Transport)
+	app.proxy.ModifyResponse = app.modifyResponse
+	app.proxy.ErrorHandler = app.proxyErrorHandler
 
 	// TODO: somehow pass more context to ErrorLog
 	//#nosec G112 -- false positive, may be removed after gosec v2.12.0+ is released
@@ -35,6 +44,66 @@ func (app *application) serve() error {
 		WriteTimeout: app.WriteTimeout,
 	}
 
+	app.server = srv
+	app.tasks = newBackgroundTasks(app.logger)
+
+	if app.CanaryInterval > 0 {
+		app.tasks.Go("canary", untilCancelled(func(ctx context.Context) {
+			app.runCanaryScheduler(ctx, srv.Handler)
+		}))
+	}
+
+	if app.ProfileWatchdogDir != "" {
+		if err := os.MkdirAll(app.ProfileWatchdogDir, 0o750); err != nil {
+			return err
+		}
+
+		app.tasks.Go("profile-watchdog", untilCancelled(app.runProfileWatchdog))
+	}
+
+	if app.ExecutionTraceDir != "" {
+		if err := os.MkdirAll(app.ExecutionTraceDir, 0o750); err != nil {
+			return err
+		}
+	}
+
+	if app.ACLConsistencyCheckInterval > 0 {
+		app.tasks.Go("acl-consistency-checker", untilCancelled(app.runACLConsistencyChecker))
+	}
+
+	if app.KeycloakRoleSyncInterval > 0 {
+		app.tasks.Go("keycloak-role-syncer", untilCancelled(app.runKeycloakRoleSyncer))
+	}
+
+	switch {
+	case app.ACLURL != "":
+		app.tasks.Go("remote-acl-refresher", untilCancelled(app.runRemoteACLRefresher))
+	case app.ACLConfigMap != "":
+		app.tasks.Go("configmap-acl-watcher", untilCancelled(app.runConfigMapACLWatcher))
+	case app.ACLSource == aclSourceKubernetes:
+		app.tasks.Go("kubernetes-acl-watcher", untilCancelled(app.runKubernetesACLWatcher))
+	case app.ACLPath != "":
+		app.tasks.Go("sighup-acl-reloader", untilCancelled(app.reloadACLsOnSIGHUP))
+	}
+
+	if len(app.secretLeases) > 0 {
+		app.tasks.Go("secret-refresher", untilCancelled(app.runSecretRefresher))
+	}
+
+	if app.errorReporter != nil {
+		app.tasks.Go("error-reporter", untilCancelled(app.errorReporter.run))
+	}
+
+	if app.logFile != nil {
+		app.tasks.Go("log-file-reopener", untilCancelled(app.reopenLogFileOnSIGUSR1))
+	}
+
+	if app.ACLAutoReload {
+		if err := app.watchACLFile(app.tasks.ctx); err != nil {
+			return err
+		}
+	}
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -49,11 +118,13 @@ func (app *application) serve() error {
 		defer cancel()
 
 		err := srv.Shutdown(ctx)
-		if err != nil {
-			shutdownError <- err
+
+		// Background tasks are stopped once requests are served, so they may still be used (e.g. to reload ACLs) until then
+		if tasksErr := app.tasks.Shutdown(ctx); err == nil {
+			err = tasksErr
 		}
 
-		shutdownError <- nil
+		shutdownError <- err
 	}()
 
 	app.logger.Info().Caller().
@@ -0,0 +1,21 @@
+package lfgw
+
+import (
+	"fmt"
+
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// withSharedNamespaces returns the ACL extended with app.SharedNamespaces. Full access ACLs are returned as is.
+func (app *application) withSharedNamespaces(acl querymodifier.ACL) (querymodifier.ACL, error) {
+	if len(app.SharedNamespaces) == 0 {
+		return acl, nil
+	}
+
+	shared, err := acl.WithSharedValues(app.SharedNamespaces)
+	if err != nil {
+		return querymodifier.ACL{}, fmt.Errorf("failed to add shared namespaces: %w", err)
+	}
+
+	return shared, nil
+}
@@ -0,0 +1,56 @@
+package lfgw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_withSharedNamespaces(t *testing.T) {
+	tests := []struct {
+		name   string
+		shared []string
+		rawACL string
+		want   string
+	}{
+		{
+			name:   "no shared namespaces",
+			rawACL: "minio",
+			want:   "minio",
+		},
+		{
+			name:   "shared namespaces are appended",
+			shared: []string{"kube-public", "monitoring-shared"},
+			rawACL: "minio",
+			want:   "minio, kube-public, monitoring-shared",
+		},
+		{
+			name:   "full access is unaffected",
+			shared: []string{"kube-public"},
+			rawACL: ".*",
+			want:   ".*",
+		},
+		{
+			name:   "denied values win",
+			shared: []string{"kube-public"},
+			rawACL: "min.*, !kube-public",
+			want:   "min.*, kube-public",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			app := application{SharedNamespaces: tt.shared}
+
+			acl, err := querymodifier.NewACL(tt.rawACL)
+			assert.Nil(t, err)
+
+			got, err := app.withSharedNamespaces(acl)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got.RawACL)
+			assert.Equal(t, acl.RawDenyACL, got.RawDenyACL)
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package lfgw
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+
+	// sigV4CredentialsRefreshMargin is the time before expiration temporary credentials are refreshed at
+	sigV4CredentialsRefreshMargin = 5 * time.Minute
+)
+
+// awsCredentials are used to sign requests, SessionToken and Expires are set for temporary credentials only.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time
+}
+
+// sigV4Signer signs requests with AWS Signature Version 4. Credentials are taken from the environment in the same way as by AWS SDKs: IRSA (AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE, exchanged through STS) has priority over static credentials (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN).
+type sigV4Signer struct {
+	region  string
+	service string
+	// stsEndpoint is the STS endpoint web identity tokens are exchanged at
+	stsEndpoint string
+	client      *http.Client
+	now         func() time.Time
+
+	mu          sync.Mutex
+	credentials awsCredentials
+}
+
+// newSigV4Signer returns a signer for the region and the service (e.g. aps for Amazon Managed Service for Prometheus).
+func newSigV4Signer(region, service string) *sigV4Signer {
+	return &sigV4Signer{
+		region:      region,
+		service:     service,
+		stsEndpoint: fmt.Sprintf("https://sts.%s.amazonaws.com", region),
+		client:      &http.Client{Timeout: 10 * time.Second},
+		now:         time.Now,
+	}
+}
+
+// configureUpstreamSigV4 sets up signing of upstream requests if app.UpstreamSigV4Region is set. Credentials are obtained once on start, so misconfigurations are caught early.
+func (app *application) configureUpstreamSigV4() error {
+	if app.UpstreamSigV4Region == "" {
+		return nil
+	}
+
+	signer := newSigV4Signer(app.UpstreamSigV4Region, app.UpstreamSigV4Service)
+	credentials, err := signer.getCredentials(context.Background())
+	if err != nil {
+		return err
+	}
+
+	app.sigV4 = signer
+
+	app.logger.Info().Caller().
+		Msgf("Upstream requests are signed with SigV4 (region: %s, service: %s, access key ID: %s)", app.UpstreamSigV4Region, app.UpstreamSigV4Service, credentials.AccessKeyID)
+
+	return nil
+}
+
+// getCredentials returns cached credentials or obtains new ones if they're missing or about to expire.
+func (s *sigV4Signer) getCredentials(ctx context.Context) (awsCredentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.credentials.AccessKeyID != "" && (s.credentials.Expires.IsZero() || s.now().Before(s.credentials.Expires.Add(-sigV4CredentialsRefreshMargin))) {
+		return s.credentials, nil
+	}
+
+	credentials, err := s.loadCredentials(ctx)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	s.credentials = credentials
+
+	return credentials, nil
+}
+
+// loadCredentials obtains credentials from the environment.
+func (s *sigV4Signer) loadCredentials(ctx context.Context) (awsCredentials, error) {
+	roleARN := os.Getenv("AWS_ROLE_ARN")
+	tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	if roleARN != "" && tokenFile != "" {
+		return s.assumeRoleWithWebIdentity(ctx, roleARN, tokenFile)
+	}
+
+	credentials := awsCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if credentials.AccessKeyID == "" || credentials.SecretAccessKey == "" {
+		return awsCredentials{}, errNoAWSCredentials
+	}
+
+	return credentials, nil
+}
+
+// assumeRoleWithWebIdentityResponse is a response of STS AssumeRoleWithWebIdentity.
+type assumeRoleWithWebIdentityResponse struct {
+	Credentials struct {
+		AccessKeyID     string    `xml:"AccessKeyId"`
+		SecretAccessKey string    `xml:"SecretAccessKey"`
+		SessionToken    string    `xml:"SessionToken"`
+		Expiration      time.Time `xml:"Expiration"`
+	} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+}
+
+// assumeRoleWithWebIdentity exchanges the web identity token (e.g. a projected service account token of IRSA) for temporary credentials of the role.
+func (s *sigV4Signer) assumeRoleWithWebIdentity(ctx context.Context, roleARN, tokenFile string) (awsCredentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to read web identity token: %w", err)
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {fmt.Sprintf("lfgw-%d", s.now().Unix())},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.stsEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to assume role with web identity: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to assume role with web identity: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("failed to assume role with web identity: unexpected status code %d: %s", resp.StatusCode, body)
+	}
+
+	var result assumeRoleWithWebIdentityResponse
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to parse STS response: %w", err)
+	}
+
+	if result.Credentials.AccessKeyID == "" {
+		return awsCredentials{}, fmt.Errorf("failed to parse STS response: no credentials")
+	}
+
+	return awsCredentials{
+		AccessKeyID:     result.Credentials.AccessKeyID,
+		SecretAccessKey: result.Credentials.SecretAccessKey,
+		SessionToken:    result.Credentials.SessionToken,
+		Expires:         result.Credentials.Expiration,
+	}, nil
+}
+
+// sign adds SigV4 headers (Authorization, X-Amz-Date and X-Amz-Security-Token for temporary credentials) to the request. Host and X-Amz-* headers are signed. The body is read into memory to be hashed and restored afterwards.
+func (s *sigV4Signer) sign(req *http.Request, credentials awsCredentials, t time.Time) error {
+	payload := []byte{}
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		payload, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(payload))
+		req.ContentLength = int64(len(payload))
+	}
+
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	} else {
+		req.Header.Del("X-Amz-Security-Token")
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4Escape(path, false),
+		sigV4CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	date := t.Format(sigV4DateFormat)
+	scope := strings.Join([]string{date, s.region, s.service, "aws4_request"}, "/")
+
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		t.Format(sigV4TimeFormat),
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, credentials.AccessKeyID, scope, signedHeaders, signature))
+
+	return nil
+}
+
+// hmacSHA256 returns HMAC-SHA256 of the data.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sigV4CanonicalQuery returns query parameters sorted by name and value, both escaped as required by SigV4.
+func sigV4CanonicalQuery(query url.Values) string {
+	pairs := []string{}
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, sigV4Escape(name, true)+"="+sigV4Escape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape percent-encodes everything but unreserved characters (RFC 3986), slashes are kept unless escapeSlash is set. Escaped paths are encoded once again this way, as required by all services but S3.
+func sigV4Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// sigV4Transport signs requests to the upstream with SigV4.
+type sigV4Transport struct {
+	signer *sigV4Signer
+	base   http.RoundTripper
+}
+
+// newSigV4Transport returns a sigV4Transport wrapping base, which defaults to http.DefaultTransport.
+func newSigV4Transport(signer *sigV4Signer, base http.RoundTripper) *sigV4Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &sigV4Transport{
+		signer: signer,
+		base:   base,
+	}
+}
+
+// RoundTrip implements http.RoundTripper. The request is cloned, as a RoundTripper must not modify the original one.
+func (t *sigV4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	credentials, err := t.signer.getCredentials(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	if err := t.signer.sign(req, credentials, t.signer.now()); err != nil {
+		return nil, err
+	}
+
+	return t.base.RoundTrip(req)
+}
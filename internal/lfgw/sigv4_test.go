@@ -0,0 +1,118 @@
+package lfgw
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigV4Signer_sign(t *testing.T) {
+	// The request, the credentials and the signature are taken from the AWS SigV4 test suite (get-vanilla)
+	credentials := awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	signTime := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	t.Run("AWS test suite", func(t *testing.T) {
+		s := newSigV4Signer("us-east-1", "service")
+		req := httptest.NewRequest(http.MethodGet, "http://example.amazonaws.com/", nil)
+
+		assert.Nil(t, s.sign(req, credentials, signTime))
+		assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+	})
+
+	t.Run("Session token and body", func(t *testing.T) {
+		s := newSigV4Signer("eu-west-1", "aps")
+		req := httptest.NewRequest(http.MethodPost, "http://aps-workspaces.eu-west-1.amazonaws.com/workspaces/ws-1/api/v1/query", strings.NewReader("query=up"))
+
+		temporary := credentials
+		temporary.SessionToken = "token"
+		assert.Nil(t, s.sign(req, temporary, signTime))
+		assert.Equal(t, "token", req.Header.Get("X-Amz-Security-Token"))
+		assert.Contains(t, req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,")
+
+		body, err := io.ReadAll(req.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "query=up", string(body), "body must be restored after hashing")
+	})
+}
+
+func TestSigV4Escape(t *testing.T) {
+	assert.Equal(t, "/api/v1/query", sigV4Escape("/api/v1/query", false))
+	assert.Equal(t, "%2Fapi", sigV4Escape("/api", true))
+	assert.Equal(t, "up%7Bnamespace%3D%22default%22%7D", sigV4Escape(`up{namespace="default"}`, true))
+	assert.Equal(t, "a%20b~", sigV4Escape("a b~", true))
+}
+
+func TestSigV4Signer_getCredentials(t *testing.T) {
+	t.Run("Static credentials", func(t *testing.T) {
+		t.Setenv("AWS_ROLE_ARN", "")
+		t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		t.Setenv("AWS_SESSION_TOKEN", "")
+
+		s := newSigV4Signer("eu-west-1", "aps")
+		got, err := s.getCredentials(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, awsCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, got)
+	})
+
+	t.Run("No credentials", func(t *testing.T) {
+		t.Setenv("AWS_ROLE_ARN", "")
+		t.Setenv("AWS_ACCESS_KEY_ID", "")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+		s := newSigV4Signer("eu-west-1", "aps")
+		_, err := s.getCredentials(context.Background())
+		assert.ErrorIs(t, err, errNoAWSCredentials)
+	})
+
+	t.Run("Web identity", func(t *testing.T) {
+		calls := 0
+		sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			assert.Nil(t, r.ParseForm())
+			assert.Equal(t, "AssumeRoleWithWebIdentity", r.PostForm.Get("Action"))
+			assert.Equal(t, "arn:aws:iam::123456789012:role/lfgw", r.PostForm.Get("RoleArn"))
+			assert.Equal(t, "jwt", r.PostForm.Get("WebIdentityToken"))
+
+			io.WriteString(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIA</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken><Expiration>2030-01-01T01:00:00Z</Expiration>
+</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`)
+		}))
+		defer sts.Close()
+
+		tokenFile := t.TempDir() + "/token"
+		assert.Nil(t, os.WriteFile(tokenFile, []byte("jwt\n"), 0o600))
+		t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/lfgw")
+		t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+
+		now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		s := newSigV4Signer("eu-west-1", "aps")
+		s.stsEndpoint = sts.URL
+		s.now = func() time.Time { return now }
+
+		got, err := s.getCredentials(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, "ASIA", got.AccessKeyID)
+		assert.Equal(t, "token", got.SessionToken)
+
+		_, err = s.getCredentials(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, calls, "credentials must be cached")
+
+		now = now.Add(56 * time.Minute)
+		_, err = s.getCredentials(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 2, calls, "credentials must be refreshed before expiration")
+	})
+}
@@ -0,0 +1,243 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+)
+
+// sloBucketDuration is the resolution of SLO windows
+const sloBucketDuration = time.Minute
+
+// sloWindows are the windows burn rates are calculated for (as in multiwindow, multi-burn-rate alerts)
+var sloWindows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+
+var (
+	sloRequests     = metrics.NewCounter("slo_requests_total")
+	sloErrors       = metrics.NewCounter("slo_errors_total")
+	sloSlowRequests = metrics.NewCounter("slo_slow_requests_total")
+)
+
+// sloBucket holds request counts for a minute
+type sloBucket struct {
+	minute   int64
+	requests uint64
+	errors   uint64
+	slow     uint64
+}
+
+// sloTracker keeps request counts for SLO windows
+type sloTracker struct {
+	mu sync.Mutex
+	// buckets is a ring of per-minute buckets covering the longest of sloWindows
+	buckets [360]sloBucket
+}
+
+// record accounts a request in the bucket of the current minute. Buckets left from previous cycles of the ring are reset.
+func (st *sloTracker) record(now time.Time, isError, isSlow bool) {
+	minute := now.Unix() / int64(sloBucketDuration.Seconds())
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	b := &st.buckets[minute%int64(len(st.buckets))]
+	if b.minute != minute {
+		*b = sloBucket{minute: minute}
+	}
+
+	b.requests++
+	if isError {
+		b.errors++
+	}
+	if isSlow {
+		b.slow++
+	}
+}
+
+// windowCounts returns request counts for the window ending now.
+func (st *sloTracker) windowCounts(now time.Time, window time.Duration) sloBucket {
+	minute := now.Unix() / int64(sloBucketDuration.Seconds())
+	first := minute - int64(window/sloBucketDuration) + 1
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var total sloBucket
+	for _, b := range st.buckets {
+		if b.minute >= first && b.minute <= minute {
+			total.requests += b.requests
+			total.errors += b.errors
+			total.slow += b.slow
+		}
+	}
+
+	return total
+}
+
+// burnRate returns how fast the error budget is consumed: 1 means the budget is exhausted exactly by the end of the SLO period, 0 is returned for windows without requests.
+func burnRate(bad, total uint64, target float64) float64 {
+	if total == 0 || target >= 1 {
+		return 0
+	}
+
+	return float64(bad) / float64(total) / (1 - target)
+}
+
+// isSLOEnabled returns true if any of the SLO targets is set.
+func (app *application) isSLOEnabled() bool {
+	return app.SLOAvailabilityTarget > 0 || app.SLOLatencyTarget > 0
+}
+
+// configureSLO sets up SLO tracking and registers burn rate and target gauges for the configured SLO targets.
+func (app *application) configureSLO() {
+	app.slo = nil
+	if !app.isSLOEnabled() {
+		return
+	}
+
+	app.slo = &sloTracker{}
+	tracker := app.slo
+
+	for _, window := range sloWindows {
+		window := window
+		w := formatSLOWindow(window)
+
+		if app.SLOAvailabilityTarget > 0 {
+			target := app.SLOAvailabilityTarget
+			metrics.GetOrCreateGauge(fmt.Sprintf(`slo_burn_rate{slo="availability",window=%q}`, w), func() float64 {
+				counts := tracker.windowCounts(time.Now(), window)
+				return burnRate(counts.errors, counts.requests, target)
+			})
+		}
+
+		if app.SLOLatencyTarget > 0 {
+			target := app.SLOLatencyTarget
+			metrics.GetOrCreateGauge(fmt.Sprintf(`slo_burn_rate{slo="latency",window=%q}`, w), func() float64 {
+				counts := tracker.windowCounts(time.Now(), window)
+				return burnRate(counts.slow, counts.requests, target)
+			})
+		}
+	}
+
+	if app.SLOAvailabilityTarget > 0 {
+		target := app.SLOAvailabilityTarget
+		metrics.GetOrCreateGauge(`slo_target{slo="availability"}`, func() float64 {
+			return target
+		})
+	}
+
+	if app.SLOLatencyTarget > 0 {
+		target := app.SLOLatencyTarget
+		metrics.GetOrCreateGauge(`slo_target{slo="latency"}`, func() float64 {
+			return target
+		})
+
+		threshold := app.SLOLatencyThreshold.Seconds()
+		metrics.GetOrCreateGauge("slo_latency_threshold_seconds", func() float64 {
+			return threshold
+		})
+	}
+}
+
+// sloMiddleware accounts proxied requests for SLO tracking: responses with 5xx status codes are errors, responses slower than app.SLOLatencyThreshold are slow. Requests rejected due to client errors (e.g. missing tokens) are counted as good ones, since lfgw behaved as expected.
+func (app *application) sloMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.slo == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
+			isError := status >= http.StatusInternalServerError
+			isSlow := app.SLOLatencyThreshold > 0 && duration > app.SLOLatencyThreshold
+
+			sloRequests.Inc()
+			if isError {
+				sloErrors.Inc()
+			}
+			if isSlow {
+				sloSlowRequests.Inc()
+			}
+
+			app.slo.record(time.Now(), isError, isSlow)
+		})(next).ServeHTTP(w, r)
+	})
+}
+
+// sloWindowReport is a part of the /slo response describing an SLO over a window
+type sloWindowReport struct {
+	Requests uint64  `json:"requests"`
+	Bad      uint64  `json:"bad"`
+	Ratio    float64 `json:"ratio"`
+	BurnRate float64 `json:"burn_rate"`
+}
+
+// sloReport is a part of the /slo response describing an SLO
+type sloReport struct {
+	Target    float64                    `json:"target"`
+	Threshold string                     `json:"threshold,omitempty"`
+	Windows   map[string]sloWindowReport `json:"windows"`
+}
+
+// sloHandler reports SLO compliance and burn rates over sloWindows as JSON. Ratio is the share of good requests (1 for windows without requests).
+func (app *application) sloHandler(w http.ResponseWriter, r *http.Request) {
+	if app.slo == nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	report := make(map[string]sloReport)
+
+	newReport := func(target float64, bad func(sloBucket) uint64) sloReport {
+		sr := sloReport{
+			Target:  target,
+			Windows: make(map[string]sloWindowReport),
+		}
+
+		for _, window := range sloWindows {
+			counts := app.slo.windowCounts(now, window)
+			wr := sloWindowReport{
+				Requests: counts.requests,
+				Bad:      bad(counts),
+				Ratio:    1,
+				BurnRate: burnRate(bad(counts), counts.requests, target),
+			}
+			if counts.requests > 0 {
+				wr.Ratio = 1 - float64(wr.Bad)/float64(counts.requests)
+			}
+			sr.Windows[formatSLOWindow(window)] = wr
+		}
+
+		return sr
+	}
+
+	if app.SLOAvailabilityTarget > 0 {
+		report["availability"] = newReport(app.SLOAvailabilityTarget, func(b sloBucket) uint64 { return b.errors })
+	}
+
+	if app.SLOLatencyTarget > 0 {
+		sr := newReport(app.SLOLatencyTarget, func(b sloBucket) uint64 { return b.slow })
+		sr.Threshold = app.SLOLatencyThreshold.String()
+		report["latency"] = sr
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// formatSLOWindow returns a window in the Prometheus duration format (e.g. 5m, 1h).
+func formatSLOWindow(window time.Duration) string {
+	if window%time.Hour == 0 {
+		return fmt.Sprintf("%dh", window/time.Hour)
+	}
+
+	return fmt.Sprintf("%dm", window/time.Minute)
+}
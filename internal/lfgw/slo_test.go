@@ -0,0 +1,78 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_sloMiddleware(t *testing.T) {
+	app := application{
+		SLOAvailabilityTarget: 0.9,
+		SLOLatencyTarget:      0.5,
+		SLOLatencyThreshold:   50 * time.Millisecond,
+	}
+	app.configureSLO()
+
+	statuses := []int{http.StatusOK, http.StatusOK, http.StatusUnauthorized, http.StatusBadGateway}
+	for _, status := range statuses {
+		status := status
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if status == http.StatusBadGateway {
+				time.Sleep(60 * time.Millisecond)
+			}
+			w.WriteHeader(status)
+		})
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/query", nil)
+		app.sloMiddleware(next).ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/slo", nil)
+	app.sloHandler(rr, r)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var got map[string]sloReport
+	assert.Nil(t, json.NewDecoder(rr.Body).Decode(&got))
+
+	availability := got["availability"].Windows["5m"]
+	assert.Equal(t, uint64(4), availability.Requests)
+	assert.Equal(t, uint64(1), availability.Bad)
+	assert.InDelta(t, 0.75, availability.Ratio, 1e-9)
+	assert.InDelta(t, 2.5, availability.BurnRate, 1e-9)
+
+	latency := got["latency"]
+	assert.Equal(t, "50ms", latency.Threshold)
+	assert.Equal(t, uint64(1), latency.Windows["6h"].Bad)
+	assert.InDelta(t, 0.5, latency.Windows["6h"].BurnRate, 1e-9)
+}
+
+func TestApp_sloHandler_Disabled(t *testing.T) {
+	app := application{}
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/slo", nil)
+	app.sloHandler(rr, r)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestSLOTracker_windowCounts(t *testing.T) {
+	st := &sloTracker{}
+
+	now := time.Unix(1700000000, 0)
+	// Same slot of the ring as now, but a previous cycle, so it's reset
+	st.record(now.Add(-time.Duration(len(st.buckets))*time.Minute), true, true)
+	st.record(now.Add(-10*time.Minute), true, false)
+	st.record(now.Add(-2*time.Minute), false, true)
+	st.record(now, false, false)
+
+	assert.Equal(t, uint64(2), st.windowCounts(now, 5*time.Minute).requests)
+	assert.Equal(t, uint64(3), st.windowCounts(now, 30*time.Minute).requests)
+	assert.Equal(t, uint64(1), st.windowCounts(now, 30*time.Minute).errors)
+	assert.Equal(t, uint64(1), st.windowCounts(now, 6*time.Hour).slow)
+}
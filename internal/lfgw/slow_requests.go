@@ -0,0 +1,57 @@
+package lfgw
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// slowRequestMiddleware logs API requests served slower than app.SlowRequestThreshold at warn level along with the user, roles and the (rewritten) query, so dashboards hurting the upstream can be found. The user (email or API key) is taken from the log context.
+func (app *application) slowRequestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.SlowRequestThreshold <= 0 || app.isNotAPIRequest(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		// Once r.ParseForm() is called, we need to update ContentLength, otherwise the request will fail
+		if app.hasFormBody(r.Method) {
+			newBody := strings.NewReader(r.PostForm.Encode())
+			r.ContentLength = newBody.Size()
+			r.Body = io.NopCloser(newBody)
+		}
+
+		query := strings.Join(append(r.Form["query"], r.Form["match[]"]...), ", ")
+		params := app.unescapedURLQuery(r.Form.Encode())
+
+		// Workaround to make further r.ParseForm() calls update r.Form and r.PostForm again
+		r.Form = nil
+		r.PostForm = nil
+
+		roles, _ := r.Context().Value(contextKeyRoles).([]string)
+
+		hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
+			if duration < app.SlowRequestThreshold {
+				return
+			}
+
+			hlog.FromRequest(r).Warn().Caller().
+				Strs("roles", roles).
+				Str("path", r.URL.Path).
+				Str("query", query).
+				Str("params", params).
+				Int("status", status).
+				Dur("duration", duration).
+				Msg("Slow request")
+		})(next).ServeHTTP(w, r)
+	})
+}
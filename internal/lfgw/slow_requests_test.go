@@ -0,0 +1,110 @@
+package lfgw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_slowRequestMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		method    string
+		path      string
+		body      string
+		delay     time.Duration
+		wantQuery string
+		wantLog   bool
+	}{
+		{
+			name:      "Slow GET request",
+			threshold: 10 * time.Millisecond,
+			method:    http.MethodGet,
+			path:      `/api/v1/query?query=up{namespace="default"}`,
+			delay:     20 * time.Millisecond,
+			wantQuery: `up{namespace="default"}`,
+			wantLog:   true,
+		},
+		{
+			name:      "Slow POST request",
+			threshold: 10 * time.Millisecond,
+			method:    http.MethodPost,
+			path:      "/api/v1/series",
+			body:      "match%5B%5D=up&match%5B%5D=down",
+			delay:     20 * time.Millisecond,
+			wantQuery: "up, down",
+			wantLog:   true,
+		},
+		{
+			name:      "Fast request",
+			threshold: time.Second,
+			method:    http.MethodGet,
+			path:      "/api/v1/query?query=up",
+		},
+		{
+			name:      "Slow non-API request",
+			threshold: 10 * time.Millisecond,
+			method:    http.MethodGet,
+			path:      "/vmui/",
+			delay:     20 * time.Millisecond,
+		},
+		{
+			name:   "Disabled",
+			method: http.MethodGet,
+			path:   "/api/v1/query?query=up",
+			delay:  20 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := zerolog.New(&buf)
+
+			app := application{
+				SlowRequestThreshold: tt.threshold,
+			}
+
+			var gotBody string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				gotBody = string(body)
+				time.Sleep(tt.delay)
+			})
+
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyRoles, []string{"team-a"}))
+
+			hlog.NewHandler(logger)(app.slowRequestMiddleware(next)).ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, tt.body, gotBody, "the body is passed on")
+
+			if !tt.wantLog {
+				assert.Empty(t, buf.String())
+				return
+			}
+
+			var entry map[string]interface{}
+			assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+			assert.Equal(t, "warn", entry["level"])
+			assert.Equal(t, "Slow request", entry["message"])
+			assert.Equal(t, tt.wantQuery, entry["query"])
+			assert.Equal(t, []interface{}{"team-a"}, entry["roles"])
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package lfgw
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// loggableFields lists application fields whose values may be logged as is. Values of other fields (e.g. tokens, client secrets, Sentry DSN) are redacted, so a new setting is never logged until it's added here.
+var loggableFields = map[string]bool{
+	"UpstreamRedirects":            true,
+	"UpstreamSigV4Region":          true,
+	"UpstreamSigV4Service":         true,
+	"SentryEnvironment":            true,
+	"VaultNamespace":               true,
+	"VaultKubernetesRole":          true,
+	"VaultKubernetesMount":         true,
+	"VaultRefreshInterval":         true,
+	"RoutePrefix":                  true,
+	"OIDCClientID":                 true,
+	"OIDCCacheSize":                true,
+	"OIDCCacheTTL":                 true,
+	"RolesClaims":                  true,
+	"ACLSource":                    true,
+	"ACLPath":                      true,
+	"ACLConfigMap":                 true,
+	"ACLConfigMapKey":              true,
+	"ACLURLRefreshInterval":        true,
+	"ACLAutoReload":                true,
+	"EnforcedLabel":                true,
+	"KubernetesACLAdminNamespace":  true,
+	"KubernetesRBACUsernameClaim":  true,
+	"KubernetesRBACUsernamePrefix": true,
+	"KubernetesRBACGroupsPrefix":   true,
+	"KubernetesRBACCacheTTL":       true,
+	"AssumedRolesEnabled":          true,
+	"AssumedRolesPrefix":           true,
+	"AssumedRolesPattern":          true,
+	"AssumedRolesVerifyNamespaces": true,
+	"AssumedRolesCacheTTL":         true,
+	"DefaultRole":                  true,
+	"DefaultACL":                   true,
+	"SharedNamespaces":             true,
+	"EnableDeduplication":          true,
+	"OptimizeExpressions":          true,
+	"UnlabeledMetrics":             true,
+	"UnlabeledMetricsPolicy":       true,
+	"SafeMode":                     true,
+	"NonAPIPathsPolicy":            true,
+	"APIPathPrefixes":              true,
+	"QueryCatalogPath":             true,
+	"ErrorMessagesPath":            true,
+	"SetProxyHeaders":              true,
+	"RequestIDHeader":              true,
+	"ScrubResponseHeaders":         true,
+	"HSTSMaxAge":                   true,
+	"ContentTypeNosniff":           true,
+	"ResponseCompression":          true,
+	"ContentSecurityPolicy":        true,
+	"UIPathPrefix":                 true,
+	"UIHomePath":                   true,
+	"SetGomaxProcs":                true,
+	"APIKeysPath":                  true,
+	"APIKeysMaxTTL":                true,
+	"ClusterPeers":                 true,
+	"ClusterService":               true,
+	"ProtectMetrics":               true,
+	"EnableLifecycle":              true,
+	"NamespaceMetricsAllowlist":    true,
+	"RoleMetrics":                  true,
+	"ReadAfterWriteWindow":         true,
+	"RequestTag":                   true,
+	"RequestTagMode":               true,
+	"RequestTagParam":              true,
+	"SLOAvailabilityTarget":        true,
+	"SLOLatencyTarget":             true,
+	"SLOLatencyThreshold":          true,
+	"FaultInjection":               true,
+	"SourceIPHeader":               true,
+	"MaxTokenAge":                  true,
+	"AllowedAZPs":                  true,
+	"ClaimsEnrichers":              true,
+	"ClaimsAdapter":                true,
+	"AzureADGraphLookup":           true,
+	"AzureADTenantID":              true,
+	"AzureADClientID":              true,
+	"GoogleHostedDomains":          true,
+	"TokenExchange":                true,
+	"TokenExchangeClientID":        true,
+	"TokenExchangeAudience":        true,
+	"TokenExchangeScope":           true,
+	"ACLConsistencyCheckInterval":  true,
+	"KeycloakAdminClientID":        true,
+	"KeycloakRoleClients":          true,
+	"KeycloakRoleSyncInterval":     true,
+	"KeycloakRoleSyncPattern":      true,
+	"KeycloakRoleSyncACL":          true,
+	"DeepHealthcheck":              true,
+	"CanaryInterval":               true,
+	"CanaryQueries":                true,
+	"CanaryClientID":               true,
+	"ProfileWatchdogDir":           true,
+	"ProfileWatchdogRSSBytes":      true,
+	"ProfileWatchdogGoroutines":    true,
+	"ProfileWatchdogInterval":      true,
+	"ProfileWatchdogCooldown":      true,
+	"ExecutionTraceDir":            true,
+	"ExecutionTraceSampleRate":     true,
+	"ExecutionTraceThreshold":      true,
+	"SlowRequestThreshold":         true,
+	"RequestSnapshots":             true,
+	"MaxParamLength":               true,
+	"MaxParams":                    true,
+	"Debug":                        true,
+	"ValidateUpstreamResponses":    true,
+	"LogFormat":                    true,
+	"LogNoColor":                   true,
+	"LogRequests":                  true,
+	"LogSamplingRate":              true,
+	"LogFile":                      true,
+	"LogFileMaxSizeBytes":          true,
+	"LogFileMaxAge":                true,
+	"LogFileMaxBackups":            true,
+	"SyslogAddress":                true,
+	"SyslogFacility":               true,
+	"SyslogAppName":                true,
+	"Port":                         true,
+	"ReadTimeout":                  true,
+	"WriteTimeout":                 true,
+	"GracefulShutdownTimeout":      true,
+	"DrainGracePeriod":             true,
+	"FeatureFlags":                 true,
+}
+
+// urlFields lists application fields holding URLs, they're logged with passwords redacted.
+var urlFields = map[string]bool{
+	"UpstreamURL":      true,
+	"ExternalURL":      true,
+	"ACLURL":           true,
+	"OIDCRealmURL":     true,
+	"VaultAddr":        true,
+	"TokenExchangeURL": true,
+	"KeycloakAdminURL": true,
+}
+
+// configSnapshot returns exported settings of the application as strings (secrets are masked, passwords in URLs are redacted). ACLs are left out as they're summarized separately.
+func (app *application) configSnapshot() map[string]string {
+	snapshot := make(map[string]string)
+
+	v := reflect.ValueOf(app).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Name == "ACLs" {
+			continue
+		}
+
+		value := fmt.Sprintf("%v", v.Field(i).Interface())
+
+		switch {
+		case urlFields[field.Name]:
+			value = redactURL(v.Field(i).Interface())
+		case !loggableFields[field.Name] && value != "":
+			value = "<redacted>"
+		}
+
+		snapshot[field.Name] = value
+	}
+
+	return snapshot
+}
+
+// redactURL returns the URL (either *url.URL or a string) with the password replaced by "xxxxx". Strings that cannot be parsed are redacted completely.
+func redactURL(value any) string {
+	switch u := value.(type) {
+	case *url.URL:
+		return u.Redacted()
+	case string:
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return "<redacted>"
+		}
+		return parsed.Redacted()
+	default:
+		return "<redacted>"
+	}
+}
+
+// aclsSnapshot returns a normalized string representation of every role, so ACLs can be hashed and compared.
+func (app *application) aclsSnapshot(acls querymodifier.ACLs) map[string]string {
+	snapshot := make(map[string]string, len(acls))
+
+	for role, acl := range acls {
+		snapshot[role] = fmt.Sprintf("%+v", acl)
+	}
+
+	return snapshot
+}
+
+// snapshotHash returns a stable SHA-256 hash of a snapshot.
+func (app *application) snapshotHash(snapshot map[string]string) string {
+	keys := make([]string, 0, len(snapshot))
+	for k := range snapshot {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, snapshot[k])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// diffSnapshots returns sorted lists of keys that were added, removed or changed between two snapshots.
+func (app *application) diffSnapshots(previous, current map[string]string) (added, removed, changed []string) {
+	added, removed, changed = []string{}, []string{}, []string{}
+
+	for k, v := range current {
+		prev, exists := previous[k]
+		switch {
+		case !exists:
+			added = append(added, k)
+		case prev != v:
+			changed = append(changed, k)
+		}
+	}
+
+	for k := range previous {
+		if _, exists := current[k]; !exists {
+			removed = append(removed, k)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+
+	return added, removed, changed
+}
+
+// logConfigSummary logs effective settings along with their hash, so it's easy to track when an instance's configuration changed.
+func (app *application) logConfigSummary() {
+	// Just to make sure our logging calls are always safe
+	if app.logger == nil {
+		app.configureLogging()
+	}
+
+	snapshot := app.configSnapshot()
+
+	keys := make([]string, 0, len(snapshot))
+	for k := range snapshot {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	settings := make([]string, 0, len(keys))
+	for _, k := range keys {
+		settings = append(settings, fmt.Sprintf("%s=%s", k, snapshot[k]))
+	}
+
+	app.logger.Info().Caller().
+		Str("config_hash", app.snapshotHash(snapshot)).
+		Strs("settings", settings).
+		Msg("Effective configuration")
+}
+
+// logACLSummary logs counts and the hash of the current ACLs. If previous ACLs are supplied (e.g. on reload), added, removed and changed roles are logged as well.
+func (app *application) logACLSummary(previous, current querymodifier.ACLs) {
+	// Just to make sure our logging calls are always safe
+	if app.logger == nil {
+		app.configureLogging()
+	}
+
+	snapshot := app.aclsSnapshot(current)
+
+	fullaccessRoles := 0
+	for _, acl := range current {
+		if acl.Fullaccess {
+			fullaccessRoles++
+		}
+	}
+
+	event := app.logger.Info().Caller().
+		Int("roles", len(current)).
+		Int("fullaccess_roles", fullaccessRoles).
+		Str("acl_hash", app.snapshotHash(snapshot))
+
+	if previous != nil {
+		added, removed, changed := app.diffSnapshots(app.aclsSnapshot(previous), snapshot)
+		event = event.
+			Strs("added_roles", added).
+			Strs("removed_roles", removed).
+			Strs("changed_roles", changed)
+	}
+
+	event.Msg("Effective ACL")
+}
@@ -0,0 +1,205 @@
+package lfgw
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// syslogTimeFormat is the timestamp format of RFC5424 messages
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// syslogFacilities maps names of syslog facilities to their codes.
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// syslogSeverity maps zerolog levels to syslog severities, other levels (e.g. entries written without a level) are sent as notice.
+func syslogSeverity(level zerolog.Level) int {
+	switch level {
+	case zerolog.PanicLevel:
+		return 1 // alert
+	case zerolog.FatalLevel:
+		return 2 // crit
+	case zerolog.ErrorLevel:
+		return 3 // err
+	case zerolog.WarnLevel:
+		return 4 // warning
+	case zerolog.InfoLevel:
+		return 6 // info
+	case zerolog.DebugLevel, zerolog.TraceLevel:
+		return 7 // debug
+	default:
+		return 5 // notice
+	}
+}
+
+// syslogWriter sends log entries to a syslog server as RFC5424 messages. Entries are sent over datagrams (udp, unixgram) as is and over streams (tcp, unix) with octet-counting framing (RFC6587). Stream connections are re-established once if a message cannot be sent.
+type syslogWriter struct {
+	network  string
+	address  string
+	facility int
+	appName  string
+	hostname string
+	// format turns a JSON entry written by zerolog into the configured log format (e.g. logfmt), entries are sent as is if it's nil
+	format func(out io.Writer) io.Writer
+
+	mu   sync.Mutex
+	conn net.Conn
+	buf  bytes.Buffer
+}
+
+// newSyslogWriter returns a writer sending entries to the syslog server at rawAddress (e.g. udp://syslog:514, tcp://syslog:601, unixgram:///dev/log) with the facility and the app name.
+func newSyslogWriter(rawAddress, facility, appName string, format func(out io.Writer) io.Writer) (*syslogWriter, error) {
+	u, err := url.Parse(rawAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse syslog address: %w", err)
+	}
+
+	sw := &syslogWriter{
+		network: u.Scheme,
+		format:  format,
+		appName: appName,
+	}
+
+	switch u.Scheme {
+	case "udp", "tcp":
+		sw.address = u.Host
+	case "unix", "unixgram":
+		sw.address = u.Path
+	default:
+		return nil, fmt.Errorf("unsupported syslog network: %q (must be one of: udp, tcp, unix, unixgram)", u.Scheme)
+	}
+
+	code, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility: %q", facility)
+	}
+	sw.facility = code
+
+	sw.hostname, err = os.Hostname()
+	if err != nil || sw.hostname == "" {
+		sw.hostname = "-"
+	}
+
+	if err := sw.connect(); err != nil {
+		return nil, err
+	}
+
+	return sw, nil
+}
+
+// connect (re-)establishes the connection to the syslog server, the caller must hold sw.mu (unless sw is not shared yet).
+func (sw *syslogWriter) connect() error {
+	if sw.conn != nil {
+		sw.conn.Close()
+		sw.conn = nil
+	}
+
+	conn, err := net.DialTimeout(sw.network, sw.address, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	sw.conn = conn
+
+	return nil
+}
+
+// Write implements io.Writer interface. Entries are sent as is with the notice severity (e.g. access logs in the combined format).
+func (sw *syslogWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if err := sw.send(zerolog.NoLevel, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// WriteLevel implements zerolog.LevelWriter interface, so severities of messages match levels of entries.
+func (sw *syslogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	n := len(p)
+
+	if sw.format != nil {
+		sw.buf.Reset()
+		if _, err := sw.format(&sw.buf).Write(p); err != nil {
+			return 0, err
+		}
+		p = sw.buf.Bytes()
+	}
+
+	if err := sw.send(level, p); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// send sends the entry as an RFC5424 message, the caller must hold sw.mu.
+func (sw *syslogWriter) send(level zerolog.Level, p []byte) error {
+	msg := sw.message(level, time.Now(), p)
+
+	// The connection is missing if it couldn't be re-established last time
+	if sw.conn != nil {
+		_, err := sw.conn.Write(msg)
+		if err == nil || sw.network == "udp" || sw.network == "unixgram" {
+			return err
+		}
+	}
+
+	if err := sw.connect(); err != nil {
+		return err
+	}
+
+	_, err := sw.conn.Write(msg)
+	return err
+}
+
+// message formats the entry as an RFC5424 message (without structured data), framed for stream connections.
+func (sw *syslogWriter) message(level zerolog.Level, t time.Time, p []byte) []byte {
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		sw.facility*8+syslogSeverity(level),
+		t.Format(syslogTimeFormat),
+		sw.hostname,
+		sw.appName,
+		os.Getpid(),
+		strings.TrimRight(string(p), "\n"),
+	)
+
+	if sw.network == "tcp" || sw.network == "unix" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	return []byte(msg)
+}
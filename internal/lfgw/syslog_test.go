@@ -0,0 +1,87 @@
+package lfgw
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyslogWriter(t *testing.T) {
+	t.Run("UDP", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		defer conn.Close()
+
+		app := &application{LogFormat: logFormatLogfmt}
+		sw, err := newSyslogWriter("udp://"+conn.LocalAddr().String(), "local0", "lfgw", app.logFormatter(true))
+		assert.Nil(t, err)
+
+		logger := zerolog.New(sw)
+		logger.Warn().Str("email", "user@example.com").Msg("Slow request")
+
+		buf := make([]byte, 1024)
+		assert.Nil(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		assert.Nil(t, err)
+
+		// local0 (16) * 8 + warning (4)
+		want := regexp.MustCompile(`^<132>1 \d{4}-\d{2}-\d{2}T\S+ \S+ lfgw \d+ - - level=warn message="Slow request" email=user@example\.com$`)
+		assert.Regexp(t, want, string(buf[:n]))
+	})
+
+	t.Run("TCP", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		defer ln.Close()
+
+		received := make(chan string, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			// Octet counting: <length> <message>
+			reader := bufio.NewReader(conn)
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(length))
+			msg := make([]byte, n)
+			_, _ = io.ReadFull(reader, msg)
+			received <- string(msg)
+		}()
+
+		sw, err := newSyslogWriter("tcp://"+ln.Addr().String(), "daemon", "lfgw", nil)
+		assert.Nil(t, err)
+
+		logger := zerolog.New(sw)
+		logger.Error().Msg("")
+
+		select {
+		case msg := <-received:
+			// daemon (3) * 8 + err (3)
+			assert.Regexp(t, regexp.MustCompile(`^<27>1 \S+ \S+ lfgw \d+ - - \{"level":"error"\}$`), msg)
+		case <-time.After(time.Second):
+			t.Fatal("no message received")
+		}
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		_, err := newSyslogWriter("http://syslog:514", "daemon", "lfgw", nil)
+		assert.EqualError(t, err, `unsupported syslog network: "http" (must be one of: udp, tcp, unix, unixgram)`)
+
+		_, err = newSyslogWriter("udp://syslog:514", "local9", "lfgw", nil)
+		assert.EqualError(t, err, `unknown syslog facility: "local9"`)
+	})
+}
@@ -0,0 +1,84 @@
+package lfgw
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/hlog"
+)
+
+// tokenAuthTime returns the time the user authenticated at (auth_time), iat is used as a fallback. Zero time is returned if neither is present.
+func (app *application) tokenAuthTime(claims userClaims, issuedAt time.Time) time.Time {
+	if claims.AuthTime > 0 {
+		return time.Unix(claims.AuthTime, 0)
+	}
+
+	if !issuedAt.IsZero() && issuedAt.Unix() > 0 {
+		return issuedAt
+	}
+
+	return time.Time{}
+}
+
+// checkTokenBinding returns an error if the token is older than maxAge (if non-zero) or if it's issued to a party not listed in allowedAZPs (if not empty). Token expiration is checked independently by the verifier.
+func (app *application) checkTokenBinding(maxAge time.Duration, allowedAZPs []string, authTime time.Time, azp string) error {
+	if maxAge > 0 {
+		if authTime.IsZero() {
+			return fmt.Errorf("%w: token has neither auth_time nor iat", errTokenBinding)
+		}
+
+		if age := time.Since(authTime); age > maxAge {
+			return fmt.Errorf("%w: token age %s exceeds %s", errTokenBinding, age.Truncate(time.Second), maxAge)
+		}
+	}
+
+	if len(allowedAZPs) > 0 && !slices.Contains(allowedAZPs, azp) {
+		return fmt.Errorf("%w: authorized party %q is not allowed", errTokenBinding, azp)
+	}
+
+	return nil
+}
+
+// filterRolesByTokenBinding drops known roles whose token binding requirements (max_token_age, allowed_azp) are not satisfied by the token. An error is returned if the user is left without any usable roles because of the requirements.
+func (app *application) filterRolesByTokenBinding(r *http.Request, roles []string, authTime time.Time, azp string) ([]string, error) {
+	allowed := make([]string, 0, len(roles))
+	denied := []string{}
+	knownAllowed := 0
+
+	acls := app.getACLs().ForRoles(roles)
+
+	for _, role := range roles {
+		acl, exists := acls[role]
+		if !exists {
+			allowed = append(allowed, role)
+			continue
+		}
+
+		if err := app.checkTokenBinding(acl.MaxTokenAge, acl.AllowedAZPs, authTime, azp); err != nil {
+			hlog.FromRequest(r).Debug().Caller().
+				Err(err).Msgf("Role %s is skipped", role)
+
+			denied = append(denied, role)
+			metrics.GetOrCreateCounter(fmt.Sprintf(`token_binding_denials_total{role=%q}`, role)).Inc()
+			continue
+		}
+
+		allowed = append(allowed, role)
+		knownAllowed++
+	}
+
+	if len(denied) == 0 {
+		return allowed, nil
+	}
+
+	// Unknown roles might still give access in assumed roles mode
+	if knownAllowed == 0 && (!app.AssumedRolesEnabled || len(allowed) == 0) {
+		return nil, fmt.Errorf("%w for the roles: %s", errTokenBinding, strings.Join(denied, ", "))
+	}
+
+	return allowed, nil
+}
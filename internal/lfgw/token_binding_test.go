@@ -0,0 +1,161 @@
+package lfgw
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_tokenAuthTime(t *testing.T) {
+	app := &application{}
+
+	authTime := time.Unix(1700000000, 0)
+	issuedAt := time.Unix(1700000600, 0)
+
+	assert.Equal(t, authTime, app.tokenAuthTime(userClaims{AuthTime: authTime.Unix()}, issuedAt))
+	assert.Equal(t, issuedAt, app.tokenAuthTime(userClaims{}, issuedAt))
+	assert.True(t, app.tokenAuthTime(userClaims{}, time.Time{}).IsZero())
+	assert.True(t, app.tokenAuthTime(userClaims{}, time.Unix(0, 0)).IsZero())
+}
+
+func TestApp_checkTokenBinding(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		name        string
+		maxAge      time.Duration
+		allowedAZPs []string
+		authTime    time.Time
+		azp         string
+		wantErr     error
+	}{
+		{
+			name: "No requirements",
+		},
+		{
+			name:     "Fresh token",
+			maxAge:   time.Hour,
+			authTime: time.Now().Add(-time.Minute),
+		},
+		{
+			name:     "Old token",
+			maxAge:   time.Hour,
+			authTime: time.Now().Add(-2 * time.Hour),
+			wantErr:  errTokenBinding,
+		},
+		{
+			name:    "No auth time",
+			maxAge:  time.Hour,
+			wantErr: errTokenBinding,
+		},
+		{
+			name:        "Allowed azp",
+			allowedAZPs: []string{"grafana", "lfgw"},
+			azp:         "grafana",
+		},
+		{
+			name:        "Unknown azp",
+			allowedAZPs: []string{"grafana", "lfgw"},
+			azp:         "cli",
+			wantErr:     errTokenBinding,
+		},
+		{
+			name:        "No azp",
+			allowedAZPs: []string{"grafana"},
+			wantErr:     errTokenBinding,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := app.checkTokenBinding(tt.maxAge, tt.allowedAZPs, tt.authTime, tt.azp)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestApp_filterRolesByTokenBinding(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	acls := querymodifier.ACLs{
+		"sensitive": querymodifier.ACL{
+			RawACL:      "sensitive",
+			MaxTokenAge: 15 * time.Minute,
+			AllowedAZPs: []string{"grafana"},
+		},
+		"team": querymodifier.ACL{
+			RawACL: "team",
+		},
+	}
+
+	tests := []struct {
+		name                string
+		assumedRolesEnabled bool
+		authTime            time.Time
+		azp                 string
+		roles               []string
+		want                []string
+		wantErr             error
+	}{
+		{
+			name:     "Requirements are satisfied",
+			authTime: time.Now().Add(-time.Minute),
+			azp:      "grafana",
+			roles:    []string{"sensitive", "team"},
+			want:     []string{"sensitive", "team"},
+		},
+		{
+			name:     "Old token drops the bound role",
+			authTime: time.Now().Add(-time.Hour),
+			azp:      "grafana",
+			roles:    []string{"sensitive", "team"},
+			want:     []string{"team"},
+		},
+		{
+			name:     "Different azp drops the bound role",
+			authTime: time.Now().Add(-time.Minute),
+			azp:      "cli",
+			roles:    []string{"sensitive", "team"},
+			want:     []string{"team"},
+		},
+		{
+			name:     "No usable roles left",
+			authTime: time.Now().Add(-time.Hour),
+			azp:      "grafana",
+			roles:    []string{"sensitive", "unknown"},
+			wantErr:  errTokenBinding,
+		},
+		{
+			name:                "Unknown roles are kept in assumed roles mode",
+			assumedRolesEnabled: true,
+			authTime:            time.Now().Add(-time.Hour),
+			azp:                 "grafana",
+			roles:               []string{"sensitive", "unknown"},
+			want:                []string{"unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{
+				acls:                &aclsState{},
+				logger:              &logger,
+				ACLs:                acls,
+				AssumedRolesEnabled: tt.assumedRolesEnabled,
+			}
+
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := app.filterRolesByTokenBinding(r, tt.roles, tt.authTime, tt.azp)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package lfgw
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	tokenExchangeGrantType       = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenExchangeAccessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+	// tokenExchangeCacheSize is the maximum amount of exchanged tokens kept in memory
+	tokenExchangeCacheSize = 10000
+	// tokenExchangeExpiryMargin makes sure an exchanged token doesn't expire while a request is in flight
+	tokenExchangeExpiryMargin = 10 * time.Second
+)
+
+// tokenExchanger swaps user access tokens for upstream-scoped tokens according to RFC 8693 and caches the results until they expire.
+type tokenExchanger struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	audience     string
+	scope        string
+	secrets      *rotatedSecrets
+	client       *http.Client
+
+	mu    sync.Mutex
+	cache map[string]exchangedToken
+}
+
+// exchangedToken holds a token issued by the token endpoint along with its expiration time.
+type exchangedToken struct {
+	accessToken string
+	expiresAt   time.Time
+}
+
+// tokenExchangeResponse represents a successful response from the token endpoint.
+type tokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+}
+
+// newTokenExchanger returns a tokenExchanger with an empty cache. The client secret is looked up in secrets first, so rotated values are applied without a restart.
+func newTokenExchanger(tokenURL, clientID, clientSecret, audience, scope string, secrets *rotatedSecrets) *tokenExchanger {
+	return &tokenExchanger{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		audience:     audience,
+		scope:        scope,
+		secrets:      secrets,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		cache:        make(map[string]exchangedToken),
+	}
+}
+
+// exchange returns a token issued in exchange for subjectToken. Cached tokens are reused until they are about to expire.
+func (te *tokenExchanger) exchange(ctx context.Context, subjectToken string) (string, error) {
+	sum := sha256.Sum256([]byte(subjectToken))
+	key := hex.EncodeToString(sum[:])
+
+	te.mu.Lock()
+	cached, ok := te.cache[key]
+	te.mu.Unlock()
+
+	if ok && time.Now().Add(tokenExchangeExpiryMargin).Before(cached.expiresAt) {
+		return cached.accessToken, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", tokenExchangeGrantType)
+	form.Set("subject_token", subjectToken)
+	form.Set("subject_token_type", tokenExchangeAccessTokenType)
+	form.Set("requested_token_type", tokenExchangeAccessTokenType)
+	if te.audience != "" {
+		form.Set("audience", te.audience)
+	}
+	if te.scope != "" {
+		form.Set("scope", te.scope)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, te.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(te.clientID), url.QueryEscape(te.secrets.get("TOKEN_EXCHANGE_CLIENT_SECRET", te.clientSecret)))
+
+	resp, err := te.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token exchange failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("token exchange failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token exchange failed: %s: %s", resp.Status, body)
+	}
+
+	var tr tokenExchangeResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return "", fmt.Errorf("token exchange failed: %w", err)
+	}
+
+	if tr.AccessToken == "" {
+		return "", fmt.Errorf("token exchange failed: no access_token in response")
+	}
+
+	// Tokens without expires_in are not cached, because we cannot tell when they become invalid
+	if tr.ExpiresIn > 0 {
+		te.store(key, exchangedToken{
+			accessToken: tr.AccessToken,
+			expiresAt:   time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second),
+		})
+	}
+
+	return tr.AccessToken, nil
+}
+
+// store puts a token into the cache. Expired entries are dropped once the cache is full; if that's not enough, the cache is reset.
+func (te *tokenExchanger) store(key string, token exchangedToken) {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	if len(te.cache) >= tokenExchangeCacheSize {
+		now := time.Now()
+		for k, v := range te.cache {
+			if now.After(v.expiresAt) {
+				delete(te.cache, k)
+			}
+		}
+
+		if len(te.cache) >= tokenExchangeCacheSize {
+			te.cache = make(map[string]exchangedToken)
+		}
+	}
+
+	te.cache[key] = token
+}
+
+// configureTokenExchange sets up a token exchanger if token exchange is enabled. tokenURL is used as a fallback when app.TokenExchangeURL is empty (normally, it's the token endpoint advertised by the OIDC provider).
+func (app *application) configureTokenExchange(tokenURL string) error {
+	// Just to make sure our logging calls are always safe
+	if app.logger == nil {
+		app.configureLogging()
+	}
+
+	if !app.TokenExchange {
+		return nil
+	}
+
+	if app.TokenExchangeURL != "" {
+		tokenURL = app.TokenExchangeURL
+	}
+
+	if tokenURL == "" {
+		return fmt.Errorf("token exchange is enabled, but token endpoint is unknown")
+	}
+
+	clientID := app.TokenExchangeClientID
+	if clientID == "" {
+		clientID = app.OIDCClientID
+	}
+
+	app.logger.Info().Caller().
+		Msgf("Token exchange is on (token endpoint: %q, audience: %q)", tokenURL, app.TokenExchangeAudience)
+
+	app.tokenExchanger = newTokenExchanger(tokenURL, clientID, app.TokenExchangeClientSecret, app.TokenExchangeAudience, app.TokenExchangeScope, app.rotatedSecrets)
+
+	return nil
+}
+
+// tokenExchangeMiddleware replaces the user's access token with a token obtained through token exchange, so the upstream receives a token scoped for itself. Requests made with API keys are passed as is, as they carry no access token to exchange.
+func (app *application) tokenExchangeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.tokenExchanger == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if id, ok := r.Context().Value(contextKeyIdentity).(identity); ok && id.APIKey != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rawAccessToken, err := app.getRawAccessToken(r)
+		if err != nil {
+			// Should never happen. It means OIDC middleware hasn't done it's job
+			app.serverError(w, r, err)
+			return
+		}
+
+		token, err := app.tokenExchanger.exchange(r.Context(), rawAccessToken)
+		if err != nil {
+			hlog.FromRequest(r).Error().Caller().
+				Err(err).Msg("")
+			app.clientError(w, http.StatusBadGateway)
+			return
+		}
+
+		// The original token should never reach the upstream
+		r.Header.Del("X-Forwarded-Access-Token")
+		r.Header.Del("X-Auth-Request-Access-Token")
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		next.ServeHTTP(w, r)
+	})
+}
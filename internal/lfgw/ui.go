@@ -0,0 +1,133 @@
+package lfgw
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const contextKeyUIPrefix = contextKey("uiPrefix")
+
+// uiPrefixMiddleware serves the upstream web UI (vmui, Prometheus UI) under app.UIPathPrefix. The prefix is stripped before other middlewares see the request, so API calls generated by the UI are authenticated and rewritten like any other request. Requests to the prefix itself are redirected to app.UIHomePath.
+func (app *application) uiPrefixMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.UIPathPrefix == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		path, ok := app.stripUIPrefix(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if path == "/" && app.UIHomePath != "" {
+			http.Redirect(w, r, app.externalURLFor(app.UIPathPrefix+app.UIHomePath), http.StatusFound)
+			return
+		}
+
+		r.URL.Path = path
+		r.URL.RawPath = ""
+
+		// Asset paths can only be rewritten in uncompressed responses
+		if app.isNotAPIRequest(path) {
+			r.Header.Del("Accept-Encoding")
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyUIPrefix, app.UIPathPrefix)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// stripUIPrefix returns the path with app.UIPathPrefix removed and true if the path is under the prefix.
+func (app *application) stripUIPrefix(path string) (string, bool) {
+	if path != app.UIPathPrefix && !strings.HasPrefix(path, app.UIPathPrefix+"/") {
+		return path, false
+	}
+
+	path = strings.TrimPrefix(path, app.UIPathPrefix)
+	if path == "" {
+		path = "/"
+	}
+
+	return path, true
+}
+
+// rewriteUIResponse adds the UI prefix back to relative Location headers and to absolute asset paths in HTML pages (along with app.RoutePrefix), so the browser keeps talking to lfgw under the prefix. Responses to requests outside of the prefix are left as is.
+func (app *application) rewriteUIResponse(resp *http.Response) error {
+	if resp.Request == nil {
+		return nil
+	}
+
+	prefix, ok := resp.Request.Context().Value(contextKeyUIPrefix).(string)
+	if !ok || prefix == "" {
+		return nil
+	}
+
+	if location := resp.Header.Get("Location"); isRootRelative(location) {
+		resp.Header.Set("Location", prefix+location)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "text/html" || resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read UI response: %w", err)
+	}
+	resp.Body.Close()
+
+	body = prefixHTMLPaths(body, app.RoutePrefix+prefix)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	return nil
+}
+
+// prefixHTMLPaths prepends the prefix to root-relative paths in href, src and action attributes. Protocol-relative URLs ("//host/path") are left as is.
+func prefixHTMLPaths(body []byte, prefix string) []byte {
+	for _, attr := range []string{"href", "src", "action"} {
+		for _, quote := range []string{`"`, `'`} {
+			old := attr + "=" + quote + "/"
+			body = replaceRootRelative(body, []byte(old), []byte(old+strings.TrimPrefix(prefix, "/")+"/"))
+		}
+	}
+
+	return body
+}
+
+// replaceRootRelative replaces occurrences of old that are not followed by another slash.
+func replaceRootRelative(body, old, replacement []byte) []byte {
+	var buf bytes.Buffer
+
+	for {
+		i := bytes.Index(body, old)
+		if i < 0 {
+			buf.Write(body)
+			return buf.Bytes()
+		}
+
+		end := i + len(old)
+		buf.Write(body[:i])
+		if end < len(body) && body[end] == '/' {
+			buf.Write(old)
+		} else {
+			buf.Write(replacement)
+		}
+		body = body[end:]
+	}
+}
+
+// isRootRelative returns true if the location is a path starting with a single slash.
+func isRootRelative(location string) bool {
+	return strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//")
+}
@@ -0,0 +1,109 @@
+package lfgw
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_uiPrefixMiddleware(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/vmui":
+			http.Redirect(w, r, "/vmui/", http.StatusMovedPermanently)
+		case "/vmui/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<link href="/static/app.css"><script src='/static/app.js'></script><a href="//example.com/">x</a><img src="./logo.png">`))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `","href":"/static"}`))
+		}
+	}))
+	defer upstream.Close()
+
+	upstreamURL, err := url.Parse(upstream.URL)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name         string
+		prefix       string
+		path         string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "prefix root redirects to UI home",
+			prefix:       "/ui",
+			path:         "/ui/",
+			wantStatus:   http.StatusFound,
+			wantLocation: "/ui/vmui/",
+		},
+		{
+			name:         "upstream redirect is kept under prefix",
+			prefix:       "/ui",
+			path:         "/ui/vmui",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "/ui/vmui/",
+		},
+		{
+			name:       "asset paths in HTML are prefixed",
+			prefix:     "/ui",
+			path:       "/ui/vmui/",
+			wantStatus: http.StatusOK,
+			wantBody:   `<link href="/ui/static/app.css"><script src='/ui/static/app.js'></script><a href="//example.com/">x</a><img src="./logo.png">`,
+		},
+		{
+			name:       "API calls are stripped of prefix, body is intact",
+			prefix:     "/ui",
+			path:       "/ui/api/v1/query",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"path":"/api/v1/query","href":"/static"}`,
+		},
+		{
+			name:       "paths outside of prefix are intact",
+			prefix:     "/ui",
+			path:       "/uiother",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"path":"/uiother","href":"/static"}`,
+		},
+		{
+			name:       "disabled",
+			prefix:     "",
+			path:       "/ui/api/v1/query",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"path":"/ui/api/v1/query","href":"/static"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := application{
+				UpstreamURL:  upstreamURL,
+				UIPathPrefix: tt.prefix,
+				UIHomePath:   "/vmui/",
+			}
+
+			proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+			proxy.ModifyResponse = app.modifyResponse
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			app.uiPrefixMiddleware(proxy).ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantLocation, rr.Header().Get("Location"))
+			if tt.wantBody != "" {
+				body, err := io.ReadAll(rr.Body)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.wantBody, string(body))
+			}
+		})
+	}
+}
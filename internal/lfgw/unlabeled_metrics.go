@@ -0,0 +1,71 @@
+package lfgw
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+// configureUnlabeledMetrics compiles app.UnlabeledMetrics, so selectors of metrics that don't carry the enforced label are handled according to app.UnlabeledMetricsPolicy.
+func (app *application) configureUnlabeledMetrics() error {
+	re, err := querymodifier.NewUnlabeledMetricsRegexp(app.UnlabeledMetrics)
+	if err != nil {
+		return err
+	}
+
+	app.unlabeledMetrics = re
+
+	if re != nil {
+		app.logger.Info().Caller().
+			Strs("unlabeled_metrics", app.UnlabeledMetrics).Msgf("Selectors of unlabeled metrics are handled with the %s policy", app.UnlabeledMetricsPolicy)
+	}
+
+	return nil
+}
+
+// newQueryModifier returns a QueryModifier for the ACL with the settings of the application.
+func (app *application) newQueryModifier(acl querymodifier.ACL) querymodifier.QueryModifier {
+	return querymodifier.QueryModifier{
+		ACL:                 acl,
+		EnableDeduplication: app.EnableDeduplication,
+		OptimizeExpressions: app.OptimizeExpressions,
+		UnlabeledMetrics:    app.unlabeledMetrics,
+		UnlabeledPolicy:     app.UnlabeledMetricsPolicy,
+	}
+}
+
+// queryRewriteError logs the error and responds with 403 Forbidden for rejected selectors of unlabeled metrics and non-aggregated queries of aggregation-only roles or 400 Bad Request otherwise. Query helper endpoints (e.g. format_query) get the error in the format of Prometheus API.
+func (app *application) queryRewriteError(w http.ResponseWriter, r *http.Request, err error) {
+	hlog.FromRequest(r).Error().Caller().
+		Err(err).Msg("")
+
+	forbidden := errors.Is(err, querymodifier.ErrUnlabeledMetric) || errors.Is(err, querymodifier.ErrNotAggregated)
+
+	if app.isQueryHelperRequest(r.URL.Path) {
+		status := http.StatusBadRequest
+		if forbidden {
+			status = http.StatusForbidden
+		}
+		app.queryHelperError(w, status, err)
+		return
+	}
+
+	if forbidden {
+		app.userError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	app.clientError(w, http.StatusBadRequest)
+}
+
+// logSkippedMetrics leaves an audit record for selectors of unlabeled metrics that were not rewritten.
+func (app *application) logSkippedMetrics(r *http.Request, qm querymodifier.QueryModifier) {
+	if len(qm.SkippedMetrics) == 0 {
+		return
+	}
+
+	hlog.FromRequest(r).Warn().Caller().
+		Strs("unlabeled_metrics", qm.SkippedMetrics).Msg("Selectors of unlabeled metrics were not rewritten")
+}
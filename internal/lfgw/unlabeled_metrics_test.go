@@ -0,0 +1,75 @@
+package lfgw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func TestApp_unlabeledMetrics(t *testing.T) {
+	logger := zerolog.New(nil)
+
+	upstreamURL, err := url.Parse("http://prometheus")
+	assert.Nil(t, err)
+
+	acl, err := querymodifier.NewACL("minio")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name      string
+		policy    string
+		wantCode  int
+		wantQuery string
+	}{
+		{
+			name:      "inject",
+			policy:    querymodifier.UnlabeledPolicyInject,
+			wantCode:  http.StatusOK,
+			wantQuery: `up{namespace="minio"}`,
+		},
+		{
+			name:      "skip",
+			policy:    querymodifier.UnlabeledPolicySkip,
+			wantCode:  http.StatusOK,
+			wantQuery: `up`,
+		},
+		{
+			name:     "reject",
+			policy:   querymodifier.UnlabeledPolicyReject,
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{
+				logger:                 &logger,
+				UpstreamURL:            upstreamURL,
+				UnlabeledMetrics:       []string{"up"},
+				UnlabeledMetricsPolicy: tt.policy,
+			}
+			assert.Nil(t, app.configureUnlabeledMetrics())
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil)
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyACL, acl))
+
+			var gotQuery string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotQuery = r.URL.Query().Get("query")
+			})
+
+			rr := httptest.NewRecorder()
+			app.rewriteRequestMiddleware(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Equal(t, tt.wantQuery, gotQuery)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package lfgw
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// upstreamStatusError is used as the status class of requests that failed before the upstream responded
+const upstreamStatusError = "error"
+
+var upstreamRetries = metrics.NewCounter("upstream_retries_total")
+
+// upstreamMetricsTransport instruments requests sent to the upstream: response time (until response headers are received) and responses per status class, connection errors per reason and retries made by the underlying transport (e.g. when the upstream closes a kept-alive connection). It should wrap the base transport directly, so requests following redirects are accounted separately.
+type upstreamMetricsTransport struct {
+	base http.RoundTripper
+}
+
+// newUpstreamMetricsTransport returns an upstreamMetricsTransport wrapping base, which defaults to http.DefaultTransport.
+func newUpstreamMetricsTransport(base http.RoundTripper) *upstreamMetricsTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &upstreamMetricsTransport{
+		base: base,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *upstreamMetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The transport asks for a connection on every attempt, so extra ones are retries
+	var attempts atomic.Int64
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			attempts.Add(1)
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	duration := time.Since(start)
+
+	if n := attempts.Load(); n > 1 {
+		upstreamRetries.Add(int(n - 1))
+	}
+
+	status := upstreamStatusError
+	if err != nil {
+		metrics.GetOrCreateCounter(fmt.Sprintf(`upstream_connection_errors_total{reason=%q}`, upstreamErrorReason(err))).Inc()
+	} else {
+		status = fmt.Sprintf("%dxx", resp.StatusCode/100)
+		metrics.GetOrCreateCounter(fmt.Sprintf(`upstream_responses_total{status=%q}`, status)).Inc()
+	}
+
+	metrics.GetOrCreateHistogram(fmt.Sprintf(`upstream_request_duration_seconds{status=%q}`, status)).Update(duration.Seconds())
+
+	return resp, err
+}
+
+// upstreamErrorReason classifies errors of requests to the upstream, so connection errors can be told apart from clients going away.
+func upstreamErrorReason(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "reset"
+	case errors.As(err, &recordErr), errors.As(err, &certErr):
+		return "tls"
+	default:
+		return "other"
+	}
+}
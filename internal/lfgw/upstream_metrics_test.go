@@ -0,0 +1,127 @@
+package lfgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"syscall"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// roundTripFunc is an http.RoundTripper implemented by a function.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestUpstreamMetricsTransport(t *testing.T) {
+	counter := func(name string) uint64 {
+		return metrics.GetOrCreateCounter(name).Get()
+	}
+
+	tests := []struct {
+		name        string
+		attempts    int
+		status      int
+		err         error
+		wantCounter string
+		wantRetries uint64
+	}{
+		{
+			name:        "success",
+			attempts:    1,
+			status:      http.StatusOK,
+			wantCounter: `upstream_responses_total{status="2xx"}`,
+		},
+		{
+			name:        "server error after a retry",
+			attempts:    2,
+			status:      http.StatusServiceUnavailable,
+			wantCounter: `upstream_responses_total{status="5xx"}`,
+			wantRetries: 1,
+		},
+		{
+			name:        "connection refused",
+			attempts:    1,
+			err:         &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED},
+			wantCounter: `upstream_connection_errors_total{reason="refused"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				trace := httptrace.ContextClientTrace(req.Context())
+				for i := 0; i < tt.attempts; i++ {
+					trace.GetConn(req.URL.Host)
+				}
+
+				if tt.err != nil {
+					return nil, tt.err
+				}
+
+				return &http.Response{StatusCode: tt.status, Body: http.NoBody}, nil
+			})
+
+			counterBefore := counter(tt.wantCounter)
+			retriesBefore := upstreamRetries.Get()
+
+			r := httptest.NewRequest(http.MethodGet, "http://upstream/api/v1/query", nil)
+			_, err := newUpstreamMetricsTransport(base).RoundTrip(r)
+			assert.Equal(t, tt.err, err)
+
+			assert.Equal(t, counterBefore+1, counter(tt.wantCounter))
+			assert.Equal(t, retriesBefore+tt.wantRetries, upstreamRetries.Get())
+		})
+	}
+}
+
+func TestUpstreamErrorReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{
+			err:  fmt.Errorf("request: %w", context.Canceled),
+			want: "canceled",
+		},
+		{
+			err:  &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "upstream"}},
+			want: "dns",
+		},
+		{
+			err:  context.DeadlineExceeded,
+			want: "timeout",
+		},
+		{
+			err:  &net.OpError{Op: "read", Err: syscall.ECONNRESET},
+			want: "reset",
+		},
+		{
+			err:  io.ErrUnexpectedEOF,
+			want: "reset",
+		},
+		{
+			err:  errors.New("something else"),
+			want: "other",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, upstreamErrorReason(tt.err))
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package lfgw
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// aclFileHash returns the SHA-256 hash of the ACL file content (symlinks are followed).
+func (app *application) aclFileHash() ([sha256.Size]byte, error) {
+	content, err := os.ReadFile(app.ACLPath)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+
+	return sha256.Sum256(content), nil
+}
+
+// watchACLFile starts watching the directory app.ACLPath resides in and reloads ACLs whenever the file content changes. The directory is watched rather than the file itself, so atomic replacements and the symlink swap pattern used by kubelet for mounted ConfigMaps (..data -> ..<timestamp>) are detected as well. Watching stops once ctx is cancelled.
+func (app *application) watchACLFile(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create ACL file watcher: %w", err)
+	}
+
+	dir := filepath.Dir(app.ACLPath)
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+
+	lastHash, err := app.aclFileHash()
+	if err != nil {
+		app.logger.Warn().Caller().
+			Err(err).Msgf("Failed to read %s", app.ACLPath)
+	}
+
+	app.logger.Info().Caller().
+		Msgf("ACL auto reload is on (watching %s)", dir)
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				app.logger.Error().Caller().
+					Err(err).Msg("ACL file watcher error")
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				// Any event in the directory might mean a new version of the file (e.g. a swapped symlink), so the content is compared instead of relying on event names
+				hash, err := app.aclFileHash()
+				if err != nil || hash == lastHash {
+					continue
+				}
+
+				app.logger.Info().Caller().
+					Msgf("%s has changed, reloading ACL", app.ACLPath)
+
+				if err := app.reloadACLs(); err == nil {
+					lastHash = hash
+				}
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package lfgw
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApp_watchACLFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// Mimics the layout kubelet creates for mounted ConfigMaps: acl.yaml -> ..data/acl.yaml, ..data -> ..<timestamp>
+	writeVersion := func(name, content string) {
+		versionDir := filepath.Join(dir, name)
+		assert.Nil(t, os.Mkdir(versionDir, 0o700))
+		assert.Nil(t, os.WriteFile(filepath.Join(versionDir, "acl.yaml"), []byte(content), 0o600))
+
+		tmpLink := filepath.Join(dir, "..data_tmp")
+		assert.Nil(t, os.Symlink(name, tmpLink))
+		assert.Nil(t, os.Rename(tmpLink, filepath.Join(dir, "..data")))
+	}
+
+	writeVersion("..v1", "version: 2\nroles:\n  minio: minio\n")
+	assert.Nil(t, os.Symlink(filepath.Join("..data", "acl.yaml"), filepath.Join(dir, "acl.yaml")))
+
+	logger := zerolog.New(nil)
+	app := &application{
+		acls:    &aclsState{},
+		logger:  &logger,
+		ACLPath: filepath.Join(dir, "acl.yaml"),
+	}
+
+	assert.Nil(t, app.reloadACLs())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.Nil(t, app.watchACLFile(ctx))
+
+	t.Run("Symlink swap", func(t *testing.T) {
+		writeVersion("..v2", "version: 2\nroles:\n  minio: mimir\n")
+
+		assert.Eventually(t, func() bool {
+			return app.getACLs()["minio"].RawACL == "mimir"
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Invalid file keeps the previous ACL", func(t *testing.T) {
+		writeVersion("..v3", "version: 2\nroles:\n  minio: mini[o\n")
+
+		// Gives the watcher a chance to process the events
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, "mimir", app.getACLs()["minio"].RawACL)
+	})
+
+	t.Run("Fixed file", func(t *testing.T) {
+		writeVersion("..v4", "version: 2\nroles:\n  minio: minio, mimir\n")
+
+		assert.Eventually(t, func() bool {
+			return app.getACLs()["minio"].RawACL == "minio, mimir"
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,87 @@
+package lfgw
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+const contextKeyIdentity = contextKey("identity")
+
+// identity describes the verified caller: either an OIDC token or an API key.
+type identity struct {
+	Subject  string
+	Email    string
+	ClientID string
+	APIKey   string
+}
+
+// whoamiResponse is returned by whoamiMiddleware.
+type whoamiResponse struct {
+	Subject      string   `json:"subject,omitempty"`
+	Email        string   `json:"email,omitempty"`
+	ClientID     string   `json:"client_id,omitempty"`
+	APIKey       string   `json:"api_key,omitempty"`
+	Roles        []string `json:"roles"`
+	MatchedRoles []string `json:"matched_roles"`
+	Fullaccess   bool     `json:"fullaccess"`
+	RawACL       string   `json:"raw_acl"`
+	RawDenyACL   string   `json:"raw_deny_acl,omitempty"`
+	LabelFilter  string   `json:"label_filter"`
+}
+
+// whoamiMiddleware serves /whoami: the verified identity of the caller, roles considered for the ACL (and those matching ACL definitions), the effective ACL and the resulting label filters. The request is not proxied.
+func (app *application) whoamiMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/whoami" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			app.clientError(w, http.StatusMethodNotAllowed)
+			return
+		}
+
+		acl, ok := r.Context().Value(contextKeyACL).(querymodifier.ACL)
+		if !ok {
+			app.serverError(w, r, errACLNotSetInContext)
+			return
+		}
+
+		id, _ := r.Context().Value(contextKeyIdentity).(identity)
+		roles, _ := r.Context().Value(contextKeyRoles).([]string)
+
+		matched := []string{}
+		for role := range app.getACLs().ForRoles(roles) {
+			matched = append(matched, role)
+		}
+		sort.Strings(matched)
+
+		if roles == nil {
+			roles = []string{}
+		}
+
+		resp := whoamiResponse{
+			Subject:      id.Subject,
+			Email:        id.Email,
+			ClientID:     id.ClientID,
+			APIKey:       id.APIKey,
+			Roles:        roles,
+			MatchedRoles: matched,
+			Fullaccess:   acl.Fullaccess,
+			RawACL:       acl.RawACL,
+			RawDenyACL:   acl.RawDenyACL,
+			LabelFilter:  app.labelFiltersString(acl),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			app.serverError(w, r, err)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package lfgw
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/weisdd/lfgw/internal/querymodifier"
+)
+
+func Test_whoamiMiddleware(t *testing.T) {
+	acls, _, err := querymodifier.NewACLsFromBytes([]byte("team-a: minio, !kube-system\nteam-(.+): ${1}\n"), "")
+	assert.Nil(t, err)
+
+	acl, err := acls.GetUserACL([]string{"team-a", "team-b", "viewer"}, false, "")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		want     int
+		wantBody *whoamiResponse
+	}{
+		{
+			name:   "identity and ACL",
+			method: http.MethodGet,
+			path:   "/whoami",
+			want:   http.StatusOK,
+			wantBody: &whoamiResponse{
+				Subject:      "f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+				Email:        "alice@example.com",
+				Roles:        []string{"team-a", "team-b", "viewer"},
+				MatchedRoles: []string{"team-a", "team-b"},
+				RawACL:       acl.RawACL,
+				RawDenyACL:   "kube-system",
+				LabelFilter:  (&application{}).labelFiltersString(acl),
+			},
+		},
+		{
+			name:   "not allowed method",
+			method: http.MethodPost,
+			path:   "/whoami",
+			want:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "other paths are passed through",
+			method: http.MethodGet,
+			path:   "/api/v1/query",
+			want:   http.StatusTeapot,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.New(nil)
+			app := &application{
+				acls:   &aclsState{},
+				logger: &logger,
+				ACLs:   acls,
+			}
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			ctx := context.WithValue(r.Context(), contextKeyACL, acl)
+			ctx = context.WithValue(ctx, contextKeyRoles, []string{"team-a", "team-b", "viewer"})
+			ctx = context.WithValue(ctx, contextKeyIdentity, identity{Subject: "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", Email: "alice@example.com"})
+			r = r.WithContext(ctx)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			rr := httptest.NewRecorder()
+			app.whoamiMiddleware(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, tt.want, rr.Code)
+
+			if tt.wantBody != nil {
+				var got whoamiResponse
+				assert.Nil(t, json.NewDecoder(rr.Body).Decode(&got))
+				assert.Equal(t, *tt.wantBody, got)
+				assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -2,8 +2,11 @@ package querymodifier
 
 import (
 	"fmt"
+	"net/netip"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/VictoriaMetrics/metricsql"
 )
@@ -11,32 +14,204 @@ import (
 // RegexpSymbols is used to determine whether ACL definition is a regexp or whether LF contains a fake regexp
 const RegexpSymbols = `.+*?^$()[]{}|\`
 
+// DefaultLabel is the label enforced by ACLs unless configured otherwise
+const DefaultLabel = "namespace"
+
+// metricNameLabel is the label holding metric names, it's used to restrict metrics available to a role
+const metricNameLabel = "__name__"
+
 // ACL stores a role definition
 type ACL struct {
 	Fullaccess  bool
 	LabelFilter metricsql.LabelFilter
 	RawACL      string
+	// LabelFilterPairs restrict pairs of ClusterLabel and LabelFilter values (defined as cluster:namespace), a series has to match any of the pairs. Pairs of merged roles might also contain denied values and extra labels of the roles (see ACLs.GetUserACL). LabelFilter contains all namespaces of the pairs then, so it's still usable for deduplication. No restrictions apply if empty
+	LabelFilterPairs [][]metricsql.LabelFilter
+	// DenyLabelFilter is a negative regexp filter excluding values from LabelFilter (defined as !value), it's used only if RawDenyACL is not empty
+	DenyLabelFilter metricsql.LabelFilter
+	// RawDenyACL contains normalized denied values (comma-separated, without !)
+	RawDenyACL string
+	// ExtraLabelFilters are injected into every selector in addition to LabelFilter, so a role can be restricted on more than one dimension (e.g. namespace and cluster)
+	ExtraLabelFilters []metricsql.LabelFilter
+	// RawExtraACLs contains normalized definitions of ExtraLabelFilters (label => comma-separated values), it's used for merging roles and deduplication
+	RawExtraACLs map[string]string
+	// SourceCIDRs limits the networks the role can be used from, no restrictions apply if empty
+	SourceCIDRs []netip.Prefix
+	// MaxTokenAge limits the time since authentication (auth_time, iat as a fallback) of tokens the role can be used with, no restrictions apply if 0
+	MaxTokenAge time.Duration
+	// AllowedAZPs limits the authorized parties (azp) of tokens the role can be used with, no restrictions apply if empty
+	AllowedAZPs []string
+	// ForcedParams are set on every API request, overriding user-supplied values (e.g. deny_partial_response=1), nothing is forced if empty
+	ForcedParams map[string]string
+	// Write allows access to mutating endpoints (e.g. delete_series, snapshots, import) when safe mode is on
+	Write bool
+	// Paths limits the upstream endpoints the ACL can be used for (a trailing * matches any suffix), no restrictions apply if empty
+	Paths []string
+	// Methods limits the HTTP methods the ACL can be used with (HEAD is implied by GET), no restrictions apply if empty
+	Methods []string
+	// AggregationOnly permits only queries aggregating series through sum, avg or count, so values of individual series are never exposed
+	AggregationOnly bool
+	// MinSeries is the minimum number of series aggregations of AggregationOnly ACLs have to be computed over, groups with fewer series are dropped. Not enforced if below 2
+	MinSeries int
+	// ResponseTimeBudget limits the time the upstream has to respond to requests of the role, requests exceeding it are cancelled. No restrictions apply if 0
+	ResponseTimeBudget time.Duration
+	// RolePattern is set for templated role definitions (other fields are empty then), such definitions are used through ACLs.ForRoles
+	RolePattern *RolePattern
 }
 
 // NewACL returns an ACL based on a rule definition (non-regexp for one namespace, regexp - for many). .RawACL in the resulting value will contain a normalized value (anchors stripped, implicit admin will have only .*).
 func NewACL(rawACL string) (ACL, error) {
+	return NewACLForLabel(DefaultLabel, rawACL)
+}
+
+// NewACLForLabel is the same as NewACL, but the rule definition is enforced on the given label instead of namespace. Values prefixed with ! are denied (e.g. "!kube-system" gives access to everything except kube-system). Values in the cluster:namespace form are paired with ClusterLabel (e.g. "prod-eu:payments, prod-us:billing").
+func NewACLForLabel(label, rawACL string) (ACL, error) {
+	buffer, err := toSlice(rawACL)
+	if err != nil {
+		return ACL{}, err
+	}
+
+	allowed, denied := splitDenied(buffer)
+	// A definition consisting only of denied values gives access to everything else
+	if len(allowed) == 0 {
+		allowed = []string{".*"}
+	}
+
+	rawAllowed := allowed
+	var pairs [][]metricsql.LabelFilter
+	if hasPairs(allowed) {
+		pairs, allowed, err = newLabelFilterPairs(label, allowed)
+		if err != nil {
+			return ACL{}, err
+		}
+	}
+
+	lf, allowed, err := newLabelFilter(label, strings.Join(allowed, ", "))
+	if err != nil {
+		return ACL{}, err
+	}
+
+	if len(pairs) > 0 {
+		// Pairs have to be kept in the raw definition, so ACLs can be merged
+		allowed = rawAllowed
+	}
+
+	if isFullaccessLF(lf) && len(denied) == 0 && len(pairs) == 0 {
+		// Note: with this approach, we intentionally omit other values in the resulting ACL
+		return getFullaccessACL(label), nil
+	}
+
+	acl := ACL{
+		Fullaccess:       false,
+		LabelFilter:      lf,
+		LabelFilterPairs: pairs,
+		RawACL:           strings.Join(allowed, ", "),
+	}
+
+	if len(denied) > 0 {
+		acl.DenyLabelFilter, denied, err = newDenyLabelFilter(label, denied)
+		if err != nil {
+			return ACL{}, err
+		}
+		acl.RawDenyACL = strings.Join(denied, ", ")
+	}
+
+	return acl, nil
+}
+
+// splitDenied splits values into allowed and denied ones (prefixed with !, the prefix is removed).
+func splitDenied(values []string) (allowed, denied []string) {
+	for _, v := range values {
+		if d, ok := strings.CutPrefix(v, "!"); ok {
+			denied = append(denied, d)
+			continue
+		}
+		allowed = append(allowed, v)
+	}
+
+	return allowed, denied
+}
+
+// newDenyLabelFilter returns a negative regexp label filter for denied values along with normalized values. It's always a regexp, so it can be merged with negative regexps present in the original query.
+func newDenyLabelFilter(label string, denied []string) (metricsql.LabelFilter, []string, error) {
+	lf, buffer, err := newLabelFilter(label, strings.Join(denied, ", "))
+	if err != nil {
+		return metricsql.LabelFilter{}, nil, err
+	}
+
+	if isFullaccessLF(lf) {
+		return metricsql.LabelFilter{}, nil, fmt.Errorf("denying all values of %s is not supported", label)
+	}
+
+	lf.IsRegexp = true
+	lf.IsNegative = true
+
+	return lf, buffer, nil
+}
+
+// NewACLWithLabels returns an ACL based on a rule definition for the enforced label (see NewACLForLabel) and definitions for other labels (label => definition in the same format). Labels with .* are not restricted. An ACL gives full access only if none of the labels are restricted.
+func NewACLWithLabels(label, rawACL string, rawLabels map[string]string) (ACL, error) {
+	acl, err := NewACLForLabel(label, rawACL)
+	if err != nil {
+		return ACL{}, err
+	}
+
+	// Sorted, so the resulting label filters are always in the same order
+	labels := make([]string, 0, len(rawLabels))
+	for label := range rawLabels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	for _, label := range labels {
+		if label == acl.LabelFilter.Label {
+			return ACL{}, fmt.Errorf("%s label is already enforced through the main definition", label)
+		}
+
+		lf, buffer, err := newLabelFilter(label, rawLabels[label])
+		if err != nil {
+			return ACL{}, err
+		}
+
+		if isFullaccessLF(lf) {
+			continue
+		}
+
+		if acl.RawExtraACLs == nil {
+			acl.RawExtraACLs = make(map[string]string)
+		}
+
+		acl.ExtraLabelFilters = append(acl.ExtraLabelFilters, lf)
+		acl.RawExtraACLs[label] = strings.Join(buffer, ", ")
+	}
+
+	if len(acl.ExtraLabelFilters) > 0 {
+		acl.Fullaccess = false
+	}
+
+	return acl, nil
+}
+
+// newLabelFilter returns a label filter based on a rule definition (non-regexp for one value, regexp - for many) along with normalized values (anchors stripped, implicit admin will have only .*).
+func newLabelFilter(label, rawACL string) (metricsql.LabelFilter, []string, error) {
 	lf := metricsql.LabelFilter{
-		Label:      "namespace",
+		Label:      label,
 		IsNegative: false,
 		IsRegexp:   false,
 	}
 
 	buffer, err := toSlice(rawACL)
 	if err != nil {
-		return ACL{}, err
+		return metricsql.LabelFilter{}, nil, err
 	}
 
 	// If .* is in the slice, then we can omit any other value
 	for _, v := range buffer {
 		// TODO: move to a helper?
 		if v == ".*" {
-			// Note: with this approach, we intentionally omit other values in the resulting ACL
-			return getFullaccessACL(), nil
+			lf.Value = ".*"
+			lf.IsRegexp = true
+			return lf, []string{".*"}, nil
 		}
 	}
 
@@ -60,25 +235,24 @@ func NewACL(rawACL string) (ACL, error) {
 	if lf.IsRegexp {
 		_, err := regexp.Compile(lf.Value)
 		if err != nil {
-			return ACL{}, fmt.Errorf("%s in %q (converted from %q)", err, lf.Value, rawACL)
+			return metricsql.LabelFilter{}, nil, fmt.Errorf("%s in %q (converted from %q)", err, lf.Value, rawACL)
 		}
 	}
 
-	acl := ACL{
-		Fullaccess:  false,
-		LabelFilter: lf,
-		RawACL:      strings.Join(buffer, ", "),
-	}
+	return lf, buffer, nil
+}
 
-	return acl, nil
+// isFullaccessLF returns true if the label filter matches any value.
+func isFullaccessLF(lf metricsql.LabelFilter) bool {
+	return lf.IsRegexp && !lf.IsNegative && lf.Value == ".*"
 }
 
 // getFullaccessACL returns a fullaccess ACL
-func getFullaccessACL() ACL {
+func getFullaccessACL(label string) ACL {
 	return ACL{
 		Fullaccess: true,
 		LabelFilter: metricsql.LabelFilter{
-			Label:      "namespace",
+			Label:      label,
 			Value:      ".*",
 			IsRegexp:   true,
 			IsNegative: false,
@@ -86,3 +260,18 @@ func getFullaccessACL() ACL {
 		RawACL: ".*",
 	}
 }
+
+// IsAllowedFrom returns true if the ACL has no source restrictions or if addr belongs to one of the allowed networks.
+func (acl ACL) IsAllowedFrom(addr netip.Addr) bool {
+	if len(acl.SourceCIDRs) == 0 {
+		return true
+	}
+
+	for _, prefix := range acl.SourceCIDRs {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+
+	return false
+}
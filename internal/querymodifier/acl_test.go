@@ -1,6 +1,7 @@
 package querymodifier
 
 import (
+	"net/netip"
 	"testing"
 
 	"github.com/VictoriaMetrics/metricsql"
@@ -169,3 +170,289 @@ func Test_NewACL(t *testing.T) {
 		})
 	}
 }
+
+func Test_NewACLForLabel(t *testing.T) {
+	got, err := NewACLForLabel("tenant", "team-a, team-b")
+	assert.Nil(t, err)
+	assert.Equal(t, ACL{
+		Fullaccess: false,
+		LabelFilter: metricsql.LabelFilter{
+			Label:      "tenant",
+			Value:      "team-a|team-b",
+			IsRegexp:   true,
+			IsNegative: false,
+		},
+		RawACL: "team-a, team-b",
+	}, got)
+
+	got, err = NewACLForLabel("tenant", ".*")
+	assert.Nil(t, err)
+	assert.Equal(t, getFullaccessACL("tenant"), got)
+}
+
+func Test_NewACL_Deny(t *testing.T) {
+	tests := []struct {
+		name   string
+		rawACL string
+		want   ACL
+		fail   bool
+	}{
+		{
+			name:   "!kube-system (everything except kube-system)",
+			rawACL: "!kube-system",
+			want: ACL{
+				Fullaccess: false,
+				LabelFilter: metricsql.LabelFilter{
+					Label:      "namespace",
+					Value:      ".*",
+					IsRegexp:   true,
+					IsNegative: false,
+				},
+				RawACL: ".*",
+				DenyLabelFilter: metricsql.LabelFilter{
+					Label:      "namespace",
+					Value:      "kube-system",
+					IsRegexp:   true,
+					IsNegative: true,
+				},
+				RawDenyACL: "kube-system",
+			},
+		},
+		{
+			name:   "min.*, !minio-secret, !^(minio-internal)$",
+			rawACL: "min.*, !minio-secret, !^(minio-internal)$",
+			want: ACL{
+				Fullaccess: false,
+				LabelFilter: metricsql.LabelFilter{
+					Label:      "namespace",
+					Value:      "min.*",
+					IsRegexp:   true,
+					IsNegative: false,
+				},
+				RawACL: "min.*",
+				DenyLabelFilter: metricsql.LabelFilter{
+					Label:      "namespace",
+					Value:      "minio-secret|^(minio-internal)$",
+					IsRegexp:   true,
+					IsNegative: true,
+				},
+				RawDenyACL: "minio-secret, ^(minio-internal)$",
+			},
+		},
+		{
+			name:   ".*, !kube-.*",
+			rawACL: ".*, !kube-.*",
+			want: ACL{
+				Fullaccess: false,
+				LabelFilter: metricsql.LabelFilter{
+					Label:      "namespace",
+					Value:      ".*",
+					IsRegexp:   true,
+					IsNegative: false,
+				},
+				RawACL: ".*",
+				DenyLabelFilter: metricsql.LabelFilter{
+					Label:      "namespace",
+					Value:      "kube-.*",
+					IsRegexp:   true,
+					IsNegative: true,
+				},
+				RawDenyACL: "kube-.*",
+			},
+		},
+		{
+			name:   "!.* (denying everything)",
+			rawACL: "!.*",
+			fail:   true,
+		},
+		{
+			name:   "! (empty denied value)",
+			rawACL: "minio, !",
+			fail:   true,
+		},
+		{
+			name:   "!kube-[ (invalid regexp)",
+			rawACL: "!kube-[, !default",
+			fail:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewACL(tt.rawACL)
+			if tt.fail {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_NewACLWithLabels(t *testing.T) {
+	tests := []struct {
+		name      string
+		rawACL    string
+		rawLabels map[string]string
+		want      ACL
+		fail      bool
+	}{
+		{
+			name:      "No labels (same as NewACL)",
+			rawACL:    "minio",
+			rawLabels: nil,
+			want: ACL{
+				Fullaccess: false,
+				LabelFilter: metricsql.LabelFilter{
+					Label:      "namespace",
+					Value:      "minio",
+					IsRegexp:   false,
+					IsNegative: false,
+				},
+				RawACL: "minio",
+			},
+		},
+		{
+			name:      "minio in prod clusters",
+			rawACL:    "minio",
+			rawLabels: map[string]string{"env": "prod", "cluster": "eu-1, us-1"},
+			want: ACL{
+				Fullaccess: false,
+				LabelFilter: metricsql.LabelFilter{
+					Label:      "namespace",
+					Value:      "minio",
+					IsRegexp:   false,
+					IsNegative: false,
+				},
+				RawACL: "minio",
+				// Sorted by label
+				ExtraLabelFilters: []metricsql.LabelFilter{
+					{
+						Label:      "cluster",
+						Value:      "eu-1|us-1",
+						IsRegexp:   true,
+						IsNegative: false,
+					},
+					{
+						Label:      "env",
+						Value:      "prod",
+						IsRegexp:   false,
+						IsNegative: false,
+					},
+				},
+				RawExtraACLs: map[string]string{"cluster": "eu-1, us-1", "env": "prod"},
+			},
+		},
+		{
+			name:      "All namespaces in one cluster (not a full access)",
+			rawACL:    ".*",
+			rawLabels: map[string]string{"cluster": "^(eu-.*)$"},
+			want: ACL{
+				Fullaccess: false,
+				LabelFilter: metricsql.LabelFilter{
+					Label:      "namespace",
+					Value:      ".*",
+					IsRegexp:   true,
+					IsNegative: false,
+				},
+				RawACL: ".*",
+				ExtraLabelFilters: []metricsql.LabelFilter{
+					{
+						Label:      "cluster",
+						Value:      "eu-.*",
+						IsRegexp:   true,
+						IsNegative: false,
+					},
+				},
+				RawExtraACLs: map[string]string{"cluster": "eu-.*"},
+			},
+		},
+		{
+			name:      "Labels with .* are not restricted",
+			rawACL:    ".*",
+			rawLabels: map[string]string{"cluster": "eu-1, .*"},
+			want:      getFullaccessACL(DefaultLabel),
+		},
+		{
+			name:      "namespace label",
+			rawACL:    "minio",
+			rawLabels: map[string]string{"namespace": "default"},
+			fail:      true,
+		},
+		{
+			name:      "Invalid regexp",
+			rawACL:    "minio",
+			rawLabels: map[string]string{"cluster": "eu-[1"},
+			fail:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewACLWithLabels(DefaultLabel, tt.rawACL, tt.rawLabels)
+			if tt.fail {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestACL_IsAllowedFrom(t *testing.T) {
+	acl := ACL{
+		SourceCIDRs: []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("2001:db8::/32"),
+		},
+	}
+
+	tests := []struct {
+		name string
+		acl  ACL
+		addr string
+		want bool
+	}{
+		{
+			name: "no restrictions",
+			acl:  ACL{},
+			addr: "192.168.0.1",
+			want: true,
+		},
+		{
+			name: "IPv4 within range",
+			acl:  acl,
+			addr: "10.1.2.3",
+			want: true,
+		},
+		{
+			name: "IPv4-mapped IPv6 within range",
+			acl:  acl,
+			addr: "::ffff:10.1.2.3",
+			want: true,
+		},
+		{
+			name: "IPv6 within range",
+			acl:  acl,
+			addr: "2001:db8::1",
+			want: true,
+		},
+		{
+			name: "out of range",
+			acl:  acl,
+			addr: "192.168.0.1",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.acl.IsAllowedFrom(netip.MustParseAddr(tt.addr))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -1,16 +1,87 @@
 package querymodifier
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/VictoriaMetrics/metricsql"
 	"gopkg.in/yaml.v3"
 )
 
 // ACLs stores a parsed YAML with role defitions
 type ACLs map[string]ACL
 
+// ErrNoMatchingRoles is returned by GetUserACL if none of the roles can be used to construct an ACL.
+var ErrNoMatchingRoles = errors.New("no matching roles found")
+
+// aclDefinition represents a role definition in acl.yaml. A definition is either a list of namespaces (a comma-separated string or a YAML list) or a mapping with additional settings. In the mapping form, fullaccess is an explicit alternative to namespaces: .*, extra_labels is an alias for labels, metrics restricts metric names (a shortcut for a __name__ extra label), and comment is a free-form description that is not used by lfgw. Extends names a role whose namespaces (including denied ones) are inherited, see resolveExtends.
+type aclDefinition struct {
+	Extends      string            `yaml:"extends"`
+	Namespaces   namespaceList     `yaml:"namespaces"`
+	Fullaccess   bool              `yaml:"fullaccess"`
+	Label        string            `yaml:"label"`
+	Deny         []string          `yaml:"deny"`
+	Labels       map[string]string `yaml:"labels"`
+	ExtraLabels  map[string]string `yaml:"extra_labels"`
+	Metrics      namespaceList     `yaml:"metrics"`
+	Comment      string            `yaml:"comment"`
+	SourceCIDRs  []string          `yaml:"source_cidrs"`
+	MaxTokenAge  time.Duration     `yaml:"max_token_age"`
+	AllowedAZPs  []string          `yaml:"allowed_azp"`
+	ForcedParams map[string]string `yaml:"forced_params"`
+	Write        bool              `yaml:"write"`
+	Paths        []string          `yaml:"paths"`
+	Methods      []string          `yaml:"methods"`
+	// AggregationOnly restricts the role to aggregated queries, MinSeries is the number of series they have to be computed over (see ACL)
+	AggregationOnly bool `yaml:"aggregation_only"`
+	MinSeries       int  `yaml:"min_series"`
+	// ResponseTimeBudget limits the time the upstream has to respond (see ACL)
+	ResponseTimeBudget time.Duration `yaml:"response_time_budget"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, so both short (string or list) and full (mapping) forms of a role definition are supported.
+func (d *aclDefinition) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode || value.Kind == yaml.SequenceNode {
+		return value.Decode(&d.Namespaces)
+	}
+
+	// A separate type is needed to avoid infinite recursion
+	type plain aclDefinition
+	return value.Decode((*plain)(d))
+}
+
+// namespaceList is a comma-separated list of namespaces (or other values, e.g. metric names), which can also be specified as a YAML list. Both forms result in the same raw ACL.
+type namespaceList string
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (n *namespaceList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.SequenceNode {
+		var s string
+		if err := value.Decode(&s); err != nil {
+			return err
+		}
+		*n = namespaceList(s)
+		return nil
+	}
+
+	items := make([]string, 0, len(value.Content))
+	for _, item := range value.Content {
+		if item.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d: expected a list of strings", item.Line)
+		}
+		items = append(items, item.Value)
+	}
+
+	*n = namespaceList(strings.Join(items, ", "))
+
+	return nil
+}
+
 // rolesToRawACL returns a comma-separated list of ACL definitions for all specified roles. Basically, it lets you dynamically generate a raw ACL as if it was supplied through acl.yaml. To support Assumed Roles, unknown roles are treated as ACL definitions.
 func (a ACLs) rolesToRawACL(roles []string) (string, error) {
 	rawACLs := make([]string, 0, len(roles))
@@ -37,8 +108,193 @@ func (a ACLs) rolesToRawACL(roles []string) (string, error) {
 	return rawACL, nil
 }
 
-// GetUserACL takes a list of roles found in an OIDC claim and constructs and ACL based on them. If assumed roles are disabled, then only known roles (present in app.ACLs) are considered.
-func (a ACLs) GetUserACL(oidcRoles []string, assumedRolesEnabled bool) (ACL, error) {
+// mergeRawExtraACLs returns per-label unions of extra label definitions for all specified roles. A label stays restricted only if all roles restrict it, as a role without such a restriction gives access to all of its values. Unknown roles are not restricted by extra labels. The result is only exact if all roles have the same extra labels, see mergeLabelFilterTuples for other cases.
+func (a ACLs) mergeRawExtraACLs(roles []string) map[string]string {
+	merged := make(map[string]string)
+
+	for i, role := range roles {
+		acl := a[role]
+
+		if i == 0 {
+			for label, rawACL := range acl.RawExtraACLs {
+				merged[label] = rawACL
+			}
+			continue
+		}
+
+		for label, rawACL := range merged {
+			other, exists := acl.RawExtraACLs[label]
+			if !exists {
+				delete(merged, label)
+				continue
+			}
+			merged[label] = rawACL + ", " + other
+		}
+	}
+
+	return merged
+}
+
+// rolesToLabel returns the label enforced by all specified roles. Unknown roles are enforced on enforcedLabel. Roles enforced on different labels cannot be merged, because a union of their definitions would be meaningless.
+func (a ACLs) rolesToLabel(roles []string, enforcedLabel string) (string, error) {
+	if enforcedLabel == "" {
+		enforcedLabel = DefaultLabel
+	}
+
+	label := ""
+
+	for _, role := range roles {
+		roleLabel := enforcedLabel
+		if acl, exists := a[role]; exists {
+			roleLabel = acl.LabelFilter.Label
+		}
+
+		if label == "" {
+			label = roleLabel
+			continue
+		}
+
+		if roleLabel != label {
+			return "", fmt.Errorf("roles enforced on different labels (%s, %s) cannot be combined", label, roleLabel)
+		}
+	}
+
+	return label, nil
+}
+
+// mergeRawDenyACLs returns denied values that remain valid for a combination of roles: a value is kept unless one of the roles grants it (i.e. the role doesn't deny it and its definition matches the value). Unknown roles are treated as definitions for label.
+func (a ACLs) mergeRawDenyACLs(roles []string, label string) []string {
+	type roleDefinition struct {
+		lf     metricsql.LabelFilter
+		denied map[string]bool
+	}
+
+	definitions := make([]roleDefinition, 0, len(roles))
+	candidates := []string{}
+
+	for _, role := range roles {
+		acl, exists := a[role]
+		if !exists {
+			var err error
+			acl, err = NewACLForLabel(label, role)
+			if err != nil {
+				// Such roles will fail further in the process anyway
+				continue
+			}
+		}
+
+		definition := roleDefinition{
+			lf:     acl.LabelFilter,
+			denied: make(map[string]bool),
+		}
+
+		if acl.RawDenyACL != "" {
+			for _, d := range strings.Split(acl.RawDenyACL, ", ") {
+				if !slices.Contains(candidates, d) {
+					candidates = append(candidates, d)
+				}
+				definition.denied[d] = true
+			}
+		}
+
+		definitions = append(definitions, definition)
+	}
+
+	kept := []string{}
+
+	for _, d := range candidates {
+		granted := false
+		for _, definition := range definitions {
+			if !definition.denied[d] && lfMatchesValue(definition.lf, d) {
+				granted = true
+				break
+			}
+		}
+
+		if !granted {
+			kept = append(kept, d)
+		}
+	}
+
+	return kept
+}
+
+// lfMatchesValue returns true if the positive label filter matches the value. Denied values might be regexps themselves, in this case they're matched literally, which is good enough for typical definitions (e.g. .* matches anything).
+func lfMatchesValue(lf metricsql.LabelFilter, value string) bool {
+	if !lf.IsRegexp {
+		return lf.Value == value
+	}
+
+	re, err := metricsql.CompileRegexpAnchored(lf.Value)
+	if err != nil {
+		return false
+	}
+
+	return re.MatchString(value)
+}
+
+// mergeForcedParams returns parameters forced by all known roles. Roles forcing different values of the same parameter result in an error, as there's no way to tell which of them is safer.
+func (a ACLs) mergeForcedParams(roles []string) (map[string]string, error) {
+	var merged map[string]string
+
+	for _, role := range roles {
+		for param, value := range a[role].ForcedParams {
+			if merged == nil {
+				merged = make(map[string]string)
+			}
+
+			if other, exists := merged[param]; exists && other != value {
+				return nil, fmt.Errorf("roles force different values of %s parameter: %q and %q", param, other, value)
+			}
+			merged[param] = value
+		}
+	}
+
+	return merged, nil
+}
+
+// hasWrite returns true if any of the known roles has the write capability.
+func (a ACLs) hasWrite(roles []string) bool {
+	for _, role := range roles {
+		if a[role].Write {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetUserACL takes a list of roles found in an OIDC claim and constructs and ACL based on them. If assumed roles are disabled, then only known roles (present in app.ACLs or matching role patterns) are considered. Unknown roles are enforced on enforcedLabel (DefaultLabel if empty). Parameters forced by any of the known roles are set in ForcedParams, Write is set if any of the known roles has the write capability. Paths and methods are restricted only if all of the known roles restrict them, the same applies to response time budgets. Aggregation-only roles cannot be combined with regular roles without full access.
+func (a ACLs) GetUserACL(oidcRoles []string, assumedRolesEnabled bool, enforcedLabel string) (ACL, error) {
+	// Templated definitions are expanded for the roles, so they can be treated as known roles further down the process
+	a = a.ForRoles(oidcRoles)
+
+	// Parameters are forced by all known roles, including those that are not needed to construct the ACL (e.g. when one of the roles gives full access)
+	forcedParams, err := a.mergeForcedParams(oidcRoles)
+	if err != nil {
+		return ACL{}, err
+	}
+
+	acl, err := a.getUserACL(oidcRoles, assumedRolesEnabled, enforcedLabel)
+	if err != nil {
+		return ACL{}, err
+	}
+
+	acl.ForcedParams = forcedParams
+	acl.Write = a.hasWrite(oidcRoles)
+	acl.Paths = a.mergeAllowlists(oidcRoles, func(acl ACL) []string { return acl.Paths })
+	acl.Methods = a.mergeAllowlists(oidcRoles, func(acl ACL) []string { return acl.Methods })
+	acl.AggregationOnly, acl.MinSeries, err = a.mergeAggregationOnly(oidcRoles)
+	if err != nil {
+		return ACL{}, err
+	}
+	acl.ResponseTimeBudget = a.mergeResponseTimeBudgets(oidcRoles)
+
+	return acl, nil
+}
+
+// getUserACL constructs an ACL based on the roles, see GetUserACL for details.
+func (a ACLs) getUserACL(oidcRoles []string, assumedRolesEnabled bool, enforcedLabel string) (ACL, error) {
 	roles := []string{}
 	assumedRoles := []string{}
 
@@ -59,7 +315,7 @@ func (a ACLs) GetUserACL(oidcRoles []string, assumedRolesEnabled bool) (ACL, err
 	}
 
 	if len(roles) == 0 {
-		return ACL{}, fmt.Errorf("no matching roles found")
+		return ACL{}, ErrNoMatchingRoles
 	}
 
 	// We can return a prebuilt ACL if there's only one role and it's known
@@ -77,42 +333,352 @@ func (a ACLs) GetUserACL(oidcRoles []string, assumedRolesEnabled bool) (ACL, err
 		return ACL{}, err
 	}
 
-	acl, err := NewACL(rawACL)
+	label, err := a.rolesToLabel(roles, enforcedLabel)
+	if err != nil {
+		return ACL{}, err
+	}
+
+	for _, d := range a.mergeRawDenyACLs(roles, label) {
+		rawACL += ", !" + d
+	}
+
+	acl, err := NewACLWithLabels(label, rawACL, a.mergeRawExtraACLs(roles))
 	if err != nil {
 		return ACL{}, err
 	}
 
+	// Extra labels merged per label would give access to more than each of the roles individually (e.g. namespace of one role in a cluster of another), so every role is restricted by its own definition through label filter pairs then
+	if !a.haveSameRawExtraACLs(roles) {
+		acl.LabelFilterPairs, err = a.mergeLabelFilterTuples(roles, label)
+		if err != nil {
+			return ACL{}, err
+		}
+
+		if len(acl.LabelFilterPairs) > 0 {
+			acl.Fullaccess = false
+		}
+	}
+
 	return acl, nil
 }
 
-// NewACLsFromFile loads ACL from a file or returns an empty ACLs instance if path is empty
-func NewACLsFromFile(path string) (ACLs, error) {
+// haveSameRawExtraACLs returns true if all specified roles are restricted by the same extra labels. Unknown roles are not restricted by extra labels.
+func (a ACLs) haveSameRawExtraACLs(roles []string) bool {
+	for _, role := range roles[1:] {
+		if !maps.Equal(a[role].RawExtraACLs, a[roles[0]].RawExtraACLs) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mergeLabelFilterTuples returns label filter pairs restricting each of the specified roles to its own values, denied values and extra labels, so a series has to be allowed by one of the roles as a whole. Unknown roles are treated as definitions for label. nil is returned if one of the roles has no restrictions at all.
+func (a ACLs) mergeLabelFilterTuples(roles []string, label string) ([][]metricsql.LabelFilter, error) {
+	tuples := make([][]metricsql.LabelFilter, 0, len(roles))
+
+	for _, role := range roles {
+		acl, exists := a[role]
+		if !exists {
+			var err error
+			acl, err = NewACLForLabel(label, role)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		pairs := acl.LabelFilterPairs
+		if len(pairs) == 0 {
+			pairs = [][]metricsql.LabelFilter{{}}
+			if !isFullaccessLF(acl.LabelFilter) {
+				pairs[0] = append(pairs[0], acl.LabelFilter)
+			}
+		}
+
+		for _, pair := range pairs {
+			tuple := append([]metricsql.LabelFilter{}, pair...)
+			if acl.RawDenyACL != "" {
+				tuple = append(tuple, acl.DenyLabelFilter)
+			}
+			tuple = append(tuple, acl.ExtraLabelFilters...)
+
+			if len(tuple) == 0 {
+				return nil, nil
+			}
+			tuples = appendPair(tuples, tuple)
+		}
+	}
+
+	return tuples, nil
+}
+
+// NewACLsFromFile loads ACL from a file or returns an empty ACLs instance if path is empty. Role definitions are enforced on enforcedLabel (DefaultLabel if empty) unless they override it.
+func NewACLsFromFile(path string, enforcedLabel string) (ACLs, error) {
+	acls, _, err := NewACLsFromFileWithWarnings(path, enforcedLabel)
+	return acls, err
+}
+
+// NewACLsFromFileWithWarnings is the same as NewACLsFromFile, but it also returns deprecation warnings (e.g. if the file is of an outdated version and got upgraded in memory).
+func NewACLsFromFileWithWarnings(path string, enforcedLabel string) (ACLs, []string, error) {
 	acls := make(ACLs)
 
 	path = strings.TrimSpace(path)
 	if path == "" {
-		return acls, nil
+		return acls, nil, nil
 	}
 
 	yamlFile, err := os.ReadFile(path)
 	if err != nil {
-		return ACLs{}, err
+		return ACLs{}, nil, err
 	}
-	var aclYaml map[string]string
 
-	err = yaml.Unmarshal(yamlFile, &aclYaml)
+	return NewACLsFromBytes(yamlFile, enforcedLabel)
+}
+
+// NewACLsFromBytes loads ACL from the content of acl.yaml (e.g. fetched from a ConfigMap rather than read from a file). Deprecation warnings are returned in the same way as in NewACLsFromFileWithWarnings.
+func NewACLsFromBytes(content []byte, enforcedLabel string) (ACLs, []string, error) {
+	acls := make(ACLs)
+
+	f, warnings, err := parseACLFile(content)
 	if err != nil {
-		return ACLs{}, err
+		return ACLs{}, nil, err
 	}
 
-	for role, rawACL := range aclYaml {
-		acl, err := NewACL(rawACL)
+	definitions := make(map[string]aclDefinition, len(f.Roles)+len(f.Users))
+	for role, definition := range f.Roles {
+		if IsReservedKey(role) {
+			return ACLs{}, nil, fmt.Errorf("%s role uses a reserved prefix (%s, %s), users and clients should be defined under users and clients", role, UserKeyPrefix, ClientKeyPrefix)
+		}
+		definitions[role] = definition
+	}
+
+	// Users and clients are resolved along with roles, so they can extend roles
+	for user, definition := range f.Users {
+		key, err := userKey(user)
 		if err != nil {
-			return ACLs{}, err
+			return ACLs{}, nil, err
+		}
+		if _, exists := definitions[key]; exists {
+			return ACLs{}, nil, fmt.Errorf("%s user is defined more than once", user)
+		}
+		definitions[key] = definition
+	}
+
+	for client, definition := range f.Clients {
+		key, err := clientKey(client)
+		if err != nil {
+			return ACLs{}, nil, err
+		}
+		if _, exists := definitions[key]; exists {
+			return ACLs{}, nil, fmt.Errorf("%s client is defined more than once", client)
+		}
+		definitions[key] = definition
+	}
+
+	roles, err := resolveExtends(definitions)
+	if err != nil {
+		return ACLs{}, nil, err
+	}
+
+	for role, definition := range roles {
+		if isRolePattern(role) && !IsReservedKey(role) {
+			pattern, err := newRolePattern(role, definition, enforcedLabel)
+			if err != nil {
+				return ACLs{}, nil, err
+			}
+
+			acls[role] = ACL{RolePattern: pattern}
+			continue
+		}
+
+		acl, err := newACLFromDefinition(role, definition, enforcedLabel)
+		if err != nil {
+			return ACLs{}, nil, err
 		}
 
 		acls[role] = acl
 	}
 
-	return acls, nil
+	return acls, warnings, nil
+}
+
+// newACLFromDefinition returns an ACL for a role definition from acl.yaml (inheritance must already be resolved). Definitions are enforced on enforcedLabel (DefaultLabel if empty) unless they override it.
+func newACLFromDefinition(role string, definition aclDefinition, enforcedLabel string) (ACL, error) {
+	label := enforcedLabel
+	if label == "" {
+		label = DefaultLabel
+	}
+	if definition.Label != "" {
+		label = definition.Label
+	}
+
+	labels := definition.Labels
+	if len(definition.ExtraLabels) > 0 {
+		if len(labels) > 0 {
+			return ACL{}, fmt.Errorf("%s role contains both labels and extra_labels, only one of them can be used", role)
+		}
+		labels = definition.ExtraLabels
+	}
+
+	if definition.Metrics != "" {
+		if _, ok := labels[metricNameLabel]; ok {
+			return ACL{}, fmt.Errorf("%s role restricts metric names through both metrics and %s, only one of them can be used", role, metricNameLabel)
+		}
+
+		// Copied, so the original definition (e.g. of a role pattern) stays intact
+		withMetrics := make(map[string]string, len(labels)+1)
+		for label, value := range labels {
+			withMetrics[label] = value
+		}
+		withMetrics[metricNameLabel] = string(definition.Metrics)
+		labels = withMetrics
+	}
+
+	rawACL := string(definition.Namespaces)
+	if definition.Fullaccess {
+		if (rawACL != "" && strings.TrimSpace(rawACL) != ".*") || len(definition.Deny) > 0 || len(labels) > 0 {
+			return ACL{}, fmt.Errorf("%s role has fullaccess set, thus it cannot restrict namespaces, deny, metrics or extra labels", role)
+		}
+		rawACL = ".*"
+	}
+
+	for _, d := range definition.Deny {
+		rawACL += ", !" + strings.TrimPrefix(strings.TrimSpace(d), "!")
+	}
+
+	acl, err := NewACLWithLabels(label, rawACL, labels)
+	if err != nil {
+		return ACL{}, fmt.Errorf("%s role: %w", role, err)
+	}
+
+	acl.SourceCIDRs, err = toPrefixes(definition.SourceCIDRs)
+	if err != nil {
+		return ACL{}, fmt.Errorf("%s role contains invalid source_cidrs: %s", role, err)
+	}
+
+	if definition.MaxTokenAge < 0 {
+		return ACL{}, fmt.Errorf("%s role contains negative max_token_age: %s", role, definition.MaxTokenAge)
+	}
+	acl.MaxTokenAge = definition.MaxTokenAge
+
+	for _, azp := range definition.AllowedAZPs {
+		azp = strings.TrimSpace(azp)
+		if azp == "" {
+			return ACL{}, fmt.Errorf("%s role contains an empty allowed_azp entry", role)
+		}
+		acl.AllowedAZPs = append(acl.AllowedAZPs, azp)
+	}
+
+	for param, value := range definition.ForcedParams {
+		if param == "" || param == "query" || param == "match[]" {
+			return ACL{}, fmt.Errorf("%s role contains a forced_params entry that cannot be forced: %q", role, param)
+		}
+
+		if acl.ForcedParams == nil {
+			acl.ForcedParams = make(map[string]string)
+		}
+		acl.ForcedParams[param] = value
+	}
+
+	acl.Write = definition.Write
+
+	acl.Paths, err = newPaths(role, definition.Paths)
+	if err != nil {
+		return ACL{}, err
+	}
+
+	acl.Methods, err = newMethods(role, definition.Methods)
+	if err != nil {
+		return ACL{}, err
+	}
+
+	if definition.MinSeries < 0 {
+		return ACL{}, fmt.Errorf("%s role contains negative min_series: %d", role, definition.MinSeries)
+	}
+	if definition.MinSeries > 0 && !definition.AggregationOnly {
+		return ACL{}, fmt.Errorf("%s role sets min_series, thus it must be aggregation_only", role)
+	}
+	// Full access ACLs are never rewritten, thus aggregation cannot be enforced for them
+	if definition.AggregationOnly && acl.Fullaccess {
+		return ACL{}, fmt.Errorf("%s role gives full access, thus it cannot be aggregation_only", role)
+	}
+	acl.AggregationOnly = definition.AggregationOnly
+	acl.MinSeries = definition.MinSeries
+
+	if definition.ResponseTimeBudget < 0 {
+		return ACL{}, fmt.Errorf("%s role contains negative response_time_budget: %s", role, definition.ResponseTimeBudget)
+	}
+	acl.ResponseTimeBudget = definition.ResponseTimeBudget
+
+	return acl, nil
+}
+
+// resolveExtends returns role definitions with inheritance (extends) resolved: a role gets namespaces and denied values of the whole chain of parents in addition to its own. The label is inherited as well, a role cannot override it. Other settings (e.g. extra labels, source_cidrs) are not inherited. Unknown parents and cycles result in an error.
+func resolveExtends(definitions map[string]aclDefinition) (map[string]aclDefinition, error) {
+	resolved := make(map[string]aclDefinition, len(definitions))
+	// Roles that are being resolved at the moment, used to detect cycles
+	resolving := make(map[string]bool)
+
+	var resolve func(role string) (aclDefinition, error)
+	resolve = func(role string) (aclDefinition, error) {
+		if definition, ok := resolved[role]; ok {
+			return definition, nil
+		}
+
+		definition := definitions[role]
+		if definition.Extends == "" {
+			resolved[role] = definition
+			return definition, nil
+		}
+
+		if resolving[role] {
+			return aclDefinition{}, fmt.Errorf("%s role is a part of an extends cycle", role)
+		}
+
+		if _, exists := definitions[definition.Extends]; !exists {
+			return aclDefinition{}, fmt.Errorf("%s role extends unknown role %s", role, definition.Extends)
+		}
+
+		if isRolePattern(definition.Extends) {
+			return aclDefinition{}, fmt.Errorf("%s role cannot extend role pattern %s", role, definition.Extends)
+		}
+
+		resolving[role] = true
+		parent, err := resolve(definition.Extends)
+		if err != nil {
+			return aclDefinition{}, err
+		}
+		delete(resolving, role)
+
+		if definition.Label != "" && parent.Label != definition.Label {
+			return aclDefinition{}, fmt.Errorf("%s role cannot override label of %s role it extends", role, definition.Extends)
+		}
+		definition.Label = parent.Label
+
+		parentNamespaces := parent.Namespaces
+		if parent.Fullaccess && parentNamespaces == "" {
+			parentNamespaces = ".*"
+		}
+
+		switch {
+		case parentNamespaces == "":
+		case definition.Namespaces == "":
+			definition.Namespaces = parentNamespaces
+		default:
+			definition.Namespaces = parentNamespaces + ", " + definition.Namespaces
+		}
+
+		definition.Deny = append(slices.Clone(parent.Deny), definition.Deny...)
+
+		resolved[role] = definition
+		return definition, nil
+	}
+
+	for role := range definitions {
+		if _, err := resolve(role); err != nil {
+			return nil, err
+		}
+	}
+
+	return resolved, nil
 }
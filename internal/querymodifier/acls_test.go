@@ -1,8 +1,11 @@
 package querymodifier
 
 import (
+	"net/netip"
+	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/VictoriaMetrics/metricsql"
 	"github.com/stretchr/testify/assert"
@@ -115,20 +118,20 @@ func TestACL_GetUserACL(t *testing.T) {
 	// Assumed roles disabled
 	t.Run("0 roles", func(t *testing.T) {
 		roles := []string{}
-		_, err := a.GetUserACL(roles, false)
+		_, err := a.GetUserACL(roles, false, DefaultLabel)
 		assert.NotNil(t, err)
 	})
 
 	t.Run("0 known roles", func(t *testing.T) {
 		roles := []string{"unknown-role"}
-		_, err := a.GetUserACL(roles, false)
+		_, err := a.GetUserACL(roles, false, DefaultLabel)
 		assert.NotNil(t, err)
 	})
 
 	t.Run("1 role", func(t *testing.T) {
 		roles := []string{"single-value"}
 		want := a["single-value"]
-		got, err := a.GetUserACL(roles, false)
+		got, err := a.GetUserACL(roles, false, DefaultLabel)
 		assert.Nil(t, err)
 		assert.Equal(t, want, got)
 	})
@@ -136,7 +139,7 @@ func TestACL_GetUserACL(t *testing.T) {
 	t.Run("multiple roles, full access", func(t *testing.T) {
 		roles := []string{"admin", "multiple-values"}
 		want := a["admin"]
-		got, err := a.GetUserACL(roles, false)
+		got, err := a.GetUserACL(roles, false, DefaultLabel)
 		assert.Nil(t, err)
 		assert.Equal(t, want, got)
 	})
@@ -159,7 +162,7 @@ func TestACL_GetUserACL(t *testing.T) {
 			RawACL: rawACL,
 		}
 
-		got, err := a.GetUserACL(roles, false)
+		got, err := a.GetUserACL(roles, false, DefaultLabel)
 		assert.Nil(t, err)
 		assert.Equal(t, want, got)
 	})
@@ -179,7 +182,7 @@ func TestACL_GetUserACL(t *testing.T) {
 			RawACL: "unknown-role",
 		}
 
-		got, err := a.GetUserACL(roles, true)
+		got, err := a.GetUserACL(roles, true, DefaultLabel)
 		assert.Nil(t, err)
 		assert.Equal(t, want, got)
 	})
@@ -198,7 +201,7 @@ func TestACL_GetUserACL(t *testing.T) {
 			RawACL: "ku.*, min.*, default, unknown-role",
 		}
 
-		got, err := a.GetUserACL(roles, true)
+		got, err := a.GetUserACL(roles, true, DefaultLabel)
 		assert.Nil(t, err)
 		assert.Equal(t, want, got)
 	})
@@ -219,7 +222,7 @@ func TestACL_GetUserACL(t *testing.T) {
 	// 		RawACL: "ku.*, min.*, default, unknown-role1|unknown-role2",
 	// 	}
 
-	// 	got, err := a.GetUserACL(roles, true)
+	// 	got, err := a.GetUserACL(roles, true, DefaultLabel)
 	// 	assert.Nil(t, err)
 	// 	assert.Equal(t, want, got)
 	// })
@@ -238,7 +241,7 @@ func TestACL_GetUserACL(t *testing.T) {
 			RawACL: "ku.*, min.*, default, unknown-role1, unknown-role2",
 		}
 
-		got, err := a.GetUserACL(roles, true)
+		got, err := a.GetUserACL(roles, true, DefaultLabel)
 		assert.Nil(t, err)
 		assert.Equal(t, want, got)
 	})
@@ -257,12 +260,347 @@ func TestACL_GetUserACL(t *testing.T) {
 			RawACL: ".*",
 		}
 
-		got, err := a.GetUserACL(roles, true)
+		got, err := a.GetUserACL(roles, true, DefaultLabel)
 		assert.Nil(t, err)
 		assert.Equal(t, want, got)
 	})
 }
 
+func TestACL_GetUserACL_ExtraLabels(t *testing.T) {
+	aclTeamA, err := NewACLWithLabels(DefaultLabel, "team-a", map[string]string{"cluster": "prod", "env": "live"})
+	assert.Nil(t, err)
+
+	aclTeamB, err := NewACLWithLabels(DefaultLabel, "team-b", map[string]string{"cluster": "dev"})
+	assert.Nil(t, err)
+
+	aclTeamBInProd, err := NewACLWithLabels(DefaultLabel, "team-b", map[string]string{"cluster": "prod", "env": "live"})
+	assert.Nil(t, err)
+
+	aclAllNamespacesInProd, err := NewACLWithLabels(DefaultLabel, ".*", map[string]string{"cluster": "prod"})
+	assert.Nil(t, err)
+
+	aclNoKubeSystemInDev, err := NewACLWithLabels(DefaultLabel, "!kube-system", map[string]string{"cluster": "dev"})
+	assert.Nil(t, err)
+
+	aclKubeSystemInProd, err := NewACLWithLabels(DefaultLabel, "kube-system", map[string]string{"cluster": "prod"})
+	assert.Nil(t, err)
+
+	aclTeamC, err := NewACL("team-c")
+	assert.Nil(t, err)
+
+	acls := ACLs{
+		"team-a":             aclTeamA,
+		"team-b":             aclTeamB,
+		"team-b-prod":        aclTeamBInProd,
+		"prod-reader":        aclAllNamespacesInProd,
+		"dev-reader":         aclNoKubeSystemInDev,
+		"kube-system-reader": aclKubeSystemInProd,
+		"team-c":             aclTeamC,
+	}
+
+	teamAPair := []metricsql.LabelFilter{
+		{Label: "namespace", Value: "team-a"},
+		{Label: "cluster", Value: "prod"},
+		{Label: "env", Value: "live"},
+	}
+
+	t.Run("Roles with the same extra labels are merged", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"team-a", "team-b-prod"}, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACLWithLabels(DefaultLabel, "team-a, team-b", map[string]string{"cluster": "prod, prod", "env": "live, live"})
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("Roles with different extra labels are restricted through pairs", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"team-a", "team-b"}, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACLWithLabels(DefaultLabel, "team-a, team-b", map[string]string{"cluster": "prod, dev"})
+		assert.Nil(t, err)
+		want.LabelFilterPairs = [][]metricsql.LabelFilter{
+			teamAPair,
+			{
+				{Label: "namespace", Value: "team-b"},
+				{Label: "cluster", Value: "dev"},
+			},
+		}
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("Namespace of one role is not allowed in a cluster of another", func(t *testing.T) {
+		acl, err := acls.GetUserACL([]string{"team-a", "team-b"}, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		qm := QueryModifier{
+			ACL: acl,
+		}
+
+		got, err := qm.GetModifiedEncodedURLValues(url.Values{
+			"query": {`up{namespace="team-a", cluster="dev"}`},
+		})
+		assert.Nil(t, err)
+
+		want := url.Values{
+			"query": {`up{namespace="team-a", cluster="prod", env="live"} or up{namespace="team-b", cluster="dev"}`},
+		}
+		assert.Equal(t, want.Encode(), got)
+	})
+
+	t.Run("Role without extra labels doesn't lift restrictions of other roles", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"team-a", "team-c"}, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL("team-a, team-c")
+		assert.Nil(t, err)
+		want.LabelFilterPairs = [][]metricsql.LabelFilter{
+			teamAPair,
+			{
+				{Label: "namespace", Value: "team-c"},
+			},
+		}
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("All namespaces, restricted cluster", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"prod-reader"}, false, DefaultLabel)
+		assert.Nil(t, err)
+		assert.False(t, got.Fullaccess)
+		assert.Equal(t, ".*", got.RawACL)
+		assert.Equal(t, map[string]string{"cluster": "prod"}, got.RawExtraACLs)
+
+		got, err = acls.GetUserACL([]string{"prod-reader", "team-a"}, false, DefaultLabel)
+		assert.Nil(t, err)
+		assert.False(t, got.Fullaccess)
+		assert.Equal(t, ".*", got.RawACL)
+		assert.Equal(t, map[string]string{"cluster": "prod, prod"}, got.RawExtraACLs)
+		assert.Equal(t, [][]metricsql.LabelFilter{{{Label: "cluster", Value: "prod"}}, teamAPair}, got.LabelFilterPairs)
+	})
+
+	t.Run("Denied values are kept per role", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"dev-reader", "kube-system-reader"}, false, DefaultLabel)
+		assert.Nil(t, err)
+		assert.False(t, got.Fullaccess)
+		assert.Equal(t, [][]metricsql.LabelFilter{
+			{
+				{Label: "namespace", Value: "kube-system", IsRegexp: true, IsNegative: true},
+				{Label: "cluster", Value: "dev"},
+			},
+			{
+				{Label: "namespace", Value: "kube-system"},
+				{Label: "cluster", Value: "prod"},
+			},
+		}, got.LabelFilterPairs)
+	})
+
+	t.Run("Unknown role doesn't lift restrictions of other roles (assumed roles enabled)", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"team-a", "unknown"}, true, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL("team-a, unknown")
+		assert.Nil(t, err)
+		want.LabelFilterPairs = [][]metricsql.LabelFilter{
+			teamAPair,
+			{
+				{Label: "namespace", Value: "unknown"},
+			},
+		}
+		assert.Equal(t, want, got)
+	})
+}
+
+func TestACL_GetUserACL_EnforcedLabel(t *testing.T) {
+	aclTenantA, err := NewACLForLabel("tenant", "a")
+	assert.Nil(t, err)
+
+	aclTenantB, err := NewACLForLabel("tenant", "b")
+	assert.Nil(t, err)
+
+	aclNamespace, err := NewACL("minio")
+	assert.Nil(t, err)
+
+	acls := ACLs{
+		"tenant-a":  aclTenantA,
+		"tenant-b":  aclTenantB,
+		"namespace": aclNamespace,
+	}
+
+	t.Run("Roles with the same label are merged", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"tenant-a", "tenant-b"}, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACLForLabel("tenant", "a, b")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("Unknown roles are enforced on the supplied label (assumed roles enabled)", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"tenant-a", "c"}, true, "tenant")
+		assert.Nil(t, err)
+
+		want, err := NewACLForLabel("tenant", "a, c")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("Roles with different labels cannot be combined", func(t *testing.T) {
+		_, err := acls.GetUserACL([]string{"tenant-a", "namespace"}, false, DefaultLabel)
+		assert.NotNil(t, err)
+
+		_, err = acls.GetUserACL([]string{"tenant-a", "c"}, true, DefaultLabel)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestACL_GetUserACL_Deny(t *testing.T) {
+	aclAllButKubeSystem, err := NewACL("!kube-system, !monitoring")
+	assert.Nil(t, err)
+
+	aclKubeSystem, err := NewACL("kube-system")
+	assert.Nil(t, err)
+
+	aclMinio, err := NewACL("minio")
+	assert.Nil(t, err)
+
+	acls := ACLs{
+		"all-but-kube-system": aclAllButKubeSystem,
+		"kube-system":         aclKubeSystem,
+		"minio":               aclMinio,
+	}
+
+	t.Run("Denied values that are not granted by other roles are kept", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"all-but-kube-system", "minio"}, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL(".*, !kube-system, !monitoring")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("Denied values granted by other roles are dropped", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"all-but-kube-system", "kube-system"}, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL(".*, !monitoring")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("Denied values granted by unknown roles are dropped (assumed roles enabled)", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"all-but-kube-system", "monitoring"}, true, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL(".*, !kube-system")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	})
+}
+
+func TestACL_GetUserACL_ForcedParams(t *testing.T) {
+	aclAdmin, err := NewACL(".*")
+	assert.Nil(t, err)
+
+	aclStrict, err := NewACL("billing")
+	assert.Nil(t, err)
+	aclStrict.ForcedParams = map[string]string{"deny_partial_response": "1"}
+
+	aclAvailable, err := NewACL("sandbox")
+	assert.Nil(t, err)
+	aclAvailable.ForcedParams = map[string]string{"deny_partial_response": "0"}
+
+	aclMinio, err := NewACL("minio")
+	assert.Nil(t, err)
+
+	acls := ACLs{
+		"admin":     aclAdmin,
+		"strict":    aclStrict,
+		"available": aclAvailable,
+		"minio":     aclMinio,
+	}
+
+	t.Run("Single role", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"strict"}, false, DefaultLabel)
+		assert.Nil(t, err)
+		assert.Equal(t, aclStrict, got)
+	})
+
+	t.Run("Parameters are kept when roles are merged", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"strict", "minio"}, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL("billing, minio")
+		assert.Nil(t, err)
+		want.ForcedParams = map[string]string{"deny_partial_response": "1"}
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("Parameters are kept along with full access", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"admin", "strict"}, false, DefaultLabel)
+		assert.Nil(t, err)
+		assert.True(t, got.Fullaccess)
+		assert.Equal(t, map[string]string{"deny_partial_response": "1"}, got.ForcedParams)
+	})
+
+	t.Run("Roles without parameters", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"minio"}, false, DefaultLabel)
+		assert.Nil(t, err)
+		assert.Nil(t, got.ForcedParams)
+	})
+
+	t.Run("Conflicting values", func(t *testing.T) {
+		_, err := acls.GetUserACL([]string{"strict", "available"}, false, DefaultLabel)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestACL_GetUserACL_Write(t *testing.T) {
+	aclAdmin, err := NewACL(".*")
+	assert.Nil(t, err)
+
+	aclIngest, err := NewACL("ingest")
+	assert.Nil(t, err)
+	aclIngest.Write = true
+
+	aclMinio, err := NewACL("minio")
+	assert.Nil(t, err)
+
+	acls := ACLs{
+		"admin":  aclAdmin,
+		"ingest": aclIngest,
+		"minio":  aclMinio,
+	}
+
+	t.Run("Single role", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"ingest"}, false, DefaultLabel)
+		assert.Nil(t, err)
+		assert.Equal(t, aclIngest, got)
+	})
+
+	t.Run("Write is kept when roles are merged", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"ingest", "minio"}, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL("ingest, minio")
+		assert.Nil(t, err)
+		want.Write = true
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("Write is kept along with full access", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"admin", "ingest"}, false, DefaultLabel)
+		assert.Nil(t, err)
+		assert.True(t, got.Fullaccess)
+		assert.True(t, got.Write)
+	})
+
+	t.Run("Full access doesn't imply write", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"admin"}, false, DefaultLabel)
+		assert.Nil(t, err)
+		assert.False(t, got.Write)
+	})
+}
+
 func TestACL_NewACLsFromFile(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -333,6 +671,144 @@ func TestACL_NewACLsFromFile(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "full definition",
+			content: `vendor:
+  namespaces: default
+  source_cidrs:
+    - 10.0.0.0/8
+    - 192.168.1.1`,
+			want: ACLs{
+				"vendor": ACL{
+					Fullaccess: false,
+					LabelFilter: metricsql.LabelFilter{
+						Label:      "namespace",
+						Value:      "default",
+						IsRegexp:   false,
+						IsNegative: false,
+					},
+					RawACL: "default",
+					SourceCIDRs: []netip.Prefix{
+						netip.MustParsePrefix("10.0.0.0/8"),
+						netip.MustParsePrefix("192.168.1.1/32"),
+					},
+				},
+			},
+		},
+		{
+			name: "token binding",
+			content: `vendor:
+  namespaces: default
+  max_token_age: 15m
+  allowed_azp: [grafana, " lfgw "]`,
+			want: ACLs{
+				"vendor": ACL{
+					Fullaccess: false,
+					LabelFilter: metricsql.LabelFilter{
+						Label:      "namespace",
+						Value:      "default",
+						IsRegexp:   false,
+						IsNegative: false,
+					},
+					RawACL:      "default",
+					MaxTokenAge: 15 * time.Minute,
+					AllowedAZPs: []string{"grafana", "lfgw"},
+				},
+			},
+		},
+		{
+			name: "forced params",
+			content: `billing:
+  namespaces: billing
+  forced_params:
+    deny_partial_response: "1"
+    partial_response: "false"`,
+			want: ACLs{
+				"billing": ACL{
+					Fullaccess: false,
+					LabelFilter: metricsql.LabelFilter{
+						Label:      "namespace",
+						Value:      "billing",
+						IsRegexp:   false,
+						IsNegative: false,
+					},
+					RawACL: "billing",
+					ForcedParams: map[string]string{
+						"deny_partial_response": "1",
+						"partial_response":      "false",
+					},
+				},
+			},
+		},
+		{
+			name: "write",
+			content: `ingest:
+  namespaces: ingest
+  write: true`,
+			want: ACLs{
+				"ingest": ACL{
+					Fullaccess: false,
+					LabelFilter: metricsql.LabelFilter{
+						Label:      "namespace",
+						Value:      "ingest",
+						IsRegexp:   false,
+						IsNegative: false,
+					},
+					RawACL: "ingest",
+					Write:  true,
+				},
+			},
+		},
+		{
+			name: "paths",
+			content: `dashboards:
+  namespaces: dashboards
+  paths: [/api/v1/query_range, " /api/v1/query ", /api/v1/label/*]
+  methods: [get]`,
+			want: ACLs{
+				"dashboards": ACL{
+					Fullaccess: false,
+					LabelFilter: metricsql.LabelFilter{
+						Label:      "namespace",
+						Value:      "dashboards",
+						IsRegexp:   false,
+						IsNegative: false,
+					},
+					RawACL:  "dashboards",
+					Paths:   []string{"/api/v1/label/*", "/api/v1/query", "/api/v1/query_range"},
+					Methods: []string{"GET"},
+				},
+			},
+		},
+		{
+			name: "multiple label filters",
+			content: `team:
+  namespaces: team-a, team-b
+  labels:
+    cluster: prod
+    env: .*`,
+			want: ACLs{
+				"team": ACL{
+					Fullaccess: false,
+					LabelFilter: metricsql.LabelFilter{
+						Label:      "namespace",
+						Value:      "team-a|team-b",
+						IsRegexp:   true,
+						IsNegative: false,
+					},
+					RawACL: "team-a, team-b",
+					ExtraLabelFilters: []metricsql.LabelFilter{
+						{
+							Label:      "cluster",
+							Value:      "prod",
+							IsRegexp:   false,
+							IsNegative: false,
+						},
+					},
+					RawExtraACLs: map[string]string{"cluster": "prod"},
+				},
+			},
+		},
 	}
 
 	f, err := os.CreateTemp("", "acl-*.yaml")
@@ -344,25 +820,276 @@ func TestACL_NewACLsFromFile(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			saveACLToFile(t, f, tt.content)
-			got, err := NewACLsFromFile(f.Name())
+			got, err := NewACLsFromFile(f.Name(), DefaultLabel)
 			assert.Nil(t, err)
 			assert.Equal(t, tt.want, got)
 		})
 	}
 
+	t.Run("enforced label", func(t *testing.T) {
+		saveACLToFile(t, f, `team-a: a
+team-b:
+  label: cluster
+  namespaces: b`)
+		got, err := NewACLsFromFile(f.Name(), "tenant")
+		assert.Nil(t, err)
+		assert.Equal(t, "tenant", got["team-a"].LabelFilter.Label)
+		assert.Equal(t, "cluster", got["team-b"].LabelFilter.Label)
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		saveACLToFile(t, f, `team-a:
+  deny:
+    - kube-system
+    - "!monitoring"
+team-b:
+  namespaces: min.*
+  deny: [minio-secret]`)
+		got, err := NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL("!kube-system, !monitoring")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got["team-a"])
+
+		want, err = NewACL("min.*, !minio-secret")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got["team-b"])
+	})
+
+	t.Run("structured definitions", func(t *testing.T) {
+		saveACLToFile(t, f, `version: 2
+roles:
+  admin:
+    comment: SRE on-call
+    fullaccess: true
+  team-a:
+    comment: Team A, owned by @team-a
+    namespaces: team-a
+    extra_labels:
+      cluster: prod
+  team-b:
+    namespaces: team-b
+    labels:
+      cluster: prod`)
+		got, err := NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL(".*")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got["admin"])
+
+		want, err = NewACLWithLabels(DefaultLabel, "team-a", map[string]string{"cluster": "prod"})
+		assert.Nil(t, err)
+		assert.Equal(t, want, got["team-a"])
+
+		want, err = NewACLWithLabels(DefaultLabel, "team-b", map[string]string{"cluster": "prod"})
+		assert.Nil(t, err)
+		assert.Equal(t, want, got["team-b"])
+	})
+
+	t.Run("namespace lists", func(t *testing.T) {
+		saveACLToFile(t, f, `version: 2
+roles:
+  team-a:
+    - ns1
+    - ns-.*
+  team-b:
+    namespaces: [ns1, ns-.*]
+    deny: [ns-secret]
+  team-c: ns1, ns-.*`)
+		got, err := NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL("ns1, ns-.*")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got["team-a"])
+		assert.Equal(t, want, got["team-c"])
+
+		want, err = NewACL("ns1, ns-.*, !ns-secret")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got["team-b"])
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		saveACLToFile(t, f, `version: 2
+roles:
+  kube-metrics:
+    namespaces: team-a
+    metrics: [kube_.*, container_.*]
+  kube-metrics-in-prod:
+    namespaces: team-a
+    metrics: kube_.*, container_.*
+    labels:
+      cluster: prod`)
+		got, err := NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACLWithLabels(DefaultLabel, "team-a", map[string]string{"__name__": "kube_.*, container_.*"})
+		assert.Nil(t, err)
+		assert.Equal(t, want, got["kube-metrics"])
+
+		want, err = NewACLWithLabels(DefaultLabel, "team-a", map[string]string{"__name__": "kube_.*, container_.*", "cluster": "prod"})
+		assert.Nil(t, err)
+		assert.Equal(t, want, got["kube-metrics-in-prod"])
+	})
+
+	t.Run("extends", func(t *testing.T) {
+		saveACLToFile(t, f, `version: 2
+roles:
+  dev-team:
+    namespaces: [dev-.*]
+    deny: [dev-secret]
+  dev-team-extended:
+    extends: dev-team
+    namespaces: [staging-.*]
+  dev-team-lead:
+    extends: dev-team-extended
+    namespaces: prod-app
+  dev-team-copy:
+    extends: dev-team
+  tenant-a:
+    label: tenant
+    namespaces: a
+  tenant-a-staging:
+    extends: tenant-a
+    namespaces: a-staging
+  admin:
+    fullaccess: true
+  admin-without-secrets:
+    extends: admin
+    deny: [secrets]`)
+		got, err := NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.Nil(t, err)
+
+		tests := []struct {
+			role   string
+			label  string
+			rawACL string
+		}{
+			{role: "dev-team-extended", label: DefaultLabel, rawACL: "dev-.*, staging-.*, !dev-secret"},
+			{role: "dev-team-lead", label: DefaultLabel, rawACL: "dev-.*, staging-.*, prod-app, !dev-secret"},
+			{role: "dev-team-copy", label: DefaultLabel, rawACL: "dev-.*, !dev-secret"},
+			{role: "tenant-a-staging", label: "tenant", rawACL: "a, a-staging"},
+			{role: "admin-without-secrets", label: DefaultLabel, rawACL: ".*, !secrets"},
+		}
+
+		for _, tt := range tests {
+			want, err := NewACLForLabel(tt.label, tt.rawACL)
+			assert.Nil(t, err)
+			assert.Equal(t, want, got[tt.role], tt.role)
+		}
+	})
+
 	t.Run("empty path", func(t *testing.T) {
-		got, err := NewACLsFromFile("")
+		got, err := NewACLsFromFile("", DefaultLabel)
 		assert.Nil(t, err)
 		assert.Equal(t, ACLs{}, got)
 	})
 
 	t.Run("incorrect ACL", func(t *testing.T) {
 		saveACLToFile(t, f, "test-role:")
-		_, err := NewACLsFromFile(f.Name())
+		_, err := NewACLsFromFile(f.Name(), DefaultLabel)
 		assert.NotNil(t, err)
 
 		saveACLToFile(t, f, "test-role: a b")
-		_, err = NewACLsFromFile(f.Name())
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, source_cidrs: [vpn]}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {source_cidrs: [10.0.0.0/8]}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, forced_params: {query: up}}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, paths: [api/v1/query]}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, paths: [/api/*/query]}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, methods: [FETCH]}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, max_token_age: 15}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, max_token_age: -1m}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, allowed_azp: [\"\"]}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, labels: {namespace: minio}}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {label: cluster, namespaces: default, labels: {cluster: prod}}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, labels: {cluster: \"\"}}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {extends: unknown, namespaces: default}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {extends: test-role, namespaces: default}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "role-a: {extends: role-c, namespaces: a}\nrole-b: {extends: role-a, namespaces: b}\nrole-c: {extends: role-b, namespaces: c}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "role-a: {label: tenant, namespaces: a}\nrole-b: {extends: role-a, label: cluster, namespaces: b}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: []")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: [[default]]")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: [{name: default}]}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {fullaccess: true, namespaces: default}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {fullaccess: true, deny: [kube-system]}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, labels: {cluster: prod}, extra_labels: {env: prod}}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {namespaces: default, metrics: kube_.*, labels: {__name__: up}}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
+		assert.NotNil(t, err)
+
+		saveACLToFile(t, f, "test-role: {fullaccess: true, metrics: kube_.*}")
+		_, err = NewACLsFromFile(f.Name(), DefaultLabel)
 		assert.NotNil(t, err)
 	})
 
@@ -0,0 +1,174 @@
+package querymodifier
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+var (
+	// ErrNotAggregated is returned for queries exposing individual series to aggregation-only ACLs.
+	ErrNotAggregated = errors.New("only aggregated queries are allowed for the roles")
+	// ErrMixedAggregationOnly is returned for aggregation-only roles combined with regular ones, as the merged ACL would expose individual series of the namespaces of aggregation-only roles.
+	ErrMixedAggregationOnly = errors.New("aggregation-only roles cannot be combined with regular roles")
+)
+
+// aggregationFuncs lists aggregate functions that hide individual series, selectors of aggregation-only ACLs must be wrapped into one of them. Functions like max or topk are not listed, as they return values of individual series.
+var aggregationFuncs = map[string]bool{
+	"sum":   true,
+	"avg":   true,
+	"count": true,
+}
+
+// isAggregation returns true if the expression is one of aggregationFuncs.
+func isAggregation(expr metricsql.Expr) (*metricsql.AggrFuncExpr, bool) {
+	ae, ok := expr.(*metricsql.AggrFuncExpr)
+	if !ok || !aggregationFuncs[strings.ToLower(ae.Name)] {
+		return nil, false
+	}
+
+	return ae, true
+}
+
+// checkAggregation returns ErrNotAggregated if an aggregation-only ACL is used with a query containing a series selector outside of aggregationFuncs (e.g. rate(http_requests_total[5m]) or max(up)).
+func (qm *QueryModifier) checkAggregation(expr metricsql.Expr) error {
+	if !qm.ACL.AggregationOnly {
+		return nil
+	}
+
+	return checkAggregated(expr)
+}
+
+// checkAggregated walks through the expression until it finds an aggregation, see checkAggregation.
+func checkAggregated(expr metricsql.Expr) error {
+	if _, ok := isAggregation(expr); ok {
+		return nil
+	}
+
+	switch e := expr.(type) {
+	case *metricsql.MetricExpr:
+		return notAggregatedError(e)
+	case *metricsql.RollupExpr:
+		return checkAggregated(e.Expr)
+	case *metricsql.FuncExpr:
+		return checkAggregatedArgs(e.Args)
+	case *metricsql.AggrFuncExpr:
+		return checkAggregatedArgs(e.Args)
+	case *metricsql.BinaryOpExpr:
+		return checkAggregatedArgs([]metricsql.Expr{e.Left, e.Right})
+	case *metricsql.NumberExpr, *metricsql.StringExpr, *metricsql.DurationExpr:
+		return nil
+	default:
+		// Unknown expressions are allowed only if they contain no selectors at all
+		var err error
+		metricsql.VisitAll(expr, func(expr metricsql.Expr) {
+			if me, ok := expr.(*metricsql.MetricExpr); ok && err == nil {
+				err = notAggregatedError(me)
+			}
+		})
+		return err
+	}
+}
+
+// checkAggregatedArgs calls checkAggregated for each of the arguments.
+func checkAggregatedArgs(args []metricsql.Expr) error {
+	for _, arg := range args {
+		if err := checkAggregated(arg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notAggregatedError returns ErrNotAggregated for the selector.
+func notAggregatedError(me *metricsql.MetricExpr) error {
+	return fmt.Errorf("%w: %s is not aggregated through sum, avg or count", ErrNotAggregated, me.AppendString(nil))
+}
+
+// mergeAggregationOnly returns true if all of the known roles are aggregation-only along with the lowest MinSeries of them. Returns false if none of the roles is known or any of them has full access (it can see individual series anyway). ErrMixedAggregationOnly is returned if aggregation-only roles are combined with other regular roles, as the restriction cannot be enforced per namespace.
+func (a ACLs) mergeAggregationOnly(roles []string) (bool, int, error) {
+	aggregationOnly := 0
+	regular := 0
+	minSeries := 0
+
+	for _, role := range roles {
+		acl, exists := a[role]
+		if !exists {
+			continue
+		}
+
+		if acl.Fullaccess {
+			return false, 0, nil
+		}
+
+		if !acl.AggregationOnly {
+			regular++
+			continue
+		}
+
+		if aggregationOnly == 0 || acl.MinSeries < minSeries {
+			minSeries = acl.MinSeries
+		}
+		aggregationOnly++
+	}
+
+	if aggregationOnly > 0 && regular > 0 {
+		return false, 0, ErrMixedAggregationOnly
+	}
+
+	return aggregationOnly > 0, minSeries, nil
+}
+
+// enforceMinSeries makes the outermost aggregations of the expression return only groups aggregating at least ACL.MinSeries series, e.g. sum(x) by (job) is turned into sum(x) by (job) and (count(x) by (job) >= 5). Aggregations over fewer series would expose values of individual series.
+func (qm *QueryModifier) enforceMinSeries(expr metricsql.Expr) metricsql.Expr {
+	if !qm.ACL.AggregationOnly || qm.ACL.MinSeries <= 1 {
+		return expr
+	}
+
+	return wrapAggregations(expr, qm.ACL.MinSeries)
+}
+
+// wrapAggregations implements enforceMinSeries for the expression and its children.
+func wrapAggregations(expr metricsql.Expr, minSeries int) metricsql.Expr {
+	if ae, ok := isAggregation(expr); ok {
+		args := make([]metricsql.Expr, 0, len(ae.Args))
+		for _, arg := range ae.Args {
+			args = append(args, metricsql.Clone(arg))
+		}
+
+		return &metricsql.BinaryOpExpr{
+			Op:   "and",
+			Left: ae,
+			Right: &metricsql.BinaryOpExpr{
+				Op: ">=",
+				Left: &metricsql.AggrFuncExpr{
+					Name:     "count",
+					Args:     args,
+					Modifier: ae.Modifier,
+				},
+				Right: &metricsql.NumberExpr{N: float64(minSeries)},
+			},
+		}
+	}
+
+	switch e := expr.(type) {
+	case *metricsql.RollupExpr:
+		e.Expr = wrapAggregations(e.Expr, minSeries)
+	case *metricsql.FuncExpr:
+		for i, arg := range e.Args {
+			e.Args[i] = wrapAggregations(arg, minSeries)
+		}
+	case *metricsql.AggrFuncExpr:
+		for i, arg := range e.Args {
+			e.Args[i] = wrapAggregations(arg, minSeries)
+		}
+	case *metricsql.BinaryOpExpr:
+		e.Left = wrapAggregations(e.Left, minSeries)
+		e.Right = wrapAggregations(e.Right, minSeries)
+	}
+
+	return expr
+}
@@ -0,0 +1,193 @@
+package querymodifier
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryModifier_aggregationOnly(t *testing.T) {
+	acl, err := NewACL("minio")
+	assert.Nil(t, err)
+	acl.AggregationOnly = true
+
+	tests := []struct {
+		name      string
+		minSeries int
+		param     string
+		query     string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:  "aggregation",
+			param: "query",
+			query: `sum(rate(http_requests_total[5m])) by (job)`,
+			want:  `sum(rate(http_requests_total{namespace="minio"}[5m])) by (job)`,
+		},
+		{
+			name:  "aggregations in a binary expression",
+			param: "query",
+			query: `sum(errors_total) / count(up) * 100`,
+			want:  `(sum(errors_total{namespace="minio"}) / count(up{namespace="minio"})) * 100`,
+		},
+		{
+			name:  "functions of aggregations",
+			param: "query",
+			query: `max_over_time(sum(up)[1h:])`,
+			want:  `max_over_time(sum(up{namespace="minio"})[1h:])`,
+		},
+		{
+			name:    "raw selector",
+			param:   "query",
+			query:   `up`,
+			wantErr: true,
+		},
+		{
+			name:    "rollup of a raw selector",
+			param:   "query",
+			query:   `rate(http_requests_total[5m])`,
+			wantErr: true,
+		},
+		{
+			name:    "aggregation exposing individual series",
+			param:   "query",
+			query:   `topk(5, http_requests_total)`,
+			wantErr: true,
+		},
+		{
+			name:    "raw selector next to an aggregation",
+			param:   "query",
+			query:   `sum(up) + up`,
+			wantErr: true,
+		},
+		{
+			name:    "series selector",
+			param:   "match[]",
+			query:   `up`,
+			wantErr: true,
+		},
+		{
+			name:      "minimum number of series",
+			minSeries: 5,
+			param:     "query",
+			query:     `max(sum(up) by (job))`,
+			want:      `max(sum(up{namespace="minio"}) by (job) and (count(up{namespace="minio"}) by (job) >= 5))`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			acl := acl
+			acl.MinSeries = tt.minSeries
+			qm := QueryModifier{ACL: acl}
+
+			got, err := qm.GetModifiedEncodedURLValues(url.Values{tt.param: {tt.query}})
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrNotAggregated)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, url.Values{tt.param: {tt.want}}.Encode(), got)
+		})
+	}
+}
+
+func TestACLs_aggregationOnly(t *testing.T) {
+	t.Run("Definitions", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			content string
+			wantErr bool
+		}{
+			{
+				name:    "valid",
+				content: "business:\n  namespaces: payments\n  aggregation_only: true\n  min_series: 5\n",
+			},
+			{
+				name:    "min_series without aggregation_only",
+				content: "business:\n  namespaces: payments\n  min_series: 5\n",
+				wantErr: true,
+			},
+			{
+				name:    "negative min_series",
+				content: "business:\n  namespaces: payments\n  aggregation_only: true\n  min_series: -1\n",
+				wantErr: true,
+			},
+			{
+				name:    "full access",
+				content: "business:\n  fullaccess: true\n  aggregation_only: true\n",
+				wantErr: true,
+			},
+		}
+
+		for _, tt := range tests {
+			tt := tt
+			t.Run(tt.name, func(t *testing.T) {
+				_, _, err := NewACLsFromBytes([]byte(tt.content), "")
+				if tt.wantErr {
+					assert.NotNil(t, err)
+					return
+				}
+				assert.Nil(t, err)
+			})
+		}
+	})
+
+	acls, _, err := NewACLsFromBytes([]byte(`
+business:
+  namespaces: payments
+  aggregation_only: true
+  min_series: 10
+analysts:
+  namespaces: billing
+  aggregation_only: true
+  min_series: 3
+developer: payments
+admin: .*
+`), "")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name          string
+		roles         []string
+		wantAggregate bool
+		wantMinSeries int
+		wantErr       error
+	}{
+		{
+			name:          "aggregation-only roles are merged",
+			roles:         []string{"business", "analysts"},
+			wantAggregate: true,
+			wantMinSeries: 3,
+		},
+		{
+			name:          "unknown roles are ignored",
+			roles:         []string{"business", "payments"},
+			wantAggregate: true,
+			wantMinSeries: 10,
+		},
+		{
+			name:    "regular roles cannot be combined with aggregation-only ones",
+			roles:   []string{"business", "developer"},
+			wantErr: ErrMixedAggregationOnly,
+		},
+		{
+			name:  "full access lifts the restriction",
+			roles: []string{"business", "admin"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := acls.GetUserACL(tt.roles, true, "")
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantAggregate, acl.AggregationOnly)
+			assert.Equal(t, tt.wantMinSeries, acl.MinSeries)
+		})
+	}
+}
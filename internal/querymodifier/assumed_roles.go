@@ -0,0 +1,87 @@
+package querymodifier
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AssumedRoles restricts unknown roles that can be assumed as raw ACLs, so unrelated roles present in an IdP don't turn into ACLs. With Prefix, only roles starting with it are assumed, and the prefix is stripped (e.g. ns:payments gives access to payments). With Pattern, only roles fully matching it are assumed, and the first capture group is used as the raw ACL (the whole role if there are no groups).
+type AssumedRoles struct {
+	Prefix  string
+	Pattern *regexp.Regexp
+}
+
+// NewAssumedRoles returns AssumedRoles for the prefix and the pattern, the pattern is fully anchored. Only one of them can be set.
+func NewAssumedRoles(prefix, pattern string) (AssumedRoles, error) {
+	if prefix != "" && pattern != "" {
+		return AssumedRoles{}, fmt.Errorf("assumed roles can be restricted either by a prefix or by a pattern")
+	}
+
+	ar := AssumedRoles{
+		Prefix: prefix,
+	}
+
+	if pattern != "" {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return AssumedRoles{}, fmt.Errorf("assumed roles pattern is not a valid regular expression: %s", err)
+		}
+		ar.Pattern = re
+	}
+
+	return ar, nil
+}
+
+// IsRestricted returns true if not all unknown roles can be assumed.
+func (ar AssumedRoles) IsRestricted() bool {
+	return ar.Prefix != "" || ar.Pattern != nil
+}
+
+// RawACL returns the raw ACL an unknown role is assumed as, false if the role cannot be assumed.
+func (ar AssumedRoles) RawACL(role string) (string, bool) {
+	switch {
+	case ar.Pattern != nil:
+		match := ar.Pattern.FindStringSubmatch(role)
+		if match == nil {
+			return "", false
+		}
+		if len(match) > 1 {
+			return match[1], match[1] != ""
+		}
+		return role, true
+	case ar.Prefix != "":
+		rawACL, ok := strings.CutPrefix(role, ar.Prefix)
+		return rawACL, ok && rawACL != ""
+	default:
+		return role, true
+	}
+}
+
+// WithAssumedRoles returns ACLs for the given roles (see ForRoles) extended with definitions of unknown roles that can be assumed, so the result can be passed to GetUserACL with assumed roles disabled. Assumed definitions are kept under original role names, so a stripped role can never be confused with a known one (e.g. ns:admin with admin). Unknown roles that cannot be assumed are skipped. Assumed definitions are enforced on enforcedLabel (DefaultLabel if empty).
+func (a ACLs) WithAssumedRoles(roles []string, ar AssumedRoles, enforcedLabel string) (ACLs, error) {
+	if enforcedLabel == "" {
+		enforcedLabel = DefaultLabel
+	}
+
+	result := a.ForRoles(roles)
+
+	for _, role := range roles {
+		if _, exists := result[role]; exists {
+			continue
+		}
+
+		rawACL, ok := ar.RawACL(role)
+		if !ok {
+			continue
+		}
+
+		acl, err := NewACLForLabel(enforcedLabel, rawACL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to assume %s role: %w", role, err)
+		}
+		result[role] = acl
+	}
+
+	return result, nil
+}
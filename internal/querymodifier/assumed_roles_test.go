@@ -0,0 +1,90 @@
+package querymodifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAssumedRoles(t *testing.T) {
+	_, err := NewAssumedRoles("ns:", "ns-(.*)")
+	assert.NotNil(t, err)
+
+	_, err = NewAssumedRoles("", "ns-(")
+	assert.NotNil(t, err)
+
+	ar, err := NewAssumedRoles("", "")
+	assert.Nil(t, err)
+	assert.False(t, ar.IsRestricted())
+}
+
+func TestACLs_WithAssumedRoles(t *testing.T) {
+	aclAdmin, err := NewACL(".*")
+	assert.Nil(t, err)
+
+	aclTeamA, err := NewACL("team-a")
+	assert.Nil(t, err)
+
+	acls := ACLs{
+		"admin":  aclAdmin,
+		"team-a": aclTeamA,
+	}
+
+	t.Run("Prefix", func(t *testing.T) {
+		ar, err := NewAssumedRoles("ns:", "")
+		assert.Nil(t, err)
+
+		roles := []string{"team-a", "ns:payments", "offline_access", "ns:"}
+		got, err := acls.WithAssumedRoles(roles, ar, DefaultLabel)
+		assert.Nil(t, err)
+		assert.Len(t, got, 2)
+
+		acl, err := got.GetUserACL(roles, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL("team-a, payments")
+		assert.Nil(t, err)
+		assert.Equal(t, want, acl)
+	})
+
+	t.Run("Stripped role is not confused with a known one", func(t *testing.T) {
+		ar, err := NewAssumedRoles("ns:", "")
+		assert.Nil(t, err)
+
+		got, err := acls.WithAssumedRoles([]string{"ns:admin"}, ar, DefaultLabel)
+		assert.Nil(t, err)
+
+		acl, err := got.GetUserACL([]string{"ns:admin"}, false, DefaultLabel)
+		assert.Nil(t, err)
+		assert.False(t, acl.Fullaccess)
+		assert.Equal(t, "admin", acl.RawACL)
+	})
+
+	t.Run("Pattern", func(t *testing.T) {
+		ar, err := NewAssumedRoles("", "k8s-ns-(.*)-viewer")
+		assert.Nil(t, err)
+
+		roles := []string{"k8s-ns-billing-viewer", "k8s-ns-billing-editor", "uma_authorization"}
+		got, err := acls.WithAssumedRoles(roles, ar, "tenant")
+		assert.Nil(t, err)
+		assert.Len(t, got, 1)
+
+		acl, err := got.GetUserACL(roles, false, "tenant")
+		assert.Nil(t, err)
+
+		want, err := NewACLForLabel("tenant", "billing")
+		assert.Nil(t, err)
+		assert.Equal(t, want, acl)
+	})
+
+	t.Run("No matching roles", func(t *testing.T) {
+		ar, err := NewAssumedRoles("ns:", "")
+		assert.Nil(t, err)
+
+		got, err := acls.WithAssumedRoles([]string{"offline_access"}, ar, DefaultLabel)
+		assert.Nil(t, err)
+
+		_, err = got.GetUserACL([]string{"offline_access"}, false, DefaultLabel)
+		assert.ErrorIs(t, err, ErrNoMatchingRoles)
+	})
+}
@@ -0,0 +1,23 @@
+package querymodifier
+
+import "time"
+
+// mergeResponseTimeBudgets returns the largest response time budget of the known roles, so a user is never restricted more than by any of their roles. Returns 0 (no restrictions) if any of them has no budget or none of the roles is known.
+func (a ACLs) mergeResponseTimeBudgets(roles []string) time.Duration {
+	var merged time.Duration
+
+	for _, role := range roles {
+		acl, exists := a[role]
+		if !exists {
+			continue
+		}
+
+		if acl.ResponseTimeBudget <= 0 {
+			return 0
+		}
+
+		merged = max(merged, acl.ResponseTimeBudget)
+	}
+
+	return merged
+}
@@ -0,0 +1,64 @@
+package querymodifier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACLs_mergeResponseTimeBudgets(t *testing.T) {
+	acls := ACLs{
+		"low-tier":  ACL{RawACL: "sandbox", ResponseTimeBudget: 5 * time.Second},
+		"mid-tier":  ACL{RawACL: "team-a", ResponseTimeBudget: 30 * time.Second},
+		"unlimited": ACL{RawACL: "minio"},
+	}
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  time.Duration
+	}{
+		{
+			name:  "Single role",
+			roles: []string{"low-tier"},
+			want:  5 * time.Second,
+		},
+		{
+			name:  "The largest budget wins",
+			roles: []string{"low-tier", "mid-tier"},
+			want:  30 * time.Second,
+		},
+		{
+			name:  "Role without a budget",
+			roles: []string{"low-tier", "unlimited"},
+			want:  0,
+		},
+		{
+			name:  "Unknown roles are ignored",
+			roles: []string{"low-tier", "unknown"},
+			want:  5 * time.Second,
+		},
+		{
+			name:  "No known roles",
+			roles: []string{"unknown"},
+			want:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, acls.mergeResponseTimeBudgets(tt.roles))
+		})
+	}
+}
+
+func TestACL_NewACLsFromBytes_ResponseTimeBudget(t *testing.T) {
+	acls, _, err := NewACLsFromBytes([]byte("low-tier:\n  namespaces: sandbox\n  response_time_budget: 5s\n"), "")
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Second, acls["low-tier"].ResponseTimeBudget)
+
+	_, _, err = NewACLsFromBytes([]byte("low-tier:\n  namespaces: sandbox\n  response_time_budget: -5s\n"), "")
+	assert.EqualError(t, err, "low-tier role contains negative response_time_budget: -5s")
+}
@@ -0,0 +1,33 @@
+package querymodifier
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClientKeyPrefix marks ACLs assigned to OIDC clients (defined under clients in acl.yaml), so service accounts authenticating with client credentials (e.g. Grafana, vmalert) can be granted access without roles. See UserKeyPrefix for details on how such ACLs are used.
+const ClientKeyPrefix = "client:"
+
+// clientKey returns an ACL key for a client definition from acl.yaml.
+func clientKey(client string) (string, error) {
+	client = strings.TrimSpace(client)
+	if client == "" {
+		return "", fmt.Errorf("client ID cannot be empty")
+	}
+
+	return ClientKeyPrefix + client, nil
+}
+
+// ClientRoles returns the key of a client ACL matching the client ID, so it can be passed to GetUserACL along with roles. Nothing is returned if there's no such ACL.
+func (a ACLs) ClientRoles(clientID string) []string {
+	if clientID == "" {
+		return nil
+	}
+
+	key := ClientKeyPrefix + clientID
+	if _, exists := a[key]; !exists {
+		return nil
+	}
+
+	return []string{key}
+}
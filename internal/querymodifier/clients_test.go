@@ -0,0 +1,33 @@
+package querymodifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACLs_ClientRoles(t *testing.T) {
+	acls, _, err := NewACLsFromBytes([]byte(`version: 2
+roles:
+  monitoring: monitoring
+clients:
+  vmalert:
+    extends: monitoring
+    namespaces: alerting
+`), DefaultLabel)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"client:vmalert"}, acls.ClientRoles("vmalert"))
+	assert.Nil(t, acls.ClientRoles("grafana"))
+	assert.Nil(t, acls.ClientRoles(""))
+
+	got, err := acls.GetUserACL(acls.ClientRoles("vmalert"), false, DefaultLabel)
+	assert.Nil(t, err)
+
+	want, err := NewACL("monitoring, alerting")
+	assert.Nil(t, err)
+	assert.Equal(t, want, got)
+
+	_, _, err = NewACLsFromBytes([]byte("version: 2\nroles:\n  client:vmalert: a\n"), DefaultLabel)
+	assert.NotNil(t, err)
+}
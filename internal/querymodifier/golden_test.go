@@ -0,0 +1,192 @@
+package querymodifier
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update expected queries in golden files (testdata/queries/*.txt)")
+
+// goldenError marks an expected rewrite error in golden files, messages are not compared as they come from metricsql
+const goldenError = "error"
+
+// goldenFile is a golden file with rewrite cases. The file starts with a header of "key: value" lines (acl, and optionally label, param, deduplication, optimize, unlabeled, unlabeled_policy), which is followed by an empty line. Then every case is a pair of lines separated from other cases by empty lines: the original query and the expected rewritten one ("error" if the rewrite should fail). Several rewritten values (e.g. match[] split per pair) are joined with " || ". Lines starting with # are comments.
+type goldenFile struct {
+	lines  []string
+	header map[string]string
+	cases  []goldenCase
+}
+
+// goldenCase is a single rewrite case, expectedLine is the index of the expected query in goldenFile.lines.
+type goldenCase struct {
+	query        string
+	expected     string
+	expectedLine int
+}
+
+// parseGoldenFile reads a golden file.
+func parseGoldenFile(path string) (*goldenFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gf := &goldenFile{
+		header: make(map[string]string),
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		gf.lines = append(gf.lines, scanner.Text())
+	}
+
+	inHeader := true
+	var block []int
+
+	flush := func() error {
+		defer func() { block = nil }()
+
+		switch {
+		case len(block) == 0:
+			return nil
+		case len(block) != 2:
+			return fmt.Errorf("%s:%d: a case must consist of a query and an expected query", path, block[0]+1)
+		}
+
+		gf.cases = append(gf.cases, goldenCase{
+			query:        gf.lines[block[0]],
+			expected:     gf.lines[block[1]],
+			expectedLine: block[1],
+		})
+		return nil
+	}
+
+	for i, line := range gf.lines {
+		switch {
+		case strings.HasPrefix(line, "#"):
+			continue
+		case strings.TrimSpace(line) == "":
+			inHeader = false
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case inHeader:
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: expected a key: value header", path, i+1)
+			}
+			gf.header[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		default:
+			block = append(block, i)
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return gf, nil
+}
+
+// queryModifier returns a QueryModifier configured by the header of the golden file.
+func (gf *goldenFile) queryModifier() (QueryModifier, string, error) {
+	label := gf.header["label"]
+	if label == "" {
+		label = DefaultLabel
+	}
+
+	acl, err := NewACLForLabel(label, gf.header["acl"])
+	if err != nil {
+		return QueryModifier{}, "", err
+	}
+
+	unlabeled, err := NewUnlabeledMetricsRegexp(strings.Split(gf.header["unlabeled"], ","))
+	if err != nil {
+		return QueryModifier{}, "", err
+	}
+
+	qm := QueryModifier{
+		ACL:              acl,
+		UnlabeledMetrics: unlabeled,
+		UnlabeledPolicy:  gf.header["unlabeled_policy"],
+	}
+
+	for key, target := range map[string]*bool{"deduplication": &qm.EnableDeduplication, "optimize": &qm.OptimizeExpressions} {
+		if value, ok := gf.header[key]; ok {
+			if *target, err = strconv.ParseBool(value); err != nil {
+				return QueryModifier{}, "", fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	param := gf.header["param"]
+	if param == "" {
+		param = "query"
+	}
+
+	return qm, param, nil
+}
+
+// rewrite returns the rewritten query in the golden file format.
+func rewrite(qm QueryModifier, param, query string) string {
+	encoded, err := qm.GetModifiedEncodedURLValues(url.Values{param: []string{query}})
+	if err != nil {
+		return goldenError
+	}
+
+	values, err := url.ParseQuery(encoded)
+	if err != nil {
+		return goldenError
+	}
+
+	return strings.Join(values[param], " || ")
+}
+
+func TestQueryModifier_golden(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "queries", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			gf, err := parseGoldenFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			qm, param, err := gf.queryModifier()
+			if err != nil {
+				t.Fatalf("%s: %s", path, err)
+			}
+
+			for _, c := range gf.cases {
+				got := rewrite(qm, param, c.query)
+
+				if *update {
+					gf.lines[c.expectedLine] = got
+					continue
+				}
+
+				assert.Equal(t, c.expected, got, "%s:%d: %s", path, c.expectedLine, c.query)
+			}
+
+			if *update {
+				if err := os.WriteFile(path, []byte(strings.Join(gf.lines, "\n")+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package querymodifier
 
 import (
+	"net/netip"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -38,3 +39,30 @@ func TestACL_ToSlice(t *testing.T) {
 		assert.NotNil(t, err)
 	})
 }
+
+func TestACL_ToPrefixes(t *testing.T) {
+	t.Run("CIDRs and plain addresses", func(t *testing.T) {
+		want := []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("192.168.1.1/32"),
+			netip.MustParsePrefix("2001:db8::/32"),
+		}
+		got, err := toPrefixes([]string{"10.1.2.3/8", " 192.168.1.1 ", "2001:db8::/32"})
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("(empty values)", func(t *testing.T) {
+		got, err := toPrefixes(nil)
+		assert.Nil(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("invalid CIDR", func(t *testing.T) {
+		_, err := toPrefixes([]string{"10.0.0.0/33"})
+		assert.NotNil(t, err)
+
+		_, err = toPrefixes([]string{"vpn"})
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,53 @@
+package querymodifier
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// knownMethods lists HTTP methods that can be used in methods of role definitions.
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// newMethods validates and normalizes (upper-cases) a methods entry of a role definition.
+func newMethods(role string, methods []string) ([]string, error) {
+	if len(methods) == 0 {
+		return nil, nil
+	}
+
+	normalized := make([]string, 0, len(methods))
+	for _, m := range methods {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if !knownMethods[m] {
+			return nil, fmt.Errorf("%s role contains an invalid methods entry: %q", role, m)
+		}
+		normalized = append(normalized, m)
+	}
+	sort.Strings(normalized)
+
+	return normalized, nil
+}
+
+// AllowsMethod returns true if the ACL doesn't restrict methods or the method is one of its methods. HEAD is allowed along with GET.
+func (acl ACL) AllowsMethod(method string) bool {
+	if len(acl.Methods) == 0 {
+		return true
+	}
+
+	for _, allowed := range acl.Methods {
+		if method == allowed || (method == http.MethodHead && allowed == http.MethodGet) {
+			return true
+		}
+	}
+
+	return false
+}
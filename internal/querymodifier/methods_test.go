@@ -0,0 +1,30 @@
+package querymodifier
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMethods(t *testing.T) {
+	got, err := newMethods("test-role", []string{"post", " GET "})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{http.MethodGet, http.MethodPost}, got)
+
+	got, err = newMethods("test-role", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, got)
+
+	_, err = newMethods("test-role", []string{"FETCH"})
+	assert.NotNil(t, err)
+}
+
+func TestACL_AllowsMethod(t *testing.T) {
+	acl := ACL{Methods: []string{http.MethodGet}}
+
+	assert.True(t, acl.AllowsMethod(http.MethodGet))
+	assert.True(t, acl.AllowsMethod(http.MethodHead))
+	assert.False(t, acl.AllowsMethod(http.MethodPost))
+	assert.True(t, ACL{}.AllowsMethod(http.MethodDelete))
+}
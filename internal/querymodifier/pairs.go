@@ -0,0 +1,199 @@
+package querymodifier
+
+import (
+	"strings"
+
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// ClusterLabel is the label the first part of paired definitions (cluster:namespace) is enforced on
+const ClusterLabel = "cluster"
+
+// isPair returns true if the value is a cluster:namespace pair. A colon within a regexp group (e.g. (?:a|b)) doesn't make a pair.
+func isPair(value string) bool {
+	cluster, _, ok := strings.Cut(value, ":")
+	return ok && !strings.Contains(cluster, "(")
+}
+
+// hasPairs returns true if any of the values is a cluster:namespace pair.
+func hasPairs(values []string) bool {
+	for _, v := range values {
+		if isPair(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newLabelFilterPairs returns label filter pairs for allowed values along with namespace parts of the values. A pair restricts both ClusterLabel and label, while a plain value restricts only label (in any cluster). Pairs matching everything are not returned, so nil means there are no restrictions at all.
+func newLabelFilterPairs(label string, values []string) ([][]metricsql.LabelFilter, []string, error) {
+	pairs := make([][]metricsql.LabelFilter, 0, len(values))
+	namespaces := make([]string, 0, len(values))
+
+	for _, v := range values {
+		cluster, namespace := ".*", v
+		if isPair(v) {
+			cluster, namespace, _ = strings.Cut(v, ":")
+		}
+		namespaces = append(namespaces, namespace)
+
+		pair := make([]metricsql.LabelFilter, 0, 2)
+		for _, part := range []struct{ label, value string }{{ClusterLabel, cluster}, {label, namespace}} {
+			lf, _, err := newLabelFilter(part.label, part.value)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if !isFullaccessLF(lf) {
+				pair = append(pair, lf)
+			}
+		}
+
+		// Everything is allowed in any cluster
+		if len(pair) == 0 {
+			return nil, []string{".*"}, nil
+		}
+
+		pairs = appendPair(pairs, pair)
+	}
+
+	return pairs, namespaces, nil
+}
+
+// appendPair appends the label filter pair unless the same pair is already present.
+func appendPair(pairs [][]metricsql.LabelFilter, pair []metricsql.LabelFilter) [][]metricsql.LabelFilter {
+	key := pairKey(pair)
+	for _, p := range pairs {
+		if pairKey(p) == key {
+			return pairs
+		}
+	}
+
+	return append(pairs, pair)
+}
+
+// pairKey returns a string representation of the label filter pair, so pairs can be compared.
+func pairKey(pair []metricsql.LabelFilter) string {
+	var key []byte
+	for _, lf := range pair {
+		key = lf.AppendString(key)
+		key = append(key, ',')
+	}
+
+	return string(key)
+}
+
+// expandLabelFilterPairs replaces every selector with a union (or) of its copies restricted by each of the label filter pairs. Rollup functions (e.g. rate) are applied to each copy separately, since they require a selector as an argument. It's exact as rollup functions are calculated per series, and series matched by more than one pair (e.g. pairs of merged roles) are returned only once by or.
+func (qm *QueryModifier) expandLabelFilterPairs(expr metricsql.Expr) metricsql.Expr {
+	if me, wrap := selectorOf(expr); me != nil {
+		if qm.skipsUnlabeledMetric(me) {
+			return expr
+		}
+		return qm.unionOfPairs(me, wrap)
+	}
+
+	switch e := expr.(type) {
+	case *metricsql.RollupExpr:
+		// Subqueries
+		e.Expr = qm.expandLabelFilterPairs(e.Expr)
+		return e
+	case *metricsql.FuncExpr:
+		if metricsql.IsRollupFunc(e.Name) {
+			for i, arg := range e.Args {
+				me, wrap := selectorOf(arg)
+				if me == nil || qm.skipsUnlabeledMetric(me) {
+					continue
+				}
+
+				return qm.unionOfPairs(me, func(me *metricsql.MetricExpr) metricsql.Expr {
+					fe := *e
+					fe.Args = append([]metricsql.Expr{}, e.Args...)
+					fe.Args[i] = wrap(me)
+					return &fe
+				})
+			}
+		}
+		for i := range e.Args {
+			e.Args[i] = qm.expandLabelFilterPairs(e.Args[i])
+		}
+		return e
+	case *metricsql.AggrFuncExpr:
+		for i := range e.Args {
+			e.Args[i] = qm.expandLabelFilterPairs(e.Args[i])
+		}
+		return e
+	case *metricsql.BinaryOpExpr:
+		e.Left = qm.expandLabelFilterPairs(e.Left)
+		e.Right = qm.expandLabelFilterPairs(e.Right)
+		return e
+	default:
+		return expr
+	}
+}
+
+// selectorOf returns the selector of an expression (a selector or a selector with a window, offset, etc.) along with a function wrapping another selector the same way. nil is returned for other arguments.
+func selectorOf(arg metricsql.Expr) (*metricsql.MetricExpr, func(*metricsql.MetricExpr) metricsql.Expr) {
+	switch a := arg.(type) {
+	case *metricsql.MetricExpr:
+		return a, func(me *metricsql.MetricExpr) metricsql.Expr {
+			return me
+		}
+	case *metricsql.RollupExpr:
+		me, ok := a.Expr.(*metricsql.MetricExpr)
+		if !ok {
+			return nil, nil
+		}
+		return me, func(me *metricsql.MetricExpr) metricsql.Expr {
+			re := *a
+			re.Expr = me
+			return &re
+		}
+	default:
+		return nil, nil
+	}
+}
+
+// unionOfPairs returns a union (or) of expressions built by wrap for copies of the selector restricted by each of the label filter pairs.
+func (qm *QueryModifier) unionOfPairs(me *metricsql.MetricExpr, wrap func(*metricsql.MetricExpr) metricsql.Expr) metricsql.Expr {
+	var union metricsql.Expr
+
+	for _, restricted := range qm.selectorsForPairs(me) {
+		expr := wrap(restricted)
+		if union == nil {
+			union = expr
+			continue
+		}
+
+		union = &metricsql.BinaryOpExpr{
+			Op:    "or",
+			Left:  union,
+			Right: expr,
+		}
+	}
+
+	return union
+}
+
+// selectorsForPairs returns copies of the selector restricted by each of the label filter pairs.
+func (qm *QueryModifier) selectorsForPairs(me *metricsql.MetricExpr) []*metricsql.MetricExpr {
+	selectors := make([]*metricsql.MetricExpr, 0, len(qm.ACL.LabelFilterPairs))
+
+	for _, pair := range qm.ACL.LabelFilterPairs {
+		restricted := &metricsql.MetricExpr{
+			LabelFilters: append([]metricsql.LabelFilter{}, me.LabelFilters...),
+		}
+
+		for _, lf := range pair {
+			if lf.IsRegexp {
+				restricted.LabelFilters = appendOrMergeRegexpLF(restricted.LabelFilters, lf)
+			} else {
+				restricted.LabelFilters = replaceLFByName(restricted.LabelFilters, lf)
+			}
+		}
+
+		selectors = append(selectors, restricted)
+	}
+
+	return selectors
+}
@@ -0,0 +1,222 @@
+package querymodifier
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/VictoriaMetrics/metricsql"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewACL_Pairs(t *testing.T) {
+	tests := []struct {
+		name   string
+		rawACL string
+		want   ACL
+		fail   bool
+	}{
+		{
+			name:   "prod-eu:payments, prod-us:billing",
+			rawACL: "prod-eu:payments, prod-us:billing",
+			want: ACL{
+				Fullaccess: false,
+				LabelFilter: metricsql.LabelFilter{
+					Label:    "namespace",
+					Value:    "payments|billing",
+					IsRegexp: true,
+				},
+				LabelFilterPairs: [][]metricsql.LabelFilter{
+					{
+						{Label: "cluster", Value: "prod-eu"},
+						{Label: "namespace", Value: "payments"},
+					},
+					{
+						{Label: "cluster", Value: "prod-us"},
+						{Label: "namespace", Value: "billing"},
+					},
+				},
+				RawACL: "prod-eu:payments, prod-us:billing",
+			},
+		},
+		{
+			name:   "prod-.*:payments, billing, !kube-system (plain values are allowed in any cluster)",
+			rawACL: "prod-.*:payments, billing, !kube-system",
+			want: ACL{
+				Fullaccess: false,
+				LabelFilter: metricsql.LabelFilter{
+					Label:    "namespace",
+					Value:    "payments|billing",
+					IsRegexp: true,
+				},
+				LabelFilterPairs: [][]metricsql.LabelFilter{
+					{
+						{Label: "cluster", Value: "prod-.*", IsRegexp: true},
+						{Label: "namespace", Value: "payments"},
+					},
+					{
+						{Label: "namespace", Value: "billing"},
+					},
+				},
+				RawACL: "prod-.*:payments, billing",
+				DenyLabelFilter: metricsql.LabelFilter{
+					Label:      "namespace",
+					Value:      "kube-system",
+					IsRegexp:   true,
+					IsNegative: true,
+				},
+				RawDenyACL: "kube-system",
+			},
+		},
+		{
+			name:   "prod-eu:.* (everything in a cluster)",
+			rawACL: "prod-eu:.*",
+			want: ACL{
+				Fullaccess: false,
+				LabelFilter: metricsql.LabelFilter{
+					Label:    "namespace",
+					Value:    ".*",
+					IsRegexp: true,
+				},
+				LabelFilterPairs: [][]metricsql.LabelFilter{
+					{
+						{Label: "cluster", Value: "prod-eu"},
+					},
+				},
+				RawACL: "prod-eu:.*",
+			},
+		},
+		{
+			name:   "prod-eu:payments, .*:.* (full access)",
+			rawACL: "prod-eu:payments, .*:.*",
+			want:   getFullaccessACL("namespace"),
+		},
+		{
+			name:   "(?:pay|bill)ments, audit (not a pair)",
+			rawACL: "(?:pay|bill)ments, audit",
+			want: ACL{
+				Fullaccess: false,
+				LabelFilter: metricsql.LabelFilter{
+					Label:    "namespace",
+					Value:    "(?:pay|bill)ments|audit",
+					IsRegexp: true,
+				},
+				RawACL: "(?:pay|bill)ments, audit",
+			},
+		},
+		{
+			name:   "prod-[:payments (invalid regexp)",
+			rawACL: "prod-[:payments",
+			fail:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewACL(tt.rawACL)
+			if tt.fail {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQueryModifier_expandLabelFilterPairs(t *testing.T) {
+	acl, err := NewACL("prod-eu:payments, prod-us:billing")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "Selector",
+			query: `up{job="demo"}`,
+			want:  `up{job="demo", cluster="prod-eu", namespace="payments"} or up{job="demo", cluster="prod-us", namespace="billing"}`,
+		},
+		{
+			name:  "Rollup function is applied per pair",
+			query: `sum(rate(http_requests_total{cluster="prod-us"}[5m] offset 1h)) by (namespace)`,
+			want:  `sum(rate(http_requests_total{cluster="prod-eu", namespace="payments"}[5m] offset 1h) or rate(http_requests_total{cluster="prod-us", namespace="billing"}[5m] offset 1h)) by (namespace)`,
+		},
+		{
+			name:  "Rollup function with several arguments",
+			query: `quantile_over_time(0.9, latency[5m])`,
+			want:  `quantile_over_time(0.9, latency{cluster="prod-eu", namespace="payments"}[5m]) or quantile_over_time(0.9, latency{cluster="prod-us", namespace="billing"}[5m])`,
+		},
+		{
+			name:  "Binary operation and subquery",
+			query: `max_over_time(sum(a)[1h:5m]) / b`,
+			want:  `max_over_time(sum(a{cluster="prod-eu", namespace="payments"} or a{cluster="prod-us", namespace="billing"})[1h:5m]) / (b{cluster="prod-eu", namespace="payments"} or b{cluster="prod-us", namespace="billing"})`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qm := QueryModifier{
+				ACL: acl,
+			}
+
+			expr, err := metricsql.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			got := string(qm.expandLabelFilterPairs(qm.modifyMetricExpr(expr)).AppendString(nil))
+			assert.Equal(t, tt.want, got)
+
+			// The result must be a valid query
+			_, err = metricsql.Parse(got)
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestQueryModifier_GetModifiedEncodedURLValues_Pairs(t *testing.T) {
+	acl, err := NewACL("prod-eu:payments, prod-us:billing")
+	assert.Nil(t, err)
+
+	qm := QueryModifier{
+		ACL: acl,
+	}
+
+	params := url.Values{
+		"match[]": {`up`},
+	}
+
+	got, err := qm.GetModifiedEncodedURLValues(params)
+	assert.Nil(t, err)
+
+	want := url.Values{
+		"match[]": {
+			`up{cluster="prod-eu", namespace="payments"}`,
+			`up{cluster="prod-us", namespace="billing"}`,
+		},
+	}
+	assert.Equal(t, want.Encode(), got)
+}
+
+func TestACL_GetUserACL_Pairs(t *testing.T) {
+	aclPayments, err := NewACL("prod-eu:payments")
+	assert.Nil(t, err)
+
+	aclBilling, err := NewACL("billing")
+	assert.Nil(t, err)
+
+	acls := ACLs{
+		"payments": aclPayments,
+		"billing":  aclBilling,
+	}
+
+	got, err := acls.GetUserACL([]string{"payments", "billing"}, false, DefaultLabel)
+	assert.Nil(t, err)
+
+	want, err := NewACL("prod-eu:payments, billing")
+	assert.Nil(t, err)
+	assert.Equal(t, want, got)
+	assert.Len(t, got.LabelFilterPairs, 2)
+}
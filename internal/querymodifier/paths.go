@@ -0,0 +1,82 @@
+package querymodifier
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// pathWildcard turns a paths entry into a prefix (e.g. /api/v1/label/*)
+const pathWildcard = "*"
+
+// newPaths validates and normalizes a paths entry of a role definition. Entries must be absolute, a trailing * makes an entry match any path starting with the rest of it.
+func newPaths(role string, paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	normalized := make([]string, 0, len(paths))
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "/") || strings.Contains(strings.TrimSuffix(p, pathWildcard), pathWildcard) {
+			return nil, fmt.Errorf("%s role contains an invalid paths entry: %q", role, p)
+		}
+		normalized = append(normalized, p)
+	}
+	sort.Strings(normalized)
+
+	return normalized, nil
+}
+
+// mergeAllowlists returns values of an allowlist (e.g. paths) of the known roles. If any of them has an empty allowlist, nil is returned (no restrictions).
+func (a ACLs) mergeAllowlists(roles []string, allowlist func(ACL) []string) []string {
+	var merged []string
+	seen := make(map[string]bool)
+
+	for _, role := range roles {
+		acl, exists := a[role]
+		if !exists {
+			continue
+		}
+
+		values := allowlist(acl)
+		if len(values) == 0 {
+			return nil
+		}
+
+		for _, p := range values {
+			if !seen[p] {
+				seen[p] = true
+				merged = append(merged, p)
+			}
+		}
+	}
+	sort.Strings(merged)
+
+	return merged
+}
+
+// AllowsPath returns true if the ACL doesn't restrict paths or the (cleaned) path matches any of its paths.
+func (acl ACL) AllowsPath(p string) bool {
+	if len(acl.Paths) == 0 {
+		return true
+	}
+
+	p = path.Clean("/" + p)
+
+	for _, allowed := range acl.Paths {
+		if prefix, ok := strings.CutSuffix(allowed, pathWildcard); ok {
+			if strings.HasPrefix(p, prefix) {
+				return true
+			}
+			continue
+		}
+
+		if p == allowed {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,60 @@
+package querymodifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACLs_mergeAllowlists(t *testing.T) {
+	acls := ACLs{
+		"dashboards": ACL{Paths: []string{"/api/v1/query", "/api/v1/query_range"}},
+		"labels":     ACL{Paths: []string{"/api/v1/label/*", "/api/v1/query"}},
+		"minio":      ACL{RawACL: "minio"},
+	}
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  []string
+	}{
+		{
+			name:  "Single role",
+			roles: []string{"dashboards"},
+			want:  []string{"/api/v1/query", "/api/v1/query_range"},
+		},
+		{
+			name:  "Paths are merged",
+			roles: []string{"dashboards", "labels"},
+			want:  []string{"/api/v1/label/*", "/api/v1/query", "/api/v1/query_range"},
+		},
+		{
+			name:  "Role without restrictions",
+			roles: []string{"dashboards", "minio"},
+			want:  nil,
+		},
+		{
+			name:  "Unknown roles are ignored",
+			roles: []string{"dashboards", "unknown"},
+			want:  []string{"/api/v1/query", "/api/v1/query_range"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, acls.mergeAllowlists(tt.roles, func(acl ACL) []string { return acl.Paths }))
+		})
+	}
+}
+
+func TestACL_AllowsPath(t *testing.T) {
+	acl := ACL{Paths: []string{"/api/v1/label/*", "/api/v1/query"}}
+
+	assert.True(t, acl.AllowsPath("/api/v1/query"))
+	assert.True(t, acl.AllowsPath("/api/v1/query/"))
+	assert.True(t, acl.AllowsPath("/api/v1/label/namespace/values"))
+	assert.False(t, acl.AllowsPath("/api/v1/query_range"))
+	assert.False(t, acl.AllowsPath("/api/v1/label/../series"))
+	assert.True(t, ACL{}.AllowsPath("/api/v1/series"))
+}
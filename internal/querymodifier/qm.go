@@ -3,6 +3,7 @@ package querymodifier
 import (
 	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/VictoriaMetrics/metricsql"
@@ -13,6 +14,11 @@ type QueryModifier struct {
 	ACL                 ACL
 	EnableDeduplication bool
 	OptimizeExpressions bool
+	// UnlabeledMetrics matches names of metrics that don't carry the enforced label, selectors of such metrics are handled according to UnlabeledPolicy (UnlabeledPolicyInject if empty)
+	UnlabeledMetrics *regexp.Regexp
+	UnlabeledPolicy  string
+	// SkippedMetrics contains names of unlabeled metrics whose selectors were left unmodified (see UnlabeledPolicySkip)
+	SkippedMetrics []string
 }
 
 // GetModifiedEncodedURLValues rewrites GET/POST "query" and "match" parameters to filter out metrics.
@@ -26,6 +32,11 @@ func (qm *QueryModifier) GetModifiedEncodedURLValues(params url.Values) (string,
 	for k, vv := range params {
 		switch k {
 		case "query", "match[]":
+			// Series selectors return individual series by definition
+			if k == "match[]" && qm.ACL.AggregationOnly && len(vv) > 0 {
+				return "", fmt.Errorf("%w: series selectors (match[]) cannot be used", ErrNotAggregated)
+			}
+
 			for _, v := range vv {
 				{
 					expr, err := metricsql.Parse(v)
@@ -33,7 +44,30 @@ func (qm *QueryModifier) GetModifiedEncodedURLValues(params url.Values) (string,
 						return "", err
 					}
 
+					if err := qm.checkUnlabeledMetrics(expr); err != nil {
+						return "", err
+					}
+
+					if err := qm.checkAggregation(expr); err != nil {
+						return "", err
+					}
+
 					expr = qm.modifyMetricExpr(expr)
+
+					// Series selectors cannot be combined through "or", thus match[] is split into a selector per pair instead (the results are merged by the upstream)
+					if me, ok := expr.(*metricsql.MetricExpr); ok && k == "match[]" && len(qm.ACL.LabelFilterPairs) > 0 && !qm.skipsUnlabeledMetric(me) {
+						for _, restricted := range qm.selectorsForPairs(me) {
+							newParams.Add(k, string(restricted.AppendString(nil)))
+						}
+						continue
+					}
+
+					if len(qm.ACL.LabelFilterPairs) > 0 {
+						expr = qm.expandLabelFilterPairs(expr)
+					}
+
+					expr = qm.enforceMinSeries(expr)
+
 					if qm.OptimizeExpressions {
 						expr = metricsql.Optimize(expr)
 					}
@@ -60,12 +94,24 @@ func (qm *QueryModifier) modifyMetricExpr(expr metricsql.Expr) metricsql.Expr {
 	// to say which label filter to add
 	modifyLabelFilter := func(expr metricsql.Expr) {
 		if me, ok := expr.(*metricsql.MetricExpr); ok {
-			if qm.ACL.LabelFilter.IsRegexp {
-				if !qm.EnableDeduplication || !qm.shouldNotBeModified(me.LabelFilters) {
-					me.LabelFilters = appendOrMergeRegexpLF(me.LabelFilters, qm.ACL.LabelFilter)
-				}
-			} else {
-				me.LabelFilters = replaceLFByName(me.LabelFilters, qm.ACL.LabelFilter)
+			if qm.skipsUnlabeledMetric(me) {
+				name, _ := qm.unlabeledMetricName(me)
+				qm.SkippedMetrics = append(qm.SkippedMetrics, name)
+				return
+			}
+
+			// Namespace filter gives access to all namespaces if the ACL is restricted only by extra labels, so there's no need to add it
+			if !isFullaccessLF(qm.ACL.LabelFilter) {
+				me.LabelFilters = qm.applyLabelFilter(me.LabelFilters, qm.ACL.LabelFilter, qm.ACL.RawACL)
+			}
+
+			// Negative regexps are never deduplicated, they're merged with the original negative regexps instead
+			if qm.ACL.RawDenyACL != "" {
+				me.LabelFilters = qm.applyLabelFilter(me.LabelFilters, qm.ACL.DenyLabelFilter, qm.ACL.RawDenyACL)
+			}
+
+			for _, lf := range qm.ACL.ExtraLabelFilters {
+				me.LabelFilters = qm.applyLabelFilter(me.LabelFilters, lf, qm.ACL.RawExtraACLs[lf.Label])
 			}
 		}
 	}
@@ -76,6 +122,19 @@ func (qm *QueryModifier) modifyMetricExpr(expr metricsql.Expr) metricsql.Expr {
 	return newExpr
 }
 
+// applyLabelFilter adds newLF (built from rawACL) to the original filters: regexps are appended or merged unless deduplication says the original filters are already within the ACL, non-regexps replace the original filters with the same label name.
+func (qm *QueryModifier) applyLabelFilter(filters []metricsql.LabelFilter, newLF metricsql.LabelFilter, rawACL string) []metricsql.LabelFilter {
+	if !newLF.IsRegexp {
+		return replaceLFByName(filters, newLF)
+	}
+
+	if qm.EnableDeduplication && !qm.ACL.Fullaccess && isCoveredByLF(filters, newLF, rawACL) {
+		return filters
+	}
+
+	return appendOrMergeRegexpLF(filters, newLF)
+}
+
 // TODO: simplify description
 // shouldNotBeModified helps to understand whether the original label filters have to be modified. The function returns false if any of the original filters do not match expectations described further. It returns true if [the list of original filters contains either a fake positive regexp (no special symbols, e.g. namespace=~"kube-system") or a non-regexp filter] and [acl.LabelFilter is a matching positive regexp]. Also, if original filter is a subfilter of the new filter or has the same value; if acl gives full access. Target label is taken from the acl.LabelFilter.
 func (qm *QueryModifier) shouldNotBeModified(filters []metricsql.LabelFilter) bool {
@@ -83,12 +142,16 @@ func (qm *QueryModifier) shouldNotBeModified(filters []metricsql.LabelFilter) bo
 		return true
 	}
 
+	return isCoveredByLF(filters, qm.ACL.LabelFilter, qm.ACL.RawACL)
+}
+
+// isCoveredByLF returns true if the original filters with the label of newLF are already within newLF (built from rawACL), see shouldNotBeModified for details.
+func isCoveredByLF(filters []metricsql.LabelFilter, newLF metricsql.LabelFilter, rawACL string) bool {
 	seen := 0
 	seenUnmodified := 0
 
 	// TODO: move to a map? Might not be worth doing as filters of the same type are unlikely
-	rawSubACLs := strings.Split(qm.ACL.RawACL, ", ")
-	newLF := qm.ACL.LabelFilter
+	rawSubACLs := strings.Split(rawACL, ", ")
 
 	for _, filter := range filters {
 		// For filter, only positive regexps and non-regexps considered, for newLF - positive regexps.
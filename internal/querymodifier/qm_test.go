@@ -336,6 +336,198 @@ func TestQueryModifier_modifyMetricExpr(t *testing.T) {
 }
 
 //gocyclo:ignore
+func TestQueryModifier_modifyMetricExpr_ExtraLabels(t *testing.T) {
+	aclMinioInProd, err := NewACLWithLabels(DefaultLabel, "minio", map[string]string{"cluster": "prod-1, prod-2"})
+	assert.Nil(t, err)
+
+	aclAllInDev, err := NewACLWithLabels(DefaultLabel, ".*", map[string]string{"cluster": "dev"})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name                string
+		query               string
+		EnableDeduplication bool
+		acl                 ACL
+		want                string
+	}{
+		{
+			name:                "All label filters are appended",
+			query:               `request_duration{job="demo"}`,
+			EnableDeduplication: false,
+			acl:                 aclMinioInProd,
+			want:                `request_duration{job="demo", namespace="minio", cluster=~"prod-1|prod-2"}`,
+		},
+		{
+			name:                "Extra regexp filter replaces a positive regexp",
+			query:               `request_duration{cluster=~"dev|prod-1"}`,
+			EnableDeduplication: true,
+			acl:                 aclMinioInProd,
+			want:                `request_duration{cluster=~"prod-1|prod-2", namespace="minio"}`,
+		},
+		{
+			name:                "Extra filter is deduplicated",
+			query:               `request_duration{cluster="prod-2"}`,
+			EnableDeduplication: true,
+			acl:                 aclMinioInProd,
+			want:                `request_duration{cluster="prod-2", namespace="minio"}`,
+		},
+		{
+			name:                "Extra non-regexp filter replaces the original one",
+			query:               `request_duration{namespace="minio", cluster="prod"}`,
+			EnableDeduplication: true,
+			acl:                 aclAllInDev,
+			want:                `request_duration{namespace="minio", cluster="dev"}`,
+		},
+		{
+			name:                "Namespace filter is not added if all namespaces are allowed",
+			query:               `request_duration{namespace=~"min.*"}`,
+			EnableDeduplication: false,
+			acl:                 aclAllInDev,
+			want:                `request_duration{namespace=~"min.*", cluster="dev"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qm := QueryModifier{
+				ACL:                 tt.acl,
+				EnableDeduplication: tt.EnableDeduplication,
+			}
+
+			expr, err := metricsql.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			got := string(qm.modifyMetricExpr(expr).AppendString(nil))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQueryModifier_modifyMetricExpr_Metrics(t *testing.T) {
+	aclKubeMetrics, err := NewACLWithLabels(DefaultLabel, "minio", map[string]string{metricNameLabel: "kube_.*, container_.*"})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name                string
+		query               string
+		EnableDeduplication bool
+		want                string
+	}{
+		{
+			name:                "Metric name filter is appended",
+			query:               `up{job="demo"}`,
+			EnableDeduplication: false,
+			want:                `up{job="demo", namespace="minio", __name__=~"kube_.*|container_.*"}`,
+		},
+		{
+			name:                "Allowed metric name is deduplicated",
+			query:               `kube_pod_info{job="demo"}`,
+			EnableDeduplication: true,
+			want:                `kube_pod_info{job="demo", namespace="minio"}`,
+		},
+		{
+			name:                "Metric name regexp is replaced",
+			query:               `{__name__=~".+"}`,
+			EnableDeduplication: true,
+			want:                `{__name__=~"kube_.*|container_.*", namespace="minio"}`,
+		},
+		{
+			name:                "Every selector is restricted",
+			query:               `sum(rate(node_cpu_seconds_total[5m])) / sum(container_cpu_usage_seconds_total)`,
+			EnableDeduplication: true,
+			want:                `sum(rate(node_cpu_seconds_total{namespace="minio", __name__=~"kube_.*|container_.*"}[5m])) / sum(container_cpu_usage_seconds_total{namespace="minio"})`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qm := QueryModifier{
+				ACL:                 aclKubeMetrics,
+				EnableDeduplication: tt.EnableDeduplication,
+			}
+
+			expr, err := metricsql.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			got := string(qm.modifyMetricExpr(expr).AppendString(nil))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQueryModifier_modifyMetricExpr_Deny(t *testing.T) {
+	aclAllButKubeSystem, err := NewACL("!kube-system")
+	assert.Nil(t, err)
+
+	aclMinioButSecret, err := NewACL("min.*, !minio-secret")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name                string
+		query               string
+		EnableDeduplication bool
+		acl                 ACL
+		want                string
+	}{
+		{
+			name:                "Only a negative filter is added if everything else is allowed",
+			query:               `request_duration{job="demo"}`,
+			EnableDeduplication: true,
+			acl:                 aclAllButKubeSystem,
+			want:                `request_duration{job="demo", namespace!~"kube-system"}`,
+		},
+		{
+			name:                "Original negative regexp is merged",
+			query:               `request_duration{namespace!~"default"}`,
+			EnableDeduplication: true,
+			acl:                 aclAllButKubeSystem,
+			want:                `request_duration{namespace!~"default|kube-system"}`,
+		},
+		{
+			name:                "Denied value explicitly requested",
+			query:               `request_duration{namespace="kube-system"}`,
+			EnableDeduplication: true,
+			acl:                 aclAllButKubeSystem,
+			want:                `request_duration{namespace="kube-system", namespace!~"kube-system"}`,
+		},
+		{
+			name:                "Positive and negative filters are combined",
+			query:               `request_duration{namespace=~"minio.*"}`,
+			EnableDeduplication: false,
+			acl:                 aclMinioButSecret,
+			want:                `request_duration{namespace=~"min.*", namespace!~"minio-secret"}`,
+		},
+		{
+			name:                "Negative filter is added even if the positive one is deduplicated",
+			query:               `request_duration{namespace="minio"}`,
+			EnableDeduplication: true,
+			acl:                 aclMinioButSecret,
+			want:                `request_duration{namespace="minio", namespace!~"minio-secret"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qm := QueryModifier{
+				ACL:                 tt.acl,
+				EnableDeduplication: tt.EnableDeduplication,
+			}
+
+			expr, err := metricsql.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			got := string(qm.modifyMetricExpr(expr).AppendString(nil))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 func TestQueryModifier_shouldNotBeModified(t *testing.T) {
 	filtersNoTargetLabel := []metricsql.LabelFilter{
 		{
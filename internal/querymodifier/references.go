@@ -0,0 +1,52 @@
+package querymodifier
+
+import (
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// ReferencedValues returns candidates that might be selected by the query through label filters on the given label (e.g. namespaces referenced in a rewritten query). A candidate is referenced if all filters on the label of at least one series selector match it, thus selectors without such filters reference all candidates.
+func ReferencedValues(query, label string, candidates []string) ([]string, error) {
+	expr, err := metricsql.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+
+	metricsql.VisitAll(expr, func(expr metricsql.Expr) {
+		me, ok := expr.(*metricsql.MetricExpr)
+		if !ok {
+			return
+		}
+
+		for _, candidate := range candidates {
+			if !referenced[candidate] && lfsAllowValue(me.LabelFilters, label, candidate) {
+				referenced[candidate] = true
+			}
+		}
+	})
+
+	values := []string{}
+	for _, candidate := range candidates {
+		if referenced[candidate] {
+			values = append(values, candidate)
+		}
+	}
+
+	return values, nil
+}
+
+// lfsAllowValue returns true if all filters on the label (positive and negative) let the value through.
+func lfsAllowValue(filters []metricsql.LabelFilter, label, value string) bool {
+	for _, lf := range filters {
+		if lf.Label != label {
+			continue
+		}
+
+		if lfMatchesValue(lf, value) == lf.IsNegative {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,72 @@
+package querymodifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferencedValues(t *testing.T) {
+	candidates := []string{"minio", "stolon", "kube-system"}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "equality",
+			query: `up{namespace="minio"}`,
+			want:  []string{"minio"},
+		},
+		{
+			name:  "regexp",
+			query: `up{namespace=~"minio|stolon"}`,
+			want:  []string{"minio", "stolon"},
+		},
+		{
+			name:  "positive and negative filters",
+			query: `up{namespace=~".*", namespace!~"kube-.*"}`,
+			want:  []string{"minio", "stolon"},
+		},
+		{
+			name:  "negative equality",
+			query: `up{namespace!="minio"}`,
+			want:  []string{"stolon", "kube-system"},
+		},
+		{
+			name:  "multiple selectors",
+			query: `sum(rate(http_requests_total{namespace="minio"}[5m])) / sum(up{namespace="stolon"})`,
+			want:  []string{"minio", "stolon"},
+		},
+		{
+			name:  "no filters on the label",
+			query: `up{job="prometheus"}`,
+			want:  []string{"minio", "stolon", "kube-system"},
+		},
+		{
+			name:  "unknown values",
+			query: `up{namespace="default"}`,
+			want:  []string{},
+		},
+		{
+			name:    "invalid query",
+			query:   `up{`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReferencedValues(tt.query, "namespace", candidates)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package querymodifier
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// validCapture limits values captured from role names, so a role cannot widen its own access by injecting regular expressions (e.g. .*|kube-system) or extra definitions (e.g. through commas)
+var validCapture = regexp.MustCompile(`^[A-Za-z0-9._@-]*$`)
+
+// RolePattern is a templated role definition: its key in acl.yaml is a regular expression with capture groups (e.g. team-(.*)), which can be referenced in the definition (e.g. ${1}-.*), so a single entry covers many similarly named roles.
+type RolePattern struct {
+	Regexp        *regexp.Regexp
+	definition    aclDefinition
+	enforcedLabel string
+}
+
+// String implements fmt.Stringer, so RolePattern is printed in a stable way (e.g. in ACL snapshots).
+func (p *RolePattern) String() string {
+	return fmt.Sprintf("%s => %+v", p.Regexp, p.definition)
+}
+
+// isRolePattern returns true if a role key in acl.yaml is a templated definition. Keys are considered to be templates only if they contain a capture group, so role names with other special symbols (e.g. dots) are still matched literally.
+func isRolePattern(role string) bool {
+	return strings.Contains(role, "(")
+}
+
+// newRolePattern returns a RolePattern for a templated role definition. The regular expression is fully anchored. Templates are validated by expanding all capture groups to a placeholder value.
+func newRolePattern(role string, definition aclDefinition, enforcedLabel string) (*RolePattern, error) {
+	re, err := regexp.Compile("^(?:" + role + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("%s role pattern is not a valid regular expression: %s", role, err)
+	}
+
+	p := &RolePattern{
+		Regexp:        re,
+		definition:    definition,
+		enforcedLabel: enforcedLabel,
+	}
+
+	placeholder := "x"
+	match := make([]int, 0, 2*(re.NumSubexp()+1))
+	for i := 0; i <= re.NumSubexp(); i++ {
+		match = append(match, 0, len(placeholder))
+	}
+
+	if _, err := newACLFromDefinition(role, p.expandDefinition(placeholder, match), enforcedLabel); err != nil {
+		return nil, fmt.Errorf("%s role pattern: %w", role, err)
+	}
+
+	return p, nil
+}
+
+// expand returns an ACL for the role if it matches the pattern. Roles with captured values outside of validCapture or resulting in invalid definitions are treated as not matching. Captured values are quoted, so dots are matched literally.
+func (p *RolePattern) expand(role string) (ACL, bool) {
+	match := p.Regexp.FindStringSubmatchIndex(role)
+	if match == nil {
+		return ACL{}, false
+	}
+
+	src, quotedMatch, ok := quoteSubmatches(role, match)
+	if !ok {
+		return ACL{}, false
+	}
+
+	acl, err := newACLFromDefinition(role, p.expandDefinition(src, quotedMatch), p.enforcedLabel)
+	if err != nil {
+		return ACL{}, false
+	}
+
+	return acl, true
+}
+
+// quoteSubmatches returns the captured values of the role quoted with regexp.QuoteMeta along with their indexes in the returned string, ok is false if any of the values is not a valid capture.
+func quoteSubmatches(role string, match []int) (string, []int, bool) {
+	var src strings.Builder
+	quotedMatch := make([]int, len(match))
+
+	for i := 0; i < len(match); i += 2 {
+		if match[i] < 0 {
+			quotedMatch[i], quotedMatch[i+1] = -1, -1
+			continue
+		}
+
+		value := role[match[i]:match[i+1]]
+		if !validCapture.MatchString(value) {
+			return "", nil, false
+		}
+
+		quotedMatch[i] = src.Len()
+		src.WriteString(regexp.QuoteMeta(value))
+		quotedMatch[i+1] = src.Len()
+	}
+
+	return src.String(), quotedMatch, true
+}
+
+// ExpandCaptures expands the template (e.g. ${1}-.*) with the values captured from the role by re, the same way role patterns are expanded: values are quoted, ok is false if any of them is outside of validCapture.
+func ExpandCaptures(re *regexp.Regexp, template, role string, match []int) (string, bool) {
+	src, quotedMatch, ok := quoteSubmatches(role, match)
+	if !ok {
+		return "", false
+	}
+
+	return string(re.ExpandString(nil, template, src, quotedMatch)), true
+}
+
+// expandDefinition returns a copy of the definition with capture groups (${1}, ${name}, etc.) substituted in namespaces, deny, metrics and extra labels.
+func (p *RolePattern) expandDefinition(role string, match []int) aclDefinition {
+	expand := func(template string) string {
+		return string(p.Regexp.ExpandString(nil, template, role, match))
+	}
+
+	definition := p.definition
+	definition.Namespaces = namespaceList(expand(string(definition.Namespaces)))
+	definition.Metrics = namespaceList(expand(string(definition.Metrics)))
+
+	definition.Deny = make([]string, 0, len(p.definition.Deny))
+	for _, d := range p.definition.Deny {
+		definition.Deny = append(definition.Deny, expand(d))
+	}
+
+	expandLabels := func(labels map[string]string) map[string]string {
+		if labels == nil {
+			return nil
+		}
+
+		expanded := make(map[string]string, len(labels))
+		for label, value := range labels {
+			expanded[label] = expand(value)
+		}
+		return expanded
+	}
+	definition.Labels = expandLabels(p.definition.Labels)
+	definition.ExtraLabels = expandLabels(p.definition.ExtraLabels)
+
+	return definition
+}
+
+// ForRoles returns ACLs for the given roles only: known roles as they are and roles matching templated definitions (see RolePattern) with templates expanded. Known roles take precedence over templates, templates are tried in alphabetical order of their keys.
+func (a ACLs) ForRoles(roles []string) ACLs {
+	result := make(ACLs, len(roles))
+
+	var patterns []string
+	for _, role := range roles {
+		if acl, exists := a[role]; exists && acl.RolePattern == nil {
+			result[role] = acl
+			continue
+		}
+
+		if patterns == nil {
+			patterns = a.rolePatterns()
+		}
+
+		for _, pattern := range patterns {
+			if acl, ok := a[pattern].RolePattern.expand(role); ok {
+				result[role] = acl
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// rolePatterns returns sorted keys of templated role definitions.
+func (a ACLs) rolePatterns() []string {
+	patterns := []string{}
+	for role, acl := range a {
+		if acl.RolePattern != nil {
+			patterns = append(patterns, role)
+		}
+	}
+	sort.Strings(patterns)
+
+	return patterns
+}
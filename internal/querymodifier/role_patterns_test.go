@@ -0,0 +1,133 @@
+package querymodifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACLs_ForRoles(t *testing.T) {
+	acls, _, err := NewACLsFromBytes([]byte(`version: 2
+roles:
+  team-(.*): "${1}-.*"
+  team-special: special
+  tenant-(?P<tenant>[a-z]+)-(dev|prod):
+    label: tenant
+    namespaces: ${tenant}-${2}
+    deny: ["${tenant}-secret"]
+    labels:
+      cluster: ${2}-.*
+  (viewer|editor)-.*: "!kube-system"`), DefaultLabel)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  map[string]ACL
+	}{
+		{
+			name:  "capture group",
+			roles: []string{"team-billing"},
+			want:  map[string]ACL{"team-billing": mustNewACLWithLabels(t, DefaultLabel, "billing-.*", nil)},
+		},
+		{
+			name:  "known role takes precedence",
+			roles: []string{"team-special"},
+			want:  map[string]ACL{"team-special": mustNewACLWithLabels(t, DefaultLabel, "special", nil)},
+		},
+		{
+			name:  "named groups, deny and extra labels",
+			roles: []string{"tenant-acme-prod"},
+			want: map[string]ACL{
+				"tenant-acme-prod": mustNewACLWithLabels(t, "tenant", "acme-prod, !acme-secret", map[string]string{"cluster": "prod-.*"}),
+			},
+		},
+		{
+			name:  "template without references",
+			roles: []string{"viewer-anything"},
+			want:  map[string]ACL{"viewer-anything": mustNewACLWithLabels(t, DefaultLabel, "!kube-system", nil)},
+		},
+		{
+			name:  "patterns are fully anchored",
+			roles: []string{"my-team-billing", "tenant-acme-staging"},
+			want:  map[string]ACL{},
+		},
+		{
+			name:  "invalid expansion",
+			roles: []string{"team-["},
+			want:  map[string]ACL{},
+		},
+		{
+			name:  "regular expressions in captured values",
+			roles: []string{"team-.*|kube-system", "team-a+"},
+			want:  map[string]ACL{},
+		},
+		{
+			name:  "extra definitions in captured values",
+			roles: []string{"team-kube-system, x", "team-a,b"},
+			want:  map[string]ACL{},
+		},
+		{
+			name:  "dots in captured values are matched literally",
+			roles: []string{"team-a.b"},
+			want:  map[string]ACL{"team-a.b": mustNewACLWithLabels(t, DefaultLabel, `a\.b-.*`, nil)},
+		},
+		{
+			name:  "pattern keys are not roles",
+			roles: []string{"unknown"},
+			want:  map[string]ACL{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := acls.ForRoles(tt.roles)
+			assert.Equal(t, ACLs(tt.want), got)
+		})
+	}
+
+	t.Run("GetUserACL", func(t *testing.T) {
+		got, err := acls.GetUserACL([]string{"team-a", "team-b"}, false, DefaultLabel)
+		assert.Nil(t, err)
+		assert.Equal(t, mustNewACLWithLabels(t, DefaultLabel, "a-.*, b-.*", nil), got)
+
+		_, err = acls.GetUserACL([]string{"team-(.*)"}, false, DefaultLabel)
+		assert.NotNil(t, err, "a role named after a pattern must not get the pattern itself")
+	})
+}
+
+func TestNewACLsFromBytes_RolePatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "invalid regexp",
+			content: `team-(.*: "${1}"`,
+		},
+		{
+			name:    "invalid template",
+			content: `team-(.*): "${1}-["`,
+		},
+		{
+			name:    "extending a pattern",
+			content: "team-(.*): \"${1}\"\nteam-x: {extends: team-(.*), namespaces: x}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := NewACLsFromBytes([]byte(tt.content), DefaultLabel)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func mustNewACLWithLabels(t *testing.T, label, rawACL string, rawLabels map[string]string) ACL {
+	t.Helper()
+
+	acl, err := NewACLWithLabels(label, rawACL, rawLabels)
+	assert.Nil(t, err)
+
+	return acl
+}
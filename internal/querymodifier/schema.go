@@ -0,0 +1,115 @@
+package querymodifier
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentACLFileVersion is the latest version of the acl.yaml schema. Older versions are upgraded in memory.
+const CurrentACLFileVersion = 2
+
+// aclFile represents the latest version of acl.yaml. Users contains definitions for emails and email domains (see UserKeyPrefix), Clients - for OIDC clients (see ClientKeyPrefix).
+type aclFile struct {
+	Version int                      `yaml:"version"`
+	Roles   map[string]aclDefinition `yaml:"roles"`
+	Users   map[string]aclDefinition `yaml:"users"`
+	Clients map[string]aclDefinition `yaml:"clients"`
+}
+
+// aclFileMigrations contains functions that upgrade acl.yaml of version i+1 to version i+2 along with a deprecation warning.
+var aclFileMigrations = []func(node *yaml.Node) (*yaml.Node, string){
+	migrateACLFileV1,
+}
+
+// parseACLFile parses acl.yaml of any supported version and upgrades it to the latest one. Deprecation warnings are returned for outdated versions.
+func parseACLFile(content []byte) (aclFile, []string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return aclFile{}, nil, err
+	}
+
+	// Empty file
+	if len(doc.Content) == 0 {
+		return aclFile{Version: CurrentACLFileVersion}, nil, nil
+	}
+
+	node := doc.Content[0]
+
+	version, err := aclFileVersion(node)
+	if err != nil {
+		return aclFile{}, nil, err
+	}
+
+	if version < 1 || version > CurrentACLFileVersion {
+		return aclFile{}, nil, fmt.Errorf("unsupported acl.yaml version %d (supported: 1-%d)", version, CurrentACLFileVersion)
+	}
+
+	warnings := []string{}
+	for v := version; v < CurrentACLFileVersion; v++ {
+		var warning string
+		node, warning = aclFileMigrations[v-1](node)
+		warnings = append(warnings, warning)
+	}
+
+	var f aclFile
+	if err := node.Decode(&f); err != nil {
+		return aclFile{}, nil, err
+	}
+
+	return f, warnings, nil
+}
+
+// aclFileVersion returns the version of acl.yaml. Files without version and roles keys are considered to be of version 1 (flat list of roles), thus a role called "version" is still allowed there.
+func aclFileVersion(node *yaml.Node) (int, error) {
+	if node.Kind != yaml.MappingNode {
+		return 1, nil
+	}
+
+	versionNode := mappingValue(node, "version")
+	rolesNode := mappingValue(node, "roles")
+
+	if versionNode == nil || rolesNode == nil || rolesNode.Kind != yaml.MappingNode {
+		return 1, nil
+	}
+
+	version, err := strconv.Atoi(versionNode.Value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse acl.yaml version %q: %s", versionNode.Value, err)
+	}
+
+	return version, nil
+}
+
+// mappingValue returns the value of the given key in a mapping node or nil if it's not found.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// migrateACLFileV1 converts a flat list of roles (version 1) into version 2, where roles are defined under the roles key. Explicitly versioned files (version: 1) might already have the roles key.
+func migrateACLFileV1(node *yaml.Node) (*yaml.Node, string) {
+	if node.Kind == yaml.MappingNode && mappingValue(node, "version") != nil {
+		if roles := mappingValue(node, "roles"); roles != nil && roles.Kind == yaml.MappingNode {
+			node = roles
+		}
+	}
+
+	migrated := &yaml.Node{
+		Kind: yaml.MappingNode,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "version"},
+			{Kind: yaml.ScalarNode, Tag: "!!int", Value: "2"},
+			{Kind: yaml.ScalarNode, Value: "roles"},
+			node,
+		},
+	}
+
+	return migrated, "acl.yaml uses the deprecated flat format (version 1), please, move role definitions under the roles key and set version: 2"
+}
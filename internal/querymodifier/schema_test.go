@@ -0,0 +1,89 @@
+package querymodifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseACLFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantRoles    map[string]aclDefinition
+		wantWarnings int
+		fail         bool
+	}{
+		{
+			name:         "Empty file",
+			content:      "",
+			wantRoles:    nil,
+			wantWarnings: 0,
+		},
+		{
+			name:    "Version 1 (flat)",
+			content: "team-a: minio\nteam-b: {namespaces: stolon}",
+			wantRoles: map[string]aclDefinition{
+				"team-a": {Namespaces: "minio"},
+				"team-b": {Namespaces: "stolon"},
+			},
+			wantWarnings: 1,
+		},
+		{
+			name:    "Version 1 (flat) with a role called version",
+			content: "version: minio\nteam-a: stolon",
+			wantRoles: map[string]aclDefinition{
+				"version": {Namespaces: "minio"},
+				"team-a":  {Namespaces: "stolon"},
+			},
+			wantWarnings: 1,
+		},
+		{
+			name:    "Version 1 (explicit)",
+			content: "version: 1\nroles:\n  team-a: minio",
+			wantRoles: map[string]aclDefinition{
+				"team-a": {Namespaces: "minio"},
+			},
+			wantWarnings: 1,
+		},
+		{
+			name:    "Version 2",
+			content: "version: 2\nroles:\n  team-a: minio\n  team-b: {namespaces: stolon}",
+			wantRoles: map[string]aclDefinition{
+				"team-a": {Namespaces: "minio"},
+				"team-b": {Namespaces: "stolon"},
+			},
+			wantWarnings: 0,
+		},
+		{
+			name:    "Unsupported version",
+			content: "version: 3\nroles:\n  team-a: minio",
+			fail:    true,
+		},
+		{
+			name:    "Invalid version",
+			content: "version: two\nroles:\n  team-a: minio",
+			fail:    true,
+		},
+		{
+			name:    "Not a mapping",
+			content: "- minio",
+			fail:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warnings, err := parseACLFile([]byte(tt.content))
+			if tt.fail {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, CurrentACLFileVersion, got.Version)
+			assert.Equal(t, tt.wantRoles, got.Roles)
+			assert.Len(t, warnings, tt.wantWarnings)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package querymodifier
+
+import (
+	"slices"
+	"strings"
+)
+
+// WithSharedValues returns a copy of the ACL that also allows the values (e.g. shared namespaces). ACLs that don't restrict their label (including full access ones) are returned as is. Denied values still take precedence. Settings unrelated to label filters (e.g. ForcedParams, extra labels) are kept.
+func (acl ACL) WithSharedValues(values []string) (ACL, error) {
+	if len(values) == 0 || acl.Fullaccess || isFullaccessLF(acl.LabelFilter) {
+		return acl, nil
+	}
+
+	rawACL := acl.RawACL + ", " + strings.Join(values, ", ")
+	if acl.RawDenyACL != "" {
+		for _, d := range strings.Split(acl.RawDenyACL, ", ") {
+			rawACL += ", !" + d
+		}
+	}
+
+	shared, err := NewACLForLabel(acl.LabelFilter.Label, rawACL)
+	if err != nil {
+		return ACL{}, err
+	}
+
+	// Pairs of merged roles cannot be derived from RawACL (see ACLs.GetUserACL), so the shared values are added to the original pairs instead
+	if len(acl.LabelFilterPairs) > 0 {
+		sharedPairs, _, err := newLabelFilterPairs(acl.LabelFilter.Label, values)
+		if err != nil {
+			return ACL{}, err
+		}
+
+		pairs := slices.Clone(acl.LabelFilterPairs)
+		for _, pair := range sharedPairs {
+			pairs = appendPair(pairs, pair)
+		}
+		// Shared values might give access to everything
+		if sharedPairs == nil {
+			pairs = nil
+		}
+		shared.LabelFilterPairs = pairs
+	}
+
+	acl.LabelFilter = shared.LabelFilter
+	acl.LabelFilterPairs = shared.LabelFilterPairs
+	acl.RawACL = shared.RawACL
+	acl.DenyLabelFilter = shared.DenyLabelFilter
+	acl.RawDenyACL = shared.RawDenyACL
+
+	return acl, nil
+}
@@ -0,0 +1,88 @@
+package querymodifier
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/metricsql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACL_WithSharedValues(t *testing.T) {
+	shared := []string{"kube-public", "monitoring-shared"}
+
+	tests := []struct {
+		name   string
+		rawACL string
+		want   string
+	}{
+		{
+			name:   "Single namespace",
+			rawACL: "minio",
+			want:   "minio, kube-public, monitoring-shared",
+		},
+		{
+			name:   "Regexps",
+			rawACL: "team-.*",
+			want:   "team-.*, kube-public, monitoring-shared",
+		},
+		{
+			name:   "Denied values take precedence",
+			rawACL: "team-.*, !kube-public",
+			want:   "team-.*, kube-public, monitoring-shared",
+		},
+		{
+			name:   "Full access",
+			rawACL: ".*",
+			want:   ".*",
+		},
+		{
+			name:   "Only denied values",
+			rawACL: "!secret",
+			want:   ".*",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := NewACL(tt.rawACL)
+			assert.Nil(t, err)
+			acl.ForcedParams = map[string]string{"deny_partial_response": "1"}
+
+			got, err := acl.WithSharedValues(shared)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got.RawACL)
+			assert.Equal(t, acl.RawDenyACL, got.RawDenyACL)
+			assert.Equal(t, acl.ForcedParams, got.ForcedParams)
+		})
+	}
+
+	t.Run("Pairs", func(t *testing.T) {
+		acl, err := NewACL("prod:minio")
+		assert.Nil(t, err)
+
+		got, err := acl.WithSharedValues(shared)
+		assert.Nil(t, err)
+		assert.Len(t, got.LabelFilterPairs, 3)
+	})
+
+	t.Run("Pairs of merged roles", func(t *testing.T) {
+		aclTeamA, err := NewACLWithLabels(DefaultLabel, "team-a", map[string]string{"cluster": "prod"})
+		assert.Nil(t, err)
+
+		aclTeamB, err := NewACL("team-b")
+		assert.Nil(t, err)
+
+		acl, err := ACLs{"team-a": aclTeamA, "team-b": aclTeamB}.GetUserACL([]string{"team-a", "team-b"}, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		got, err := acl.WithSharedValues(shared)
+		assert.Nil(t, err)
+		assert.Equal(t, "team-a, team-b, kube-public, monitoring-shared", got.RawACL)
+		assert.Equal(t, append(acl.LabelFilterPairs, []metricsql.LabelFilter{
+			{Label: "namespace", Value: "kube-public"},
+		}, []metricsql.LabelFilter{
+			{Label: "namespace", Value: "monitoring-shared"},
+		}), got.LabelFilterPairs)
+	})
+}
@@ -0,0 +1,88 @@
+package querymodifier
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// Policies for selectors of metrics that don't carry the enforced label
+const (
+	// UnlabeledPolicyInject adds label filters of the ACL anyway (such selectors return nothing for restricted users)
+	UnlabeledPolicyInject = "inject"
+	// UnlabeledPolicySkip leaves such selectors unmodified, names of the metrics are collected in QueryModifier.SkippedMetrics for auditing
+	UnlabeledPolicySkip = "skip"
+	// UnlabeledPolicyReject rejects queries containing such selectors
+	UnlabeledPolicyReject = "reject"
+)
+
+// ErrUnlabeledMetric is returned for queries with selectors of unlabeled metrics if UnlabeledPolicyReject is used
+var ErrUnlabeledMetric = errors.New("query contains a metric that doesn't carry the enforced label")
+
+// NewUnlabeledMetricsRegexp returns an anchored regular expression matching any of the metric names (regular expressions are supported). Nil is returned for an empty list.
+func NewUnlabeledMetricsRegexp(metrics []string) (*regexp.Regexp, error) {
+	patterns := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+
+		if _, err := regexp.Compile(m); err != nil {
+			return nil, fmt.Errorf("invalid unlabeled metric %q: %w", m, err)
+		}
+		patterns = append(patterns, "(?:"+m+")")
+	}
+
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	return regexp.Compile("^(?:" + strings.Join(patterns, "|") + ")$")
+}
+
+// unlabeledMetricName returns the name of the metric if the selector refers to an unlabeled metric. Only exact names (e.g. up or {__name__="up"}) are considered.
+func (qm *QueryModifier) unlabeledMetricName(me *metricsql.MetricExpr) (string, bool) {
+	if qm.UnlabeledMetrics == nil {
+		return "", false
+	}
+
+	for _, lf := range me.LabelFilters {
+		if lf.Label == metricNameLabel && !lf.IsRegexp && !lf.IsNegative {
+			return lf.Value, qm.UnlabeledMetrics.MatchString(lf.Value)
+		}
+	}
+
+	return "", false
+}
+
+// skipsUnlabeledMetric returns true if the selector refers to an unlabeled metric and such selectors are left unmodified.
+func (qm *QueryModifier) skipsUnlabeledMetric(me *metricsql.MetricExpr) bool {
+	if qm.UnlabeledPolicy != UnlabeledPolicySkip {
+		return false
+	}
+
+	_, unlabeled := qm.unlabeledMetricName(me)
+	return unlabeled
+}
+
+// checkUnlabeledMetrics returns ErrUnlabeledMetric if the policy is to reject selectors of unlabeled metrics and the expression contains any.
+func (qm *QueryModifier) checkUnlabeledMetrics(expr metricsql.Expr) error {
+	if qm.UnlabeledPolicy != UnlabeledPolicyReject {
+		return nil
+	}
+
+	var err error
+	metricsql.VisitAll(expr, func(expr metricsql.Expr) {
+		if me, ok := expr.(*metricsql.MetricExpr); ok && err == nil {
+			if name, unlabeled := qm.unlabeledMetricName(me); unlabeled {
+				err = fmt.Errorf("%w: %s", ErrUnlabeledMetric, name)
+			}
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,54 @@
+package querymodifier
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewUnlabeledMetricsRegexp(t *testing.T) {
+	re, err := NewUnlabeledMetricsRegexp([]string{"up", " scrape_.* ", ""})
+	assert.Nil(t, err)
+	assert.True(t, re.MatchString("up"))
+	assert.True(t, re.MatchString("scrape_samples_scraped"))
+	assert.False(t, re.MatchString("uptime"))
+
+	re, err = NewUnlabeledMetricsRegexp(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, re)
+
+	_, err = NewUnlabeledMetricsRegexp([]string{"up("})
+	assert.NotNil(t, err)
+}
+
+func TestQueryModifier_unlabeledMetrics(t *testing.T) {
+	acl, err := NewACL("minio")
+	assert.Nil(t, err)
+
+	unlabeled, err := NewUnlabeledMetricsRegexp([]string{"up"})
+	assert.Nil(t, err)
+
+	t.Run("Skipped metrics are collected", func(t *testing.T) {
+		qm := QueryModifier{
+			ACL:              acl,
+			UnlabeledMetrics: unlabeled,
+			UnlabeledPolicy:  UnlabeledPolicySkip,
+		}
+
+		_, err := qm.GetModifiedEncodedURLValues(url.Values{"query": {"up * on() node_load1"}})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"up"}, qm.SkippedMetrics)
+	})
+
+	t.Run("Rejected metrics", func(t *testing.T) {
+		qm := QueryModifier{
+			ACL:              acl,
+			UnlabeledMetrics: unlabeled,
+			UnlabeledPolicy:  UnlabeledPolicyReject,
+		}
+
+		_, err := qm.GetModifiedEncodedURLValues(url.Values{"query": {"up"}})
+		assert.ErrorIs(t, err, ErrUnlabeledMetric)
+	})
+}
@@ -0,0 +1,57 @@
+package querymodifier
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UserKeyPrefix marks ACLs assigned to users (defined under users in acl.yaml) rather than to roles. Such ACLs are kept along with role ACLs, so they're merged with them in the same way, but they're never matched against roles found in tokens directly.
+const UserKeyPrefix = "user:"
+
+// IsReservedKey returns true if an ACL key belongs to a user or a client definition rather than to a role.
+func IsReservedKey(key string) bool {
+	return strings.HasPrefix(key, UserKeyPrefix) || strings.HasPrefix(key, ClientKeyPrefix)
+}
+
+// userKey returns an ACL key for a user definition from acl.yaml: an email (alice@example.com) or all emails of a domain (*@payments.example.com). Emails are case-insensitive.
+func userKey(user string) (string, error) {
+	user = strings.ToLower(strings.TrimSpace(user))
+
+	local, domain, ok := strings.Cut(user, "@")
+	if !ok || local == "" || domain == "" || strings.Contains(domain, "@") || (strings.Contains(local, "*") && local != "*") {
+		return "", fmt.Errorf("%q user must be an email or a domain wildcard (*@example.com)", user)
+	}
+
+	return UserKeyPrefix + user, nil
+}
+
+// UserRoles returns keys of user ACLs matching the email (both the email itself and its domain wildcard), so they can be passed to GetUserACL along with roles. Only existing keys are returned, otherwise they'd be treated as raw ACLs in assumed roles mode.
+func (a ACLs) UserRoles(email string) []string {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok || domain == "" {
+		return nil
+	}
+
+	var roles []string
+	for _, key := range []string{UserKeyPrefix + email, UserKeyPrefix + "*@" + domain} {
+		if _, exists := a[key]; exists {
+			roles = append(roles, key)
+		}
+	}
+
+	return roles
+}
+
+// WithoutReservedRoles returns roles except for those looking like user or client ACL keys, so a role in a token can never grant access defined for a user or a client.
+func WithoutReservedRoles(roles []string) []string {
+	filtered := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if !IsReservedKey(role) {
+			filtered = append(filtered, role)
+		}
+	}
+
+	return filtered
+}
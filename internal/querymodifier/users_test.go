@@ -0,0 +1,82 @@
+package querymodifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACLs_UserRoles(t *testing.T) {
+	acls, _, err := NewACLsFromBytes([]byte(`version: 2
+roles:
+  team-a: a
+users:
+  Alice@Example.com: alice
+  "*@payments.example.com":
+    extends: team-a
+    namespaces: payments
+`), DefaultLabel)
+	assert.Nil(t, err)
+
+	t.Run("Email and domain", func(t *testing.T) {
+		assert.Equal(t, []string{"user:alice@example.com"}, acls.UserRoles("alice@EXAMPLE.com"))
+		assert.Equal(t, []string{"user:*@payments.example.com"}, acls.UserRoles("bob@payments.example.com"))
+		assert.Nil(t, acls.UserRoles("bob@example.com"))
+		assert.Nil(t, acls.UserRoles(""))
+	})
+
+	t.Run("Merged with roles", func(t *testing.T) {
+		roles := append([]string{"team-a"}, acls.UserRoles("alice@example.com")...)
+		got, err := acls.GetUserACL(roles, false, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL("a, alice")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("Users might extend roles", func(t *testing.T) {
+		got, err := acls.GetUserACL(acls.UserRoles("bob@payments.example.com"), false, DefaultLabel)
+		assert.Nil(t, err)
+
+		want, err := NewACL("a, payments")
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	})
+}
+
+func TestNewACLsFromBytes_Users(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "Not an email",
+			content: "version: 2\nroles: {}\nusers:\n  alice: a\n",
+		},
+		{
+			name:    "Partial wildcard",
+			content: "version: 2\nroles: {}\nusers:\n  \"a*@example.com\": a\n",
+		},
+		{
+			name:    "Duplicate users",
+			content: "version: 2\nroles: {}\nusers:\n  alice@example.com: a\n  ALICE@example.com: b\n",
+		},
+		{
+			name:    "Reserved prefix in roles",
+			content: "version: 2\nroles:\n  user:alice@example.com: a\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := NewACLsFromBytes([]byte(tt.content), DefaultLabel)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestWithoutReservedRoles(t *testing.T) {
+	assert.Equal(t, []string{"team-a"}, WithoutReservedRoles([]string{"team-a", "user:alice@example.com", "client:grafana"}))
+}